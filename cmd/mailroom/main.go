@@ -10,9 +10,11 @@ import (
 	_ "github.com/nyaruka/mailroom/v26/services/ivr/twiml"
 	_ "github.com/nyaruka/mailroom/v26/services/ivr/vonage"
 	_ "github.com/nyaruka/mailroom/v26/services/llm/anthropic"
+	_ "github.com/nyaruka/mailroom/v26/services/llm/bedrock"
 	_ "github.com/nyaruka/mailroom/v26/services/llm/google"
 	_ "github.com/nyaruka/mailroom/v26/services/llm/openai"
 	_ "github.com/nyaruka/mailroom/v26/services/llm/openai_azure"
+	_ "github.com/nyaruka/mailroom/v26/services/llm/openai_compat"
 	_ "github.com/nyaruka/mailroom/v26/web/android"
 	_ "github.com/nyaruka/mailroom/v26/web/campaign"
 	_ "github.com/nyaruka/mailroom/v26/web/channel"
@@ -22,6 +24,7 @@ import (
 	_ "github.com/nyaruka/mailroom/v26/web/msg"
 	_ "github.com/nyaruka/mailroom/v26/web/org"
 	_ "github.com/nyaruka/mailroom/v26/web/po"
+	_ "github.com/nyaruka/mailroom/v26/web/prompt"
 	_ "github.com/nyaruka/mailroom/v26/web/public"
 	_ "github.com/nyaruka/mailroom/v26/web/simulation"
 	_ "github.com/nyaruka/mailroom/v26/web/system"
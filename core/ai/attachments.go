@@ -0,0 +1,37 @@
+package ai
+
+import (
+	"context"
+
+	"github.com/nyaruka/goflow/utils"
+)
+
+// Attachments provides the attachments which requests are sent with, e.g. images sent by the contact that a call is
+// being made for
+type Attachments interface {
+	Load(ctx context.Context) []utils.Attachment // returns nil if the call has no attachments to send
+}
+
+// attachmentsService is an LLM service which adds attachments to requests
+type attachmentsService struct {
+	service     Service
+	attachments Attachments
+}
+
+// NewAttachmentsService wraps the given service so that requests which don't have attachments of their own are sent
+// with those from the given source at call time, e.g. so that flows can ask about photos that contacts send
+func NewAttachmentsService(svc Service, a Attachments) Service {
+	return &attachmentsService{service: svc, attachments: a}
+}
+
+func (s *attachmentsService) Call(ctx context.Context, req *Request) (*Response, error) {
+	if len(req.Attachments) == 0 {
+		if attachments := s.attachments.Load(ctx); len(attachments) > 0 {
+			call := *req
+			call.Attachments = attachments
+			req = &call
+		}
+	}
+
+	return s.service.Call(ctx, req)
+}
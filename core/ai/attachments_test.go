@@ -0,0 +1,45 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// attachments for testing which are fixed
+type fixedAttachments []utils.Attachment
+
+func (a fixedAttachments) Load(ctx context.Context) []utils.Attachment { return a }
+
+func TestAttachmentsService(t *testing.T) {
+	ctx := context.Background()
+	llm := &fixedLLM{output: "A cat"}
+
+	// requests are sent with attachments from the source
+	svc := ai.NewAttachmentsService(llm, fixedAttachments{"image/jpeg:https://example.com/cat.jpg"})
+
+	req := &ai.Request{Instructions: "Describe the photo.", Input: "What's this?", MaxTokens: 10}
+	resp, err := svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "A cat", resp.Output)
+	assert.Equal(t, []utils.Attachment{"image/jpeg:https://example.com/cat.jpg"}, llm.last.Attachments)
+	assert.Nil(t, req.Attachments) // original request is unchanged
+
+	// unless they have attachments of their own
+	req = &ai.Request{Instructions: "Describe the photo.", Input: "What's this?", MaxTokens: 10, Attachments: []utils.Attachment{"image/png:https://example.com/dog.png"}}
+	_, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, []utils.Attachment{"image/png:https://example.com/dog.png"}, llm.last.Attachments)
+
+	// and requests are unchanged if there are no attachments to add
+	svc = ai.NewAttachmentsService(llm, fixedAttachments(nil))
+
+	req = &ai.Request{Instructions: "Describe the photo.", Input: "What's this?", MaxTokens: 10}
+	_, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Same(t, req, llm.last)
+}
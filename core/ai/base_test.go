@@ -0,0 +1,33 @@
+package ai_test
+
+import (
+	"context"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+)
+
+// LLM service for testing which returns a fixed output and records requests
+type fixedLLM struct {
+	output string
+	calls  int
+	last   *ai.Request
+}
+
+func (s *fixedLLM) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	s.calls++
+	s.last = req
+	return &ai.Response{Output: s.output, TokensInput: 10, TokensOutput: 1}, nil
+}
+
+// LLM service for testing which returns each of a sequence of outputs in turn
+type sequenceLLM struct {
+	outputs  []string
+	requests []*ai.Request
+}
+
+func (s *sequenceLLM) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	s.requests = append(s.requests, req)
+	output := s.outputs[0]
+	s.outputs = s.outputs[1:]
+	return &ai.Response{Output: output, TokensInput: 10, TokensOutput: 5}, nil
+}
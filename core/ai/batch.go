@@ -0,0 +1,59 @@
+package ai
+
+import (
+	"context"
+	"errors"
+)
+
+// BatchCostRatio is the fraction of the normal cost of requests which is charged for requests processed as a batch
+const BatchCostRatio = 0.5
+
+// BatchService is a service which can process requests offline as a batch, at lower cost but with results only
+// available some time later, e.g. for large jobs which aren't interactive
+type BatchService interface {
+	// SubmitBatch submits the given requests to be processed as a batch, returning the ID of the batch
+	SubmitBatch(ctx context.Context, reqs []*Request) (string, error)
+
+	// SubmitEmbeddingBatch submits the given sets of inputs to be embedded as a batch, returning the ID of the batch
+	SubmitEmbeddingBatch(ctx context.Context, inputs [][]string) (string, error)
+
+	// CollectBatch collects the results of a batch in the order of its requests, or nil if it hasn't finished yet
+	CollectBatch(ctx context.Context, id string) ([]*BatchResult, error)
+}
+
+// BatchResult is the result of a single request in a batch, which is either output or vectors, or an error
+type BatchResult struct {
+	Output       string      `json:"output,omitempty"`
+	Vectors      [][]float32 `json:"vectors,omitempty"`
+	TokensInput  int64       `json:"tokens_input,omitempty"`
+	TokensOutput int64       `json:"tokens_output,omitempty"`
+	Error        string      `json:"error,omitempty"`
+}
+
+// SubmitBatch submits the given requests as a batch using the underlying service, if it supports batches
+func (s *LLMService) SubmitBatch(ctx context.Context, reqs []*Request) (string, error) {
+	if bs, ok := s.provider.(BatchService); ok {
+		var id string
+		err := s.passthrough(ctx, func() (err error) { id, err = bs.SubmitBatch(ctx, reqs); return err })
+		return id, err
+	}
+	return "", errors.New("LLM service doesn't support batches")
+}
+
+// SubmitEmbeddingBatch submits the given inputs as a batch using the underlying service, if it supports batches
+func (s *LLMService) SubmitEmbeddingBatch(ctx context.Context, inputs [][]string) (string, error) {
+	if bs, ok := s.provider.(BatchService); ok {
+		var id string
+		err := s.passthrough(ctx, func() (err error) { id, err = bs.SubmitEmbeddingBatch(ctx, inputs); return err })
+		return id, err
+	}
+	return "", errors.New("LLM service doesn't support batches")
+}
+
+// CollectBatch collects the results of a batch using the underlying service, if it supports batches
+func (s *LLMService) CollectBatch(ctx context.Context, id string) ([]*BatchResult, error) {
+	if bs, ok := s.provider.(BatchService); ok {
+		return bs.CollectBatch(ctx, id)
+	}
+	return nil, errors.New("LLM service doesn't support batches")
+}
@@ -0,0 +1,23 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	svc := ai.NewLLMService(&fixedLLM{output: "Hola"})
+
+	_, err := svc.SubmitBatch(ctx, []*ai.Request{{Input: "Hello"}})
+	assert.EqualError(t, err, "LLM service doesn't support batches")
+
+	_, err = svc.SubmitEmbeddingBatch(ctx, [][]string{{"Hello"}})
+	assert.EqualError(t, err, "LLM service doesn't support batches")
+
+	_, err = svc.CollectBatch(ctx, "batch_123")
+	assert.EqualError(t, err, "LLM service doesn't support batches")
+}
@@ -0,0 +1,54 @@
+package ai
+
+import (
+	"context"
+	"errors"
+)
+
+// Breaker decides whether calls to a provider should be attempted based on the outcomes of previous calls, e.g. with
+// state shared between instances
+type Breaker interface {
+	Allow(ctx context.Context) (bool, error)
+	Success(ctx context.Context) error
+	Failure(ctx context.Context) error
+}
+
+// breakerService is an LLM service which fast-fails calls while its breaker is open
+type breakerService struct {
+	service Service
+	breaker Breaker
+}
+
+// NewBreakerService wraps the given service so that calls fail immediately with an unavailable error while the given
+// breaker is open. Failures which suggest the provider is unhealthy, i.e. transient errors and errors that didn't get
+// a response from the provider, count towards opening it. Failures of the breaker itself don't fail calls.
+func NewBreakerService(svc Service, b Breaker) Service {
+	return &breakerService{service: svc, breaker: b}
+}
+
+func (s *breakerService) Call(ctx context.Context, req *Request) (*Response, error) {
+	if allowed, err := s.breaker.Allow(ctx); err == nil && !allowed {
+		return nil, &ServiceError{Message: "LLM provider unavailable as recent calls have failed", Code: ErrorUnavailable, Instructions: req.Instructions, Input: req.Input}
+	}
+
+	resp, err := s.service.Call(ctx, req)
+	if err != nil {
+		if ctx.Err() == nil && IsProviderFailure(err) {
+			s.breaker.Failure(ctx)
+		}
+		return nil, err
+	}
+
+	s.breaker.Success(ctx)
+	return resp, nil
+}
+
+// IsProviderFailure returns whether the given error suggests the provider is unhealthy rather than there being a problem
+// with the request
+func IsProviderFailure(err error) bool {
+	var serr *ServiceError
+	if errors.As(err, &serr) {
+		return IsTransient(serr) || (serr.Code == ErrorUnknown && serr.StatusCode == 0)
+	}
+	return true
+}
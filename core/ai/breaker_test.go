@@ -0,0 +1,63 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// breaker for testing which opens after a number of consecutive failures and stays open until a success
+type testBreaker struct {
+	threshold int
+	failures  int
+}
+
+func (b *testBreaker) Allow(ctx context.Context) (bool, error) { return !b.open(), nil }
+func (b *testBreaker) Success(ctx context.Context) error       { b.failures = 0; return nil }
+func (b *testBreaker) Failure(ctx context.Context) error       { b.failures++; return nil }
+func (b *testBreaker) open() bool                              { return b.failures >= b.threshold }
+
+func TestBreakerService(t *testing.T) {
+	ctx := context.Background()
+	req := &ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100}
+
+	breaker := &testBreaker{threshold: 2}
+
+	// errors which are the request's problem don't count against the provider
+	llm := &erroringLLM{err: &ai.ServiceError{Message: "401 Unauthorized", Code: ai.ErrorCredentials, StatusCode: 401}}
+	svc := ai.NewBreakerService(llm, breaker)
+	for range 3 {
+		_, err := svc.Call(ctx, req)
+		assert.EqualError(t, err, "401 Unauthorized")
+	}
+	assert.False(t, breaker.open())
+
+	// but server errors and connection errors do
+	svc = ai.NewBreakerService(&erroringLLM{err: &ai.ServiceError{Message: "503 Service Unavailable", Code: ai.ErrorUnknown, StatusCode: 503}}, breaker)
+	svc.Call(ctx, req)
+	svc = ai.NewBreakerService(&erroringLLM{err: errors.New("connection refused")}, breaker)
+	svc.Call(ctx, req)
+	assert.True(t, breaker.open())
+
+	// once open, calls fail fast
+	ok := &fixedLLM{output: "Hola"}
+	svc = ai.NewBreakerService(ok, breaker)
+	_, err := svc.Call(ctx, req)
+	assert.EqualError(t, err, "LLM provider unavailable as recent calls have failed")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorUnavailable, serr.Code)
+	}
+	assert.Equal(t, 0, ok.calls)
+
+	// a success closes it again
+	breaker = &testBreaker{threshold: 2, failures: 1}
+	resp, err := ai.NewBreakerService(ok, breaker).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Equal(t, 0, breaker.failures)
+}
@@ -0,0 +1,49 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+)
+
+// Budget accounts for the tokens spent on LLM calls and limits further calls once they exceed some budget
+type Budget interface {
+	Exceeded(ctx context.Context) (bool, error)
+	Spend(ctx context.Context, tokens int64) error
+}
+
+// budgetService is an LLM service which accounts for token spend against a budget
+type budgetService struct {
+	service Service
+	budget  Budget
+}
+
+// NewBudgetService wraps the given service so that the tokens of every call are spent from the given budget, and
+// calls made once it is exceeded are rejected. Failures to check or record spend don't fail calls.
+func NewBudgetService(svc Service, b Budget) Service {
+	return &budgetService{service: svc, budget: b}
+}
+
+func (s *budgetService) Call(ctx context.Context, req *Request) (*Response, error) {
+	var diagnostics []string
+
+	exceeded, err := s.budget.Exceeded(ctx)
+	if err != nil {
+		diagnostics = append(diagnostics, fmt.Sprintf("error checking token budget: %s", err))
+	} else if exceeded {
+		return nil, &ServiceError{Message: "token budget exceeded", Code: ErrorBudgetExceeded, Instructions: req.Instructions, Input: req.Input}
+	}
+
+	resp, err := s.service.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if tokens := resp.TokensInput + resp.TokensOutput; tokens > 0 {
+		if err := s.budget.Spend(ctx, tokens); err != nil {
+			diagnostics = append(diagnostics, fmt.Sprintf("error recording token spend: %s", err))
+		}
+	}
+
+	resp.Diagnostics = append(resp.Diagnostics, diagnostics...)
+	return resp, nil
+}
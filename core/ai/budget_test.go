@@ -0,0 +1,58 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// budget for testing which has a fixed limit
+type fixedBudget struct {
+	limit int64
+	spent int64
+	err   error
+}
+
+func (b *fixedBudget) Exceeded(ctx context.Context) (bool, error) { return b.spent >= b.limit, b.err }
+
+func (b *fixedBudget) Spend(ctx context.Context, tokens int64) error {
+	b.spent += tokens
+	return b.err
+}
+
+func TestBudgetService(t *testing.T) {
+	ctx := context.Background()
+	llm := &fixedLLM{output: "Hola"}
+	budget := &fixedBudget{limit: 20}
+	svc := ai.NewBudgetService(llm, budget)
+
+	req := &ai.Request{Instructions: "Translate to Spanish", Input: "Hello", MaxTokens: 10}
+
+	// each call spends 11 tokens so the second call takes us over the limit
+	for range 2 {
+		resp, err := svc.Call(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, "Hola", resp.Output)
+		assert.Nil(t, resp.Diagnostics)
+	}
+	assert.Equal(t, int64(22), budget.spent)
+
+	_, err := svc.Call(ctx, req)
+	assert.EqualError(t, err, "token budget exceeded")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorBudgetExceeded, serr.Code)
+	}
+	assert.Equal(t, 2, llm.calls)
+
+	// budget errors don't fail calls
+	svc = ai.NewBudgetService(llm, &fixedBudget{limit: 20, err: errors.New("boom")})
+
+	resp, err := svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"error checking token budget: boom", "error recording token spend: boom"}, resp.Diagnostics)
+}
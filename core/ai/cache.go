@@ -0,0 +1,18 @@
+package ai
+
+// the cache status of a response, according to how many of its input tokens were read from the provider's prompt cache
+const (
+	CacheHit     = "hit"
+	CacheMiss    = "miss"
+	CachePartial = "partial"
+)
+
+// CacheStatusFor returns the cache status for a response where the given number of its input tokens were cached
+func CacheStatusFor(cached, input int64) string {
+	if cached <= 0 {
+		return CacheMiss
+	} else if cached >= input {
+		return CacheHit
+	}
+	return CachePartial
+}
@@ -0,0 +1,15 @@
+package ai_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheStatusFor(t *testing.T) {
+	assert.Equal(t, ai.CacheMiss, ai.CacheStatusFor(0, 1500))
+	assert.Equal(t, ai.CacheMiss, ai.CacheStatusFor(0, 0))
+	assert.Equal(t, ai.CachePartial, ai.CacheStatusFor(1024, 1500))
+	assert.Equal(t, ai.CacheHit, ai.CacheStatusFor(1500, 1500))
+}
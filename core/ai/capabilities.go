@@ -0,0 +1,29 @@
+package ai
+
+// ServiceCapabilities are the features supported by an LLM service
+type ServiceCapabilities struct {
+	Streaming  bool `json:"streaming"`
+	Tools      bool `json:"tools"`
+	Vision     bool `json:"vision"`
+	Embeddings bool `json:"embeddings"`
+	JSONMode   bool `json:"json_mode"`
+	JSONSchema bool `json:"json_schema"`
+}
+
+// CapableService is an LLM service which can report its capabilities
+type CapableService interface {
+	Capabilities() ServiceCapabilities
+}
+
+// ModelCapabilities returns the capabilities of the given model when used via a provider with the given capabilities.
+// Features which depend on the model are only reported if the model is known to support them.
+func ModelCapabilities(model string, provider ServiceCapabilities) ServiceCapabilities {
+	caps := ServiceCapabilities{Streaming: provider.Streaming, Embeddings: provider.Embeddings, JSONMode: provider.JSONMode}
+
+	if info := LookupModel(model); info != nil {
+		caps.Tools = provider.Tools && info.Tools
+		caps.Vision = provider.Vision && info.Vision
+		caps.JSONSchema = provider.JSONSchema && info.JSONSchema
+	}
+	return caps
+}
@@ -0,0 +1,21 @@
+package ai_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelCapabilities(t *testing.T) {
+	provider := ai.ServiceCapabilities{Tools: true, Vision: true, JSONMode: true, JSONSchema: true}
+
+	assert.Equal(t, ai.ServiceCapabilities{Tools: true, Vision: true, JSONMode: true, JSONSchema: true}, ai.ModelCapabilities("gpt-4o", provider))
+	assert.Equal(t, ai.ServiceCapabilities{Tools: true, JSONMode: true}, ai.ModelCapabilities("gpt-3.5-turbo", provider))
+
+	// provider limits what the model can do
+	assert.Equal(t, ai.ServiceCapabilities{Tools: true, Vision: true}, ai.ModelCapabilities("claude-sonnet-4", ai.ServiceCapabilities{Tools: true, Vision: true}))
+
+	// unknown models only get provider level features
+	assert.Equal(t, ai.ServiceCapabilities{JSONMode: true}, ai.ModelCapabilities("my-custom-model", provider))
+}
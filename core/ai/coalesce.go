@@ -0,0 +1,91 @@
+package ai
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Coalescer merges identical requests which arrive while a call is in flight or within a window of its start into
+// that single call. It is shared by all services for an LLM so that it can span sessions.
+type Coalescer struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done chan struct{}
+	resp *Response
+	err  error
+}
+
+// NewCoalescer creates a new coalescer with the given window
+func NewCoalescer(window time.Duration) *Coalescer {
+	return &Coalescer{window: window, calls: make(map[string]*coalescedCall)}
+}
+
+// do makes the call for the given key, or waits for and returns the result of an existing call for the same key. The
+// call is made on a context detached from the caller which started it, so that it canceling doesn't fail the others
+// waiting on it, and each caller stops waiting if its own context is canceled. The returned bool is whether the result
+// was shared from another call.
+func (c *Coalescer) do(ctx context.Context, key string, fn func(context.Context) (*Response, error)) (*Response, error, bool) {
+	c.mu.Lock()
+	call, shared := c.calls[key]
+	if !shared {
+		call = &coalescedCall{done: make(chan struct{})}
+		c.calls[key] = call
+	}
+	c.mu.Unlock()
+
+	if !shared {
+		go func() {
+			start := time.Now()
+			call.resp, call.err = fn(context.WithoutCancel(ctx))
+			close(call.done)
+
+			// keep the call around for anything else arriving within the window
+			time.AfterFunc(c.window-time.Since(start), func() {
+				c.mu.Lock()
+				if c.calls[key] == call {
+					delete(c.calls, key)
+				}
+				c.mu.Unlock()
+			})
+		}()
+	}
+
+	select {
+	case <-call.done:
+		return call.resp, call.err, shared
+	case <-ctx.Done():
+		return nil, ctx.Err(), shared
+	}
+}
+
+// coalescingService is an LLM service which merges identical requests using a coalescer
+type coalescingService struct {
+	service   Service
+	coalescer *Coalescer
+	scope     string
+}
+
+// NewCoalescingService wraps the given service so that identical requests within the same scope are coalesced. Callers
+// whose request was coalesced into another get a copy of its response with no token usage, as no spend was incurred.
+func NewCoalescingService(svc Service, c *Coalescer, scope string) Service {
+	return &coalescingService{service: svc, coalescer: c, scope: scope}
+}
+
+func (s *coalescingService) Call(ctx context.Context, req *Request) (*Response, error) {
+	key := s.scope + ":" + HashRequest(req, nil)
+
+	resp, err, shared := s.coalescer.do(ctx, key, func(ctx context.Context) (*Response, error) { return s.service.Call(ctx, req) })
+	if err != nil || !shared {
+		return resp, err
+	}
+
+	coalesced := *resp
+	coalesced.TokensInput, coalesced.TokensOutput = 0, 0
+	return &coalesced, nil
+}
@@ -0,0 +1,92 @@
+package ai_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// LLM service for testing which takes some time to respond and counts calls
+type slowLLM struct {
+	delay time.Duration
+	calls atomic.Int32
+}
+
+func (s *slowLLM) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	s.calls.Add(1)
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &ai.Response{Output: "Hola", TokensInput: 10, TokensOutput: 1}, nil
+}
+
+func TestCoalescingService(t *testing.T) {
+	ctx := context.Background()
+	llm := &slowLLM{delay: 20 * time.Millisecond}
+	coalescer := ai.NewCoalescer(200 * time.Millisecond)
+	svc := ai.NewCoalescingService(llm, coalescer, "llm1")
+
+	req := &ai.Request{Instructions: "translate", Input: "Hello", MaxTokens: 100}
+
+	// staggered identical requests, the second arriving after the first has completed but within the window
+	resps := make([]*ai.Response, 3)
+	wg := sync.WaitGroup{}
+	for i, delay := range []time.Duration{0, 10 * time.Millisecond, 60 * time.Millisecond} {
+		wg.Go(func() {
+			time.Sleep(delay)
+			resp, err := svc.Call(ctx, req)
+			require.NoError(t, err)
+			resps[i] = resp
+		})
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), llm.calls.Load())
+	assert.Equal(t, &ai.Response{Output: "Hola", TokensInput: 10, TokensOutput: 1}, resps[0])
+	assert.Equal(t, &ai.Response{Output: "Hola"}, resps[1])
+	assert.Equal(t, &ai.Response{Output: "Hola"}, resps[2])
+
+	// a different request isn't coalesced
+	_, err := svc.Call(ctx, &ai.Request{Instructions: "translate", Input: "Goodbye", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), llm.calls.Load())
+
+	// nor is the same request in a different scope
+	_, err = ai.NewCoalescingService(llm, coalescer, "llm2").Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), llm.calls.Load())
+
+	// once the window has passed, the request is made again
+	time.Sleep(250 * time.Millisecond)
+
+	resp, err := svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, int32(4), llm.calls.Load())
+	assert.Equal(t, int64(10), resp.TokensInput)
+
+	// a caller which is canceled stops waiting without failing others waiting on the same call
+	time.Sleep(250 * time.Millisecond)
+
+	ctx1, cancel1 := context.WithCancel(ctx)
+	errs := make([]error, 2)
+	wg.Go(func() { _, errs[0] = svc.Call(ctx1, req) })
+	wg.Go(func() {
+		time.Sleep(5 * time.Millisecond)
+		_, errs[1] = svc.Call(ctx, req)
+	})
+	time.Sleep(10 * time.Millisecond)
+	cancel1()
+	wg.Wait()
+
+	assert.Equal(t, context.Canceled, errs[0])
+	assert.NoError(t, errs[1])
+	assert.Equal(t, int32(5), llm.calls.Load())
+}
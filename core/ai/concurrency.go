@@ -0,0 +1,58 @@
+package ai
+
+import (
+	"context"
+	"time"
+)
+
+// Slots limits how many LLM calls can be in progress at the same time
+type Slots chan struct{}
+
+// NewSlots creates slots for the given number of calls at the same time
+func NewSlots(n int) Slots {
+	return make(Slots, n)
+}
+
+// concurrencyService is an LLM service which only makes calls when there are free slots for them
+type concurrencyService struct {
+	service Service
+	slots   []Slots
+}
+
+// NewConcurrencyService wraps the given service so that each call waits until it has taken a slot from each of the
+// given slots, e.g. one for all providers and one for its provider, which are freed once it's done. Calls whose context
+// is done before they get their slots fail as unavailable, and the time calls spend waiting is added to their timings.
+func NewConcurrencyService(svc Service, slots ...Slots) Service {
+	return &concurrencyService{service: svc, slots: slots}
+}
+
+func (s *concurrencyService) Call(ctx context.Context, req *Request) (*Response, error) {
+	start := time.Now()
+
+	for i, slots := range s.slots {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			s.free(i)
+			return nil, &ServiceError{Message: "timed out waiting for a free slot to call LLM", Code: ErrorUnavailable, Instructions: req.Instructions, Input: req.Input}
+		}
+	}
+	defer s.free(len(s.slots))
+
+	wait := time.Since(start)
+
+	resp, err := s.service.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Timings.AddQueueWait(wait)
+	return resp, nil
+}
+
+// frees the first n slots
+func (s *concurrencyService) free(n int) {
+	for _, slots := range s.slots[:n] {
+		<-slots
+	}
+}
@@ -0,0 +1,58 @@
+package ai_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyService(t *testing.T) {
+	ctx := context.Background()
+	req := &ai.Request{Instructions: "Translate to Spanish", Input: "Hello", MaxTokens: 10}
+
+	all, openai := ai.NewSlots(3), ai.NewSlots(1)
+	svc := ai.NewConcurrencyService(&delayedLLM{delay: 50 * time.Millisecond, svc: &fixedLLM{output: "Hola"}}, all, openai)
+
+	// calls are made one at a time because of the smaller limit
+	resps := make([]*ai.Response, 3)
+	wg := &sync.WaitGroup{}
+	for i := range 3 {
+		wg.Go(func() {
+			var err error
+			resps[i], err = svc.Call(ctx, req)
+			assert.NoError(t, err)
+		})
+	}
+	wg.Wait()
+
+	var maxWait time.Duration
+	for _, resp := range resps {
+		require.NotNil(t, resp)
+		assert.Equal(t, "Hola", resp.Output)
+		maxWait = max(maxWait, resp.Timings.QueueWait)
+	}
+	assert.GreaterOrEqual(t, maxWait, 100*time.Millisecond)
+
+	// and all slots are freed afterwards
+	assert.Len(t, all, 0)
+	assert.Len(t, openai, 0)
+
+	// calls which can't get a slot before their context is done fail
+	openai <- struct{}{}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	_, err := svc.Call(timeoutCtx, req)
+	assert.EqualError(t, err, "timed out waiting for a free slot to call LLM")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorUnavailable, serr.Code)
+	}
+	assert.Len(t, all, 0)
+}
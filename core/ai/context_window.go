@@ -0,0 +1,89 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// contextWindowService is an LLM service which checks the estimated size of requests against a model's context window
+type contextWindowService struct {
+	service  Service
+	model    string
+	window   int
+	truncate bool
+}
+
+// NewContextWindowService wraps the given service so that requests whose estimated prompt tokens plus max tokens exceed
+// the given model's context window, and so are guaranteed to fail, either fail without being sent or have the oldest
+// turns of their history and then the oldest lines of their input dropped until they fit (truncate). Instructions are
+// never truncated.
+func NewContextWindowService(svc Service, model string, window int, truncate bool) Service {
+	return &contextWindowService{service: svc, model: model, window: window, truncate: truncate}
+}
+
+func (s *contextWindowService) Call(ctx context.Context, req *Request) (*Response, error) {
+	instructionsTokens, historyTokens, inputTokens := EstimateTokens(req.Instructions), estimateHistoryTokens(req.History), EstimateTokens(req.Input)
+	available := s.window - req.MaxTokens - instructionsTokens // for history and input
+
+	if historyTokens+inputTokens <= available {
+		return s.service.Call(ctx, req)
+	}
+
+	if s.truncate {
+		truncated := *req
+		for len(truncated.History) > 0 && estimateHistoryTokens(truncated.History)+inputTokens > available {
+			truncated.History = truncated.History[1:]
+		}
+		if inputTokens > available {
+			truncated.Input = truncateOldest(req.Input, available)
+		}
+
+		if truncated.Input != "" {
+			resp, err := s.service.Call(ctx, &truncated)
+			if err != nil {
+				return nil, err
+			}
+
+			if dropped := len(req.History) - len(truncated.History); dropped > 0 {
+				resp.Diagnostics = append(resp.Diagnostics, fmt.Sprintf("dropped %d oldest turns of history to fit context window", dropped))
+			}
+			if truncated.Input != req.Input {
+				resp.Diagnostics = append(resp.Diagnostics, fmt.Sprintf("input truncated from %d to %d estimated tokens to fit context window", inputTokens, EstimateTokens(truncated.Input)))
+			}
+			return resp, nil
+		}
+	}
+
+	return nil, &ServiceError{
+		Message:      fmt.Sprintf("estimated prompt of %d tokens plus max tokens of %d exceeds the context window of %d tokens for model %s", instructionsTokens+historyTokens+inputTokens, req.MaxTokens, s.window, s.model),
+		Code:         ErrorContextLength,
+		Instructions: req.Instructions,
+		Input:        req.Input,
+	}
+}
+
+func estimateHistoryTokens(history []*Turn) int {
+	tokens := 0
+	for _, t := range history {
+		tokens += EstimateTokens(t.Input) + EstimateTokens(t.Output)
+	}
+	return tokens
+}
+
+// drops the oldest, i.e. first, lines of the given text until it fits within the given number of tokens, returning
+// empty if even the last line doesn't fit
+func truncateOldest(text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+
+	lines := strings.Split(text, "\n")
+
+	for i := range lines {
+		if remaining := strings.Join(lines[i:], "\n"); EstimateTokens(remaining) <= maxTokens {
+			return remaining
+		}
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package ai_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextWindowService(t *testing.T) {
+	ctx := context.Background()
+
+	// 3 lines of 100 characters each, so 25 tokens each
+	input := strings.Repeat("a", 100) + "\n" + strings.Repeat("b", 100) + "\n" + strings.Repeat("c", 100)
+
+	// requests which fit are passed through unchanged
+	llm := &fixedLLM{output: "ok"}
+	svc := ai.NewContextWindowService(llm, "tiny", 200, false)
+
+	resp, err := svc.Call(ctx, &ai.Request{Instructions: "summarize", Input: input, MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, input, llm.last.Input)
+	assert.Nil(t, resp.Diagnostics)
+
+	// requests which don't fit error without being sent
+	_, err = svc.Call(ctx, &ai.Request{Instructions: "summarize", Input: input, MaxTokens: 150})
+	assert.EqualError(t, err, "estimated prompt of 79 tokens plus max tokens of 150 exceeds the context window of 200 tokens for model tiny")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorContextLength, serr.Code)
+	}
+	assert.Equal(t, 1, llm.calls)
+
+	// unless truncation is enabled, in which case the oldest lines of input are dropped
+	svc = ai.NewContextWindowService(llm, "tiny", 200, true)
+
+	resp, err = svc.Call(ctx, &ai.Request{Instructions: "summarize", Input: input, MaxTokens: 150})
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("c", 100), llm.last.Input)
+	assert.Equal(t, []string{"input truncated from 76 to 25 estimated tokens to fit context window"}, resp.Diagnostics)
+
+	// but if even the last line doesn't fit, we still error
+	_, err = svc.Call(ctx, &ai.Request{Instructions: "summarize", Input: input, MaxTokens: 190})
+	assert.ErrorAs(t, err, &serr)
+	assert.Equal(t, ai.ErrorContextLength, serr.Code)
+	assert.Equal(t, 2, llm.calls)
+
+	// history counts towards the prompt and its oldest turns are dropped first
+	history := []*ai.Turn{{Input: strings.Repeat("d", 100), Output: strings.Repeat("e", 100)}, {Input: "f", Output: "g"}}
+
+	resp, err = svc.Call(ctx, &ai.Request{Instructions: "summarize", Input: input, History: history, MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, history[1:], llm.last.History)
+	assert.Equal(t, input, llm.last.Input)
+	assert.Equal(t, []string{"dropped 1 oldest turns of history to fit context window"}, resp.Diagnostics)
+
+	svc = ai.NewContextWindowService(llm, "tiny", 200, false)
+
+	_, err = svc.Call(ctx, &ai.Request{Instructions: "summarize", Input: input, History: history, MaxTokens: 100})
+	assert.EqualError(t, err, "estimated prompt of 131 tokens plus max tokens of 100 exceeds the context window of 200 tokens for model tiny")
+}
@@ -0,0 +1,45 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+)
+
+// Fallback provides the response to give when calls can't be made, e.g. a message that an agent will follow up in the
+// language of the contact a call was made for
+type Fallback interface {
+	Response(ctx context.Context) string // empty if there's no fallback response in that context
+}
+
+// IsDegradable returns whether the given error means that the service is down, rate limited or over budget, rather than
+// something being wrong with the request, such that a fallback response can be given instead
+func IsDegradable(err error) bool {
+	return IsTransient(err) || ErrorCode(err) == ErrorBudgetExceeded
+}
+
+// degradingService is an LLM service which gives fallback responses when calls can't be made
+type degradingService struct {
+	service  Service
+	fallback Fallback
+}
+
+// NewDegradingService wraps the given service so that calls which fail because it's unavailable are given a fallback
+// response rather than an error, if there's one in the context of the call. Such responses are marked as degraded and
+// the error is recorded in their diagnostics.
+func NewDegradingService(svc Service, f Fallback) Service {
+	return &degradingService{service: svc, fallback: f}
+}
+
+func (s *degradingService) Call(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := s.service.Call(ctx, req)
+	if err == nil || !IsDegradable(err) || ctx.Err() != nil {
+		return resp, err
+	}
+
+	output := s.fallback.Response(ctx)
+	if output == "" {
+		return nil, err
+	}
+
+	return &Response{Output: output, Degraded: true, DegradedCode: ErrorCode(err), Diagnostics: []string{fmt.Sprintf("fallback response given as call failed: %s", err)}}, nil
+}
@@ -0,0 +1,58 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fallback for testing which gives a fixed response
+type fixedFallback string
+
+func (f fixedFallback) Response(ctx context.Context) string { return string(f) }
+
+func TestIsDegradable(t *testing.T) {
+	assert.True(t, ai.IsDegradable(&ai.ServiceError{Message: "rate limit exceeded", Code: ai.ErrorRateLimit}))
+	assert.True(t, ai.IsDegradable(&ai.ServiceError{Message: "LLM provider unavailable", Code: ai.ErrorUnavailable}))
+	assert.True(t, ai.IsDegradable(&ai.ServiceError{Message: "token budget exceeded", Code: ai.ErrorBudgetExceeded}))
+	assert.True(t, ai.IsDegradable(&ai.ServiceError{Message: "502 Bad Gateway", Code: ai.ErrorUnknown, StatusCode: 502}))
+	assert.False(t, ai.IsDegradable(&ai.ServiceError{Message: "401 Unauthorized", Code: ai.ErrorCredentials, StatusCode: 401}))
+	assert.False(t, ai.IsDegradable(&ai.ServiceError{Message: "prompt too long", Code: ai.ErrorContextLength}))
+	assert.False(t, ai.IsDegradable(errors.New("boom")))
+}
+
+func TestDegradingService(t *testing.T) {
+	ctx := context.Background()
+	req := &ai.Request{Instructions: "Answer the question", Input: "When are you open?", MaxTokens: 100}
+
+	// successful calls are untouched
+	svc := ai.NewDegradingService(&fixedLLM{output: "9am"}, fixedFallback("An agent will follow up."))
+	resp, err := svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "9am", resp.Output)
+	assert.False(t, resp.Degraded)
+
+	// calls which fail because the provider is unavailable get the fallback response
+	svc = ai.NewDegradingService(&erroringLLM{err: &ai.ServiceError{Message: "rate limit exceeded", Code: ai.ErrorRateLimit}}, fixedFallback("An agent will follow up."))
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "An agent will follow up.", resp.Output)
+	assert.True(t, resp.Degraded)
+	assert.Equal(t, ai.ErrorRateLimit, resp.DegradedCode)
+	assert.Equal(t, []string{"fallback response given as call failed: rate limit exceeded"}, resp.Diagnostics)
+	assert.Equal(t, int64(0), resp.TokensInput)
+
+	// unless there's no fallback response in the context of the call
+	svc = ai.NewDegradingService(&erroringLLM{err: &ai.ServiceError{Message: "rate limit exceeded", Code: ai.ErrorRateLimit}}, fixedFallback(""))
+	_, err = svc.Call(ctx, req)
+	assert.EqualError(t, err, "rate limit exceeded")
+
+	// other errors are returned as is
+	svc = ai.NewDegradingService(&erroringLLM{err: &ai.ServiceError{Message: "401 Unauthorized", Code: ai.ErrorCredentials, StatusCode: 401}}, fixedFallback("An agent will follow up."))
+	_, err = svc.Call(ctx, req)
+	assert.EqualError(t, err, "401 Unauthorized")
+}
@@ -0,0 +1,80 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// EmbeddingService is a service which can embed text as vectors, e.g. for retrieval of relevant knowledge
+type EmbeddingService interface {
+	Embed(ctx context.Context, inputs []string) ([][]float32, error)
+}
+
+// Embed embeds the given inputs using the underlying service, if it supports embeddings
+func (s *LLMService) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	if es, ok := s.provider.(EmbeddingService); ok {
+		var vectors [][]float32
+		err := s.passthroughUsage(ctx, func() (*Usage, error) {
+			var err error
+			vectors, err = es.Embed(ctx, inputs)
+
+			// embeddings are only billed for their inputs, which we estimate as not all providers report them
+			usage := &Usage{}
+			for _, in := range inputs {
+				usage.TokensInput += int64(EstimateTokens(in))
+			}
+			return usage, err
+		})
+		return vectors, err
+	}
+	return nil, errors.New("LLM service doesn't support embeddings")
+}
+
+// ChunkText splits the given text into chunks of whole paragraphs or sentences which are no more than roughly the
+// given number of tokens, unless a single sentence is longer than that.
+func ChunkText(text string, maxTokens int) []string {
+	var chunks []string
+	var current strings.Builder
+	currentTokens := 0
+
+	flush := func() {
+		if current.Len() > 0 {
+			chunks = append(chunks, current.String())
+			current.Reset()
+			currentTokens = 0
+		}
+	}
+	add := func(s, sep string, tokens int) {
+		if currentTokens > 0 && currentTokens+tokens > maxTokens {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteString(sep)
+		}
+		current.WriteString(s)
+		currentTokens += tokens
+	}
+
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+
+		if tokens := EstimateTokens(para); tokens <= maxTokens {
+			add(para, "\n\n", tokens)
+			continue
+		}
+
+		// paragraph is too big so chunk it by sentence, starting a new chunk for it
+		flush()
+		for _, sentence := range SplitSentences(para) {
+			add(sentence, " ", EstimateTokens(sentence))
+		}
+		flush()
+	}
+	flush()
+
+	return chunks
+}
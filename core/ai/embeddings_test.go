@@ -0,0 +1,65 @@
+package ai_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbed(t *testing.T) {
+	svc := ai.NewLLMService(&fixedLLM{output: "Hola"})
+	_, err := svc.Embed(context.Background(), []string{"Hello"})
+	assert.EqualError(t, err, "LLM service doesn't support embeddings")
+}
+
+// LLM service for testing which also supports embeddings
+type embeddingLLM struct {
+	fixedLLM
+	embeds int
+}
+
+func (s *embeddingLLM) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	s.embeds++
+	return [][]float32{{0.5, 0.25}}, nil
+}
+
+func TestEmbedGuarded(t *testing.T) {
+	ctx := context.Background()
+	provider := &embeddingLLM{}
+	guard := &testGuard{}
+	svc := ai.NewLLMService(provider).WithGuard(guard)
+
+	vectors, err := svc.Embed(ctx, []string{"Hello", "World"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{0.5, 0.25}}, vectors)
+	assert.Equal(t, []error{nil}, guard.done)
+	assert.Equal(t, []*ai.Usage{{TokensInput: int64(ai.EstimateTokens("Hello") + ai.EstimateTokens("World"))}}, guard.usage)
+
+	guard.closed = true
+
+	_, err = svc.Embed(ctx, []string{"Hello"})
+	assert.EqualError(t, err, "not allowed")
+	assert.Equal(t, 1, provider.embeds)
+	assert.Len(t, guard.done, 1)
+}
+
+func TestChunkText(t *testing.T) {
+	assert.Nil(t, ai.ChunkText("", 100))
+	assert.Nil(t, ai.ChunkText(" \n\n ", 100))
+	assert.Equal(t, []string{"Hello world."}, ai.ChunkText("Hello world.", 100))
+
+	// paragraphs are combined while they fit
+	assert.Equal(t, []string{"Short one.\n\nShort two.", "Short three."}, ai.ChunkText("Short one.\n\nShort two.\n\nShort three.", 6))
+
+	// paragraphs which don't fit are split by sentence
+	long := "The clinic opens at nine. " + strings.Repeat("Bring your card. ", 3) + "Parking is free."
+	assert.Equal(t, []string{
+		"Intro.",
+		"The clinic opens at nine. Bring your card.",
+		"Bring your card. Bring your card. Parking is free.",
+	}, ai.ChunkText("Intro.\n\n"+long, 12))
+}
@@ -0,0 +1,22 @@
+package ai
+
+import (
+	"maps"
+)
+
+var defaultEndpoints = map[string]string{}
+
+// RegisterDefaultEndpoint registers the API endpoint used by LLMs of the given type which don't have one configured
+func RegisterDefaultEndpoint(typ, endpoint string) {
+	defaultEndpoints[typ] = endpoint
+}
+
+// DefaultEndpoint returns the default API endpoint for LLMs of the given type, or empty if it has none
+func DefaultEndpoint(typ string) string {
+	return defaultEndpoints[typ]
+}
+
+// DefaultEndpoints returns the default API endpoints of all LLM types which have one
+func DefaultEndpoints() map[string]string {
+	return maps.Clone(defaultEndpoints)
+}
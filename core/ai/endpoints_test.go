@@ -0,0 +1,22 @@
+package ai_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultEndpoints(t *testing.T) {
+	ai.RegisterDefaultEndpoint("test_ai", "https://api.test.ai/v1/")
+
+	assert.Equal(t, "https://api.test.ai/v1/", ai.DefaultEndpoint("test_ai"))
+	assert.Equal(t, "", ai.DefaultEndpoint("custom_ai"))
+
+	endpoints := ai.DefaultEndpoints()
+	assert.Equal(t, "https://api.test.ai/v1/", endpoints["test_ai"])
+
+	// returned map is a copy
+	endpoints["test_ai"] = "https://other.test.ai/"
+	assert.Equal(t, "https://api.test.ai/v1/", ai.DefaultEndpoint("test_ai"))
+}
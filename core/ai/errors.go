@@ -1,17 +1,141 @@
 package ai
 
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/gocommon/stringsx"
+)
+
 const (
-	ErrorCredentials = "credentials"
-	ErrorRateLimit   = "ratelimit"
-	ErrorReasoning   = "reasoning"
-	ErrorUnknown     = "unknown"
+	ErrorCredentials     = "credentials"
+	ErrorRateLimit       = "ratelimit"
+	ErrorReasoning       = "reasoning"
+	ErrorMaxTokens       = "max_tokens"
+	ErrorInvalidJSON     = "invalid_json"
+	ErrorPromptInjection = "prompt_injection"
+	ErrorBudgetExceeded  = "budget_exceeded"
+	ErrorUnavailable     = "unavailable"
+	ErrorContentFiltered = "content_filtered" // provider refused the request or response for safety reasons
+	ErrorContextLength   = "context_length"   // prompt is too long for the model's context window
+	ErrorInvalidModel    = "invalid_model"    // model doesn't exist or isn't available to the account
+	ErrorUnknown         = "unknown"
 )
 
+// maximum number of characters of a raw error body that we include in an error message
+const maxErrorSnippetLength = 200
+
 type ServiceError struct {
 	Message      string
 	Code         string
+	StatusCode   int
+	RetryAfter   time.Duration // how long the provider asked us to wait before retrying, if it did
 	Instructions string
 	Input        string
 }
 
 func (e *ServiceError) Error() string { return e.Message }
+
+// ErrorCodeForStatus maps an HTTP status code returned by a provider to an error code
+func ErrorCodeForStatus(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return ErrorCredentials
+	case http.StatusTooManyRequests:
+		return ErrorRateLimit
+	case http.StatusRequestEntityTooLarge:
+		return ErrorContextLength
+	}
+	return ErrorUnknown
+}
+
+// ErrorCodeForType maps an error type or code returned by a provider to an error code, falling back to mapping the
+// HTTP status code if it's not one we recognize
+func ErrorCodeForType(typ string, status int) string {
+	switch typ {
+	case "content_filter", "content_policy_violation":
+		return ErrorContentFiltered
+	case "context_length_exceeded", "string_above_max_length":
+		return ErrorContextLength
+	case "model_not_found", "DeploymentNotFound":
+		return ErrorInvalidModel
+	}
+	return ErrorCodeForStatus(status)
+}
+
+// ErrorCode returns the error code of the given error if it's a service error, and otherwise ErrorUnknown
+func ErrorCode(err error) string {
+	if serr, ok := errors.AsType[*ServiceError](err); ok {
+		return serr.Code
+	}
+	return ErrorUnknown
+}
+
+// IsTransient returns whether the given error is likely to be temporary, i.e. a rate limit or a server error from the
+// provider or the provider being considered unavailable, such that the same request may succeed later or elsewhere
+func IsTransient(err error) bool {
+	var serr *ServiceError
+	if errors.As(err, &serr) {
+		return serr.Code == ErrorRateLimit || serr.Code == ErrorUnavailable || serr.StatusCode >= 500
+	}
+	return false
+}
+
+// ParseRetryAfter parses how long the given provider response asks us to wait before retrying, from a Retry-After
+// header as seconds or an HTTP date, or the non-standard retry-after-ms header. Returns zero if there's no such header.
+func ParseRetryAfter(r *http.Response) time.Duration {
+	if r == nil {
+		return 0
+	}
+	if ms, err := strconv.ParseFloat(r.Header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+
+	value := r.Header.Get("Retry-After")
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// NewRawResponseError checks for an error response whose body isn't JSON, e.g. an HTML or plain text error page
+// returned by a proxy or gateway in front of the provider, and returns an error which includes the status code and a
+// snippet of the body. Returns nil if the response is nil, isn't an error or has a JSON body that the provider's SDK
+// will have been able to parse.
+func NewRawResponseError(r *http.Response, instructions, input string) *ServiceError {
+	if r == nil || r.StatusCode < 400 || r.Body == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body)) // so that others can still read it
+
+	if err != nil || json.Valid(body) {
+		return nil
+	}
+
+	message := fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode))
+	if snippet := stringsx.TruncateEllipsis(strings.Join(strings.Fields(string(body)), " "), maxErrorSnippetLength); snippet != "" {
+		message += ": " + snippet
+	}
+
+	return &ServiceError{
+		Message:      message,
+		Code:         ErrorCodeForStatus(r.StatusCode),
+		StatusCode:   r.StatusCode,
+		RetryAfter:   ParseRetryAfter(r),
+		Instructions: instructions,
+		Input:        input,
+	}
+}
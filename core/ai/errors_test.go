@@ -0,0 +1,110 @@
+package ai_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCodeForStatus(t *testing.T) {
+	assert.Equal(t, ai.ErrorCredentials, ai.ErrorCodeForStatus(401))
+	assert.Equal(t, ai.ErrorRateLimit, ai.ErrorCodeForStatus(429))
+	assert.Equal(t, ai.ErrorUnknown, ai.ErrorCodeForStatus(500))
+	assert.Equal(t, ai.ErrorUnknown, ai.ErrorCodeForStatus(502))
+	assert.Equal(t, ai.ErrorContextLength, ai.ErrorCodeForStatus(413))
+}
+
+func TestErrorCodeForType(t *testing.T) {
+	assert.Equal(t, ai.ErrorContentFiltered, ai.ErrorCodeForType("content_filter", 400))
+	assert.Equal(t, ai.ErrorContentFiltered, ai.ErrorCodeForType("content_policy_violation", 400))
+	assert.Equal(t, ai.ErrorContextLength, ai.ErrorCodeForType("context_length_exceeded", 400))
+	assert.Equal(t, ai.ErrorInvalidModel, ai.ErrorCodeForType("model_not_found", 404))
+	assert.Equal(t, ai.ErrorInvalidModel, ai.ErrorCodeForType("DeploymentNotFound", 404))
+
+	// unrecognized types fall back to the status code
+	assert.Equal(t, ai.ErrorCredentials, ai.ErrorCodeForType("invalid_api_key", 401))
+	assert.Equal(t, ai.ErrorUnknown, ai.ErrorCodeForType("", 400))
+}
+
+func TestErrorCode(t *testing.T) {
+	assert.Equal(t, ai.ErrorRateLimit, ai.ErrorCode(&ai.ServiceError{Message: "slow down", Code: ai.ErrorRateLimit}))
+	assert.Equal(t, ai.ErrorContextLength, ai.ErrorCode(fmt.Errorf("error calling: %w", &ai.ServiceError{Code: ai.ErrorContextLength})))
+	assert.Equal(t, ai.ErrorUnknown, ai.ErrorCode(errors.New("boom")))
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, ai.IsTransient(&ai.ServiceError{Message: "slow down", Code: ai.ErrorRateLimit, StatusCode: 429}))
+	assert.True(t, ai.IsTransient(&ai.ServiceError{Message: "overloaded", Code: ai.ErrorUnknown, StatusCode: 503}))
+	assert.True(t, ai.IsTransient(&ai.ServiceError{Message: "breaker open", Code: ai.ErrorUnavailable}))
+	assert.True(t, ai.IsTransient(fmt.Errorf("error calling: %w", &ai.ServiceError{Code: ai.ErrorUnknown, StatusCode: 500})))
+	assert.False(t, ai.IsTransient(&ai.ServiceError{Message: "bad key", Code: ai.ErrorCredentials, StatusCode: 401}))
+	assert.False(t, ai.IsTransient(&ai.ServiceError{Message: "too long", Code: ai.ErrorMaxTokens}))
+	assert.False(t, ai.IsTransient(errors.New("boom")))
+}
+
+func TestNewRawResponseError(t *testing.T) {
+	newResponse := func(status int, body []byte) *http.Response {
+		return &http.Response{StatusCode: status, Body: io.NopCloser(bytes.NewReader(body))}
+	}
+
+	// no response (e.g. connection error), success response or JSON error body means no raw error
+	assert.Nil(t, ai.NewRawResponseError(nil, "", ""))
+	assert.Nil(t, ai.NewRawResponseError(newResponse(200, []byte(`<html></html>`)), "", ""))
+	assert.Nil(t, ai.NewRawResponseError(newResponse(401, []byte(`{"error": {"message": "Incorrect API key provided"}}`)), "", ""))
+
+	// HTML error page from a gateway
+	resp := newResponse(502, testsuite.ReadFile(t, "testdata/gateway_error.html"))
+	err := ai.NewRawResponseError(resp, "translate to Spanish", "Hello world")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "502 Bad Gateway: <html> <head><title>502 Bad Gateway</title></head> <body> <center><h1>502 Bad Gateway</h1></center> <hr><center>nginx/1.25.3</center> </body> </html>", err.Error())
+		assert.Equal(t, ai.ErrorUnknown, err.Code)
+		assert.Equal(t, 502, err.StatusCode)
+		assert.Equal(t, "translate to Spanish", err.Instructions)
+		assert.Equal(t, "Hello world", err.Input)
+	}
+
+	// body can still be read by others
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "nginx/1.25.3")
+
+	// plain text error with status we can map, and long bodies are truncated
+	err = ai.NewRawResponseError(newResponse(429, bytes.Repeat([]byte("slow down "), 50)), "", "")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, ai.ErrorRateLimit, err.Code)
+		assert.Len(t, []rune(err.Error()), len("429 Too Many Requests: ")+200)
+		assert.Contains(t, err.Error(), "slow down slow down")
+	}
+
+	// empty body
+	err = ai.NewRawResponseError(newResponse(401, nil), "", "")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "401 Unauthorized", err.Error())
+		assert.Equal(t, ai.ErrorCredentials, err.Code)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	newResponse := func(headers map[string]string) *http.Response {
+		r := &http.Response{Header: http.Header{}}
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		return r
+	}
+
+	assert.Equal(t, time.Duration(0), ai.ParseRetryAfter(nil))
+	assert.Equal(t, time.Duration(0), ai.ParseRetryAfter(newResponse(nil)))
+	assert.Equal(t, 20*time.Second, ai.ParseRetryAfter(newResponse(map[string]string{"Retry-After": "20"})))
+	assert.Equal(t, 1500*time.Millisecond, ai.ParseRetryAfter(newResponse(map[string]string{"Retry-After": "1.5"})))
+	assert.Equal(t, 250*time.Millisecond, ai.ParseRetryAfter(newResponse(map[string]string{"Retry-After": "1", "Retry-After-Ms": "250"})))
+	assert.Equal(t, time.Duration(0), ai.ParseRetryAfter(newResponse(map[string]string{"Retry-After": "Wed, 21 Oct 2015 07:28:00 GMT"})))
+	assert.Equal(t, time.Duration(0), ai.ParseRetryAfter(newResponse(map[string]string{"Retry-After": "soon"})))
+}
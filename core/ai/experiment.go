@@ -0,0 +1,112 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// ExperimentVariant is a variant of an experiment, which makes calls with its own service and optionally its own
+// instructions, in which "{instructions}" is replaced by the original instructions
+type ExperimentVariant struct {
+	Name         string
+	Model        string // model of the variant's service if it's not that of the experiment's
+	Service      Service
+	Instructions string
+	Weight       int
+}
+
+// ExperimentStore records which variant of an experiment each subject, e.g. a contact, got and the outcomes of calls
+type ExperimentStore interface {
+	Subject(ctx context.Context) string // returns "" if the request isn't on behalf of a subject
+	Variant(ctx context.Context, subject string) (string, error)
+	Record(ctx context.Context, subject, variant string, resp *Response, err error) error
+}
+
+// experimentService is an LLM service which splits calls between the variants of an experiment by subject
+type experimentService struct {
+	name     string
+	store    ExperimentStore
+	variants []*ExperimentVariant
+}
+
+// NewExperimentService creates a service which makes the calls of each subject with one of the given variants, chosen
+// by weight the first time and then stuck to, so that outcomes can be compared by variant. Calls which aren't on behalf
+// of a subject use the first variant and aren't recorded. Store errors don't fail calls but are noted in diagnostics.
+func NewExperimentService(name string, store ExperimentStore, variants ...*ExperimentVariant) Service {
+	return &experimentService{name: name, store: store, variants: variants}
+}
+
+func (s *experimentService) Call(ctx context.Context, req *Request) (*Response, error) {
+	subject := s.store.Subject(ctx)
+	if subject == "" {
+		return s.variants[0].Service.Call(ctx, req)
+	}
+
+	var diagnostics []string
+
+	assigned, err := s.store.Variant(ctx, subject)
+	if err != nil {
+		diagnostics = append(diagnostics, fmt.Sprintf("error getting experiment variant: %s", err))
+	}
+
+	// variants may have been removed since a subject was assigned to them
+	variant := s.variant(assigned)
+	if variant == nil {
+		variant = s.assign(subject)
+	}
+
+	call := *req
+	if variant.Instructions != "" {
+		call.Instructions = strings.ReplaceAll(variant.Instructions, "{instructions}", req.Instructions)
+	}
+
+	resp, err := variant.Service.Call(ctx, &call)
+
+	if rerr := s.store.Record(ctx, subject, variant.Name, resp, err); rerr != nil {
+		diagnostics = append(diagnostics, fmt.Sprintf("error recording experiment outcome: %s", rerr))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Model == "" {
+		resp.Model = variant.Model
+	}
+	resp.Diagnostics = append(resp.Diagnostics, fmt.Sprintf("experiment %s variant %s", s.name, variant.Name))
+	resp.Diagnostics = append(resp.Diagnostics, diagnostics...)
+	return resp, nil
+}
+
+func (s *experimentService) variant(name string) *ExperimentVariant {
+	for _, v := range s.variants {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// picks a variant for a subject by weight, deterministically so that it's the same if recording the assignment fails
+func (s *experimentService) assign(subject string) *ExperimentVariant {
+	total := 0
+	for _, v := range s.variants {
+		total += max(v.Weight, 0)
+	}
+	if total == 0 {
+		return s.variants[0]
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(s.name + ":" + subject))
+	n := int(h.Sum32() % uint32(total))
+
+	for _, v := range s.variants {
+		if n < max(v.Weight, 0) {
+			return v
+		}
+		n -= max(v.Weight, 0)
+	}
+	return s.variants[0]
+}
@@ -0,0 +1,96 @@
+package ai_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type subjectKey struct{}
+
+// experiment store for testing which keeps assignments and outcomes in memory
+type testExperimentStore struct {
+	assigned map[string]string
+	calls    map[string]int
+	failures map[string]int
+}
+
+func newTestExperimentStore() *testExperimentStore {
+	return &testExperimentStore{assigned: map[string]string{}, calls: map[string]int{}, failures: map[string]int{}}
+}
+
+func (s *testExperimentStore) Subject(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectKey{}).(string)
+	return subject
+}
+
+func (s *testExperimentStore) Variant(ctx context.Context, subject string) (string, error) {
+	return s.assigned[subject], nil
+}
+
+func (s *testExperimentStore) Record(ctx context.Context, subject, variant string, resp *ai.Response, err error) error {
+	s.assigned[subject] = variant
+	s.calls[variant]++
+	if err != nil {
+		s.failures[variant]++
+	}
+	return nil
+}
+
+func TestExperimentService(t *testing.T) {
+	req := &ai.Request{Instructions: "Translate to Spanish.", Input: "Hello", MaxTokens: 100}
+
+	control := &fixedLLM{output: "Hola"}
+	short := &fixedLLM{output: "Hola!"}
+	store := newTestExperimentStore()
+
+	svc := ai.NewExperimentService("greeting", store,
+		&ai.ExperimentVariant{Name: "control", Service: control, Weight: 1},
+		&ai.ExperimentVariant{Name: "short", Model: "gpt-4o-mini", Service: short, Instructions: "{instructions} Be brief.", Weight: 1},
+	)
+
+	// calls not on behalf of a subject use the first variant and aren't recorded
+	resp, err := svc.Call(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Nil(t, resp.Diagnostics)
+	assert.Len(t, store.calls, 0)
+
+	// subjects are split between variants
+	for i := range 100 {
+		_, err := svc.Call(context.WithValue(context.Background(), subjectKey{}, fmt.Sprint(i)), req)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 100, store.calls["control"]+store.calls["short"])
+	assert.Greater(t, store.calls["control"], 25)
+	assert.Greater(t, store.calls["short"], 25)
+	assert.Equal(t, "Translate to Spanish. Be brief.", short.last.Instructions)
+	assert.Equal(t, "Translate to Spanish.", control.last.Instructions)
+
+	// and stick to the variant they were first assigned
+	store.assigned["7"] = "short"
+	ctx := context.WithValue(context.Background(), subjectKey{}, "7")
+	for range 3 {
+		resp, err := svc.Call(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, "Hola!", resp.Output)
+		assert.Equal(t, "gpt-4o-mini", resp.Model) // variant's own model
+		assert.Equal(t, []string{"experiment greeting variant short"}, resp.Diagnostics)
+	}
+
+	// unless that variant no longer exists
+	store.assigned["7"] = "removed"
+	_, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.NotEqual(t, "removed", store.assigned["7"])
+
+	// failed calls are recorded too
+	svc = ai.NewExperimentService("greeting", store, &ai.ExperimentVariant{Name: "broken", Service: &failingLLM{}, Weight: 1})
+	_, err = svc.Call(ctx, req)
+	assert.EqualError(t, err, "503 Service Unavailable")
+	assert.Equal(t, 1, store.failures["broken"])
+}
@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+)
+
+// maximum number of output tokens of an extraction, per field
+const maxExtractTokensPerField = 50
+
+// ExtractField is a contact field whose value can be extracted from text
+type ExtractField struct {
+	Key  string
+	Name string
+	Type assets.FieldType
+}
+
+// ExtractFields uses the given service to extract values for the given fields from free text, e.g. a contact telling
+// us about themselves. Output is constrained to a schema of the fields, and values which aren't valid for their field
+// types are dropped, so the returned map only contains values which can be saved. The response is returned so that
+// callers can record usage.
+func ExtractFields(ctx context.Context, svc flows.LLMService, text string, fields []*ExtractField) (map[string]string, *flows.LLMResponse, error) {
+	instructions := prompts.Render("extract_fields", map[string]any{"Fields": fields})
+
+	resp, err := NewLLMService(AsService(svc)).ResponseJSON(ctx, instructions, text, extractSchema(fields), maxExtractTokensPerField*len(fields))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var extracted map[string]any
+	json.Unmarshal([]byte(resp.Output), &extracted) // already validated against schema
+
+	values := make(map[string]string, len(fields))
+	for _, f := range fields {
+		if v, ok := extractValue(f, extracted[f.Key]); ok {
+			values[f.Key] = v
+		}
+	}
+	return values, resp, nil
+}
+
+// builds a schema for an object with a nullable property for each field
+func extractSchema(fields []*ExtractField) map[string]any {
+	props := make(map[string]any, len(fields))
+	required := make([]any, len(fields))
+
+	for i, f := range fields {
+		typ := "string"
+		if f.Type == assets.FieldTypeNumber {
+			typ = "number"
+		}
+		props[f.Key] = map[string]any{"type": []any{typ, "null"}, "description": f.Name}
+		required[i] = f.Key
+	}
+
+	return map[string]any{"type": "object", "properties": props, "required": required, "additionalProperties": false}
+}
+
+// converts an extracted value to a field value, returning false if it's missing or not valid for the field's type
+func extractValue(f *ExtractField, v any) (string, bool) {
+	switch typed := v.(type) {
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64), true
+	case string:
+		typed = strings.TrimSpace(typed)
+		if typed == "" {
+			return "", false
+		}
+		if f.Type == assets.FieldTypeDatetime && !isISODatetime(typed) {
+			return "", false
+		}
+		return typed, true
+	}
+	return "", false
+}
+
+func isISODatetime(s string) bool {
+	if _, err := time.Parse("2006-01-02", s); err == nil {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339, s)
+	return err == nil
+}
@@ -0,0 +1,54 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractFields(t *testing.T) {
+	ctx := context.Background()
+
+	fields := []*ai.ExtractField{
+		{Key: "name", Name: "Name", Type: assets.FieldTypeText},
+		{Key: "age", Name: "Age", Type: assets.FieldTypeNumber},
+		{Key: "city", Name: "City", Type: assets.FieldTypeText},
+		{Key: "children", Name: "Number of Children", Type: assets.FieldTypeNumber},
+		{Key: "born", Name: "Date of Birth", Type: assets.FieldTypeDatetime},
+	}
+
+	llm := &fixedLLM{output: `{"name": "Marie", "age": 34, "city": "Cap-Haïtien", "children": 2, "born": null}`}
+
+	values, resp, err := ai.ExtractFields(ctx, ai.NewLLMService(llm), "I'm Marie, 34, living in Cap-Haïtien, 2 kids", fields)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"name": "Marie", "age": "34", "city": "Cap-Haïtien", "children": "2"}, values)
+	assert.Equal(t, int64(10), resp.TokensInput)
+	assert.Equal(t, "I'm Marie, 34, living in Cap-Haïtien, 2 kids", llm.last.Input)
+	assert.Contains(t, llm.last.Instructions, "- children (number): Number of Children\n")
+	assert.Equal(t, []any{"number", "null"}, llm.last.Schema["properties"].(map[string]any)["age"].(map[string]any)["type"])
+	assert.Equal(t, 250, llm.last.MaxTokens)
+
+	// invalid datetimes and empty strings are dropped
+	llm.output = `{"name": " ", "age": 34.5, "city": null, "children": null, "born": "last year"}`
+
+	values, _, err = ai.ExtractFields(ctx, ai.NewLLMService(llm), "I'm 34 and a half", fields)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"age": "34.5"}, values)
+
+	llm.output = `{"name": null, "age": null, "city": null, "children": null, "born": "1990-04-05"}`
+
+	values, _, err = ai.ExtractFields(ctx, ai.NewLLMService(llm), "I was born on 5 April 1990", fields)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"born": "1990-04-05"}, values)
+
+	// output which doesn't match the schema is an error once repair fails
+	llm.output = `{"name": "Marie", "age": "thirty four", "city": null, "children": null, "born": null}`
+
+	_, _, err = ai.ExtractFields(ctx, ai.NewLLMService(llm), "I'm Marie, thirty four", fields)
+	assert.ErrorContains(t, err, "output is not valid JSON: doesn't match schema: $.age: expected number or null")
+	assert.Equal(t, 5, llm.calls)
+}
@@ -0,0 +1,73 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+)
+
+// FallbackRoute is a service in a fallback chain, the model it uses and an optional circuit breaker
+type FallbackRoute struct {
+	Model   string
+	Service Service
+	Breaker Breaker
+
+	// When decides whether this route is tried after the given error from the previous route, nil meaning always
+	When func(error) bool
+}
+
+// fallbackService is an LLM service which tries each of a chain of services until one succeeds
+type fallbackService struct {
+	routes []FallbackRoute
+}
+
+// NewFallbackService creates a service which tries each of the given routes in order until one succeeds. Routes whose
+// breaker is open are skipped entirely until it half-opens. What happened to the routes before the one which handled
+// the request is recorded in the diagnostics of the response.
+func NewFallbackService(routes ...FallbackRoute) Service {
+	return &fallbackService{routes: routes}
+}
+
+func (s *fallbackService) Call(ctx context.Context, req *Request) (*Response, error) {
+	var diagnostics []string
+	var lastErr error
+
+	for _, route := range s.routes {
+		if route.Breaker != nil {
+			if allowed, err := route.Breaker.Allow(ctx); err == nil && !allowed {
+				diagnostics = append(diagnostics, fmt.Sprintf("skipped %s due to open breaker", route.Model))
+				continue
+			}
+		}
+		if lastErr != nil && route.When != nil && !route.When(lastErr) {
+			return nil, lastErr
+		}
+
+		resp, err := route.Service.Call(ctx, req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err // caller gave up so don't count this against the route or try others
+			}
+
+			if route.Breaker != nil && IsProviderFailure(err) {
+				route.Breaker.Failure(ctx)
+			}
+			diagnostics = append(diagnostics, fmt.Sprintf("%s failed: %s", route.Model, err))
+			lastErr = err
+			continue
+		}
+
+		if route.Breaker != nil {
+			route.Breaker.Success(ctx)
+		}
+		if resp.Model == "" {
+			resp.Model = route.Model
+		}
+		resp.Diagnostics = append(diagnostics, resp.Diagnostics...)
+		return resp, nil
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, &ServiceError{Message: "no models available as all breakers are open", Code: ErrorUnknown, Instructions: req.Instructions, Input: req.Input}
+}
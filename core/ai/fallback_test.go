@@ -0,0 +1,102 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// LLM service for testing which always fails
+type failingLLM struct {
+	calls int
+}
+
+func (s *failingLLM) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	s.calls++
+	return nil, errors.New("503 Service Unavailable")
+}
+
+func TestFallbackService(t *testing.T) {
+	ctx := context.Background()
+	req := &ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100}
+
+	primary := &failingLLM{}
+	secondary := &fixedLLM{output: "Hola"}
+	breaker := &testBreaker{threshold: 2}
+
+	svc := ai.NewFallbackService(
+		ai.FallbackRoute{Model: "gpt-4o", Service: primary, Breaker: breaker},
+		ai.FallbackRoute{Model: "gpt-4o-mini", Service: secondary},
+	)
+
+	// primary is tried and fails until its breaker opens
+	for range 2 {
+		resp, err := svc.Call(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, "Hola", resp.Output)
+		assert.Equal(t, "gpt-4o-mini", resp.Model)
+		assert.Equal(t, []string{"gpt-4o failed: 503 Service Unavailable"}, resp.Diagnostics)
+	}
+	assert.Equal(t, 2, primary.calls)
+	assert.True(t, breaker.open())
+
+	// with its breaker open, primary is skipped entirely
+	resp, err := svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", resp.Model)
+	assert.Equal(t, []string{"skipped gpt-4o due to open breaker"}, resp.Diagnostics)
+	assert.Equal(t, 2, primary.calls)
+	assert.Equal(t, 3, secondary.calls)
+
+	// if every route fails, we get the last error
+	svc = ai.NewFallbackService(ai.FallbackRoute{Model: "gpt-4o", Service: primary}, ai.FallbackRoute{Model: "gpt-4o-mini", Service: &failingLLM{}})
+	_, err = svc.Call(ctx, req)
+	assert.EqualError(t, err, "503 Service Unavailable")
+
+	// and if every route is skipped, an error saying so
+	svc = ai.NewFallbackService(ai.FallbackRoute{Model: "gpt-4o", Service: primary, Breaker: breaker})
+	_, err = svc.Call(ctx, req)
+	assert.EqualError(t, err, "no models available as all breakers are open")
+
+	// routes can be conditional on the error from the previous route
+	transient := &ai.ServiceError{Message: "429 Too Many Requests", Code: ai.ErrorRateLimit, StatusCode: 429}
+	svc = ai.NewFallbackService(
+		ai.FallbackRoute{Model: "gpt-4o", Service: &erroringLLM{err: transient}},
+		ai.FallbackRoute{Model: "claude-sonnet-4", Service: secondary, When: ai.IsTransient},
+	)
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "claude-sonnet-4", resp.Model)
+	assert.Equal(t, []string{"gpt-4o failed: 429 Too Many Requests"}, resp.Diagnostics)
+
+	svc = ai.NewFallbackService(
+		ai.FallbackRoute{Model: "gpt-4o", Service: &erroringLLM{err: &ai.ServiceError{Message: "bad key", Code: ai.ErrorCredentials, StatusCode: 401}}},
+		ai.FallbackRoute{Model: "claude-sonnet-4", Service: secondary, When: ai.IsTransient},
+	)
+	_, err = svc.Call(ctx, req)
+	assert.EqualError(t, err, "bad key")
+	assert.Equal(t, 4, secondary.calls)
+
+	// errors caused by the request rather than the provider don't count against a route's breaker
+	breaker = &testBreaker{threshold: 1}
+	svc = ai.NewFallbackService(
+		ai.FallbackRoute{Model: "gpt-4o", Service: &erroringLLM{err: &ai.ServiceError{Message: "prompt too long", Code: ai.ErrorContextLength, StatusCode: 400}}, Breaker: breaker},
+		ai.FallbackRoute{Model: "gpt-4o-mini", Service: secondary},
+	)
+	_, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.False(t, breaker.open())
+}
+
+// LLM service for testing which always fails with the given error
+type erroringLLM struct {
+	err error
+}
+
+func (s *erroringLLM) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	return nil, s.err
+}
@@ -0,0 +1,26 @@
+package ai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// HashRequest returns a stable fingerprint of the given request and effective params, e.g. as returned by
+// Params.Applied. Identical requests with identical params always produce the same hash.
+func HashRequest(req *Request, params map[string]any) string {
+	// JSON encoding of maps is ordered by key so this is deterministic
+	b, _ := json.Marshal(struct {
+		Instructions string         `json:"instructions"`
+		Input        string         `json:"input"`
+		History      []*Turn        `json:"history,omitempty"`
+		MaxTokens    int            `json:"max_tokens"`
+		Images       []string       `json:"images,omitempty"`
+		Tools        []*Tool        `json:"tools,omitempty"`
+		Schema       map[string]any `json:"schema,omitempty"`
+		Params       map[string]any `json:"params,omitempty"`
+	}{req.Instructions, req.Input, req.History, req.MaxTokens, req.Images(), req.Tools, req.Schema, params})
+
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,33 @@
+package ai_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashRequest(t *testing.T) {
+	req := &ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100}
+	params := ai.Params{Temperature: new(0.5), TopP: new(0.9)}
+
+	hash := ai.HashRequest(req, params.Applied("gpt-4o", 100))
+	assert.Len(t, hash, 64)
+
+	// identical effective requests produce identical hashes
+	assert.Equal(t, hash, ai.HashRequest(&ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100}, ai.Params{TopP: new(0.9), Temperature: new(0.5)}.Applied("gpt-4o", 100)))
+
+	// debug flag and idempotency aren't part of what is sent
+	assert.Equal(t, hash, ai.HashRequest(&ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100, Debug: true, Idempotent: true}, params.Applied("gpt-4o", 100)))
+
+	// but any change to the request or params changes the hash
+	assert.NotEqual(t, hash, ai.HashRequest(&ai.Request{Instructions: "translate to Spanish", Input: "Hello!", MaxTokens: 100}, params.Applied("gpt-4o", 100)))
+	assert.NotEqual(t, hash, ai.HashRequest(req, params.Applied("gpt-4o-mini", 100)))
+	assert.NotEqual(t, hash, ai.HashRequest(req, params.Applied("gpt-4o", 200)))
+	assert.NotEqual(t, hash, ai.HashRequest(req, ai.Params{Temperature: new(0.6), TopP: new(0.9)}.Applied("gpt-4o", 100)))
+	assert.NotEqual(t, hash, ai.HashRequest(req, ai.Params{Temperature: new(0.5), TopP: new(0.9), JSONMode: new(true)}.Applied("gpt-4o", 100)))
+	assert.NotEqual(t, hash, ai.HashRequest(&ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100, Tools: []*ai.Tool{{Name: "lookup"}}}, params.Applied("gpt-4o", 100)))
+	assert.NotEqual(t, hash, ai.HashRequest(&ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100, History: []*ai.Turn{{Input: "Hi", Output: "Hola"}}}, params.Applied("gpt-4o", 100)))
+	assert.NotEqual(t, hash, ai.HashRequest(&ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100, Attachments: []utils.Attachment{"image/jpeg:https://example.com/cat.jpg"}}, params.Applied("gpt-4o", 100)))
+}
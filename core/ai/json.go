@@ -0,0 +1,134 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+)
+
+// jsonService is an LLM service which requires that output is valid JSON
+type jsonService struct {
+	service Service
+	schema  map[string]any
+	repair  bool
+}
+
+// NewJSONService wraps the given service so that output which isn't valid JSON, or doesn't conform to the schema of the
+// request or else the given default schema, is an error, unless repair is enabled and a single follow-up call asking
+// the model to correct its output succeeds.
+func NewJSONService(svc Service, schema map[string]any, repair bool) Service {
+	return &jsonService{service: svc, schema: schema, repair: repair}
+}
+
+func (s *jsonService) Call(ctx context.Context, req *Request) (*Response, error) {
+	if req.Schema == nil && s.schema != nil {
+		withSchema := *req
+		withSchema.Schema = s.schema
+		req = &withSchema
+	}
+
+	resp, err := s.service.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	perr := ensureJSON(resp, req.Schema)
+	if perr == nil {
+		return resp, nil
+	}
+
+	if s.repair {
+		repairReq := &Request{
+			Instructions: prompts.Render("repair_json", map[string]any{"Error": perr.Error(), "Schema": schemaString(req.Schema)}),
+			Input:        resp.Output,
+			MaxTokens:    req.MaxTokens,
+			Schema:       req.Schema,
+			Idempotent:   true,
+		}
+
+		repaired, err := s.service.Call(ctx, repairReq)
+		if err != nil {
+			return nil, err
+		}
+
+		// the caller pays for both calls
+		repaired.TokensInput += resp.TokensInput
+		repaired.TokensOutput += resp.TokensOutput
+		repaired.Timings.Total += resp.Timings.Total
+
+		if perr = ensureJSON(repaired, req.Schema); perr == nil {
+			return repaired, nil
+		}
+	}
+
+	return nil, &ServiceError{Message: fmt.Sprintf("output is not valid JSON: %s", perr), Code: ErrorInvalidJSON, Instructions: req.Instructions, Input: req.Input}
+}
+
+// checks that the output of the given response is valid JSON, and if it isn't, tries to extract JSON from it, e.g.
+// when the model has wrapped it in code fences or prose. Returns the original parse error if that fails. If a schema
+// is given, the JSON must also conform to it.
+func ensureJSON(resp *Response, schema map[string]any) error {
+	perr := validateJSON(resp.Output)
+	if perr != nil {
+		extracted, ok := ExtractJSON(resp.Output)
+		if !ok {
+			return perr
+		}
+
+		resp.Output = extracted
+		resp.Cleaned = true
+	}
+
+	if schema != nil {
+		var v any
+		json.Unmarshal([]byte(resp.Output), &v)
+
+		if err := ValidateSchema(v, schema); err != nil {
+			return fmt.Errorf("doesn't match schema: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func schemaString(schema map[string]any) string {
+	if schema == nil {
+		return ""
+	}
+	b, _ := json.Marshal(schema)
+	return string(b)
+}
+
+func validateJSON(s string) error {
+	var v any
+	return json.Unmarshal([]byte(s), &v)
+}
+
+var codeFenceRegex = regexp.MustCompile("(?s)```[a-zA-Z]*\\s*\\n(.*?)\\n\\s*```")
+
+// ExtractJSON tries to find valid JSON in the given text, firstly inside any markdown code fences, and otherwise as
+// the first object or array which can be parsed.
+func ExtractJSON(s string) (string, bool) {
+	for _, m := range codeFenceRegex.FindAllStringSubmatch(s, -1) {
+		if inner := strings.TrimSpace(m[1]); validateJSON(inner) == nil {
+			return inner, true
+		}
+	}
+
+	for i, r := range s {
+		if r != '{' && r != '[' {
+			continue
+		}
+
+		var v json.RawMessage
+		if err := json.NewDecoder(strings.NewReader(s[i:])).Decode(&v); err == nil {
+			return string(v), true
+		}
+	}
+
+	return "", false
+}
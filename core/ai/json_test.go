@@ -0,0 +1,133 @@
+package ai_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONService(t *testing.T) {
+	ctx := context.Background()
+	req := &ai.Request{Instructions: "Return a JSON object", Input: "Bob is 34", MaxTokens: 100}
+
+	// valid output is returned as is
+	llm := &sequenceLLM{outputs: []string{`{"name": "Bob", "age": 34}`}}
+	resp, err := ai.NewJSONService(llm, nil, false).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name": "Bob", "age": 34}`, resp.Output)
+	assert.Len(t, llm.requests, 1)
+
+	// invalid output without repair is an error
+	llm = &sequenceLLM{outputs: []string{`{"name": "Bob", "age": 34`}}
+	_, err = ai.NewJSONService(llm, nil, false).Call(ctx, req)
+	assert.EqualError(t, err, "output is not valid JSON: unexpected end of JSON input")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorInvalidJSON, serr.Code)
+	}
+	assert.Len(t, llm.requests, 1)
+
+	// invalid output with successful repair
+	llm = &sequenceLLM{outputs: []string{`{"name": "Bob", "age": 34`, `{"name": "Bob", "age": 34}`}}
+	resp, err = ai.NewJSONService(llm, nil, true).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name": "Bob", "age": 34}`, resp.Output)
+	assert.Equal(t, int64(20), resp.TokensInput)
+	assert.Equal(t, int64(10), resp.TokensOutput)
+	if assert.Len(t, llm.requests, 2) {
+		assert.Equal(t, "The input text was meant to be valid JSON but could not be parsed: unexpected end of JSON input.\nCorrect it so that it is valid JSON, preserving its content and structure as closely as possible.\nReturn only the corrected JSON, with no additional text or explanation.", llm.requests[1].Instructions)
+		assert.Equal(t, `{"name": "Bob", "age": 34`, llm.requests[1].Input)
+	}
+
+	// repair is only attempted once
+	llm = &sequenceLLM{outputs: []string{`{"name": "Bob", "age": 34`, `{name: Bob}`}}
+	_, err = ai.NewJSONService(llm, nil, true).Call(ctx, req)
+	assert.EqualError(t, err, "output is not valid JSON: invalid character 'n' looking for beginning of object key string")
+	assert.Len(t, llm.requests, 2)
+	// with a schema, output must also conform to it
+	schema := map[string]any{"type": "object", "properties": map[string]any{"age": map[string]any{"type": "integer"}}, "required": []any{"age"}}
+	schemaReq := &ai.Request{Instructions: "Return a JSON object", Input: "Bob is 34", MaxTokens: 100, Schema: schema}
+
+	llm = &sequenceLLM{outputs: []string{`{"name": "Bob", "age": "34"}`}}
+	_, err = ai.NewJSONService(llm, nil, false).Call(ctx, schemaReq)
+	assert.EqualError(t, err, "output is not valid JSON: doesn't match schema: $.age: expected integer")
+
+	llm = &sequenceLLM{outputs: []string{`{"name": "Bob", "age": "34"}`, `{"name": "Bob", "age": 34}`}}
+	resp, err = ai.NewJSONService(llm, nil, true).Call(ctx, schemaReq)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name": "Bob", "age": 34}`, resp.Output)
+	if assert.Len(t, llm.requests, 2) {
+		assert.Equal(t, "The input text was meant to be valid JSON but is invalid: doesn't match schema: $.age: expected integer.\nIt must conform to the JSON schema: {\"properties\":{\"age\":{\"type\":\"integer\"}},\"required\":[\"age\"],\"type\":\"object\"}\nCorrect it so that it is valid JSON, preserving its content and structure as closely as possible.\nReturn only the corrected JSON, with no additional text or explanation.", llm.requests[1].Instructions)
+		assert.Equal(t, schema, llm.requests[1].Schema)
+	}
+
+	// requests without a schema get the default schema of the service, which the repair call is also given
+	llm = &sequenceLLM{outputs: []string{`{"name": "Bob", "age": "34"}`, `{"name": "Bob", "age": 34}`}}
+	resp, err = ai.NewJSONService(llm, schema, true).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name": "Bob", "age": 34}`, resp.Output)
+	if assert.Len(t, llm.requests, 2) {
+		assert.Equal(t, schema, llm.requests[0].Schema)
+		assert.Contains(t, llm.requests[1].Instructions, `It must conform to the JSON schema: {"properties":{"age":{"type":"integer"}},"required":["age"],"type":"object"}`)
+		assert.Equal(t, schema, llm.requests[1].Schema)
+	}
+	assert.Nil(t, req.Schema)
+}
+
+func TestExtractJSON(t *testing.T) {
+	fenced, err := os.ReadFile("testdata/json_fenced.txt")
+	require.NoError(t, err)
+	prose, err := os.ReadFile("testdata/json_prose.txt")
+	require.NoError(t, err)
+
+	tcs := []struct {
+		input     string
+		extracted string
+		ok        bool
+	}{
+		{string(fenced), "{\n  \"name\": \"Bob\",\n  \"age\": 34\n}", true},
+		{string(prose), `{"name": "Bob", "age": 34, "tags": ["new", "vip"]}`, true},
+		{"Here you go: ```[1, 2, 3]```", `[1, 2, 3]`, true},
+		{"```\n{\"a\": 1}\n```\nor maybe ```\n{\"b\": 2}\n```", `{"a": 1}`, true},
+		{"```json\n{broken\n```", "", false},
+		{"no JSON here", "", false},
+		{`{"name": "Bob"`, "", false},
+	}
+
+	for _, tc := range tcs {
+		extracted, ok := ai.ExtractJSON(tc.input)
+		assert.Equal(t, tc.ok, ok, "ok mismatch for input %q", tc.input)
+		assert.Equal(t, tc.extracted, extracted, "extracted mismatch for input %q", tc.input)
+	}
+}
+
+func TestJSONServiceCleanup(t *testing.T) {
+	ctx := context.Background()
+	req := &ai.Request{Instructions: "Return a JSON object", Input: "Bob is 34", MaxTokens: 100}
+
+	prose, err := os.ReadFile("testdata/json_prose.txt")
+	require.NoError(t, err)
+
+	// JSON wrapped in prose is extracted without needing a repair call
+	llm := &sequenceLLM{outputs: []string{string(prose)}}
+	resp, err := ai.NewJSONService(llm, nil, true).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name": "Bob", "age": 34, "tags": ["new", "vip"]}`, resp.Output)
+	assert.True(t, resp.Cleaned)
+	assert.Len(t, llm.requests, 1)
+
+	// valid JSON isn't flagged as cleaned
+	llm = &sequenceLLM{outputs: []string{`{"name": "Bob"}`}}
+	resp, err = ai.NewJSONService(llm, nil, false).Call(ctx, req)
+	require.NoError(t, err)
+	assert.False(t, resp.Cleaned)
+
+	// if extraction fails, we get the original parse error
+	llm = &sequenceLLM{outputs: []string{"```json\n{name: Bob}\n```"}}
+	_, err = ai.NewJSONService(llm, nil, false).Call(ctx, req)
+	assert.EqualError(t, err, "output is not valid JSON: invalid character '`' looking for beginning of value")
+}
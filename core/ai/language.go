@@ -0,0 +1,160 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+)
+
+// scripts which are mostly used by a single language, so identify it
+var languageScripts = []struct {
+	script *unicode.RangeTable
+	lang   i18n.Language
+}{
+	{unicode.Hiragana, "jpn"}, // before Han since Japanese mixes both
+	{unicode.Katakana, "jpn"},
+	{unicode.Hangul, "kor"},
+	{unicode.Han, "zho"},
+	{unicode.Arabic, "ara"},
+	{unicode.Cyrillic, "rus"},
+	{unicode.Devanagari, "hin"},
+	{unicode.Ethiopic, "amh"},
+	{unicode.Greek, "ell"},
+	{unicode.Hebrew, "heb"},
+	{unicode.Thai, "tha"},
+}
+
+// common words which distinguish languages written in Latin script
+var languageStopwords = map[i18n.Language][]string{
+	"eng": {"the", "and", "is", "are", "you", "to", "of", "what", "this", "have", "my", "it"},
+	"spa": {"el", "la", "los", "las", "y", "es", "que", "de", "por", "para", "mi", "una", "está", "cómo"},
+	"fra": {"le", "la", "les", "et", "est", "que", "de", "pour", "je", "vous", "une", "des", "mon", "pas"},
+	"por": {"o", "os", "as", "e", "é", "que", "de", "para", "não", "uma", "meu", "você", "está", "com"},
+}
+
+// DetectLanguage is a lightweight detector of the language of the given text, using the script it is written in or,
+// for Latin script, counts of common words. Returns NilLanguage if the language can't be determined.
+func DetectLanguage(text string) i18n.Language {
+	counts := make(map[i18n.Language]int)
+	letters := 0
+
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, ls := range languageScripts {
+			if unicode.Is(ls.script, r) {
+				counts[ls.lang]++
+				break
+			}
+		}
+	}
+
+	// a script language wins if it accounts for a good share of the letters
+	best, bestCount := i18n.NilLanguage, 0
+	for _, ls := range languageScripts {
+		if c := counts[ls.lang]; c > bestCount {
+			best, bestCount = ls.lang, c
+		}
+	}
+	if best != i18n.NilLanguage && bestCount*3 >= letters {
+		return best
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) })
+	clear(counts)
+	for _, w := range words {
+		for lang, stopwords := range languageStopwords {
+			for _, sw := range stopwords {
+				if w == sw {
+					counts[lang]++
+				}
+			}
+		}
+	}
+
+	// require a clear winner
+	best, bestCount, tied := i18n.NilLanguage, 0, false
+	for lang, c := range counts {
+		if c > bestCount {
+			best, bestCount, tied = lang, c, false
+		} else if c == bestCount {
+			tied = true
+		}
+	}
+	if tied || bestCount == 0 {
+		return i18n.NilLanguage
+	}
+	return best
+}
+
+// maximum number of output tokens of a language identification
+const maxIdentifyLanguageTokens = 50
+
+// LanguageIdentification is the language of a text as identified by an LLM
+type LanguageIdentification struct {
+	Language   i18n.Language `json:"language"`
+	Confidence float64       `json:"confidence"`
+}
+
+// IdentifyLanguage uses the given service to identify the language of the given text, which unlike DetectLanguage can
+// distinguish closely related languages. Output which isn't a valid identification is treated as NilLanguage with no
+// confidence. The response is returned so that callers can record usage.
+func IdentifyLanguage(ctx context.Context, svc flows.LLMService, text string) (*LanguageIdentification, *flows.LLMResponse, error) {
+	resp, err := svc.Response(ctx, prompts.Render("identify_language", nil), text, maxIdentifyLanguageTokens)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output, _ := ExtractJSON(resp.Output)
+
+	id := &LanguageIdentification{}
+	if err := json.Unmarshal([]byte(output), id); err != nil {
+		return &LanguageIdentification{}, resp, nil
+	}
+	lang, err := i18n.ParseLanguage(string(id.Language))
+	if err != nil || lang == "und" {
+		return &LanguageIdentification{}, resp, nil
+	}
+	id.Language = lang
+	return id, resp, nil
+}
+
+// LanguageRoute is a service to route requests to, and the model it uses
+type LanguageRoute struct {
+	Model   string
+	Service Service
+}
+
+// languageRoutingService is an LLM service which routes requests to different models based on the input language
+type languageRoutingService struct {
+	fallback LanguageRoute
+	routes   map[i18n.Language]LanguageRoute
+}
+
+// NewLanguageRoutingService creates a service which detects the language of each request's input and routes it to the
+// route for that language, or to the fallback route. The model which handled the request is recorded on the response.
+func NewLanguageRoutingService(fallback LanguageRoute, routes map[i18n.Language]LanguageRoute) Service {
+	return &languageRoutingService{fallback: fallback, routes: routes}
+}
+
+func (s *languageRoutingService) Call(ctx context.Context, req *Request) (*Response, error) {
+	route, ok := s.routes[DetectLanguage(req.Input)]
+	if !ok {
+		route = s.fallback
+	}
+
+	resp, err := route.Service.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Model = route.Model
+	return resp, nil
+}
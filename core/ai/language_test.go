@@ -0,0 +1,98 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tcs := []struct {
+		text string
+		lang i18n.Language
+	}{
+		{"What is the weather like today and are you open?", "eng"},
+		{"¿Cómo está el clima hoy? Necesito saber la hora de la cita", "spa"},
+		{"Je ne sais pas où est mon colis, pouvez-vous m'aider?", "fra"},
+		{"Eu não sei onde está o meu pedido, você pode ajudar?", "por"},
+		{"مرحبا، كيف حالك؟", "ara"},
+		{"Привет, как дела?", "rus"},
+		{"今日はいい天気ですね", "jpn"},
+		{"你好，今天天气怎么样", "zho"},
+		{"안녕하세요", "kor"},
+		{"Hello مرحبا كيف حالك اليوم", "ara"},
+		{"12345 !!!", i18n.NilLanguage},
+		{"Muraho neza", i18n.NilLanguage},
+		{"", i18n.NilLanguage},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.lang, ai.DetectLanguage(tc.text), "language mismatch for %q", tc.text)
+	}
+}
+
+func TestIdentifyLanguage(t *testing.T) {
+	ctx := context.Background()
+
+	tcs := []struct {
+		output     string
+		language   i18n.Language
+		confidence float64
+	}{
+		{`{"language": "hat", "confidence": 0.9}`, "hat", 0.9},
+		{"```json\n{\"language\": \"fra\", \"confidence\": 0.6}\n```", "fra", 0.6},
+		{`{"language": "und", "confidence": 0}`, i18n.NilLanguage, 0},
+		{`{"language": "xx", "confidence": 0.9}`, i18n.NilLanguage, 0},
+		{`Haitian Creole`, i18n.NilLanguage, 0},
+	}
+
+	for _, tc := range tcs {
+		llm := &fixedLLM{output: tc.output}
+
+		id, resp, err := ai.IdentifyLanguage(ctx, ai.NewLLMService(llm), "Mwen bezwen èd")
+		require.NoError(t, err)
+		assert.Equal(t, tc.language, id.Language, "language mismatch for output %q", tc.output)
+		assert.Equal(t, tc.confidence, id.Confidence, "confidence mismatch for output %q", tc.output)
+		assert.Equal(t, int64(10), resp.TokensInput)
+		assert.Equal(t, "Mwen bezwen èd", llm.last.Input)
+	}
+
+	// errors are returned
+	_, _, err := ai.IdentifyLanguage(ctx, ai.NewLLMService(&failingLLM{}), "Mwen bezwen èd")
+	assert.Error(t, err)
+}
+
+func TestLanguageRoutingService(t *testing.T) {
+	ctx := context.Background()
+
+	fallback := &fixedLLM{output: "fallback"}
+	arabic := &fixedLLM{output: "arabic"}
+
+	svc := ai.NewLanguageRoutingService(ai.LanguageRoute{Model: "gpt-4o-mini", Service: fallback}, map[i18n.Language]ai.LanguageRoute{
+		"ara": {Model: "gpt-4o", Service: arabic},
+	})
+
+	// routed language
+	resp, err := svc.Call(ctx, &ai.Request{Instructions: "Summarize", Input: "مرحبا، كيف حالك؟", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "arabic", resp.Output)
+	assert.Equal(t, "gpt-4o", resp.Model)
+
+	// language without a route
+	resp, err = svc.Call(ctx, &ai.Request{Instructions: "Summarize", Input: "What is the weather like today?", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "fallback", resp.Output)
+	assert.Equal(t, "gpt-4o-mini", resp.Model)
+
+	// undetectable language
+	resp, err = svc.Call(ctx, &ai.Request{Instructions: "Summarize", Input: "12345", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", resp.Model)
+
+	assert.Equal(t, 1, arabic.calls)
+	assert.Equal(t, 2, fallback.calls)
+}
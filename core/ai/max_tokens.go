@@ -0,0 +1,39 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+)
+
+// maxTokensService is an LLM service which checks requested max tokens against a model's output limit
+type maxTokensService struct {
+	service Service
+	model   string
+	limit   int
+	strict  bool
+}
+
+// NewMaxTokensService wraps the given service so that requests for more output tokens than the given model's limit
+// either fail with an error naming the limit (strict) or are clamped to that limit.
+func NewMaxTokensService(svc Service, model string, limit int, strict bool) Service {
+	return &maxTokensService{service: svc, model: model, limit: limit, strict: strict}
+}
+
+func (s *maxTokensService) Call(ctx context.Context, req *Request) (*Response, error) {
+	if req.MaxTokens > s.limit {
+		if s.strict {
+			return nil, &ServiceError{
+				Message:      fmt.Sprintf("requested max tokens of %d exceeds the limit of %d output tokens for model %s", req.MaxTokens, s.limit, s.model),
+				Code:         ErrorMaxTokens,
+				Instructions: req.Instructions,
+				Input:        req.Input,
+			}
+		}
+
+		clamped := *req
+		clamped.MaxTokens = s.limit
+		req = &clamped
+	}
+
+	return s.service.Call(ctx, req)
+}
@@ -0,0 +1,42 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxTokensService(t *testing.T) {
+	ctx := context.Background()
+
+	// non-strict clamps to the model's limit
+	llm := &fixedLLM{output: "Hola"}
+	svc := ai.NewMaxTokensService(llm, "gpt-4-turbo", 4096, false)
+
+	_, err := svc.Call(ctx, &ai.Request{Instructions: "translate", Input: "Hello", MaxTokens: 2500})
+	require.NoError(t, err)
+	assert.Equal(t, 2500, llm.last.MaxTokens)
+
+	_, err = svc.Call(ctx, &ai.Request{Instructions: "translate", Input: "Hello", MaxTokens: 16000})
+	require.NoError(t, err)
+	assert.Equal(t, 4096, llm.last.MaxTokens)
+
+	// strict returns an error naming the limit
+	llm = &fixedLLM{output: "Hola"}
+	svc = ai.NewMaxTokensService(llm, "gpt-4-turbo", 4096, true)
+
+	_, err = svc.Call(ctx, &ai.Request{Instructions: "translate", Input: "Hello", MaxTokens: 4096})
+	require.NoError(t, err)
+	assert.Equal(t, 4096, llm.last.MaxTokens)
+
+	_, err = svc.Call(ctx, &ai.Request{Instructions: "translate", Input: "Hello", MaxTokens: 16000})
+	assert.EqualError(t, err, "requested max tokens of 16000 exceeds the limit of 4096 output tokens for model gpt-4-turbo")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorMaxTokens, serr.Code)
+	}
+	assert.Equal(t, 1, llm.calls)
+}
@@ -0,0 +1,95 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+)
+
+// Turn is a single exchange of input and output in a conversation
+type Turn struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// Conversation is what is remembered of a conversation
+type Conversation struct {
+	Summary string  `json:"summary,omitempty"` // summary of turns too old to be remembered individually
+	Turns   []*Turn `json:"turns"`             // most recent turns, oldest first
+}
+
+// Memory stores conversations so that requests can continue them
+type Memory interface {
+	Load(ctx context.Context) (*Conversation, error) // returns nil if the request isn't part of a conversation
+	Save(ctx context.Context, c *Conversation) error
+}
+
+// memoryService is an LLM service which continues conversations remembered in a memory
+type memoryService struct {
+	service    Service
+	memory     Memory
+	window     int
+	summarizer Service
+}
+
+// NewMemoryService wraps the given service so that requests which are part of a conversation include its history, and
+// each turn is remembered. Only the given number of most recent turns are kept, with older turns either summarized by
+// the given summarizer, if there is one, or forgotten. Memory errors don't fail calls but are noted in diagnostics.
+func NewMemoryService(svc Service, m Memory, window int, summarizer Service) Service {
+	return &memoryService{service: svc, memory: m, window: window, summarizer: summarizer}
+}
+
+func (s *memoryService) Call(ctx context.Context, req *Request) (*Response, error) {
+	var diagnostics []string
+
+	conv, err := s.memory.Load(ctx)
+	if err != nil {
+		diagnostics = append(diagnostics, fmt.Sprintf("error loading conversation: %s", err))
+	}
+	if conv == nil {
+		resp, err := s.service.Call(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Diagnostics = append(resp.Diagnostics, diagnostics...)
+		return resp, nil
+	}
+
+	continued := *req
+	continued.History = conv.Turns
+	if conv.Summary != "" {
+		continued.Instructions = strings.TrimSpace(prompts.Render("conversation_summary", map[string]any{"Instructions": req.Instructions, "Summary": conv.Summary}))
+	}
+
+	resp, err := s.service.Call(ctx, &continued)
+	if err != nil {
+		return nil, err
+	}
+
+	conv.Turns = append(conv.Turns, &Turn{Input: req.Input, Output: resp.Output})
+
+	if older := len(conv.Turns) - s.window; older > 0 {
+		if s.summarizer != nil {
+			summary, err := summarizeTurns(ctx, s.summarizer, conv.Summary, conv.Turns[:older])
+			if err != nil {
+				diagnostics = append(diagnostics, fmt.Sprintf("error summarizing conversation: %s", err))
+			} else {
+				conv.Summary = summary.Output
+
+				// the caller pays for both calls
+				resp.TokensInput += summary.TokensInput
+				resp.TokensOutput += summary.TokensOutput
+			}
+		}
+		conv.Turns = conv.Turns[older:]
+	}
+
+	if err := s.memory.Save(ctx, conv); err != nil {
+		diagnostics = append(diagnostics, fmt.Sprintf("error saving conversation: %s", err))
+	}
+
+	resp.Diagnostics = append(resp.Diagnostics, diagnostics...)
+	return resp, nil
+}
@@ -0,0 +1,97 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memory for testing which stores a single conversation
+type memoryConversation struct {
+	conv    *ai.Conversation
+	loadErr error
+	saveErr error
+}
+
+func (m *memoryConversation) Load(ctx context.Context) (*ai.Conversation, error) {
+	if m.conv == nil || m.loadErr != nil {
+		return nil, m.loadErr
+	}
+	c := *m.conv
+	return &c, nil
+}
+
+func (m *memoryConversation) Save(ctx context.Context, c *ai.Conversation) error {
+	if m.saveErr == nil {
+		m.conv = c
+	}
+	return m.saveErr
+}
+
+func TestMemoryService(t *testing.T) {
+	ctx := context.Background()
+
+	// requests which aren't part of a conversation are passed through
+	llm := &sequenceLLM{outputs: []string{"Hola"}}
+	svc := ai.NewMemoryService(llm, &memoryConversation{}, 2, nil)
+
+	resp, err := svc.Call(ctx, &ai.Request{Instructions: "chat", Input: "Hi", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Nil(t, llm.requests[0].History)
+
+	// requests which are, include its history and are remembered, with older turns forgotten
+	mem := &memoryConversation{conv: &ai.Conversation{}}
+	llm = &sequenceLLM{outputs: []string{"one", "two", "three"}}
+	svc = ai.NewMemoryService(llm, mem, 2, nil)
+
+	for _, input := range []string{"1", "2", "3"} {
+		_, err := svc.Call(ctx, &ai.Request{Instructions: "chat", Input: input, MaxTokens: 100})
+		require.NoError(t, err)
+	}
+
+	assert.Nil(t, llm.requests[0].History)
+	assert.Equal(t, []*ai.Turn{{Input: "1", Output: "one"}}, llm.requests[1].History)
+	assert.Equal(t, []*ai.Turn{{Input: "1", Output: "one"}, {Input: "2", Output: "two"}}, llm.requests[2].History)
+	assert.Equal(t, &ai.Conversation{Turns: []*ai.Turn{{Input: "2", Output: "two"}, {Input: "3", Output: "three"}}}, mem.conv)
+
+	// with summarization, older turns are summarized rather than forgotten
+	mem = &memoryConversation{conv: &ai.Conversation{Turns: []*ai.Turn{{Input: "1", Output: "one"}}}}
+	llm = &sequenceLLM{outputs: []string{"two", "User counted to two."}}
+	svc = ai.NewMemoryService(llm, mem, 1, llm)
+
+	resp, err = svc.Call(ctx, &ai.Request{Instructions: "chat", Input: "2", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "two", resp.Output)
+	assert.Equal(t, int64(20), resp.TokensInput) // includes summarizing
+	assert.Equal(t, int64(10), resp.TokensOutput)
+	assert.Equal(t, "User: 1\nAssistant: one\n", llm.requests[1].Input)
+	assert.Equal(t, &ai.Conversation{Summary: "User counted to two.", Turns: []*ai.Turn{{Input: "2", Output: "two"}}}, mem.conv)
+
+	// and the summary is added to instructions
+	llm = &sequenceLLM{outputs: []string{"three", "User counted to three."}}
+	svc = ai.NewMemoryService(llm, mem, 1, llm)
+
+	_, err = svc.Call(ctx, &ai.Request{Instructions: "chat", Input: "3", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Contains(t, llm.requests[0].Instructions, "<summary>\nUser counted to two.\n</summary>")
+	assert.Contains(t, llm.requests[1].Instructions, "It continues an earlier conversation which is summarized as: User counted to two.")
+
+	// memory errors don't fail calls
+	llm = &sequenceLLM{outputs: []string{"Hola", "Hola"}}
+	svc = ai.NewMemoryService(llm, &memoryConversation{loadErr: errors.New("boom")}, 2, nil)
+
+	resp, err = svc.Call(ctx, &ai.Request{Instructions: "chat", Input: "Hi", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"error loading conversation: boom"}, resp.Diagnostics)
+
+	svc = ai.NewMemoryService(llm, &memoryConversation{conv: &ai.Conversation{}, saveErr: errors.New("boom")}, 2, nil)
+
+	resp, err = svc.Call(ctx, &ai.Request{Instructions: "chat", Input: "Hi", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"error saving conversation: boom"}, resp.Diagnostics)
+}
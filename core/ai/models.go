@@ -0,0 +1,83 @@
+package ai
+
+import (
+	"strings"
+)
+
+// ModelInfo describes the limits and features of a known model
+type ModelInfo struct {
+	ContextWindow   int // maximum number of input and output tokens combined
+	MaxOutputTokens int // maximum number of output tokens per response
+
+	Tools      bool // supports tool calling
+	Vision     bool // supports image input
+	JSONSchema bool // supports output constrained to a JSON schema
+	Reasoning  bool // spends hidden output tokens reasoning and doesn't accept sampling params like temperature
+}
+
+var knownModels = map[string]*ModelInfo{}
+
+func init() {
+	// OpenAI
+	RegisterModel("gpt-3.5-turbo", &ModelInfo{ContextWindow: 16385, MaxOutputTokens: 4096, Tools: true})
+	RegisterModel("gpt-4", &ModelInfo{ContextWindow: 8192, MaxOutputTokens: 8192, Tools: true})
+	RegisterModel("gpt-4-turbo", &ModelInfo{ContextWindow: 128000, MaxOutputTokens: 4096, Tools: true, Vision: true})
+	RegisterModel("gpt-4o", &ModelInfo{ContextWindow: 128000, MaxOutputTokens: 16384, Tools: true, Vision: true, JSONSchema: true})
+	RegisterModel("gpt-4o-mini", &ModelInfo{ContextWindow: 128000, MaxOutputTokens: 16384, Tools: true, Vision: true, JSONSchema: true})
+	RegisterModel("gpt-4.1", &ModelInfo{ContextWindow: 1047576, MaxOutputTokens: 32768, Tools: true, Vision: true, JSONSchema: true})
+	RegisterModel("gpt-4.1-mini", &ModelInfo{ContextWindow: 1047576, MaxOutputTokens: 32768, Tools: true, Vision: true, JSONSchema: true})
+	RegisterModel("gpt-4.1-nano", &ModelInfo{ContextWindow: 1047576, MaxOutputTokens: 32768, Tools: true, Vision: true, JSONSchema: true})
+	RegisterModel("gpt-5", &ModelInfo{ContextWindow: 400000, MaxOutputTokens: 128000, Tools: true, Vision: true, JSONSchema: true, Reasoning: true})
+	RegisterModel("gpt-5-mini", &ModelInfo{ContextWindow: 400000, MaxOutputTokens: 128000, Tools: true, Vision: true, JSONSchema: true, Reasoning: true})
+	RegisterModel("gpt-5-nano", &ModelInfo{ContextWindow: 400000, MaxOutputTokens: 128000, Tools: true, Vision: true, JSONSchema: true, Reasoning: true})
+	RegisterModel("o1", &ModelInfo{ContextWindow: 200000, MaxOutputTokens: 100000, Tools: true, Vision: true, JSONSchema: true, Reasoning: true})
+	RegisterModel("o1-mini", &ModelInfo{ContextWindow: 128000, MaxOutputTokens: 65536, Reasoning: true})
+	RegisterModel("o3", &ModelInfo{ContextWindow: 200000, MaxOutputTokens: 100000, Tools: true, Vision: true, JSONSchema: true, Reasoning: true})
+	RegisterModel("o3-mini", &ModelInfo{ContextWindow: 200000, MaxOutputTokens: 100000, Tools: true, JSONSchema: true, Reasoning: true})
+	RegisterModel("o4-mini", &ModelInfo{ContextWindow: 200000, MaxOutputTokens: 100000, Tools: true, Vision: true, JSONSchema: true, Reasoning: true})
+
+	// Anthropic
+	RegisterModel("claude-3-haiku", &ModelInfo{ContextWindow: 200000, MaxOutputTokens: 4096, Tools: true, Vision: true})
+	RegisterModel("claude-3-opus", &ModelInfo{ContextWindow: 200000, MaxOutputTokens: 4096, Tools: true, Vision: true})
+	RegisterModel("claude-3-5-haiku", &ModelInfo{ContextWindow: 200000, MaxOutputTokens: 8192, Tools: true, Vision: true})
+	RegisterModel("claude-3-5-sonnet", &ModelInfo{ContextWindow: 200000, MaxOutputTokens: 8192, Tools: true, Vision: true})
+	RegisterModel("claude-3-7-sonnet", &ModelInfo{ContextWindow: 200000, MaxOutputTokens: 64000, Tools: true, Vision: true})
+	RegisterModel("claude-sonnet-4", &ModelInfo{ContextWindow: 200000, MaxOutputTokens: 64000, Tools: true, Vision: true})
+	RegisterModel("claude-opus-4", &ModelInfo{ContextWindow: 200000, MaxOutputTokens: 32000, Tools: true, Vision: true})
+
+	// DeepSeek
+	RegisterModel("deepseek-chat", &ModelInfo{ContextWindow: 128000, MaxOutputTokens: 8192, Tools: true})
+	RegisterModel("deepseek-reasoner", &ModelInfo{ContextWindow: 128000, MaxOutputTokens: 65536, Reasoning: true})
+
+	// Google
+	RegisterModel("gemini-1.5-flash", &ModelInfo{ContextWindow: 1048576, MaxOutputTokens: 8192, Tools: true, Vision: true, JSONSchema: true})
+	RegisterModel("gemini-1.5-pro", &ModelInfo{ContextWindow: 2097152, MaxOutputTokens: 8192, Tools: true, Vision: true, JSONSchema: true})
+	RegisterModel("gemini-2.0-flash", &ModelInfo{ContextWindow: 1048576, MaxOutputTokens: 8192, Tools: true, Vision: true, JSONSchema: true})
+	RegisterModel("gemini-2.5-flash", &ModelInfo{ContextWindow: 1048576, MaxOutputTokens: 65536, Tools: true, Vision: true, JSONSchema: true})
+	RegisterModel("gemini-2.5-pro", &ModelInfo{ContextWindow: 1048576, MaxOutputTokens: 65536, Tools: true, Vision: true, JSONSchema: true})
+}
+
+// RegisterModel registers the limits of a known model
+func RegisterModel(name string, info *ModelInfo) {
+	knownModels[name] = info
+}
+
+// LookupModel looks up a known model by name. Dated or versioned model names like gpt-4o-2024-08-06 resolve to the
+// longest registered name which is a prefix followed by a dash. Returns nil if the model isn't known.
+func LookupModel(name string) *ModelInfo {
+	name = strings.ToLower(name)
+
+	var match string
+	for known := range knownModels {
+		if (name == known || strings.HasPrefix(name, known+"-")) && len(known) > len(match) {
+			match = known
+		}
+	}
+	return knownModels[match]
+}
+
+// IsReasoningModel returns whether the given model is a known reasoning model
+func IsReasoningModel(name string) bool {
+	info := LookupModel(name)
+	return info != nil && info.Reasoning
+}
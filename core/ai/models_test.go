@@ -0,0 +1,31 @@
+package ai_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupModel(t *testing.T) {
+	assert.Equal(t, &ai.ModelInfo{ContextWindow: 128000, MaxOutputTokens: 16384, Tools: true, Vision: true, JSONSchema: true}, ai.LookupModel("gpt-4o"))
+	assert.Equal(t, &ai.ModelInfo{ContextWindow: 128000, MaxOutputTokens: 16384, Tools: true, Vision: true, JSONSchema: true}, ai.LookupModel("gpt-4o-2024-08-06"))
+	assert.Equal(t, &ai.ModelInfo{ContextWindow: 128000, MaxOutputTokens: 16384, Tools: true, Vision: true, JSONSchema: true}, ai.LookupModel("GPT-4o-mini"))
+	assert.Equal(t, &ai.ModelInfo{ContextWindow: 8192, MaxOutputTokens: 8192, Tools: true}, ai.LookupModel("gpt-4-0613"))
+	assert.Equal(t, &ai.ModelInfo{ContextWindow: 128000, MaxOutputTokens: 4096, Tools: true, Vision: true}, ai.LookupModel("gpt-4-turbo-preview"))
+	assert.Equal(t, &ai.ModelInfo{ContextWindow: 200000, MaxOutputTokens: 8192, Tools: true, Vision: true}, ai.LookupModel("claude-3-5-sonnet-20241022"))
+	assert.Equal(t, &ai.ModelInfo{ContextWindow: 1048576, MaxOutputTokens: 65536, Tools: true, Vision: true, JSONSchema: true}, ai.LookupModel("gemini-2.5-flash"))
+
+	// a known name which is a prefix not followed by a dash doesn't match
+	assert.Nil(t, ai.LookupModel("gpt-4.5-preview"))
+	assert.Nil(t, ai.LookupModel("my-custom-model"))
+	assert.Nil(t, ai.LookupModel(""))
+}
+
+func TestIsReasoningModel(t *testing.T) {
+	assert.True(t, ai.IsReasoningModel("o1"))
+	assert.True(t, ai.IsReasoningModel("o3-mini-2025-01-31"))
+	assert.True(t, ai.IsReasoningModel("gpt-5-mini"))
+	assert.False(t, ai.IsReasoningModel("gpt-4o"))
+	assert.False(t, ai.IsReasoningModel("my-custom-model"))
+}
@@ -0,0 +1,92 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Moderator flags text which isn't appropriate to return, e.g. because it's harmful or explicit
+type Moderator interface {
+	Moderate(ctx context.Context, text string) (bool, error)
+}
+
+// Moderate moderates the given text using the underlying service, if it supports moderation
+func (s *LLMService) Moderate(ctx context.Context, text string) (bool, error) {
+	if m, ok := s.provider.(Moderator); ok {
+		var flagged bool
+		err := s.passthrough(ctx, func() (err error) { flagged, err = m.Moderate(ctx, text); return err })
+		return flagged, err
+	}
+	return false, errors.New("LLM service doesn't support moderation")
+}
+
+// BlocklistModerator flags text which matches any of a set of patterns
+type BlocklistModerator struct {
+	Patterns []*regexp.Regexp
+}
+
+// NewBlocklistModerator creates a new blocklist moderator from the given patterns, which are matched case-insensitively
+func NewBlocklistModerator(patterns []string) (*BlocklistModerator, error) {
+	m := &BlocklistModerator{Patterns: make([]*regexp.Regexp, len(patterns))}
+	for i, p := range patterns {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid moderation pattern %q: %w", p, err)
+		}
+		m.Patterns[i] = re
+	}
+	return m, nil
+}
+
+func (m *BlocklistModerator) Moderate(ctx context.Context, text string) (bool, error) {
+	for _, p := range m.Patterns {
+		if p.MatchString(text) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// moderationService is an LLM service which moderates output before returning it
+type moderationService struct {
+	service    Service
+	moderators []Moderator
+	fallback   string
+}
+
+// NewModerationService wraps the given service so that output is checked by each of the given moderators, and flagged
+// output is replaced by the given fallback, or if that's empty, fails the call. Failing to moderate output also fails
+// the call rather than return output which may be inappropriate.
+func NewModerationService(svc Service, fallback string, moderators ...Moderator) Service {
+	return &moderationService{service: svc, moderators: moderators, fallback: fallback}
+}
+
+func (s *moderationService) Call(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := s.service.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Output == "" {
+		return resp, nil
+	}
+
+	for _, moderator := range s.moderators {
+		flagged, err := moderator.Moderate(ctx, resp.Output)
+		if err != nil {
+			return nil, &ServiceError{Message: fmt.Sprintf("error moderating output: %s", err), Code: ErrorUnknown, Instructions: req.Instructions, Input: req.Input}
+		}
+		if flagged {
+			if s.fallback == "" {
+				return nil, &ServiceError{Message: "output flagged by moderation", Code: ErrorContentFiltered, Instructions: req.Instructions, Input: req.Input}
+			}
+
+			resp.Output = s.fallback
+			resp.Moderated = true
+			break
+		}
+	}
+
+	return resp, nil
+}
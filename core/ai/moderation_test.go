@@ -0,0 +1,90 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// moderator for testing which returns a fixed result
+type fixedModerator struct {
+	flagged bool
+	err     error
+}
+
+func (m *fixedModerator) Moderate(ctx context.Context, text string) (bool, error) {
+	return m.flagged, m.err
+}
+
+func TestBlocklistModerator(t *testing.T) {
+	ctx := context.Background()
+
+	m, err := ai.NewBlocklistModerator([]string{`\bdamn\b`, `kill(ing)? yourself`})
+	require.NoError(t, err)
+
+	tcs := []struct {
+		text    string
+		flagged bool
+	}{
+		{"The clinic opens at 9am", false},
+		{"Damn, that's late", true},
+		{"Nobody should be killing yourself with work", true},
+		{"Amsterdamned", false},
+	}
+
+	for _, tc := range tcs {
+		flagged, err := m.Moderate(ctx, tc.text)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.flagged, flagged, "flagged mismatch for text %q", tc.text)
+	}
+
+	_, err = ai.NewBlocklistModerator([]string{`(unclosed`})
+	assert.EqualError(t, err, "invalid moderation pattern \"(unclosed\": error parsing regexp: missing closing ): `(?i)(unclosed`")
+}
+
+func TestModerationService(t *testing.T) {
+	ctx := context.Background()
+	req := &ai.Request{Instructions: "Answer the question", Input: "When do you open?", MaxTokens: 100}
+
+	// output not flagged
+	svc := ai.NewModerationService(&fixedLLM{output: "At 9am"}, "Sorry, I can't help with that.", &fixedModerator{}, &fixedModerator{})
+
+	resp, err := svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "At 9am", resp.Output)
+	assert.False(t, resp.Moderated)
+
+	// output flagged by second moderator is replaced by fallback
+	svc = ai.NewModerationService(&fixedLLM{output: "Something awful"}, "Sorry, I can't help with that.", &fixedModerator{}, &fixedModerator{flagged: true})
+
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Sorry, I can't help with that.", resp.Output)
+	assert.True(t, resp.Moderated)
+
+	// or fails the call if there's no fallback
+	svc = ai.NewModerationService(&fixedLLM{output: "Something awful"}, "", &fixedModerator{flagged: true})
+
+	_, err = svc.Call(ctx, req)
+	assert.EqualError(t, err, "output flagged by moderation")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorContentFiltered, serr.Code)
+	}
+
+	// moderation errors fail the call
+	svc = ai.NewModerationService(&fixedLLM{output: "At 9am"}, "Sorry", &fixedModerator{err: errors.New("boom")})
+
+	_, err = svc.Call(ctx, req)
+	assert.EqualError(t, err, "error moderating output: boom")
+
+	// as do moderation errors from services which don't support it
+	svc = ai.NewModerationService(&fixedLLM{output: "At 9am"}, "Sorry", ai.NewLLMService(&fixedLLM{}))
+
+	_, err = svc.Call(ctx, req)
+	assert.EqualError(t, err, "error moderating output: LLM service doesn't support moderation")
+}
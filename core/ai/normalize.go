@@ -0,0 +1,55 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// invisible characters which we strip. Zero-width joiners and non-joiners are kept because they are meaningful in some
+// scripts and in emoji sequences.
+var invisibleChars = map[rune]bool{
+	'\u00ad': true,                                                                 // soft hyphen
+	'\u180e': true,                                                                 // mongolian vowel separator
+	'\u200b': true,                                                                 // zero-width space
+	'\u2060': true,                                                                 // word joiner
+	'\ufeff': true,                                                                 // zero-width no-break space / byte order mark
+	'\u202a': true, '\u202b': true, '\u202c': true, '\u202d': true, '\u202e': true, // bidi embeddings and overrides
+	'\u2066': true, '\u2067': true, '\u2068': true, '\u2069': true, // bidi isolates
+}
+
+// Normalize applies NFC normalization to the given text and strips zero-width, bidi control and other control
+// characters, apart from tabs and newlines.
+func Normalize(s string) string {
+	s = norm.NFC.String(s)
+
+	return strings.Map(func(r rune) rune {
+		if invisibleChars[r] || (unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r') {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// normalizingService is an LLM service which normalizes text before passing it to another service
+type normalizingService struct {
+	service      Service
+	instructions bool
+}
+
+// NewNormalizingService wraps the given service so that input, and optionally instructions, are normalized
+func NewNormalizingService(svc Service, instructions bool) Service {
+	return &normalizingService{service: svc, instructions: instructions}
+}
+
+func (s *normalizingService) Call(ctx context.Context, req *Request) (*Response, error) {
+	normalized := *req
+	normalized.Input = Normalize(req.Input)
+	if s.instructions {
+		normalized.Instructions = Normalize(req.Instructions)
+	}
+
+	return s.service.Call(ctx, &normalized)
+}
@@ -0,0 +1,47 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/goflow/test/services"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tcs := []struct {
+		input    string
+		expected string
+	}{
+		{"Hello world", "Hello world"},
+		{"cafe\u0301", "café"},                             // combining acute accent composed
+		{"Bonjou\u200b tout\u200bmoun", "Bonjou toutmoun"}, // zero-width spaces stripped
+		{"\ufeffhello\u2060", "hello"},                     // BOM and word joiner stripped
+		{"abc\u202edef", "abcdef"},                         // bidi override stripped
+		{"bell\x07 and null\x00", "bell and null"},         // control characters stripped
+		{"line 1\nline 2\ttab", "line 1\nline 2\ttab"},     // newlines and tabs kept
+		{"👩\u200d💻", "👩\u200d💻"},                           // zero-width joiner in emoji sequence kept
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expected, ai.Normalize(tc.input), "normalize mismatch for %q", tc.input)
+	}
+}
+
+func TestNormalizingService(t *testing.T) {
+	ctx := context.Background()
+
+	svc := ai.NewNormalizingService(ai.AsService(services.NewLLM()), false)
+
+	resp, err := svc.Call(ctx, &ai.Request{Instructions: "Traduire\u200b", Input: "cafe\u0301\u200b noir", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "You asked:\n\nTraduire\u200b\n\ncafé noir", resp.Output)
+
+	svc = ai.NewNormalizingService(ai.AsService(services.NewLLM()), true)
+
+	resp, err = svc.Call(ctx, &ai.Request{Instructions: "Traduire\u200b", Input: "cafe\u0301\u200b noir", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "You asked:\n\nTraduire\n\ncafé noir", resp.Output)
+}
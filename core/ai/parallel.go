@@ -0,0 +1,148 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+)
+
+// ParallelStrategy is how a response is selected from those of services called in parallel
+type ParallelStrategy string
+
+const (
+	ParallelFirst    ParallelStrategy = "first"    // first successful response
+	ParallelCheapest ParallelStrategy = "cheapest" // successful response which cost least, according to model pricing
+	ParallelJudge    ParallelStrategy = "judge"    // successful response which a judge model picks as the best
+)
+
+// ParallelRoute is a service called in parallel and the model it uses
+type ParallelRoute struct {
+	Model   string
+	Service Service
+}
+
+// parallelService is an LLM service which calls several services concurrently and selects one of their responses
+type parallelService struct {
+	strategy ParallelStrategy
+	judge    Service
+	routes   []ParallelRoute
+}
+
+// NewParallelService creates a service which calls each of the given routes concurrently and selects a response using
+// the given strategy, so that a request only fails if every route fails. The tokens of responses which aren't selected
+// and of judging are added to the selected response so that they're accounted for, except for those of calls which are
+// cancelled once the first response has been selected. Which response was selected is recorded in its diagnostics.
+func NewParallelService(strategy ParallelStrategy, judge Service, routes ...ParallelRoute) Service {
+	return &parallelService{strategy: strategy, judge: judge, routes: routes}
+}
+
+type parallelResult struct {
+	index int
+	resp  *Response
+	err   error
+}
+
+func (s *parallelService) Call(ctx context.Context, req *Request) (*Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan *parallelResult, len(s.routes))
+	for i, route := range s.routes {
+		go func() {
+			resp, err := route.Service.Call(ctx, req)
+			if err == nil && resp.Model == "" {
+				resp.Model = route.Model
+			}
+			results <- &parallelResult{index: i, resp: resp, err: err}
+		}()
+	}
+
+	var diagnostics []string
+	var lastErr error
+	responses := make([]*Response, len(s.routes))
+
+	for range s.routes {
+		r := <-results
+		if r.err != nil {
+			diagnostics = append(diagnostics, fmt.Sprintf("%s failed: %s", s.routes[r.index].Model, r.err))
+			lastErr = r.err
+			continue
+		}
+		if s.strategy == ParallelFirst {
+			r.resp.Diagnostics = append(diagnostics, r.resp.Diagnostics...)
+			return r.resp, nil
+		}
+		responses[r.index] = r.resp
+	}
+
+	var candidates []*Response
+	for _, resp := range responses {
+		if resp != nil {
+			candidates = append(candidates, resp)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, lastErr
+	}
+
+	selected := candidates[0]
+	var judged *Response
+
+	if len(candidates) > 1 {
+		switch s.strategy {
+		case ParallelCheapest:
+			selected = cheapestResponse(candidates)
+		case ParallelJudge:
+			var err error
+			if judged, err = s.callJudge(ctx, req, candidates); err != nil {
+				diagnostics = append(diagnostics, fmt.Sprintf("judging failed: %s", err))
+			} else if n, err := strconv.Atoi(strings.Trim(strings.TrimSpace(judged.Output), ".")); err != nil || n < 1 || n > len(candidates) {
+				diagnostics = append(diagnostics, fmt.Sprintf("judge returned invalid candidate: %s", judged.Output))
+			} else {
+				selected = candidates[n-1]
+			}
+		}
+	}
+
+	diagnostics = append(diagnostics, fmt.Sprintf("selected %s from %d responses", selected.Model, len(candidates)))
+
+	for _, resp := range append(candidates, judged) {
+		if resp != nil && resp != selected {
+			selected.TokensInput += resp.TokensInput
+			selected.TokensOutput += resp.TokensOutput
+		}
+	}
+
+	selected.Diagnostics = append(diagnostics, selected.Diagnostics...)
+	return selected, nil
+}
+
+// asks the judge service which of the given candidate responses is the best
+func (s *parallelService) callJudge(ctx context.Context, req *Request, candidates []*Response) (*Response, error) {
+	var input strings.Builder
+	fmt.Fprintf(&input, "Instructions:\n%s\n\nInput:\n%s\n", req.Instructions, req.Input)
+	for i, c := range candidates {
+		fmt.Fprintf(&input, "\nCandidate %d:\n%s\n", i+1, c.Output)
+	}
+
+	return s.judge.Call(ctx, &Request{Instructions: prompts.Render("judge_responses", nil), Input: input.String(), MaxTokens: 10, Idempotent: true})
+}
+
+// gets the response which cost least, with responses from models without pricing considered the most expensive
+func cheapestResponse(candidates []*Response) *Response {
+	cheapest, lowest := candidates[0], math.Inf(1)
+	for _, c := range candidates {
+		cost := math.Inf(1)
+		if pricing := LookupPricing(c.Model); pricing != nil {
+			cost = pricing.Cost(c.TokensInput, c.TokensOutput)
+		}
+		if cost < lowest {
+			cheapest, lowest = c, cost
+		}
+	}
+	return cheapest
+}
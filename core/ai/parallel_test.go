@@ -0,0 +1,108 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// LLM service for testing which waits before calling another service, unless it's cancelled first
+type delayedLLM struct {
+	delay time.Duration
+	svc   ai.Service
+}
+
+func (s *delayedLLM) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	select {
+	case <-time.After(s.delay):
+		return s.svc.Call(ctx, req)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestParallelService(t *testing.T) {
+	ctx := context.Background()
+	req := &ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100}
+
+	ai.RegisterPricing("cheap-model", &ai.Pricing{Input: 0.1, Output: 0.4})
+	ai.RegisterPricing("pricey-model", &ai.Pricing{Input: 5, Output: 15})
+
+	// first strategy returns whichever succeeds first
+	svc := ai.NewParallelService(ai.ParallelFirst, nil,
+		ai.ParallelRoute{Model: "pricey-model", Service: &delayedLLM{delay: time.Second, svc: &fixedLLM{output: "Hola!"}}},
+		ai.ParallelRoute{Model: "cheap-model", Service: &fixedLLM{output: "Hola"}},
+	)
+	resp, err := svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Equal(t, "cheap-model", resp.Model)
+	assert.Equal(t, int64(10), resp.TokensInput)
+	assert.Nil(t, resp.Diagnostics)
+
+	// a route failing doesn't fail the request
+	svc = ai.NewParallelService(ai.ParallelFirst, nil,
+		ai.ParallelRoute{Model: "pricey-model", Service: &failingLLM{}},
+		ai.ParallelRoute{Model: "cheap-model", Service: &delayedLLM{delay: 10 * time.Millisecond, svc: &fixedLLM{output: "Hola"}}},
+	)
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Equal(t, []string{"pricey-model failed: 503 Service Unavailable"}, resp.Diagnostics)
+
+	// unless every route fails
+	svc = ai.NewParallelService(ai.ParallelFirst, nil,
+		ai.ParallelRoute{Model: "pricey-model", Service: &failingLLM{}},
+		ai.ParallelRoute{Model: "cheap-model", Service: &failingLLM{}},
+	)
+	_, err = svc.Call(ctx, req)
+	assert.EqualError(t, err, "503 Service Unavailable")
+
+	// cheapest strategy waits for all responses and selects the one which cost least
+	svc = ai.NewParallelService(ai.ParallelCheapest, nil,
+		ai.ParallelRoute{Model: "pricey-model", Service: &fixedLLM{output: "Hola!"}},
+		ai.ParallelRoute{Model: "cheap-model", Service: &delayedLLM{delay: 10 * time.Millisecond, svc: &fixedLLM{output: "Hola"}}},
+	)
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Equal(t, "cheap-model", resp.Model)
+	assert.Equal(t, int64(20), resp.TokensInput) // includes tokens of the other response
+	assert.Equal(t, int64(2), resp.TokensOutput)
+	assert.Equal(t, []string{"selected cheap-model from 2 responses"}, resp.Diagnostics)
+
+	// judge strategy asks the judge which is best
+	judge := &fixedLLM{output: "1"}
+	svc = ai.NewParallelService(ai.ParallelJudge, judge,
+		ai.ParallelRoute{Model: "pricey-model", Service: &fixedLLM{output: "¡Hola!"}},
+		ai.ParallelRoute{Model: "cheap-model", Service: &fixedLLM{output: "Hola"}},
+	)
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "¡Hola!", resp.Output)
+	assert.Equal(t, "pricey-model", resp.Model)
+	assert.Equal(t, int64(30), resp.TokensInput) // includes tokens of the other response and judging
+	assert.Equal(t, []string{"selected pricey-model from 2 responses"}, resp.Diagnostics)
+	assert.Equal(t, "Instructions:\ntranslate to Spanish\n\nInput:\nHello\n\nCandidate 1:\n¡Hola!\n\nCandidate 2:\nHola\n", judge.last.Input)
+
+	// an invalid answer from the judge means the first candidate is selected
+	judge.output = "both"
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "¡Hola!", resp.Output)
+	assert.Equal(t, []string{"judge returned invalid candidate: both", "selected pricey-model from 2 responses"}, resp.Diagnostics)
+
+	// as does the judge failing
+	svc = ai.NewParallelService(ai.ParallelJudge, &failingLLM{},
+		ai.ParallelRoute{Model: "pricey-model", Service: &fixedLLM{output: "¡Hola!"}},
+		ai.ParallelRoute{Model: "cheap-model", Service: &fixedLLM{output: "Hola"}},
+	)
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "¡Hola!", resp.Output)
+	assert.Equal(t, []string{"judging failed: 503 Service Unavailable", "selected pricey-model from 2 responses"}, resp.Diagnostics)
+}
@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"maps"
+	"slices"
+)
+
+// DefaultTemperature is the temperature used by services which don't have one configured, as close to deterministic as
+// providers allow
+const DefaultTemperature = 0.000001
+
+// Params are the generation parameters applied to requests made by an LLM service. Nil values mean that the
+// service's own default is used.
+type Params struct {
+	Temperature      *float64
+	TopP             *float64
+	JSONMode         *bool
+	Seed             *int64   // for more reproducible sampling, if the provider supports it
+	FrequencyPenalty *float64 // penalizes tokens by how often they've already appeared, if the provider supports it
+	PresencePenalty  *float64 // penalizes tokens which have already appeared, if the provider supports it
+}
+
+// Override returns a copy of these params with any values set in other taking precedence
+func (p Params) Override(other Params) Params {
+	if other.Temperature != nil {
+		p.Temperature = other.Temperature
+	}
+	if other.TopP != nil {
+		p.TopP = other.TopP
+	}
+	if other.JSONMode != nil {
+		p.JSONMode = other.JSONMode
+	}
+	if other.Seed != nil {
+		p.Seed = other.Seed
+	}
+	if other.FrequencyPenalty != nil {
+		p.FrequencyPenalty = other.FrequencyPenalty
+	}
+	if other.PresencePenalty != nil {
+		p.PresencePenalty = other.PresencePenalty
+	}
+	return p
+}
+
+// Applied returns these params along with the given model and max tokens as a map of what was actually sent to a
+// provider, for debugging
+func (p Params) Applied(model string, maxTokens int) map[string]any {
+	applied := map[string]any{"model": model, "max_tokens": maxTokens}
+	if p.Temperature != nil {
+		applied["temperature"] = *p.Temperature
+	}
+	if p.TopP != nil {
+		applied["top_p"] = *p.TopP
+	}
+	if p.JSONMode != nil {
+		applied["json_mode"] = *p.JSONMode
+	}
+	if p.Seed != nil {
+		applied["seed"] = *p.Seed
+	}
+	if p.FrequencyPenalty != nil {
+		applied["frequency_penalty"] = *p.FrequencyPenalty
+	}
+	if p.PresencePenalty != nil {
+		applied["presence_penalty"] = *p.PresencePenalty
+	}
+	return applied
+}
+
+var presets = map[string]Params{}
+
+func init() {
+	RegisterPreset("precise", Params{Temperature: new(DefaultTemperature)})
+	RegisterPreset("balanced", Params{Temperature: new(0.5), TopP: new(0.9)})
+	RegisterPreset("creative", Params{Temperature: new(0.9), TopP: new(0.95)})
+	RegisterPreset("json", Params{Temperature: new(DefaultTemperature), JSONMode: new(true)})
+}
+
+// RegisterPreset registers a named bundle of params which LLMs can use as defaults
+func RegisterPreset(name string, params Params) {
+	presets[name] = params
+}
+
+// Preset returns the params of the preset with the given name
+func Preset(name string) (Params, bool) {
+	p, ok := presets[name]
+	return p, ok
+}
+
+// Presets returns the names of all registered presets
+func Presets() []string {
+	return slices.Sorted(maps.Keys(presets))
+}
@@ -0,0 +1,41 @@
+package ai_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresets(t *testing.T) {
+	assert.Equal(t, []string{"balanced", "creative", "json", "precise"}, ai.Presets())
+
+	p, ok := ai.Preset("creative")
+	assert.True(t, ok)
+	assert.Equal(t, ai.Params{Temperature: new(0.9), TopP: new(0.95)}, p)
+
+	p, ok = ai.Preset("json")
+	assert.True(t, ok)
+	assert.Equal(t, ai.Params{Temperature: new(0.000001), JSONMode: new(true)}, p)
+
+	_, ok = ai.Preset("xxx")
+	assert.False(t, ok)
+}
+
+func TestParamsOverride(t *testing.T) {
+	base := ai.Params{Temperature: new(0.9), TopP: new(0.95)}
+
+	assert.Equal(t, base, base.Override(ai.Params{}))
+	assert.Equal(t, ai.Params{Temperature: new(0.1), TopP: new(0.95)}, base.Override(ai.Params{Temperature: new(0.1)}))
+	assert.Equal(t, ai.Params{Temperature: new(0.9), TopP: new(0.95), JSONMode: new(false)}, base.Override(ai.Params{JSONMode: new(false)}))
+	assert.Equal(t, ai.Params{Temperature: new(0.9), TopP: new(0.95), Seed: new(int64(42)), FrequencyPenalty: new(0.5), PresencePenalty: new(-0.5)}, base.Override(ai.Params{Seed: new(int64(42)), FrequencyPenalty: new(0.5), PresencePenalty: new(-0.5)}))
+
+	// original is unchanged
+	assert.Equal(t, ai.Params{Temperature: new(0.9), TopP: new(0.95)}, base)
+}
+
+func TestParamsApplied(t *testing.T) {
+	assert.Equal(t, map[string]any{"model": "gpt-4o", "max_tokens": 1000}, ai.Params{}.Applied("gpt-4o", 1000))
+	assert.Equal(t, map[string]any{"model": "gpt-4o", "max_tokens": 1000, "temperature": 0.9, "top_p": 0.95, "json_mode": true}, ai.Params{Temperature: new(0.9), TopP: new(0.95), JSONMode: new(true)}.Applied("gpt-4o", 1000))
+	assert.Equal(t, map[string]any{"model": "gpt-4o", "max_tokens": 1000, "seed": int64(42), "frequency_penalty": 0.5, "presence_penalty": 0.2}, ai.Params{Seed: new(int64(42)), FrequencyPenalty: new(0.5), PresencePenalty: new(0.2)}.Applied("gpt-4o", 1000))
+}
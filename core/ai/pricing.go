@@ -0,0 +1,59 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Pricing is the cost of a model's tokens in USD per million tokens
+type Pricing struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Cost returns the cost in USD of the given numbers of input and output tokens
+func (p *Pricing) Cost(input, output int64) float64 {
+	return (float64(input)*p.Input + float64(output)*p.Output) / 1_000_000
+}
+
+var modelPricing = map[string]*Pricing{}
+
+// RegisterPricing registers the pricing of a model
+func RegisterPricing(name string, p *Pricing) {
+	modelPricing[strings.ToLower(name)] = p
+}
+
+// LoadPricing registers the pricing of models from a JSON file of model names to pricings, e.g.
+// {"gpt-4o": {"input": 2.5, "output": 10}}, since prices vary by deployment and change over time.
+func LoadPricing(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading pricing file: %w", err)
+	}
+
+	pricing := map[string]*Pricing{}
+	if err := json.Unmarshal(b, &pricing); err != nil {
+		return fmt.Errorf("error parsing pricing file: %w", err)
+	}
+
+	for name, p := range pricing {
+		RegisterPricing(name, p)
+	}
+	return nil
+}
+
+// LookupPricing looks up the pricing of a model by name, resolving dated or versioned names in the same way as
+// LookupModel. Returns nil if the model has no pricing.
+func LookupPricing(name string) *Pricing {
+	name = strings.ToLower(name)
+
+	var match string
+	for known := range modelPricing {
+		if (name == known || strings.HasPrefix(name, known+"-")) && len(known) > len(match) {
+			match = known
+		}
+	}
+	return modelPricing[match]
+}
@@ -0,0 +1,26 @@
+package ai_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPricing(t *testing.T) {
+	assert.EqualError(t, ai.LoadPricing("testdata/missing.json"), "error reading pricing file: open testdata/missing.json: no such file or directory")
+
+	require.NoError(t, ai.LoadPricing("testdata/pricing.json"))
+
+	p := ai.LookupPricing("test-model")
+	if assert.NotNil(t, p) {
+		assert.Equal(t, 2.5, p.Input)
+		assert.InDelta(t, 0.0045, p.Cost(1000, 200), 0.0000001)
+	}
+
+	assert.Equal(t, 0.15, ai.LookupPricing("test-model-mini-2024-07-18").Input)
+	assert.Equal(t, 2.5, ai.LookupPricing("TEST-MODEL-2024-08-06").Input)
+	assert.Nil(t, ai.LookupPricing("test-modelx"))
+	assert.Nil(t, ai.LookupPricing("unpriced"))
+}
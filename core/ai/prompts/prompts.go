@@ -11,15 +11,91 @@ import (
 //go:embed templates/categorize.txt
 var categorize string
 
+//go:embed templates/contact_query.txt
+var contactQuery string
+
+//go:embed templates/conversation_summary.txt
+var conversationSummary string
+
+//go:embed templates/digest_conversations.txt
+var digestConversations string
+
+//go:embed templates/extract_fields.txt
+var extractFields string
+
+//go:embed templates/identify_language.txt
+var identifyLanguage string
+
+//go:embed templates/judge_responses.txt
+var judgeResponses string
+
+//go:embed templates/knowledge_context.txt
+var knowledgeContext string
+
+//go:embed templates/quick_replies.txt
+var quickReplies string
+
+//go:embed templates/repair_json.txt
+var repairJSON string
+
+//go:embed templates/score_sentiment.txt
+var scoreSentiment string
+
+//go:embed templates/score_spam.txt
+var scoreSpam string
+
+//go:embed templates/screen_injection.txt
+var screenInjection string
+
+//go:embed templates/sim_persona.txt
+var simPersona string
+
+//go:embed templates/summarize_conversation.txt
+var summarizeConversation string
+
+//go:embed templates/suggest_replies.txt
+var suggestReplies string
+
+//go:embed templates/summarize_transcript.txt
+var summarizeTranscript string
+
+//go:embed templates/template_variables.txt
+var templateVariables string
+
+//go:embed templates/ticket_topic.txt
+var ticketTopic string
+
 //go:embed templates/translate.txt
 var translate string
 
+//go:embed templates/translate_message.txt
+var translateMessage string
+
 //go:embed templates/translate_unknown_from.txt
 var translateUnknownFrom string
 
 var templates = map[string]*template.Template{
 	"categorize":             template.Must(template.New("").Parse(categorize)),
+	"contact_query":          template.Must(template.New("").Parse(contactQuery)),
+	"conversation_summary":   template.Must(template.New("").Parse(conversationSummary)),
+	"digest_conversations":   template.Must(template.New("").Parse(digestConversations)),
+	"extract_fields":         template.Must(template.New("").Parse(extractFields)),
+	"identify_language":      template.Must(template.New("").Parse(identifyLanguage)),
+	"judge_responses":        template.Must(template.New("").Parse(judgeResponses)),
+	"knowledge_context":      template.Must(template.New("").Parse(knowledgeContext)),
+	"quick_replies":          template.Must(template.New("").Parse(quickReplies)),
+	"repair_json":            template.Must(template.New("").Parse(repairJSON)),
+	"score_sentiment":        template.Must(template.New("").Parse(scoreSentiment)),
+	"score_spam":             template.Must(template.New("").Parse(scoreSpam)),
+	"screen_injection":       template.Must(template.New("").Parse(screenInjection)),
+	"sim_persona":            template.Must(template.New("").Parse(simPersona)),
+	"summarize_conversation": template.Must(template.New("").Parse(summarizeConversation)),
+	"suggest_replies":        template.Must(template.New("").Parse(suggestReplies)),
+	"summarize_transcript":   template.Must(template.New("").Parse(summarizeTranscript)),
+	"template_variables":     template.Must(template.New("").Parse(templateVariables)),
+	"ticket_topic":           template.Must(template.New("").Parse(ticketTopic)),
 	"translate":              template.Must(template.New("").Parse(translate)),
+	"translate_message":      template.Must(template.New("").Parse(translateMessage)),
 	"translate_unknown_from": template.Must(template.New("").Parse(translateUnknownFrom)),
 }
 
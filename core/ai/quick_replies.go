@@ -0,0 +1,87 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+)
+
+// MaxQuickReplyLength is the maximum length of a suggested quick reply, as channels truncate or reject longer buttons
+const MaxQuickReplyLength = 20
+
+var quickRepliesSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"response":      map[string]any{"type": "string"},
+		"quick_replies": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+	},
+	"required":             []any{"response", "quick_replies"},
+	"additionalProperties": false,
+}
+
+// quickRepliesService is an LLM service which has the model suggest quick replies alongside its response
+type quickRepliesService struct {
+	service Service
+	max     int
+}
+
+// NewQuickRepliesService wraps the given service so that the model responds with structured output containing both its
+// response and up to max short replies which the contact could send back, which are returned as the output and quick
+// replies of the response. Requests which have their own schema or tools are passed through as is, as is output which
+// doesn't have the expected structure, e.g. from models which don't support structured output.
+func NewQuickRepliesService(svc Service, max int) Service {
+	return &quickRepliesService{service: svc, max: max}
+}
+
+func (s *quickRepliesService) Call(ctx context.Context, req *Request) (*Response, error) {
+	if req.Schema != nil || len(req.Tools) > 0 {
+		return s.service.Call(ctx, req)
+	}
+
+	call := *req
+	call.Instructions = strings.TrimSpace(prompts.Render("quick_replies", map[string]any{"Instructions": req.Instructions, "Max": s.max, "MaxLength": MaxQuickReplyLength}))
+	call.Schema = quickRepliesSchema
+
+	resp, err := s.service.Call(ctx, &call)
+	if err != nil {
+		return nil, err
+	}
+
+	var structured struct {
+		Response     string   `json:"response"`
+		QuickReplies []string `json:"quick_replies"`
+	}
+
+	output := resp.Output
+	if extracted, ok := ExtractJSON(output); ok {
+		output = extracted
+	}
+	if err := json.Unmarshal([]byte(output), &structured); err != nil || structured.Response == "" {
+		resp.Diagnostics = append(resp.Diagnostics, "output didn't include quick replies")
+		return resp, nil
+	}
+
+	resp.Output = structured.Response
+	resp.QuickReplies = cleanQuickReplies(structured.QuickReplies, s.max)
+	return resp, nil
+}
+
+// trims the given quick replies, dropping any which are empty, duplicates or too long, up to the given maximum
+func cleanQuickReplies(replies []string, max int) []string {
+	cleaned := make([]string, 0, len(replies))
+	for _, r := range replies {
+		r = strings.TrimSpace(r)
+		if r == "" || utf8.RuneCountInString(r) > MaxQuickReplyLength || slices.ContainsFunc(cleaned, func(c string) bool { return strings.EqualFold(c, r) }) {
+			continue
+		}
+		cleaned = append(cleaned, r)
+		if len(cleaned) == max {
+			break
+		}
+	}
+	return cleaned
+}
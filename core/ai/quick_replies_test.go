@@ -0,0 +1,52 @@
+package ai_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuickRepliesService(t *testing.T) {
+	ctx := context.Background()
+	req := &ai.Request{Instructions: "Ask the user if they want to continue.", Input: "Hi", MaxTokens: 100}
+
+	llm := &fixedLLM{output: `{"response": "Do you want to continue?", "quick_replies": ["Yes", "No", "yes", " ", "Not right now, thanks", "Maybe", "Later"]}`}
+	svc := ai.NewQuickRepliesService(llm, 3)
+
+	// output is split into the response and quick replies, which are cleaned up
+	resp, err := svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Do you want to continue?", resp.Output)
+	assert.Equal(t, []string{"Yes", "No", "Maybe"}, resp.QuickReplies)
+	assert.Nil(t, resp.Diagnostics)
+	assert.True(t, strings.HasPrefix(llm.last.Instructions, "Ask the user if they want to continue.\n\nRespond with a JSON object"))
+	assert.Contains(t, llm.last.Instructions, "up to 3 short replies")
+	assert.NotNil(t, llm.last.Schema)
+
+	// JSON wrapped in code fences is extracted
+	llm.output = "```json\n{\"response\": \"Bye!\", \"quick_replies\": []}\n```"
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Bye!", resp.Output)
+	assert.Equal(t, []string{}, resp.QuickReplies)
+
+	// output without the expected structure is returned as is
+	llm.output = "Do you want to continue?"
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Do you want to continue?", resp.Output)
+	assert.Nil(t, resp.QuickReplies)
+	assert.Equal(t, []string{"output didn't include quick replies"}, resp.Diagnostics)
+
+	// as are requests with their own schema
+	llm.output = `{"response": "Yes", "quick_replies": ["No"]}`
+	resp, err = svc.Call(ctx, &ai.Request{Instructions: "Extract", Input: "Hi", Schema: map[string]any{"type": "object"}, MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, `{"response": "Yes", "quick_replies": ["No"]}`, resp.Output)
+	assert.Nil(t, resp.QuickReplies)
+	assert.Equal(t, "Extract", llm.last.Instructions)
+}
@@ -0,0 +1,42 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+)
+
+// RateLimiter limits the rate at which LLM calls can be made
+type RateLimiter interface {
+	Allow(ctx context.Context) (bool, error)
+}
+
+// rateLimitService is an LLM service which only makes calls allowed by a rate limiter
+type rateLimitService struct {
+	service Service
+	limiter RateLimiter
+}
+
+// NewRateLimitService wraps the given service so that calls not allowed by the given rate limiter are rejected with a
+// rate limit error. Failures to check the limiter don't fail calls.
+func NewRateLimitService(svc Service, l RateLimiter) Service {
+	return &rateLimitService{service: svc, limiter: l}
+}
+
+func (s *rateLimitService) Call(ctx context.Context, req *Request) (*Response, error) {
+	var diagnostics []string
+
+	allowed, err := s.limiter.Allow(ctx)
+	if err != nil {
+		diagnostics = append(diagnostics, fmt.Sprintf("error checking rate limit: %s", err))
+	} else if !allowed {
+		return nil, &ServiceError{Message: "rate limit exceeded", Code: ErrorRateLimit, Instructions: req.Instructions, Input: req.Input}
+	}
+
+	resp, err := s.service.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Diagnostics = append(resp.Diagnostics, diagnostics...)
+	return resp, nil
+}
@@ -0,0 +1,55 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rate limiter for testing which allows a fixed number of calls
+type fixedRateLimiter struct {
+	remaining int
+	err       error
+}
+
+func (l *fixedRateLimiter) Allow(ctx context.Context) (bool, error) {
+	if l.remaining <= 0 {
+		return false, l.err
+	}
+	l.remaining--
+	return true, l.err
+}
+
+func TestRateLimitService(t *testing.T) {
+	ctx := context.Background()
+	llm := &fixedLLM{output: "Hola"}
+	svc := ai.NewRateLimitService(llm, &fixedRateLimiter{remaining: 2})
+
+	req := &ai.Request{Instructions: "Translate to Spanish", Input: "Hello", MaxTokens: 10}
+
+	for range 2 {
+		resp, err := svc.Call(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, "Hola", resp.Output)
+		assert.Nil(t, resp.Diagnostics)
+	}
+
+	_, err := svc.Call(ctx, req)
+	assert.EqualError(t, err, "rate limit exceeded")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorRateLimit, serr.Code)
+	}
+	assert.Equal(t, 2, llm.calls)
+
+	// limiter errors don't fail calls
+	svc = ai.NewRateLimitService(llm, &fixedRateLimiter{remaining: 1, err: errors.New("boom")})
+
+	resp, err := svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"error checking rate limit: boom"}, resp.Diagnostics)
+}
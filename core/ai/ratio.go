@@ -0,0 +1,33 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+)
+
+// completionRatioService is an LLM service which limits requested output relative to the size of the prompt
+type completionRatioService struct {
+	service  Service
+	maxRatio float64
+}
+
+// NewCompletionRatioService wraps the given service so that requests where max tokens exceeds the given ratio to the
+// estimated number of prompt tokens are rejected, e.g. to prevent a tiny prompt being used to generate large output.
+func NewCompletionRatioService(svc Service, maxRatio float64) Service {
+	return &completionRatioService{service: svc, maxRatio: maxRatio}
+}
+
+func (s *completionRatioService) Call(ctx context.Context, req *Request) (*Response, error) {
+	promptTokens := max(EstimateTokens(req.Instructions)+EstimateTokens(req.Input), 1)
+
+	if ratio := float64(req.MaxTokens) / float64(promptTokens); ratio > s.maxRatio {
+		return nil, &ServiceError{
+			Message:      fmt.Sprintf("requested max tokens of %d is %.1f times the estimated %d prompt tokens which exceeds the limit of %g", req.MaxTokens, ratio, promptTokens, s.maxRatio),
+			Code:         ErrorMaxTokens,
+			Instructions: req.Instructions,
+			Input:        req.Input,
+		}
+	}
+
+	return s.service.Call(ctx, req)
+}
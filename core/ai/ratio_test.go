@@ -0,0 +1,32 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompletionRatioService(t *testing.T) {
+	ctx := context.Background()
+
+	llm := &fixedLLM{output: "Hola"}
+	svc := ai.NewCompletionRatioService(llm, 50)
+
+	// prompt of about 10 tokens with 400 max tokens is within policy
+	resp, err := svc.Call(ctx, &ai.Request{Instructions: "Translate to Spanish", Input: "Hello, how are you today?", MaxTokens: 400})
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Equal(t, 1, llm.calls)
+
+	// tiny prompt with enormous max tokens is rejected
+	_, err = svc.Call(ctx, &ai.Request{Instructions: "Write", Input: "Go", MaxTokens: 16000})
+	assert.EqualError(t, err, "requested max tokens of 16000 is 5333.3 times the estimated 3 prompt tokens which exceeds the limit of 50")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorMaxTokens, serr.Code)
+	}
+	assert.Equal(t, 1, llm.calls)
+}
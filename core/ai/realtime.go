@@ -0,0 +1,64 @@
+package ai
+
+import (
+	"context"
+	"errors"
+)
+
+// RealtimeEventType is the type of an event received from a realtime session
+type RealtimeEventType string
+
+const (
+	RealtimeEventAudio       RealtimeEventType = "audio"       // audio spoken by the agent
+	RealtimeEventInterrupted RealtimeEventType = "interrupted" // caller started speaking so agent audio not yet played should be dropped
+	RealtimeEventTranscript  RealtimeEventType = "transcript"  // transcription of something said by the caller or agent
+	RealtimeEventUsage       RealtimeEventType = "usage"       // tokens used by a response of the agent
+	RealtimeEventEnded       RealtimeEventType = "ended"       // agent ended the conversation with its results
+)
+
+// speakers of transcripts in realtime sessions
+const (
+	RealtimeSpeakerCaller = "caller"
+	RealtimeSpeakerAgent  = "agent"
+)
+
+// RealtimeEvent is an event received from a realtime session
+type RealtimeEvent struct {
+	Type         RealtimeEventType
+	Audio        []byte            // for audio events
+	Speaker      string            // for transcript events
+	Text         string            // for transcript events
+	TokensInput  int64             // for usage events
+	TokensOutput int64             // for usage events
+	Results      map[string]string // for ended events
+}
+
+// RealtimeConfig is the configuration of a realtime session
+type RealtimeConfig struct {
+	Instructions string
+	Voice        string
+}
+
+// RealtimeSession is a speech to speech conversation with a model, with audio in both directions as 8kHz G.711 μ-law
+// which is what telephony providers stream. The agent ends the conversation once it has what it needs and provides its
+// results, which are whatever the instructions asked it to find out.
+type RealtimeSession interface {
+	SendAudio(ctx context.Context, audio []byte) error
+	Receive(ctx context.Context) (*RealtimeEvent, error)
+	Close() error
+}
+
+// RealtimeService is a service which can hold realtime speech to speech sessions, e.g. as an agent on IVR calls
+type RealtimeService interface {
+	Realtime(ctx context.Context, cfg *RealtimeConfig) (RealtimeSession, error)
+}
+
+// Realtime starts a realtime session using the underlying service, if it supports realtime sessions
+func (s *LLMService) Realtime(ctx context.Context, cfg *RealtimeConfig) (RealtimeSession, error) {
+	if rs, ok := s.provider.(RealtimeService); ok {
+		var session RealtimeSession
+		err := s.passthrough(ctx, func() (err error) { session, err = rs.Realtime(ctx, cfg); return err })
+		return session, err
+	}
+	return nil, errors.New("LLM service doesn't support realtime sessions")
+}
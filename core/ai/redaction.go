@@ -0,0 +1,173 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// RedactMode is how personal information is redacted from requests
+type RedactMode string
+
+const (
+	RedactModeStrip        RedactMode = "strip"        // replaced with a marker and lost
+	RedactModePseudonymize RedactMode = "pseudonymize" // replaced with placeholders which are restored in the output
+)
+
+// SensitiveValues provides values which should be redacted from a request in addition to phone numbers and emails,
+// e.g. the values of some of the fields of the contact it's being made for
+type SensitiveValues interface {
+	Values(ctx context.Context) ([]string, error)
+}
+
+var (
+	redactEmailRegex = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	redactPhoneRegex = regexp.MustCompile(`\+?\d[\d\s().\-]{6,}\d`)
+)
+
+// minimum length of sensitive values which we redact, as shorter values would redact common words and numbers
+const minSensitiveValueLength = 3
+
+const redactedMarker = "[REDACTED]"
+
+const pseudonymizedInstructions = "Values in square brackets such as [EMAIL_1] or [PHONE_1] are placeholders for personal information. Keep any you use exactly as they are."
+
+// redactingService is an LLM service which redacts personal information from requests before passing them on
+type redactingService struct {
+	service Service
+	mode    RedactMode
+	values  SensitiveValues
+}
+
+// NewRedactingService wraps the given service so that phone numbers, emails and any values from the given source are
+// redacted from the instructions, input and history of requests. They are either stripped or pseudonymized, in which
+// case placeholders are restored in the output. Failing to load values fails the call rather than send them.
+func NewRedactingService(svc Service, mode RedactMode, values SensitiveValues) Service {
+	return &redactingService{service: svc, mode: mode, values: values}
+}
+
+func (s *redactingService) Call(ctx context.Context, req *Request) (*Response, error) {
+	var values []string
+	if s.values != nil {
+		var err error
+		if values, err = s.values.Values(ctx); err != nil {
+			return nil, &ServiceError{Message: fmt.Sprintf("error loading values to redact: %s", err), Code: ErrorUnknown, Instructions: req.Instructions, Input: req.Input}
+		}
+	}
+
+	r := newRedactor(s.mode == RedactModeStrip, values)
+
+	redacted := *req
+	redacted.Instructions = r.redact(req.Instructions)
+	redacted.Input = r.redact(req.Input)
+	redacted.History = nil
+	for _, t := range req.History {
+		redacted.History = append(redacted.History, &Turn{Input: r.redact(t.Input), Output: r.redact(t.Output)})
+	}
+
+	if !r.strip && len(r.originals) > 0 {
+		redacted.Instructions = strings.TrimSpace(redacted.Instructions + "\n\n" + pseudonymizedInstructions)
+	}
+
+	resp, err := s.service.Call(ctx, &redacted)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Output = r.restore(resp.Output)
+	for _, tc := range resp.ToolCalls {
+		tc.Arguments = r.restoreJSON(tc.Arguments)
+	}
+	return resp, nil
+}
+
+// replaces personal information in text with placeholders, using the same placeholder for each occurrence of a value
+type redactor struct {
+	strip     bool
+	values    []string
+	originals map[string]string // placeholders to the values they replaced
+	assigned  map[string]string // values to their placeholders
+	counts    map[string]int    // number of placeholders by kind
+}
+
+func newRedactor(strip bool, values []string) *redactor {
+	// redact longer values first so that values which contain others are redacted whole
+	values = slices.DeleteFunc(slices.Clone(values), func(v string) bool { return len(strings.TrimSpace(v)) < minSensitiveValueLength })
+	slices.SortFunc(values, func(a, b string) int { return len(b) - len(a) })
+
+	return &redactor{strip: strip, values: values, originals: make(map[string]string), assigned: make(map[string]string), counts: make(map[string]int)}
+}
+
+func (r *redactor) redact(text string) string {
+	if text == "" {
+		return text
+	}
+
+	for _, v := range r.values {
+		if strings.Contains(text, v) {
+			text = strings.ReplaceAll(text, v, r.placeholder("PII", v))
+		}
+	}
+
+	text = redactEmailRegex.ReplaceAllStringFunc(text, func(m string) string { return r.placeholder("EMAIL", m) })
+
+	return redactPhoneRegex.ReplaceAllStringFunc(text, func(m string) string {
+		// E.164 numbers have at most 15 digits, and requiring 9 avoids redacting dates and other shorter numbers
+		if digits := len(strings.Map(keepDigits, m)); digits < 9 || digits > 15 {
+			return m
+		}
+		return r.placeholder("PHONE", m)
+	})
+}
+
+func (r *redactor) placeholder(kind, value string) string {
+	if r.strip {
+		return redactedMarker
+	}
+	if p, ok := r.assigned[value]; ok {
+		return p
+	}
+
+	r.counts[kind]++
+	p := fmt.Sprintf("[%s_%d]", kind, r.counts[kind])
+	r.assigned[value] = p
+	r.originals[p] = value
+	return p
+}
+
+func (r *redactor) restore(text string) string {
+	if len(r.originals) == 0 {
+		return text
+	}
+
+	pairs := make([]string, 0, len(r.originals)*2)
+	for p, v := range r.originals {
+		pairs = append(pairs, p, v)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// restores placeholders inside the strings of JSON, escaping values as needed
+func (r *redactor) restoreJSON(data json.RawMessage) json.RawMessage {
+	if len(r.originals) == 0 || len(data) == 0 {
+		return data
+	}
+
+	pairs := make([]string, 0, len(r.originals)*2)
+	for p, v := range r.originals {
+		escaped, _ := json.Marshal(v)
+		pairs = append(pairs, p, string(escaped[1:len(escaped)-1]))
+	}
+	return json.RawMessage(strings.NewReplacer(pairs...).Replace(string(data)))
+}
+
+func keepDigits(r rune) rune {
+	if unicode.IsDigit(r) {
+		return r
+	}
+	return -1
+}
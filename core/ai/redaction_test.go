@@ -0,0 +1,72 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sensitive values for testing which are fixed
+type fixedValues struct {
+	values []string
+	err    error
+}
+
+func (v *fixedValues) Values(ctx context.Context) ([]string, error) { return v.values, v.err }
+
+func TestRedactingService(t *testing.T) {
+	ctx := context.Background()
+	values := &fixedValues{values: []string{"AB-1234-XY", "M"}}
+
+	req := &ai.Request{
+		Instructions: "Summarize the message",
+		Input:        "I'm bob@example.com, call +250 788 123 456 or 0788123456. ID AB-1234-XY. Born 2001-02-03. bob@example.com again.",
+		History:      []*ai.Turn{{Input: "My number is +250 788 123 456", Output: "Thanks"}},
+		MaxTokens:    100,
+	}
+
+	// pseudonymize mode
+	llm := &fixedLLM{output: "Contact [EMAIL_1] at [PHONE_1] about [PII_1]"}
+	svc := ai.NewRedactingService(llm, ai.RedactModePseudonymize, values)
+
+	resp, err := svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Contact bob@example.com at +250 788 123 456 about AB-1234-XY", resp.Output)
+	assert.Equal(t, "I'm [EMAIL_1], call [PHONE_1] or [PHONE_2]. ID [PII_1]. Born 2001-02-03. [EMAIL_1] again.", llm.last.Input)
+	assert.Equal(t, "Summarize the message\n\nValues in square brackets such as [EMAIL_1] or [PHONE_1] are placeholders for personal information. Keep any you use exactly as they are.", llm.last.Instructions)
+	assert.Equal(t, []*ai.Turn{{Input: "My number is [PHONE_1]", Output: "Thanks"}}, llm.last.History)
+
+	// original request isn't modified
+	assert.Equal(t, "My number is +250 788 123 456", req.History[0].Input)
+
+	// strip mode
+	llm = &fixedLLM{output: "Contact [REDACTED]"}
+	svc = ai.NewRedactingService(llm, ai.RedactModeStrip, values)
+
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Contact [REDACTED]", resp.Output)
+	assert.Equal(t, "I'm [REDACTED], call [REDACTED] or [REDACTED]. ID [REDACTED]. Born 2001-02-03. [REDACTED] again.", llm.last.Input)
+	assert.Equal(t, "Summarize the message", llm.last.Instructions)
+
+	// nothing to redact
+	llm = &fixedLLM{output: "Hola"}
+	svc = ai.NewRedactingService(llm, ai.RedactModePseudonymize, nil)
+
+	resp, err = svc.Call(ctx, &ai.Request{Instructions: "Translate to Spanish", Input: "Hello", MaxTokens: 10})
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Equal(t, "Translate to Spanish", llm.last.Instructions)
+	assert.Nil(t, llm.last.History)
+
+	// failing to load values fails the call
+	svc = ai.NewRedactingService(llm, ai.RedactModePseudonymize, &fixedValues{err: errors.New("boom")})
+
+	_, err = svc.Call(ctx, req)
+	assert.EqualError(t, err, "error loading values to redact: boom")
+	assert.Equal(t, 1, llm.calls)
+}
@@ -0,0 +1,59 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ResponseCache stores responses to requests so that repeated identical requests needn't be sent to providers
+type ResponseCache interface {
+	Get(ctx context.Context, key string) (*Response, error) // returns nil if there is no response for the key
+	Set(ctx context.Context, key string, resp *Response, ttl time.Duration) error
+}
+
+// cachingService is an LLM service which serves repeated requests from a response cache
+type cachingService struct {
+	service Service
+	cache   ResponseCache
+	scope   string
+	ttl     time.Duration
+}
+
+// NewCachingService wraps the given service so that responses are cached for the given TTL and identical requests
+// within the same scope are served from the cache. Cached responses have no token usage, as no spend was incurred.
+// Requests with tools aren't cached as their responses may depend on more than the request itself.
+func NewCachingService(svc Service, c ResponseCache, scope string, ttl time.Duration) Service {
+	return &cachingService{service: svc, cache: c, scope: scope, ttl: ttl}
+}
+
+func (s *cachingService) Call(ctx context.Context, req *Request) (*Response, error) {
+	if len(req.Tools) > 0 {
+		return s.service.Call(ctx, req)
+	}
+
+	key := s.scope + ":" + HashRequest(req, nil)
+	var diagnostics []string
+
+	cached, err := s.cache.Get(ctx, key)
+	if err != nil {
+		diagnostics = append(diagnostics, fmt.Sprintf("error reading response cache: %s", err))
+	} else if cached != nil {
+		cached.TokensInput, cached.TokensOutput = 0, 0
+		cached.Timings = Timings{}
+		cached.Diagnostics = append(cached.Diagnostics, "served from response cache")
+		return cached, nil
+	}
+
+	resp, err := s.service.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cache.Set(ctx, key, resp, s.ttl); err != nil {
+		diagnostics = append(diagnostics, fmt.Sprintf("error writing response cache: %s", err))
+	}
+
+	resp.Diagnostics = append(resp.Diagnostics, diagnostics...)
+	return resp, nil
+}
@@ -0,0 +1,82 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// response cache for testing which stores copies of responses in memory
+type memoryCache struct {
+	entries map[string]ai.Response
+	err     error
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) (*ai.Response, error) {
+	if e, ok := c.entries[key]; ok {
+		return &e, c.err
+	}
+	return nil, c.err
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, resp *ai.Response, ttl time.Duration) error {
+	if c.err == nil {
+		c.entries[key] = *resp
+	}
+	return c.err
+}
+
+func TestCachingService(t *testing.T) {
+	ctx := context.Background()
+	llm := &fixedLLM{output: "yes"}
+	cache := &memoryCache{entries: map[string]ai.Response{}}
+	svc := ai.NewCachingService(llm, cache, "llm1", time.Hour)
+
+	req := &ai.Request{Instructions: "Categorize", Input: "YES", MaxTokens: 10}
+
+	resp, err := svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "yes", resp.Output)
+	assert.Equal(t, int64(10), resp.TokensInput)
+	assert.Nil(t, resp.Diagnostics)
+	assert.Len(t, cache.entries, 1)
+
+	// identical request is served from the cache without any token usage
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "yes", resp.Output)
+	assert.Equal(t, int64(0), resp.TokensInput)
+	assert.Equal(t, int64(0), resp.TokensOutput)
+	assert.Equal(t, []string{"served from response cache"}, resp.Diagnostics)
+	assert.Equal(t, 1, llm.calls)
+
+	// different max tokens is a different request
+	_, err = svc.Call(ctx, &ai.Request{Instructions: "Categorize", Input: "YES", MaxTokens: 20})
+	require.NoError(t, err)
+	assert.Equal(t, 2, llm.calls)
+
+	// as is the same request in a different scope
+	_, err = ai.NewCachingService(llm, cache, "llm2", time.Hour).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, 3, llm.calls)
+
+	// requests with tools aren't cached
+	withTools := &ai.Request{Instructions: "Categorize", Input: "YES", MaxTokens: 10, Tools: []*ai.Tool{{Name: "lookup"}}}
+	svc.Call(ctx, withTools)
+	svc.Call(ctx, withTools)
+	assert.Equal(t, 5, llm.calls)
+	assert.Len(t, cache.entries, 3)
+
+	// cache errors don't fail calls
+	svc = ai.NewCachingService(llm, &memoryCache{err: errors.New("boom")}, "llm1", time.Hour)
+
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "yes", resp.Output)
+	assert.Equal(t, []string{"error reading response cache: boom", "error writing response cache: boom"}, resp.Diagnostics)
+}
@@ -0,0 +1,61 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+)
+
+// Retriever retrieves the chunks of knowledge most relevant to some input, most relevant first
+type Retriever interface {
+	Retrieve(ctx context.Context, input string, limit int) ([]string, error)
+}
+
+// retrievalService is an LLM service which adds relevant knowledge to instructions before passing them to another service
+type retrievalService struct {
+	service          Service
+	retriever        Retriever
+	topK             int
+	maxContextTokens int
+}
+
+// NewRetrievalService wraps the given service so that the top K chunks of knowledge relevant to the input are added to
+// the instructions, limited to roughly the given number of tokens if that is non-zero.
+func NewRetrievalService(svc Service, r Retriever, topK, maxContextTokens int) Service {
+	return &retrievalService{service: svc, retriever: r, topK: topK, maxContextTokens: maxContextTokens}
+}
+
+func (s *retrievalService) Call(ctx context.Context, req *Request) (*Response, error) {
+	chunks, err := s.retriever.Retrieve(ctx, req.Input, s.topK)
+	if err != nil {
+		return nil, &ServiceError{Message: fmt.Sprintf("error retrieving knowledge: %s", err), Code: ErrorUnknown, Instructions: req.Instructions, Input: req.Input}
+	}
+
+	// keep the most relevant chunks that fit
+	if s.maxContextTokens > 0 {
+		tokens := 0
+		for i, c := range chunks {
+			tokens += EstimateTokens(c)
+			if tokens > s.maxContextTokens {
+				chunks = chunks[:i]
+				break
+			}
+		}
+	}
+	if len(chunks) == 0 {
+		return s.service.Call(ctx, req)
+	}
+
+	augmented := *req
+	augmented.Instructions = strings.TrimSpace(prompts.Render("knowledge_context", map[string]any{"Instructions": req.Instructions, "Chunks": chunks}))
+
+	resp, err := s.service.Call(ctx, &augmented)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Diagnostics = append(resp.Diagnostics, fmt.Sprintf("added %d chunks of knowledge", len(chunks)))
+	return resp, nil
+}
@@ -0,0 +1,62 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fixedRetriever struct {
+	chunks []string
+	err    error
+	limit  int
+}
+
+func (r *fixedRetriever) Retrieve(ctx context.Context, input string, limit int) ([]string, error) {
+	r.limit = limit
+	if len(r.chunks) > limit {
+		return r.chunks[:limit], r.err
+	}
+	return r.chunks, r.err
+}
+
+func TestRetrievalService(t *testing.T) {
+	ctx := context.Background()
+
+	llm := &fixedLLM{output: "We open at 9am"}
+	retriever := &fixedRetriever{chunks: []string{"The clinic opens at 9am.", "Parking is free.", "Bring your card."}}
+	svc := ai.NewRetrievalService(llm, retriever, 2, 0)
+
+	resp, err := svc.Call(ctx, &ai.Request{Instructions: "Answer the question.", Input: "When do you open?", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "We open at 9am", resp.Output)
+	assert.Equal(t, []string{"added 2 chunks of knowledge"}, resp.Diagnostics)
+	assert.Equal(t, 2, retriever.limit)
+	assert.Equal(t, "When do you open?", llm.last.Input)
+	assert.Equal(t, "Answer the question.\n\nThe following information is relevant to the input. Use it when responding, but don't mention that it was provided.\n\n<knowledge>\nThe clinic opens at 9am.\n</knowledge>\n<knowledge>\nParking is free.\n</knowledge>", llm.last.Instructions)
+
+	// context is limited to the chunks which fit
+	svc = ai.NewRetrievalService(llm, retriever, 3, 8)
+
+	_, err = svc.Call(ctx, &ai.Request{Instructions: "Answer the question.", Input: "When do you open?", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "Answer the question.\n\nThe following information is relevant to the input. Use it when responding, but don't mention that it was provided.\n\n<knowledge>\nThe clinic opens at 9am.\n</knowledge>", llm.last.Instructions)
+
+	// no relevant chunks means instructions are unchanged
+	svc = ai.NewRetrievalService(llm, &fixedRetriever{}, 3, 0)
+
+	resp, err = svc.Call(ctx, &ai.Request{Instructions: "Answer the question.", Input: "When do you open?", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Nil(t, resp.Diagnostics)
+	assert.Equal(t, "Answer the question.", llm.last.Instructions)
+
+	// retrieval errors are returned as service errors
+	svc = ai.NewRetrievalService(llm, &fixedRetriever{err: errors.New("boom")}, 3, 0)
+
+	_, err = svc.Call(ctx, &ai.Request{Instructions: "Answer the question.", Input: "When do you open?", MaxTokens: 100})
+	assert.EqualError(t, err, "error retrieving knowledge: boom")
+}
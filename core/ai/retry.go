@@ -0,0 +1,85 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy is how failed calls with transient errors are retried
+type RetryPolicy struct {
+	MaxAttempts    int           // including the first attempt
+	InitialBackoff time.Duration // doubled for each subsequent retry
+	MaxBackoff     time.Duration
+	Jitter         float64       // fraction of each backoff which is randomized
+	Deadline       time.Duration // for all attempts combined, zero meaning none
+}
+
+// DefaultRetryPolicy is the retry policy used unless an LLM configures otherwise
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: 10 * time.Second, Jitter: 0.5, Deadline: 30 * time.Second}
+
+// Backoff returns how long to wait before the given retry, i.e. 1 for the first retry, ignoring any wait requested
+// by the provider
+func (p *RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := min(p.InitialBackoff<<(retry-1), p.MaxBackoff)
+	if p.Jitter > 0 {
+		backoff = time.Duration(float64(backoff) * (1 - p.Jitter*rand.Float64()))
+	}
+	return backoff
+}
+
+// retryService is an LLM service which retries calls that fail with transient errors
+type retryService struct {
+	service Service
+	policy  RetryPolicy
+}
+
+// NewRetryService wraps the given service so that retryable requests which fail with transient errors, i.e. rate
+// limits and server errors, are retried according to the given policy. Waits between attempts honor any Retry-After
+// from the provider, but we give up rather than wait beyond the policy's deadline.
+func NewRetryService(svc Service, policy RetryPolicy) Service {
+	return &retryService{service: svc, policy: policy}
+}
+
+func (s *retryService) Call(ctx context.Context, req *Request) (*Response, error) {
+	if !req.Retryable() || s.policy.MaxAttempts <= 1 {
+		return s.service.Call(ctx, req)
+	}
+
+	if s.policy.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.policy.Deadline)
+		defer cancel()
+	}
+
+	var diagnostics []string
+
+	for attempt := 1; ; attempt++ {
+		resp, err := s.service.Call(ctx, req)
+		if err == nil {
+			resp.Diagnostics = append(diagnostics, resp.Diagnostics...)
+			return resp, nil
+		}
+		if attempt >= s.policy.MaxAttempts || !IsTransient(err) {
+			return nil, err
+		}
+
+		wait := s.policy.Backoff(attempt)
+		if serr, ok := errors.AsType[*ServiceError](err); ok && serr.RetryAfter > 0 {
+			wait = serr.RetryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return nil, err
+		}
+
+		diagnostics = append(diagnostics, fmt.Sprintf("attempt %d failed: %s", attempt, err))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// LLM service for testing which fails with each of a sequence of errors before succeeding
+type flakyLLM struct {
+	errs  []error
+	calls int
+}
+
+func (s *flakyLLM) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return nil, err
+	}
+	return &ai.Response{Output: "Hola", TokensInput: 10, TokensOutput: 1}, nil
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := ai.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 2*time.Second, policy.Backoff(2))
+	assert.Equal(t, 3*time.Second, policy.Backoff(3))
+
+	policy.Jitter = 0.5
+	for range 10 {
+		b := policy.Backoff(2)
+		assert.GreaterOrEqual(t, b, time.Second)
+		assert.LessOrEqual(t, b, 2*time.Second)
+	}
+}
+
+func TestRetryService(t *testing.T) {
+	ctx := context.Background()
+	policy := ai.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Deadline: time.Second}
+	req := &ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100, Idempotent: true}
+
+	rateLimited := &ai.ServiceError{Message: "429 Too Many Requests", Code: ai.ErrorRateLimit, StatusCode: 429, RetryAfter: 10 * time.Millisecond}
+	unavailable := &ai.ServiceError{Message: "503 Service Unavailable", Code: ai.ErrorUnknown, StatusCode: 503}
+	unauthorized := &ai.ServiceError{Message: "401 Unauthorized", Code: ai.ErrorCredentials, StatusCode: 401}
+
+	// transient errors are retried, waiting as long as the provider asks
+	llm := &flakyLLM{errs: []error{rateLimited, unavailable}}
+	start := time.Now()
+	resp, err := ai.NewRetryService(llm, policy).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Equal(t, []string{"attempt 1 failed: 429 Too Many Requests", "attempt 2 failed: 503 Service Unavailable"}, resp.Diagnostics)
+	assert.Equal(t, 3, llm.calls)
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+
+	// until we run out of attempts
+	llm = &flakyLLM{errs: []error{unavailable, unavailable, unavailable}}
+	_, err = ai.NewRetryService(llm, policy).Call(ctx, req)
+	assert.Equal(t, unavailable, err)
+	assert.Equal(t, 3, llm.calls)
+
+	// other errors aren't retried
+	llm = &flakyLLM{errs: []error{unauthorized}}
+	_, err = ai.NewRetryService(llm, policy).Call(ctx, req)
+	assert.Equal(t, unauthorized, err)
+	assert.Equal(t, 1, llm.calls)
+
+	// nor are requests which aren't retryable
+	llm = &flakyLLM{errs: []error{unavailable}}
+	_, err = ai.NewRetryService(llm, policy).Call(ctx, &ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100})
+	assert.Equal(t, unavailable, err)
+	assert.Equal(t, 1, llm.calls)
+
+	// and we don't wait beyond the deadline
+	llm = &flakyLLM{errs: []error{&ai.ServiceError{Message: "429 Too Many Requests", Code: ai.ErrorRateLimit, StatusCode: 429, RetryAfter: time.Minute}}}
+	start = time.Now()
+	_, err = ai.NewRetryService(llm, policy).Call(ctx, req)
+	assert.EqualError(t, err, "429 Too Many Requests")
+	assert.Equal(t, 1, llm.calls)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
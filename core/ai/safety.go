@@ -0,0 +1,9 @@
+package ai
+
+// safety severities which provider safety ratings are normalized to
+const (
+	SafetyNegligible = "negligible"
+	SafetyLow        = "low"
+	SafetyMedium     = "medium"
+	SafetyHigh       = "high"
+)
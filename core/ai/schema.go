@@ -0,0 +1,113 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ValidateSchema validates the given decoded JSON value against a JSON schema. Only the subset of JSON schema that
+// providers support for structured output is checked, i.e. type, enum, properties, required, additionalProperties and
+// items, and other keywords are ignored.
+func ValidateSchema(v any, schema map[string]any) error {
+	return validateSchema(v, schema, "$")
+}
+
+func validateSchema(v any, schema map[string]any, path string) error {
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return isSchemaType(v, t) }) {
+		return fmt.Errorf("%s: expected %s", path, strings.Join(types, " or "))
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		if !slices.ContainsFunc(enum, func(e any) bool { return jsonEqual(e, v) }) {
+			return fmt.Errorf("%s: value is not one of the allowed values", path)
+		}
+	}
+
+	switch typed := v.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+
+		if required, ok := schema["required"].([]any); ok {
+			for _, r := range required {
+				if name, _ := r.(string); name != "" {
+					if _, ok := typed[name]; !ok {
+						return fmt.Errorf("%s: missing required property '%s'", path, name)
+					}
+				}
+			}
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(typed)) {
+			if propSchema, ok := props[name].(map[string]any); ok {
+				if err := validateSchema(typed[name], propSchema, path+"."+name); err != nil {
+					return err
+				}
+			} else if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				return fmt.Errorf("%s: unexpected property '%s'", path, name)
+			}
+		}
+
+	case []any:
+		if itemSchema, ok := schema["items"].(map[string]any); ok {
+			for i, item := range typed {
+				if err := validateSchema(item, itemSchema, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// gets the types allowed by a schema's type keyword, which can be a single type or a list of types
+func schemaTypes(t any) []string {
+	switch typed := t.(type) {
+	case string:
+		return []string{typed}
+	case []any:
+		types := make([]string, 0, len(typed))
+		for _, e := range typed {
+			if s, ok := e.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func isSchemaType(v any, t string) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == float64(int64(f))
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return true // unknown types aren't enforced
+}
+
+func jsonEqual(a, b any) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
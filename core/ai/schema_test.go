@@ -0,0 +1,53 @@
+package ai_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSchema(t *testing.T) {
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name":  map[string]any{"type": "string"},
+			"age":   map[string]any{"type": "integer"},
+			"mood":  map[string]any{"type": "string", "enum": []any{"happy", "sad"}},
+			"tags":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"notes": map[string]any{"type": []any{"string", "null"}},
+		},
+		"required":             []any{"name", "age"},
+		"additionalProperties": false,
+	}
+
+	tcs := []struct {
+		json string
+		err  string
+	}{
+		{`{"name": "Bob", "age": 34}`, ""},
+		{`{"name": "Bob", "age": 34, "mood": "happy", "tags": ["a", "b"], "notes": null}`, ""},
+		{`{"name": "Bob", "age": 34, "notes": "likes cats"}`, ""},
+		{`[]`, "$: expected object"},
+		{`{"name": "Bob"}`, "$: missing required property 'age'"},
+		{`{"name": "Bob", "age": 34.5}`, "$.age: expected integer"},
+		{`{"name": "Bob", "age": "34"}`, "$.age: expected integer"},
+		{`{"name": "Bob", "age": 34, "mood": "angry"}`, "$.mood: value is not one of the allowed values"},
+		{`{"name": "Bob", "age": 34, "tags": ["a", 2]}`, "$.tags[1]: expected string"},
+		{`{"name": "Bob", "age": 34, "notes": 5}`, "$.notes: expected string or null"},
+		{`{"name": "Bob", "age": 34, "height": 180}`, "$: unexpected property 'height'"},
+	}
+
+	for _, tc := range tcs {
+		var v any
+		json.Unmarshal([]byte(tc.json), &v)
+
+		err := ai.ValidateSchema(v, schema)
+		if tc.err == "" {
+			assert.NoError(t, err, "unexpected error for %s", tc.json)
+		} else {
+			assert.EqualError(t, err, tc.err, "error mismatch for %s", tc.json)
+		}
+	}
+}
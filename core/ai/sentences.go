@@ -0,0 +1,140 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// lowercased abbreviations which end with a period that doesn't end a sentence
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true, "st": true, "mt": true,
+	"vs": true, "etc": true, "e.g": true, "i.e": true, "approx": true, "no": true, "inc": true, "ltd": true, "co": true,
+	"jan": true, "feb": true, "mar": true, "apr": true, "jun": true, "jul": true, "aug": true, "sep": true, "sept": true,
+	"oct": true, "nov": true, "dec": true, "sra": true, "srta": true, "mme": true, "mlle": true,
+}
+
+// runes which end sentences, some of which (e.g. CJK) don't need to be followed by a space
+var sentenceTerminators = map[rune]bool{'.': true, '!': true, '?': true, '…': true, '。': true, '！': true, '？': true, '؟': true, '।': true, '۔': true}
+var spacelessTerminators = map[rune]bool{'。': true, '！': true, '？': true}
+
+// runes which can follow a terminator but still belong to the sentence
+var sentenceClosers = map[rune]bool{'"': true, '\'': true, ')': true, ']': true, '”': true, '’': true, '»': true, '」': true, '』': true}
+
+// SplitSentences splits the given text into sentences, taking care not to split on common abbreviations, initials or
+// decimal numbers. Sentences include their terminating punctuation but not surrounding whitespace.
+func SplitSentences(s string) []string {
+	var sentences []string
+	start := 0
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !sentenceTerminators[r] {
+			i += size
+			continue
+		}
+
+		// consume any run of terminators and closing punctuation
+		end := i + size
+		for end < len(s) {
+			nr, nsize := utf8.DecodeRuneInString(s[end:])
+			if !sentenceTerminators[nr] && !sentenceClosers[nr] {
+				break
+			}
+			end += nsize
+		}
+
+		if isSentenceEnd(s, start, i, end, r) {
+			if sentence := strings.TrimSpace(s[start:end]); sentence != "" {
+				sentences = append(sentences, sentence)
+			}
+			start = end
+		}
+		i = end
+	}
+
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		sentences = append(sentences, rest)
+	}
+	return sentences
+}
+
+// determines whether the terminator r at position i, whose punctuation runs until end, ends the sentence which began
+// at start
+func isSentenceEnd(s string, start, i, end int, r rune) bool {
+	if end == len(s) || spacelessTerminators[r] {
+		return true
+	}
+
+	next, _ := utf8.DecodeRuneInString(s[end:])
+	if !unicode.IsSpace(next) {
+		return false // e.g. 3.5 or example.com
+	}
+
+	if r == '.' && end == i+1 {
+		word := lastWord(s[start:i])
+		if abbreviations[strings.ToLower(word)] {
+			return false
+		}
+		if utf8.RuneCountInString(word) == 1 && unicode.IsUpper([]rune(word)[0]) {
+			return false // an initial like J. Smith
+		}
+
+		// a period followed by a lowercase word probably isn't the end of a sentence
+		if following := strings.TrimLeftFunc(s[end:], unicode.IsSpace); following != "" {
+			if fr, _ := utf8.DecodeRuneInString(following); unicode.IsLower(fr) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// gets the last word of the given text, which may include internal periods like e.g
+func lastWord(s string) string {
+	if idx := strings.LastIndexFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == '(' || r == '"' }); idx >= 0 {
+		_, size := utf8.DecodeRuneInString(s[idx:])
+		return s[idx+size:]
+	}
+	return s
+}
+
+// TrimSentences trims the given text to its first n sentences, returning whether it was trimmed
+func TrimSentences(s string, n int) (string, bool) {
+	sentences := SplitSentences(s)
+	if len(sentences) <= n {
+		return s, false
+	}
+
+	// take the original text up to the end of the nth sentence so that whitespace between sentences is preserved
+	end := 0
+	for _, sentence := range sentences[:n] {
+		end = strings.Index(s[end:], sentence) + end + len(sentence)
+	}
+	return s[:end], true
+}
+
+// sentenceLimitService is an LLM service which trims output to a maximum number of sentences
+type sentenceLimitService struct {
+	service Service
+	max     int
+}
+
+// NewSentenceLimitService wraps the given service so that output is trimmed to the given maximum number of sentences
+func NewSentenceLimitService(svc Service, max int) Service {
+	return &sentenceLimitService{service: svc, max: max}
+}
+
+func (s *sentenceLimitService) Call(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := s.service.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if trimmed, ok := TrimSentences(resp.Output, s.max); ok {
+		resp.Output = trimmed
+		resp.Trimmed = true
+	}
+	return resp, nil
+}
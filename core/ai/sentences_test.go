@@ -0,0 +1,70 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSentences(t *testing.T) {
+	tcs := []struct {
+		text      string
+		sentences []string
+	}{
+		{"", nil},
+		{"Hello", []string{"Hello"}},
+		{"Hello there. How are you?", []string{"Hello there.", "How are you?"}},
+		{"Wait... what?! Really.", []string{"Wait...", "what?!", "Really."}},
+		{"Dr. Smith arrives at 3.30 p.m. tomorrow. Be ready.", []string{"Dr. Smith arrives at 3.30 p.m. tomorrow.", "Be ready."}},
+		{"Bring fruit, e.g. apples. Also water.", []string{"Bring fruit, e.g. apples.", "Also water."}},
+		{"J. R. R. Tolkien wrote it. Read it.", []string{"J. R. R. Tolkien wrote it.", "Read it."}},
+		{"Visit example.com today. Thanks!", []string{"Visit example.com today.", "Thanks!"}},
+		{`He said "Stop." Then he left.`, []string{`He said "Stop."`, "Then he left."}},
+		{"今日は晴れです。明日は雨です。", []string{"今日は晴れです。", "明日は雨です。"}},
+		{"هل أنت بخير؟ نعم.", []string{"هل أنت بخير؟", "نعم."}},
+		{"  Extra   space.   Here.  ", []string{"Extra   space.", "Here."}},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.sentences, ai.SplitSentences(tc.text), "sentences mismatch for %q", tc.text)
+	}
+}
+
+func TestTrimSentences(t *testing.T) {
+	trimmed, ok := ai.TrimSentences("One. Two!\nThree? Four.", 2)
+	assert.True(t, ok)
+	assert.Equal(t, "One. Two!", trimmed)
+
+	trimmed, ok = ai.TrimSentences("One. Two!\nThree? Four.", 3)
+	assert.True(t, ok)
+	assert.Equal(t, "One. Two!\nThree?", trimmed)
+
+	trimmed, ok = ai.TrimSentences("One. Two!", 2)
+	assert.False(t, ok)
+	assert.Equal(t, "One. Two!", trimmed)
+
+	trimmed, ok = ai.TrimSentences("今日は晴れです。明日は雨です。", 1)
+	assert.True(t, ok)
+	assert.Equal(t, "今日は晴れです。", trimmed)
+}
+
+func TestSentenceLimitService(t *testing.T) {
+	ctx := context.Background()
+	req := &ai.Request{Instructions: "Reply", Input: "Hi", MaxTokens: 100}
+
+	llm := &fixedLLM{output: "Hello! Mr. Smith will see you now. Please wait. Thanks."}
+	resp, err := ai.NewSentenceLimitService(llm, 2).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello! Mr. Smith will see you now.", resp.Output)
+	assert.True(t, resp.Trimmed)
+
+	// no trimming needed
+	llm = &fixedLLM{output: "Hello! Mr. Smith will see you now."}
+	resp, err = ai.NewSentenceLimitService(llm, 2).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello! Mr. Smith will see you now.", resp.Output)
+	assert.False(t, resp.Trimmed)
+}
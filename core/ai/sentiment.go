@@ -0,0 +1,49 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+)
+
+// maximum number of output tokens of the scores of each message
+const maxSentimentTokensPerMsg = 20
+
+// Sentiment is the sentiment and urgency of a message as scored by an LLM
+type Sentiment struct {
+	Score   float64 `json:"sentiment"` // from -1 (very negative) to 1 (very positive)
+	Urgency float64 `json:"urgency"`   // from 0 (not urgent) to 1 (needs help immediately)
+}
+
+// ScoreSentiments uses the given service to score the sentiment and urgency of the given messages in a single call,
+// returning scores in the same order as the messages. The response is returned so that callers can record usage.
+func ScoreSentiments(ctx context.Context, svc flows.LLMService, texts []string) ([]*Sentiment, *flows.LLMResponse, error) {
+	input, err := json.Marshal(texts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error marshaling messages: %w", err)
+	}
+
+	resp, err := svc.Response(ctx, prompts.Render("score_sentiment", nil), string(input), 10+len(texts)*maxSentimentTokensPerMsg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output, _ := ExtractJSON(resp.Output)
+
+	var scores []*Sentiment
+	if err := json.Unmarshal([]byte(output), &scores); err != nil {
+		return nil, resp, fmt.Errorf("error parsing sentiment scores: %w", err)
+	}
+	if len(scores) != len(texts) {
+		return nil, resp, fmt.Errorf("expected %d sentiment scores, got %d", len(texts), len(scores))
+	}
+
+	for _, s := range scores {
+		s.Score = max(-1, min(1, s.Score))
+		s.Urgency = max(0, min(1, s.Urgency))
+	}
+	return scores, resp, nil
+}
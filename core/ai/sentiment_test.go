@@ -0,0 +1,41 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreSentiments(t *testing.T) {
+	ctx := context.Background()
+
+	llm := &fixedLLM{output: `[{"sentiment": -0.5, "urgency": 0.9}, {"sentiment": 2, "urgency": -1}]`}
+
+	scores, resp, err := ai.ScoreSentiments(ctx, ai.NewLLMService(llm), []string{"Help, my baby is sick!", "Thanks so much"})
+	require.NoError(t, err)
+	assert.Equal(t, []*ai.Sentiment{{Score: -0.5, Urgency: 0.9}, {Score: 1, Urgency: 0}}, scores) // out of range scores are clamped
+	assert.Equal(t, int64(10), resp.TokensInput)
+	assert.Equal(t, `["Help, my baby is sick!","Thanks so much"]`, llm.last.Input)
+	assert.Equal(t, 50, llm.last.MaxTokens)
+
+	// output with the wrong number of scores
+	llm = &fixedLLM{output: `[{"sentiment": -0.5, "urgency": 0.9}]`}
+
+	_, resp, err = ai.ScoreSentiments(ctx, ai.NewLLMService(llm), []string{"Help, my baby is sick!", "Thanks so much"})
+	assert.EqualError(t, err, "expected 2 sentiment scores, got 1")
+	assert.NotNil(t, resp)
+
+	// output which isn't JSON
+	llm = &fixedLLM{output: `They're both quite emotional`}
+
+	_, _, err = ai.ScoreSentiments(ctx, ai.NewLLMService(llm), []string{"Help, my baby is sick!", "Thanks so much"})
+	assert.ErrorContains(t, err, "error parsing sentiment scores")
+
+	// errors from the service
+	_, resp, err = ai.ScoreSentiments(ctx, ai.NewLLMService(&failingLLM{}), []string{"Help"})
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+}
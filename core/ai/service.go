@@ -0,0 +1,269 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+)
+
+// Request is a request to an LLM service
+type Request struct {
+	Instructions string
+	Input        string
+	MaxTokens    int
+	Debug        bool    // whether the response should include debugging information such as applied params
+	Tools        []*Tool // tools which the LLM can call, if the service supports them
+	History      []*Turn // earlier turns of the conversation that this request continues, oldest first
+
+	// Schema is a JSON schema which output must conform to, which services enforce if they support it
+	Schema map[string]any
+
+	// Attachments are passed to the LLM with the input, though only images are supported and only by some services
+	Attachments []utils.Attachment
+
+	Idempotent     bool   // whether the call is safe to retry, which is the case for plain completions
+	IdempotencyKey string // key sent to the provider so that a call which isn't idempotent can still be retried safely
+}
+
+// Retryable returns whether failed attempts of this request can be retried
+func (r *Request) Retryable() bool {
+	return r.Idempotent || r.IdempotencyKey != ""
+}
+
+// Images returns the URLs of the image attachments of this request
+func (r *Request) Images() []string {
+	var urls []string
+	for _, a := range r.Attachments {
+		if strings.HasPrefix(a.ContentType(), "image/") {
+			urls = append(urls, a.URL())
+		}
+	}
+	return urls
+}
+
+// Response is a response from an LLM service, which includes more detail than the flow engine needs
+type Response struct {
+	Output       string
+	TokensInput  int64
+	TokensOutput int64
+	Timings      Timings
+	Cleaned      bool     // whether output was cleaned up, e.g. by extracting JSON from surrounding text
+	Trimmed      bool     // whether output was trimmed, e.g. to a maximum number of sentences
+	Moderated    bool     // whether output was replaced because moderation flagged it
+	Degraded     bool     // whether output is a fallback response because the call couldn't be made
+	DegradedCode string   // error code of the failed call if output is a fallback response
+	Diagnostics  []string // notes on how the request was handled, e.g. models skipped or failed before it succeeded
+	RequestHash  string   // fingerprint of the effective request sent to the provider
+	Model        string   // the model which handled the request, if it was routed between models
+
+	// TokensReasoning is the number of hidden reasoning tokens used by reasoning models, which are included in
+	// TokensOutput so that they're counted against budgets like any other output tokens
+	TokensReasoning int64
+
+	// ToolCalls are the calls the LLM wants made to the request's tools, in which case output may be empty
+	ToolCalls []*ToolCall
+
+	// QuickReplies are short replies suggested alongside the output which the contact could send back
+	QuickReplies []string
+
+	CachedTokens int    // number of input tokens read from the provider's prompt cache
+	CacheStatus  string // hit, miss or partial if the provider reports prompt cache usage
+
+	// SafetyRatings are any safety ratings from the provider, as category to normalized severity
+	SafetyRatings map[string]string
+
+	// AppliedParams are the effective params sent to the provider after all merging and clamping, if requested
+	AppliedParams map[string]any
+}
+
+// LLMResponse converts this response to a response for the flow engine
+func (r *Response) LLMResponse() *flows.LLMResponse {
+	return &flows.LLMResponse{Output: r.Output, TokensInput: r.TokensInput, TokensOutput: r.TokensOutput}
+}
+
+// Service is an LLM service which returns extended responses
+type Service interface {
+	Call(ctx context.Context, req *Request) (*Response, error)
+}
+
+// HealthCheckedService is an LLM service which can check that its provider is reachable, e.g. a self-hosted model
+type HealthCheckedService interface {
+	Health(ctx context.Context) error
+}
+
+// Guard decides whether requests which aren't calls, e.g. streams or embeddings, can be sent directly to the provider of
+// an LLM service, since they go around the behavior configured on its calls such as redaction, budgets and breakers
+type Guard interface {
+	Allow(ctx context.Context) error                   // returns an error if requests can't be sent to the provider
+	Done(ctx context.Context, usage *Usage, err error) // records the outcome and token usage of a request which was allowed
+}
+
+// LLMService adapts a service so that it can also be used by the flow engine
+type LLMService struct {
+	Service
+
+	provider Service // used directly for everything other than calls, e.g. capabilities or embeddings
+	guard    Guard   // if set, checks requests sent directly to the provider
+}
+
+// NewLLMService creates a new LLM service for the flow engine from the given service
+func NewLLMService(s Service) *LLMService {
+	return &LLMService{Service: s, provider: s}
+}
+
+// NewWrappedLLMService creates a new LLM service for the flow engine which makes calls with the given wrapped service
+// but uses the provider service that it wraps for everything else, since wrappers only support calls
+func NewWrappedLLMService(wrapped, provider Service) *LLMService {
+	return &LLMService{Service: wrapped, provider: provider}
+}
+
+// WithGuard sets the guard which requests sent directly to the provider must pass
+func (s *LLMService) WithGuard(g Guard) *LLMService {
+	s.guard = g
+	return s
+}
+
+// sends a request directly to the provider with the given function if the guard allows it
+func (s *LLMService) passthrough(ctx context.Context, fn func() error) error {
+	return s.passthroughUsage(ctx, func() (*Usage, error) { return nil, fn() })
+}
+
+// sends a request directly to the provider with the given function, which returns the tokens used by the request, if
+// the guard allows it
+func (s *LLMService) passthroughUsage(ctx context.Context, fn func() (*Usage, error)) error {
+	if s.guard != nil {
+		if err := s.guard.Allow(ctx); err != nil {
+			return err
+		}
+	}
+
+	usage, err := fn()
+
+	if s.guard != nil {
+		s.guard.Done(ctx, usage, err)
+	}
+	return err
+}
+
+func (s *LLMService) Response(ctx context.Context, instructions, input string, maxTokens int) (*flows.LLMResponse, error) {
+	resp, err := s.Call(ctx, &Request{Instructions: instructions, Input: input, MaxTokens: maxTokens, Idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	return resp.LLMResponse(), nil
+}
+
+// ResponseJSON makes a request whose output must be JSON which conforms to the given schema. Services which support
+// schemas have the provider enforce it, and in all cases output is validated against it, with a single attempt to
+// repair output which isn't valid.
+func (s *LLMService) ResponseJSON(ctx context.Context, instructions, input string, schema map[string]any, maxTokens int) (*flows.LLMResponse, error) {
+	req := &Request{Instructions: instructions, Input: input, MaxTokens: maxTokens, Schema: schema, Idempotent: true}
+
+	resp, err := NewJSONService(s.Service, nil, true).Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.LLMResponse(), nil
+}
+
+// Capabilities returns the capabilities of the underlying service, if it reports them
+func (s *LLMService) Capabilities() ServiceCapabilities {
+	if c, ok := s.provider.(CapableService); ok {
+		return c.Capabilities()
+	}
+	return ServiceCapabilities{}
+}
+
+// Stream makes a streaming request to the underlying service, if it supports streaming
+func (s *LLMService) Stream(ctx context.Context, req *Request) (*Stream, error) {
+	if ss, ok := s.provider.(StreamingService); ok {
+		if s.guard == nil {
+			return ss.Stream(ctx, req)
+		}
+
+		if err := s.guard.Allow(ctx); err != nil {
+			return nil, err
+		}
+
+		stream, err := ss.Stream(ctx, req)
+		if err != nil {
+			s.guard.Done(ctx, nil, err)
+			return nil, err
+		}
+
+		// the guard is done with the stream when it's closed, when we know what it used
+		stream.onClose = func() {
+			resp := stream.Response()
+			usage := &Usage{TokensInput: resp.TokensInput, TokensOutput: resp.TokensOutput}
+			if usage.TokensInput == 0 && usage.TokensOutput == 0 {
+				usage = &Usage{TokensInput: int64(EstimateTokens(req.Instructions + req.Input)), TokensOutput: int64(EstimateTokens(resp.Output))}
+			}
+
+			// errors from after the consumer stopped reading are from us closing the stream
+			var err error
+			if stream.finished {
+				err = stream.Err()
+			}
+			s.guard.Done(ctx, usage, err)
+		}
+		return stream, nil
+	}
+	return nil, errors.New("LLM service doesn't support streaming")
+}
+
+// Health checks the underlying service, if it supports health checks, and otherwise assumes it's healthy
+func (s *LLMService) Health(ctx context.Context) error {
+	if hs, ok := s.provider.(HealthCheckedService); ok {
+		return hs.Health(ctx)
+	}
+	return nil
+}
+
+// AsService returns the given flow engine LLM service as a service, adapting it if it doesn't already support extended
+// responses, e.g. the test service provided by goflow.
+func AsService(svc flows.LLMService) Service {
+	if s, ok := svc.(Service); ok {
+		return s
+	}
+	return &basicService{svc: svc}
+}
+
+type basicService struct {
+	svc flows.LLMService
+}
+
+func (s *basicService) Call(ctx context.Context, req *Request) (*Response, error) {
+	timer := NewTimer()
+
+	resp, err := s.svc.Response(ctx, req.Instructions, req.Input, req.MaxTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{Output: resp.Output, TokensInput: resp.TokensInput, TokensOutput: resp.TokensOutput, Timings: timer.Timings()}, nil
+}
+
+// debugService is an LLM service which requests debugging information in responses
+type debugService struct {
+	service Service
+}
+
+// NewDebugService wraps the given service so that all requests ask for debugging information in responses
+func NewDebugService(svc Service) Service {
+	return &debugService{service: svc}
+}
+
+func (s *debugService) Call(ctx context.Context, req *Request) (*Response, error) {
+	debug := *req
+	debug.Debug = true
+
+	return s.service.Call(ctx, &debug)
+}
+
+var _ flows.LLMService = (*LLMService)(nil)
+var _ Service = (*LLMService)(nil)
+var _ CapableService = (*LLMService)(nil)
+var _ StreamingService = (*LLMService)(nil)
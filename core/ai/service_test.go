@@ -0,0 +1,159 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/test/services"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLLMService(t *testing.T) {
+	ctx := context.Background()
+
+	svc := ai.NewLLMService(&fixedLLM{output: "Hola"})
+
+	// can be used by the engine
+	var llmSvc flows.LLMService = svc
+	resp, err := llmSvc.Response(ctx, "translate to Spanish", "Hello", 100)
+	require.NoError(t, err)
+	assert.Equal(t, &flows.LLMResponse{Output: "Hola", TokensInput: 10, TokensOutput: 1}, resp)
+
+	// plain completions from the engine are idempotent
+	assert.True(t, svc.Service.(*fixedLLM).last.Idempotent)
+
+	// and still provides extended responses
+	assert.Equal(t, svc, ai.AsService(llmSvc))
+}
+
+func TestLLMServiceResponseJSON(t *testing.T) {
+	ctx := context.Background()
+	schema := map[string]any{"type": "object", "required": []any{"age"}}
+
+	llm := &sequenceLLM{outputs: []string{"Sure! ```json\n{\"age\": 34}\n```"}}
+	resp, err := ai.NewLLMService(llm).ResponseJSON(ctx, "Extract age", "Bob is 34", schema, 100)
+	require.NoError(t, err)
+	assert.Equal(t, &flows.LLMResponse{Output: `{"age": 34}`, TokensInput: 10, TokensOutput: 5}, resp)
+	assert.Equal(t, schema, llm.requests[0].Schema)
+	assert.True(t, llm.requests[0].Idempotent)
+
+	// output which doesn't conform gets a single repair attempt
+	llm = &sequenceLLM{outputs: []string{`{"name": "Bob"}`, `{"name": "Bob"}`}}
+	_, err = ai.NewLLMService(llm).ResponseJSON(ctx, "Extract age", "Bob is 34", schema, 100)
+	assert.EqualError(t, err, "output is not valid JSON: doesn't match schema: $: missing required property 'age'")
+	assert.Len(t, llm.requests, 2)
+}
+
+func TestAsService(t *testing.T) {
+	ctx := context.Background()
+
+	dates.SetNowFunc(dates.NewSequentialNow(time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC), time.Second))
+	defer dates.SetNowFunc(time.Now)
+
+	// services which only support the engine interface are adapted
+	svc := ai.AsService(services.NewLLM())
+
+	resp, err := svc.Call(ctx, &ai.Request{Instructions: "Categorize... [Yes, No]", Input: "yeah", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, &ai.Response{Output: "No", TokensInput: 45, TokensOutput: 78, Timings: ai.Timings{Total: time.Second}}, resp)
+
+	_, err = svc.Call(ctx, &ai.Request{Instructions: "Answer", Input: "\\error boom", MaxTokens: 100})
+	assert.EqualError(t, err, "boom")
+}
+
+func TestDebugService(t *testing.T) {
+	ctx := context.Background()
+
+	llm := &fixedLLM{output: "Hola"}
+	svc := ai.NewDebugService(llm)
+
+	req := &ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100}
+	_, err := svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.True(t, llm.last.Debug)
+	assert.False(t, req.Debug) // original request is unchanged
+}
+
+func TestRequestRetryable(t *testing.T) {
+	assert.True(t, (&ai.Request{Idempotent: true}).Retryable())
+	assert.False(t, (&ai.Request{}).Retryable())
+	assert.True(t, (&ai.Request{IdempotencyKey: "a1b2c3"}).Retryable())
+}
+
+func TestRequestImages(t *testing.T) {
+	req := &ai.Request{Attachments: []utils.Attachment{"image/jpeg:https://example.com/cat.jpg", "audio/mp4:https://example.com/meow.m4a", "image/png:https://example.com/dog.png"}}
+	assert.Equal(t, []string{"https://example.com/cat.jpg", "https://example.com/dog.png"}, req.Images())
+	assert.Nil(t, (&ai.Request{}).Images())
+}
+
+// guard for testing which refuses requests while closed and records outcomes
+type testGuard struct {
+	closed bool
+	done   []error
+	usage  []*ai.Usage
+}
+
+func (g *testGuard) Allow(ctx context.Context) error {
+	if g.closed {
+		return errors.New("not allowed")
+	}
+	return nil
+}
+
+func (g *testGuard) Done(ctx context.Context, usage *ai.Usage, err error) {
+	g.done = append(g.done, err)
+	g.usage = append(g.usage, usage)
+}
+
+// LLM service for testing which also supports streaming
+type streamingLLM struct {
+	fixedLLM
+	events []ai.StreamEvent
+}
+
+func (s *streamingLLM) Stream(ctx context.Context, req *ai.Request) (*ai.Stream, error) {
+	src := newTestSource(s.events...)
+	close(src.events)
+	return ai.NewStream(src, ai.NewTimer(), nil), nil
+}
+
+func TestStreamGuarded(t *testing.T) {
+	ctx := context.Background()
+	req := &ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100}
+	provider := &streamingLLM{events: []ai.StreamEvent{{Delta: "Hola"}, {Delta: " mundo"}, {Usage: &ai.Usage{TokensInput: 12, TokensOutput: 3}}}}
+	guard := &testGuard{}
+	svc := ai.NewLLMService(provider).WithGuard(guard)
+
+	// guard is only done with a stream once it has been read and closed, when it gets the usage reported
+	stream, err := svc.Stream(ctx, req)
+	require.NoError(t, err)
+	for stream.Next() {
+	}
+	assert.Len(t, guard.done, 0)
+
+	require.NoError(t, stream.Close())
+	assert.Equal(t, []error{nil}, guard.done)
+	assert.Equal(t, []*ai.Usage{{TokensInput: 12, TokensOutput: 3}}, guard.usage)
+
+	// if the provider doesn't report usage, it's estimated
+	provider.events = []ai.StreamEvent{{Delta: "Hola"}, {Delta: " mundo"}}
+	stream, err = svc.Stream(ctx, req)
+	require.NoError(t, err)
+	for stream.Next() {
+	}
+	require.NoError(t, stream.Close())
+	assert.Equal(t, &ai.Usage{TokensInput: int64(ai.EstimateTokens("translate to SpanishHello")), TokensOutput: int64(ai.EstimateTokens("Hola mundo"))}, guard.usage[1])
+
+	guard.closed = true
+
+	_, err = svc.Stream(ctx, req)
+	assert.EqualError(t, err, "not allowed")
+	assert.Len(t, guard.done, 2)
+}
@@ -0,0 +1,61 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+)
+
+// maximum number of output tokens of the scores of a message
+const maxSpamTokens = 30
+
+// SpamScore is how likely an unsolicited message is to be spam or abuse, each from 0 to 1
+type SpamScore struct {
+	Spam  float64 `json:"spam"`
+	Abuse float64 `json:"abuse"`
+}
+
+// Max returns the greater of the spam and abuse scores
+func (s *SpamScore) Max() float64 { return max(s.Spam, s.Abuse) }
+
+// ScoreSpam uses the given service to score how likely the given unsolicited message is to be spam or abuse. The
+// response is returned so that callers can record usage.
+func ScoreSpam(ctx context.Context, svc flows.LLMService, text string) (*SpamScore, *flows.LLMResponse, error) {
+	resp, err := svc.Response(ctx, prompts.Render("score_spam", nil), text, maxSpamTokens)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output, _ := ExtractJSON(resp.Output)
+
+	score := &SpamScore{}
+	if err := json.Unmarshal([]byte(output), score); err != nil {
+		return nil, resp, fmt.Errorf("error parsing spam scores: %w", err)
+	}
+
+	score.Spam = max(0, min(1, score.Spam))
+	score.Abuse = max(0, min(1, score.Abuse))
+	return score, resp, nil
+}
+
+// ModerateSpam uses the moderation endpoint of the given service's provider to screen the given unsolicited message,
+// which is cheaper than scoring it with a model but only catches abuse, which is scored as 1 if flagged
+func ModerateSpam(ctx context.Context, svc flows.LLMService, text string) (*SpamScore, error) {
+	m, ok := svc.(Moderator)
+	if !ok {
+		return nil, errors.New("LLM service doesn't support moderation")
+	}
+
+	flagged, err := m.Moderate(ctx, text)
+	if err != nil {
+		return nil, fmt.Errorf("error moderating message: %w", err)
+	}
+	if flagged {
+		return &SpamScore{Abuse: 1}, nil
+	}
+	return &SpamScore{}, nil
+}
@@ -0,0 +1,69 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreSpam(t *testing.T) {
+	ctx := context.Background()
+
+	llm := &fixedLLM{output: "```json\n{\"spam\": 0.95, \"abuse\": 0.1}\n```"}
+
+	score, resp, err := ai.ScoreSpam(ctx, ai.NewLLMService(llm), "WIN A FREE PHONE!!! click bit.ly/xyz")
+	require.NoError(t, err)
+	assert.Equal(t, &ai.SpamScore{Spam: 0.95, Abuse: 0.1}, score)
+	assert.Equal(t, 0.95, score.Max())
+	assert.Equal(t, int64(10), resp.TokensInput)
+	assert.Equal(t, "WIN A FREE PHONE!!! click bit.ly/xyz", llm.last.Input)
+	assert.Equal(t, 30, llm.last.MaxTokens)
+
+	// out of range scores are clamped
+	llm = &fixedLLM{output: `{"spam": -1, "abuse": 3}`}
+
+	score, _, err = ai.ScoreSpam(ctx, ai.NewLLMService(llm), "...")
+	require.NoError(t, err)
+	assert.Equal(t, &ai.SpamScore{Spam: 0, Abuse: 1}, score)
+
+	// output which isn't JSON
+	llm = &fixedLLM{output: `Looks like spam to me`}
+
+	_, resp, err = ai.ScoreSpam(ctx, ai.NewLLMService(llm), "...")
+	assert.ErrorContains(t, err, "error parsing spam scores")
+	assert.NotNil(t, resp)
+
+	// errors from the service
+	_, resp, err = ai.ScoreSpam(ctx, ai.NewLLMService(&failingLLM{}), "...")
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+}
+
+// LLM service for testing which also moderates text with a fixed result
+type moderatingLLM struct {
+	fixedLLM
+	fixedModerator
+}
+
+func TestModerateSpam(t *testing.T) {
+	ctx := context.Background()
+
+	score, err := ai.ModerateSpam(ctx, ai.NewLLMService(&moderatingLLM{fixedModerator: fixedModerator{flagged: true}}), "You idiot")
+	require.NoError(t, err)
+	assert.Equal(t, &ai.SpamScore{Abuse: 1}, score)
+
+	score, err = ai.ModerateSpam(ctx, ai.NewLLMService(&moderatingLLM{}), "Where is my order?")
+	require.NoError(t, err)
+	assert.Equal(t, &ai.SpamScore{}, score)
+
+	_, err = ai.ModerateSpam(ctx, ai.NewLLMService(&moderatingLLM{fixedModerator: fixedModerator{err: errors.New("boom")}}), "You idiot")
+	assert.EqualError(t, err, "error moderating message: boom")
+
+	// services whose providers don't support moderation
+	_, err = ai.ModerateSpam(ctx, ai.NewLLMService(&fixedLLM{}), "You idiot")
+	assert.EqualError(t, err, "error moderating message: LLM service doesn't support moderation")
+}
@@ -0,0 +1,29 @@
+package ai
+
+import (
+	"context"
+	"errors"
+)
+
+// SpeechService is a service which can synthesize speech from text, e.g. for IVR prompts
+type SpeechService interface {
+	Synthesize(ctx context.Context, text, voice string) ([]byte, string, error)
+}
+
+// Synthesize synthesizes speech using the underlying service, if it supports speech, returning the audio and its
+// content type
+func (s *LLMService) Synthesize(ctx context.Context, text, voice string) ([]byte, string, error) {
+	if ss, ok := s.provider.(SpeechService); ok {
+		var audio []byte
+		var contentType string
+		err := s.passthroughUsage(ctx, func() (*Usage, error) {
+			var err error
+			audio, contentType, err = ss.Synthesize(ctx, text, voice)
+
+			// providers don't report tokens for speech so we estimate them from the text
+			return &Usage{TokensInput: int64(EstimateTokens(text))}, err
+		})
+		return audio, contentType, err
+	}
+	return nil, "", errors.New("LLM service doesn't support speech")
+}
@@ -0,0 +1,43 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpeech(t *testing.T) {
+	svc := ai.NewLLMService(&fixedLLM{output: "Hola"})
+	_, _, err := svc.Synthesize(context.Background(), "Hello", "alloy")
+	assert.EqualError(t, err, "LLM service doesn't support speech")
+}
+
+// LLM service for testing which also supports speech
+type speakingLLM struct {
+	fixedLLM
+}
+
+func (s *speakingLLM) Synthesize(ctx context.Context, text, voice string) ([]byte, string, error) {
+	return []byte("ID3"), "audio/mpeg", nil
+}
+
+func TestSynthesizeGuarded(t *testing.T) {
+	guard := &testGuard{}
+	svc := ai.NewLLMService(&speakingLLM{}).WithGuard(guard)
+
+	audio, contentType, err := svc.Synthesize(context.Background(), "Hello there", "alloy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ID3"), audio)
+	assert.Equal(t, "audio/mpeg", contentType)
+	assert.Equal(t, []error{nil}, guard.done)
+	assert.Equal(t, []*ai.Usage{{TokensInput: int64(ai.EstimateTokens("Hello there"))}}, guard.usage)
+
+	// requests the guard doesn't allow aren't made
+	guard.closed = true
+
+	_, _, err = svc.Synthesize(context.Background(), "Hello there", "alloy")
+	assert.EqualError(t, err, "not allowed")
+	assert.Len(t, guard.done, 1)
+}
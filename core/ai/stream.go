@@ -0,0 +1,144 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// how long we wait for final usage when a stream is closed before it has finished
+const defaultDrainTimeout = 2 * time.Second
+
+// StreamingService is an LLM service which can also stream responses
+type StreamingService interface {
+	Service
+
+	Stream(ctx context.Context, req *Request) (*Stream, error)
+}
+
+// Usage is the token usage reported by a provider
+type Usage struct {
+	TokensInput  int64
+	TokensOutput int64
+}
+
+// StreamEvent is a single event read from a provider's stream
+type StreamEvent struct {
+	Delta string // text generated since the previous event, if any
+	Usage *Usage // final usage, if reported by this event
+}
+
+// StreamSource is implemented by services to adapt their provider's stream
+type StreamSource interface {
+	Next() bool
+	Current() StreamEvent
+	Err() error
+	Close() error
+}
+
+// Stream is a streamed response from an LLM service
+type Stream struct {
+	// DrainTimeout is how long Close waits for final usage if the stream hasn't finished
+	DrainTimeout time.Duration
+
+	src      StreamSource
+	timer    *Timer
+	clean    func(string) string
+	chunk    string
+	output   strings.Builder
+	usage    *Usage
+	finished bool
+	onClose  func() // called once the stream has been closed
+}
+
+// NewStream creates a new stream reading from the given source. The optional clean function is applied to the final
+// output of the response.
+func NewStream(src StreamSource, timer *Timer, clean func(string) string) *Stream {
+	if clean == nil {
+		clean = strings.TrimSpace
+	}
+	return &Stream{DrainTimeout: defaultDrainTimeout, src: src, timer: timer, clean: clean}
+}
+
+// Next advances to the next chunk of text, returning false when the stream has finished or errored
+func (s *Stream) Next() bool {
+	for s.src.Next() {
+		if s.read(s.src.Current()) {
+			return true
+		}
+	}
+
+	s.finished = true
+	return false
+}
+
+// Chunk returns the current chunk of text
+func (s *Stream) Chunk() string { return s.chunk }
+
+// Err returns the error, if any, which ended the stream
+func (s *Stream) Err() error { return s.src.Err() }
+
+// Response returns the response so far, i.e. the output and usage received and the timings of the call
+func (s *Stream) Response() *Response {
+	resp := &Response{Output: s.clean(s.output.String()), Timings: s.timer.Timings()}
+	if s.usage != nil {
+		resp.TokensInput, resp.TokensOutput = s.usage.TokensInput, s.usage.TokensOutput
+	}
+	return resp
+}
+
+// Close closes the stream. If the stream hasn't finished, e.g. because the consumer stopped reading early, we first
+// drain any remaining events, bounded by the drain timeout, so that final usage can still be captured for billing.
+func (s *Stream) Close() error {
+	err := s.close()
+
+	if s.onClose != nil {
+		s.onClose()
+		s.onClose = nil
+	}
+	return err
+}
+
+func (s *Stream) close() error {
+	if s.finished || s.usage != nil {
+		return s.src.Close()
+	}
+
+	drained := make(chan *Usage, 1)
+	go func() {
+		for s.src.Next() {
+			if u := s.src.Current().Usage; u != nil {
+				drained <- u
+				return
+			}
+		}
+		drained <- nil
+	}()
+
+	timeout := time.NewTimer(s.DrainTimeout)
+	defer timeout.Stop()
+
+	select {
+	case s.usage = <-drained:
+		return s.src.Close()
+	case <-timeout.C:
+		err := s.src.Close()
+		<-drained // closing the source ends any blocked read
+		return err
+	}
+}
+
+// reads the given event, returning whether it contained text
+func (s *Stream) read(e StreamEvent) bool {
+	if e.Usage != nil {
+		s.usage = e.Usage
+	}
+	if e.Delta == "" {
+		return false
+	}
+
+	s.timer.FirstToken()
+	s.chunk = e.Delta
+	s.output.WriteString(e.Delta)
+	return true
+}
@@ -0,0 +1,94 @@
+package ai_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+// stream source for testing which reads events from a channel until it's closed
+type testSource struct {
+	events  chan ai.StreamEvent
+	closed  chan struct{}
+	current ai.StreamEvent
+	err     error
+}
+
+func newTestSource(events ...ai.StreamEvent) *testSource {
+	s := &testSource{events: make(chan ai.StreamEvent, 10), closed: make(chan struct{})}
+	for _, e := range events {
+		s.events <- e
+	}
+	return s
+}
+
+func (s *testSource) Next() bool {
+	select {
+	case e, ok := <-s.events:
+		s.current = e
+		return ok
+	case <-s.closed:
+		s.err = errors.New("stream closed")
+		return false
+	}
+}
+
+func (s *testSource) Current() ai.StreamEvent { return s.current }
+func (s *testSource) Err() error              { return s.err }
+func (s *testSource) Close() error            { close(s.closed); return nil }
+
+func TestStream(t *testing.T) {
+	// stream read to completion
+	src := newTestSource(ai.StreamEvent{Delta: " Hola"}, ai.StreamEvent{Delta: " mundo "}, ai.StreamEvent{Usage: &ai.Usage{TokensInput: 12, TokensOutput: 3}})
+	close(src.events)
+	stream := ai.NewStream(src, ai.NewTimer(), nil)
+
+	var chunks []string
+	for stream.Next() {
+		chunks = append(chunks, stream.Chunk())
+	}
+	assert.NoError(t, stream.Err())
+	assert.NoError(t, stream.Close())
+	assert.Equal(t, []string{" Hola", " mundo "}, chunks)
+
+	resp := stream.Response()
+	assert.Equal(t, "Hola mundo", resp.Output)
+	assert.Equal(t, int64(12), resp.TokensInput)
+	assert.Equal(t, int64(3), resp.TokensOutput)
+}
+
+func TestStreamCloseDrainsUsage(t *testing.T) {
+	// consumer stops reading early but usage is still pending in the stream
+	src := newTestSource(ai.StreamEvent{Delta: "Hola"}, ai.StreamEvent{Delta: " mundo"}, ai.StreamEvent{Delta: "!"}, ai.StreamEvent{Usage: &ai.Usage{TokensInput: 12, TokensOutput: 4}})
+	stream := ai.NewStream(src, ai.NewTimer(), nil)
+
+	assert.True(t, stream.Next())
+	assert.Equal(t, "Hola", stream.Chunk())
+	assert.NoError(t, stream.Close())
+
+	resp := stream.Response()
+	assert.Equal(t, "Hola", resp.Output) // drained text isn't included in output
+	assert.Equal(t, int64(12), resp.TokensInput)
+	assert.Equal(t, int64(4), resp.TokensOutput)
+}
+
+func TestStreamCloseWithoutUsage(t *testing.T) {
+	// consumer stops reading early and no usage is forthcoming so we give up after the drain timeout
+	src := newTestSource(ai.StreamEvent{Delta: "Hola"})
+	stream := ai.NewStream(src, ai.NewTimer(), nil)
+	stream.DrainTimeout = 50 * time.Millisecond
+
+	assert.True(t, stream.Next())
+
+	start := time.Now()
+	assert.NoError(t, stream.Close())
+	assert.Less(t, time.Since(start), time.Second)
+
+	resp := stream.Response()
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Equal(t, int64(0), resp.TokensInput)
+	assert.Equal(t, int64(0), resp.TokensOutput)
+}
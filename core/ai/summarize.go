@@ -0,0 +1,102 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+)
+
+// maximum number of output tokens of a summary of older turns
+const maxSummaryTokens = 500
+
+// summarizingService is an LLM service which summarizes older turns of history when requests grow too large
+type summarizingService struct {
+	service    Service
+	summarizer Service
+	threshold  int
+}
+
+// NewSummarizingService wraps the given service so that when the estimated tokens of a request's instructions, history
+// and input exceed the given threshold, its oldest turns of history are compressed by the given summarizer, e.g. a
+// cheaper model, into a summary which is added to the instructions.
+func NewSummarizingService(svc, summarizer Service, threshold int) Service {
+	return &summarizingService{service: svc, summarizer: summarizer, threshold: threshold}
+}
+
+func (s *summarizingService) Call(ctx context.Context, req *Request) (*Response, error) {
+	fixed := EstimateTokens(req.Instructions) + EstimateTokens(req.Input)
+	if len(req.History) == 0 || fixed+estimateHistoryTokens(req.History) <= s.threshold {
+		return s.service.Call(ctx, req)
+	}
+
+	// keep the most recent turns which fit alongside a summary of the rest
+	keep := req.History
+	for len(keep) > 0 && fixed+maxSummaryTokens+estimateHistoryTokens(keep) > s.threshold {
+		keep = keep[1:]
+	}
+	older := req.History[:len(req.History)-len(keep)]
+
+	summary, err := summarizeTurns(ctx, s.summarizer, "", older)
+	if err != nil {
+		return nil, err
+	}
+
+	summarized := *req
+	summarized.History = keep
+	summarized.Instructions = strings.TrimSpace(prompts.Render("conversation_summary", map[string]any{"Instructions": req.Instructions, "Summary": summary.Output}))
+
+	resp, err := s.service.Call(ctx, &summarized)
+	if err != nil {
+		return nil, err
+	}
+
+	// the caller pays for both calls
+	resp.TokensInput += summary.TokensInput
+	resp.TokensOutput += summary.TokensOutput
+	resp.Diagnostics = append(resp.Diagnostics, fmt.Sprintf("summarized %d older turns of history", len(older)))
+	return resp, nil
+}
+
+// Summarize uses the given service to write a brief summary of a transcript of the recent messages of a conversation
+// with a contact, e.g. for an agent who is taking it over
+func Summarize(ctx context.Context, svc flows.LLMService, transcript string) (*flows.LLMResponse, error) {
+	return svc.Response(ctx, prompts.Render("summarize_transcript", nil), transcript, maxSummaryTokens)
+}
+
+// DigestConversation is a conversation to be included in a digest
+type DigestConversation struct {
+	Topic      string
+	Transcript string
+}
+
+// maximum number of output tokens of a digest of conversations
+const maxDigestTokens = 2000
+
+// Digest uses the given service to write a digest of the given conversations grouped by topic, e.g. for the
+// administrators of a workspace
+func Digest(ctx context.Context, svc flows.LLMService, conversations []*DigestConversation) (*flows.LLMResponse, error) {
+	var input strings.Builder
+	for i, c := range conversations {
+		fmt.Fprintf(&input, "## Conversation %d (topic: %s)\n%s\n", i+1, c.Topic, strings.TrimSpace(c.Transcript))
+	}
+
+	return svc.Response(ctx, prompts.Render("digest_conversations", nil), input.String(), maxDigestTokens)
+}
+
+// summarizes the given turns of a conversation along with any existing summary of turns before them
+func summarizeTurns(ctx context.Context, summarizer Service, summary string, turns []*Turn) (*Response, error) {
+	var transcript strings.Builder
+	for _, t := range turns {
+		fmt.Fprintf(&transcript, "User: %s\nAssistant: %s\n", t.Input, t.Output)
+	}
+
+	return summarizer.Call(ctx, &Request{
+		Instructions: prompts.Render("summarize_conversation", map[string]any{"Summary": summary}),
+		Input:        transcript.String(),
+		MaxTokens:    maxSummaryTokens,
+		Idempotent:   true,
+	})
+}
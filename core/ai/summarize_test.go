@@ -0,0 +1,76 @@
+package ai_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizingService(t *testing.T) {
+	ctx := context.Background()
+
+	// each turn is 200 estimated tokens
+	history := []*ai.Turn{
+		{Input: strings.Repeat("a", 400), Output: strings.Repeat("b", 400)},
+		{Input: strings.Repeat("c", 400), Output: strings.Repeat("d", 400)},
+		{Input: strings.Repeat("e", 400), Output: strings.Repeat("f", 400)},
+		{Input: strings.Repeat("g", 400), Output: strings.Repeat("h", 400)},
+	}
+
+	llm := &fixedLLM{output: "ok"}
+	summarizer := &fixedLLM{output: "They talked about letters."}
+	svc := ai.NewSummarizingService(llm, summarizer, 1000)
+
+	// requests under the threshold are passed through
+	resp, err := svc.Call(ctx, &ai.Request{Instructions: "chat", Input: "hi", History: history, MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, history, llm.last.History)
+	assert.Equal(t, 0, summarizer.calls)
+	assert.Nil(t, resp.Diagnostics)
+
+	// those over it have older turns summarized so that what remains fits alongside the summary
+	svc = ai.NewSummarizingService(llm, summarizer, 800)
+
+	resp, err = svc.Call(ctx, &ai.Request{Instructions: "chat", Input: "hi", History: history, MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, history[3:], llm.last.History)
+	assert.Contains(t, llm.last.Instructions, "<summary>\nThey talked about letters.\n</summary>")
+	assert.True(t, strings.HasPrefix(summarizer.last.Input, "User: "+strings.Repeat("a", 400)+"\nAssistant: "+strings.Repeat("b", 400)+"\n"))
+	assert.True(t, strings.HasSuffix(summarizer.last.Input, "Assistant: "+strings.Repeat("f", 400)+"\n"))
+	assert.Equal(t, int64(20), resp.TokensInput)
+	assert.Equal(t, []string{"summarized 3 older turns of history"}, resp.Diagnostics)
+
+	// requests without history are never summarized
+	_, err = svc.Call(ctx, &ai.Request{Instructions: "chat", Input: strings.Repeat("x", 4000), MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, 1, summarizer.calls)
+}
+
+func TestSummarize(t *testing.T) {
+	llm := &fixedLLM{output: "The contact's order hasn't arrived."}
+
+	resp, err := ai.Summarize(context.Background(), ai.NewLLMService(llm), "Contact: Where is my order?\nAgent: Let me check.\n")
+	require.NoError(t, err)
+	assert.Equal(t, "The contact's order hasn't arrived.", resp.Output)
+	assert.Equal(t, int64(10), resp.TokensInput)
+	assert.Equal(t, "Contact: Where is my order?\nAgent: Let me check.\n", llm.last.Input)
+	assert.True(t, strings.HasPrefix(llm.last.Instructions, "The input text is a transcript of the recent messages"))
+	assert.Equal(t, 500, llm.last.MaxTokens)
+}
+
+func TestDigest(t *testing.T) {
+	llm := &fixedLLM{output: "Billing\n- One contact was charged twice."}
+
+	resp, err := ai.Digest(context.Background(), ai.NewLLMService(llm), []*ai.DigestConversation{
+		{Topic: "Billing", Transcript: "Contact: I was charged twice!\n"},
+		{Topic: "General", Transcript: "Contact: Hi\nAgent: Hello\n"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Billing\n- One contact was charged twice.", resp.Output)
+	assert.Equal(t, "## Conversation 1 (topic: Billing)\nContact: I was charged twice!\n## Conversation 2 (topic: General)\nContact: Hi\nAgent: Hello\n", llm.last.Input)
+	assert.Contains(t, llm.last.Instructions, "grouped by topic")
+}
@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+)
+
+// maximum number of output tokens of generating template variables, per variable
+const maxTemplateVariableTokens = 100
+
+// TemplateVariable is a text variable of a message template whose value can be generated
+type TemplateVariable struct {
+	Key       string // unique key of the variable, e.g. "body_1"
+	Name      string // name of the variable in its component, e.g. "1"
+	Content   string // content of the component the variable appears in
+	MaxLength int
+}
+
+// GenerateTemplateVariables uses the given service to write values for the given template variables for a contact,
+// described by the given input, optionally following instructions from the sender. Output is constrained to a schema of
+// the variables and whitespace in values is collapsed, but values aren't otherwise checked against the template, which
+// callers should do before using them. The response is returned so that callers can record usage.
+func GenerateTemplateVariables(ctx context.Context, svc flows.LLMService, vars []*TemplateVariable, contact, instructions string) (map[string]string, *flows.LLMResponse, error) {
+	prompt := prompts.Render("template_variables", map[string]any{"Variables": vars, "Instructions": strings.TrimSpace(instructions)})
+
+	resp, err := NewLLMService(AsService(svc)).ResponseJSON(ctx, prompt, contact, templateVariablesSchema(vars), maxTemplateVariableTokens*len(vars))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var generated map[string]string
+	json.Unmarshal([]byte(resp.Output), &generated) // already validated against schema
+
+	values := make(map[string]string, len(vars))
+	for _, v := range vars {
+		values[v.Key] = strings.Join(strings.Fields(generated[v.Key]), " ")
+	}
+	return values, resp, nil
+}
+
+// builds a schema for an object with a string property for each variable
+func templateVariablesSchema(vars []*TemplateVariable) map[string]any {
+	props := make(map[string]any, len(vars))
+	required := make([]any, len(vars))
+
+	for i, v := range vars {
+		props[v.Key] = map[string]any{"type": "string", "maxLength": v.MaxLength}
+		required[i] = v.Key
+	}
+
+	return map[string]any{"type": "object", "properties": props, "required": required, "additionalProperties": false}
+}
@@ -0,0 +1,42 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateTemplateVariables(t *testing.T) {
+	ctx := context.Background()
+
+	vars := []*ai.TemplateVariable{
+		{Key: "body_1", Name: "1", Content: "Hi {{1}}, are you still experiencing problems with {{2}}?", MaxLength: 1024},
+		{Key: "body_2", Name: "2", Content: "Hi {{1}}, are you still experiencing problems with {{2}}?", MaxLength: 1024},
+	}
+
+	llm := &fixedLLM{output: `{"body_1": "Ann", "body_2": "your\n  internet   connection "}`}
+
+	values, resp, err := ai.GenerateTemplateVariables(ctx, ai.NewLLMService(llm), vars, "Name: Ann\nLanguage: eng", "mention their internet")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"body_1": "Ann", "body_2": "your internet connection"}, values)
+	assert.Equal(t, int64(10), resp.TokensInput)
+	assert.Equal(t, "Name: Ann\nLanguage: eng", llm.last.Input)
+	assert.Contains(t, llm.last.Instructions, "- body_2: variable 2 in \"Hi {{1}}, are you still experiencing problems with {{2}}?\" (maximum 1024 characters)\n")
+	assert.Contains(t, llm.last.Instructions, "Follow these instructions from the person sending the message: mention their internet\n")
+	assert.Equal(t, []any{"body_1", "body_2"}, llm.last.Schema["required"])
+	assert.Equal(t, 200, llm.last.MaxTokens)
+
+	// no instructions means none are included
+	_, _, err = ai.GenerateTemplateVariables(ctx, ai.NewLLMService(llm), vars, "Name: Ann", " ")
+	require.NoError(t, err)
+	assert.NotContains(t, llm.last.Instructions, "Follow these instructions")
+
+	// output which doesn't match the schema is an error once repair fails
+	llm.output = `{"body_1": "Ann"}`
+
+	_, _, err = ai.GenerateTemplateVariables(ctx, ai.NewLLMService(llm), vars, "Name: Ann", "")
+	assert.ErrorContains(t, err, "missing required property 'body_2'")
+}
@@ -0,0 +1,25 @@
+package ai
+
+import (
+	"regexp"
+	"strings"
+)
+
+// matches the thinking blocks of reasoning models, including an unclosed block if output was cut short while thinking
+var thinkingRegex = regexp.MustCompile(`(?s)<think>(.*?)(?:</think>|$)`)
+
+// StripThinking removes the <think> blocks which reasoning models like DeepSeek R1 include in their output when their
+// provider doesn't return reasoning separately. Returns the remaining output and the thinking that was removed.
+func StripThinking(output string) (string, string) {
+	if !strings.Contains(output, "<think>") {
+		return output, ""
+	}
+
+	var thinking []string
+	stripped := thinkingRegex.ReplaceAllStringFunc(output, func(block string) string {
+		thinking = append(thinking, strings.TrimSpace(thinkingRegex.FindStringSubmatch(block)[1]))
+		return ""
+	})
+
+	return strings.TrimSpace(stripped), strings.Join(thinking, "\n")
+}
@@ -0,0 +1,29 @@
+package ai_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripThinking(t *testing.T) {
+	tcs := []struct {
+		output   string
+		stripped string
+		thinking string
+	}{
+		{"", "", ""},
+		{"Hola", "Hola", ""},
+		{"<think>\nThey want Spanish.\n</think>\n\nHola", "Hola", "They want Spanish."},
+		{"<think>One</think>Hola <think>Two</think>mundo", "Hola mundo", "One\nTwo"},
+		{"<think>\nThey want Spanish but I ran out of", "", "They want Spanish but I ran out of"},
+		{"<think></think>Hola", "Hola", ""},
+	}
+
+	for _, tc := range tcs {
+		stripped, thinking := ai.StripThinking(tc.output)
+		assert.Equal(t, tc.stripped, stripped, "stripped mismatch for %q", tc.output)
+		assert.Equal(t, tc.thinking, thinking, "thinking mismatch for %q", tc.output)
+	}
+}
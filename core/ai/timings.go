@@ -0,0 +1,67 @@
+package ai
+
+import (
+	"context"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+)
+
+// Timings is a breakdown of where the time of an LLM call was spent. Time to first byte and token are measured from
+// when the request to the provider was started, i.e. after any queue wait. Durations which don't apply to the call
+// path taken, e.g. time to first token for a non-streaming call, are zero.
+type Timings struct {
+	QueueWait        time.Duration // waiting for a limiter or semaphore before the call could be made
+	TimeToFirstByte  time.Duration // until the first byte of the provider's response was received
+	TimeToFirstToken time.Duration // until the first token of a streamed response was received
+	Total            time.Duration // the entire call including any queue wait
+}
+
+// AddQueueWait adds time spent waiting before the call could be made
+func (t *Timings) AddQueueWait(d time.Duration) {
+	t.QueueWait += d
+	t.Total += d
+}
+
+// Timer records the timings of a single LLM call
+type Timer struct {
+	start      time.Time
+	firstByte  time.Time
+	firstToken time.Time
+}
+
+// NewTimer creates a new timer started now
+func NewTimer() *Timer {
+	return &Timer{start: dates.Now()}
+}
+
+// Trace returns a context which records when the first byte of the response to an HTTP request is received. If the
+// request is retried, it's the first byte of the final attempt which is recorded.
+func (t *Timer) Trace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{GotFirstResponseByte: t.FirstByte})
+}
+
+// FirstByte records that the first byte of the response has been received
+func (t *Timer) FirstByte() {
+	t.firstByte = dates.Now()
+}
+
+// FirstToken records that the first token of a streamed response has been received
+func (t *Timer) FirstToken() {
+	if t.firstToken.IsZero() {
+		t.firstToken = dates.Now()
+	}
+}
+
+// Timings returns the timings of the call so far
+func (t *Timer) Timings() Timings {
+	timings := Timings{Total: dates.Since(t.start)}
+	if !t.firstByte.IsZero() {
+		timings.TimeToFirstByte = t.firstByte.Sub(t.start)
+	}
+	if !t.firstToken.IsZero() {
+		timings.TimeToFirstToken = t.firstToken.Sub(t.start)
+	}
+	return timings
+}
@@ -0,0 +1,34 @@
+package ai_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimer(t *testing.T) {
+	dates.SetNowFunc(dates.NewSequentialNow(time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC), time.Second))
+	defer dates.SetNowFunc(time.Now)
+
+	// non-streaming call with retry only records first byte of final attempt
+	timer := ai.NewTimer() // 0s
+	timer.FirstByte()      // 1s
+	timer.FirstByte()      // 2s
+
+	assert.Equal(t, ai.Timings{TimeToFirstByte: 2 * time.Second, Total: 3 * time.Second}, timer.Timings())
+
+	// streaming call records first token
+	timer = ai.NewTimer() // 0s
+	timer.FirstByte()     // 1s
+	timer.FirstToken()    // 2s
+	timer.FirstToken()    // ignored
+
+	timings := timer.Timings() // 3s
+	assert.Equal(t, ai.Timings{TimeToFirstByte: time.Second, TimeToFirstToken: 2 * time.Second, Total: 3 * time.Second}, timings)
+
+	timings.AddQueueWait(500 * time.Millisecond)
+	assert.Equal(t, ai.Timings{QueueWait: 500 * time.Millisecond, TimeToFirstByte: time.Second, TimeToFirstToken: 2 * time.Second, Total: 3500 * time.Millisecond}, timings)
+}
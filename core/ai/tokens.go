@@ -0,0 +1,26 @@
+package ai
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// EstimateTokens makes a pre-flight estimate of the number of tokens in the given text without needing a provider's
+// tokenizer. It assumes about 4 characters per token for most scripts but a token per character for scripts like CJK
+// which don't separate words with spaces.
+func EstimateTokens(s string) int {
+	chars, dense := 0, 0
+	for _, r := range s {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Thai) {
+			dense++
+		} else {
+			chars++
+		}
+	}
+
+	tokens := dense + (chars+3)/4
+	if tokens == 0 && utf8.RuneCountInString(s) > 0 {
+		tokens = 1
+	}
+	return tokens
+}
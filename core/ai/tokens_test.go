@@ -0,0 +1,16 @@
+package ai_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, ai.EstimateTokens(""))
+	assert.Equal(t, 1, ai.EstimateTokens("Hi"))
+	assert.Equal(t, 3, ai.EstimateTokens("Hello world!"))
+	assert.Equal(t, 5, ai.EstimateTokens("今日は晴れ"))
+	assert.Equal(t, 7, ai.EstimateTokens("Hello 今日は晴れ"))
+}
@@ -0,0 +1,17 @@
+package ai
+
+import "encoding/json"
+
+// Tool is a function which an LLM can choose to call instead of responding with text
+type Tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters"` // JSON schema of the arguments
+}
+
+// ToolCall is a call to one of the request's tools that an LLM wants made
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
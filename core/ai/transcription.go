@@ -0,0 +1,35 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/nyaruka/goflow/utils"
+)
+
+// TranscriptionService is a service which can transcribe audio attachments, e.g. voice notes sent by contacts
+type TranscriptionService interface {
+	Transcribe(ctx context.Context, audio utils.Attachment) (string, error)
+}
+
+// Transcribe transcribes the given audio attachment using the underlying service, if it supports transcription
+func (s *LLMService) Transcribe(ctx context.Context, audio utils.Attachment) (string, error) {
+	if ts, ok := s.provider.(TranscriptionService); ok {
+		var text string
+		err := s.passthroughUsage(ctx, func() (*Usage, error) {
+			var err error
+			text, err = ts.Transcribe(ctx, audio)
+
+			// providers don't report tokens for transcriptions so we estimate them from the text
+			return &Usage{TokensOutput: int64(EstimateTokens(text))}, err
+		})
+		return text, err
+	}
+	return "", errors.New("LLM service doesn't support transcription")
+}
+
+// IsAudio returns whether the given attachment is audio that can be transcribed
+func IsAudio(a utils.Attachment) bool {
+	return strings.HasPrefix(a.ContentType(), "audio/")
+}
@@ -0,0 +1,48 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscription(t *testing.T) {
+	assert.True(t, ai.IsAudio("audio/mp4:https://example.com/note.m4a"))
+	assert.False(t, ai.IsAudio("image/jpeg:https://example.com/cat.jpg"))
+	assert.False(t, ai.IsAudio("https://example.com/note.m4a"))
+
+	svc := ai.NewLLMService(&fixedLLM{output: "Hola"})
+	_, err := svc.Transcribe(context.Background(), utils.Attachment("audio/mp4:https://example.com/note.m4a"))
+	assert.EqualError(t, err, "LLM service doesn't support transcription")
+}
+
+// LLM service for testing which also supports transcription
+type transcribingLLM struct {
+	fixedLLM
+	text string
+}
+
+func (s *transcribingLLM) Transcribe(ctx context.Context, audio utils.Attachment) (string, error) {
+	return s.text, nil
+}
+
+func TestTranscribeGuarded(t *testing.T) {
+	guard := &testGuard{}
+	svc := ai.NewLLMService(&transcribingLLM{text: "Hello there"}).WithGuard(guard)
+
+	text, err := svc.Transcribe(context.Background(), utils.Attachment("audio/mp4:https://example.com/note.m4a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello there", text)
+	assert.Equal(t, []error{nil}, guard.done)
+	assert.Equal(t, []*ai.Usage{{TokensOutput: int64(ai.EstimateTokens("Hello there"))}}, guard.usage)
+
+	// requests the guard doesn't allow aren't made
+	guard.closed = true
+
+	_, err = svc.Transcribe(context.Background(), utils.Attachment("audio/mp4:https://example.com/note.m4a"))
+	assert.EqualError(t, err, "not allowed")
+	assert.Len(t, guard.done, 1)
+}
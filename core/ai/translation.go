@@ -0,0 +1,50 @@
+package ai
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+)
+
+// returned by models which can't translate the input
+const cantTranslate = "<CANT>"
+
+// TranslationService is a service which can translate messages into other languages, e.g. messages in flows which have
+// no translation in the contact's language
+type TranslationService interface {
+	Translate(ctx context.Context, text string, from, to i18n.Language) (*Response, error)
+}
+
+// Translate translates the given text using the underlying service if it has its own way to translate, or otherwise by
+// asking the model. Output which isn't a translation is an error.
+func (s *LLMService) Translate(ctx context.Context, text string, from, to i18n.Language) (*Response, error) {
+	var resp *Response
+	var err error
+
+	if ts, ok := s.provider.(TranslationService); ok {
+		err = s.passthrough(ctx, func() (err error) { resp, err = ts.Translate(ctx, text, from, to); return err })
+	} else {
+		resp, err = s.Call(ctx, NewTranslationRequest(text, from, to))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Output == "" || resp.Output == cantTranslate {
+		return resp, errors.New("model couldn't translate message")
+	}
+	return resp, nil
+}
+
+// NewTranslationRequest creates a request to translate the given text, with enough output tokens for a translation
+// somewhat longer than the original
+func NewTranslationRequest(text string, from, to i18n.Language) *Request {
+	return &Request{
+		Instructions: prompts.Render("translate_message", map[string]any{"From": from, "To": to}),
+		Input:        text,
+		MaxTokens:    EstimateTokens(text)*2 + 50,
+		Idempotent:   true,
+	}
+}
@@ -0,0 +1,35 @@
+package ai_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslation(t *testing.T) {
+	ctx := context.Background()
+
+	req := ai.NewTranslationRequest("Hi there", "eng", "spa")
+	assert.Contains(t, req.Instructions, `from the language with the ISO code "eng" to the language with the ISO code "spa"`)
+	assert.Equal(t, "Hi there", req.Input)
+	assert.Equal(t, 54, req.MaxTokens)
+
+	// services without their own way to translate ask the model
+	llm := &fixedLLM{output: "Hola"}
+	svc := ai.NewLLMService(llm)
+
+	resp, err := svc.Translate(ctx, "Hi there", "eng", "spa")
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Equal(t, req, llm.last)
+
+	llm.output = "<CANT>"
+	_, err = svc.Translate(ctx, "Hi there", "eng", "spa")
+	assert.EqualError(t, err, "model couldn't translate message")
+
+	_, err = ai.NewLLMService(&failingLLM{}).Translate(ctx, "Hi there", "eng", "spa")
+	assert.Error(t, err)
+}
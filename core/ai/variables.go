@@ -0,0 +1,76 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Variables provides the values of the variables which instructions can reference like {{contact.name}}, e.g. details
+// of the contact and flow that a call is being made for
+type Variables interface {
+	Load(ctx context.Context) (map[string]string, error) // returns nil if the call has no context to provide values
+}
+
+// variables are referenced by dotted names like {{ contact.fields.age }}
+var variableRegex = regexp.MustCompile(`\{\{\s*([a-z_][a-z0-9_]*(?:\.[a-z0-9_]+)*)\s*\}\}`)
+
+// variablesService is an LLM service which expands variables in the instructions of requests
+type variablesService struct {
+	service   Service
+	variables Variables
+}
+
+// NewVariablesService wraps the given service so that variables referenced in instructions are replaced by their
+// values from the given source at call time. Values are collapsed onto a single line so they can't break the formatting
+// of the instructions, and variables without values are replaced by nothing and noted in diagnostics.
+func NewVariablesService(svc Service, v Variables) Service {
+	return &variablesService{service: svc, variables: v}
+}
+
+func (s *variablesService) Call(ctx context.Context, req *Request) (*Response, error) {
+	if !variableRegex.MatchString(req.Instructions) {
+		return s.service.Call(ctx, req)
+	}
+
+	values, err := s.variables.Load(ctx)
+	if err != nil {
+		return nil, &ServiceError{Message: fmt.Sprintf("error loading instruction variables: %s", err), Code: ErrorUnknown, Instructions: req.Instructions, Input: req.Input}
+	}
+
+	call := *req
+	var missing []string
+	call.Instructions, missing = ExpandVariables(req.Instructions, values)
+
+	resp, err := s.service.Call(ctx, &call)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(missing) > 0 {
+		resp.Diagnostics = append(resp.Diagnostics, fmt.Sprintf("no values for instruction variables: %s", strings.Join(missing, ", ")))
+	}
+	return resp, nil
+}
+
+// ExpandVariables replaces the variables referenced in the given instructions with their values, returning the names of
+// any which don't have values
+func ExpandVariables(instructions string, values map[string]string) (string, []string) {
+	var missing []string
+
+	expanded := variableRegex.ReplaceAllStringFunc(instructions, func(ref string) string {
+		name := variableRegex.FindStringSubmatch(ref)[1]
+		value, ok := values[name]
+		if !ok {
+			if !slices.Contains(missing, name) {
+				missing = append(missing, name)
+			}
+			return ""
+		}
+		return strings.Join(strings.Fields(value), " ")
+	})
+
+	return expanded, missing
+}
@@ -0,0 +1,87 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// instruction variables for testing which are fixed
+type fixedVariables struct {
+	values map[string]string
+	err    error
+	loads  int
+}
+
+func (v *fixedVariables) Load(ctx context.Context) (map[string]string, error) {
+	v.loads++
+	return v.values, v.err
+}
+
+func TestExpandVariables(t *testing.T) {
+	values := map[string]string{"org.name": "Nyaruka", "contact.name": "Ann\n\nMarie  ", "contact.fields.age": "33"}
+
+	tcs := []struct {
+		instructions string
+		expanded     string
+		missing      []string
+	}{
+		{"Answer the question.", "Answer the question.", nil},
+		{"You work for {{org.name}}.", "You work for Nyaruka.", nil},
+		{"Greet {{ contact.name }} who is {{contact.fields.age}}.", "Greet Ann Marie who is 33.", nil},
+		{"Reply as JSON like {\"name\": \"{{contact.name}}\"}", "Reply as JSON like {\"name\": \"Ann Marie\"}", nil},
+		{"Groups: {{contact.groups}}, results: {{results.color}} {{contact.groups}}", "Groups: , results:  ", []string{"contact.groups", "results.color"}},
+		{"Not variables: {{ Contact.Name }} {{contact.}} {product}", "Not variables: {{ Contact.Name }} {{contact.}} {product}", nil},
+	}
+
+	for _, tc := range tcs {
+		expanded, missing := ai.ExpandVariables(tc.instructions, values)
+		assert.Equal(t, tc.expanded, expanded, "expanded mismatch for %q", tc.instructions)
+		assert.Equal(t, tc.missing, missing, "missing mismatch for %q", tc.instructions)
+	}
+}
+
+func TestVariablesService(t *testing.T) {
+	ctx := context.Background()
+	vars := &fixedVariables{values: map[string]string{"org.name": "Nyaruka"}}
+	llm := &fixedLLM{output: "Hi"}
+	svc := ai.NewVariablesService(llm, vars)
+
+	// instructions without variables don't need values to be loaded
+	req := &ai.Request{Instructions: "Greet the contact.", Input: "Hello", MaxTokens: 10}
+	resp, err := svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Hi", resp.Output)
+	assert.Equal(t, "Greet the contact.", llm.last.Instructions)
+	assert.Nil(t, resp.Diagnostics)
+	assert.Equal(t, 0, vars.loads)
+
+	req = &ai.Request{Instructions: "Greet the contact on behalf of {{org.name}}. They are {{contact.fields.age}}.", Input: "Hello", MaxTokens: 10}
+	resp, err = svc.Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Greet the contact on behalf of Nyaruka. They are .", llm.last.Instructions)
+	assert.Equal(t, []string{"no values for instruction variables: contact.fields.age"}, resp.Diagnostics)
+	assert.Equal(t, 1, vars.loads)
+
+	// original request isn't modified
+	assert.Equal(t, "Greet the contact on behalf of {{org.name}}. They are {{contact.fields.age}}.", req.Instructions)
+
+	// calls without any context to provide values still have variables removed
+	vars.values = nil
+	resp, err = svc.Call(ctx, &ai.Request{Instructions: "You work for {{org.name}}.", Input: "Hello", MaxTokens: 10})
+	require.NoError(t, err)
+	assert.Equal(t, "You work for .", llm.last.Instructions)
+	assert.Equal(t, []string{"no values for instruction variables: org.name"}, resp.Diagnostics)
+
+	// failing to load values fails the call
+	vars.err = errors.New("boom")
+	llm.calls = 0
+	_, err = svc.Call(ctx, req)
+	assert.EqualError(t, err, "error loading instruction variables: boom")
+	assert.Equal(t, ai.ErrorUnknown, ai.ErrorCode(err))
+	assert.Equal(t, 0, llm.calls)
+}
@@ -0,0 +1,86 @@
+package crons
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+func init() {
+	Register("collect_llm_batches", &CollectLLMBatchesCron{})
+}
+
+// CollectLLMBatchesCron polls the providers of pending LLM batches and queues the tasks which submitted batches that
+// have finished again with their results
+type CollectLLMBatchesCron struct{}
+
+func (c *CollectLLMBatchesCron) Next(last time.Time) time.Time {
+	return Next(last, time.Minute)
+}
+
+func (c *CollectLLMBatchesCron) AllInstances() bool {
+	return false
+}
+
+func (c *CollectLLMBatchesCron) Run(ctx context.Context, rt *runtime.Runtime) (map[string]any, error) {
+	batches, err := models.GetLLMBatches(ctx, rt)
+	if err != nil {
+		return nil, err
+	}
+
+	numCollected, numPending, numDropped := 0, 0, 0
+
+	for _, b := range batches {
+		oa, err := models.GetOrgAssets(ctx, rt, b.OrgID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading org assets: %w", err)
+		}
+
+		// if the LLM has been removed, there's no way to collect the batch
+		llm := oa.LLMByID(b.LLMID)
+		if llm == nil {
+			if err := models.DeleteLLMBatch(ctx, rt, b.ID); err != nil {
+				return nil, err
+			}
+			numDropped++
+			continue
+		}
+
+		svc, err := llm.AsService(rt, rt.HTTP.Services)
+		if err != nil {
+			return nil, fmt.Errorf("error creating LLM service: %w", err)
+		}
+
+		// errors polling the provider are logged and the batch tried again next time
+		results, err := svc.(ai.BatchService).CollectBatch(ctx, b.ID)
+		if err != nil {
+			slog.Error("error collecting llm batch", "batch", b.ID, "llm", llm.UUID(), "error", err)
+			numPending++
+			continue
+		}
+		if results == nil {
+			numPending++
+			continue
+		}
+
+		if err := llm.RecordBatch(ctx, rt, oa, results); err != nil {
+			slog.Error("error recording llm batch", "batch", b.ID, "llm", llm.UUID(), "error", err)
+		}
+
+		if err := tasks.QueueBatchResults(ctx, rt, b, results); err != nil {
+			return nil, fmt.Errorf("error queuing results of llm batch %s: %w", b.ID, err)
+		}
+		if err := models.DeleteLLMBatch(ctx, rt, b.ID); err != nil {
+			return nil, err
+		}
+		numCollected++
+	}
+
+	return map[string]any{"collected": numCollected, "pending": numPending, "dropped": numDropped}, nil
+}
@@ -0,0 +1,56 @@
+package crons_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/crons"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectLLMBatches(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData|testsuite.ResetValkey)
+
+	cron := &crons.CollectLLMBatchesCron{}
+
+	// nothing pending so nothing to do
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"collected": 0, "pending": 0, "dropped": 0}, res)
+
+	// the test LLM doesn't support batches so its batch stays pending
+	require.NoError(t, models.InsertLLMBatch(ctx, rt, &models.LLMBatch{
+		ID:        "batch_123",
+		OrgID:     testdb.Org1.ID,
+		LLMID:     testdb.TestLLM.ID,
+		TaskType:  "categorize_contacts_batch",
+		Task:      json.RawMessage(`{}`),
+		CreatedOn: time.Now(),
+	}))
+
+	// a batch of an LLM which no longer exists is dropped
+	require.NoError(t, models.InsertLLMBatch(ctx, rt, &models.LLMBatch{
+		ID:        "batch_456",
+		OrgID:     testdb.Org1.ID,
+		LLMID:     123456,
+		TaskType:  "categorize_contacts_batch",
+		Task:      json.RawMessage(`{}`),
+		CreatedOn: time.Now(),
+	}))
+
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"collected": 0, "pending": 1, "dropped": 1}, res)
+
+	batches, err := models.GetLLMBatches(ctx, rt)
+	assert.NoError(t, err)
+	assert.Len(t, batches, 1)
+	assert.Equal(t, "batch_123", batches[0].ID)
+}
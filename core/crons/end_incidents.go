@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
 	valkey "github.com/gomodule/redigo/redis"
@@ -28,7 +29,9 @@ func (c *EndIncidentsCron) AllInstances() bool {
 
 // EndIncidents checks open incidents and end any that no longer apply
 func (c *EndIncidentsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[string]any, error) {
-	incidents, err := models.GetOpenIncidents(ctx, rt.DB, []models.IncidentType{models.IncidentTypeWebhooksUnhealthy})
+	types := append([]models.IncidentType{models.IncidentTypeWebhooksUnhealthy}, models.LLMIncidentTypes...)
+
+	incidents, err := models.GetOpenIncidents(ctx, rt.DB, types)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching open incidents: %w", err)
 	}
@@ -44,6 +47,14 @@ func (c *EndIncidentsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[st
 			if ended {
 				numEnded++
 			}
+		} else if slices.Contains(models.LLMIncidentTypes, incident.Type) {
+			ended, err := c.checkLLMIncident(ctx, rt, incident)
+			if err != nil {
+				return nil, fmt.Errorf("error checking llm incident #%d: %w", incident.ID, err)
+			}
+			if ended {
+				numEnded++
+			}
 		}
 	}
 
@@ -92,6 +103,35 @@ func (c *EndIncidentsCron) checkWebhookIncident(ctx context.Context, rt *runtime
 	return false, nil
 }
 
+func (c *EndIncidentsCron) checkLLMIncident(ctx context.Context, rt *runtime.Runtime, incident *models.Incident) (bool, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, incident.OrgID)
+	if err != nil {
+		return false, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	ongoing, err := models.LLMIncidentOngoing(ctx, rt, oa, incident)
+	if err != nil {
+		return false, fmt.Errorf("error checking llm problem: %w", err)
+	}
+
+	log := slog.With("incident_id", incident.ID, "type", incident.Type, "scope", incident.Scope)
+
+	if !ongoing {
+		if err := incident.End(ctx, rt.DB); err != nil {
+			return false, fmt.Errorf("error ending incident: %w", err)
+		}
+		if err := models.QueueIncidentWebhook(ctx, rt, oa, incident); err != nil {
+			return false, fmt.Errorf("error queueing incident webhook: %w", err)
+		}
+
+		log.Info("ended llm incident")
+		return true, nil
+	}
+
+	log.Debug("checked llm incident")
+	return false, nil
+}
+
 func (c *EndIncidentsCron) getWebhookIncidentNodes(rt *runtime.Runtime, incident *models.Incident) ([]flows.NodeUUID, error) {
 	vc := rt.VK.Get()
 	defer vc.Close()
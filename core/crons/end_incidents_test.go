@@ -65,3 +65,45 @@ func TestEndIncidents(t *testing.T) {
 	assertvk.SMembers(t, vc, fmt.Sprintf("incident:%d:nodes", id1), []string{"3c703019-8c92-4d28-9be0-a926a934486b"})
 	assertvk.SMembers(t, vc, fmt.Sprintf("incident:%d:nodes", id2), []string{}) // healthy node removed
 }
+
+func TestEndLLMIncidents(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData|testsuite.ResetValkey)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	// credentials of the test LLM verify fine so its incident will end
+	id1, err := models.IncidentLLM(ctx, rt, oa, models.IncidentTypeLLMCredentials, testdb.TestLLM.UUID)
+	require.NoError(t, err)
+
+	// breaker of the OpenAI LLM is still tripped so its incident won't end
+	_, err = vc.Do("SET", fmt.Sprintf("llm_breaker:%s:failures", testdb.OpenAI.UUID), 5)
+	require.NoError(t, err)
+
+	id2, err := models.IncidentLLM(ctx, rt, oa, models.IncidentTypeLLMUnavailable, testdb.OpenAI.UUID)
+	require.NoError(t, err)
+
+	// org doesn't have a budget so its budget incident will end
+	id3, err := models.IncidentLLM(ctx, rt, oa, models.IncidentTypeLLMBudgetExceeded, "")
+	require.NoError(t, err)
+
+	cron := &crons.EndIncidentsCron{}
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"ended": 2}, res)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_incident WHERE id = $1 AND ended_on IS NOT NULL`, id1).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_incident WHERE id = $1 AND ended_on IS NULL`, id2).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_incident WHERE id = $1 AND ended_on IS NOT NULL`, id3).Returns(1)
+
+	// once the breaker has been reset by a successful call, the incident ends too
+	_, err = vc.Do("DEL", fmt.Sprintf("llm_breaker:%s:failures", testdb.OpenAI.UUID))
+	require.NoError(t, err)
+
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"ended": 1}, res)
+}
@@ -0,0 +1,65 @@
+package crons
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+const (
+	sentimentBatchSize     = 50  // number of messages scored by a single LLM call
+	sentimentMaxBatchesOrg = 100 // maximum number of batches queued for an org per run so one org can't hog the cron
+)
+
+func init() {
+	Register("score_sentiment", &ScoreSentimentCron{})
+}
+
+// ScoreSentimentCron batches up incoming messages queued for sentiment scoring and queues tasks to score them
+type ScoreSentimentCron struct{}
+
+func (c *ScoreSentimentCron) Next(last time.Time) time.Time {
+	return Next(last, time.Second*10)
+}
+
+func (c *ScoreSentimentCron) AllInstances() bool {
+	return false
+}
+
+func (c *ScoreSentimentCron) Run(ctx context.Context, rt *runtime.Runtime) (map[string]any, error) {
+	orgIDs, err := models.GetSentimentOrgs(ctx, rt)
+	if err != nil {
+		return nil, err
+	}
+
+	numBatches, numMsgs := 0, 0
+
+	for _, orgID := range orgIDs {
+		for range sentimentMaxBatchesOrg {
+			msgs, err := models.PopSentimentMsgs(ctx, rt, orgID, sentimentBatchSize)
+			if err != nil {
+				return nil, err
+			}
+			if len(msgs) == 0 {
+				break
+			}
+
+			if err := tasks.Queue(ctx, rt, rt.Queues.AI, orgID, &tasks.ScoreSentiment{Msgs: msgs}, false); err != nil {
+				return nil, fmt.Errorf("error queuing sentiment task for org #%d: %w", orgID, err)
+			}
+
+			numBatches++
+			numMsgs += len(msgs)
+
+			if len(msgs) < sentimentBatchSize {
+				break
+			}
+		}
+	}
+
+	return map[string]any{"batches": numBatches, "msgs": numMsgs}, nil
+}
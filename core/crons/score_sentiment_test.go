@@ -0,0 +1,71 @@
+package crons_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/v26/core/crons"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/nyaruka/vkutil/assertvk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreSentiment(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData|testsuite.ResetValkey)
+
+	rt.DB.MustExec(`UPDATE ai_llm SET config = config || '{"score_sentiment": true, "sentiment_field": "gender"}'::jsonb WHERE id = $1`, testdb.TestLLM.ID)
+	models.FlushCache()
+
+	cron := &crons.ScoreSentimentCron{}
+
+	// nothing queued so nothing to do
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"batches": 0, "msgs": 0}, res)
+
+	for _, m := range []*models.SentimentMsg{{ContactID: testdb.Ann.ID, Text: "I love it"}, {ContactID: testdb.Bob.ID, Text: "This is terrible"}, {ContactID: testdb.Ann.ID, Text: "Thanks"}} {
+		require.NoError(t, models.QueueSentimentMsg(ctx, rt, testdb.Org1.ID, m))
+	}
+	require.NoError(t, models.QueueSentimentMsg(ctx, rt, testdb.Org2.ID, &models.SentimentMsg{ContactID: testdb.Org2Contact.ID, Text: "Help!"}))
+
+	assertvk.SMembers(t, vc, "llm_sentiment:orgs", []string{"1", "2"})
+	assertvk.LLen(t, vc, "llm_sentiment:1", 3)
+
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"batches": 2, "msgs": 4}, res)
+
+	// queues and set of orgs are emptied
+	assertvk.SMembers(t, vc, "llm_sentiment:orgs", []string{})
+	assertvk.LLen(t, vc, "llm_sentiment:1", 0)
+
+	var task1 *tasks.ScoreSentiment
+	for range 2 {
+		task, err := rt.Queues.AI.Pop(ctx, vc)
+		require.NoError(t, err)
+		assert.Equal(t, "score_sentiment", task.Type)
+
+		if task.OwnerID == int(testdb.Org1.ID) {
+			task1 = &tasks.ScoreSentiment{}
+			jsonx.MustUnmarshal(task.Task, task1)
+		}
+	}
+	require.NotNil(t, task1)
+	assert.Equal(t, []*models.SentimentMsg{{ContactID: testdb.Ann.ID, Text: "I love it"}, {ContactID: testdb.Bob.ID, Text: "This is terrible"}, {ContactID: testdb.Ann.ID, Text: "Thanks"}}, task1.Msgs)
+
+	// test LLM doesn't return scores so batch is dropped but usage is still recorded
+	oa := testdb.Org1.Load(t, rt)
+	require.NoError(t, task1.Perform(ctx, rt, oa))
+
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'calls'`, testdb.TestLLM.ID).Returns(int64(1))
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contact WHERE id IN ($1, $2) AND fields->>$3 IS NOT NULL`, testdb.Ann.ID, testdb.Bob.ID, testdb.GenderField.UUID).Returns(0)
+}
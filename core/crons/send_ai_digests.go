@@ -0,0 +1,42 @@
+package crons
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+func init() {
+	Register("send_ai_digests", &SendAIDigestsCron{})
+}
+
+// SendAIDigestsCron queues tasks to send the daily AI digests of orgs for which it's the hour they're sent at
+type SendAIDigestsCron struct{}
+
+func (c *SendAIDigestsCron) Next(last time.Time) time.Time {
+	// run at the start of every hour
+	return last.Truncate(time.Hour).Add(time.Hour)
+}
+
+func (c *SendAIDigestsCron) AllInstances() bool {
+	return false
+}
+
+func (c *SendAIDigestsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[string]any, error) {
+	orgIDs, err := models.GetAIDigestOrgs(ctx, rt.DB.DB, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, orgID := range orgIDs {
+		if err := tasks.Queue(ctx, rt, rt.Queues.AI, orgID, &tasks.SendAIDigest{}, false); err != nil {
+			return nil, fmt.Errorf("error queuing AI digest task for org #%d: %w", orgID, err)
+		}
+	}
+
+	return map[string]any{"queued": len(orgIDs)}, nil
+}
@@ -0,0 +1,37 @@
+package crons
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// how long records of LLM calls are kept for debugging
+const llmCallRetention = 7 * 24 * time.Hour
+
+func init() {
+	Register("trim_llm_calls", &TrimLLMCallsCron{})
+}
+
+// TrimLLMCallsCron deletes records of LLM calls older than our retention period
+type TrimLLMCallsCron struct{}
+
+func (c *TrimLLMCallsCron) Next(last time.Time) time.Time {
+	return Next(last, time.Hour)
+}
+
+func (c *TrimLLMCallsCron) AllInstances() bool {
+	return false
+}
+
+func (c *TrimLLMCallsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[string]any, error) {
+	deleted, err := models.DeleteLLMCallsBefore(ctx, rt.DB, time.Now().Add(-llmCallRetention))
+	if err != nil {
+		return nil, fmt.Errorf("error trimming llm calls: %w", err)
+	}
+
+	return map[string]any{"deleted": deleted}, nil
+}
@@ -0,0 +1,305 @@
+package ivr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/gorilla/websocket"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/goflow/flows/routers/waits/hints"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/runner"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+const (
+	agentInstructionsKey = "ivr_agent:%s:instructions" // instructions of the agent a call has been handed to
+	agentOutcomeKey      = "ivr_agent:%s:outcome"      // outcome of the agent for the call to be resumed with
+	agentKeyTTL          = time.Hour
+
+	agentMaxDuration = 30 * time.Minute // longest that an agent can talk to a caller
+	agentEndTimeout  = 30 * time.Second // how long we wait for the agent's last words to be played once it has ended
+	agentEndMark     = "agent_ended"
+)
+
+// MediaStream is a stream of the audio of a call with a telephony provider, in both directions as 8kHz G.711 μ-law
+type MediaStream interface {
+	// Start waits for the stream to start and returns the UUID of the call it's for
+	Start() (flows.CallUUID, error)
+
+	// Read returns the next audio from the caller, or the name of a mark once the audio written before it has been
+	// played, or io.EOF once the stream has stopped
+	Read() ([]byte, string, error)
+
+	WriteAudio(audio []byte) error
+	WriteMark(name string) error
+	Clear() error
+	Close() error
+}
+
+// AgentService is implemented by IVR services which can hand calls to a realtime voice agent by streaming their audio
+type AgentService interface {
+	// WriteAgentResponse writes a response which connects the call to the given stream URL, passing it the call UUID,
+	// and resumes the call using the given resume URL once the stream ends
+	WriteAgentResponse(w http.ResponseWriter, streamURL string, callUUID flows.CallUUID, resumeURL string) error
+
+	// NewMediaStream creates a media stream from a websocket connection made by the provider to the stream URL
+	NewMediaStream(conn *websocket.Conn) MediaStream
+}
+
+// AgentResume is our type for resumes as consequences of voice agents ending their conversations with callers
+type AgentResume struct{}
+
+// Type returns the type for AgentResume
+func (r AgentResume) Type() ResumeType {
+	return AgentResumeType
+}
+
+// AgentOutcome is what a voice agent found out in its conversation with a caller, which the call is resumed with as
+// JSON input so that flows can parse it
+type AgentOutcome struct {
+	Transcript string            `json:"transcript"`
+	Results    map[string]string `json:"results"`
+}
+
+// HandOffToAgent hands the call to the org's voice agent if it has one, the service supports it, and the flow is
+// waiting for a recording, in which case the text of the prompts before the wait become the instructions of the agent,
+// who talks to the caller in their place until it ends the conversation. Returns whether the call was handed off, in
+// which case the response has been written.
+func HandOffToAgent(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, svc Service, channel *models.Channel, scene *runner.Scene, resumeURL string, w http.ResponseWriter) (bool, error) {
+	llm := oa.VoiceAgentLLM()
+	asvc, ok := svc.(AgentService)
+	if llm == nil || !ok || scene.Sprint == nil || scene.DBCall == nil {
+		return false, nil
+	}
+
+	var prompts []string
+	waitsForAudio := false
+
+	for _, e := range scene.Sprint.Events() {
+		switch event := e.(type) {
+		case *events.IVRCreated:
+			if text := strings.TrimSpace(event.Msg.Text()); text != "" {
+				prompts = append(prompts, text)
+			}
+		case *events.MsgWait:
+			_, waitsForAudio = event.Hint.(*hints.Audio)
+		}
+	}
+
+	if !waitsForAudio || len(prompts) == 0 {
+		return false, nil
+	}
+
+	callUUID := scene.DBCall.UUID()
+
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	if _, err := valkey.DoContext(vc, ctx, "SET", fmt.Sprintf(agentInstructionsKey, callUUID), strings.Join(prompts, "\n"), "EX", int(agentKeyTTL/time.Second)); err != nil {
+		return false, fmt.Errorf("error storing agent instructions: %w", err)
+	}
+
+	domain := channel.Config().GetString(models.ChannelConfigCallbackDomain, rt.Config.Domain)
+	streamURL := fmt.Sprintf("wss://%s/mr/ivr/c/%s/agent", domain, channel.UUID())
+
+	if err := asvc.WriteAgentResponse(w, streamURL, callUUID, resumeURL); err != nil {
+		return false, fmt.Errorf("error writing agent response: %w", err)
+	}
+	return true, nil
+}
+
+// RunAgent bridges the given media stream of a call, which has been handed off to the org's voice agent, to a realtime
+// session with that agent until either ends, and stores the outcome for the call to be resumed with
+func RunAgent(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, channel *models.Channel, stream MediaStream) error {
+	callUUID, err := stream.Start()
+	if err != nil {
+		return fmt.Errorf("error starting media stream: %w", err)
+	}
+
+	call, err := models.GetCallByUUID(ctx, rt.DB, oa.OrgID(), callUUID)
+	if err != nil {
+		return fmt.Errorf("unable to load call with UUID %s: %w", callUUID, err)
+	}
+	if call.ChannelID() != channel.ID() {
+		return fmt.Errorf("call %s isn't on channel %s", callUUID, channel.UUID())
+	}
+
+	vc := rt.VK.Get()
+	instructions, err := valkey.String(valkey.DoContext(vc, ctx, "GET", fmt.Sprintf(agentInstructionsKey, callUUID)))
+	vc.Close()
+	if err == valkey.ErrNil {
+		return fmt.Errorf("call %s hasn't been handed to an agent", callUUID)
+	} else if err != nil {
+		return fmt.Errorf("error getting agent instructions: %w", err)
+	}
+
+	llm := oa.VoiceAgentLLM()
+	if llm == nil {
+		return errors.New("org has no voice agent LLM")
+	}
+
+	fsvc, err := llm.AsService(rt, rt.HTTP.Services)
+	if err != nil {
+		return fmt.Errorf("error creating LLM service for voice agent: %w", err)
+	}
+	rsvc, ok := fsvc.(ai.RealtimeService)
+	if !ok {
+		return errors.New("LLM service doesn't support realtime sessions")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, agentMaxDuration)
+	defer cancel()
+
+	start := time.Now()
+
+	session, err := rsvc.Realtime(ctx, &ai.RealtimeConfig{Instructions: instructions, Voice: llm.AgentVoice()})
+	if err != nil {
+		return fmt.Errorf("error starting realtime session: %w", err)
+	}
+
+	outcome, usage, err := bridgeAgent(ctx, session, stream)
+
+	// the session context may have expired so record usage and store the outcome in a fresh one
+	recCtx, recCancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer recCancel()
+
+	if rerr := llm.RecordStandaloneCall(recCtx, rt, oa, instructions, "", usage, time.Since(start), err != nil); rerr != nil {
+		slog.Error("error recording llm call", "error", rerr, "llm_id", llm.ID())
+	}
+
+	outcomeJSON, _ := json.Marshal(outcome)
+
+	vc = rt.VK.Get()
+	defer vc.Close()
+
+	if _, serr := valkey.DoContext(vc, recCtx, "SET", fmt.Sprintf(agentOutcomeKey, callUUID), outcomeJSON, "EX", int(agentKeyTTL/time.Second)); serr != nil {
+		return fmt.Errorf("error storing agent outcome: %w", serr)
+	}
+
+	return err
+}
+
+// relays audio between the stream and the session until the caller hangs up, the agent ends the conversation and its
+// last words have been played, or either fails
+func bridgeAgent(ctx context.Context, session ai.RealtimeSession, stream MediaStream) (*AgentOutcome, *flows.LLMResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	outcome := &AgentOutcome{Results: map[string]string{}}
+	usage := &flows.LLMResponse{}
+	var transcript strings.Builder
+
+	callerDone := make(chan error, 1)
+	go func() {
+		for {
+			audio, mark, err := stream.Read()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					err = nil
+				}
+				callerDone <- err
+				return
+			}
+			if mark == agentEndMark {
+				callerDone <- nil
+				return
+			}
+			if len(audio) > 0 {
+				if err := session.SendAudio(ctx, audio); err != nil {
+					callerDone <- err
+					return
+				}
+			}
+		}
+	}()
+
+	// only this goroutine writes to the stream, outcome and usage until it's done
+	agentDone := make(chan error, 1)
+	go func() {
+		for {
+			evt, err := session.Receive(ctx)
+			if err != nil {
+				agentDone <- err
+				return
+			}
+
+			switch evt.Type {
+			case ai.RealtimeEventAudio:
+				err = stream.WriteAudio(evt.Audio)
+			case ai.RealtimeEventInterrupted:
+				err = stream.Clear()
+			case ai.RealtimeEventTranscript:
+				if evt.Text != "" {
+					speaker := "Caller"
+					if evt.Speaker == ai.RealtimeSpeakerAgent {
+						speaker = "Agent"
+					}
+					fmt.Fprintf(&transcript, "%s: %s\n", speaker, evt.Text)
+				}
+			case ai.RealtimeEventUsage:
+				usage.TokensInput += evt.TokensInput
+				usage.TokensOutput += evt.TokensOutput
+			case ai.RealtimeEventEnded:
+				for k, v := range evt.Results {
+					outcome.Results[k] = v
+				}
+				agentDone <- stream.WriteMark(agentEndMark)
+				return
+			}
+
+			if err != nil {
+				agentDone <- err
+				return
+			}
+		}
+	}()
+
+	var err error
+
+	select {
+	case err = <-callerDone:
+		// caller hung up or the stream failed so stop the agent
+		session.Close()
+		<-agentDone
+
+	case err = <-agentDone:
+		// agent ended or failed so if it ended, wait for its last words to be played before ending the stream
+		if err == nil {
+			select {
+			case err = <-callerDone:
+			case <-time.After(agentEndTimeout):
+			}
+		}
+		session.Close()
+	}
+
+	stream.Close()
+
+	outcome.Transcript = strings.TrimSpace(transcript.String())
+	usage.Output = outcome.Transcript
+
+	return outcome, usage, err
+}
+
+// gets and removes the outcome of the agent a call was handed to as JSON, or empty if there isn't one
+func popAgentOutcome(ctx context.Context, rt *runtime.Runtime, callUUID flows.CallUUID) (string, error) {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	outcome, err := valkey.String(valkey.DoContext(vc, ctx, "GETDEL", fmt.Sprintf(agentOutcomeKey, callUUID)))
+	if err != nil && err != valkey.ErrNil {
+		return "", fmt.Errorf("error getting agent outcome: %w", err)
+	}
+	return outcome, nil
+}
@@ -289,6 +289,14 @@ func StartCall(
 		return fmt.Errorf("error committing scene: %w", err)
 	}
 
+	if handed, err := HandOffToAgent(ctx, rt, oa, svc, channel, scene, resumeURL, w); err != nil {
+		return fmt.Errorf("error handing call to agent: %w", err)
+	} else if handed {
+		return nil
+	}
+
+	synthesizeSpeech(ctx, rt, oa, scene)
+
 	// have our service output our session status
 	if err := svc.WriteSessionResponse(ctx, rt, oa, channel, scene, urn, resumeURL, r, w); err != nil {
 		return fmt.Errorf("error writing ivr response for start: %w", err)
@@ -387,6 +395,15 @@ func ResumeCall(
 		resume, svcErr, err = buildDialResume(res)
 		resumeEvent = resume.Event()
 
+	case AgentResume:
+		var input string
+		if input, err = popAgentOutcome(ctx, rt, call.UUID()); err == nil {
+			msg, resume, svcErr, err = buildMsgResume(ctx, rt, oa, svc, channel, urn, call, flow.(*models.Flow), InputResume{Input: input})
+			if msg != nil {
+				resumeEvent = resume.Event()
+			}
+		}
+
 	default:
 		return fmt.Errorf("unknown resume type: %vvv", ivrResume)
 	}
@@ -428,6 +445,14 @@ func ResumeCall(
 
 	// if still active, write out our response
 	if status == models.CallStatusInProgress {
+		if handed, err := HandOffToAgent(ctx, rt, oa, svc, channel, scene, resumeURL, w); err != nil {
+			return fmt.Errorf("error handing call to agent: %w", err)
+		} else if handed {
+			return nil
+		}
+
+		synthesizeSpeech(ctx, rt, oa, scene)
+
 		if err = svc.WriteSessionResponse(ctx, rt, oa, channel, scene, urn, resumeURL, r, w); err != nil {
 			return fmt.Errorf("error writing ivr response for resume: %w", err)
 		}
@@ -23,6 +23,7 @@ const (
 	InputResumeType   = ResumeType("input")
 	DialResumeType    = ResumeType("dial")
 	TimeoutResumeType = ResumeType("timeout")
+	AgentResumeType   = ResumeType("agent")
 )
 
 // Resume is our interface for a type of IVR resume
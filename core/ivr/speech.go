@@ -0,0 +1,82 @@
+package ivr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/runner"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// if the org has an LLM for speech, replaces the text of IVR prompts in the scene's sprint with synthesized audio so
+// that IVR services play that instead of using the telephony provider's own text to speech. Any failure falls back to
+// the text so that the call can continue.
+func synthesizeSpeech(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, scene *runner.Scene) {
+	llm := oa.SpeechLLM()
+	if llm == nil || rt.S3 == nil || scene.Sprint == nil {
+		return
+	}
+
+	var svc ai.SpeechService
+
+	for _, e := range scene.Sprint.Events() {
+		event, ok := e.(*events.IVRCreated)
+		if !ok || len(event.Msg.Attachments()) > 0 || event.Msg.Text() == "" {
+			continue
+		}
+
+		if svc == nil {
+			fsvc, err := llm.AsService(rt, rt.HTTP.Services)
+			if err != nil {
+				slog.Error("error creating LLM service for speech", "llm", llm.UUID(), "error", err)
+				return
+			}
+			if svc, ok = fsvc.(ai.SpeechService); !ok {
+				return
+			}
+		}
+
+		url, err := speechURL(ctx, rt, oa, svc, event.Msg.Text(), llm.SpeechVoice(), event.Msg.Locale())
+		if err != nil {
+			slog.Error("error synthesizing speech for IVR prompt", "llm", llm.UUID(), "error", err)
+			continue
+		}
+
+		msg := event.Msg
+		event.Msg = flows.NewIVRMsgOut(msg.URN(), msg.Channel(), msg.Text(), url, msg.Locale())
+	}
+}
+
+// gets the URL of synthesized speech for the given text, voice and locale, which is stored so that identical prompts
+// are only synthesized once
+func speechURL(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, svc ai.SpeechService, text, voice string, locale i18n.Locale) (string, error) {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s", voice, locale, text)))
+	key := fmt.Sprintf("speech/%d/%s.mp3", oa.OrgID(), hex.EncodeToString(hash[:]))
+	bucket := rt.Config.S3AttachmentsBucket
+
+	if _, err := rt.S3.Client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}); err == nil {
+		return rt.S3.ObjectURL(bucket, key), nil
+	}
+
+	audio, contentType, err := svc.Synthesize(ctx, text, voice)
+	if err != nil {
+		return "", err
+	}
+
+	url, err := rt.S3.PutObject(ctx, bucket, key, contentType, audio, types.ObjectCannedACLPublicRead)
+	if err != nil {
+		return "", fmt.Errorf("error storing synthesized speech: %w", err)
+	}
+	return url, nil
+}
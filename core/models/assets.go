@@ -596,6 +596,10 @@ func (a *OrgAssets) loadFlow(fromCache func() assets.Flow, fromDB func(context.C
 		return nil, ErrNotFound
 	}
 
+	if err := dbFlow.resolveLLMs(a); err != nil {
+		return nil, fmt.Errorf("error resolving LLMs of flow: %w", err)
+	}
+
 	a.flowCacheLock.Lock()
 	a.flowByID[dbFlow.ID()] = dbFlow
 	a.flowByUUID[dbFlow.UUID()] = dbFlow
@@ -632,6 +636,104 @@ func (a *OrgAssets) LLMByID(id LLMID) *LLM {
 	return a.llmsByID[id]
 }
 
+func (a *OrgAssets) LLMByUUID(uuid assets.LLMUUID) *LLM {
+	for _, l := range a.llms {
+		if llm := l.(*LLM); llm.UUID() == uuid {
+			return llm
+		}
+	}
+	return nil
+}
+
+// DefaultLLM returns the LLM used by AI actions in flows which don't reference one which exists, if the org has one
+func (a *OrgAssets) DefaultLLM() *LLM {
+	if uuid := a.org.DefaultLLM(); uuid != "" {
+		return a.LLMByUUID(uuid)
+	}
+	return nil
+}
+
+// ResolveLLM returns the LLM with the given UUID, or the default LLM if the UUID is empty or the LLM no longer exists
+func (a *OrgAssets) ResolveLLM(uuid assets.LLMUUID) *LLM {
+	if uuid != "" {
+		if llm := a.LLMByUUID(uuid); llm != nil {
+			return llm
+		}
+	}
+	return a.DefaultLLM()
+}
+
+// TranscriptionLLM returns the LLM which transcribes audio attachments of incoming messages, if there is one
+func (a *OrgAssets) TranscriptionLLM() *LLM {
+	for _, l := range a.llms {
+		if llm := l.(*LLM); llm.TranscribesAudio() {
+			return llm
+		}
+	}
+	return nil
+}
+
+// TranslationLLM returns the LLM which translates flow messages which have no translation in the contact's language, if
+// there is one
+func (a *OrgAssets) TranslationLLM() *LLM {
+	for _, l := range a.llms {
+		if llm := l.(*LLM); llm.TranslatesMessages() {
+			return llm
+		}
+	}
+	return nil
+}
+
+// LanguageDetectionLLM returns the LLM which detects the language of contacts from their messages, if there is one
+func (a *OrgAssets) LanguageDetectionLLM() *LLM {
+	for _, l := range a.llms {
+		if llm := l.(*LLM); llm.DetectsLanguage() {
+			return llm
+		}
+	}
+	return nil
+}
+
+// SentimentLLM returns the LLM which scores the sentiment of incoming messages, if there is one
+func (a *OrgAssets) SentimentLLM() *LLM {
+	for _, l := range a.llms {
+		if llm := l.(*LLM); llm.ScoresSentiment() {
+			return llm
+		}
+	}
+	return nil
+}
+
+// SpamLLM returns the LLM which screens unsolicited incoming messages for spam and abuse, if there is one
+func (a *OrgAssets) SpamLLM() *LLM {
+	for _, l := range a.llms {
+		if llm := l.(*LLM); llm.ScreensSpam() {
+			return llm
+		}
+	}
+	return nil
+}
+
+// SpeechLLM returns the LLM which synthesizes IVR prompts, if there is one
+func (a *OrgAssets) SpeechLLM() *LLM {
+	for _, l := range a.llms {
+		if llm := l.(*LLM); llm.SpeechVoice() != "" {
+			return llm
+		}
+	}
+	return nil
+}
+
+// VoiceAgentLLM returns the LLM which IVR calls are handed to as a realtime agent, if there is one
+func (a *OrgAssets) VoiceAgentLLM() *LLM {
+	for _, l := range a.llms {
+		if llm := l.(*LLM); llm.AgentVoice() != "" {
+			return llm
+		}
+	}
+	return nil
+}
+
 func (a *OrgAssets) Triggers() []*Trigger {
 	return a.triggers
 }
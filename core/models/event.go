@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/nyaruka/gocommon/aws/dynamo"
@@ -61,8 +62,12 @@ var eventPersistence = map[string]time.Duration{
 	events.TypeTicketOpened:           eternity,
 	events.TypeTicketReopened:         eternity,
 	events.TypeTicketTopicChanged:     eternity,
+	events.TypeWarning:                eternity, // (additional filtering on text below)
 }
 
+// MachineTranslatedWarning is the prefix of warnings which mark flow messages as machine translated
+const MachineTranslatedWarning = "message machine translated"
+
 // PersistEvent returns whether an event should be persisted
 func PersistEvent(e flows.Event) bool {
 	switch typed := e.(type) {
@@ -70,6 +75,9 @@ func PersistEvent(e flows.Event) bool {
 		// Only persist non-import URN taken errors for now - this is to help with flows that still use actions for
 		// adding URNs that have no way to route on failure
 		return typed.Code == events.ErrorCodeURNTaken && typed.Via_ != string(ViaImport)
+	case *events.Warning:
+		// Only persist warnings that messages were machine translated so that it's clear in the contact's history
+		return strings.HasPrefix(typed.Text, MachineTranslatedWarning)
 	default:
 		_, ok := eventPersistence[e.Type()]
 		return ok
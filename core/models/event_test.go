@@ -25,6 +25,7 @@ func TestPersistEvent(t *testing.T) {
 	assert.True(t, models.PersistEvent(events.NewError("URN taken by another contact", events.ErrorCodeURNTaken)))
 	assert.False(t, models.PersistEvent(events.NewError("Bang", "bang")))
 	assert.False(t, models.PersistEvent(events.NewWarning("Don't do that")))
+	assert.True(t, models.PersistEvent(events.NewWarning("message machine translated from eng to spa by GPT-4")))
 
 	e := events.NewError("URN taken by another contact", events.ErrorCodeURNTaken)
 	e.SetUser(nil, string(models.ViaImport))
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"database/sql/driver"
@@ -99,6 +100,50 @@ func (f *Flow) Reference() *assets.FlowReference {
 	return assets.NewFlowReference(f.UUID(), f.Name())
 }
 
+// replaces the LLMs of call_llm actions which don't reference an LLM which exists with the org's default LLM, so that
+// providers can be swapped without editing every flow
+func (f *Flow) resolveLLMs(oa *OrgAssets) error {
+	def := oa.DefaultLLM()
+	if def == nil || !bytes.Contains(f.f.Definition, []byte(`"call_llm"`)) {
+		return nil
+	}
+
+	var definition map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(f.f.Definition))
+	decoder.UseNumber()
+	if err := decoder.Decode(&definition); err != nil {
+		return err
+	}
+
+	resolved := false
+	nodes, _ := definition["nodes"].([]any)
+	for _, n := range nodes {
+		node, _ := n.(map[string]any)
+		actions, _ := node["actions"].([]any)
+		for _, a := range actions {
+			action, _ := a.(map[string]any)
+			if action == nil || action["type"] != "call_llm" {
+				continue
+			}
+			ref, _ := action["llm"].(map[string]any)
+			uuid, _ := ref["uuid"].(string)
+			if uuid == "" || oa.LLMByUUID(assets.LLMUUID(uuid)) == nil {
+				action["llm"] = assets.NewLLMReference(def.UUID(), def.Name())
+				resolved = true
+			}
+		}
+	}
+
+	if resolved {
+		b, err := json.Marshal(definition)
+		if err != nil {
+			return err
+		}
+		f.f.Definition = b
+	}
+	return nil
+}
+
 func LoadFlowByUUID(ctx context.Context, db *sql.DB, orgID OrgID, flowUUID assets.FlowUUID) (*Flow, error) {
 	return loadFlow(ctx, db, sqlSelectFlowByUUID, orgID, flowUUID)
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/buger/jsonparser"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/mailroom/v26/core/goflow"
@@ -12,6 +13,7 @@ import (
 	"github.com/nyaruka/mailroom/v26/testsuite"
 	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoadFlows(t *testing.T) {
@@ -123,3 +125,65 @@ func TestLoadFlows(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Nil(t, dbFlow)
 }
+
+func TestFlowDefaultLLM(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	flow := testdb.InsertFlow(t, rt, testdb.Org1, []byte(`{
+		"uuid": "4b4bd1a5-2d34-4d5e-9a3c-5e2f6b7c8d9e",
+		"name": "AI Flow",
+		"spec_version": "13.1.0",
+		"language": "eng",
+		"type": "messaging",
+		"nodes": [
+			{
+				"uuid": "0d1e2f3a-4b5c-4d6e-8f7a-9b0c1d2e3f4a",
+				"actions": [
+					{"uuid": "1e2f3a4b-5c6d-4e7f-8a9b-0c1d2e3f4a5b", "type": "call_llm", "llm": {"uuid": "e5d8900a-ef54-4d2a-8214-ff7d3e903502", "name": "Test"}, "instructions": "Translate", "input": "@input", "output_local": "_llm_output"},
+					{"uuid": "2f3a4b5c-6d7e-4f8a-9b0c-1d2e3f4a5b6c", "type": "call_llm", "llm": {"uuid": "9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d", "name": "Deleted"}, "instructions": "Summarize", "input": "@input", "output_local": "_llm_output"}
+				],
+				"exits": [{"uuid": "3a4b5c6d-7e8f-4a9b-8c1d-2e3f4a5b6c7d"}]
+			}
+		]
+	}`))
+
+	def := testdb.InsertLLM(t, rt, testdb.Org1, "6c5d4e3f-2a1b-4c9d-8e7f-6a5b4c3d2e1f", "test", "claude", "Claude", map[string]any{}, "F")
+
+	definitionLLMs := func(oa *models.OrgAssets) []string {
+		f, err := oa.FlowByID(flow.ID)
+		require.NoError(t, err)
+
+		var uuids []string
+		jsonparser.ArrayEach(f.Definition(), func(action []byte, _ jsonparser.ValueType, _ int, _ error) {
+			uuid, _ := jsonparser.GetString(action, "llm", "uuid")
+			uuids = append(uuids, uuid)
+		}, "nodes", "[0]", "actions")
+		return uuids
+	}
+
+	// without a default LLM, flows are used as is
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg|models.RefreshLLMs|models.RefreshFlows)
+	require.NoError(t, err)
+	assert.Nil(t, oa.DefaultLLM())
+	assert.Nil(t, oa.ResolveLLM("9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"))
+	assert.Equal(t, []string{"e5d8900a-ef54-4d2a-8214-ff7d3e903502", "9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"}, definitionLLMs(oa))
+
+	require.NoError(t, models.SetDefaultLLM(ctx, rt.DB, testdb.Org1.ID, def.UUID))
+
+	// with one, actions referencing LLMs which don't exist use it
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg|models.RefreshFlows)
+	require.NoError(t, err)
+	assert.Equal(t, def.UUID, oa.DefaultLLM().UUID())
+	assert.Equal(t, testdb.TestLLM.UUID, oa.ResolveLLM(testdb.TestLLM.UUID).UUID())
+	assert.Equal(t, def.UUID, oa.ResolveLLM("9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d").UUID())
+	assert.Equal(t, def.UUID, oa.ResolveLLM("").UUID())
+	assert.Equal(t, []string{"e5d8900a-ef54-4d2a-8214-ff7d3e903502", "6c5d4e3f-2a1b-4c9d-8e7f-6a5b4c3d2e1f"}, definitionLLMs(oa))
+
+	require.NoError(t, models.SetDefaultLLM(ctx, rt.DB, testdb.Org1.ID, ""))
+
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+	assert.Nil(t, oa.DefaultLLM())
+}
@@ -20,6 +20,9 @@ const (
 
 	// LogTypeAirtimeTransferred is our type for when we make an airtime transfer
 	LogTypeAirtimeTransferred = "airtime_transferred"
+
+	// LogTypeLLMCalled is our type for when a flow calls an LLM
+	LogTypeLLMCalled = "llm_called"
 )
 
 // HTTPLog is our type for a HTTPLog
@@ -61,6 +64,13 @@ func NewWebhookCalledLog(orgID OrgID, fid FlowID, url string, statusCode int, re
 	return h
 }
 
+// NewLLMCalledLog creates a new HTTP log for a request to an LLM provider by a flow
+func NewLLMCalledLog(orgID OrgID, fid FlowID, url string, statusCode int, request, response string, isError bool, elapsed time.Duration, retries int, createdOn time.Time) *HTTPLog {
+	h := newHTTPLog(orgID, LogTypeLLMCalled, url, statusCode, request, response, isError, elapsed, retries, createdOn)
+	h.FlowID = fid
+	return h
+}
+
 // NewAirtimeTransferredLog creates a new HTTP log for an airtime transfer
 func NewAirtimeTransferredLog(orgID OrgID, url string, statusCode int, request, response string, isError bool, elapsed time.Duration, retries int, createdOn time.Time) *HTTPLog {
 	return newHTTPLog(orgID, LogTypeAirtimeTransferred, url, statusCode, request, response, isError, elapsed, retries, createdOn)
@@ -37,4 +37,11 @@ func TestHTTPLogs(t *testing.T) {
 	assert.Nil(t, err)
 
 	assertdb.Query(t, rt.DB, `SELECT count(*) from request_logs_httplog WHERE org_id = $1 AND status_code = 400 AND flow_id = $2 AND num_retries = 2`, testdb.Org1.ID, testdb.Favorites.ID).Returns(1)
+
+	// insert an LLM log
+	log = models.NewLLMCalledLog(testdb.Org1.ID, testdb.Favorites.ID, "https://api.openai.com/v1/responses", 200, "POST /v1/responses", "HTTP 200", false, time.Second, 0, time.Now())
+	err = models.InsertHTTPLogs(ctx, rt.DB, []*models.HTTPLog{log})
+	assert.Nil(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) from request_logs_httplog WHERE org_id = $1 AND log_type = 'llm_called' AND flow_id = $2`, testdb.Org1.ID, testdb.Favorites.ID).Returns(1)
 }
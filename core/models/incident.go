@@ -1,17 +1,23 @@
 package models
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"time"
 
 	valkey "github.com/gomodule/redigo/redis"
 	"github.com/lib/pq"
 	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/mailroom/v26/core/ai"
 	"github.com/nyaruka/mailroom/v26/runtime"
 	"github.com/nyaruka/null/v3"
 	"github.com/nyaruka/vkutil"
@@ -33,16 +39,22 @@ type IncidentType string
 const (
 	IncidentTypeOrgFlagged        IncidentType = "org:flagged"
 	IncidentTypeWebhooksUnhealthy IncidentType = "webhooks:unhealthy"
+	IncidentTypeLLMCredentials    IncidentType = "llm:credentials"     // provider of an LLM is rejecting its credentials
+	IncidentTypeLLMBudgetExceeded IncidentType = "llm:budget_exceeded" // org has spent its LLM token budget
+	IncidentTypeLLMUnavailable    IncidentType = "llm:unavailable"     // circuit breaker of an LLM is open
 )
 
+// LLMIncidentTypes are the types of incidents for problems with an org's LLMs
+var LLMIncidentTypes = []IncidentType{IncidentTypeLLMCredentials, IncidentTypeLLMBudgetExceeded, IncidentTypeLLMUnavailable}
+
 type Incident struct {
-	ID        IncidentID   `db:"id"`
-	OrgID     OrgID        `db:"org_id"`
-	Type      IncidentType `db:"incident_type"`
-	Scope     string       `db:"scope"`
-	StartedOn time.Time    `db:"started_on"`
-	EndedOn   *time.Time   `db:"ended_on"`
-	ChannelID ChannelID    `db:"channel_id"`
+	ID        IncidentID   `json:"id"         db:"id"`
+	OrgID     OrgID        `json:"org_id"     db:"org_id"`
+	Type      IncidentType `json:"type"       db:"incident_type"`
+	Scope     string       `json:"scope"      db:"scope"`
+	StartedOn time.Time    `json:"started_on" db:"started_on"`
+	EndedOn   *time.Time   `json:"ended_on"   db:"ended_on"`
+	ChannelID ChannelID    `json:"channel_id" db:"channel_id"`
 }
 
 // End ends this incident
@@ -58,7 +70,7 @@ func (i *Incident) End(ctx context.Context, db DBorTx) error {
 
 // IncidentWebhooksUnhealthy ensures there is an open unhealthy webhooks incident for the given org
 func IncidentWebhooksUnhealthy(ctx context.Context, db DBorTx, rp *valkey.Pool, oa *OrgAssets, nodes []flows.NodeUUID) (IncidentID, error) {
-	id, err := getOrCreateIncident(ctx, db, oa, &Incident{
+	id, _, err := getOrCreateIncident(ctx, db, oa, &Incident{
 		OrgID:     oa.OrgID(),
 		Type:      IncidentTypeWebhooksUnhealthy,
 		StartedOn: dates.Now(),
@@ -85,17 +97,180 @@ func IncidentWebhooksUnhealthy(ctx context.Context, db DBorTx, rp *valkey.Pool,
 	return id, nil
 }
 
+// IncidentLLM ensures there is an open incident of the given type for a problem with the org's LLMs, scoped to the LLM
+// with the given UUID if the problem is specific to it, and queues firing of the org's incident webhook if it was started
+func IncidentLLM(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, typ IncidentType, llmUUID assets.LLMUUID) (IncidentID, error) {
+	incident := &Incident{
+		OrgID:     oa.OrgID(),
+		Type:      typ,
+		StartedOn: dates.Now(),
+		Scope:     string(llmUUID),
+	}
+	id, created, err := getOrCreateIncident(ctx, rt.DB, oa, incident)
+	if err != nil {
+		return NilIncidentID, err
+	}
+
+	if created {
+		if err := QueueIncidentWebhook(ctx, rt, oa, incident); err != nil {
+			return NilIncidentID, fmt.Errorf("error queueing incident webhook: %w", err)
+		}
+	}
+
+	return id, nil
+}
+
+// how long after a call starts an LLM incident that other calls which find the same problem skip starting it again
+const llmIncidentDedupe = 5 * time.Minute
+
+// starts an LLM incident from a call which found the problem, logging rather than returning errors so that they don't
+// fail that call. As every call made while the problem persists will find it, only the first in each dedupe period
+// touches the database.
+func startLLMIncident(ctx context.Context, rt *runtime.Runtime, orgID OrgID, typ IncidentType, llmUUID assets.LLMUUID) {
+	// detach from the call's context as it may have been canceled
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 15*time.Second)
+	defer cancel()
+
+	vc := rt.VK.Get()
+	reply, err := valkey.DoContext(vc, ctx, "SET", fmt.Sprintf("llm_incident:%d:%s:%s", orgID, typ, llmUUID), "1", "NX", "EX", int(llmIncidentDedupe/time.Second))
+	vc.Close()
+	if err != nil {
+		slog.Error("error deduping llm incident", "error", err, "org_id", orgID, "type", typ, "llm", llmUUID)
+		return
+	}
+	if reply == nil {
+		return
+	}
+
+	oa, err := GetOrgAssets(ctx, rt, orgID)
+	if err == nil {
+		_, err = IncidentLLM(ctx, rt, oa, typ, llmUUID)
+	}
+	if err != nil {
+		slog.Error("error starting llm incident", "error", err, "org_id", orgID, "type", typ, "llm", llmUUID)
+	}
+}
+
+// LLMIncidentOngoing returns whether the problem of the given LLM incident is ongoing, which for credentials incidents
+// means making a test call to the LLM
+func LLMIncidentOngoing(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, incident *Incident) (bool, error) {
+	if incident.Type == IncidentTypeLLMBudgetExceeded {
+		return LLMBudgetExceeded(ctx, rt, oa.OrgID())
+	}
+
+	// incidents for LLMs which have since been deleted are over
+	llm := oa.LLMByUUID(assets.LLMUUID(incident.Scope))
+	if llm == nil {
+		return false, nil
+	}
+
+	switch incident.Type {
+	case IncidentTypeLLMCredentials:
+		_, err := llm.Verify(ctx, rt, rt.HTTP.Services)
+		return ai.ErrorCode(err) == ai.ErrorCredentials, nil
+	case IncidentTypeLLMUnavailable:
+		return llm.valkeyBreaker(rt).Tripped(ctx)
+	}
+	return false, nil
+}
+
+//	{
+//	  "org_id": 1,
+//	  "status": "started",
+//	  "incident": {
+//	    "id": 123,
+//	    "type": "llm:credentials",
+//	    "scope": "e5d8900a-ef54-4d2a-8214-ff7d3e903502",
+//	    "started_on": "2026-05-04T13:14:30.123456Z",
+//	    "ended_on": null
+//	  }
+//	}
+type incidentWebhookPayload struct {
+	OrgID    OrgID  `json:"org_id"`
+	Status   string `json:"status"`
+	Incident struct {
+		ID        IncidentID   `json:"id"`
+		Type      IncidentType `json:"type"`
+		Scope     string       `json:"scope"`
+		StartedOn time.Time    `json:"started_on"`
+		EndedOn   *time.Time   `json:"ended_on"`
+	} `json:"incident"`
+}
+
+var incidentWebhookQueuer func(context.Context, *runtime.Runtime, *Incident) error
+
+// RegisterIncidentWebhookQueuer registers the function used to queue firing of incident webhooks, which is done by a
+// task so that whatever started or ended the incident isn't held up by the org's webhook
+func RegisterIncidentWebhookQueuer(fn func(context.Context, *runtime.Runtime, *Incident) error) {
+	incidentWebhookQueuer = fn
+}
+
+// QueueIncidentWebhook queues firing of the org's incident webhook for the given incident if it has one
+func QueueIncidentWebhook(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, incident *Incident) error {
+	if oa.Org().IncidentWebhook() == "" || incidentWebhookQueuer == nil {
+		return nil
+	}
+	return incidentWebhookQueuer(ctx, rt, incident)
+}
+
+// FireIncidentWebhook notifies the org's incident webhook, if it has one, that the given incident has started or ended.
+// Failures are logged rather than returned as the incident itself has been recorded.
+func FireIncidentWebhook(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, incident *Incident) {
+	url := oa.Org().IncidentWebhook()
+	if url == "" {
+		return
+	}
+
+	payload := &incidentWebhookPayload{OrgID: incident.OrgID, Status: "started"}
+	if incident.EndedOn != nil {
+		payload.Status = "ended"
+	}
+	payload.Incident.ID = incident.ID
+	payload.Incident.Type = incident.Type
+	payload.Incident.Scope = incident.Scope
+	payload.Incident.StartedOn = incident.StartedOn
+	payload.Incident.EndedOn = incident.EndedOn
+
+	log := slog.With("org_id", incident.OrgID, "incident_id", incident.ID, "status", payload.Status)
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Error("error marshaling incident webhook payload", "error", err)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		log.Error("error creating incident webhook request", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// the URL is user-controlled so is called like any other webhook
+	resp, err := rt.HTTP.Engine.Do(req)
+	if err != nil {
+		log.Error("error calling incident webhook", "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		log.Error("incident webhook returned non-2XX status", "status_code", resp.StatusCode)
+	}
+}
+
 const sqlInsertIncident = `
 INSERT INTO notifications_incident(org_id, incident_type, scope, started_on, channel_id) 
      VALUES($1, $2, $3, $4, $5)
 ON CONFLICT DO NOTHING 
   RETURNING id`
 
-func getOrCreateIncident(ctx context.Context, db DBorTx, oa *OrgAssets, incident *Incident) (IncidentID, error) {
+// gets the open incident like the given one or creates it, returning its ID and whether it was created
+func getOrCreateIncident(ctx context.Context, db DBorTx, oa *OrgAssets, incident *Incident) (IncidentID, bool, error) {
 	var incidentID IncidentID
 	err := db.GetContext(ctx, &incidentID, sqlInsertIncident, incident.OrgID, incident.Type, incident.Scope, incident.StartedOn, incident.ChannelID)
 	if err != nil && err != sql.ErrNoRows {
-		return NilIncidentID, fmt.Errorf("error inserting incident: %w", err)
+		return NilIncidentID, false, fmt.Errorf("error inserting incident: %w", err)
 	}
 
 	// if we got back an id, a new incident was actually created
@@ -103,16 +278,17 @@ func getOrCreateIncident(ctx context.Context, db DBorTx, oa *OrgAssets, incident
 		incident.ID = incidentID
 
 		if err := NotifyIncidentStarted(ctx, db, oa, incident); err != nil {
-			return NilIncidentID, fmt.Errorf("error creating notifications for new incident: %w", err)
-		}
-	} else {
-		err := db.GetContext(ctx, &incidentID, `SELECT id FROM notifications_incident WHERE org_id = $1 AND incident_type = $2 AND scope = $3 AND ended_on IS NULL`, incident.OrgID, incident.Type, incident.Scope)
-		if err != nil {
-			return NilIncidentID, fmt.Errorf("error looking up existing incident: %w", err)
+			return NilIncidentID, false, fmt.Errorf("error creating notifications for new incident: %w", err)
 		}
+		return incidentID, true, nil
+	}
+
+	err = db.GetContext(ctx, &incidentID, `SELECT id FROM notifications_incident WHERE org_id = $1 AND incident_type = $2 AND scope = $3 AND ended_on IS NULL`, incident.OrgID, incident.Type, incident.Scope)
+	if err != nil {
+		return NilIncidentID, false, fmt.Errorf("error looking up existing incident: %w", err)
 	}
 
-	return incidentID, nil
+	return incidentID, false, nil
 }
 
 const sqlSelectOpenIncidents = `
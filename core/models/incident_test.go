@@ -2,6 +2,7 @@ package models_test
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"sort"
 	"testing"
@@ -56,6 +57,89 @@ func TestIncidentWebhooksUnhealthy(t *testing.T) {
 
 }
 
+func TestIncidentLLM(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData|testsuite.ResetValkey)
+
+	mocks := httpx.WithMocks(http.DefaultTransport, map[string][]*httpx.MockResponse{
+		"http://example.com/incidents": {
+			httpx.NewMockResponse(200, nil, []byte(`OK`)),
+			httpx.NewMockResponse(200, nil, []byte(`OK`)),
+			httpx.NewMockResponse(200, nil, []byte(`OK`)),
+			httpx.NewMockResponse(200, nil, []byte(`OK`)),
+		},
+	})
+	rt.HTTP.Engine.Transport = mocks
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = '{"incident_webhook": "http://example.com/incidents"}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	id1, err := models.IncidentLLM(ctx, rt, oa, models.IncidentTypeLLMCredentials, testdb.OpenAI.UUID)
+	require.NoError(t, err)
+	assert.NotEqual(t, models.NilIncidentID, id1)
+
+	// admins are notified and the org's webhook is queued to be fired
+	assertdb.Query(t, rt.DB, `SELECT incident_type, scope FROM notifications_incident WHERE id = $1`, id1).Columns(map[string]any{"incident_type": "llm:credentials", "scope": string(testdb.OpenAI.UUID)})
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_notification WHERE incident_id = $1`, id1).Returns(1)
+	assert.Equal(t, map[string][]string{"batch/1": {"fire_incident_webhook"}}, testsuite.GetQueuedTaskTypes(t, rt))
+	assert.Len(t, mocks.Requests(), 0)
+
+	testsuite.FlushTasks(t, rt)
+
+	if assert.Len(t, mocks.Requests(), 1) {
+		body, err := mocks.Requests()[0].GetBody()
+		require.NoError(t, err)
+		payload, _ := io.ReadAll(body)
+		assert.Contains(t, string(payload), fmt.Sprintf(`"status":"started","incident":{"id":%d,"type":"llm:credentials","scope":"%s"`, id1, testdb.OpenAI.UUID))
+	}
+
+	// raising same incident for the same LLM doesn't create a new one or call the webhook again
+	id2, err := models.IncidentLLM(ctx, rt, oa, models.IncidentTypeLLMCredentials, testdb.OpenAI.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, id1, id2)
+	assert.Equal(t, map[string]int{}, testsuite.FlushTasks(t, rt))
+	assert.Len(t, mocks.Requests(), 1)
+
+	// but raising it for another LLM does
+	id3, err := models.IncidentLLM(ctx, rt, oa, models.IncidentTypeLLMCredentials, testdb.Anthropic.UUID)
+	require.NoError(t, err)
+	assert.NotEqual(t, id1, id3)
+
+	testsuite.FlushTasks(t, rt)
+	assert.Len(t, mocks.Requests(), 2)
+
+	// budget incidents aren't specific to an LLM, and end when the org is no longer over budget
+	id4, err := models.IncidentLLM(ctx, rt, oa, models.IncidentTypeLLMBudgetExceeded, "")
+	require.NoError(t, err)
+
+	testsuite.FlushTasks(t, rt)
+
+	incidents, err := models.GetOpenIncidents(ctx, rt.DB, []models.IncidentType{models.IncidentTypeLLMBudgetExceeded})
+	require.NoError(t, err)
+	require.Len(t, incidents, 1)
+	assert.Equal(t, id4, incidents[0].ID)
+
+	ongoing, err := models.LLMIncidentOngoing(ctx, rt, oa, incidents[0])
+	assert.NoError(t, err)
+	assert.False(t, ongoing)
+
+	require.NoError(t, incidents[0].End(ctx, rt.DB))
+	require.NoError(t, models.QueueIncidentWebhook(ctx, rt, oa, incidents[0]))
+
+	testsuite.FlushTasks(t, rt)
+
+	if assert.Len(t, mocks.Requests(), 4) {
+		body, err := mocks.Requests()[3].GetBody()
+		require.NoError(t, err)
+		payload, _ := io.ReadAll(body)
+		assert.Contains(t, string(payload), `"status":"ended"`)
+	}
+
+	assert.False(t, mocks.HasUnused())
+}
+
 func TestGetOpenIncidents(t *testing.T) {
 	ctx, rt := testsuite.Runtime(t)
 
@@ -0,0 +1,198 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// KnowledgeBaseID is our type for knowledge base IDs
+type KnowledgeBaseID int
+
+// KnowledgeBaseUUID is our type for knowledge base UUIDs
+type KnowledgeBaseUUID string
+
+// DocumentID is our type for knowledge base document IDs
+type DocumentID int
+
+// DocumentStatus is the embedding status of a knowledge base document
+type DocumentStatus string
+
+const (
+	DocumentStatusPending  = DocumentStatus("P")
+	DocumentStatusEmbedded = DocumentStatus("E")
+	DocumentStatusFailed   = DocumentStatus("F")
+)
+
+// ErrKnowledgeUnavailable is returned when knowledge bases are used with a database which doesn't have their tables
+// or the pgvector extension
+var ErrKnowledgeUnavailable = errors.New("knowledge bases unavailable as database lacks their tables or pgvector")
+
+// converts errors from queries of knowledge base tables caused by the tables or vector type not existing
+func knowledgeError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && (pqErr.Code == "42P01" || pqErr.Code == "42704") { // undefined table or object
+		return ErrKnowledgeUnavailable
+	}
+	return err
+}
+
+// Document is a document in a knowledge base which is chunked and embedded so it can be retrieved by similarity
+type Document struct {
+	ID              DocumentID      `db:"id"`
+	OrgID           OrgID           `db:"org_id"`
+	KnowledgeBaseID KnowledgeBaseID `db:"knowledge_base_id"`
+	LLMID           LLMID           `db:"llm_id"`
+	Content         string          `db:"content"`
+	Status          DocumentStatus  `db:"status"`
+}
+
+// DocumentChunk is a chunk of a document with its embedding
+type DocumentChunk struct {
+	DocumentID DocumentID `db:"document_id"`
+	Position   int        `db:"position"`
+	Content    string     `db:"content"`
+	Embedding  Vector     `db:"embedding"`
+}
+
+// Vector is an embedding vector stored using pgvector
+type Vector []float32
+
+// Value returns the pgvector text representation of this vector, e.g. [0.1,0.2]
+func (v Vector) Value() (driver.Value, error) {
+	parts := make([]string, len(v))
+	for i, f := range v {
+		parts[i] = strconv.FormatFloat(float64(f), 'f', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]", nil
+}
+
+const sqlSelectDocument = `
+SELECT d.id, k.org_id, d.knowledge_base_id, k.llm_id, d.content, d.status
+  FROM ai_document d
+  JOIN ai_knowledgebase k ON k.id = d.knowledge_base_id
+ WHERE d.id = $1 AND d.is_active AND k.is_active`
+
+// GetDocument loads the document with the given ID
+func GetDocument(ctx context.Context, db DBorTx, id DocumentID) (*Document, error) {
+	d := &Document{}
+	if err := db.GetContext(ctx, d, sqlSelectDocument, id); err != nil {
+		return nil, fmt.Errorf("error loading document #%d: %w", id, knowledgeError(err))
+	}
+	return d, nil
+}
+
+const sqlDeleteDocumentChunks = `DELETE FROM ai_documentchunk WHERE document_id = $1`
+
+const sqlInsertDocumentChunks = `
+INSERT INTO ai_documentchunk(document_id, position, content, embedding)
+     VALUES(:document_id, :position, :content, CAST(:embedding AS vector))`
+
+const sqlUpdateDocumentStatus = `UPDATE ai_document SET status = $2, modified_on = NOW() WHERE id = $1`
+
+// SetDocumentChunks replaces the chunks of the given document and marks it as embedded
+func SetDocumentChunks(ctx context.Context, db DB, d *Document, chunks []*DocumentChunk) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlDeleteDocumentChunks, d.ID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting existing document chunks: %w", knowledgeError(err))
+	}
+	if len(chunks) > 0 {
+		if err := BulkQuery(ctx, "inserted document chunks", tx, sqlInsertDocumentChunks, chunks); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error inserting document chunks: %w", knowledgeError(err))
+		}
+	}
+	if _, err := tx.ExecContext(ctx, sqlUpdateDocumentStatus, d.ID, DocumentStatusEmbedded); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error updating document status: %w", err)
+	}
+
+	d.Status = DocumentStatusEmbedded
+	return tx.Commit()
+}
+
+// SetDocumentFailed marks the given document as having failed to be embedded
+func SetDocumentFailed(ctx context.Context, db DBorTx, d *Document) error {
+	if _, err := db.ExecContext(ctx, sqlUpdateDocumentStatus, d.ID, DocumentStatusFailed); err != nil {
+		return fmt.Errorf("error updating document status: %w", err)
+	}
+
+	d.Status = DocumentStatusFailed
+	return nil
+}
+
+const sqlSearchKnowledgeBase = `
+  SELECT c.content
+    FROM ai_documentchunk c
+    JOIN ai_document d ON d.id = c.document_id
+   WHERE d.knowledge_base_id = $1 AND d.is_active
+ORDER BY c.embedding <=> CAST($2 AS vector)
+   LIMIT $3`
+
+// SearchKnowledgeBase returns the content of the chunks in the given knowledge base which are most similar to the
+// given embedding, most similar first
+func SearchKnowledgeBase(ctx context.Context, db DBorTx, kbID KnowledgeBaseID, embedding Vector, limit int) ([]string, error) {
+	var contents []string
+	if err := db.SelectContext(ctx, &contents, sqlSearchKnowledgeBase, kbID, embedding, limit); err != nil {
+		return nil, fmt.Errorf("error searching knowledge base #%d: %w", kbID, knowledgeError(err))
+	}
+	return contents, nil
+}
+
+const sqlSelectKnowledgeBase = `SELECT id, llm_id FROM ai_knowledgebase WHERE org_id = $1 AND uuid = $2 AND is_active`
+
+// retrieves relevant chunks from a knowledge base by embedding input with the LLM its documents were embedded with
+type knowledgeRetriever struct {
+	rt     *runtime.Runtime
+	client *http.Client
+	orgID  OrgID
+	uuid   KnowledgeBaseUUID
+}
+
+func (r *knowledgeRetriever) Retrieve(ctx context.Context, input string, limit int) ([]string, error) {
+	kb := &struct {
+		ID    KnowledgeBaseID `db:"id"`
+		LLMID LLMID           `db:"llm_id"`
+	}{}
+	if err := r.rt.DB.GetContext(ctx, kb, sqlSelectKnowledgeBase, r.orgID, r.uuid); err != nil {
+		return nil, fmt.Errorf("error loading knowledge base %s: %w", r.uuid, knowledgeError(err))
+	}
+
+	oa, err := GetOrgAssets(ctx, r.rt, r.orgID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading org assets: %w", err)
+	}
+	llm := oa.LLMByID(kb.LLMID)
+	if llm == nil {
+		return nil, fmt.Errorf("no such LLM #%d for knowledge base %s", kb.LLMID, r.uuid)
+	}
+
+	svc, err := llm.AsService(r.rt, r.client)
+	if err != nil {
+		return nil, err
+	}
+	es, ok := svc.(ai.EmbeddingService)
+	if !ok {
+		return nil, fmt.Errorf("LLM %s doesn't support embeddings", llm.UUID())
+	}
+
+	vectors, err := es.Embed(ctx, []string{input})
+	if err != nil {
+		return nil, fmt.Errorf("error embedding input: %w", err)
+	}
+
+	return SearchKnowledgeBase(ctx, r.rt.DB, kb.ID, vectors[0], limit)
+}
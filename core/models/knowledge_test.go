@@ -0,0 +1,53 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKnowledgeBases(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	var kbExists bool
+	rt.DB.Get(&kbExists, `SELECT to_regclass('public.ai_knowledgebase') IS NOT NULL`)
+	if !kbExists {
+		_, err := models.GetDocument(ctx, rt.DB, 1)
+		assert.ErrorIs(t, err, models.ErrKnowledgeUnavailable)
+		t.Skip("database doesn't have pgvector")
+	}
+
+	var kbID models.KnowledgeBaseID
+	rt.DB.Get(&kbID, `INSERT INTO ai_knowledgebase(uuid, org_id, llm_id, name, is_active, created_on, modified_on)
+	VALUES('0199bad8-f98d-75a3-b641-2718a25ac3f5', $1, $2, 'Clinic', TRUE, NOW(), NOW()) RETURNING id`, testdb.Org1.ID, testdb.OpenAI.ID)
+
+	var docID models.DocumentID
+	rt.DB.Get(&docID, `INSERT INTO ai_document(knowledge_base_id, content, status, is_active, created_on, modified_on)
+	VALUES($1, 'The clinic opens at nine.', 'P', TRUE, NOW(), NOW()) RETURNING id`, kbID)
+
+	doc, err := models.GetDocument(ctx, rt.DB, docID)
+	require.NoError(t, err)
+	assert.Equal(t, testdb.Org1.ID, doc.OrgID)
+	assert.Equal(t, testdb.OpenAI.ID, doc.LLMID)
+	assert.Equal(t, models.DocumentStatusPending, doc.Status)
+
+	err = models.SetDocumentChunks(ctx, rt.DB, doc, []*models.DocumentChunk{
+		{DocumentID: docID, Position: 0, Content: "The clinic opens at nine.", Embedding: models.Vector{1, 0}},
+		{DocumentID: docID, Position: 1, Content: "Parking is free.", Embedding: models.Vector{0, 1}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.DocumentStatusEmbedded, doc.Status)
+
+	assertdb.Query(t, rt.DB, `SELECT status FROM ai_document WHERE id = $1`, docID).Returns("E")
+
+	contents, err := models.SearchKnowledgeBase(ctx, rt.DB, kbID, models.Vector{0.1, 0.9}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Parking is free."}, contents)
+}
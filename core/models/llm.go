@@ -1,24 +1,39 @@
 package models
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"sync"
 	"time"
 
+	valkey "github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/engine"
 	"github.com/nyaruka/goflow/flows/events"
 	"github.com/nyaruka/goflow/test/services"
+	"github.com/nyaruka/mailroom/v26/core/ai"
 	"github.com/nyaruka/mailroom/v26/core/goflow"
 	"github.com/nyaruka/mailroom/v26/runtime"
 	"github.com/nyaruka/null/v3"
 )
 
+// SpamAction is what happens to contacts whose unsolicited messages are scored as spam or abuse
+type SpamAction string
+
+const (
+	SpamActionFlag  = SpamAction("flag")  // message doesn't trigger flows and contact is added to the spam group if there is one
+	SpamActionBlock = SpamAction("block") // as above and contact is also blocked
+)
+
 // LLMID is our type for LLM IDs
 type LLMID int
 
@@ -28,6 +43,115 @@ const NilLLMID = LLMID(0)
 // maxOutputTokensLimit is the hard ceiling we apply to any LLM's configured max_output_tokens.
 const maxOutputTokensLimit = 16000
 
+// config keys for generation params common to all LLM services
+const (
+	configPreset      = "preset"      // name of a params preset to use as defaults, e.g. precise or creative
+	configTemperature = "temperature" // sampling temperature
+	configTopP        = "top_p"       // nucleus sampling probability mass
+	configJSONMode    = "json_mode"   // whether output should be constrained to valid JSON
+	configJSONSchema  = "json_schema" // JSON schema which output in JSON mode must conform to if calls don't have their own
+
+	configSeed             = "seed"              // seed for more reproducible sampling
+	configFrequencyPenalty = "frequency_penalty" // penalty for tokens by how often they've appeared
+	configPresencePenalty  = "presence_penalty"  // penalty for tokens which have appeared
+)
+
+// config keys for behavior that is applied on top of any LLM service
+const (
+	configScreenInput    = "screen_input"    // action to take on likely prompt injection: reject or neutralize (default off)
+	configScreenDetector = "screen_detector" // how to detect prompt injection: heuristic (default), llm or both
+
+	configNormalizeInput        = "normalize_input"        // whether to normalize unicode in input (default false)
+	configNormalizeInstructions = "normalize_instructions" // whether to also normalize unicode in instructions (default false)
+
+	configStrictMaxTokens    = "strict_max_tokens"    // whether max tokens over the model's limit errors rather than clamps (default false)
+	configMaxCompletionRatio = "max_completion_ratio" // maximum ratio of max tokens to estimated prompt tokens (default unlimited)
+	configTruncateInput      = "truncate_input"       // whether input too long for the model's context window loses its oldest lines rather than errors (default false)
+
+	configRepairJSON = "repair_json" // whether invalid output in JSON mode gets a single repair attempt (default false)
+
+	configCoalesceWindow = "coalesce_window" // milliseconds within which identical requests are coalesced (default 0 = off)
+	configCacheTTL       = "cache_ttl"       // seconds for which responses are cached and reused (default 0 = off)
+
+	configDebugParams = "debug_params" // whether responses include the effective params sent to the provider (default false)
+
+	configLanguageModels = "language_models" // map of input languages to other models of the same provider to route them to
+	configFallbackModels = "fallback_models" // list of other models of the same provider to fall back to if calls fail
+	configFallbackLLM    = "fallback_uuid"   // another LLM, possibly of a different provider, to fall back to on transient errors
+
+	configExperiment         = "experiment"          // name of an experiment which splits calls between variants by contact
+	configExperimentVariants = "experiment_variants" // variants of the experiment with a name and optional model of the same provider, instructions and weight
+
+	configParallelLLM      = "parallel_uuid"     // another LLM, possibly of a different provider, called at the same time as this one
+	configParallelStrategy = "parallel_strategy" // how a response is selected when calling in parallel: first (default), cheapest or judge
+	configJudgeModel       = "judge_model"       // model of the same provider which judges the best response (default same model)
+
+	configMaxSentences = "max_sentences" // maximum number of sentences that output is trimmed to (default 0 = no limit)
+
+	configMaxAttempts   = "max_attempts"   // maximum attempts of calls which fail with transient errors (default 3)
+	configRetryDeadline = "retry_deadline" // seconds within which all attempts of a call must be made (default 30)
+
+	configBreakerThreshold = "breaker_threshold" // consecutive provider failures which make calls fail fast (default 5)
+	configBreakerCooldown  = "breaker_cooldown"  // seconds for which calls fail fast before a trial call (default 30)
+
+	configTimeout        = "timeout"         // seconds that each HTTP request to the provider can take (default that of the services client)
+	configConnectTimeout = "connect_timeout" // seconds that connecting to the provider can take (default no limit besides timeout)
+	configProxyURL       = "proxy_url"       // URL of a forward proxy which requests to the provider are routed through
+
+	configTranscribeAudio = "transcribe_audio" // whether this LLM transcribes audio of incoming messages (default false)
+	configSpeechVoice     = "speech_voice"     // voice this LLM uses to synthesize IVR prompts (default none = not used)
+	configAgentVoice      = "agent_voice"      // voice this LLM speaks with as a realtime agent on IVR calls (default none = not used)
+
+	configDetectLanguage          = "detect_language"           // whether this LLM sets the language of contacts without one from their messages (default false)
+	configDetectLanguageThreshold = "detect_language_threshold" // minimum confidence of a detected language for it to be set (default 0.8)
+
+	configFallbackResponses = "fallback_responses" // responses by language given to flows when calls fail because the provider is down, rate limited or over budget
+
+	configTranslateMessages = "translate_messages" // whether this LLM translates flow messages which have no translation in the contact's language (default false)
+
+	configScoreSentiment = "score_sentiment" // whether this LLM scores the sentiment of incoming messages (default false)
+	configSentimentField = "sentiment_field" // key of the contact field which the sentiment of a contact's last message is saved to
+	configUrgencyField   = "urgency_field"   // key of the contact field which the urgency of a contact's last message is saved to
+
+	configScreenSpam     = "screen_spam"     // whether this LLM screens unsolicited incoming messages for spam and abuse (default false)
+	configSpamModeration = "spam_moderation" // whether messages are screened by the provider's moderation endpoint rather than the model (default false)
+	configSpamThreshold  = "spam_threshold"  // minimum score of a message for its contact to be flagged (default 0.8)
+	configSpamAction     = "spam_action"     // what happens to flagged contacts: flag or block (default flag)
+	configSpamGroup      = "spam_group_uuid" // group which flagged contacts are added to
+
+	configKnowledgeBase    = "knowledge_base_uuid" // knowledge base which relevant context is retrieved from for each call
+	configTopK             = "top_k"               // maximum number of chunks of knowledge retrieved (default 3)
+	configMaxContextTokens = "max_context_tokens"  // maximum tokens of knowledge added to instructions (default 0 = no limit)
+
+	configQuickReplies = "quick_replies" // maximum number of quick replies suggested for messages of flows (default 0 = off)
+
+	configMemoryTurns     = "memory_turns"     // number of recent turns of conversations with each contact remembered (default 0 = off)
+	configMemorySummarize = "memory_summarize" // whether older turns are summarized rather than forgotten (default false)
+	configSummaryModel    = "summary_model"    // cheaper model of the same provider used to summarize history (default same model)
+	configSummarizeTokens = "summarize_tokens" // estimated prompt tokens above which older turns of history are summarized (default 0 = off)
+
+	configRedactPII    = "redact_pii"    // how phone numbers, emails and field values are redacted from calls: strip or pseudonymize (default off)
+	configRedactFields = "redact_fields" // keys of contact fields whose values are also redacted
+
+	configModerateOutput      = "moderate_output"      // how output is moderated: provider, blocklist or both (default off)
+	configModerationBlocklist = "moderation_blocklist" // patterns which flag output when moderating by blocklist
+	configModerationFallback  = "moderation_fallback"  // output returned in place of flagged output (default none = call fails)
+
+	configAsync        = "async"         // whether calls made by flows handling messages are made asynchronously on the AI queue (default false)
+	configAsyncTimeout = "async_timeout" // seconds that asynchronous calls can take before they fail (default 60)
+)
+
+// slots which limit concurrent calls are shared by all services on this node, with those for all types keyed by *
+var (
+	llmSlots   = map[string]ai.Slots{}
+	llmSlotsMu sync.Mutex
+)
+
+const (
+	llmBreakerThreshold = 5                // consecutive failures which open a breaker
+	llmBreakerCooldown  = 30 * time.Second // how long a breaker stays open before allowing a trial call
+)
+
 var registeredLLMServices = map[string]func(*runtime.Runtime, *LLM, *http.Client) (flows.LLMService, error){}
 
 // Register a LLM service factory with the engine
@@ -61,6 +185,53 @@ type LLM struct {
 	Config_          Config           `json:"config"`
 	MaxOutputTokens_ int              `json:"max_output_tokens"`
 	Roles_           []assets.LLMRole `json:"roles"`
+
+	coalescer_    *llmCoalescer
+	routedModels_ *llmRoutedModels
+}
+
+// holds the coalescer shared by all services for an LLM asset, created when it's first needed
+type llmCoalescer struct {
+	once      sync.Once
+	coalescer *ai.Coalescer
+}
+
+// calls whose models are never taken, e.g. because their callers failed, are only kept until there are this many
+const maxLLMRoutedModels = 1000
+
+// holds the models which handled calls to an LLM asset that were routed away from its own model, e.g. by language or to
+// a fallback, by their output until the calls are recorded, so that they can be priced by the model which handled them
+type llmRoutedModels struct {
+	mutex  sync.Mutex
+	models map[string]string
+}
+
+func (r *llmRoutedModels) add(output, model string) {
+	// LLMs which weren't loaded as assets don't have their calls recorded
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.models == nil || len(r.models) >= maxLLMRoutedModels {
+		r.models = make(map[string]string)
+	}
+	r.models[output] = model
+}
+
+func (r *llmRoutedModels) take(output string) string {
+	if r == nil {
+		return ""
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	model := r.models[output]
+	delete(r.models, output)
+	return model
 }
 
 func (l *LLM) ID() LLMID               { return l.ID_ }
@@ -73,44 +244,779 @@ func (l *LLM) Config() Config          { return l.Config_ }
 func (l *LLM) MaxOutputTokens() int    { return min(l.MaxOutputTokens_, maxOutputTokensLimit) }
 func (l *LLM) Roles() []assets.LLMRole { return l.Roles_ }
 
+// TranscribesAudio returns whether this LLM should be used to transcribe audio attachments of incoming messages
+func (l *LLM) TranscribesAudio() bool { return l.Config().GetBool(configTranscribeAudio, false) }
+
+// FallbackResponse returns the response given to flows when calls can't be made, e.g. that an agent will follow up or a
+// category for flows to route on, in the first of the given languages that there is one in
+func (l *LLM) FallbackResponse(langs ...i18n.Language) string {
+	responses := l.Config().GetStringMap(configFallbackResponses)
+	for _, lang := range langs {
+		if r := responses[string(lang)]; r != "" {
+			return r
+		}
+	}
+	return ""
+}
+
+// TranslatesMessages returns whether this LLM should be used to translate messages sent by flows which have no
+// translation in the contact's language
+func (l *LLM) TranslatesMessages() bool { return l.Config().GetBool(configTranslateMessages, false) }
+
+// DetectsLanguage returns whether this LLM should be used to detect the language of contacts without one
+func (l *LLM) DetectsLanguage() bool { return l.Config().GetBool(configDetectLanguage, false) }
+
+// DetectLanguageThreshold returns the minimum confidence of a detected language for it to be set on a contact
+func (l *LLM) DetectLanguageThreshold() float64 {
+	return l.Config().GetFloat(configDetectLanguageThreshold, 0.8)
+}
+
+// ScoresSentiment returns whether this LLM should be used to score the sentiment of incoming messages
+func (l *LLM) ScoresSentiment() bool { return l.Config().GetBool(configScoreSentiment, false) }
+
+// SentimentFields returns the keys of the contact fields which sentiment and urgency scores are saved to, either of
+// which may be empty if that score isn't saved
+func (l *LLM) SentimentFields() (string, string) {
+	return l.Config().GetString(configSentimentField, ""), l.Config().GetString(configUrgencyField, "")
+}
+
+// ScreensSpam returns whether this LLM should be used to screen unsolicited incoming messages for spam and abuse
+func (l *LLM) ScreensSpam() bool { return l.Config().GetBool(configScreenSpam, false) }
+
+// SpamModeration returns whether messages are screened by the provider's moderation endpoint rather than the model
+func (l *LLM) SpamModeration() bool { return l.Config().GetBool(configSpamModeration, false) }
+
+// SpamThreshold returns the minimum spam or abuse score of a message for its contact to be flagged
+func (l *LLM) SpamThreshold() float64 { return l.Config().GetFloat(configSpamThreshold, 0.8) }
+
+// SpamAction returns what happens to contacts flagged as sending spam or abuse, which is either flagged or blocked
+func (l *LLM) SpamAction() SpamAction {
+	if a := SpamAction(l.Config().GetString(configSpamAction, "")); a == SpamActionBlock {
+		return a
+	}
+	return SpamActionFlag
+}
+
+// SpamGroup returns the UUID of the group which contacts flagged as sending spam or abuse are added to, if any
+func (l *LLM) SpamGroup() assets.GroupUUID {
+	return assets.GroupUUID(l.Config().GetString(configSpamGroup, ""))
+}
+
+// SpeechVoice returns the voice this LLM should use to synthesize IVR prompts, or empty if it shouldn't be used
+func (l *LLM) SpeechVoice() string { return l.Config().GetString(configSpeechVoice, "") }
+
+// AgentVoice returns the voice this LLM should speak with as a realtime agent on IVR calls, or empty if it shouldn't be
+// used as one
+func (l *LLM) AgentVoice() string { return l.Config().GetString(configAgentVoice, "") }
+
+// Params returns the generation params for this LLM, i.e. the params of its preset, if any, overridden by any
+// explicitly configured values.
+func (l *LLM) Params() ai.Params {
+	cfg := l.Config()
+	params, _ := ai.Preset(cfg.GetString(configPreset, ""))
+
+	explicit := ai.Params{}
+	if _, ok := cfg[configTemperature]; ok {
+		explicit.Temperature = new(cfg.GetFloat(configTemperature, 0))
+	}
+	if _, ok := cfg[configTopP]; ok {
+		explicit.TopP = new(cfg.GetFloat(configTopP, 1))
+	}
+	if _, ok := cfg[configJSONMode]; ok {
+		explicit.JSONMode = new(cfg.GetBool(configJSONMode, false))
+	}
+	if _, ok := cfg[configSeed]; ok {
+		explicit.Seed = new(int64(cfg.GetInt(configSeed, 0)))
+	}
+	if _, ok := cfg[configFrequencyPenalty]; ok {
+		explicit.FrequencyPenalty = new(cfg.GetFloat(configFrequencyPenalty, 0))
+	}
+	if _, ok := cfg[configPresencePenalty]; ok {
+		explicit.PresencePenalty = new(cfg.GetFloat(configPresencePenalty, 0))
+	}
+
+	return params.Override(explicit)
+}
+
 func (l *LLM) AsService(rt *runtime.Runtime, client *http.Client) (flows.LLMService, error) {
+	svc, provider, err := l.service(rt, client, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// every call is limited by the org's rate limit and accounted for against its token budget, and failed calls are
+	// logged, so these are outermost
+	if rt != nil {
+		svc = ai.NewRateLimitService(svc, &orgLLMRateLimiter{rt: rt, orgID: l.OrgID()})
+		svc = ai.NewBudgetService(svc, &orgLLMBudget{rt: rt, orgID: l.OrgID()})
+
+		// flows are given fallback responses rather than errors when the provider is down, rate limited or over budget
+		if len(l.Config().GetStringMap(configFallbackResponses)) > 0 {
+			svc = &llmDegradationsService{service: ai.NewDegradingService(svc, &llmFallback{llm: l})}
+		}
+
+		svc = &llmCallLogService{service: svc, rt: rt, orgID: l.OrgID(), llmID: l.ID()}
+
+		// and calls made asynchronously are only limited, accounted for and logged when they're actually made
+		if l.Config().GetBool(configAsync, false) {
+			svc = &llmAsyncService{service: svc, rt: rt, llmID: l.ID()}
+		}
+	}
+
+	// variables in instructions are expanded from the context of the call, which deferred calls won't have when made,
+	// and likewise images sent by the contact are added from it
+	svc = ai.NewVariablesService(svc, contextLLMVariables{})
+	svc = ai.NewAttachmentsService(svc, contextLLMAttachments{})
+
+	// and instructions which reference a prompt are resolved first as its body can reference variables
+	if rt != nil {
+		svc = &llmPromptService{service: svc, rt: rt, orgID: l.OrgID()}
+	}
+
+	// calls routed to other models are noted once their output is final so that they're priced by those models
+	svc = &llmRoutedModelsService{service: svc, llm: l}
+
+	wrapped := ai.NewWrappedLLMService(svc, provider)
+
+	// requests which aren't calls go directly to the provider so are guarded separately
+	if rt != nil {
+		wrapped.WithGuard(&llmGuard{rt: rt, llm: l})
+	}
+
+	return wrapped, nil
+}
+
+// Verify makes a cheap call to this LLM's provider, without any of the behavior configured on top of it such as
+// retries or fallbacks, so that problems with its config such as a bad API key are reported directly
+func (l *LLM) Verify(ctx context.Context, rt *runtime.Runtime, client *http.Client) (*ai.Response, error) {
+	_, provider, err := l.modelService(rt, client, l.Model())
+	if err != nil {
+		return nil, err
+	}
+
+	// providers which can check their health, e.g. self-hosted servers, tell us if they're unreachable before we call them
+	if hs, ok := provider.(ai.HealthCheckedService); ok {
+		if err := hs.Health(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// reasoning models need room to think before they can answer at all
+	maxTokens := 16
+	if ai.IsReasoningModel(l.Model()) {
+		maxTokens = 1024
+	}
+
+	return provider.Call(ctx, &ai.Request{Instructions: "Reply with the word OK.", Input: "OK", MaxTokens: maxTokens, Idempotent: true})
+}
+
+// creates the service for this LLM with all configured behavior, optionally falling back to another LLM, returning it
+// and the underlying provider service
+func (l *LLM) service(rt *runtime.Runtime, client *http.Client, withFallback bool) (ai.Service, ai.Service, error) {
+	svc, provider, err := l.modelService(rt, client, l.Model())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if languageModels := l.Config().GetStringMap(configLanguageModels); len(languageModels) > 0 {
+		routes := make(map[i18n.Language]ai.LanguageRoute, len(languageModels))
+		for lang, model := range languageModels {
+			routed, _, err := l.modelService(rt, client, model)
+			if err != nil {
+				return nil, nil, err
+			}
+			routes[i18n.Language(lang)] = ai.LanguageRoute{Model: model, Service: routed}
+		}
+
+		svc = ai.NewLanguageRoutingService(ai.LanguageRoute{Model: l.Model(), Service: svc}, routes)
+	}
+
+	if name := l.Experiment(); name != "" && rt != nil {
+		var variants []*ai.ExperimentVariant
+		for _, v := range l.Config().GetConfigList(configExperimentVariants) {
+			variant := &ai.ExperimentVariant{Name: v.GetString("name", ""), Service: svc, Instructions: v.GetString("instructions", ""), Weight: v.GetInt("weight", 1)}
+			if variant.Name == "" {
+				continue
+			}
+			if model := v.GetString("model", l.Model()); model != l.Model() {
+				if variant.Service, _, err = l.modelService(rt, client, model); err != nil {
+					return nil, nil, err
+				}
+				variant.Model = model
+			}
+			variants = append(variants, variant)
+		}
+
+		if len(variants) > 0 {
+			svc = ai.NewExperimentService(name, &contactLLMExperiment{rt: rt, llmUUID: string(l.UUID()), name: name}, variants...)
+		}
+	}
+
+	if fallbackModels := l.Config().GetStringList(configFallbackModels); len(fallbackModels) > 0 {
+		routes := []ai.FallbackRoute{{Model: l.Model(), Service: svc, Breaker: l.modelBreaker(rt, l.Model())}}
+		for _, model := range fallbackModels {
+			fallback, _, err := l.modelService(rt, client, model)
+			if err != nil {
+				return nil, nil, err
+			}
+			routes = append(routes, ai.FallbackRoute{Model: model, Service: fallback, Breaker: l.modelBreaker(rt, model)})
+		}
+
+		svc = ai.NewFallbackService(routes...)
+	}
+
+	if kbUUID := l.Config().GetString(configKnowledgeBase, ""); kbUUID != "" && rt != nil {
+		retriever := &knowledgeRetriever{rt: rt, client: client, orgID: l.OrgID(), uuid: KnowledgeBaseUUID(kbUUID)}
+		svc = ai.NewRetrievalService(svc, retriever, l.Config().GetInt(configTopK, 3), l.Config().GetInt(configMaxContextTokens, 0))
+	}
+
+	if rt != nil {
+		svc = ai.NewBreakerService(svc, l.valkeyBreaker(rt))
+	}
+
+	svc, err = l.wrapService(rt, svc, provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// fallback LLMs don't themselves fall back to avoid cycles
+	if fallbackUUID := l.Config().GetString(configFallbackLLM, ""); fallbackUUID != "" && withFallback && rt != nil {
+		fallback := &otherLLMService{rt: rt, client: client, orgID: l.OrgID(), uuid: assets.LLMUUID(fallbackUUID)}
+		svc = ai.NewFallbackService(
+			ai.FallbackRoute{Model: l.Model(), Service: svc},
+			ai.FallbackRoute{Model: fallbackUUID, Service: fallback, When: ai.IsTransient},
+		)
+	}
+
+	// other LLMs don't themselves call in parallel to avoid cycles
+	if parallelUUID := l.Config().GetString(configParallelLLM, ""); parallelUUID != "" && withFallback && rt != nil {
+		strategy := ai.ParallelStrategy(l.Config().GetString(configParallelStrategy, string(ai.ParallelFirst)))
+
+		var judge ai.Service
+		if strategy == ai.ParallelJudge {
+			judge, _, err = l.modelService(rt, client, l.Config().GetString(configJudgeModel, l.Model()))
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		other := &otherLLMService{rt: rt, client: client, orgID: l.OrgID(), uuid: assets.LLMUUID(parallelUUID)}
+		svc = ai.NewParallelService(strategy, judge,
+			ai.ParallelRoute{Model: l.Model(), Service: svc},
+			ai.ParallelRoute{Model: parallelUUID, Service: other},
+		)
+	}
+
+	// quick replies are suggested once, and before memory so that it remembers the response without them
+	if maxReplies := l.Config().GetInt(configQuickReplies, 0); maxReplies > 0 && withFallback {
+		svc = &llmQuickRepliesService{plain: svc, withReplies: ai.NewQuickRepliesService(svc, min(maxReplies, maxLLMQuickReplies))}
+	}
+
+	// conversations are remembered once, whichever LLM ends up handling a call
+	if memoryTurns := l.Config().GetInt(configMemoryTurns, 0); memoryTurns > 0 && withFallback && rt != nil {
+		summarizer, _, err := l.modelService(rt, client, l.Config().GetString(configSummaryModel, l.Model()))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if threshold := l.Config().GetInt(configSummarizeTokens, 0); threshold > 0 {
+			svc = ai.NewSummarizingService(svc, summarizer, threshold)
+		}
+		if !l.Config().GetBool(configMemorySummarize, false) {
+			summarizer = nil
+		}
+
+		svc = ai.NewMemoryService(svc, &contactLLMMemory{rt: rt, llmID: l.ID()}, memoryTurns, summarizer)
+	}
+
+	return svc, provider, nil
+}
+
+// calls another LLM of the same org, which is loaded when needed since it may have changed or been removed
+type otherLLMService struct {
+	rt     *runtime.Runtime
+	client *http.Client
+	orgID  OrgID
+	uuid   assets.LLMUUID
+}
+
+func (s *otherLLMService) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	oa, err := GetOrgAssets(ctx, s.rt, s.orgID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading org assets: %w", err)
+	}
+	llm := oa.LLMByUUID(s.uuid)
+	if llm == nil {
+		return nil, fmt.Errorf("no such LLM %s", s.uuid)
+	}
+
+	svc, _, err := llm.service(s.rt, s.client, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := svc.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Model == "" {
+		resp.Model = llm.Model()
+	}
+	return resp, nil
+}
+
+// LLM service which notes the models which handled calls that were routed away from the LLM's own model
+type llmRoutedModelsService struct {
+	service ai.Service
+	llm     *LLM
+}
+
+func (s *llmRoutedModelsService) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	resp, err := s.service.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Model != "" && resp.Model != s.llm.Model() {
+		s.llm.routedModels_.add(resp.Output, resp.Model)
+	}
+	return resp, nil
+}
+
+// creates the service for the given model, which is this LLM's own model unless it's being routed elsewhere, returning
+// it and the underlying provider service
+func (l *LLM) modelService(rt *runtime.Runtime, client *http.Client, model string) (ai.Service, ai.Service, error) {
 	fn := registeredLLMServices[l.Type()]
 	if fn == nil {
-		return nil, fmt.Errorf("unknown type '%s' for LLM: %s", l.Type(), l.UUID())
+		return nil, nil, fmt.Errorf("unknown type '%s' for LLM: %s", l.Type(), l.UUID())
+	}
+
+	m := l
+	if model != l.Model() {
+		routed := *l
+		routed.Model_ = model
+		m = &routed
+	}
+
+	client, err := l.HTTPClient(client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fsvc, err := fn(rt, m, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider := ai.AsService(fsvc)
+	svc := provider
+
+	if rt != nil {
+		svc = &statsService{service: svc, stats: rt.Stats, typ: l.Type(), model: model}
+
+		// slots are taken inside of retries so that calls don't hold them whilst backing off
+		if slots := l.slots(rt); len(slots) > 0 {
+			svc = ai.NewConcurrencyService(svc, slots...)
+		}
+	}
+
+	policy := ai.DefaultRetryPolicy
+	policy.MaxAttempts = l.Config().GetInt(configMaxAttempts, policy.MaxAttempts)
+	policy.Deadline = time.Duration(l.Config().GetInt(configRetryDeadline, int(policy.Deadline/time.Second))) * time.Second
+	svc = ai.NewRetryService(svc, policy)
+
+	if info := ai.LookupModel(model); info != nil {
+		svc = ai.NewContextWindowService(svc, model, info.ContextWindow, l.Config().GetBool(configTruncateInput, false))
+		svc = ai.NewMaxTokensService(svc, model, info.MaxOutputTokens, l.Config().GetBool(configStrictMaxTokens, false))
+	}
+
+	// redaction is applied to every call made to a model so nothing can be sent around it
+	if mode := ai.RedactMode(l.Config().GetString(configRedactPII, "")); mode == ai.RedactModeStrip || mode == ai.RedactModePseudonymize {
+		var values ai.SensitiveValues
+		if fields := l.Config().GetStringList(configRedactFields); len(fields) > 0 && rt != nil {
+			values = &contactFieldValues{rt: rt, orgID: l.OrgID(), fields: fields}
+		}
+		svc = ai.NewRedactingService(svc, mode, values)
+	}
+
+	return svc, provider, nil
+}
+
+// gets the shared slots which limit concurrent calls to all LLMs and to LLMs of this type, if configured
+func (l *LLM) slots(rt *runtime.Runtime) []ai.Slots {
+	llmSlotsMu.Lock()
+	defer llmSlotsMu.Unlock()
+
+	var slots []ai.Slots
+	for _, key := range []string{"*", l.Type()} {
+		limit := rt.Config.LLMConcurrencyParsed[key]
+		if limit <= 0 {
+			continue
+		}
+		s := llmSlots[key]
+		if s == nil || cap(s) != limit {
+			s = ai.NewSlots(limit)
+			llmSlots[key] = s
+		}
+		slots = append(slots, s)
+	}
+	return slots
+}
+
+// gets the breaker for this LLM whose state is shared by all instances, and which starts an incident when it opens
+func (l *LLM) valkeyBreaker(rt *runtime.Runtime) *valkeyBreaker {
+	b := l.newValkeyBreaker(rt, fmt.Sprintf("llm_breaker:%s", l.UUID()))
+	b.incidents = true
+	return b
+}
+
+// gets the breaker for the given model of this LLM used to skip it when falling back between models, which is nil
+// without a runtime to keep state in
+func (l *LLM) modelBreaker(rt *runtime.Runtime, model string) ai.Breaker {
+	if rt == nil {
+		return nil
+	}
+	return l.newValkeyBreaker(rt, fmt.Sprintf("llm_breaker:%s/%s", l.UUID(), model))
+}
+
+func (l *LLM) newValkeyBreaker(rt *runtime.Runtime, key string) *valkeyBreaker {
+	return &valkeyBreaker{
+		rt:        rt,
+		orgID:     l.OrgID(),
+		llmUUID:   l.UUID(),
+		key:       key,
+		threshold: l.Config().GetInt(configBreakerThreshold, llmBreakerThreshold),
+		cooldown:  time.Duration(l.Config().GetInt(configBreakerCooldown, int(llmBreakerCooldown/time.Second))) * time.Second,
+	}
+}
+
+// circuit breaker whose state is kept in valkey so that it's shared by all instances. It opens when consecutive
+// failures reach the threshold and after the cooldown allows a single trial call, which closes it if it succeeds and
+// re-opens it if it fails. If enabled, it starts an incident for the org when it opens.
+type valkeyBreaker struct {
+	rt        *runtime.Runtime
+	orgID     OrgID
+	llmUUID   assets.LLMUUID
+	key       string
+	threshold int
+	cooldown  time.Duration
+	incidents bool
+}
+
+func (b *valkeyBreaker) Allow(ctx context.Context) (bool, error) {
+	vc := b.rt.VK.Get()
+	defer vc.Close()
+
+	values, err := valkey.Values(valkey.DoContext(vc, ctx, "MGET", b.key+":open", b.key+":failures"))
+	if err != nil {
+		return false, fmt.Errorf("error getting breaker state: %w", err)
+	}
+	if values[0] != nil {
+		return false, nil
+	}
+
+	failures, _ := valkey.Int(values[1], nil)
+	if failures < b.threshold {
+		return true, nil
+	}
+
+	// cooldown has passed so whoever claims the trial gets to make it
+	claimed, err := valkey.String(valkey.DoContext(vc, ctx, "SET", b.key+":trial", "1", "NX", "EX", max(int(b.cooldown/time.Second), 1)))
+	if err == valkey.ErrNil {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error claiming breaker trial: %w", err)
+	}
+	return claimed == "OK", nil
+}
+
+func (b *valkeyBreaker) Success(ctx context.Context) error {
+	vc := b.rt.VK.Get()
+	defer vc.Close()
+
+	_, err := valkey.DoContext(vc, ctx, "DEL", b.key+":open", b.key+":failures", b.key+":trial")
+	return err
+}
+
+func (b *valkeyBreaker) Failure(ctx context.Context) error {
+	vc := b.rt.VK.Get()
+	defer vc.Close()
+
+	failures, err := valkey.Int(valkey.DoContext(vc, ctx, "INCR", b.key+":failures"))
+	if err != nil {
+		return fmt.Errorf("error recording breaker failure: %w", err)
+	}
+	if _, err := valkey.DoContext(vc, ctx, "EXPIRE", b.key+":failures", 60*60); err != nil {
+		return fmt.Errorf("error recording breaker failure: %w", err)
+	}
+
+	if failures >= b.threshold {
+		vc.Send("MULTI")
+		vc.Send("SET", b.key+":open", "1", "PX", max(b.cooldown.Milliseconds(), 1))
+		vc.Send("DEL", b.key+":trial")
+		if _, err := valkey.DoContext(vc, ctx, "EXEC"); err != nil {
+			return fmt.Errorf("error opening breaker: %w", err)
+		}
+
+		if b.incidents {
+			startLLMIncident(ctx, b.rt, b.orgID, IncidentTypeLLMUnavailable, b.llmUUID)
+		}
+	}
+	return nil
+}
+
+// Tripped returns whether this breaker has had enough consecutive failures to open, which remains true while it's
+// half-open until a trial call succeeds
+func (b *valkeyBreaker) Tripped(ctx context.Context) (bool, error) {
+	vc := b.rt.VK.Get()
+	defer vc.Close()
+
+	failures, err := valkey.Int(valkey.DoContext(vc, ctx, "GET", b.key+":failures"))
+	if err != nil && err != valkey.ErrNil {
+		return false, fmt.Errorf("error getting breaker failures: %w", err)
+	}
+	return failures >= b.threshold, nil
+}
+
+// records stats for each call made to a provider, including each attempt of retried calls, so that provider
+// degradation is visible
+type statsService struct {
+	service ai.Service
+	stats   *runtime.StatsCollector
+	typ     string
+	model   string
+}
+
+func (s *statsService) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	start := time.Now()
+
+	resp, err := s.service.Call(ctx, req)
+	if err != nil {
+		s.stats.RecordLLMCall(s.typ, s.model, time.Since(start), ai.ErrorCode(err))
+		return nil, err
+	}
+
+	s.stats.RecordLLMCall(s.typ, s.model, time.Since(start), "")
+	s.stats.RecordLLMTokens(s.typ, s.model, resp.TokensInput, resp.TokensOutput, resp.TokensReasoning)
+	if resp.CacheStatus != "" {
+		s.stats.RecordLLMCache(s.typ, s.model, resp.CacheStatus != ai.CacheMiss)
+	}
+	return resp, nil
+}
+
+// wraps the given service with any additional behavior configured on this LLM
+func (l *LLM) wrapService(rt *runtime.Runtime, svc, provider ai.Service) (ai.Service, error) {
+	if maxRatio := l.Config().GetFloat(configMaxCompletionRatio, 0); maxRatio > 0 {
+		svc = ai.NewCompletionRatioService(svc, maxRatio)
+	}
+
+	if jsonMode := l.Params().JSONMode; jsonMode != nil && *jsonMode {
+		schema, _ := l.Config()[configJSONSchema].(map[string]any)
+		svc = ai.NewJSONService(svc, schema, l.Config().GetBool(configRepairJSON, false))
+	}
+
+	if action := ai.ScreenAction(l.Config().GetString(configScreenInput, "")); action == ai.ScreenActionReject || action == ai.ScreenActionNeutralize {
+		var screeners []ai.Screener
+
+		detector := l.Config().GetString(configScreenDetector, "heuristic")
+		if detector == "heuristic" || detector == "both" {
+			screeners = append(screeners, ai.NewHeuristicScreener())
+		}
+		if detector == "llm" || detector == "both" {
+			screeners = append(screeners, &ai.LLMScreener{Service: svc})
+		}
+
+		svc = ai.NewScreeningService(svc, action, screeners...)
+	}
+
+	// normalization comes after screening in the chain so that screening applies to normalized input
+	if l.Config().GetBool(configNormalizeInput, false) {
+		svc = ai.NewNormalizingService(svc, l.Config().GetBool(configNormalizeInstructions, false))
+	}
+
+	if maxSentences := l.Config().GetInt(configMaxSentences, 0); maxSentences > 0 {
+		svc = ai.NewSentenceLimitService(svc, maxSentences)
+	}
+
+	// moderation comes after trimming so that it applies to the output that will actually be returned
+	if moderate := l.Config().GetString(configModerateOutput, ""); moderate == "provider" || moderate == "blocklist" || moderate == "both" {
+		var moderators []ai.Moderator
+
+		if moderate == "blocklist" || moderate == "both" {
+			blocklist, err := ai.NewBlocklistModerator(l.Config().GetStringList(configModerationBlocklist))
+			if err != nil {
+				return nil, err
+			}
+			moderators = append(moderators, blocklist)
+		}
+		if moderate == "provider" || moderate == "both" {
+			m, ok := provider.(ai.Moderator)
+			if !ok {
+				return nil, fmt.Errorf("LLM type %s doesn't support moderation", l.Type())
+			}
+			moderators = append(moderators, m)
+		}
+
+		svc = ai.NewModerationService(svc, l.Config().GetString(configModerationFallback, ""), moderators...)
+	}
+
+	if window := time.Duration(l.Config().GetInt(configCoalesceWindow, 0)) * time.Millisecond; window > 0 {
+		svc = ai.NewCoalescingService(svc, l.coalescer(window), string(l.UUID()))
+	}
+
+	if ttl := time.Duration(l.Config().GetInt(configCacheTTL, 0)) * time.Second; ttl > 0 && rt != nil {
+		svc = ai.NewCachingService(svc, &valkeyResponseCache{rt: rt}, fmt.Sprintf("%s/%s", l.UUID(), l.Model()), ttl)
+	}
+
+	if l.Config().GetBool(configDebugParams, false) {
+		svc = ai.NewDebugService(svc)
+	}
+
+	return svc, nil
+}
+
+// gets the coalescer shared by all services for this LLM, which goes away with the asset when org assets are refreshed
+func (l *LLM) coalescer(window time.Duration) *ai.Coalescer {
+	// LLMs which weren't loaded as assets can't share one
+	if l.coalescer_ == nil {
+		return ai.NewCoalescer(window)
 	}
-	return fn(rt, l, client)
+
+	l.coalescer_.once.Do(func() { l.coalescer_.coalescer = ai.NewCoalescer(window) })
+	return l.coalescer_.coalescer
+}
+
+const responseCacheKeyPrefix = "llm:response:"
+
+// response cache which stores responses in valkey
+type valkeyResponseCache struct {
+	rt *runtime.Runtime
+}
+
+func (c *valkeyResponseCache) Get(ctx context.Context, key string) (*ai.Response, error) {
+	vc := c.rt.VK.Get()
+	defer vc.Close()
+
+	b, err := valkey.Bytes(valkey.DoContext(vc, ctx, "GET", responseCacheKeyPrefix+key))
+	if err == valkey.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	resp := &ai.Response{}
+	if err := json.Unmarshal(b, resp); err != nil {
+		return nil, fmt.Errorf("error unmarshaling cached response: %w", err)
+	}
+	return resp, nil
 }
 
-// RecordCall records stats for an LLM call and returns the daily count rows to be inserted.
-func (l *LLM) RecordCall(rt *runtime.Runtime, oa *OrgAssets, e *events.LLMCalled) []*LLMDailyCount {
-	rt.Stats.RecordLLMCall(l.Type(), l.Model(), time.Duration(e.ElapsedMS)*time.Millisecond)
+func (c *valkeyResponseCache) Set(ctx context.Context, key string, resp *ai.Response, ttl time.Duration) error {
+	vc := c.rt.VK.Get()
+	defer vc.Close()
 
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("error marshaling response: %w", err)
+	}
+
+	_, err = valkey.DoContext(vc, ctx, "SET", responseCacheKeyPrefix+key, b, "EX", int(ttl/time.Second))
+	return err
+}
+
+// RecordCall returns the daily count rows to be inserted for an LLM call by the given flow (if any), which include its
+// cost in millionths of a USD if the model which handled it has pricing. Stats for the call are recorded by the service
+// which made it.
+func (l *LLM) RecordCall(oa *OrgAssets, flowID FlowID, e *events.LLMCalled) []*LLMDailyCount {
 	day := dates.ExtractDate(dates.Now().In(oa.Env().Timezone()))
-	counts := []*LLMDailyCount{{LLMID: l.ID(), Day: day, Scope: "calls", Count: 1}}
+	counts := []*LLMDailyCount{{LLMID: l.ID(), FlowID: flowID, Day: day, Scope: "calls", Count: 1}}
 	if e.Tokens.Input > 0 {
-		counts = append(counts, &LLMDailyCount{LLMID: l.ID(), Day: day, Scope: "tokens:in", Count: e.Tokens.Input})
+		counts = append(counts, &LLMDailyCount{LLMID: l.ID(), FlowID: flowID, Day: day, Scope: "tokens:in", Count: e.Tokens.Input})
 	}
 	if e.Tokens.Output > 0 {
-		counts = append(counts, &LLMDailyCount{LLMID: l.ID(), Day: day, Scope: "tokens:out", Count: e.Tokens.Output})
+		counts = append(counts, &LLMDailyCount{LLMID: l.ID(), FlowID: flowID, Day: day, Scope: "tokens:out", Count: e.Tokens.Output})
+	}
+
+	// calls are priced by the model which handled them, which may not be this LLM's own model
+	model := cmp.Or(l.routedModels_.take(e.Output), l.Model())
+	if pricing := ai.LookupPricing(model); pricing != nil {
+		if cost := int64(math.Round(pricing.Cost(e.Tokens.Input, e.Tokens.Output) * 1_000_000)); cost > 0 {
+			counts = append(counts, &LLMDailyCount{LLMID: l.ID(), FlowID: flowID, Day: day, Scope: "cost:microusd", Count: cost})
+		}
 	}
 	return counts
 }
 
+// RecordError returns the daily count row to be inserted for an LLM call by the given flow (if any) which failed with
+// the given error code, whether or not a fallback response was given in its place
+func (l *LLM) RecordError(oa *OrgAssets, flowID FlowID, code string) []*LLMDailyCount {
+	day := dates.ExtractDate(dates.Now().In(oa.Env().Timezone()))
+	return []*LLMDailyCount{{LLMID: l.ID(), FlowID: flowID, Day: day, Scope: llmErrorsScopePrefix + code, Count: 1}}
+}
+
+// RecordStandaloneCall records a call to this LLM made outside of a flow session, e.g. by an editing endpoint, inserting
+// its daily counts and a record of the call if it succeeded, as failed calls, and the org's usage, are recorded by the
+// service itself.
+func (l *LLM) RecordStandaloneCall(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, instructions, input string, resp *flows.LLMResponse, elapsed time.Duration, failed bool) error {
+	if resp == nil {
+		resp = &flows.LLMResponse{}
+	}
+	counts := l.RecordCall(oa, NilFlowID, events.NewLLMCalled(flows.NewLLM(l), instructions, input, resp, elapsed))
+
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	if err := InsertLLMDailyCounts(ctx, tx, counts); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing llm call counts: %w", err)
+	}
+
+	if !failed {
+		call := NewLLMCall(oa.OrgID(), l.ID(), NilFlowID, NilContactID, elapsed, resp.TokensInput, resp.TokensOutput, nil)
+		return InsertLLMCalls(ctx, rt.DB, []*LLMCall{call})
+	}
+	return nil
+}
+
+// the prefix of the scopes of daily counts of failed calls, which are followed by the error code
+const llmErrorsScopePrefix = "errors:"
+
 type LLMDailyCount struct {
-	LLMID LLMID      `db:"llm_id"`
-	Day   dates.Date `db:"day"`
-	Scope string     `db:"scope"`
-	Count int64      `db:"count"`
+	LLMID  LLMID      `db:"llm_id"`
+	FlowID FlowID     `db:"flow_id"` // the flow which made the calls if any
+	Day    dates.Date `db:"day"`
+	Scope  string     `db:"scope"`
+	Count  int64      `db:"count"`
 }
 
 const sqlInsertLLMDailyCount = `INSERT INTO ai_llmcount(llm_id, scope, day, count, is_squashed) VALUES(:llm_id, :scope, :day, :count, FALSE)`
 
-// InsertLLMDailyCounts inserts the given LLM daily count rows.
+const sqlInsertLLMFlowDailyCount = `INSERT INTO ai_llmflowcount(flow_id, llm_id, scope, day, count, is_squashed) VALUES(:flow_id, :llm_id, :scope, :day, :count, FALSE)`
+
+// InsertLLMDailyCounts inserts the given LLM daily count rows, and for those of calls made by flows, the same rows for
+// those flows so that usage can be attributed to them.
 func InsertLLMDailyCounts(ctx context.Context, tx DBorTx, counts []*LLMDailyCount) error {
 	if len(counts) == 0 {
 		return nil
 	}
-	return BulkQuery(ctx, "inserted llm daily counts", tx, sqlInsertLLMDailyCount, counts)
+	if err := BulkQuery(ctx, "inserted llm daily counts", tx, sqlInsertLLMDailyCount, counts); err != nil {
+		return err
+	}
+
+	flowCounts := make([]*LLMDailyCount, 0, len(counts))
+	for _, c := range counts {
+		if c.FlowID != NilFlowID {
+			flowCounts = append(flowCounts, c)
+		}
+	}
+	if len(flowCounts) == 0 {
+		return nil
+	}
+	return BulkQuery(ctx, "inserted llm flow daily counts", tx, sqlInsertLLMFlowDailyCount, flowCounts)
 }
 
 // loads the LLMs for the passed in org
@@ -120,7 +1026,7 @@ func loadLLMs(ctx context.Context, db *sql.DB, orgID OrgID) ([]assets.LLM, error
 		return nil, fmt.Errorf("error querying LLMs for org: %d: %w", orgID, err)
 	}
 
-	return ScanJSONRows(rows, func() assets.LLM { return &LLM{} })
+	return ScanJSONRows(rows, func() assets.LLM { return &LLM{coalescer_: &llmCoalescer{}, routedModels_: &llmRoutedModels{}} })
 }
 
 const sqlSelectLLMs = `
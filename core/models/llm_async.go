@@ -0,0 +1,207 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+const (
+	llmAsyncPendingKey = "llm_async:%d:%s:pending" // set whilst a deferred call of a contact is queued or being made
+	llmAsyncResultKey  = "llm_async:%d:%s:result"  // result of a deferred call of a contact, for its flow to be resumed with
+	llmAsyncResultTTL  = time.Hour
+
+	defaultLLMAsyncTimeout = time.Minute
+)
+
+// ErrLLMDeferred is returned by asynchronous LLM calls whose result isn't available yet
+var ErrLLMDeferred = errors.New("LLM call deferred")
+
+// LLMDeferredCall is an LLM call of a contact which has been deferred to be made asynchronously
+type LLMDeferredCall struct {
+	LLMID     LLMID       `json:"llm_id"`
+	ContactID ContactID   `json:"contact_id"`
+	Hash      string      `json:"hash"`
+	Request   *ai.Request `json:"request"`
+}
+
+// LLMDeferrals collects the LLM calls which were deferred during the handling of a message, in which case the handling
+// is discarded and retried once they've been made, and the results which were used when it was retried
+type LLMDeferrals struct {
+	mutex sync.Mutex
+	calls []*LLMDeferredCall
+	used  []string
+}
+
+// NewLLMDeferrals creates a new empty collection of deferred calls
+func NewLLMDeferrals() *LLMDeferrals {
+	return &LLMDeferrals{}
+}
+
+// WithLLMDeferrals returns a copy of the given context in which calls to asynchronous LLMs are deferred
+func WithLLMDeferrals(ctx context.Context, d *LLMDeferrals) context.Context {
+	return context.WithValue(ctx, llmDeferralsKey, d)
+}
+
+// Calls returns the calls which were deferred
+func (d *LLMDeferrals) Calls() []*LLMDeferredCall {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.calls
+}
+
+// Release removes the results which were used, once the handling which used them has been committed
+func (d *LLMDeferrals) Release(ctx context.Context, rt *runtime.Runtime) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if len(d.used) == 0 {
+		return nil
+	}
+
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	args := make([]any, len(d.used))
+	for i, key := range d.used {
+		args[i] = key
+	}
+	if _, err := valkey.DoContext(vc, ctx, "DEL", args...); err != nil {
+		return fmt.Errorf("error removing deferred LLM call results: %w", err)
+	}
+	d.used = nil
+	return nil
+}
+
+// MarkPending marks this call as pending, returning false if it already was, in which case it doesn't need queuing
+func (c *LLMDeferredCall) MarkPending(ctx context.Context, rt *runtime.Runtime, timeout time.Duration) (bool, error) {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	// if a call is lost, e.g. by a node dying, it can be queued again once this expires
+	_, err := valkey.String(valkey.DoContext(vc, ctx, "SET", fmt.Sprintf(llmAsyncPendingKey, c.ContactID, c.Hash), "1", "NX", "EX", int((timeout+time.Minute)/time.Second)))
+	if err == valkey.ErrNil {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error marking deferred LLM call as pending: %w", err)
+	}
+	return true, nil
+}
+
+// Make makes this call with its LLM, if it still exists, and stores the result, which is a failure if the call errors
+// or takes longer than the LLM's async timeout
+func (c *LLMDeferredCall) Make(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets) error {
+	result := &llmAsyncResult{}
+
+	if llm := oa.LLMByID(c.LLMID); llm == nil {
+		result.Error = "LLM no longer exists"
+	} else {
+		svc, err := llm.AsService(rt, rt.HTTP.Services)
+		if err != nil {
+			return fmt.Errorf("error creating LLM service: %w", err)
+		}
+
+		timeout := llm.AsyncTimeout()
+		callCtx, cancel := context.WithTimeout(WithContactID(ctx, c.ContactID), timeout)
+		defer cancel()
+
+		result.Response, err = svc.(*ai.LLMService).Call(callCtx, c.Request)
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Error = fmt.Sprintf("LLM call timed out after %s", timeout)
+		} else if err != nil {
+			result.Error = err.Error()
+		}
+	}
+
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error marshaling deferred LLM call result: %w", err)
+	}
+
+	vc.Send("MULTI")
+	vc.Send("SET", fmt.Sprintf(llmAsyncResultKey, c.ContactID, c.Hash), resultJSON, "EX", int(llmAsyncResultTTL/time.Second))
+	vc.Send("DEL", fmt.Sprintf(llmAsyncPendingKey, c.ContactID, c.Hash))
+	if _, err := valkey.DoContext(vc, ctx, "EXEC"); err != nil {
+		return fmt.Errorf("error storing deferred LLM call result: %w", err)
+	}
+	return nil
+}
+
+// AsyncTimeout returns how long asynchronous calls to this LLM can take before they fail
+func (l *LLM) AsyncTimeout() time.Duration {
+	return time.Duration(l.Config().GetInt(configAsyncTimeout, int(defaultLLMAsyncTimeout/time.Second))) * time.Second
+}
+
+// result of a deferred call as stored in valkey
+type llmAsyncResult struct {
+	Response *ai.Response `json:"response,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// LLM service which, when calls are made during the handling of a message, defers them to be made asynchronously and
+// returns their results when the handling is retried, and otherwise makes calls as is
+type llmAsyncService struct {
+	service ai.Service
+	rt      *runtime.Runtime
+	llmID   LLMID
+}
+
+func (s *llmAsyncService) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	d, _ := ctx.Value(llmDeferralsKey).(*LLMDeferrals)
+	contactID := contactIDFromContext(ctx)
+	if d == nil || contactID == NilContactID {
+		return s.service.Call(ctx, req)
+	}
+
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling LLM request: %w", err)
+	}
+	h := sha256.Sum256(append([]byte(fmt.Sprintf("%d:", s.llmID)), reqJSON...))
+	hash := hex.EncodeToString(h[:16])
+
+	vc := s.rt.VK.Get()
+	defer vc.Close()
+
+	resultKey := fmt.Sprintf(llmAsyncResultKey, contactID, hash)
+	resultJSON, err := valkey.Bytes(valkey.DoContext(vc, ctx, "GET", resultKey))
+	if err != nil && err != valkey.ErrNil {
+		return nil, fmt.Errorf("error getting deferred LLM call result: %w", err)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err == nil {
+		result := &llmAsyncResult{}
+		if err := json.Unmarshal(resultJSON, result); err != nil {
+			return nil, fmt.Errorf("error unmarshaling deferred LLM call result: %w", err)
+		}
+
+		d.used = append(d.used, resultKey)
+
+		if result.Error != "" {
+			return nil, errors.New(result.Error)
+		}
+		return result.Response, nil
+	}
+
+	// handling is discarded once a call is deferred, so only the first call without a result needs making
+	if len(d.calls) == 0 {
+		d.calls = append(d.calls, &LLMDeferredCall{LLMID: s.llmID, ContactID: contactID, Hash: hash, Request: req})
+	}
+	return nil, ErrLLMDeferred
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nyaruka/goflow/utils"
+)
+
+// WithLLMAttachments returns a copy of the given context in which LLM calls are sent with the images among the given
+// attachments, e.g. those of the message that a flow session is handling
+func WithLLMAttachments(ctx context.Context, attachments []utils.Attachment) context.Context {
+	var images []utils.Attachment
+	for _, a := range attachments {
+		if strings.HasPrefix(a.ContentType(), "image/") {
+			images = append(images, a)
+		}
+	}
+	return context.WithValue(ctx, llmAttachmentsKey, images)
+}
+
+// source of the attachments of LLM calls, from their context
+type contextLLMAttachments struct{}
+
+func (contextLLMAttachments) Load(ctx context.Context) []utils.Attachment {
+	a, _ := ctx.Value(llmAttachmentsKey).([]utils.Attachment)
+	return a
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+const llmBatchesKey = "llm_batches" // hash of pending batches by ID
+
+// LLMBatch is a batch of requests submitted to an LLM's provider to be processed offline, along with the task which
+// submitted it, which is queued again with the results once the batch has finished
+type LLMBatch struct {
+	ID        string          `json:"id"`
+	OrgID     OrgID           `json:"org_id"`
+	LLMID     LLMID           `json:"llm_id"`
+	TaskType  string          `json:"task_type"`
+	Task      json.RawMessage `json:"task"`
+	CreatedOn time.Time       `json:"created_on"`
+}
+
+// InsertLLMBatch records a pending batch so that its results are collected when it has finished
+func InsertLLMBatch(ctx context.Context, rt *runtime.Runtime, b *LLMBatch) error {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	if _, err := valkey.DoContext(vc, ctx, "HSET", llmBatchesKey, b.ID, jsonx.MustMarshal(b)); err != nil {
+		return fmt.Errorf("error recording llm batch: %w", err)
+	}
+	return nil
+}
+
+// GetLLMBatches gets all pending batches
+func GetLLMBatches(ctx context.Context, rt *runtime.Runtime) ([]*LLMBatch, error) {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	items, err := valkey.ByteSlices(valkey.DoContext(vc, ctx, "HVALS", llmBatchesKey))
+	if err != nil {
+		return nil, fmt.Errorf("error getting llm batches: %w", err)
+	}
+
+	batches := make([]*LLMBatch, len(items))
+	for i, item := range items {
+		batches[i] = &LLMBatch{}
+		if err := json.Unmarshal(item, batches[i]); err != nil {
+			return nil, fmt.Errorf("error unmarshaling llm batch: %w", err)
+		}
+	}
+	return batches, nil
+}
+
+// DeleteLLMBatch deletes a pending batch once its results have been collected
+func DeleteLLMBatch(ctx context.Context, rt *runtime.Runtime, id string) error {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	if _, err := valkey.DoContext(vc, ctx, "HDEL", llmBatchesKey, id); err != nil {
+		return fmt.Errorf("error deleting llm batch: %w", err)
+	}
+	return nil
+}
+
+// BatchCounts returns the daily count rows to be inserted for the requests of a batch, whose cost is discounted
+func (l *LLM) BatchCounts(oa *OrgAssets, results []*ai.BatchResult) []*LLMDailyCount {
+	var tokensIn, tokensOut int64
+	for _, r := range results {
+		tokensIn += r.TokensInput
+		tokensOut += r.TokensOutput
+	}
+
+	day := dates.ExtractDate(dates.Now().In(oa.Env().Timezone()))
+	counts := []*LLMDailyCount{{LLMID: l.ID(), Day: day, Scope: "calls", Count: int64(len(results))}}
+	if tokensIn > 0 {
+		counts = append(counts, &LLMDailyCount{LLMID: l.ID(), Day: day, Scope: "tokens:in", Count: tokensIn})
+	}
+	if tokensOut > 0 {
+		counts = append(counts, &LLMDailyCount{LLMID: l.ID(), Day: day, Scope: "tokens:out", Count: tokensOut})
+	}
+	if pricing := ai.LookupPricing(l.Model()); pricing != nil {
+		if cost := int64(math.Round(pricing.Cost(tokensIn, tokensOut) * ai.BatchCostRatio * 1_000_000)); cost > 0 {
+			counts = append(counts, &LLMDailyCount{LLMID: l.ID(), Day: day, Scope: "cost:microusd", Count: cost})
+		}
+	}
+	return counts
+}
+
+// RecordBatch records the requests of a finished batch, inserting their daily counts, and spending their tokens from the
+// org's budget which records them as the org's usage
+func (l *LLM) RecordBatch(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, results []*ai.BatchResult) error {
+	counts := l.BatchCounts(oa, results)
+
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	if err := InsertLLMDailyCounts(ctx, tx, counts); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing llm batch counts: %w", err)
+	}
+
+	var tokens int64
+	for _, r := range results {
+		tokens += r.TokensInput + r.TokensOutput
+	}
+	if tokens > 0 {
+		return (&orgLLMBudget{rt: rt, orgID: oa.OrgID()}).Spend(ctx, tokens)
+	}
+	return nil
+}
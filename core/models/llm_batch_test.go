@@ -0,0 +1,67 @@
+package models_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLLMBatches(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetValkey)
+
+	batches, err := models.GetLLMBatches(ctx, rt)
+	assert.NoError(t, err)
+	assert.Len(t, batches, 0)
+
+	b := &models.LLMBatch{
+		ID:        "batch_123",
+		OrgID:     testdb.Org1.ID,
+		LLMID:     testdb.OpenAI.ID,
+		TaskType:  "categorize_contacts_batch",
+		Task:      json.RawMessage(`{"job_id":"123"}`),
+		CreatedOn: time.Date(2026, 5, 4, 13, 14, 30, 0, time.UTC),
+	}
+	require.NoError(t, models.InsertLLMBatch(ctx, rt, b))
+
+	batches, err = models.GetLLMBatches(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.LLMBatch{b}, batches)
+
+	require.NoError(t, models.DeleteLLMBatch(ctx, rt, "batch_123"))
+
+	batches, err = models.GetLLMBatches(ctx, rt)
+	assert.NoError(t, err)
+	assert.Len(t, batches, 0)
+}
+
+func TestLLMBatchCounts(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdb.Org1.ID)
+	require.NoError(t, err)
+
+	ai.RegisterPricing("priced-model", &ai.Pricing{Input: 2.5, Output: 10})
+
+	llm := &models.LLM{ID_: testdb.OpenAI.ID, Type_: "openai", Model_: "priced-model-2025-01-01"}
+
+	counts := llm.BatchCounts(oa, []*ai.BatchResult{
+		{Output: "Question", TokensInput: 600, TokensOutput: 100},
+		{Output: "Other", TokensInput: 400, TokensOutput: 100},
+		{Error: "Input is too long"},
+	})
+	assert.Len(t, counts, 4)
+	assert.Equal(t, int64(3), counts[0].Count)
+	assert.Equal(t, int64(1000), counts[1].Count)
+	assert.Equal(t, int64(200), counts[2].Count)
+	assert.Equal(t, "cost:microusd", counts[3].Scope)
+	assert.Equal(t, int64(2250), counts[3].Count) // half the cost of the same calls made normally
+}
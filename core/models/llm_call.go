@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/null/v3"
+)
+
+// LLMCallID is our type for LLM call IDs
+type LLMCallID int64
+
+// LLMCallStatus is the status of an LLM call
+type LLMCallStatus string
+
+const (
+	LLMCallStatusSuccess  = LLMCallStatus("S")
+	LLMCallStatusFailed   = LLMCallStatus("F")
+	LLMCallStatusDegraded = LLMCallStatus("D") // failed but a fallback response was given instead
+)
+
+// LLMCall is a record of a call made to an LLM, for debugging
+type LLMCall struct {
+	ID           LLMCallID     `db:"id"            json:"id"`
+	OrgID        OrgID         `db:"org_id"        json:"-"`
+	LLMID        LLMID         `db:"llm_id"        json:"llm_id"`
+	FlowID       FlowID        `db:"flow_id"       json:"flow_id,omitempty"`
+	ContactID    ContactID     `db:"contact_id"    json:"contact_id,omitempty"`
+	Status       LLMCallStatus `db:"status"        json:"status"`
+	ErrorCode    null.String   `db:"error_code"    json:"error_code,omitempty"`
+	ElapsedMS    int           `db:"elapsed_ms"    json:"elapsed_ms"`
+	TokensInput  int64         `db:"tokens_input"  json:"tokens_input"`
+	TokensOutput int64         `db:"tokens_output" json:"tokens_output"`
+	CreatedOn    time.Time     `db:"created_on"    json:"created_on"`
+}
+
+// NewLLMCall creates a new record of an LLM call which failed if the given error is non-nil
+func NewLLMCall(orgID OrgID, llmID LLMID, flowID FlowID, contactID ContactID, elapsed time.Duration, tokensIn, tokensOut int64, err error) *LLMCall {
+	c := &LLMCall{
+		OrgID:        orgID,
+		LLMID:        llmID,
+		FlowID:       flowID,
+		ContactID:    contactID,
+		Status:       LLMCallStatusSuccess,
+		ElapsedMS:    int(elapsed / time.Millisecond),
+		TokensInput:  tokensIn,
+		TokensOutput: tokensOut,
+		CreatedOn:    dates.Now(),
+	}
+	if err != nil {
+		c.Status = LLMCallStatusFailed
+		c.ErrorCode = null.String(ai.ErrorCode(err))
+	}
+	return c
+}
+
+// Degrade marks this call as having failed with the given error code but been given a fallback response
+func (c *LLMCall) Degrade(code string) {
+	c.Status = LLMCallStatusDegraded
+	c.ErrorCode = null.String(code)
+}
+
+const sqlInsertLLMCalls = `
+INSERT INTO ai_llmcall( org_id,  llm_id,  flow_id,  contact_id,  status,  error_code,  elapsed_ms,  tokens_input,  tokens_output,  created_on)
+                VALUES(:org_id, :llm_id, :flow_id, :contact_id, :status, :error_code, :elapsed_ms, :tokens_input, :tokens_output, :created_on)
+RETURNING id`
+
+// InsertLLMCalls inserts the given LLM call records
+func InsertLLMCalls(ctx context.Context, tx DBorTx, calls []*LLMCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	return BulkQuery(ctx, "inserted llm calls", tx, sqlInsertLLMCalls, calls)
+}
+
+const sqlSelectRecentLLMCalls = `
+  SELECT id, org_id, llm_id, flow_id, contact_id, status, error_code, elapsed_ms, tokens_input, tokens_output, created_on
+    FROM ai_llmcall
+   WHERE org_id = $1 AND ($2 = 0 OR llm_id = $2)
+ORDER BY created_on DESC, id DESC
+   LIMIT $3`
+
+// GetRecentLLMCalls gets the most recent calls made by the given org, optionally only to the given LLM, most recent first
+func GetRecentLLMCalls(ctx context.Context, db DBorTx, orgID OrgID, llmID LLMID, limit int) ([]*LLMCall, error) {
+	calls := make([]*LLMCall, 0, limit)
+	if err := db.SelectContext(ctx, &calls, sqlSelectRecentLLMCalls, orgID, int(llmID), limit); err != nil {
+		return nil, fmt.Errorf("error selecting recent llm calls: %w", err)
+	}
+	return calls, nil
+}
+
+const sqlDeleteLLMCallsBefore = `DELETE FROM ai_llmcall WHERE created_on < $1`
+
+// DeleteLLMCallsBefore deletes LLM call records created before the given time, returning the number deleted
+func DeleteLLMCallsBefore(ctx context.Context, db DBorTx, before time.Time) (int64, error) {
+	res, err := db.ExecContext(ctx, sqlDeleteLLMCallsBefore, before)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting llm calls: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// LLM service which records calls that fail. Successful calls are recorded from the events of the sessions which made
+// them, but failed calls have no such events that identify the LLM.
+type llmCallLogService struct {
+	service ai.Service
+	rt      *runtime.Runtime
+	orgID   OrgID
+	llmID   LLMID
+}
+
+func (s *llmCallLogService) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	start := time.Now()
+
+	resp, err := s.service.Call(ctx, req)
+	if err != nil {
+		call := NewLLMCall(s.orgID, s.llmID, NilFlowID, contactIDFromContext(ctx), time.Since(start), 0, 0, err)
+
+		// detach from the call's context as we want to record failures caused by it being canceled
+		recCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+
+		if lerr := InsertLLMCalls(recCtx, s.rt.DB, []*LLMCall{call}); lerr != nil {
+			slog.Error("error recording failed llm call", "error", lerr, "llm_id", s.llmID)
+		}
+		if lerr := s.recordError(recCtx, string(call.ErrorCode)); lerr != nil {
+			slog.Error("error recording failed llm call counts", "error", lerr, "llm_id", s.llmID)
+		}
+	}
+	return resp, err
+}
+
+func (s *llmCallLogService) recordError(ctx context.Context, code string) error {
+	oa, err := GetOrgAssets(ctx, s.rt, s.orgID)
+	if err != nil {
+		return fmt.Errorf("error loading org assets: %w", err)
+	}
+	llm := oa.LLMByID(s.llmID)
+	if llm == nil {
+		return nil
+	}
+	if err := InsertLLMDailyCounts(ctx, s.rt.DB, llm.RecordError(oa, NilFlowID, code)); err != nil {
+		return err
+	}
+
+	// admins need to know when credentials stop working as calls won't succeed until they're fixed
+	if code == ai.ErrorCredentials {
+		startLLMIncident(ctx, s.rt, s.orgID, IncidentTypeLLMCredentials, llm.UUID())
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLLMCalls(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	call1 := models.NewLLMCall(testdb.Org1.ID, testdb.OpenAI.ID, testdb.Favorites.ID, testdb.Ann.ID, 1250*time.Millisecond, 120, 34, nil)
+	assert.Equal(t, models.LLMCallStatusSuccess, call1.Status)
+	assert.Equal(t, "", string(call1.ErrorCode))
+	assert.Equal(t, 1250, call1.ElapsedMS)
+
+	call2 := models.NewLLMCall(testdb.Org1.ID, testdb.OpenAI.ID, models.NilFlowID, testdb.Bob.ID, time.Second, 0, 0, &ai.ServiceError{Message: "slow down", Code: ai.ErrorRateLimit})
+	assert.Equal(t, models.LLMCallStatusFailed, call2.Status)
+	assert.Equal(t, ai.ErrorRateLimit, string(call2.ErrorCode))
+
+	call3 := models.NewLLMCall(testdb.Org1.ID, testdb.Anthropic.ID, models.NilFlowID, models.NilContactID, time.Second, 0, 0, errors.New("boom"))
+	assert.Equal(t, ai.ErrorUnknown, string(call3.ErrorCode))
+
+	err := models.InsertLLMCalls(ctx, rt.DB, []*models.LLMCall{call1, call2, call3})
+	require.NoError(t, err)
+	assert.NotZero(t, call1.ID)
+
+	assertdb.Query(t, rt.DB, `SELECT COUNT(*) FROM ai_llmcall WHERE status = 'F'`).Returns(2)
+	assertdb.Query(t, rt.DB, `SELECT flow_id, contact_id, status, error_code, elapsed_ms, tokens_input, tokens_output FROM ai_llmcall WHERE id = $1`, call1.ID).
+		Columns(map[string]any{"flow_id": testdb.Favorites.ID, "contact_id": testdb.Ann.ID, "status": "S", "error_code": nil, "elapsed_ms": 1250, "tokens_input": 120, "tokens_output": 34})
+	assertdb.Query(t, rt.DB, `SELECT flow_id, contact_id, error_code FROM ai_llmcall WHERE id = $1`, call3.ID).
+		Columns(map[string]any{"flow_id": nil, "contact_id": nil, "error_code": "unknown"})
+
+	calls, err := models.GetRecentLLMCalls(ctx, rt.DB, testdb.Org1.ID, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, calls, 3)
+
+	calls, err = models.GetRecentLLMCalls(ctx, rt.DB, testdb.Org1.ID, testdb.OpenAI.ID, 1)
+	require.NoError(t, err)
+	assert.Len(t, calls, 1)
+
+	deleted, err := models.DeleteLLMCallsBefore(ctx, rt.DB, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+}
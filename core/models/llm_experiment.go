@@ -0,0 +1,145 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+const (
+	experimentAssignmentsKey = "llm_experiment:%s:%s:assignments" // hash of contacts to the variant they got
+	experimentVariantKey     = "llm_experiment:%s:%s:variant:%s"  // hash of counts for a variant
+	experimentOutputsKey     = "llm_experiment:%s:%s:outputs:%s"  // hash of counts of the outputs of a variant
+	experimentTTL            = time.Hour * 24 * 90                // refreshed whenever the experiment is used
+	experimentMaxOutputLen   = 50                                 // outputs longer than this aren't counted as outcomes
+	experimentMaxOutputs     = 100                                // maximum distinct outputs counted per variant
+)
+
+// records the outcome of a call for a contact, counting the contact if this is their first call, and counting the
+// output if it's short enough to be a categorical outcome, e.g. a category, and there's room for it
+var recordExperimentScript = valkey.NewScript(3, `
+local first = redis.call("HSETNX", KEYS[1], ARGV[1], ARGV[2])
+redis.call("HINCRBY", KEYS[2], "contacts", first)
+redis.call("HINCRBY", KEYS[2], "calls", 1)
+redis.call("HINCRBY", KEYS[2], "failures", ARGV[3])
+redis.call("HINCRBY", KEYS[2], "tokens_input", ARGV[4])
+redis.call("HINCRBY", KEYS[2], "tokens_output", ARGV[5])
+if ARGV[6] ~= "" and (redis.call("HEXISTS", KEYS[3], ARGV[6]) == 1 or redis.call("HLEN", KEYS[3]) < tonumber(ARGV[7])) then
+	redis.call("HINCRBY", KEYS[3], ARGV[6], 1)
+end
+for _, key in ipairs(KEYS) do
+	redis.call("EXPIRE", key, ARGV[8])
+end
+`)
+
+// store of an LLM's experiment which splits calls by contact, kept in valkey
+type contactLLMExperiment struct {
+	rt      *runtime.Runtime
+	llmUUID string
+	name    string
+}
+
+func (e *contactLLMExperiment) Subject(ctx context.Context) string {
+	if contactID := contactIDFromContext(ctx); contactID != NilContactID {
+		return strconv.Itoa(int(contactID))
+	}
+	return ""
+}
+
+func (e *contactLLMExperiment) Variant(ctx context.Context, subject string) (string, error) {
+	vc := e.rt.VK.Get()
+	defer vc.Close()
+
+	variant, err := valkey.String(valkey.DoContext(vc, ctx, "HGET", fmt.Sprintf(experimentAssignmentsKey, e.llmUUID, e.name), subject))
+	if err != nil && err != valkey.ErrNil {
+		return "", err
+	}
+	return variant, nil
+}
+
+func (e *contactLLMExperiment) Record(ctx context.Context, subject, variant string, resp *ai.Response, err error) error {
+	vc := e.rt.VK.Get()
+	defer vc.Close()
+
+	failed, tokensIn, tokensOut, output := 0, int64(0), int64(0), ""
+	if err != nil {
+		failed = 1
+	} else {
+		tokensIn, tokensOut = resp.TokensInput, resp.TokensOutput
+		if o := strings.ToLower(strings.TrimSpace(resp.Output)); utf8.RuneCountInString(o) <= experimentMaxOutputLen && !strings.Contains(o, "\n") {
+			output = o
+		}
+	}
+
+	_, rerr := recordExperimentScript.DoContext(ctx, vc,
+		fmt.Sprintf(experimentAssignmentsKey, e.llmUUID, e.name),
+		fmt.Sprintf(experimentVariantKey, e.llmUUID, e.name, variant),
+		fmt.Sprintf(experimentOutputsKey, e.llmUUID, e.name, variant),
+		subject, variant, failed, tokensIn, tokensOut, output, experimentMaxOutputs, int(experimentTTL/time.Second),
+	)
+	return rerr
+}
+
+// ExperimentVariantResults are the outcomes of a variant of an LLM's experiment
+type ExperimentVariantResults struct {
+	Name         string           `json:"name"`
+	Contacts     int              `json:"contacts"`
+	Calls        int              `json:"calls"`
+	Failures     int              `json:"failures"`
+	TokensInput  int64            `json:"tokens_input"`
+	TokensOutput int64            `json:"tokens_output"`
+	Outputs      map[string]int64 `json:"outputs"`
+}
+
+// Experiment returns the name of the experiment which splits calls to this LLM between variants, if any
+func (l *LLM) Experiment() string {
+	return l.Config().GetString(configExperiment, "")
+}
+
+// ExperimentResults gets the outcomes of each variant of this LLM's experiment, or nil if it doesn't have one
+func (l *LLM) ExperimentResults(ctx context.Context, rt *runtime.Runtime) ([]*ExperimentVariantResults, error) {
+	name := l.Experiment()
+	if name == "" {
+		return nil, nil
+	}
+
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	variants := l.Config().GetConfigList(configExperimentVariants)
+	results := make([]*ExperimentVariantResults, 0, len(variants))
+
+	for _, v := range variants {
+		variant := v.GetString("name", "")
+		if variant == "" {
+			continue
+		}
+
+		counts, err := valkey.Int64Map(valkey.DoContext(vc, ctx, "HGETALL", fmt.Sprintf(experimentVariantKey, l.UUID(), name, variant)))
+		if err != nil {
+			return nil, fmt.Errorf("error getting experiment counts: %w", err)
+		}
+		outputs, err := valkey.Int64Map(valkey.DoContext(vc, ctx, "HGETALL", fmt.Sprintf(experimentOutputsKey, l.UUID(), name, variant)))
+		if err != nil {
+			return nil, fmt.Errorf("error getting experiment outputs: %w", err)
+		}
+
+		results = append(results, &ExperimentVariantResults{
+			Name:         variant,
+			Contacts:     int(counts["contacts"]),
+			Calls:        int(counts["calls"]),
+			Failures:     int(counts["failures"]),
+			TokensInput:  counts["tokens_input"],
+			TokensOutput: counts["tokens_output"],
+			Outputs:      outputs,
+		})
+	}
+	return results, nil
+}
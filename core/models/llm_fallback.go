@@ -0,0 +1,86 @@
+package models
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+)
+
+// LLMDegradations collects the outputs of LLM calls during a flow sprint which were fallback responses given because
+// the calls couldn't be made, so that the calls can be recorded as degraded when the events of the sprint are handled
+type LLMDegradations struct {
+	mutex   sync.Mutex
+	outputs map[string]string // output to error code of the failed call
+}
+
+// NewLLMDegradations creates a new empty collection of degraded calls
+func NewLLMDegradations() *LLMDegradations {
+	return &LLMDegradations{outputs: make(map[string]string)}
+}
+
+// WithLLMDegradations returns a copy of the given context in which calls given fallback responses are collected
+func WithLLMDegradations(ctx context.Context, d *LLMDegradations) context.Context {
+	return context.WithValue(ctx, llmDegradationsKey, d)
+}
+
+func (d *LLMDegradations) add(output, code string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.outputs[output] = code
+}
+
+// Take returns the error code of the failed call if the given output was a fallback response, removing it from the
+// collection, or empty if it wasn't
+func (d *LLMDegradations) Take(output string) string {
+	if d == nil {
+		return ""
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	code := d.outputs[output]
+	delete(d.outputs, output)
+	return code
+}
+
+// source of the fallback responses of an LLM, which are only given to calls made by flows for contacts, in their
+// language if there's a response in it, or otherwise in the org's default language
+type llmFallback struct {
+	llm *LLM
+}
+
+func (f *llmFallback) Response(ctx context.Context) string {
+	v, _ := ctx.Value(llmVariablesKey).(*LLMVariables)
+	if v == nil {
+		return ""
+	}
+
+	langs := make([]i18n.Language, 0, 2)
+	if v.contact != nil && v.contact.Language() != i18n.NilLanguage {
+		langs = append(langs, v.contact.Language())
+	}
+	langs = append(langs, v.oa.Env().DefaultLanguage())
+
+	return f.llm.FallbackResponse(langs...)
+}
+
+// LLM service which notes the outputs of calls made during flow sprints which were fallback responses
+type llmDegradationsService struct {
+	service ai.Service
+}
+
+func (s *llmDegradationsService) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	resp, err := s.service.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if d, _ := ctx.Value(llmDegradationsKey).(*LLMDegradations); d != nil && resp.Degraded {
+		d.add(resp.Output, resp.DegradedCode)
+	}
+	return resp, nil
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// guards requests which are sent directly to the provider of an LLM rather than made as calls, e.g. streams and
+// embeddings, so that they're still limited by the org's rate limit and budget and the LLM's breaker, spend from that
+// budget, and are logged if they fail. They're refused for LLMs which redact what is sent to them as redaction can only be applied to calls.
+type llmGuard struct {
+	rt  *runtime.Runtime
+	llm *LLM
+}
+
+func (g *llmGuard) Allow(ctx context.Context) error {
+	if mode := ai.RedactMode(g.llm.Config().GetString(configRedactPII, "")); mode == ai.RedactModeStrip || mode == ai.RedactModePseudonymize {
+		return &ai.ServiceError{Message: "LLM redacts what is sent to it so can only be used for calls", Code: ai.ErrorUnknown}
+	}
+
+	if allowed, err := (&orgLLMRateLimiter{rt: g.rt, orgID: g.llm.OrgID()}).Allow(ctx); err == nil && !allowed {
+		return &ai.ServiceError{Message: "rate limit exceeded", Code: ai.ErrorRateLimit}
+	}
+	if exceeded, err := (&orgLLMBudget{rt: g.rt, orgID: g.llm.OrgID()}).Exceeded(ctx); err == nil && exceeded {
+		return &ai.ServiceError{Message: "token budget exceeded", Code: ai.ErrorBudgetExceeded}
+	}
+	if allowed, err := g.llm.valkeyBreaker(g.rt).Allow(ctx); err == nil && !allowed {
+		return &ai.ServiceError{Message: "LLM provider unavailable as recent calls have failed", Code: ai.ErrorUnavailable}
+	}
+	return nil
+}
+
+func (g *llmGuard) Done(ctx context.Context, usage *ai.Usage, err error) {
+	canceled := ctx.Err() != nil
+
+	// detach from the request's context as we want to record what happened even if it was canceled, e.g. by the
+	// consumer of a stream going away
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if usage != nil {
+		if tokens := usage.TokensInput + usage.TokensOutput; tokens > 0 {
+			if serr := (&orgLLMBudget{rt: g.rt, orgID: g.llm.OrgID()}).Spend(ctx, tokens); serr != nil {
+				slog.Error("error recording token spend of llm request", "error", serr, "llm_id", g.llm.ID())
+			}
+		}
+	}
+
+	breaker := g.llm.valkeyBreaker(g.rt)
+
+	if err == nil {
+		breaker.Success(ctx)
+		return
+	}
+
+	if !canceled && ai.IsProviderFailure(err) {
+		breaker.Failure(ctx)
+	}
+
+	call := NewLLMCall(g.llm.OrgID(), g.llm.ID(), NilFlowID, contactIDFromContext(ctx), 0, 0, 0, err)
+	if lerr := InsertLLMCalls(ctx, g.rt.DB, []*LLMCall{call}); lerr != nil {
+		slog.Error("error recording failed llm request", "error", lerr, "llm_id", g.llm.ID())
+	}
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clients are shared by all services for the same LLM and HTTP config so that connections are reused
+var (
+	llmClients   = map[string]*http.Client{}
+	llmClientsMu sync.Mutex
+)
+
+// HTTPClient returns the client which requests to this LLM's provider are made with, which is a copy of the given client
+// which honors any timeout, connect timeout or proxy configured by this LLM, and logs requests with secrets redacted when
+// their context has a collector of LLM HTTP logs
+func (l *LLM) HTTPClient(client *http.Client) (*http.Client, error) {
+	timeout := time.Duration(l.Config().GetInt(configTimeout, 0)) * time.Second
+	connectTimeout := time.Duration(l.Config().GetInt(configConnectTimeout, 0)) * time.Second
+	proxyURL := l.Config().GetString(configProxyURL, "")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var proxy *url.URL
+	if proxyURL != "" {
+		var err error
+		proxy, err = url.Parse(proxyURL)
+		if err != nil || (proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5") || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL for LLM %s: %s", l.UUID(), proxyURL)
+		}
+	}
+
+	llmClientsMu.Lock()
+	defer llmClientsMu.Unlock()
+
+	// the transport of the given client may be replaced, e.g. in tests, so it's part of the key too, as are the secrets
+	// which are redacted from logs, hashed so that they aren't kept in the key
+	secrets := fnv.New64a()
+	secrets.Write([]byte(strings.Join(l.secrets(), "\x00")))
+
+	key := fmt.Sprintf("%s|%s|%s|%s|%x|%p|%p", l.UUID(), timeout, connectTimeout, proxyURL, secrets.Sum64(), client, client.Transport)
+	if c := llmClients[key]; c != nil {
+		return c, nil
+	}
+
+	c := *client
+	if timeout > 0 {
+		c.Timeout = timeout
+	}
+
+	// only real transports can be reconfigured, others such as mocks in tests are used as is
+	transport := c.Transport
+	if transport == nil && (connectTimeout > 0 || proxy != nil) {
+		transport = http.DefaultTransport
+	}
+	if t, ok := transport.(*http.Transport); ok && (connectTimeout > 0 || proxy != nil) {
+		t = t.Clone()
+		if connectTimeout > 0 {
+			t.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+		}
+		if proxy != nil {
+			t.Proxy = http.ProxyURL(proxy)
+		}
+		transport = t
+	}
+	c.Transport = &llmTraceTransport{inner: transport, redact: l.redactor()}
+
+	llmClients[key] = &c
+	return &c, nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+type contextKey int
+
+const (
+	contactIDKey contextKey = iota
+	quickRepliesKey
+	llmDeferralsKey
+	llmHTTPLogsKey
+	llmVariablesKey
+	llmDegradationsKey
+	llmAttachmentsKey
+)
+
+// WithContactID returns a copy of the given context for calls made on behalf of the given contact, e.g. by their
+// flow session, so that LLMs can remember their conversations with that contact
+func WithContactID(ctx context.Context, contactID ContactID) context.Context {
+	return context.WithValue(ctx, contactIDKey, contactID)
+}
+
+func contactIDFromContext(ctx context.Context) ContactID {
+	id, _ := ctx.Value(contactIDKey).(ContactID)
+	return id
+}
+
+// memory of an LLM's conversations with contacts, stored in the database
+type contactLLMMemory struct {
+	rt    *runtime.Runtime
+	llmID LLMID
+}
+
+const sqlSelectLLMConversation = `SELECT summary, turns FROM ai_conversation WHERE contact_id = $1 AND llm_id = $2`
+
+func (m *contactLLMMemory) Load(ctx context.Context) (*ai.Conversation, error) {
+	contactID := contactIDFromContext(ctx)
+	if contactID == NilContactID {
+		return nil, nil
+	}
+
+	var summary string
+	var turns []byte
+
+	err := m.rt.DB.QueryRowContext(ctx, sqlSelectLLMConversation, contactID, m.llmID).Scan(&summary, &turns)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &ai.Conversation{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading conversation: %w", err)
+	}
+
+	conv := &ai.Conversation{Summary: summary}
+	if err := json.Unmarshal(turns, &conv.Turns); err != nil {
+		return nil, fmt.Errorf("error unmarshaling conversation turns: %w", err)
+	}
+	return conv, nil
+}
+
+const sqlUpsertLLMConversation = `
+INSERT INTO ai_conversation(contact_id, llm_id, summary, turns, modified_on) VALUES($1, $2, $3, $4, NOW())
+ON CONFLICT (contact_id, llm_id) DO UPDATE SET summary = EXCLUDED.summary, turns = EXCLUDED.turns, modified_on = EXCLUDED.modified_on`
+
+func (m *contactLLMMemory) Save(ctx context.Context, c *ai.Conversation) error {
+	turns, err := json.Marshal(c.Turns)
+	if err != nil {
+		return fmt.Errorf("error marshaling conversation turns: %w", err)
+	}
+
+	if _, err := m.rt.DB.ExecContext(ctx, sqlUpsertLLMConversation, contactIDFromContext(ctx), m.llmID, c.Summary, string(turns)); err != nil {
+		return fmt.Errorf("error saving conversation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+)
+
+// maximum number of quick replies an LLM can be configured to suggest
+const maxLLMQuickReplies = 10
+
+// LLMQuickReplies collects the quick replies which LLMs suggest alongside their outputs during a flow sprint, so that
+// they can be added to outgoing messages which include those outputs
+type LLMQuickReplies struct {
+	mutex   sync.Mutex
+	outputs []string
+	replies [][]string
+}
+
+// NewLLMQuickReplies creates a new empty collection of quick replies
+func NewLLMQuickReplies() *LLMQuickReplies {
+	return &LLMQuickReplies{}
+}
+
+// WithLLMQuickReplies returns a copy of the given context in which quick replies suggested by LLMs are collected
+func WithLLMQuickReplies(ctx context.Context, qr *LLMQuickReplies) context.Context {
+	return context.WithValue(ctx, quickRepliesKey, qr)
+}
+
+func (q *LLMQuickReplies) add(output string, replies []string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.outputs = append(q.outputs, strings.TrimSpace(output))
+	q.replies = append(q.replies, replies)
+}
+
+// For returns the quick replies suggested alongside the most recent output which the given text of a message includes
+func (q *LLMQuickReplies) For(text string) []flows.QuickReply {
+	if q == nil {
+		return nil
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i := len(q.outputs) - 1; i >= 0; i-- {
+		if q.outputs[i] != "" && strings.Contains(text, q.outputs[i]) {
+			qrs := make([]flows.QuickReply, len(q.replies[i]))
+			for j, r := range q.replies[i] {
+				qrs[j] = flows.QuickReply{Type: "text", Text: r}
+			}
+			return qrs
+		}
+	}
+	return nil
+}
+
+// LLM service which has the model suggest quick replies for calls made during flow sprints, where they can be added to
+// outgoing messages, and otherwise makes calls as is
+type llmQuickRepliesService struct {
+	plain       ai.Service
+	withReplies ai.Service
+}
+
+func (s *llmQuickRepliesService) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	qr, _ := ctx.Value(quickRepliesKey).(*LLMQuickReplies)
+	if qr == nil {
+		return s.plain.Call(ctx, req)
+	}
+
+	resp, err := s.withReplies.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.QuickReplies) > 0 {
+		qr.add(resp.Output, resp.QuickReplies)
+	}
+	return resp, nil
+}
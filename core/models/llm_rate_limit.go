@@ -0,0 +1,61 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// token bucket which holds up to a limit of tokens, refilled at that limit per minute, and which is full if it doesn't
+// exist. Returns 1 if a token was taken and 0 if the bucket was empty.
+var takeLLMRateTokenScript = valkey.NewScript(1, `
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local now_ms = tonumber(ARGV[2])
+
+local state = redis.call("HMGET", key, "tokens", "ts")
+local tokens = tonumber(state[1]) or limit
+local ts = tonumber(state[2]) or now_ms
+
+tokens = math.min(limit, tokens + math.max(0, now_ms - ts) * limit / 60000)
+
+local taken = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	taken = 1
+end
+
+redis.call("HSET", key, "tokens", tostring(tokens), "ts", now_ms)
+redis.call("PEXPIRE", key, 60000)
+return taken
+`)
+
+// rate limiter for the LLM calls of an org, shared by all instances
+type orgLLMRateLimiter struct {
+	rt    *runtime.Runtime
+	orgID OrgID
+}
+
+func (l *orgLLMRateLimiter) Allow(ctx context.Context) (bool, error) {
+	oa, err := GetOrgAssets(ctx, l.rt, l.orgID)
+	if err != nil {
+		return false, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	limit := oa.Org().LLMCallsPerMinute(l.rt.Config.LLMCallsPerMinute)
+	if limit <= 0 {
+		return true, nil
+	}
+
+	vc := l.rt.VK.Get()
+	defer vc.Close()
+
+	taken, err := valkey.Int(takeLLMRateTokenScript.DoContext(ctx, vc, fmt.Sprintf("llm_rate:%d", l.orgID), limit, dates.Now().UnixMilli()))
+	if err != nil {
+		return false, fmt.Errorf("error taking rate limit token: %w", err)
+	}
+	return taken == 1, nil
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// values of some fields of the contact that LLM calls are being made for, which are redacted from those calls
+type contactFieldValues struct {
+	rt     *runtime.Runtime
+	orgID  OrgID
+	fields []string // field keys
+}
+
+const sqlSelectContactFields = `SELECT fields FROM contacts_contact WHERE id = $1 AND org_id = $2`
+
+func (v *contactFieldValues) Values(ctx context.Context) ([]string, error) {
+	contactID := contactIDFromContext(ctx)
+	if contactID == NilContactID {
+		return nil, nil
+	}
+
+	oa, err := GetOrgAssets(ctx, v.rt, v.orgID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	var raw []byte
+	err = v.rt.DB.QueryRowContext(ctx, sqlSelectContactFields, contactID, v.orgID).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading contact fields: %w", err)
+	}
+
+	var fieldValues map[string]struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &fieldValues); err != nil {
+		return nil, fmt.Errorf("error unmarshaling contact fields: %w", err)
+	}
+
+	values := make([]string, 0, len(v.fields))
+	for _, key := range v.fields {
+		if field := oa.FieldByKey(key); field != nil {
+			if fv := fieldValues[string(field.UUID())]; fv.Text != "" {
+				values = append(values, fv.Text)
+			}
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+const (
+	sentimentOrgsKey     = "llm_sentiment:orgs"
+	sentimentQueueKeyFmt = "llm_sentiment:%d"
+)
+
+// SentimentMsg is an incoming message waiting to have its sentiment scored
+type SentimentMsg struct {
+	ContactID ContactID `json:"contact_id"`
+	Text      string    `json:"text"`
+}
+
+// pops up to the given number of messages off an org's queue, removing the org from the set of orgs with queued
+// messages if that empties it, so that messages queued in the meantime are never missed
+var popSentimentMsgsScript = valkey.NewScript(2, `
+local items = redis.call("LPOP", KEYS[1], ARGV[1])
+if redis.call("LLEN", KEYS[1]) == 0 then
+	redis.call("SREM", KEYS[2], ARGV[2])
+end
+return items or {}
+`)
+
+// QueueSentimentMsg queues an incoming message to have its sentiment scored in a batch with others of the same org
+func QueueSentimentMsg(ctx context.Context, rt *runtime.Runtime, orgID OrgID, m *SentimentMsg) error {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	vc.Send("MULTI")
+	vc.Send("RPUSH", fmt.Sprintf(sentimentQueueKeyFmt, orgID), jsonx.MustMarshal(m))
+	vc.Send("SADD", sentimentOrgsKey, orgID)
+	if _, err := valkey.DoContext(vc, ctx, "EXEC"); err != nil {
+		return fmt.Errorf("error queuing message for sentiment scoring: %w", err)
+	}
+	return nil
+}
+
+// GetSentimentOrgs gets the orgs which have messages queued to have their sentiment scored
+func GetSentimentOrgs(ctx context.Context, rt *runtime.Runtime) ([]OrgID, error) {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	ids, err := valkey.Ints(valkey.DoContext(vc, ctx, "SMEMBERS", sentimentOrgsKey))
+	if err != nil {
+		return nil, fmt.Errorf("error getting orgs with queued sentiment messages: %w", err)
+	}
+
+	orgIDs := make([]OrgID, len(ids))
+	for i, id := range ids {
+		orgIDs[i] = OrgID(id)
+	}
+	return orgIDs, nil
+}
+
+// PopSentimentMsgs pops up to the given number of the oldest messages queued by the given org
+func PopSentimentMsgs(ctx context.Context, rt *runtime.Runtime, orgID OrgID, limit int) ([]*SentimentMsg, error) {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	items, err := valkey.ByteSlices(popSentimentMsgsScript.DoContext(ctx, vc, fmt.Sprintf(sentimentQueueKeyFmt, orgID), sentimentOrgsKey, limit, orgID))
+	if err != nil {
+		return nil, fmt.Errorf("error popping sentiment messages: %w", err)
+	}
+
+	msgs := make([]*SentimentMsg, len(items))
+	for i, item := range items {
+		msgs[i] = &SentimentMsg{}
+		if err := json.Unmarshal(item, msgs[i]); err != nil {
+			return nil, fmt.Errorf("error unmarshaling sentiment message: %w", err)
+		}
+	}
+	return msgs, nil
+}
@@ -0,0 +1,50 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSentimentMsgs(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetValkey)
+
+	orgIDs, err := models.GetSentimentOrgs(ctx, rt)
+	assert.NoError(t, err)
+	assert.Len(t, orgIDs, 0)
+
+	for _, text := range []string{"one", "two", "three"} {
+		require.NoError(t, models.QueueSentimentMsg(ctx, rt, testdb.Org1.ID, &models.SentimentMsg{ContactID: testdb.Ann.ID, Text: text}))
+	}
+
+	orgIDs, err = models.GetSentimentOrgs(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.OrgID{testdb.Org1.ID}, orgIDs)
+
+	msgs, err := models.PopSentimentMsgs(ctx, rt, testdb.Org1.ID, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.SentimentMsg{{ContactID: testdb.Ann.ID, Text: "one"}, {ContactID: testdb.Ann.ID, Text: "two"}}, msgs)
+
+	// org still has a message queued
+	orgIDs, err = models.GetSentimentOrgs(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.OrgID{testdb.Org1.ID}, orgIDs)
+
+	msgs, err = models.PopSentimentMsgs(ctx, rt, testdb.Org1.ID, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.SentimentMsg{{ContactID: testdb.Ann.ID, Text: "three"}}, msgs)
+
+	orgIDs, err = models.GetSentimentOrgs(ctx, rt)
+	assert.NoError(t, err)
+	assert.Len(t, orgIDs, 0)
+
+	msgs, err = models.PopSentimentMsgs(ctx, rt, testdb.Org1.ID, 2)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 0)
+}
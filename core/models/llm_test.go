@@ -1,6 +1,12 @@
 package models_test
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,9 +15,11 @@ import (
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/mailroom/v26/core/ai"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/testsuite"
 	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/nyaruka/vkutil/assertvk"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -70,21 +78,102 @@ func TestLLMRecordCall(t *testing.T) {
 		return events.NewLLMCalled(flows.NewLLM(llm), "instructions", "input", &flows.LLMResponse{Output: "output", TokensInput: in, TokensOutput: out}, 250*time.Millisecond)
 	}
 
-	assert.Len(t, llm.RecordCall(rt, oa, mkEvent(120, 340)), 3)
-	assert.Len(t, llm.RecordCall(rt, oa, mkEvent(80, 200)), 3)
-	assert.Len(t, llm.RecordCall(rt, oa, mkEvent(0, 0)), 1)
+	assert.Len(t, llm.RecordCall(oa, testdb.Favorites.ID, mkEvent(120, 340)), 3)
+	assert.Len(t, llm.RecordCall(oa, testdb.Favorites.ID, mkEvent(80, 200)), 3)
+	assert.Len(t, llm.RecordCall(oa, models.NilFlowID, mkEvent(0, 0)), 1)
 
 	var allCounts []*models.LLMDailyCount
-	allCounts = append(allCounts, llm.RecordCall(rt, oa, mkEvent(120, 340))...)
-	allCounts = append(allCounts, llm.RecordCall(rt, oa, mkEvent(80, 200))...)
-	allCounts = append(allCounts, llm.RecordCall(rt, oa, mkEvent(0, 0))...)
+	allCounts = append(allCounts, llm.RecordCall(oa, testdb.Favorites.ID, mkEvent(120, 340))...)
+	allCounts = append(allCounts, llm.RecordCall(oa, testdb.Favorites.ID, mkEvent(80, 200))...)
+	allCounts = append(allCounts, llm.RecordCall(oa, models.NilFlowID, mkEvent(0, 0))...)
+	allCounts = append(allCounts, llm.RecordError(oa, testdb.Favorites.ID, "ratelimit")...)
+	allCounts = append(allCounts, llm.RecordError(oa, models.NilFlowID, "timeout")...)
 
 	require.NoError(t, models.InsertLLMDailyCounts(ctx, rt.DB, allCounts))
 
-	assertdb.Query(t, rt.DB, `SELECT COUNT(*) FROM ai_llmcount WHERE llm_id = $1`, testdb.OpenAI.ID).Returns(7)
+	assertdb.Query(t, rt.DB, `SELECT COUNT(*) FROM ai_llmcount WHERE llm_id = $1`, testdb.OpenAI.ID).Returns(9)
 	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'calls'`, testdb.OpenAI.ID).Returns(int64(3))
 	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'tokens:in'`, testdb.OpenAI.ID).Returns(int64(200))
 	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'tokens:out'`, testdb.OpenAI.ID).Returns(int64(540))
+	assertdb.Query(t, rt.DB, `SELECT COUNT(*) FROM ai_llmcount WHERE llm_id = $1 AND scope IN ('errors:ratelimit', 'errors:timeout')`, testdb.OpenAI.ID).Returns(2)
+
+	// calls made by flows are also counted against those flows
+	assertdb.Query(t, rt.DB, `SELECT COUNT(*) FROM ai_llmflowcount WHERE flow_id = $1 AND llm_id = $2`, testdb.Favorites.ID, testdb.OpenAI.ID).Returns(7)
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmflowcount WHERE flow_id = $1 AND scope = 'calls'`, testdb.Favorites.ID).Returns(int64(2))
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmflowcount WHERE flow_id = $1 AND scope = 'errors:ratelimit'`, testdb.Favorites.ID).Returns(int64(1))
+
+	report, err := models.GetLLMUsageReport(ctx, rt.DB, testdb.Org1.ID, dates.NewDate(2026, 5, 1), dates.NewDate(2026, 5, 31))
+	require.NoError(t, err)
+	assert.Equal(t, &models.LLMUsageTotals{Calls: 3, TokensInput: 200, TokensOutput: 540, Errors: map[string]int64{"ratelimit": 1, "timeout": 1}}, report.Total)
+	if assert.Len(t, report.Days, 1) {
+		assert.Equal(t, "2026-05-04", report.Days[0].Day)
+	}
+	if assert.Len(t, report.LLMs, 1) {
+		assert.Equal(t, testdb.OpenAI.ID, report.LLMs[0].LLMID)
+	}
+	if assert.Len(t, report.Flows, 1) {
+		assert.Equal(t, testdb.Favorites.ID, report.Flows[0].FlowID)
+		assert.Equal(t, int64(2), report.Flows[0].Calls)
+		assert.Equal(t, map[string]int64{"ratelimit": 1}, report.Flows[0].Errors)
+	}
+
+	// nothing in other periods
+	report, err = models.GetLLMUsageReport(ctx, rt.DB, testdb.Org1.ID, dates.NewDate(2026, 6, 1), dates.NewDate(2026, 6, 30))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), report.Total.Calls)
+	assert.Len(t, report.Days, 0)
+	assert.Len(t, report.Flows, 0)
+}
+
+func TestLLMRecordCallCost(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData|testsuite.ResetValkey)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdb.Org1.ID)
+	require.NoError(t, err)
+
+	ai.RegisterPricing("priced-model", &ai.Pricing{Input: 2.5, Output: 10})
+
+	llm := &models.LLM{ID_: testdb.OpenAI.ID, Type_: "openai", Model_: "priced-model-2025-01-01"}
+	event := events.NewLLMCalled(flows.NewLLM(llm), "instructions", "input", &flows.LLMResponse{Output: "output", TokensInput: 1000, TokensOutput: 200}, 250*time.Millisecond)
+
+	counts := llm.RecordCall(oa, models.NilFlowID, event)
+	assert.Len(t, counts, 4)
+	assert.Equal(t, "cost:microusd", counts[3].Scope)
+	assert.Equal(t, int64(4500), counts[3].Count)
+
+	// calls routed to another model are priced by that model
+	ai.RegisterPricing("cheap-model", &ai.Pricing{Input: 0.5, Output: 2})
+
+	routed := testdb.InsertLLM(t, rt, testdb.Org1, "9c1e4b7a-2d3f-4a5b-8c6d-7e8f9a0b1c2d", "test", "priced-model", "Routed", map[string]any{
+		"experiment": "cheap",
+		"experiment_variants": []any{
+			map[string]any{"name": "control", "weight": 0},
+			map[string]any{"name": "cheap", "model": "cheap-model"},
+		},
+	}, "F")
+
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshLLMs)
+	require.NoError(t, err)
+
+	llm = oa.LLMByID(routed.ID)
+	svc, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	resp, err := svc.(ai.Service).Call(models.WithContactID(ctx, testdb.Ann.ID), &ai.Request{Instructions: "Answer", Input: "\\return Hola", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "cheap-model", resp.Model)
+
+	event = events.NewLLMCalled(flows.NewLLM(llm), "Answer", "\\return Hola", &flows.LLMResponse{Output: "Hola", TokensInput: 1000, TokensOutput: 200}, 250*time.Millisecond)
+
+	counts = llm.RecordCall(oa, models.NilFlowID, event)
+	assert.Equal(t, "cost:microusd", counts[3].Scope)
+	assert.Equal(t, int64(900), counts[3].Count)
+
+	// and the model is only used once, so another call with the same output is priced by the LLM's own model
+	counts = llm.RecordCall(oa, models.NilFlowID, event)
+	assert.Equal(t, int64(4500), counts[3].Count)
 }
 
 func TestLLMMaxOutputTokens(t *testing.T) {
@@ -103,3 +192,674 @@ func TestLLMMaxOutputTokens(t *testing.T) {
 		assert.Equal(t, tc.expected, l.MaxOutputTokens(), "configured=%d", tc.configured)
 	}
 }
+
+// gets the transport that an LLM client makes requests with, from inside the transport which logs them
+func unwrapTransport(c *http.Client) http.RoundTripper {
+	return c.Transport.(interface{ Unwrap() http.RoundTripper }).Unwrap()
+}
+
+func TestLLMHTTPClient(t *testing.T) {
+	base := &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone(), Timeout: 15 * time.Second}
+
+	// LLMs without HTTP config use a copy of the given client
+	llm := &models.LLM{UUID_: "8a7b6c5d-4e3f-4a2b-9c1d-0e9f8a7b6c5d", Config_: map[string]any{}}
+	client, err := llm.HTTPClient(base)
+	require.NoError(t, err)
+	assert.NotSame(t, base, client)
+	assert.Equal(t, 15*time.Second, client.Timeout)
+
+	llm = &models.LLM{UUID_: "8a7b6c5d-4e3f-4a2b-9c1d-0e9f8a7b6c5d", Config_: map[string]any{"timeout": 60, "connect_timeout": 5, "proxy_url": "http://proxy.example.com:3128"}}
+	client, err = llm.HTTPClient(base)
+	require.NoError(t, err)
+	assert.NotSame(t, base, client)
+	assert.Equal(t, time.Minute, client.Timeout)
+	assert.Equal(t, 15*time.Second, base.Timeout)
+
+	transport := unwrapTransport(client)
+	assert.NotNil(t, transport.(*http.Transport).DialContext)
+	proxy, err := transport.(*http.Transport).Proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: "api.openai.com"}})
+	require.NoError(t, err)
+	assert.Equal(t, "http://proxy.example.com:3128", proxy.String())
+
+	// and clients are reused
+	client2, err := llm.HTTPClient(base)
+	require.NoError(t, err)
+	assert.Same(t, client, client2)
+
+	// transports which can't be reconfigured, e.g. mocks, are used as is
+	mocked := &http.Client{Transport: http.NewFileTransport(http.Dir("."))}
+	client, err = llm.HTTPClient(mocked)
+	require.NoError(t, err)
+	assert.Equal(t, mocked.Transport, unwrapTransport(client))
+	assert.Equal(t, time.Minute, client.Timeout)
+
+	llm = &models.LLM{UUID_: "8a7b6c5d-4e3f-4a2b-9c1d-0e9f8a7b6c5d", Config_: map[string]any{"proxy_url": "ftp://proxy"}}
+	_, err = llm.HTTPClient(base)
+	assert.EqualError(t, err, "invalid proxy URL for LLM 8a7b6c5d-4e3f-4a2b-9c1d-0e9f8a7b6c5d: ftp://proxy")
+}
+
+func TestLLMHTTPLogs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"output": "Hola", "key": "sesame"}`))
+	}))
+	defer server.Close()
+
+	llm := &models.LLM{UUID_: "1c2d3e4f-5a6b-4c7d-8e9f-0a1b2c3d4e5f", Config_: map[string]any{"api_key": "sesame"}}
+	client, err := llm.HTTPClient(&http.Client{})
+	require.NoError(t, err)
+
+	request := func(ctx context.Context) {
+		req, _ := http.NewRequestWithContext(ctx, "POST", server.URL+"/v1/responses?key=sesame", strings.NewReader(`{"input": "Hello"}`))
+		req.Header.Set("Authorization", "Bearer sesame")
+		req.Header.Set("X-Goog-Api-Key", "abc123")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	// requests without a collector in their context aren't logged
+	request(context.Background())
+
+	logs := models.NewLLMHTTPLogs()
+	request(models.WithLLMHTTPLogs(context.Background(), logs))
+
+	if assert.Len(t, logs.Logs(), 1) {
+		log := logs.Logs()[0]
+		assert.Equal(t, server.URL+"/v1/responses?key=****************", log.URL)
+		assert.Equal(t, 200, log.StatusCode)
+		assert.Equal(t, flows.CallStatusSuccess, log.Status)
+		assert.Contains(t, log.Request, "Authorization: ****************\r\n")
+		assert.Contains(t, log.Request, "X-Goog-Api-Key: ****************\r\n")
+		assert.Contains(t, log.Request, `{"input": "Hello"}`)
+		assert.Contains(t, log.Response, `{"output": "Hola", "key": "****************"}`)
+		assert.NotContains(t, log.Request, "sesame")
+		assert.NotContains(t, log.Request, "abc123")
+	}
+
+	// taking logs empties the collector
+	assert.Len(t, logs.Take(), 1)
+	assert.Len(t, logs.Logs(), 0)
+}
+
+func TestLLMParams(t *testing.T) {
+	newLLM := func(cfg map[string]any) *models.LLM {
+		return &models.LLM{Type_: "openai", Model_: "gpt-4", Config_: cfg}
+	}
+
+	// no preset or explicit params
+	assert.Equal(t, ai.Params{}, newLLM(map[string]any{"api_key": "sesame"}).Params())
+
+	// unknown preset is ignored
+	assert.Equal(t, ai.Params{}, newLLM(map[string]any{"preset": "xxx"}).Params())
+
+	// preset expands to its params
+	assert.Equal(t, ai.Params{Temperature: new(0.9), TopP: new(0.95)}, newLLM(map[string]any{"preset": "creative"}).Params())
+	assert.Equal(t, ai.Params{Temperature: new(0.000001), JSONMode: new(true)}, newLLM(map[string]any{"preset": "json"}).Params())
+
+	// explicit config overrides preset
+	assert.Equal(t, ai.Params{Temperature: new(0.7), TopP: new(0.95)}, newLLM(map[string]any{"preset": "creative", "temperature": 0.7}).Params())
+	assert.Equal(t, ai.Params{Temperature: new(0.000001), JSONMode: new(false)}, newLLM(map[string]any{"preset": "json", "json_mode": false}).Params())
+
+	// explicit config without preset
+	assert.Equal(t, ai.Params{Temperature: new(0.2), TopP: new(0.5)}, newLLM(map[string]any{"temperature": "0.2", "top_p": 0.5}).Params())
+	assert.Equal(t, ai.Params{Seed: new(int64(42)), FrequencyPenalty: new(0.5), PresencePenalty: new(-0.2)}, newLLM(map[string]any{"seed": 42, "frequency_penalty": 0.5, "presence_penalty": "-0.2"}).Params())
+}
+
+func TestLLMLanguageRouting(t *testing.T) {
+	llm := &models.LLM{Type_: "test", Model_: "gpt-4o-mini", Config_: map[string]any{"language_models": map[string]any{"ara": "gpt-4o"}}}
+
+	svc, err := llm.AsService(nil, nil)
+	require.NoError(t, err)
+
+	resp, err := svc.(ai.Service).Call(context.Background(), &ai.Request{Instructions: "Categorize... [Yes, No]", Input: "نعم", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "No", resp.Output)
+	assert.Equal(t, "gpt-4o", resp.Model)
+
+	resp, err = svc.(ai.Service).Call(context.Background(), &ai.Request{Instructions: "Categorize... [Yes, No]", Input: "yes it is", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", resp.Model)
+}
+
+func TestLLMFallback(t *testing.T) {
+	llm := &models.LLM{UUID_: "4e8f1c2a-6b3d-4f5e-9a7b-1c2d3e4f5a6b", Type_: "test", Model_: "gpt-4o", Config_: map[string]any{"fallback_models": []any{"gpt-4o-mini"}}}
+
+	svc, err := llm.AsService(nil, nil)
+	require.NoError(t, err)
+
+	// test service errors on this input regardless of model, so both are tried
+	_, err = svc.(ai.Service).Call(context.Background(), &ai.Request{Instructions: "Answer", Input: "\\error boom", MaxTokens: 100})
+	assert.EqualError(t, err, "boom")
+
+	resp, err := svc.(ai.Service).Call(context.Background(), &ai.Request{Instructions: "Categorize... [Yes, No]", Input: "yes", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o", resp.Model)
+	assert.Nil(t, resp.Diagnostics)
+}
+
+func TestLLMParallel(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	ai.RegisterPricing("cheap-model", &ai.Pricing{Input: 0.1, Output: 0.4})
+	ai.RegisterPricing("pricey-model", &ai.Pricing{Input: 5, Output: 15})
+
+	other := testdb.InsertLLM(t, rt, testdb.Org1, "0b3c2f5e-7d6a-4e8b-9c1d-2e3f4a5b6c7d", "test", "cheap-model", "Cheap", map[string]any{}, "E")
+
+	llm := &models.LLM{ID_: testdb.TestLLM.ID, UUID_: testdb.TestLLM.UUID, OrgID_: testdb.Org1.ID, Type_: "test", Model_: "pricey-model", Config_: map[string]any{"parallel_uuid": string(other.UUID), "parallel_strategy": "cheapest"}}
+
+	svc, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	// both LLMs are called and the response of the cheaper one is used
+	resp, err := svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "Answer", Input: "\\return Hola", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Equal(t, "cheap-model", resp.Model)
+	assert.Equal(t, int64(90), resp.TokensInput)
+	assert.Equal(t, []string{"selected cheap-model from 2 responses"}, resp.Diagnostics)
+}
+
+func TestLLMExperiment(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetValkey)
+
+	llm := &models.LLM{UUID_: "5d2e8f1a-3b4c-4d6e-9f7a-8b1c2d3e4f5a", Type_: "test", Model_: "gpt-4o", Config_: map[string]any{
+		"experiment": "greeting",
+		"experiment_variants": []any{
+			map[string]any{"name": "control", "weight": 0},
+			map[string]any{"name": "brief", "instructions": "{instructions} Be brief."},
+		},
+	}}
+	assert.Equal(t, "greeting", llm.Experiment())
+
+	svc, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	req := &ai.Request{Instructions: "Answer", Input: "\\return Hola", MaxTokens: 100}
+
+	// calls not on behalf of a contact aren't part of the experiment
+	resp, err := svc.(ai.Service).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Nil(t, resp.Diagnostics)
+
+	for range 2 {
+		resp, err = svc.(ai.Service).Call(models.WithContactID(ctx, testdb.Ann.ID), req)
+		require.NoError(t, err)
+		assert.Equal(t, "Hola", resp.Output)
+		assert.Equal(t, []string{"experiment greeting variant brief"}, resp.Diagnostics)
+	}
+
+	results, err := llm.ExperimentResults(ctx, rt)
+	require.NoError(t, err)
+	assert.Equal(t, []*models.ExperimentVariantResults{
+		{Name: "control", Outputs: map[string]int64{}},
+		{Name: "brief", Contacts: 1, Calls: 2, TokensInput: 90, TokensOutput: 156, Outputs: map[string]int64{"hola": 2}},
+	}, results)
+}
+
+func TestLLMQuickReplies(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	llm := &models.LLM{UUID_: "2e9d7c1b-5a3f-4e8d-9b6c-1f0a2b3c4d5e", Type_: "test", Model_: "gpt-4o", Config_: map[string]any{"quick_replies": 2}}
+
+	svc, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	req := &ai.Request{Instructions: "Ask", Input: `\return {"response": "Continue?", "quick_replies": ["Yes", "No", "Later"]}`, MaxTokens: 100}
+
+	// calls outside of flow sprints don't suggest quick replies
+	resp, err := svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "Ask", Input: "\\return Continue?", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "Continue?", resp.Output)
+	assert.Nil(t, resp.QuickReplies)
+
+	// those in flow sprints do, and they're collected by output
+	qr := models.NewLLMQuickReplies()
+	resp, err = svc.(ai.Service).Call(models.WithLLMQuickReplies(ctx, qr), req)
+	require.NoError(t, err)
+	assert.Equal(t, "Continue?", resp.Output)
+	assert.Equal(t, []string{"Yes", "No"}, resp.QuickReplies)
+
+	assert.Equal(t, []flows.QuickReply{{Type: "text", Text: "Yes"}, {Type: "text", Text: "No"}}, qr.For("Thanks! Continue?"))
+	assert.Nil(t, qr.For("Goodbye"))
+	assert.Nil(t, (*models.LLMQuickReplies)(nil).For("Continue?"))
+}
+
+func TestLLMResponseCache(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetValkey)
+
+	llm := &models.LLM{UUID_: "0c9f4a3e-2b1d-4c5e-8f7a-6b5c4d3e2f1a", Type_: "test", Model_: "gpt-4o", Config_: map[string]any{"cache_ttl": 60}}
+
+	svc, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	req := &ai.Request{Instructions: "Categorize... [Yes, No]", Input: "yes", MaxTokens: 100}
+
+	resp, err := svc.(ai.Service).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "No", resp.Output)
+	assert.Nil(t, resp.Diagnostics)
+
+	resp, err = svc.(ai.Service).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "No", resp.Output)
+	assert.Equal(t, int64(0), resp.TokensInput)
+	assert.Equal(t, []string{"served from response cache"}, resp.Diagnostics)
+}
+
+func TestLLMMemory(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	llm := &models.LLM{ID_: testdb.TestLLM.ID, UUID_: testdb.TestLLM.UUID, Type_: "test", Model_: "gpt-4o", Config_: map[string]any{"memory_turns": 2}}
+
+	svc, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	req := &ai.Request{Instructions: "Categorize... [Yes, No]", Input: "yes", MaxTokens: 100}
+
+	// calls not made on behalf of a contact aren't remembered
+	_, err = svc.(ai.Service).Call(ctx, req)
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT COUNT(*) FROM ai_conversation`).Returns(0)
+
+	// but those that are, are
+	annCtx := models.WithContactID(ctx, testdb.Ann.ID)
+	for range 3 {
+		_, err = svc.(ai.Service).Call(annCtx, req)
+		require.NoError(t, err)
+	}
+
+	assertdb.Query(t, rt.DB, `SELECT COUNT(*) FROM ai_conversation WHERE contact_id = $1 AND llm_id = $2`, testdb.Ann.ID, testdb.TestLLM.ID).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT jsonb_array_length(turns) FROM ai_conversation WHERE contact_id = $1`, testdb.Ann.ID).Returns(2)
+}
+
+func TestLLMTokenBudget(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetAll)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = '{"llm_daily_token_budget": 200, "incident_webhook": "http://example.com/incidents"}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	daily, monthly := oa.Org().LLMTokenBudgets()
+	assert.Equal(t, int64(200), daily)
+	assert.Equal(t, int64(0), monthly)
+
+	svc, err := oa.LLMByID(testdb.TestLLM.ID).AsService(rt, nil)
+	require.NoError(t, err)
+
+	// test service uses 123 tokens per call so the second call takes us over budget
+	req := &ai.Request{Instructions: "Categorize... [Yes, No]", Input: "yes", MaxTokens: 100}
+	for range 2 {
+		_, err = svc.(ai.Service).Call(ctx, req)
+		require.NoError(t, err)
+	}
+
+	// tokens spent are persisted as the org's usage
+	assertdb.Query(t, rt.DB, `SELECT COUNT(*), SUM(tokens)::bigint FROM orgs_llmusage WHERE org_id = $1`, testdb.Org1.ID).Columns(map[string]any{"count": int64(2), "sum": int64(246)})
+
+	_, err = svc.(ai.Service).Call(ctx, req)
+	assert.EqualError(t, err, "token budget exceeded")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorBudgetExceeded, serr.Code)
+	}
+
+	// an incident is started and the webhook queued rather than called
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_incident WHERE incident_type = 'llm:budget_exceeded' AND ended_on IS NULL`).Returns(1)
+	assert.Equal(t, map[string][]string{"batch/1": {"fire_incident_webhook"}}, testsuite.GetQueuedTaskTypes(t, rt))
+
+	// further over budget calls don't go to the database to start the incident again, even if it has since ended
+	rt.DB.MustExec(`UPDATE notifications_incident SET ended_on = NOW()`)
+
+	_, err = svc.(ai.Service).Call(ctx, req)
+	assert.EqualError(t, err, "token budget exceeded")
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_incident WHERE incident_type = 'llm:budget_exceeded' AND ended_on IS NULL`).Returns(0)
+	assert.Equal(t, map[string][]string{"batch/1": {"fire_incident_webhook"}}, testsuite.GetQueuedTaskTypes(t, rt))
+}
+
+func TestLLMRateLimit(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetAll)
+
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2026, 5, 4, 13, 14, 30, 0, time.UTC)))
+	defer dates.SetNowFunc(time.Now)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = '{"llm_calls_per_minute": 2}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, oa.Org().LLMCallsPerMinute(0))
+
+	svc, err := oa.LLMByID(testdb.TestLLM.ID).AsService(rt, nil)
+	require.NoError(t, err)
+
+	req := &ai.Request{Instructions: "Categorize... [Yes, No]", Input: "yes", MaxTokens: 100}
+	for range 2 {
+		_, err = svc.(ai.Service).Call(ctx, req)
+		require.NoError(t, err)
+	}
+
+	_, err = svc.(ai.Service).Call(ctx, req)
+	assert.EqualError(t, err, "rate limit exceeded")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorRateLimit, serr.Code)
+	}
+
+	// after 30 seconds the bucket has refilled by one call
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2026, 5, 4, 13, 15, 0, 0, time.UTC)))
+
+	_, err = svc.(ai.Service).Call(ctx, req)
+	assert.NoError(t, err)
+	_, err = svc.(ai.Service).Call(ctx, req)
+	assert.EqualError(t, err, "rate limit exceeded")
+}
+
+func TestLLMRedaction(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = jsonb_build_object($2::text, '{"text": "Female"}'::jsonb) WHERE id = $1`, testdb.Ann.ID, testdb.GenderField.UUID)
+
+	llm := &models.LLM{UUID_: "0c1d2e3f-4a5b-4c6d-8e7f-9a0b1c2d3e4f", OrgID_: testdb.Org1.ID, Type_: "test", Model_: "gpt-4o", Config_: map[string]any{"redact_pii": "strip", "redact_fields": []any{"gender"}}}
+
+	svc, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	req := &ai.Request{Instructions: "Answer", Input: "I'm Female, email ann@example.com or call +250788123456", MaxTokens: 100}
+
+	resp, err := svc.(ai.Service).Call(models.WithContactID(ctx, testdb.Ann.ID), req)
+	require.NoError(t, err)
+	assert.Equal(t, "You asked:\n\nAnswer\n\nI'm [REDACTED], email [REDACTED] or call [REDACTED]", resp.Output)
+
+	// field values are only redacted for calls made for a contact
+	resp, err = svc.(ai.Service).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "You asked:\n\nAnswer\n\nI'm Female, email [REDACTED] or call [REDACTED]", resp.Output)
+}
+
+func TestLLMModeration(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	llm := &models.LLM{UUID_: "7e6d5c4b-3a2f-4e1d-9c8b-7a6f5e4d3c2b", OrgID_: testdb.Org1.ID, Type_: "test", Model_: "gpt-4o", Config_: map[string]any{
+		"moderate_output":      "blocklist",
+		"moderation_blocklist": []any{`\bdragons?\b`},
+		"moderation_fallback":  "Sorry, I can't help with that.",
+	}}
+
+	svc, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	resp, err := svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "Answer", Input: "What time do you open?", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "You asked:\n\nAnswer\n\nWhat time do you open?", resp.Output)
+	assert.False(t, resp.Moderated)
+
+	resp, err = svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "Answer", Input: "Tell me about dragons", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "Sorry, I can't help with that.", resp.Output)
+	assert.True(t, resp.Moderated)
+
+	// invalid patterns are an error
+	llm.Config_["moderation_blocklist"] = []any{`(dragons`}
+
+	_, err = llm.AsService(rt, nil)
+	assert.ErrorContains(t, err, "invalid moderation pattern")
+}
+
+func TestLLMFallbackLLM(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	llm := &models.LLM{UUID_: "9b2e6f1d-3c4a-4e5b-8d7c-2a1b0c9d8e7f", OrgID_: testdb.Org1.ID, Type_: "test", Model_: "gpt-4o", Config_: map[string]any{"fallback_uuid": string(testdb.TestLLM.UUID)}}
+
+	svc, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	resp, err := svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "Categorize... [Yes, No]", Input: "yes", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o", resp.Model)
+	assert.Nil(t, resp.Diagnostics)
+
+	// errors which aren't transient don't fall back
+	_, err = svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "Answer", Input: "\\error boom", MaxTokens: 100})
+	assert.EqualError(t, err, "boom")
+}
+
+func TestLLMBreaker(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData|testsuite.ResetValkey)
+
+	llm := &models.LLM{UUID_: "5d4c3b2a-1f0e-4d9c-8b7a-6f5e4d3c2b1a", OrgID_: testdb.Org1.ID, Type_: "test", Model_: "gpt-4o", Config_: map[string]any{"breaker_threshold": 2, "breaker_cooldown": 60}}
+
+	svc, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	ok := &ai.Request{Instructions: "Categorize... [Yes, No]", Input: "yes", MaxTokens: 100}
+	failing := &ai.Request{Instructions: "Answer", Input: "\\error boom", MaxTokens: 100}
+
+	for range 2 {
+		_, err = svc.(ai.Service).Call(ctx, failing)
+		assert.EqualError(t, err, "boom")
+	}
+
+	// breaker is now open so even good requests fail fast
+	_, err = svc.(ai.Service).Call(ctx, ok)
+	assert.EqualError(t, err, "LLM provider unavailable as recent calls have failed")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorUnavailable, serr.Code)
+	}
+
+	// and that's shared by other services for the same LLM
+	svc2, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+	_, err = svc2.(ai.Service).Call(ctx, ok)
+	assert.EqualError(t, err, "LLM provider unavailable as recent calls have failed")
+
+	// models being fallen back between have their own breakers, which don't start incidents
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	llm = &models.LLM{UUID_: "6e5d4c3b-2a1f-4e0d-9c8b-7a6f5e4d3c2b", OrgID_: testdb.Org1.ID, Type_: "test", Model_: "gpt-4o", Config_: map[string]any{"breaker_threshold": 2, "fallback_models": []any{"gpt-4o-mini"}}}
+
+	svc, err = llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	_, err = svc.(ai.Service).Call(ctx, failing)
+	assert.EqualError(t, err, "boom")
+
+	assertvk.Keys(t, vc, "llm_breaker:6e5d4c3b-2a1f-4e0d-9c8b-7a6f5e4d3c2b*", []string{
+		"llm_breaker:6e5d4c3b-2a1f-4e0d-9c8b-7a6f5e4d3c2b/gpt-4o-mini:failures",
+		"llm_breaker:6e5d4c3b-2a1f-4e0d-9c8b-7a6f5e4d3c2b/gpt-4o:failures",
+		"llm_breaker:6e5d4c3b-2a1f-4e0d-9c8b-7a6f5e4d3c2b:failures",
+	})
+
+	// once open, model breakers are shared so other services skip those models too
+	_, err = svc.(ai.Service).Call(ctx, failing)
+	assert.EqualError(t, err, "boom")
+
+	vc.Do("DEL", "llm_breaker:6e5d4c3b-2a1f-4e0d-9c8b-7a6f5e4d3c2b:open", "llm_breaker:6e5d4c3b-2a1f-4e0d-9c8b-7a6f5e4d3c2b:failures")
+
+	svc2, err = llm.AsService(rt, nil)
+	require.NoError(t, err)
+	_, err = svc2.(ai.Service).Call(ctx, ok)
+	assert.EqualError(t, err, "no models available as all breakers are open")
+}
+
+func TestLLMAsync(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData|testsuite.ResetValkey)
+
+	dbLLM := testdb.InsertLLM(t, rt, testdb.Org1, "3f2e1d0c-9b8a-4c7d-8e6f-5a4b3c2d1e0f", "test", "gpt-4o", "Async", map[string]any{"async": true, "async_timeout": 30}, "F")
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshLLMs)
+	require.NoError(t, err)
+
+	llm := oa.LLMByID(dbLLM.ID)
+	assert.Equal(t, 30*time.Second, llm.AsyncTimeout())
+
+	svc, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	req := &ai.Request{Instructions: "Answer", Input: "\\return Hola", MaxTokens: 100}
+
+	// calls outside of message handling are made as is
+	resp, err := svc.(ai.Service).Call(models.WithContactID(ctx, testdb.Ann.ID), req)
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+
+	// those during message handling are deferred, and only the first needs making
+	deferrals := models.NewLLMDeferrals()
+	handlingCtx := models.WithLLMDeferrals(models.WithContactID(ctx, testdb.Ann.ID), deferrals)
+
+	_, err = svc.(ai.Service).Call(handlingCtx, req)
+	assert.Equal(t, models.ErrLLMDeferred, err)
+	_, err = svc.(ai.Service).Call(handlingCtx, &ai.Request{Instructions: "Answer", Input: "\\return Adios", MaxTokens: 100})
+	assert.Equal(t, models.ErrLLMDeferred, err)
+
+	calls := deferrals.Calls()
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, dbLLM.ID, calls[0].LLMID)
+		assert.Equal(t, testdb.Ann.ID, calls[0].ContactID)
+		assert.Equal(t, "\\return Hola", calls[0].Request.Input)
+	}
+
+	pending, err := calls[0].MarkPending(ctx, rt, llm.AsyncTimeout())
+	require.NoError(t, err)
+	assert.True(t, pending)
+
+	pending, err = calls[0].MarkPending(ctx, rt, llm.AsyncTimeout())
+	require.NoError(t, err)
+	assert.False(t, pending)
+
+	// once made, the result is used when handling is retried
+	err = calls[0].Make(ctx, rt, oa)
+	require.NoError(t, err)
+	assertvk.Keys(t, vc, "llm_async:*", []string{fmt.Sprintf("llm_async:%d:%s:result", testdb.Ann.ID, calls[0].Hash)})
+
+	deferrals = models.NewLLMDeferrals()
+	handlingCtx = models.WithLLMDeferrals(models.WithContactID(ctx, testdb.Ann.ID), deferrals)
+
+	resp, err = svc.(ai.Service).Call(handlingCtx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Len(t, deferrals.Calls(), 0)
+
+	// and removed once that handling is committed
+	require.NoError(t, deferrals.Release(ctx, rt))
+	assertvk.Keys(t, vc, "llm_async:*", []string{})
+
+	// failed calls are failures when handling is retried
+	deferrals = models.NewLLMDeferrals()
+	handlingCtx = models.WithLLMDeferrals(models.WithContactID(ctx, testdb.Ann.ID), deferrals)
+
+	_, err = svc.(ai.Service).Call(handlingCtx, &ai.Request{Instructions: "Answer", Input: "\\error boom", MaxTokens: 100})
+	assert.Equal(t, models.ErrLLMDeferred, err)
+	require.NoError(t, deferrals.Calls()[0].Make(ctx, rt, oa))
+
+	_, err = svc.(ai.Service).Call(models.WithLLMDeferrals(models.WithContactID(ctx, testdb.Ann.ID), models.NewLLMDeferrals()), &ai.Request{Instructions: "Answer", Input: "\\error boom", MaxTokens: 100})
+	assert.EqualError(t, err, "boom")
+}
+
+func TestLLMVariables(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdb.Org1.ID)
+	require.NoError(t, err)
+
+	_, ann, _ := testdb.Ann.Load(t, rt, oa)
+
+	values := models.NewLLMVariables(oa, ann, nil).Values()
+	assert.Equal(t, oa.Org().Name(), values["org.name"])
+	assert.Equal(t, "Ann", values["contact.name"])
+	assert.Equal(t, ann.Groups().All()[0].Name(), values["contact.groups"])
+	assert.Equal(t, "F", values["contact.fields.gender"])
+	assert.Equal(t, "", values["contact.fields.age"])
+
+	llm := &models.LLM{UUID_: "4b7c9d2e-1f3a-4e5b-8c6d-7e8f9a0b1c2d", Type_: "test", Model_: "gpt-4o", Config_: map[string]any{}}
+
+	svc, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	req := &ai.Request{Instructions: "Greet {{contact.name}} who is {{contact.fields.gender}} on behalf of {{org.name}}.", Input: "\\return Hi", MaxTokens: 100}
+
+	// calls made outside of flow sessions have no variables
+	resp, err := svc.(ai.Service).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"no values for instruction variables: contact.name, contact.fields.gender, org.name"}, resp.Diagnostics)
+
+	resp, err = svc.(ai.Service).Call(models.WithLLMVariables(ctx, models.NewLLMVariables(oa, ann, nil)), req)
+	require.NoError(t, err)
+	assert.Equal(t, "Hi", resp.Output)
+	assert.Nil(t, resp.Diagnostics)
+}
+
+func TestLLMFallbackResponses(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetAll)
+
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2026, 5, 4, 13, 14, 30, 0, time.UTC)))
+	defer dates.SetNowFunc(time.Now)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = '{"llm_calls_per_minute": 1}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET language = 'spa' WHERE id = $1`, testdb.Ann.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	_, ann, _ := testdb.Ann.Load(t, rt, oa)
+
+	llm := &models.LLM{ID_: testdb.TestLLM.ID, UUID_: testdb.TestLLM.UUID, OrgID_: testdb.Org1.ID, Type_: "test", Model_: "gpt-4o", Config_: map[string]any{
+		"fallback_responses": map[string]any{"eng": "An agent will follow up.", "spa": "Un agente le responderá."},
+	}}
+	assert.Equal(t, "Un agente le responderá.", llm.FallbackResponse("fra", "spa", "eng"))
+	assert.Equal(t, "", llm.FallbackResponse("fra"))
+
+	svc, err := llm.AsService(rt, nil)
+	require.NoError(t, err)
+
+	req := &ai.Request{Instructions: "Answer the question", Input: "\\return We open at 9am", MaxTokens: 100}
+
+	resp, err := svc.(ai.Service).Call(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "We open at 9am", resp.Output)
+
+	// calls made outside of flow sessions still fail when rate limited
+	_, err = svc.(ai.Service).Call(ctx, req)
+	assert.EqualError(t, err, "rate limit exceeded")
+
+	// but calls made by flows get the fallback response in the contact's language, and are noted as degraded
+	degradations := models.NewLLMDegradations()
+	flowCtx := models.WithLLMDegradations(models.WithLLMVariables(ctx, models.NewLLMVariables(oa, ann, nil)), degradations)
+
+	resp, err = svc.(ai.Service).Call(flowCtx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Un agente le responderá.", resp.Output)
+	assert.True(t, resp.Degraded)
+	assert.Equal(t, "ratelimit", degradations.Take("Un agente le responderá."))
+	assert.Equal(t, "", degradations.Take("Un agente le responderá."))
+
+	call := models.NewLLMCall(testdb.Org1.ID, testdb.TestLLM.ID, models.NilFlowID, testdb.Ann.ID, 0, 0, 0, nil)
+	call.Degrade("ratelimit")
+	assert.Equal(t, models.LLMCallStatusDegraded, call.Status)
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/stringsx"
+	"github.com/nyaruka/goflow/flows"
+)
+
+// config values of providers which are secrets and so are redacted from HTTP logs
+var llmSecretConfigs = []string{"api_key", "access_key", "secret"}
+
+// headers which carry credentials, e.g. request signatures, and so have their values redacted from HTTP logs
+var llmAuthHeaderRegex = regexp.MustCompile(`(?im)^(authorization|api-key|x-api-key|x-goog-api-key|x-amz-security-token): [^\r\n]*`)
+
+// LLMHTTPLogs collects the HTTP logs of requests made to LLM providers, e.g. during a simulation
+type LLMHTTPLogs struct {
+	mutex sync.Mutex
+	logs  []*flows.HTTPLog
+}
+
+// NewLLMHTTPLogs creates a new empty collector of LLM HTTP logs
+func NewLLMHTTPLogs() *LLMHTTPLogs {
+	return &LLMHTTPLogs{}
+}
+
+// WithLLMHTTPLogs returns a copy of the given context in which the HTTP requests of LLM calls are logged to the given
+// collector. Responses are read in full to be logged so streamed responses only arrive once complete.
+func WithLLMHTTPLogs(ctx context.Context, l *LLMHTTPLogs) context.Context {
+	return context.WithValue(ctx, llmHTTPLogsKey, l)
+}
+
+func llmHTTPLogsFromContext(ctx context.Context) *LLMHTTPLogs {
+	l, _ := ctx.Value(llmHTTPLogsKey).(*LLMHTTPLogs)
+	return l
+}
+
+// Logs returns the logs collected so far
+func (l *LLMHTTPLogs) Logs() []*flows.HTTPLog {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]*flows.HTTPLog(nil), l.logs...)
+}
+
+// Take returns the logs collected so far and removes them from the collector
+func (l *LLMHTTPLogs) Take() []*flows.HTTPLog {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	logs := l.logs
+	l.logs = nil
+	return logs
+}
+
+func (l *LLMHTTPLogs) add(log *flows.HTTPLog) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.logs = append(l.logs, log)
+}
+
+// transport which traces requests whose context has a collector of LLM HTTP logs
+type llmTraceTransport struct {
+	inner  http.RoundTripper // nil for the default transport
+	redact stringsx.Redactor
+}
+
+func (t *llmTraceTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	inner := t.inner
+	if inner == nil {
+		inner = http.DefaultTransport
+	}
+
+	logs := llmHTTPLogsFromContext(request.Context())
+	if logs == nil {
+		return inner.RoundTrip(request)
+	}
+
+	traced := httpx.WithTraces(inner)
+	response, err := traced.RoundTrip(request)
+
+	for _, trace := range traced.Traces() {
+		logs.add(flows.NewHTTPLog(trace, flows.HTTPStatusFromCode, t.redact))
+	}
+
+	return response, err
+}
+
+// Unwrap returns the transport which requests are made with, or nil for the default transport
+func (t *llmTraceTransport) Unwrap() http.RoundTripper {
+	return t.inner
+}
+
+// returns the secrets of this LLM which must be redacted from logs of requests made with its config
+func (l *LLM) secrets() []string {
+	secrets := make([]string, 0, len(llmSecretConfigs))
+	for _, key := range llmSecretConfigs {
+		if v := l.Config().GetString(key, ""); v != "" {
+			secrets = append(secrets, v)
+		}
+	}
+	return secrets
+}
+
+// returns a redactor which masks this LLM's secrets and the values of credential headers
+func (l *LLM) redactor() stringsx.Redactor {
+	redactSecrets := stringsx.NewRedactor(flows.RedactionMask, l.secrets()...)
+
+	return func(s string) string {
+		return llmAuthHeaderRegex.ReplaceAllString(redactSecrets(s), "${1}: "+flows.RedactionMask)
+	}
+}
@@ -0,0 +1,248 @@
+package models
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+const (
+	llmUsageDayExpiry   = 2 * 24 * time.Hour  // long enough to cover any org timezone
+	llmUsageMonthExpiry = 32 * 24 * time.Hour // ditto
+)
+
+// budget of tokens for an org's LLM calls which keeps running daily and monthly totals of spend in valkey
+type orgLLMBudget struct {
+	rt    *runtime.Runtime
+	orgID OrgID
+}
+
+// gets the valkey keys for the current day and month in the org's timezone, the org's budgets for them, and the day
+func (b *orgLLMBudget) periods(ctx context.Context) ([2]string, [2]int64, dates.Date, error) {
+	oa, err := GetOrgAssets(ctx, b.rt, b.orgID)
+	if err != nil {
+		return [2]string{}, [2]int64{}, dates.ZeroDate, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	now := dates.Now().In(oa.Env().Timezone())
+	daily, monthly := oa.Org().LLMTokenBudgets()
+
+	keys := [2]string{
+		fmt.Sprintf("llm_usage:%d:%s", b.orgID, now.Format("2006-01-02")),
+		fmt.Sprintf("llm_usage:%d:%s", b.orgID, now.Format("2006-01")),
+	}
+	return keys, [2]int64{daily, monthly}, dates.ExtractDate(now), nil
+}
+
+func (b *orgLLMBudget) Exceeded(ctx context.Context) (bool, error) {
+	keys, budgets, _, err := b.periods(ctx)
+	if err != nil {
+		return false, err
+	}
+	if budgets[0] <= 0 && budgets[1] <= 0 {
+		return false, nil
+	}
+
+	vc := b.rt.VK.Get()
+	defer vc.Close()
+
+	spent, err := valkey.Int64s(valkey.DoContext(vc, ctx, "MGET", keys[0], keys[1]))
+	if err != nil {
+		return false, fmt.Errorf("error getting token usage: %w", err)
+	}
+
+	for i, budget := range budgets {
+		if budget > 0 && spent[i] >= budget {
+			startLLMIncident(ctx, b.rt, b.orgID, IncidentTypeLLMBudgetExceeded, "")
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (b *orgLLMBudget) Spend(ctx context.Context, tokens int64) error {
+	keys, _, day, err := b.periods(ctx)
+	if err != nil {
+		return err
+	}
+
+	vc := b.rt.VK.Get()
+	defer vc.Close()
+
+	vc.Send("MULTI")
+	vc.Send("INCRBY", keys[0], tokens)
+	vc.Send("EXPIRE", keys[0], int(llmUsageDayExpiry/time.Second))
+	vc.Send("INCRBY", keys[1], tokens)
+	vc.Send("EXPIRE", keys[1], int(llmUsageMonthExpiry/time.Second))
+	if _, err := valkey.DoContext(vc, ctx, "EXEC"); err != nil {
+		return fmt.Errorf("error incrementing token usage: %w", err)
+	}
+
+	// every spend is also persisted as valkey only keeps totals for as long as budgets need them
+	if _, err := b.rt.DB.NamedExecContext(ctx, sqlInsertLLMUsage, &LLMUsage{OrgID: b.orgID, Day: day, Tokens: tokens}); err != nil {
+		return fmt.Errorf("error inserting llm usage: %w", err)
+	}
+	return nil
+}
+
+// LLMBudgetExceeded returns whether the given org has exceeded its daily or monthly LLM token budget, e.g. so that
+// batches which bypass the usual services aren't submitted
+func LLMBudgetExceeded(ctx context.Context, rt *runtime.Runtime, orgID OrgID) (bool, error) {
+	return (&orgLLMBudget{rt: rt, orgID: orgID}).Exceeded(ctx)
+}
+
+// LLMUsage is the tokens spent on LLM calls by an org on a day
+type LLMUsage struct {
+	OrgID  OrgID      `db:"org_id"`
+	Day    dates.Date `db:"day"`
+	Tokens int64      `db:"tokens"`
+}
+
+const sqlInsertLLMUsage = `INSERT INTO orgs_llmusage(org_id, day, tokens, is_squashed) VALUES(:org_id, :day, :tokens, FALSE)`
+
+// LLMUsageTotals are the totals of the daily counts of LLM calls over a period
+type LLMUsageTotals struct {
+	Calls        int64            `json:"calls"`
+	TokensInput  int64            `json:"tokens_input"`
+	TokensOutput int64            `json:"tokens_output"`
+	CostMicroUSD int64            `json:"cost_microusd"`
+	Errors       map[string]int64 `json:"errors"` // by error code
+}
+
+func (t *LLMUsageTotals) add(scope string, count int64) {
+	switch scope {
+	case "calls":
+		t.Calls += count
+	case "tokens:in":
+		t.TokensInput += count
+	case "tokens:out":
+		t.TokensOutput += count
+	case "cost:microusd":
+		t.CostMicroUSD += count
+	default:
+		if code, ok := strings.CutPrefix(scope, llmErrorsScopePrefix); ok {
+			t.Errors[code] += count
+		}
+	}
+}
+
+// LLMUsageByDay are the usage totals of an org's LLMs on a day
+type LLMUsageByDay struct {
+	Day string `json:"day"`
+	*LLMUsageTotals
+}
+
+// LLMUsageByLLM are the usage totals of one of an org's LLMs
+type LLMUsageByLLM struct {
+	LLMID LLMID `json:"llm_id"`
+	*LLMUsageTotals
+}
+
+// LLMUsageByFlow are the usage totals of calls made by a flow to one of an org's LLMs
+type LLMUsageByFlow struct {
+	FlowID FlowID `json:"flow_id"`
+	LLMID  LLMID  `json:"llm_id"`
+	*LLMUsageTotals
+}
+
+// LLMUsageReport is the usage of an org's LLMs over a period, rolled up from their daily counts
+type LLMUsageReport struct {
+	Total *LLMUsageTotals   `json:"total"`
+	Days  []*LLMUsageByDay  `json:"days"`
+	LLMs  []*LLMUsageByLLM  `json:"llms"`
+	Flows []*LLMUsageByFlow `json:"flows"`
+}
+
+const sqlSelectLLMUsageCounts = `
+  SELECT TO_CHAR(c.day, 'YYYY-MM-DD') AS day, c.llm_id, c.scope, SUM(c.count) AS count
+    FROM ai_llmcount c
+    JOIN ai_llm l ON l.id = c.llm_id
+   WHERE l.org_id = $1 AND c.day >= $2 AND c.day <= $3
+GROUP BY c.day, c.llm_id, c.scope
+ORDER BY c.day, c.llm_id, c.scope`
+
+const sqlSelectLLMFlowUsageCounts = `
+  SELECT c.flow_id, c.llm_id, c.scope, SUM(c.count) AS count
+    FROM ai_llmflowcount c
+    JOIN ai_llm l ON l.id = c.llm_id
+   WHERE l.org_id = $1 AND c.day >= $2 AND c.day <= $3
+GROUP BY c.flow_id, c.llm_id, c.scope
+ORDER BY c.flow_id, c.llm_id, c.scope`
+
+// GetLLMUsageReport gets the usage of the given org's LLMs between the given days inclusive, in total and by day, LLM
+// and flow. Flows are ordered by their cost and then their number of calls so that the most expensive come first.
+func GetLLMUsageReport(ctx context.Context, db DBorTx, orgID OrgID, since, until dates.Date) (*LLMUsageReport, error) {
+	newTotals := func() *LLMUsageTotals { return &LLMUsageTotals{Errors: map[string]int64{}} }
+	report := &LLMUsageReport{Total: newTotals(), Days: []*LLMUsageByDay{}, LLMs: []*LLMUsageByLLM{}, Flows: []*LLMUsageByFlow{}}
+
+	var counts []*struct {
+		Day   string `db:"day"`
+		LLMID LLMID  `db:"llm_id"`
+		Scope string `db:"scope"`
+		Count int64  `db:"count"`
+	}
+	if err := db.SelectContext(ctx, &counts, sqlSelectLLMUsageCounts, orgID, since, until); err != nil {
+		return nil, fmt.Errorf("error selecting llm usage counts: %w", err)
+	}
+
+	byDay := make(map[string]*LLMUsageByDay)
+	byLLM := make(map[LLMID]*LLMUsageByLLM)
+
+	for _, c := range counts {
+		d := byDay[c.Day]
+		if d == nil {
+			d = &LLMUsageByDay{Day: c.Day, LLMUsageTotals: newTotals()}
+			byDay[c.Day] = d
+			report.Days = append(report.Days, d)
+		}
+		l := byLLM[c.LLMID]
+		if l == nil {
+			l = &LLMUsageByLLM{LLMID: c.LLMID, LLMUsageTotals: newTotals()}
+			byLLM[c.LLMID] = l
+			report.LLMs = append(report.LLMs, l)
+		}
+
+		report.Total.add(c.Scope, c.Count)
+		d.add(c.Scope, c.Count)
+		l.add(c.Scope, c.Count)
+	}
+
+	var flowCounts []*struct {
+		FlowID FlowID `db:"flow_id"`
+		LLMID  LLMID  `db:"llm_id"`
+		Scope  string `db:"scope"`
+		Count  int64  `db:"count"`
+	}
+	if err := db.SelectContext(ctx, &flowCounts, sqlSelectLLMFlowUsageCounts, orgID, since, until); err != nil {
+		return nil, fmt.Errorf("error selecting llm flow usage counts: %w", err)
+	}
+
+	type flowKey struct {
+		FlowID FlowID
+		LLMID  LLMID
+	}
+	byFlow := make(map[flowKey]*LLMUsageByFlow)
+
+	for _, c := range flowCounts {
+		f := byFlow[flowKey{c.FlowID, c.LLMID}]
+		if f == nil {
+			f = &LLMUsageByFlow{FlowID: c.FlowID, LLMID: c.LLMID, LLMUsageTotals: newTotals()}
+			byFlow[flowKey{c.FlowID, c.LLMID}] = f
+			report.Flows = append(report.Flows, f)
+		}
+		f.add(c.Scope, c.Count)
+	}
+
+	slices.SortStableFunc(report.Flows, func(a, b *LLMUsageByFlow) int {
+		return cmp.Or(cmp.Compare(b.CostMicroUSD, a.CostMicroUSD), cmp.Compare(b.Calls, a.Calls))
+	})
+
+	return report, nil
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nyaruka/goflow/excellent/types"
+	"github.com/nyaruka/goflow/flows"
+)
+
+// LLMVariables is the context of LLM calls made by a flow session, which their instructions can reference as variables
+// like {{contact.fields.age}} that are expanded at call time
+type LLMVariables struct {
+	oa      *OrgAssets
+	contact *flows.Contact
+	session flows.Session
+}
+
+// NewLLMVariables creates variables for calls made for the given contact by the given session, which is nil if it's
+// being started, in which case there are no results yet
+func NewLLMVariables(oa *OrgAssets, contact *flows.Contact, session flows.Session) *LLMVariables {
+	return &LLMVariables{oa: oa, contact: contact, session: session}
+}
+
+// WithLLMVariables returns a copy of the given context in which instructions of LLM calls can reference the given
+// variables
+func WithLLMVariables(ctx context.Context, v *LLMVariables) context.Context {
+	return context.WithValue(ctx, llmVariablesKey, v)
+}
+
+// Values returns the current values of the variables. The contact and session are those being modified by the engine
+// so values include changes made earlier in the same sprint.
+func (v *LLMVariables) Values() map[string]string {
+	values := map[string]string{"org.name": v.oa.Org().Name()}
+
+	if c := v.contact; c != nil {
+		values["contact.name"] = c.Name()
+		values["contact.language"] = string(c.Language())
+
+		groups := make([]string, 0, len(c.Groups().All()))
+		for _, g := range c.Groups().All() {
+			groups = append(groups, g.Name())
+		}
+		values["contact.groups"] = strings.Join(groups, ", ")
+
+		for key, val := range c.Fields().Context(v.oa.Env()) {
+			if key != "__default__" {
+				values["contact.fields."+key] = types.Render(val)
+			}
+		}
+	}
+
+	if run := v.currentRun(); run != nil {
+		for key, result := range run.Results() {
+			values["results."+key] = result.Value
+			values["results."+key+".category"] = result.Category
+		}
+	}
+
+	return values
+}
+
+// the run of the session which is currently active or waiting, if any
+func (v *LLMVariables) currentRun() flows.Run {
+	if v.session == nil {
+		return nil
+	}
+	runs := v.session.Runs()
+	for i := len(runs) - 1; i >= 0; i-- {
+		if s := runs[i].Status(); s == flows.RunStatusActive || s == flows.RunStatusWaiting {
+			return runs[i]
+		}
+	}
+	return nil
+}
+
+// source of the values of variables in the instructions of LLM calls, from their context
+type contextLLMVariables struct{}
+
+func (contextLLMVariables) Load(ctx context.Context) (map[string]string, error) {
+	if v, _ := ctx.Value(llmVariablesKey).(*LLMVariables); v != nil {
+		return v.Values(), nil
+	}
+	return nil, nil
+}
@@ -145,6 +145,7 @@ type MsgInRef struct {
 	Attachments []utils.Attachment
 	LogUUIDs    []svclogs.UUID
 	Handled     bool
+	Transcript  string // transcription of the message's audio if it had no text
 }
 
 // Msg is our type for mailroom messages
@@ -518,6 +519,71 @@ func GetMessagesByUUID(ctx context.Context, db *sqlx.DB, orgID OrgID, direction
 	return loadMessages(ctx, db, sqlSelectMessagesByUUID, orgID, direction, pq.Array(msgUUIDs))
 }
 
+var sqlSelectRecentContactMessages = `
+SELECT 
+	id,
+	uuid,
+	broadcast_id,
+	flow_id,
+	ticket_uuid,
+	optin_id,
+	text,
+	attachments,
+	quickreplies,
+	locale,
+	templating,
+	created_on,
+	direction,
+	status,
+	visibility,
+	msg_count,
+	error_count,
+	next_attempt,
+	failed_reason,
+	coalesce(high_priority, FALSE) as high_priority,
+	external_identifier,
+	channel_id,
+	contact_id,
+	contact_urn_id,
+	org_id
+FROM
+	msgs_msg
+WHERE
+	org_id = $1 AND
+	contact_id = $2 AND
+	visibility = 'V'
+ORDER BY
+	created_on DESC, id DESC
+LIMIT $3`
+
+// GetRecentContactMessages fetches the given number of most recent visible messages of the given contact, most recent first
+func GetRecentContactMessages(ctx context.Context, db *sqlx.DB, orgID OrgID, contactID ContactID, limit int) ([]*Msg, error) {
+	return loadMessages(ctx, db, sqlSelectRecentContactMessages, orgID, contactID, limit)
+}
+
+// GetRecentContactTranscript gets a transcript of the given number of most recent visible messages of the given contact,
+// oldest first, with each message on a line starting with "Contact:" if incoming or "Agent:" if outgoing
+func GetRecentContactTranscript(ctx context.Context, db *sqlx.DB, orgID OrgID, contactID ContactID, limit int) (string, error) {
+	msgs, err := GetRecentContactMessages(ctx, db, orgID, contactID, limit)
+	if err != nil {
+		return "", err
+	}
+
+	var transcript strings.Builder
+	for _, m := range slices.Backward(msgs) {
+		if text := strings.TrimSpace(m.Text()); text != "" {
+			if m.Direction() == DirectionIn {
+				transcript.WriteString("Contact: ")
+			} else {
+				transcript.WriteString("Agent: ")
+			}
+			transcript.WriteString(text)
+			transcript.WriteString("\n")
+		}
+	}
+	return transcript.String(), nil
+}
+
 var sqlSelectMessagesForRetry = `
 SELECT 
 	m.id,
@@ -621,8 +687,8 @@ msgs_msg(uuid, text, attachments, quickreplies, locale, templating, high_priorit
 		 :contact_id, :contact_urn_id, :org_id, :flow_id, :broadcast_id, :ticket_uuid, :optin_id, :created_by_id)
 RETURNING id, modified_on`
 
-// MarkMessageHandled updates a message after handling
-func MarkMessageHandled(ctx context.Context, tx DBorTx, msgUUID flows.EventUUID, status MsgStatus, visibility MsgVisibility, flow *Flow, ticket *Ticket, attachments []utils.Attachment, logUUIDs []svclogs.UUID) error {
+// MarkMessageHandled updates a message after handling, saving any transcript of its audio as its text
+func MarkMessageHandled(ctx context.Context, tx DBorTx, msgUUID flows.EventUUID, status MsgStatus, visibility MsgVisibility, flow *Flow, ticket *Ticket, attachments []utils.Attachment, logUUIDs []svclogs.UUID, transcript string) error {
 	flowID := NilFlowID
 	if flow != nil {
 		flowID = flow.ID()
@@ -634,8 +700,8 @@ func MarkMessageHandled(ctx context.Context, tx DBorTx, msgUUID flows.EventUUID,
 	}
 
 	_, err := tx.ExecContext(ctx,
-		`UPDATE msgs_msg SET status = $2, visibility = $3, flow_id = $4, ticket_uuid = $5, attachments = $6, log_uuids = array_cat(log_uuids, $7) WHERE uuid = $1`,
-		msgUUID, status, visibility, flowID, null.String(ticketUUID), pq.Array(attachments), pq.Array(logUUIDs),
+		`UPDATE msgs_msg SET status = $2, visibility = $3, flow_id = $4, ticket_uuid = $5, attachments = $6, log_uuids = array_cat(log_uuids, $7), text = COALESCE(NULLIF($8, ''), text) WHERE uuid = $1`,
+		msgUUID, status, visibility, flowID, null.String(ticketUUID), pq.Array(attachments), pq.Array(logUUIDs), transcript,
 	)
 	if err != nil {
 		return fmt.Errorf("error marking msg %s as handled: %w", msgUUID, err)
@@ -211,6 +211,25 @@ func TestGetMessagesByUUID(t *testing.T) {
 	assert.Equal(t, "in 1", msgs[0].Text())
 }
 
+func TestGetRecentContactMessages(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bad8-d4be-76c7-8a5c-a12caae7aa87", testdb.TwilioChannel, testdb.Ann, "in 1", models.MsgStatusHandled, "")
+	testdb.InsertOutgoingMsg(t, rt, testdb.Org1, "0199bad8-f98d-75a3-b641-2718a25ac3f5", testdb.TwilioChannel, testdb.Ann, "out 1", nil, models.MsgStatusSent, false)
+	testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bad9-9791-770d-a47d-8f4a6ea3ad13", testdb.TwilioChannel, testdb.Ann, "in 2", models.MsgStatusHandled, "")
+	testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bb93-ec0f-703e-9b5b-d26d4b6b133c", testdb.TwilioChannel, testdb.Bob, "other", models.MsgStatusHandled, "")
+	deleted := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bb94-1134-75d6-91dc-8aee7787f703", testdb.TwilioChannel, testdb.Ann, "deleted", models.MsgStatusHandled, "")
+	rt.DB.MustExec(`UPDATE msgs_msg SET visibility = 'D' WHERE id = $1`, deleted.ID)
+
+	msgs, err := models.GetRecentContactMessages(ctx, rt.DB, testdb.Org1.ID, testdb.Ann.ID, 2)
+	require.NoError(t, err)
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, "in 2", msgs[0].Text())
+	assert.Equal(t, "out 1", msgs[1].Text())
+}
+
 func TestResendMessages(t *testing.T) {
 	ctx, rt := testsuite.Runtime(t)
 
@@ -389,6 +408,26 @@ func TestNormalizeAttachment(t *testing.T) {
 	}
 }
 
+func TestMarkMessageHandled(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	in1 := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bad8-f98d-75a3-b641-2718a25ac3f5", testdb.TwilioChannel, testdb.Ann, "hi", models.MsgStatusPending, "")
+	in2 := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bad9-9791-770d-a47d-8f4a6ea3ad13", testdb.TwilioChannel, testdb.Ann, "", models.MsgStatusPending, "")
+
+	err := models.MarkMessageHandled(ctx, rt.DB, in1.UUID, models.MsgStatusHandled, models.VisibilityVisible, nil, nil, nil, nil, "")
+	require.NoError(t, err)
+
+	// a message with audio has the transcript of it saved as its text
+	err = models.MarkMessageHandled(ctx, rt.DB, in2.UUID, models.MsgStatusHandled, models.VisibilityVisible, nil, nil, nil, nil, "Hello from a voice note")
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT text FROM msgs_msg WHERE uuid = $1`, in1.UUID).Returns("hi")
+	assertdb.Query(t, rt.DB, `SELECT text FROM msgs_msg WHERE uuid = $1`, in2.UUID).Returns("Hello from a voice note")
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE status = 'H'`).Returns(2)
+}
+
 func TestMarkMessages(t *testing.T) {
 	ctx, rt := testsuite.Runtime(t)
 
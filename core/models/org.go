@@ -19,6 +19,7 @@ import (
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/engine"
@@ -84,6 +85,18 @@ const (
 
 	configDTOneKey    = "dtone_key"
 	configDTOneSecret = "dtone_secret"
+
+	configLLMDailyTokenBudget   = "llm_daily_token_budget"
+	configLLMMonthlyTokenBudget = "llm_monthly_token_budget"
+	configLLMCallsPerMinute     = "llm_calls_per_minute"
+	configTicketTopicLLM        = "ticket_topic_llm"
+	configTicketSummaryLLM      = "ticket_summary_llm"
+	configDefaultLLM            = "default_llm"
+	configAIDigestLLM           = "ai_digest_llm"
+	configAIDigestHour          = "ai_digest_hour"
+	configIncidentWebhook       = "incident_webhook"
+
+	defaultAIDigestHour = 8
 )
 
 // Org is mailroom's type for RapidPro orgs. It also implements the envs.Environment interface for GoFlow
@@ -164,6 +177,73 @@ func (o *Org) ConfigValue(key string, def string) string {
 	return def
 }
 
+// LLMTokenBudgets returns the daily and monthly budgets of tokens that can be spent on LLM calls, zero meaning unlimited
+func (o *Org) LLMTokenBudgets() (int64, int64) {
+	budget := func(key string) int64 {
+		v, _ := o.o.Config[key].(float64)
+		return int64(v)
+	}
+	return budget(configLLMDailyTokenBudget), budget(configLLMMonthlyTokenBudget)
+}
+
+// LLMCallsPerMinute returns the maximum number of LLM calls that can be made per minute if this org overrides the given
+// default, zero meaning unlimited
+func (o *Org) LLMCallsPerMinute(def int) int {
+	if v, ok := o.o.Config[configLLMCallsPerMinute].(float64); ok {
+		return int(v)
+	}
+	return def
+}
+
+// TicketTopicLLM returns the UUID of the LLM used to assign topics to newly opened tickets, if the org has opted into that
+func (o *Org) TicketTopicLLM() assets.LLMUUID {
+	return assets.LLMUUID(o.ConfigValue(configTicketTopicLLM, ""))
+}
+
+// TicketSummaryLLM returns the UUID of the LLM used to add summaries of conversations to tickets opened from flows or
+// assigned to agents, if the org has opted into that
+func (o *Org) TicketSummaryLLM() assets.LLMUUID {
+	return assets.LLMUUID(o.ConfigValue(configTicketSummaryLLM, ""))
+}
+
+// DefaultLLM returns the UUID of the LLM used by AI actions in flows which don't reference one which exists, if the org
+// has one
+func (o *Org) DefaultLLM() assets.LLMUUID {
+	return assets.LLMUUID(o.ConfigValue(configDefaultLLM, ""))
+}
+
+// AIDigestLLM returns the UUID of the LLM used to write a daily digest of conversations with open tickets for the org's
+// administrators, if the org has opted into that
+func (o *Org) AIDigestLLM() assets.LLMUUID {
+	return assets.LLMUUID(o.ConfigValue(configAIDigestLLM, ""))
+}
+
+// AIDigestHour returns the hour of the day, in the org's timezone, at which its daily digest is sent
+func (o *Org) AIDigestHour() int {
+	if v, ok := o.o.Config[configAIDigestHour].(float64); ok {
+		return int(v)
+	}
+	return defaultAIDigestHour
+}
+
+// IncidentWebhook returns the URL which is notified when incidents for the org start and end, if it has one
+func (o *Org) IncidentWebhook() string {
+	return o.ConfigValue(configIncidentWebhook, "")
+}
+
+// SetDefaultLLM updates the default LLM of the org with the given ID, or clears it if uuid is empty
+func SetDefaultLLM(ctx context.Context, db DBorTx, orgID OrgID, uuid assets.LLMUUID) error {
+	if _, err := db.ExecContext(ctx, sqlUpdateOrgDefaultLLM, orgID, configDefaultLLM, string(uuid)); err != nil {
+		return fmt.Errorf("error updating default LLM for org #%d: %w", orgID, err)
+	}
+	return nil
+}
+
+const sqlUpdateOrgDefaultLLM = `
+UPDATE orgs_org
+   SET config = CASE WHEN $3::text = '' THEN COALESCE(config, '{}') - $2::text ELSE COALESCE(config, '{}') || jsonb_build_object($2::text, $3::text) END
+ WHERE id = $1`
+
 // EmailService returns the email service for this org
 func (o *Org) EmailService(ctx context.Context, rt *runtime.Runtime, retries *smtpx.RetryConfig) (flows.EmailService, error) {
 	// first look for custom SMTP on this org
@@ -354,3 +434,22 @@ func GetOutboxCounts(ctx context.Context, db *sql.DB, orgIDs []OrgID) (map[OrgID
 	}
 	return counts, nil
 }
+
+const sqlSelectAIDigestOrgs = `
+  SELECT id
+    FROM orgs_org
+   WHERE is_active AND config->>'ai_digest_llm' IS NOT NULL
+     AND EXTRACT(HOUR FROM $1::timestamptz AT TIME ZONE timezone) = COALESCE((config->>'ai_digest_hour')::int, $2)
+ORDER BY id`
+
+// GetAIDigestOrgs gets the active orgs which have opted into a daily AI digest and for which the given time falls within
+// the hour at which it's sent
+func GetAIDigestOrgs(ctx context.Context, db *sql.DB, now time.Time) ([]OrgID, error) {
+	rows, err := db.QueryContext(ctx, sqlSelectAIDigestOrgs, now, defaultAIDigestHour)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting orgs for AI digests: %w", err)
+	}
+	defer rows.Close()
+
+	return dbutil.ScanAllSlice(rows, []OrgID{})
+}
@@ -0,0 +1,263 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// PromptID is our type for prompt IDs
+type PromptID int
+
+// PromptUUID is our type for prompt UUIDs
+type PromptUUID uuids.UUID
+
+// the prefix of instructions which reference a prompt by name rather than being the instructions themselves
+const promptReferencePrefix = "prompt:"
+
+var (
+	// variables in the body of a prompt are referenced like {name}
+	promptVariableRegex = regexp.MustCompile(`\{([a-z_][a-z0-9_]*)\}`)
+
+	// values of variables follow the reference to a prompt on lines like "name: value"
+	promptValueRegex = regexp.MustCompile(`^([a-z_][a-z0-9_]*):\s?(.*)$`)
+)
+
+// ErrPromptNotFound is returned when there is no active prompt with the given name or UUID
+var ErrPromptNotFound = errors.New("prompt not found")
+
+// Prompt is a named set of instructions which can be used by AI actions in flows, and which is versioned so that it can
+// be iterated on without republishing the flows which use it
+type Prompt struct {
+	ID         PromptID   `db:"id"          json:"-"`
+	UUID       PromptUUID `db:"uuid"        json:"uuid"`
+	OrgID      OrgID      `db:"org_id"      json:"-"`
+	Name       string     `db:"name"        json:"name"`
+	Body       string     `db:"body"        json:"body"`
+	LLMID      LLMID      `db:"llm_id"      json:"-"` // the LLM the prompt is designed for and previewed with
+	Version    int        `db:"version"     json:"version"`
+	ModifiedOn time.Time  `db:"modified_on" json:"modified_on"`
+}
+
+// PromptVersion is a version of the body of a prompt
+type PromptVersion struct {
+	PromptID    PromptID  `db:"prompt_id"     json:"-"`
+	Version     int       `db:"version"       json:"version"`
+	Body        string    `db:"body"          json:"body"`
+	LLMID       LLMID     `db:"llm_id"        json:"-"`
+	CreatedByID UserID    `db:"created_by_id" json:"created_by_id"`
+	CreatedOn   time.Time `db:"created_on"    json:"created_on"`
+}
+
+// Variables returns the names of the variables in the body of this prompt in the order they first appear
+func (p *Prompt) Variables() []string {
+	return promptVariables(p.Body)
+}
+
+// Render returns the body of this prompt with its variables replaced by the given values, erroring if any are missing
+func (p *Prompt) Render(values map[string]string) (string, error) {
+	return renderPrompt(p.Body, values)
+}
+
+func promptVariables(body string) []string {
+	names := []string{}
+	for _, m := range promptVariableRegex.FindAllStringSubmatch(body, -1) {
+		if !slices.Contains(names, m[1]) {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+func renderPrompt(body string, values map[string]string) (string, error) {
+	var missing []string
+	for _, name := range promptVariables(body) {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing values for prompt variables: %s", strings.Join(missing, ", "))
+	}
+
+	return promptVariableRegex.ReplaceAllStringFunc(body, func(v string) string {
+		return values[v[1:len(v)-1]]
+	}), nil
+}
+
+// ParsePromptReference parses instructions which reference a prompt by name, e.g.
+//
+//	prompt: support_triage
+//	product: Solar Lamp
+//	tone: friendly
+//
+// returning the name of the prompt and the values of its variables, or an empty name if the instructions aren't a
+// reference to a prompt. Lines which aren't like "name: value" continue the value of the previous variable.
+func ParsePromptReference(instructions string) (string, map[string]string) {
+	first, rest, _ := strings.Cut(strings.TrimSpace(instructions), "\n")
+	if !strings.HasPrefix(first, promptReferencePrefix) {
+		return "", nil
+	}
+
+	name := strings.TrimSpace(strings.TrimPrefix(first, promptReferencePrefix))
+	values := make(map[string]string)
+	last := ""
+
+	for line := range strings.Lines(rest) {
+		if m := promptValueRegex.FindStringSubmatch(strings.TrimRight(line, "\r\n")); m != nil {
+			last = m[1]
+			values[last] = strings.TrimSpace(m[2])
+		} else if last != "" {
+			values[last] = strings.TrimSpace(values[last] + "\n" + strings.TrimRight(line, "\r\n"))
+		}
+	}
+
+	return name, values
+}
+
+const sqlSelectPrompt = `
+SELECT id, uuid, org_id, name, body, llm_id, version, modified_on
+  FROM ai_prompt
+ WHERE org_id = $1 AND %s AND is_active`
+
+// GetPromptByName loads the active prompt in the given org with the given name
+func GetPromptByName(ctx context.Context, db DBorTx, orgID OrgID, name string) (*Prompt, error) {
+	return getPrompt(ctx, db, fmt.Sprintf(sqlSelectPrompt, "LOWER(name) = LOWER($2)"), orgID, name)
+}
+
+// GetPromptByUUID loads the active prompt in the given org with the given UUID
+func GetPromptByUUID(ctx context.Context, db DBorTx, orgID OrgID, uuid PromptUUID) (*Prompt, error) {
+	return getPrompt(ctx, db, fmt.Sprintf(sqlSelectPrompt, "uuid = $2"), orgID, uuid)
+}
+
+func getPrompt(ctx context.Context, db DBorTx, query string, orgID OrgID, key any) (*Prompt, error) {
+	p := &Prompt{}
+	if err := db.GetContext(ctx, p, query, orgID, key); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %v", ErrPromptNotFound, key)
+		}
+		return nil, fmt.Errorf("error loading prompt %v: %w", key, err)
+	}
+	return p, nil
+}
+
+const sqlInsertPrompt = `
+INSERT INTO ai_prompt(uuid, org_id, name, body, llm_id, version, is_active, created_on, modified_on, created_by_id, modified_by_id)
+               VALUES($1, $2, $3, $4, $5, 1, TRUE, NOW(), NOW(), $6, $6)
+RETURNING id, version, modified_on`
+
+const sqlInsertPromptVersion = `
+INSERT INTO ai_promptversion(prompt_id, version, body, llm_id, created_by_id, created_on)
+                      VALUES($1, $2, $3, $4, $5, NOW())`
+
+// CreatePrompt creates a new prompt in the given org, as its first version
+func CreatePrompt(ctx context.Context, db DB, orgID OrgID, userID UserID, name, body string, llmID LLMID) (*Prompt, error) {
+	p := &Prompt{UUID: PromptUUID(uuids.NewV4()), OrgID: orgID, Name: name, Body: body, LLMID: llmID}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error beginning transaction: %w", err)
+	}
+
+	if err := tx.QueryRowxContext(ctx, sqlInsertPrompt, p.UUID, orgID, name, body, llmID, userID).Scan(&p.ID, &p.Version, &p.ModifiedOn); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error inserting prompt: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, sqlInsertPromptVersion, p.ID, p.Version, body, llmID, userID); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error inserting prompt version: %w", err)
+	}
+
+	return p, tx.Commit()
+}
+
+const sqlUpdatePrompt = `
+   UPDATE ai_prompt
+      SET name = $2, body = $3, llm_id = $4, version = version + 1, modified_on = NOW(), modified_by_id = $5
+    WHERE id = $1
+RETURNING version, modified_on`
+
+// Update saves a new version of this prompt with the given name, body and LLM
+func (p *Prompt) Update(ctx context.Context, db DB, userID UserID, name, body string, llmID LLMID) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+
+	var version int
+	var modifiedOn time.Time
+
+	if err := tx.QueryRowxContext(ctx, sqlUpdatePrompt, p.ID, name, body, llmID, userID).Scan(&version, &modifiedOn); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error updating prompt: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, sqlInsertPromptVersion, p.ID, version, body, llmID, userID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error inserting prompt version: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing prompt update: %w", err)
+	}
+
+	p.Name, p.Body, p.LLMID, p.Version, p.ModifiedOn = name, body, llmID, version, modifiedOn
+	return nil
+}
+
+const sqlSelectPromptVersions = `
+  SELECT prompt_id, version, body, llm_id, created_by_id, created_on
+    FROM ai_promptversion
+   WHERE prompt_id = $1
+ORDER BY version DESC`
+
+// GetPromptVersions loads the versions of the given prompt, newest first
+func GetPromptVersions(ctx context.Context, db DBorTx, promptID PromptID) ([]*PromptVersion, error) {
+	versions := make([]*PromptVersion, 0, 10)
+	if err := db.SelectContext(ctx, &versions, sqlSelectPromptVersions, promptID); err != nil {
+		return nil, fmt.Errorf("error loading versions of prompt #%d: %w", promptID, err)
+	}
+	return versions, nil
+}
+
+// resolves instructions which reference a prompt by name to the rendered body of that prompt, so that changes to the
+// prompt take effect in every flow which references it without the flows being republished
+type llmPromptService struct {
+	service ai.Service
+	rt      *runtime.Runtime
+	orgID   OrgID
+}
+
+func (s *llmPromptService) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	name, values := ParsePromptReference(req.Instructions)
+	if name == "" {
+		return s.service.Call(ctx, req)
+	}
+
+	prompt, err := GetPromptByName(ctx, s.rt.DB, s.orgID, name)
+	if err != nil {
+		return nil, err
+	}
+	instructions, err := prompt.Render(values)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering prompt %s: %w", name, err)
+	}
+
+	call := *req
+	call.Instructions = instructions
+
+	resp, err := s.service.Call(ctx, &call)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Diagnostics = append(resp.Diagnostics, fmt.Sprintf("prompt %s version %d", prompt.Name, prompt.Version))
+	return resp, nil
+}
@@ -0,0 +1,112 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptRender(t *testing.T) {
+	p := &models.Prompt{Body: `Help customers with {product} in a {tone} tone. Reply as JSON like {"category": "..."}. Be {tone}.`}
+
+	assert.Equal(t, []string{"product", "tone"}, p.Variables())
+
+	rendered, err := p.Render(map[string]string{"product": "Solar Lamp", "tone": "friendly"})
+	assert.NoError(t, err)
+	assert.Equal(t, `Help customers with Solar Lamp in a friendly tone. Reply as JSON like {"category": "..."}. Be friendly.`, rendered)
+
+	_, err = p.Render(map[string]string{"tone": "friendly"})
+	assert.EqualError(t, err, "missing values for prompt variables: product")
+
+	p = &models.Prompt{Body: "Categorize the message."}
+	assert.Equal(t, []string{}, p.Variables())
+
+	rendered, err = p.Render(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Categorize the message.", rendered)
+}
+
+func TestParsePromptReference(t *testing.T) {
+	tcs := []struct {
+		instructions string
+		name         string
+		values       map[string]string
+	}{
+		{"Categorize the message.", "", nil},
+		{"Use the prompt: support_triage", "", nil},
+		{"prompt:support_triage", "support_triage", map[string]string{}},
+		{"  prompt: Support Triage \n", "Support Triage", map[string]string{}},
+		{"prompt: support_triage\nproduct: Solar Lamp\ntone:friendly", "support_triage", map[string]string{"product": "Solar Lamp", "tone": "friendly"}},
+		{"prompt: support_triage\r\nproduct: Solar Lamp\r\nhistory: first line\r\nsecond line\r\n", "support_triage", map[string]string{"product": "Solar Lamp", "history": "first line\nsecond line"}},
+		{"prompt: support_triage\nignored\nproduct:", "support_triage", map[string]string{"product": ""}},
+	}
+
+	for _, tc := range tcs {
+		name, values := models.ParsePromptReference(tc.instructions)
+		assert.Equal(t, tc.name, name, "name mismatch for %q", tc.instructions)
+		assert.Equal(t, tc.values, values, "values mismatch for %q", tc.instructions)
+	}
+}
+
+func TestPrompts(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	p, err := models.CreatePrompt(ctx, rt.DB, testdb.Org1.ID, testdb.Admin.ID, "support_triage", "Categorize messages about {product}.", testdb.TestLLM.ID)
+	require.NoError(t, err)
+	assert.NotZero(t, p.ID)
+	assert.Equal(t, 1, p.Version)
+
+	// names are matched case insensitively
+	p2, err := models.GetPromptByName(ctx, rt.DB, testdb.Org1.ID, "Support_Triage")
+	require.NoError(t, err)
+	assert.Equal(t, p.UUID, p2.UUID)
+	assert.Equal(t, testdb.TestLLM.ID, p2.LLMID)
+
+	_, err = models.GetPromptByName(ctx, rt.DB, testdb.Org2.ID, "support_triage")
+	assert.ErrorIs(t, err, models.ErrPromptNotFound)
+
+	err = p.Update(ctx, rt.DB, testdb.Editor.ID, "support_triage", "Categorize messages about {product} as Question or Complaint.", models.NilLLMID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, p.Version)
+
+	p2, err = models.GetPromptByUUID(ctx, rt.DB, testdb.Org1.ID, p.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, p2.Version)
+	assert.Equal(t, "Categorize messages about {product} as Question or Complaint.", p2.Body)
+	assert.Equal(t, models.NilLLMID, p2.LLMID)
+
+	versions, err := models.GetPromptVersions(ctx, rt.DB, p.ID)
+	require.NoError(t, err)
+	if assert.Len(t, versions, 2) {
+		assert.Equal(t, 2, versions[0].Version)
+		assert.Equal(t, testdb.Editor.ID, versions[0].CreatedByID)
+		assert.Equal(t, 1, versions[1].Version)
+		assert.Equal(t, "Categorize messages about {product}.", versions[1].Body)
+		assert.Equal(t, testdb.TestLLM.ID, versions[1].LLMID)
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdb.Org1.ID)
+	require.NoError(t, err)
+
+	svc, err := oa.LLMByID(testdb.TestLLM.ID).AsService(rt, nil)
+	require.NoError(t, err)
+
+	// instructions which reference a prompt are resolved to its current version
+	resp, err := svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "prompt: support_triage\nproduct: Solar Lamp", Input: "\\return Question", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "Question", resp.Output)
+	assert.Equal(t, []string{"prompt support_triage version 2"}, resp.Diagnostics)
+
+	_, err = svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "prompt: support_triage", Input: "\\return Question", MaxTokens: 100})
+	assert.EqualError(t, err, "error rendering prompt support_triage: missing values for prompt variables: product")
+
+	_, err = svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "prompt: unknown", Input: "\\return Question", MaxTokens: 100})
+	assert.ErrorIs(t, err, models.ErrPromptNotFound)
+}
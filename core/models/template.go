@@ -1,11 +1,15 @@
 package models
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/goflow/assets"
@@ -96,6 +100,69 @@ func (t *TemplateTranslation) UnmarshalJSON(d []byte) error {
 	return nil
 }
 
+// maximum lengths of the values of text variables by the type of component they're in, as enforced by WhatsApp
+var templateVariableMaxLengths = map[string]int{
+	"header/text":        60,
+	"body/text":          1024,
+	"button/url":         2000,
+	"button/quick_reply": 128,
+}
+
+const defaultTemplateVariableMaxLength = 1024
+
+// TemplateTextVariable is a text variable of a template translation along with the component it appears in
+type TemplateTextVariable struct {
+	Index         int    // index of the variable in the translation's variables
+	Name          string // name of the variable in the component, e.g. "1"
+	Component     string // name of the component, e.g. "body"
+	ComponentType string // type of the component, e.g. "body/text"
+	Content       string // content of the component which the variable appears in
+	MaxLength     int
+}
+
+// TextVariables returns the text variables of this translation, which are those whose values can be written rather
+// than being media, in order of index
+func (t *TemplateTranslation) TextVariables() []*TemplateTextVariable {
+	vars := make([]*TemplateTextVariable, 0, len(t.t.Variables))
+	for _, c := range t.t.Components {
+		for name, idx := range c.Variables() {
+			if idx < 0 || idx >= len(t.t.Variables) || t.t.Variables[idx].Type() != "text" {
+				continue
+			}
+			maxLength, ok := templateVariableMaxLengths[c.Type()]
+			if !ok {
+				maxLength = defaultTemplateVariableMaxLength
+			}
+			vars = append(vars, &TemplateTextVariable{Index: idx, Name: name, Component: c.Name(), ComponentType: c.Type(), Content: c.Content(), MaxLength: maxLength})
+		}
+	}
+	slices.SortFunc(vars, func(a, b *TemplateTextVariable) int { return cmp.Compare(a.Index, b.Index) })
+	return vars
+}
+
+// ValidateVariables checks that the given values can be used for the variables of this translation, i.e. that there's
+// one for each variable and that those of text variables are within length limits and don't contain newlines or tabs,
+// which WhatsApp rejects in parameters
+func (t *TemplateTranslation) ValidateVariables(values []string) error {
+	if len(values) != len(t.t.Variables) {
+		return fmt.Errorf("expected %d variable values, got %d", len(t.t.Variables), len(values))
+	}
+
+	for _, v := range t.TextVariables() {
+		value := values[v.Index]
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("value for variable %s of %s is empty", v.Name, v.Component)
+		}
+		if n := utf8.RuneCountInString(value); n > v.MaxLength {
+			return fmt.Errorf("value for variable %s of %s is %d characters, maximum is %d", v.Name, v.Component, n, v.MaxLength)
+		}
+		if strings.ContainsAny(value, "\n\t") || strings.Contains(value, "    ") {
+			return fmt.Errorf("value for variable %s of %s contains newlines, tabs or more than 3 consecutive spaces", v.Name, v.Component)
+		}
+	}
+	return nil
+}
+
 // loads the templates for the passed in org
 func loadTemplates(ctx context.Context, db *sql.DB, orgID OrgID) ([]assets.Template, error) {
 	rows, err := db.QueryContext(ctx, sqlSelectTemplatesByOrg, orgID)
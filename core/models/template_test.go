@@ -1,9 +1,11 @@
 package models_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/assets/static"
 	"github.com/nyaruka/mailroom/v26/core/models"
@@ -64,3 +66,30 @@ func TestTemplates(t *testing.T) {
 
 	assert.Nil(t, oa.TemplateByUUID("f67e498e-08fa-44e0-8acd-4c10122de714"))
 }
+
+func TestTemplateVariables(t *testing.T) {
+	tt := &models.TemplateTranslation{}
+	jsonx.MustUnmarshal([]byte(`{
+		"channel": {"uuid": "0f661e8b-ea9d-4bd3-9953-d368340acf91", "name": "WhatsApp"},
+		"locale": "eng-US",
+		"components": [
+			{"name": "header", "type": "header/media", "content": "", "variables": {"1": 0}},
+			{"name": "body", "type": "body/text", "content": "Hi {{1}}, your appointment is on {{2}}.", "variables": {"1": 1, "2": 2}},
+			{"name": "button.0", "type": "button/quick_reply", "content": "{{1}}", "variables": {"1": 3}}
+		],
+		"variables": [{"type": "image"}, {"type": "text"}, {"type": "text"}, {"type": "text"}]
+	}`), tt)
+
+	vars := tt.TextVariables()
+	assert.Equal(t, []*models.TemplateTextVariable{
+		{Index: 1, Name: "1", Component: "body", ComponentType: "body/text", Content: "Hi {{1}}, your appointment is on {{2}}.", MaxLength: 1024},
+		{Index: 2, Name: "2", Component: "body", ComponentType: "body/text", Content: "Hi {{1}}, your appointment is on {{2}}.", MaxLength: 1024},
+		{Index: 3, Name: "1", Component: "button.0", ComponentType: "button/quick_reply", Content: "{{1}}", MaxLength: 128},
+	}, vars)
+
+	assert.NoError(t, tt.ValidateVariables([]string{"", "Ann", "Monday", "Confirm"}))
+	assert.EqualError(t, tt.ValidateVariables([]string{"Ann", "Monday"}), "expected 4 variable values, got 2")
+	assert.EqualError(t, tt.ValidateVariables([]string{"", " ", "Monday", "Confirm"}), "value for variable 1 of body is empty")
+	assert.EqualError(t, tt.ValidateVariables([]string{"", "Ann", "Monday\nat 10", "Confirm"}), "value for variable 2 of body contains newlines, tabs or more than 3 consecutive spaces")
+	assert.EqualError(t, tt.ValidateVariables([]string{"", "Ann", "Monday", strings.Repeat("x", 129)}), "value for variable 1 of button.0 is 129 characters, maximum is 128")
+}
@@ -117,6 +117,36 @@ func LoadTickets(ctx context.Context, db *sqlx.DB, orgID OrgID, uuids []flows.Ti
 	return loadTickets(ctx, db, sqlSelectTicketsByUUID, orgID, pq.Array(uuids))
 }
 
+const sqlSelectDigestTickets = `
+SELECT * FROM (
+    SELECT DISTINCT ON (contact_id)
+      id,
+      uuid,
+      org_id,
+      contact_id,
+      status,
+      topic_id,
+      assignee_id,
+      opened_on,
+      opened_by_id,
+      opened_in_id,
+      replied_on,
+      modified_on,
+      closed_on,
+      last_activity_on
+        FROM tickets_ticket
+       WHERE org_id = $1 AND status = 'O' AND last_activity_on > $2
+    ORDER BY contact_id, last_activity_on DESC
+) t
+ORDER BY last_activity_on DESC
+   LIMIT $3`
+
+// LoadDigestTickets loads the most recently active open ticket of each contact with ticket activity since the given
+// time, most recently active first, up to the given limit
+func LoadDigestTickets(ctx context.Context, db *sqlx.DB, orgID OrgID, since time.Time, limit int) ([]*Ticket, error) {
+	return loadTickets(ctx, db, sqlSelectDigestTickets, orgID, since, limit)
+}
+
 func loadTickets(ctx context.Context, db *sqlx.DB, query string, params ...any) ([]*Ticket, error) {
 	rows, err := db.QueryxContext(ctx, query, params...)
 	if err != nil && err != sql.ErrNoRows {
@@ -163,3 +163,83 @@ func (c Config) GetInt(key string, def int) int {
 	}
 	return def
 }
+
+// GetFloat returns the value of the key as a float. If the key does not exist or cannot be converted to a float, it returns the default value.
+func (c Config) GetFloat(key string, def float64) float64 {
+	if v, ok := c[key]; ok {
+		if f, ok := v.(float64); ok {
+			return f
+		}
+		if n, ok := v.(int); ok {
+			return float64(n)
+		}
+		if s, ok := v.(string); ok {
+			f, err := strconv.ParseFloat(s, 64)
+			if err == nil {
+				return f
+			}
+		}
+	}
+	return def
+}
+
+// GetStringList returns the value of the key as a list of strings, ignoring any non-string values. If the key does not
+// exist or isn't a list, it returns nil.
+func (c Config) GetStringList(key string) []string {
+	if v, ok := c[key].([]any); ok {
+		l := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				l = append(l, s)
+			}
+		}
+		return l
+	}
+	return nil
+}
+
+// GetConfigList returns the value of the key as a list of configs, ignoring any non-object values. If the key does not
+// exist or isn't a list, it returns nil.
+func (c Config) GetConfigList(key string) []Config {
+	if v, ok := c[key].([]any); ok {
+		l := make([]Config, 0, len(v))
+		for _, e := range v {
+			if m, ok := e.(map[string]any); ok {
+				l = append(l, Config(m))
+			}
+		}
+		return l
+	}
+	return nil
+}
+
+// GetStringMap returns the value of the key as a map of strings, ignoring any non-string values. If the key does not
+// exist or isn't a map, it returns nil.
+func (c Config) GetStringMap(key string) map[string]string {
+	if v, ok := c[key].(map[string]any); ok {
+		m := make(map[string]string, len(v))
+		for k, e := range v {
+			if s, ok := e.(string); ok {
+				m[k] = s
+			}
+		}
+		return m
+	}
+	return nil
+}
+
+// GetBool returns the value of the key as a bool. If the key does not exist or cannot be converted to a bool, it returns the default value.
+func (c Config) GetBool(key string, def bool) bool {
+	if v, ok := c[key]; ok {
+		if b, ok := v.(bool); ok {
+			return b
+		}
+		if s, ok := v.(string); ok {
+			b, err := strconv.ParseBool(s)
+			if err == nil {
+				return b
+			}
+		}
+	}
+	return def
+}
@@ -111,4 +111,37 @@ func TestConfig(t *testing.T) {
 	assert.Equal(t, 456, cfg.GetInt("numstr", 123))
 	assert.Equal(t, 123, cfg.GetInt("xxx", 123))
 
+	cfg["temp"] = 0.7      // a float
+	cfg["tempstr"] = "0.3" // float as string
+	cfg["flag"] = true
+	cfg["flagstr"] = "true" // bool as string
+
+	assert.Equal(t, 0.7, cfg.GetFloat("temp", 1.5))
+	assert.Equal(t, 0.3, cfg.GetFloat("tempstr", 1.5))
+	assert.Equal(t, 234.0, cfg.GetFloat("count", 1.5))
+	assert.Equal(t, 345.0, cfg.GetFloat("integer", 1.5))
+	assert.Equal(t, 1.5, cfg.GetFloat("foo", 1.5))
+	assert.Equal(t, 1.5, cfg.GetFloat("xxx", 1.5))
+	assert.True(t, cfg.GetBool("flag", false))
+	assert.True(t, cfg.GetBool("flagstr", false))
+	assert.False(t, cfg.GetBool("foo", false))
+	assert.True(t, cfg.GetBool("xxx", true))
+
+	cfg["models"] = map[string]any{"ara": "gpt-4o", "fra": "gpt-4.1", "bad": 123}
+
+	assert.Equal(t, map[string]string{"ara": "gpt-4o", "fra": "gpt-4.1"}, cfg.GetStringMap("models"))
+	assert.Nil(t, cfg.GetStringMap("foo"))
+	assert.Nil(t, cfg.GetStringMap("xxx"))
+
+	cfg["fallbacks"] = []any{"gpt-4o-mini", 123, "gpt-4.1-nano"}
+
+	assert.Equal(t, []string{"gpt-4o-mini", "gpt-4.1-nano"}, cfg.GetStringList("fallbacks"))
+	assert.Nil(t, cfg.GetStringList("models"))
+	assert.Nil(t, cfg.GetStringList("xxx"))
+
+	cfg["variants"] = []any{map[string]any{"name": "control"}, "bad", map[string]any{"name": "short", "weight": 2.0}}
+
+	assert.Equal(t, []models.Config{{"name": "control"}, {"name": "short", "weight": 2.0}}, cfg.GetConfigList("variants"))
+	assert.Nil(t, cfg.GetConfigList("models"))
+	assert.Nil(t, cfg.GetConfigList("xxx"))
 }
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"log/slog"
+	"time"
 
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/events"
@@ -24,7 +25,31 @@ func handleLLMCalled(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAss
 	llm := oa.SessionAssets().LLMs().Get(event.LLM.UUID)
 	if llm != nil {
 		m := llm.Asset().(*models.LLM)
-		scene.AttachPreCommitHook(hooks.InsertLLMDailyCounts, m.RecordCall(rt, oa, event))
+		flow := e.Step().Run().Flow().Asset().(*models.Flow)
+		scene.AttachPreCommitHook(hooks.InsertLLMDailyCounts, m.RecordCall(oa, flow.ID(), event))
+
+		call := models.NewLLMCall(oa.OrgID(), m.ID(), flow.ID(), scene.ContactID(), time.Duration(event.ElapsedMS)*time.Millisecond, event.Tokens.Input, event.Tokens.Output, nil)
+		if code := scene.LLMDegradations.Take(event.Output); code != "" {
+			call.Degrade(code)
+			scene.AttachPreCommitHook(hooks.InsertLLMDailyCounts, m.RecordError(oa, flow.ID(), code))
+		}
+		scene.AttachPreCommitHook(hooks.InsertLLMCalls, call)
+
+		// events are handled once the sprint is over, so this takes the requests of this and any later calls in it
+		for _, httpLog := range scene.LLMHTTPLogs.Take() {
+			scene.AttachPreCommitHook(hooks.InsertHTTPLogs, models.NewLLMCalledLog(
+				oa.OrgID(),
+				flow.ID(),
+				httpLog.URL,
+				httpLog.StatusCode,
+				httpLog.Request,
+				httpLog.Response,
+				httpLog.Status != flows.CallStatusSuccess,
+				time.Duration(httpLog.ElapsedMS)*time.Millisecond,
+				httpLog.Retries,
+				httpLog.CreatedOn,
+			))
+		}
 	}
 
 	return nil
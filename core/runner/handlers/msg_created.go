@@ -43,6 +43,11 @@ func handleMsgCreated(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAs
 	} else {
 		flow := e.Step().Run().Flow().Asset().(*models.Flow)
 
+		// add any quick replies suggested by an LLM whose output this message includes
+		if len(event.Msg.QuickReplies()) == 0 {
+			event.Msg.QuickReplies_ = scene.LLMQuickReplies.For(event.Msg.Text())
+		}
+
 		msg, err = models.NewOutgoingFlowMsg(rt, oa.Org(), channel, scene.DBContact, flow, event, scene.IncomingMsg)
 	}
 	if err != nil {
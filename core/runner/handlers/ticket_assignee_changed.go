@@ -10,6 +10,7 @@ import (
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/core/runner"
 	"github.com/nyaruka/mailroom/v26/core/runner/hooks"
+	"github.com/nyaruka/mailroom/v26/core/tasks/ctasks"
 	"github.com/nyaruka/mailroom/v26/runtime"
 )
 
@@ -51,6 +52,11 @@ func handleTicketAssigneeChanged(ctx context.Context, rt *runtime.Runtime, oa *m
 		scene.AttachPreCommitHook(hooks.InsertDailyCounts, map[string]int{
 			fmt.Sprintf("tickets:assigned:%d:%d", teamID, assignee.ID()): 1,
 		})
+
+		// if the org has opted in, summarize the conversation for the agent it's being handed to
+		if oa.Org().TicketSummaryLLM() != "" {
+			scene.AttachPostCommitHook(hooks.QueueContactTask, ctasks.NewSummarizeTicket(event.TicketUUID))
+		}
 	}
 
 	return nil
@@ -10,6 +10,7 @@ import (
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/core/runner"
 	"github.com/nyaruka/mailroom/v26/core/runner/hooks"
+	"github.com/nyaruka/mailroom/v26/core/tasks/ctasks"
 	"github.com/nyaruka/mailroom/v26/runtime"
 )
 
@@ -23,9 +24,10 @@ func handleTicketOpened(ctx context.Context, rt *runtime.Runtime, oa *models.Org
 
 	slog.Debug("ticket opened", "contact", scene.ContactUUID(), "session", scene.SessionUUID(), "ticket", event.Ticket.UUID)
 
+	var topic *models.Topic
 	var topicID models.TopicID
 	if event.Ticket.Topic != nil {
-		topic := oa.TopicByUUID(event.Ticket.Topic.UUID)
+		topic = oa.TopicByUUID(event.Ticket.Topic.UUID)
 		if topic == nil {
 			return fmt.Errorf("unable to find topic with UUID: %s", event.Ticket.Topic.UUID)
 		}
@@ -62,6 +64,16 @@ func handleTicketOpened(ctx context.Context, rt *runtime.Runtime, oa *models.Org
 
 	scene.AttachPreCommitHook(hooks.InsertTickets, ticket)
 
+	// if the org has opted in, have an LLM choose a better topic than the default
+	if (topic == nil || topic.IsDefault()) && oa.Org().TicketTopicLLM() != "" {
+		scene.AttachPostCommitHook(hooks.QueueContactTask, ctasks.NewTicketOpened(event.Ticket.UUID))
+	}
+
+	// if the org has opted in, summarize the conversation for agents if the ticket was opened from a flow
+	if flow != nil && oa.Org().TicketSummaryLLM() != "" {
+		scene.AttachPostCommitHook(hooks.QueueContactTask, ctasks.NewSummarizeTicket(event.Ticket.UUID))
+	}
+
 	if assigneeID == models.NilUserID {
 		// ticket is unassigned so notify all possible assignees except the user who opened the ticket
 		for _, user := range models.GetTicketAssignableUsers(oa) {
@@ -0,0 +1,32 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/runner"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/vinovest/sqlx"
+)
+
+// InsertLLMCalls is our hook for inserting records of LLM calls
+var InsertLLMCalls runner.PreCommitHook = &insertLLMCalls{}
+
+type insertLLMCalls struct{}
+
+func (h *insertLLMCalls) Order() int { return 10 }
+
+func (h *insertLLMCalls) Execute(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*runner.Scene][]any) error {
+	calls := make([]*models.LLMCall, 0, len(scenes))
+	for _, args := range scenes {
+		for _, c := range args {
+			calls = append(calls, c.(*models.LLMCall))
+		}
+	}
+
+	if err := models.InsertLLMCalls(ctx, tx, calls); err != nil {
+		return fmt.Errorf("error inserting llm calls: %w", err)
+	}
+	return nil
+}
@@ -40,7 +40,7 @@ func (h *updateMessageHandled) Execute(ctx context.Context, rt *runtime.Runtime,
 			ticket = scene.DBContact.FindTicket(evt.TicketUUID)
 		}
 
-		err := models.MarkMessageHandled(ctx, tx, msgIn.UUID, models.MsgStatusHandled, visibility, flow, ticket, msgIn.Attachments, msgIn.LogUUIDs)
+		err := models.MarkMessageHandled(ctx, tx, msgIn.UUID, models.MsgStatusHandled, visibility, flow, ticket, msgIn.Attachments, msgIn.LogUUIDs, msgIn.Transcript)
 		if err != nil {
 			return fmt.Errorf("error marking message as handled: %w", err)
 		}
@@ -42,6 +42,10 @@ type Scene struct {
 	WaitTimeout         time.Duration
 	PriorRunModifiedOns map[flows.RunUUID]time.Time
 	OutgoingMsgs        []*models.MsgOut
+	LLMQuickReplies     *models.LLMQuickReplies
+	LLMDeferrals        *models.LLMDeferrals // if set, calls to asynchronous LLMs are deferred rather than made
+	LLMHTTPLogs         *models.LLMHTTPLogs
+	LLMDegradations     *models.LLMDegradations
 
 	preCommits    map[PreCommitHook][]any
 	postCommits   map[PostCommitHook][]any
@@ -58,6 +62,10 @@ func NewScene(dbContact *models.Contact, contact *flows.Contact) *Scene {
 		DBContact: dbContact,
 		Contact:   contact,
 
+		LLMQuickReplies: models.NewLLMQuickReplies(),
+		LLMHTTPLogs:     models.NewLLMHTTPLogs(),
+		LLMDegradations: models.NewLLMDegradations(),
+
 		preCommits:  make(map[PreCommitHook][]any),
 		postCommits: make(map[PostCommitHook][]any),
 		rawEvents:   make([]flows.Event, 0, 5),
@@ -69,6 +77,22 @@ func NewScene(dbContact *models.Contact, contact *flows.Contact) *Scene {
 func (s *Scene) ContactID() models.ContactID    { return models.ContactID(s.Contact.ID()) }
 func (s *Scene) ContactUUID() flows.ContactUUID { return s.Contact.UUID() }
 
+// gets the context for the engine to run this scene's session in, which is passed on to LLM calls made by its actions,
+// and where the session is nil if it's being started, and the event is that of the trigger or resume
+func (s *Scene) engineContext(ctx context.Context, oa *models.OrgAssets, session flows.Session, event flows.Event) context.Context {
+	ctx = models.WithLLMQuickReplies(models.WithContactID(ctx, s.ContactID()), s.LLMQuickReplies)
+	ctx = models.WithLLMHTTPLogs(ctx, s.LLMHTTPLogs)
+	ctx = models.WithLLMDegradations(ctx, s.LLMDegradations)
+	ctx = models.WithLLMVariables(ctx, models.NewLLMVariables(oa, s.Contact, session))
+	if msgEvent, ok := event.(*events.MsgReceived); ok {
+		ctx = models.WithLLMAttachments(ctx, msgEvent.Msg.Attachments())
+	}
+	if s.LLMDeferrals != nil {
+		ctx = models.WithLLMDeferrals(ctx, s.LLMDeferrals)
+	}
+	return ctx
+}
+
 // SessionUUID is a convenience utility to get the session UUID for this scene if any
 func (s *Scene) SessionUUID() flows.SessionUUID {
 	if s.Session == nil {
@@ -136,6 +160,9 @@ func (s *Scene) addSprint(ctx context.Context, rt *runtime.Runtime, oa *models.O
 		}
 	}
 
+	// messages sent without a translation in the contact's language may be machine translated before they're handled
+	evts = translateMessages(ctx, rt, oa, s.Contact, evts)
+
 	evts = append(evts, newSprintEndedEvent(s.DBContact, resumed))
 
 	for _, e := range evts {
@@ -175,7 +202,7 @@ func (s *Scene) StartSession(ctx context.Context, rt *runtime.Runtime, oa *model
 		}
 	}
 
-	session, sprint, err := s.Engine(rt).NewSession(ctx, oa.SessionAssets(), oa.Env(), s.Contact, trigger, s.Call)
+	session, sprint, err := s.Engine(rt).NewSession(s.engineContext(ctx, oa, nil, trigger.Event()), oa.SessionAssets(), oa.Env(), s.Contact, trigger, s.Call)
 	if err != nil {
 		return fmt.Errorf("error starting contact %s in flow %s: %w", s.ContactUUID(), trigger.Flow().UUID, err)
 	}
@@ -222,7 +249,7 @@ func (s *Scene) ResumeSession(ctx context.Context, rt *runtime.Runtime, oa *mode
 		s.PriorRunModifiedOns[r.UUID()] = r.ModifiedOn()
 	}
 
-	sprint, err := fs.Resume(ctx, resume)
+	sprint, err := fs.Resume(s.engineContext(ctx, oa, fs, resume.Event()), resume)
 	if err != nil {
 		return fmt.Errorf("error resuming flow: %w", err)
 	}
@@ -148,6 +148,42 @@ func TestSingleSprintSession(t *testing.T) {
 	testsuite.AssertContactFires(t, rt, testdb.Bob.ID, map[string]time.Time{})
 }
 
+func TestMachineTranslatedMessages(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetValkey|testsuite.ResetData|testsuite.ResetDynamo)
+
+	rt.DB.MustExec(`UPDATE ai_llm SET config = config || '{"translate_messages": true}'::jsonb WHERE id = $1`, testdb.TestLLM.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET language = 'spa' WHERE id = $1`, testdb.Bob.ID)
+
+	testFlows := testdb.ImportFlows(t, rt, testdb.Org1, "testdata/session_test_flows.json")
+	flow := testFlows[1]
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshFlows|models.RefreshLLMs)
+	require.NoError(t, err)
+
+	// flow has no Spanish translation so messages to Bob are machine translated, whereas Dan has no language
+	trig := triggers.NewBuilder(flow.Reference()).Manual().Build()
+	scenes := testsuite.StartSessions(t, rt, oa, []*testdb.Contact{testdb.Bob, testdb.Dan}, trig)
+
+	assertdb.Query(t, rt.DB, `SELECT text, locale::text LIKE 'spa%' AS spanish FROM msgs_msg WHERE contact_id = $1 AND flow_id = $2`, testdb.Bob.ID, flow.ID).
+		Columns(map[string]any{"text": "Ju57 w4n73d 70 54y h1", "spanish": true})
+	assertdb.Query(t, rt.DB, `SELECT text FROM msgs_msg WHERE contact_id = $1 AND flow_id = $2`, testdb.Dan.ID, flow.ID).Returns("Just wanted to say hi")
+
+	// translations are marked by warnings which are persisted to the contact's history
+	var warnings []string
+	for _, e := range scenes[0].Events() {
+		if w, ok := e.(*events.Warning); ok {
+			warnings = append(warnings, w.Text)
+		}
+	}
+	assert.Equal(t, []string{"message machine translated from eng to spa by Test"}, warnings)
+	assert.True(t, models.PersistEvent(events.NewWarning(warnings[0])))
+
+	// and recorded as usage of the LLM
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'calls'`, testdb.TestLLM.ID).Returns(int64(1))
+}
+
 func TestSessionWithSubflows(t *testing.T) {
 	ctx, rt := testsuite.Runtime(t)
 
@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// if the org has an LLM for translation, translates messages in the given events which flows sent in another language
+// because they have no translation in the contact's language, adding a warning after each that it was machine
+// translated. Any failure leaves the message as the flow sent it.
+func translateMessages(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, contact *flows.Contact, evts []flows.Event) []flows.Event {
+	llm := oa.TranslationLLM()
+	to := contact.Language()
+	if llm == nil || to == i18n.NilLanguage {
+		return evts
+	}
+
+	var svc ai.TranslationService
+	translated := make([]flows.Event, 0, len(evts))
+
+	for _, e := range evts {
+		translated = append(translated, e)
+
+		event, ok := e.(*events.MsgCreated)
+		if !ok || event.BroadcastUUID != "" || event.Msg.Templating() != nil || event.Msg.Text() == "" {
+			continue
+		}
+		from, country := event.Msg.Locale().Split()
+		if from == i18n.NilLanguage || from == to {
+			continue
+		}
+
+		if svc == nil {
+			fsvc, err := llm.AsService(rt, rt.HTTP.Services)
+			if err != nil {
+				slog.Error("error creating LLM service for translation", "llm", llm.UUID(), "error", err)
+				return evts
+			}
+			if svc, ok = fsvc.(ai.TranslationService); !ok {
+				return evts
+			}
+		}
+
+		callStart := time.Now()
+		resp, err := svc.Translate(ctx, event.Msg.Text(), from, to)
+
+		var llmResp *flows.LLMResponse
+		if resp != nil {
+			llmResp = resp.LLMResponse()
+		}
+		if rerr := llm.RecordStandaloneCall(ctx, rt, oa, "", event.Msg.Text(), llmResp, time.Since(callStart), err != nil); rerr != nil {
+			slog.Error("error recording llm call", "error", rerr, "llm", llm.UUID())
+		}
+
+		if err != nil {
+			slog.Error("error translating flow message", "llm", llm.UUID(), "error", err)
+			continue
+		}
+
+		event.Msg.Text_ = resp.Output
+		event.Msg.Locale_ = i18n.NewLocale(to, country)
+
+		translated = append(translated, events.NewWarning(fmt.Sprintf("%s from %s to %s by %s", models.MachineTranslatedWarning, from, to, llm.Name())))
+	}
+
+	return translated
+}
@@ -0,0 +1,52 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// TypeCallLLM is the type of the call LLM task
+const TypeCallLLM = "call_llm"
+
+// timeout of deferred calls whose LLM no longer exists
+const defaultCallLLMTimeout = time.Minute
+
+func init() {
+	RegisterType(TypeCallLLM, func() Task { return &CallLLM{} })
+}
+
+// CallLLM is our task for making an LLM call which was deferred during the handling of a contact's message, storing
+// its result, and then resuming the processing of the contact's queue so that the handling is retried with that result.
+// These are queued on the AI queue so that slow calls don't tie up the workers which handle messages.
+type CallLLM struct {
+	Call *models.LLMDeferredCall `json:"call" validate:"required"`
+}
+
+func (t *CallLLM) Type() string {
+	return TypeCallLLM
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *CallLLM) Timeout() time.Duration {
+	return 10 * time.Minute
+}
+
+func (t *CallLLM) WithAssets() models.Refresh {
+	return models.RefreshNone
+}
+
+func (t *CallLLM) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) error {
+	if err := t.Call.Make(ctx, rt, oa); err != nil {
+		return fmt.Errorf("error making deferred LLM call: %w", err)
+	}
+
+	// the contact's deferred task is still at the front of their queue, waiting for this result
+	if err := Queue(ctx, rt, rt.Queues.Realtime, oa.OrgID(), &ProcessContactQueue{ContactID: t.Call.ContactID}, false); err != nil {
+		return fmt.Errorf("error queuing contact queue task: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// TypeCategorizeContacts is the type of the categorize contacts task
+const TypeCategorizeContacts = "categorize_contacts"
+
+const (
+	categorizeProgressKey  = "llm_categorize:%s"      // hash of the progress of a job
+	categorizeDoneKey      = "llm_categorize:%s:done" // set of the contacts processed by a job
+	categorizeProgressTTL  = time.Hour * 24 * 7
+	categorizeBatchSize    = 25
+	categorizeMaxInputSize = 2000 // maximum number of characters of a field value that we categorize
+)
+
+func init() {
+	RegisterType(TypeCategorizeContacts, func() Task { return &CategorizeContacts{} })
+}
+
+// CategorizeContacts is our task to categorize the value of a field for each contact in a group using an LLM, saving the
+// category to another field. Contacts are processed in batch tasks on the throttled queue and progress is tracked in
+// Valkey by job ID. Contacts already processed by a job are skipped, so a job which was interrupted, e.g. because the
+// org's LLM budget ran out, can be resumed by queuing this task again with the same job ID. Jobs which aren't urgent
+// can opt into having each batch processed offline by the LLM's provider at lower cost.
+type CategorizeContacts struct {
+	JobID       string         `json:"job_id"       validate:"required"`
+	LLMID       models.LLMID   `json:"llm_id"       validate:"required"`
+	GroupID     models.GroupID `json:"group_id"     validate:"required"`
+	InputField  string         `json:"input_field"  validate:"required"`
+	OutputField string         `json:"output_field" validate:"required"`
+	Categories  []string       `json:"categories"   validate:"required,min=1"`
+	UseBatch    bool           `json:"use_batch,omitempty"`
+}
+
+func (t *CategorizeContacts) Type() string {
+	return TypeCategorizeContacts
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *CategorizeContacts) Timeout() time.Duration {
+	return time.Minute * 10
+}
+
+func (t *CategorizeContacts) WithAssets() models.Refresh {
+	return models.RefreshFields
+}
+
+// Perform looks up the contacts in the group which this job hasn't yet processed and queues batch tasks to categorize them
+func (t *CategorizeContacts) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) error {
+	if oa.LLMByID(t.LLMID) == nil {
+		return fmt.Errorf("no such LLM with ID %d", t.LLMID)
+	}
+	if oa.FieldByKey(t.InputField) == nil || oa.FieldByKey(t.OutputField) == nil {
+		return fmt.Errorf("no such fields '%s' and '%s'", t.InputField, t.OutputField)
+	}
+
+	contactIDs, err := models.GetGroupContactIDs(ctx, rt.DB, t.GroupID)
+	if err != nil {
+		return fmt.Errorf("error getting contacts in group %d: %w", t.GroupID, err)
+	}
+
+	done, err := getCategorizedContactIDs(ctx, rt, t.JobID)
+	if err != nil {
+		return err
+	}
+
+	remaining := slices.DeleteFunc(contactIDs, func(id models.ContactID) bool { _, ok := done[id]; return ok })
+
+	if err := initCategorizeProgress(ctx, rt, t.JobID, len(remaining)+len(done)); err != nil {
+		return err
+	}
+
+	for _, batch := range slices.Collect(slices.Chunk(remaining, categorizeBatchSize)) {
+		task := &CategorizeContactsBatch{CategorizeContacts: *t, ContactIDs: batch}
+
+		if err := Queue(ctx, rt, rt.Queues.AI, oa.OrgID(), task, false); err != nil {
+			return fmt.Errorf("error queuing categorize contacts batch task: %w", err)
+		}
+	}
+
+	slog.Info("queued categorize contacts batch tasks", "job", t.JobID, "group_id", t.GroupID, "contacts", len(remaining), "already_done", len(done))
+
+	return nil
+}
+
+// CategorizeProgress is the progress of a categorization job
+type CategorizeProgress struct {
+	Total       int `json:"total"`
+	Processed   int `json:"processed"`
+	Categorized int `json:"categorized"`
+	Failed      int `json:"failed"`
+}
+
+// GetCategorizeProgress gets the progress of the given categorization job, or nil if there's no such job
+func GetCategorizeProgress(ctx context.Context, rt *runtime.Runtime, jobID string) (*CategorizeProgress, error) {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	vals, err := valkey.IntMap(valkey.DoContext(vc, ctx, "HGETALL", fmt.Sprintf(categorizeProgressKey, jobID)))
+	if err != nil {
+		return nil, fmt.Errorf("error getting categorize progress: %w", err)
+	}
+	if len(vals) == 0 {
+		return nil, nil
+	}
+
+	return &CategorizeProgress{Total: vals["total"], Processed: vals["processed"], Categorized: vals["categorized"], Failed: vals["failed"]}, nil
+}
+
+func initCategorizeProgress(ctx context.Context, rt *runtime.Runtime, jobID string, total int) error {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	key := fmt.Sprintf(categorizeProgressKey, jobID)
+
+	// failures are reset as a resumed job will retry them
+	vc.Send("MULTI")
+	vc.Send("HSET", key, "total", total, "failed", 0)
+	vc.Send("EXPIRE", key, int(categorizeProgressTTL.Seconds()))
+	if _, err := valkey.DoContext(vc, ctx, "EXEC"); err != nil {
+		return fmt.Errorf("error initializing categorize progress: %w", err)
+	}
+	return nil
+}
+
+// records that the given contacts have been processed, of which some may have been categorized, and that others failed
+func recordCategorizeProgress(ctx context.Context, rt *runtime.Runtime, jobID string, processed []models.ContactID, categorized, failed int) error {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	key := fmt.Sprintf(categorizeProgressKey, jobID)
+	doneKey := fmt.Sprintf(categorizeDoneKey, jobID)
+	ttl := int(categorizeProgressTTL.Seconds())
+
+	vc.Send("MULTI")
+	vc.Send("HINCRBY", key, "processed", len(processed))
+	vc.Send("HINCRBY", key, "categorized", categorized)
+	vc.Send("HINCRBY", key, "failed", failed)
+	vc.Send("EXPIRE", key, ttl)
+	if len(processed) > 0 {
+		vc.Send("SADD", valkey.Args{}.Add(doneKey).AddFlat(processed)...)
+		vc.Send("EXPIRE", doneKey, ttl)
+	}
+	if _, err := valkey.DoContext(vc, ctx, "EXEC"); err != nil {
+		return fmt.Errorf("error recording categorize progress: %w", err)
+	}
+	return nil
+}
+
+func getCategorizedContactIDs(ctx context.Context, rt *runtime.Runtime, jobID string) (map[models.ContactID]struct{}, error) {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	ids, err := valkey.Ints(valkey.DoContext(vc, ctx, "SMEMBERS", fmt.Sprintf(categorizeDoneKey, jobID)))
+	if err != nil {
+		return nil, fmt.Errorf("error getting processed contacts: %w", err)
+	}
+
+	done := make(map[models.ContactID]struct{}, len(ids))
+	for _, id := range ids {
+		done[models.ContactID(id)] = struct{}{}
+	}
+	return done, nil
+}
@@ -0,0 +1,242 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/gocommon/stringsx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/runner"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// TypeCategorizeContactsBatch is the type of the categorize contacts batch task
+const TypeCategorizeContactsBatch = "categorize_contacts_batch"
+
+func init() {
+	RegisterType(TypeCategorizeContactsBatch, func() Task { return &CategorizeContactsBatch{} })
+}
+
+// CategorizeContactsBatch is our task to categorize a batch of the contacts of a categorization job
+type CategorizeContactsBatch struct {
+	CategorizeContacts
+
+	ContactIDs []models.ContactID `json:"contact_ids" validate:"required"`
+
+	// results of an offline batch in the order of the contacts, if this task is being queued again with them
+	Results []*ai.BatchResult `json:"results,omitempty"`
+}
+
+func (t *CategorizeContactsBatch) Type() string {
+	return TypeCategorizeContactsBatch
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *CategorizeContactsBatch) Timeout() time.Duration {
+	return time.Minute * 5
+}
+
+func (t *CategorizeContactsBatch) WithAssets() models.Refresh {
+	return models.RefreshNone
+}
+
+func (t *CategorizeContactsBatch) SetBatchResults(results []*ai.BatchResult) {
+	t.Results = results
+}
+
+// a contact to be categorized and the value to categorize
+type categorizeInput struct {
+	contactID models.ContactID
+	value     string
+}
+
+// Perform categorizes each contact in the batch, stopping early if the LLM starts rejecting calls, e.g. because the
+// org has run out of budget, in which case the remaining contacts are left for the job to be resumed. If the job uses
+// offline batches, the contacts are instead submitted as a batch and categorized when this is queued with the results.
+func (t *CategorizeContactsBatch) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) error {
+	llm := oa.LLMByID(t.LLMID)
+	inputField := oa.SessionAssets().Fields().Get(t.InputField)
+	outputField := oa.SessionAssets().Fields().Get(t.OutputField)
+	if llm == nil || inputField == nil || outputField == nil {
+		return recordCategorizeProgress(ctx, rt, t.JobID, nil, 0, len(t.ContactIDs))
+	}
+
+	var processed []models.ContactID
+	var outputs map[models.ContactID]string
+
+	if t.Results != nil {
+		outputs = t.batchOutputs()
+	} else {
+		inputs, empty, err := t.loadInputs(ctx, rt, oa, inputField)
+		if err != nil {
+			return err
+		}
+
+		// contacts without a value have nothing to categorize
+		processed = empty
+
+		instructions := prompts.Render("categorize", map[string]any{"arg1": strings.Join(t.Categories, ", ")})
+
+		if t.UseBatch {
+			return t.submitBatch(ctx, rt, oa, llm, instructions, inputs, processed)
+		}
+
+		outputs, err = t.callLLM(ctx, rt, oa, llm, instructions, inputs)
+		if err != nil {
+			return err
+		}
+	}
+
+	mods := make(map[models.ContactID][]flows.Modifier, len(outputs))
+
+	for contactID, output := range outputs {
+		processed = append(processed, contactID)
+
+		if category := matchCategory(output, t.Categories); category != "" {
+			mods[contactID] = []flows.Modifier{modifiers.NewField(outputField, category)}
+		}
+	}
+
+	if len(mods) > 0 {
+		contactIDs := make([]models.ContactID, 0, len(mods))
+		for id := range mods {
+			contactIDs = append(contactIDs, id)
+		}
+
+		_, skipped, err := runner.ModifyWithLock(ctx, rt, oa, models.NilUserID, contactIDs, mods, nil, "")
+		if err != nil {
+			return fmt.Errorf("error saving categories: %w", err)
+		}
+
+		// contacts we couldn't lock haven't been categorized so they're left for the job to be resumed
+		for _, id := range skipped {
+			delete(mods, id)
+		}
+		processed = slices.DeleteFunc(processed, func(id models.ContactID) bool { return slices.Contains(skipped, id) })
+	}
+
+	return recordCategorizeProgress(ctx, rt, t.JobID, processed, len(mods), len(t.ContactIDs)-len(processed))
+}
+
+// loads the values of the contacts to be categorized, returning them along with the contacts which don't have a value
+func (t *CategorizeContactsBatch) loadInputs(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, inputField *flows.Field) ([]*categorizeInput, []models.ContactID, error) {
+	mcs, err := models.LoadContacts(ctx, rt.DB, oa, t.ContactIDs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading contacts: %w", err)
+	}
+
+	inputs := make([]*categorizeInput, 0, len(mcs))
+	var empty []models.ContactID
+
+	for _, mc := range mcs {
+		contact, err := mc.EngineContact(oa)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating flow contact: %w", err)
+		}
+
+		value := contact.Fields().Get(inputField)
+		if value == nil || value.Text.Native() == "" {
+			empty = append(empty, mc.ID())
+			continue
+		}
+
+		inputs = append(inputs, &categorizeInput{contactID: mc.ID(), value: stringsx.Truncate(value.Text.Native(), categorizeMaxInputSize)})
+	}
+
+	return inputs, empty, nil
+}
+
+// calls the LLM for each input, returning the outputs of the calls which succeeded
+func (t *CategorizeContactsBatch) callLLM(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, llm *models.LLM, instructions string, inputs []*categorizeInput) (map[models.ContactID]string, error) {
+	svc, err := llm.AsService(rt, rt.HTTP.Services)
+	if err != nil {
+		return nil, fmt.Errorf("error creating LLM service: %w", err)
+	}
+
+	outputs := make(map[models.ContactID]string, len(inputs))
+
+	for _, in := range inputs {
+		callStart := time.Now()
+		resp, err := svc.Response(ctx, instructions, in.value, llm.MaxOutputTokens())
+
+		if rerr := llm.RecordStandaloneCall(ctx, rt, oa, instructions, in.value, resp, time.Since(callStart), err != nil); rerr != nil {
+			slog.Error("error recording llm call", "error", rerr, "llm", llm.UUID())
+		}
+
+		if err != nil {
+			if code := ai.ErrorCode(err); code == ai.ErrorRateLimit || code == ai.ErrorBudgetExceeded {
+				slog.Warn("stopping categorize contacts batch", "job", t.JobID, "error", err)
+				break
+			}
+			slog.Error("error categorizing contact", "job", t.JobID, "contact", in.contactID, "error", err)
+			continue
+		}
+
+		outputs[in.contactID] = resp.Output
+	}
+
+	return outputs, nil
+}
+
+// submits the inputs as an offline batch, recording the contacts without values as processed now, and queuing this
+// task again for just the submitted contacts when the batch has finished
+func (t *CategorizeContactsBatch) submitBatch(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, llm *models.LLM, instructions string, inputs []*categorizeInput, processed []models.ContactID) error {
+	if len(inputs) == 0 {
+		return recordCategorizeProgress(ctx, rt, t.JobID, processed, 0, 0)
+	}
+
+	reqs := make([]*ai.Request, len(inputs))
+	task := &CategorizeContactsBatch{CategorizeContacts: t.CategorizeContacts, ContactIDs: make([]models.ContactID, len(inputs))}
+	for i, in := range inputs {
+		reqs[i] = &ai.Request{Instructions: instructions, Input: in.value, MaxTokens: llm.MaxOutputTokens(), Idempotent: true}
+		task.ContactIDs[i] = in.contactID
+	}
+
+	err := submitLLMBatch(ctx, rt, oa, llm, task, func(bs ai.BatchService) (string, error) { return bs.SubmitBatch(ctx, reqs) })
+	if err != nil {
+		if ai.ErrorCode(err) != ai.ErrorBudgetExceeded {
+			return fmt.Errorf("error submitting categorize batch: %w", err)
+		}
+		slog.Warn("stopping categorize contacts batch", "job", t.JobID, "error", err)
+		return recordCategorizeProgress(ctx, rt, t.JobID, processed, 0, len(inputs))
+	}
+
+	return recordCategorizeProgress(ctx, rt, t.JobID, processed, 0, 0)
+}
+
+// gets the outputs of the batch results which succeeded
+func (t *CategorizeContactsBatch) batchOutputs() map[models.ContactID]string {
+	outputs := make(map[models.ContactID]string, len(t.Results))
+
+	for i, r := range t.Results {
+		if i >= len(t.ContactIDs) {
+			break
+		}
+		if r.Error != "" {
+			slog.Error("error categorizing contact", "job", t.JobID, "contact", t.ContactIDs[i], "error", r.Error)
+			continue
+		}
+		outputs[t.ContactIDs[i]] = r.Output
+	}
+
+	return outputs
+}
+
+// matches LLM output to one of the given categories, ignoring case and surrounding whitespace or quotes
+func matchCategory(output string, categories []string) string {
+	output = strings.Trim(strings.TrimSpace(output), `"'.`)
+	for _, c := range categories {
+		if strings.EqualFold(c, output) {
+			return c
+		}
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package tasks_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	_ "github.com/nyaruka/mailroom/v26/core/runner/handlers"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCategorizeContacts(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetAll)
+
+	group := testdb.InsertContactGroup(t, rt, testdb.Org1, "e52fee05-2f95-4445-aef6-2fe7dac2fd56", "Survey", "", testdb.Ann, testdb.Bob, testdb.Cat)
+
+	// test LLM returns whatever follows \return, so Ann can be categorized but Bob can't and Cat has no value
+	setGender := func(c *testdb.Contact, value string) {
+		rt.DB.MustExec(fmt.Sprintf(`UPDATE contacts_contact SET fields = fields || '{"%s": {"text": "%s"}}'::jsonb WHERE id = $1`, testdb.GenderField.UUID, value), c.ID)
+	}
+	setGender(testdb.Ann, `\\return female`)
+	setGender(testdb.Bob, `\\return dunno`)
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = fields - $2 WHERE id = $1`, testdb.Cat.ID, testdb.GenderField.UUID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshGroups|models.RefreshFields)
+	require.NoError(t, err)
+
+	task := &tasks.CategorizeContacts{
+		JobID:       "01992f54-5ab6-717a-a39e-e8ca91fb7262",
+		LLMID:       testdb.TestLLM.ID,
+		GroupID:     group.ID,
+		InputField:  "gender",
+		OutputField: "gender",
+		Categories:  []string{"Male", "Female"},
+	}
+	require.NoError(t, task.Perform(ctx, rt, oa))
+
+	progress, err := tasks.GetCategorizeProgress(ctx, rt, task.JobID)
+	assert.NoError(t, err)
+	assert.Equal(t, &tasks.CategorizeProgress{Total: 3}, progress)
+
+	testsuite.FlushTasks(t, rt)
+
+	progress, err = tasks.GetCategorizeProgress(ctx, rt, task.JobID)
+	assert.NoError(t, err)
+	assert.Equal(t, &tasks.CategorizeProgress{Total: 3, Processed: 3, Categorized: 1}, progress)
+
+	assertdb.Query(t, rt.DB, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdb.Ann.ID, testdb.GenderField.UUID).Returns("Female")
+	assertdb.Query(t, rt.DB, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdb.Bob.ID, testdb.GenderField.UUID).Returns(`\return dunno`)
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'calls'`, testdb.TestLLM.ID).Returns(int64(2))
+
+	// resuming the job finds nothing left to do
+	require.NoError(t, task.Perform(ctx, rt, oa))
+	testsuite.FlushTasks(t, rt)
+
+	progress, err = tasks.GetCategorizeProgress(ctx, rt, task.JobID)
+	assert.NoError(t, err)
+	assert.Equal(t, &tasks.CategorizeProgress{Total: 3, Processed: 3, Categorized: 1}, progress)
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'calls'`, testdb.TestLLM.ID).Returns(int64(2))
+
+	// unknown jobs have no progress
+	progress, err = tasks.GetCategorizeProgress(ctx, rt, "01992f54-5ab6-717a-a39e-e8ca91fb7263")
+	assert.NoError(t, err)
+	assert.Nil(t, progress)
+}
+
+func TestCategorizeContactsBatchResults(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetAll)
+
+	task := &tasks.CategorizeContactsBatch{
+		CategorizeContacts: tasks.CategorizeContacts{
+			JobID:       "01992f54-5ab6-717a-a39e-e8ca91fb7262",
+			LLMID:       testdb.TestLLM.ID,
+			GroupID:     testdb.DoctorsGroup.ID,
+			InputField:  "gender",
+			OutputField: "gender",
+			Categories:  []string{"Male", "Female"},
+			UseBatch:    true,
+		},
+		ContactIDs: []models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID},
+	}
+	batch := &models.LLMBatch{ID: "batch_123", OrgID: testdb.Org1.ID, LLMID: testdb.TestLLM.ID, TaskType: task.Type(), Task: jsonx.MustMarshal(task)}
+
+	// results are fed back to the task which submitted the batch
+	err := tasks.QueueBatchResults(ctx, rt, batch, []*ai.BatchResult{
+		{Output: "female", TokensInput: 20, TokensOutput: 1},
+		{Output: "dunno", TokensInput: 20, TokensOutput: 1},
+		{Error: "Input is too long"},
+	})
+	require.NoError(t, err)
+
+	testsuite.FlushTasks(t, rt)
+
+	progress, err := tasks.GetCategorizeProgress(ctx, rt, task.JobID)
+	assert.NoError(t, err)
+	assert.Equal(t, &tasks.CategorizeProgress{Processed: 2, Categorized: 1, Failed: 1}, progress)
+
+	assertdb.Query(t, rt.DB, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdb.Ann.ID, testdb.GenderField.UUID).Returns("Female")
+}
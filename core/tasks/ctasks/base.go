@@ -27,6 +27,16 @@ type Task interface {
 
 var registeredTypes = map[string]func() Task{}
 
+// DeferredError is returned by tasks which couldn't be completed because LLM calls made during them were deferred, in
+// which case the task should be retried once those calls have been made asynchronously
+type DeferredError struct {
+	Calls []*models.LLMDeferredCall
+}
+
+func (e *DeferredError) Error() string {
+	return fmt.Sprintf("task deferred until %d LLM call(s) are made", len(e.Calls))
+}
+
 func RegisterType(name string, initFunc func() Task) {
 	registeredTypes[name] = initFunc
 }
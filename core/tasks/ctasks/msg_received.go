@@ -3,8 +3,12 @@ package ctasks
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"slices"
+	"time"
 
 	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/events"
@@ -12,6 +16,8 @@ import (
 	"github.com/nyaruka/goflow/flows/resumes"
 	"github.com/nyaruka/goflow/flows/triggers"
 	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
 	"github.com/nyaruka/mailroom/v26/core/ivr"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/core/msgio"
@@ -36,6 +42,16 @@ type MsgReceived struct {
 	Attachments   []string         `json:"attachments,omitempty"`
 	NewContact    bool             `json:"new_contact"`
 	NewURN        *NewURNSpec      `json:"new_urn,omitempty"`
+
+	// set if handling was deferred until LLM calls were made, with the results of those made before it was
+	Deferred *MsgDeferredResults `json:"deferred,omitempty"`
+}
+
+// MsgDeferredResults are the results of the LLM calls made when handling a message before it was deferred, so that
+// they aren't made again, and billed again, when it's retried
+type MsgDeferredResults struct {
+	Transcript string        `json:"transcript,omitempty"`
+	Language   i18n.Language `json:"language,omitempty"`
 }
 
 func (t *MsgReceived) Type() string {
@@ -79,13 +95,24 @@ func (t *MsgReceived) perform(ctx context.Context, rt *runtime.Runtime, oa *mode
 		}
 	}
 
+	// if there's no text but there is audio, try to transcribe it so that flows have text to route on
+	text, transcript := t.Text, ""
+	if text == "" {
+		if t.Deferred != nil {
+			transcript = t.Deferred.Transcript
+		} else {
+			transcript = transcribeAudio(ctx, rt, oa, availableAttachments)
+		}
+		text = transcript
+	}
+
 	// associate this message with the last open ticket for this contact if there is one
 	var ticketUUID flows.TicketUUID
 	if tks := mc.Tickets(); len(tks) > 0 {
 		ticketUUID = tks[len(tks)-1].UUID
 	}
 
-	msgIn := flows.NewMsgIn(t.URN, channel.Reference(), t.Text, availableAttachments, string(t.MsgExternalID))
+	msgIn := flows.NewMsgIn(t.URN, channel.Reference(), text, availableAttachments, string(t.MsgExternalID))
 	msgEvent := events.NewMsgReceived(msgIn, ticketUUID)
 	msgEvent.UUID_ = t.MsgUUID
 
@@ -96,11 +123,13 @@ func (t *MsgReceived) perform(ctx context.Context, rt *runtime.Runtime, oa *mode
 	}
 
 	scene := runner.NewScene(mc, contact)
+	scene.LLMDeferrals = models.NewLLMDeferrals()
 	scene.IncomingMsg = &models.MsgInRef{
 		UUID:        t.MsgUUID,
 		ExtID:       t.MsgExternalID,
 		Attachments: attachments,
 		LogUUIDs:    logUUIDs,
+		Transcript:  transcript,
 	}
 
 	if t.NewContact {
@@ -130,6 +159,22 @@ func (t *MsgReceived) perform(ctx context.Context, rt *runtime.Runtime, oa *mode
 		}
 	}
 
+	// if the contact has no language, try to detect it from their message so that flows use the right translations
+	detected := i18n.NilLanguage
+	if contact.Language() == i18n.NilLanguage && text != "" {
+		if t.Deferred != nil {
+			detected = t.Deferred.Language
+		} else {
+			detected = detectLanguage(ctx, rt, oa, text)
+		}
+
+		if detected != i18n.NilLanguage {
+			if err := scene.ApplyModifier(ctx, rt, oa, modifiers.NewLanguage(detected), models.NilUserID, ""); err != nil {
+				return fmt.Errorf("error applying language modifier: %w", err)
+			}
+		}
+	}
+
 	if err := scene.AddEvent(ctx, rt, oa, msgEvent, models.NilUserID, ""); err != nil {
 		return fmt.Errorf("error adding message event to scene: %w", err)
 	}
@@ -138,6 +183,13 @@ func (t *MsgReceived) perform(ctx context.Context, rt *runtime.Runtime, oa *mode
 		return fmt.Errorf("error handing message event in scene: %w", err)
 	}
 
+	// if calls to asynchronous LLMs were deferred, discard this handling so that it can be retried once they're made,
+	// keeping the results of the calls already made so that the retry can reuse them
+	if calls := scene.LLMDeferrals.Calls(); len(calls) > 0 {
+		t.Deferred = &MsgDeferredResults{Transcript: transcript, Language: detected}
+		return &DeferredError{Calls: calls}
+	}
+
 	// update last_seen_on last so that during flow execution it's the previous value which is more useful than now
 	if err := scene.ApplyModifier(ctx, rt, oa, modifiers.NewSeen(dates.Now()), models.NilUserID, ""); err != nil {
 		return fmt.Errorf("error applying last seen modifier: %w", err)
@@ -147,6 +199,17 @@ func (t *MsgReceived) perform(ctx context.Context, rt *runtime.Runtime, oa *mode
 		return fmt.Errorf("error committing scene: %w", err)
 	}
 
+	if err := scene.LLMDeferrals.Release(ctx, rt); err != nil {
+		slog.Error("error releasing deferred LLM call results", "error", err, "contact", mc.UUID())
+	}
+
+	// sentiment is scored in batches by a cron so that it doesn't slow down handling and is cheaper at scale
+	if oa.SentimentLLM() != nil && text != "" {
+		if err := models.QueueSentimentMsg(ctx, rt, oa.OrgID(), &models.SentimentMsg{ContactID: mc.ID(), Text: text}); err != nil {
+			slog.Error("error queuing message for sentiment scoring", "error", err, "contact", mc.UUID())
+		}
+	}
+
 	return nil
 }
 
@@ -184,8 +247,18 @@ func (t *MsgReceived) handleMsgEvent(ctx context.Context, rt *runtime.Runtime, o
 		}
 	}
 
-	// find any matching triggers
-	trigger, keyword := models.FindMatchingMsgTrigger(oa, channel, scene.Contact, t.Text)
+	// unsolicited messages, i.e. those not replying to a flow, may be screened for spam and abuse before they can trigger
+	// flows, unless they already were before handling was deferred, in which case they got through
+	if session == nil && t.Deferred == nil {
+		if flagged, err := screenSpam(ctx, rt, oa, scene, msgEvent.Msg); err != nil {
+			return err
+		} else if flagged {
+			return nil
+		}
+	}
+
+	// find any matching triggers, using the message text given to the flow which may be a transcription
+	trigger, keyword := models.FindMatchingMsgTrigger(oa, channel, scene.Contact, msgEvent.Msg.Text())
 
 	// we found a trigger and their session is nil or doesn't ignore keywords
 	if (trigger != nil && trigger.TriggerType() != models.CatchallTriggerType && (flow == nil || !flow.IgnoreTriggers())) ||
@@ -229,3 +302,140 @@ func (t *MsgReceived) handleMsgEvent(ctx context.Context, rt *runtime.Runtime, o
 
 	return nil
 }
+
+// transcribes the first audio attachment using the org's transcription LLM, if it has one, returning empty if there's
+// nothing to transcribe or transcription fails since a message without text is still a message
+func transcribeAudio(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, attachments []utils.Attachment) string {
+	llm := oa.TranscriptionLLM()
+	if llm == nil {
+		return ""
+	}
+
+	for _, att := range attachments {
+		if !ai.IsAudio(att) {
+			continue
+		}
+
+		svc, err := llm.AsService(rt, rt.HTTP.Services)
+		if err != nil {
+			slog.Error("error creating LLM service for transcription", "llm", llm.UUID(), "error", err)
+			return ""
+		}
+		ts, ok := svc.(ai.TranscriptionService)
+		if !ok {
+			return ""
+		}
+
+		callStart := time.Now()
+		text, err := ts.Transcribe(ctx, att)
+
+		resp := &flows.LLMResponse{Output: text, TokensOutput: int64(ai.EstimateTokens(text))}
+		if rerr := llm.RecordStandaloneCall(ctx, rt, oa, "", "", resp, time.Since(callStart), err != nil); rerr != nil {
+			slog.Error("error recording llm call", "error", rerr, "llm", llm.UUID())
+		}
+
+		if err != nil {
+			slog.Error("error transcribing audio attachment", "llm", llm.UUID(), "error", err)
+			return ""
+		}
+		return text
+	}
+	return ""
+}
+
+// detects the language of a message with the org's language detection LLM, if it has one, returning NilLanguage if it
+// can't be detected with enough confidence or isn't one of the org's languages
+func detectLanguage(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, text string) i18n.Language {
+	llm := oa.LanguageDetectionLLM()
+	if llm == nil {
+		return i18n.NilLanguage
+	}
+
+	svc, err := llm.AsService(rt, rt.HTTP.Services)
+	if err != nil {
+		slog.Error("error creating LLM service for language detection", "llm", llm.UUID(), "error", err)
+		return i18n.NilLanguage
+	}
+
+	callStart := time.Now()
+	id, resp, err := ai.IdentifyLanguage(ctx, svc, text)
+
+	if rerr := llm.RecordStandaloneCall(ctx, rt, oa, prompts.Render("identify_language", nil), text, resp, time.Since(callStart), err != nil); rerr != nil {
+		slog.Error("error recording llm call", "error", rerr, "llm", llm.UUID())
+	}
+
+	if err != nil {
+		slog.Error("error detecting language of message", "llm", llm.UUID(), "error", err)
+		return i18n.NilLanguage
+	}
+	if id.Confidence < llm.DetectLanguageThreshold() {
+		return i18n.NilLanguage
+	}
+	if allowed := oa.Env().AllowedLanguages(); len(allowed) > 0 && !slices.Contains(allowed, id.Language) {
+		return i18n.NilLanguage
+	}
+	return id.Language
+}
+
+// screens an unsolicited message with the org's spam LLM, if it has one, and if it's scored as spam or abuse, flags or
+// blocks the contact according to the LLM's config, returning whether it did. Messages that can't be screened are let
+// through since losing a genuine message is worse than letting through spam.
+func screenSpam(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, scene *runner.Scene, msg *flows.MsgIn) (bool, error) {
+	llm := oa.SpamLLM()
+	text := msg.Text()
+	if llm == nil || text == "" {
+		return false, nil
+	}
+
+	// images sent with the message are scored with it since they can be spam or abuse too
+	ctx = models.WithLLMAttachments(ctx, msg.Attachments())
+
+	svc, err := llm.AsService(rt, rt.HTTP.Services)
+	if err != nil {
+		slog.Error("error creating LLM service for spam screening", "llm", llm.UUID(), "error", err)
+		return false, nil
+	}
+
+	var score *ai.SpamScore
+
+	if llm.SpamModeration() {
+		score, err = ai.ModerateSpam(ctx, svc, text)
+	} else {
+		var resp *flows.LLMResponse
+		callStart := time.Now()
+		score, resp, err = ai.ScoreSpam(ctx, svc, text)
+
+		if rerr := llm.RecordStandaloneCall(ctx, rt, oa, prompts.Render("score_spam", nil), text, resp, time.Since(callStart), err != nil); rerr != nil {
+			slog.Error("error recording llm call", "error", rerr, "llm", llm.UUID())
+		}
+	}
+
+	if err != nil {
+		slog.Error("error screening message for spam", "llm", llm.UUID(), "error", err)
+		return false, nil
+	}
+	if score.Max() < llm.SpamThreshold() {
+		return false, nil
+	}
+
+	mods := make([]flows.Modifier, 0, 2)
+	if group := oa.SessionAssets().Groups().Get(llm.SpamGroup()); group != nil {
+		mods = append(mods, modifiers.NewGroups([]*flows.Group{group}, modifiers.GroupsAdd))
+	}
+	if llm.SpamAction() == models.SpamActionBlock {
+		mods = append(mods, modifiers.NewStatus(flows.ContactStatusBlocked))
+	}
+
+	// if there's no group to flag the contact with, let the message through rather than silently dropping it
+	if len(mods) == 0 {
+		slog.Warn("message scored as spam but no group to flag contact with", "llm", llm.UUID(), "group", llm.SpamGroup())
+		return false, nil
+	}
+
+	for _, mod := range mods {
+		if err := scene.ApplyModifier(ctx, rt, oa, mod, models.NilUserID, ""); err != nil {
+			return false, fmt.Errorf("error applying modifier to contact flagged for spam: %w", err)
+		}
+	}
+	return true, nil
+}
@@ -544,6 +544,178 @@ func TestMsgReceivedNewURN(t *testing.T) {
 	}
 }
 
+func TestMsgReceivedDetectLanguage(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData|testsuite.ResetDynamo|testsuite.ResetElastic)
+
+	rt.DB.MustExec(`UPDATE ai_llm SET config = config || '{"detect_language": true, "detect_language_threshold": 0.7}'::jsonb WHERE id = $1`, testdb.TestLLM.ID)
+
+	dbMsg := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bad8-f98d-75a3-b641-2718a25ac3f5", testdb.TwilioChannel, testdb.Bob, "", models.MsgStatusPending, "")
+
+	tcs := []struct {
+		text             string
+		expectedLanguage any
+	}{
+		{`\return {"language": "fra", "confidence": 0.9}`, "fra"},
+		{`\return {"language": "fra", "confidence": 0.5}`, nil}, // not confident enough
+		{`\return {"language": "hat", "confidence": 0.9}`, nil}, // not one of the org's languages
+		{`\return I don't know`, nil},
+		{`\error boom`, nil},
+	}
+
+	for i, tc := range tcs {
+		models.FlushCache()
+
+		rt.DB.MustExec(`UPDATE contacts_contact SET language = NULL WHERE id = $1`, testdb.Bob.ID)
+		rt.DB.MustExec(`UPDATE msgs_msg SET status = 'P', flow_id = NULL WHERE id = $1`, dbMsg.ID)
+
+		task := &ctasks.MsgReceived{
+			ChannelID: testdb.TwilioChannel.ID,
+			MsgUUID:   dbMsg.UUID,
+			URN:       testdb.Bob.URN,
+			URNID:     testdb.Bob.URNID,
+			Text:      tc.text,
+		}
+
+		err := tasks.QueueContact(ctx, rt, testdb.Org1.ID, testdb.Bob.ID, task)
+		require.NoError(t, err)
+
+		queued, err := rt.Queues.Realtime.Pop(ctx, vc)
+		require.NoError(t, err)
+
+		err = tasks.Perform(ctx, rt, queued)
+		require.NoError(t, err)
+
+		assertdb.Query(t, rt.DB, `SELECT language FROM contacts_contact WHERE id = $1`, testdb.Bob.ID).Returns(tc.expectedLanguage, "%d: language mismatch", i)
+	}
+
+	// every detection is recorded as usage of the LLM
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'calls'`, testdb.TestLLM.ID).Returns(int64(5))
+}
+
+func TestMsgReceivedDeferredRetry(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData|testsuite.ResetDynamo|testsuite.ResetElastic)
+
+	rt.DB.MustExec(`UPDATE ai_llm SET config = config || '{"detect_language": true}'::jsonb WHERE id = $1`, testdb.TestLLM.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET language = NULL WHERE id = $1`, testdb.Bob.ID)
+
+	dbMsg := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bad8-f98d-75a3-b641-2718a25ac3f5", testdb.TwilioChannel, testdb.Bob, "", models.MsgStatusPending, "")
+
+	// a retry of handling which was deferred reuses the results of LLM calls made before it was deferred
+	task := &ctasks.MsgReceived{
+		ChannelID: testdb.TwilioChannel.ID,
+		MsgUUID:   dbMsg.UUID,
+		URN:       testdb.Bob.URN,
+		URNID:     testdb.Bob.URNID,
+		Text:      `\return {"language": "eng", "confidence": 0.9}`,
+		Deferred:  &ctasks.MsgDeferredResults{Language: "fra"},
+	}
+
+	err := tasks.QueueContact(ctx, rt, testdb.Org1.ID, testdb.Bob.ID, task)
+	require.NoError(t, err)
+
+	queued, err := rt.Queues.Realtime.Pop(ctx, vc)
+	require.NoError(t, err)
+
+	err = tasks.Perform(ctx, rt, queued)
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT language FROM contacts_contact WHERE id = $1`, testdb.Bob.ID).Returns("fra")
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'calls'`, testdb.TestLLM.ID).Returns(int64(0))
+}
+
+func TestMsgReceivedScreenSpam(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData|testsuite.ResetDynamo|testsuite.ResetElastic)
+
+	rt.DB.MustExec(`UPDATE ai_llm SET config = config || jsonb_build_object('screen_spam', true, 'spam_threshold', 0.7, 'spam_group_uuid', $2::text) WHERE id = $1`, testdb.TestLLM.ID, testdb.TestersGroup.UUID)
+
+	dbMsg := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bad8-f98d-75a3-b641-2718a25ac3f5", testdb.TwilioChannel, testdb.Bob, "", models.MsgStatusPending, "")
+
+	tcs := []struct {
+		text           string
+		action         string
+		expectedTester int
+		expectedStatus string
+	}{
+		{`\return {"spam": 0.1, "abuse": 0.2}`, "flag", 0, "A"},
+		{`\return I don't know`, "flag", 0, "A"}, // unparseable scores let the message through
+		{`\error boom`, "flag", 0, "A"},
+		{`\return {"spam": 0.9, "abuse": 0.0}`, "flag", 1, "A"},
+		{`\return {"spam": 0.0, "abuse": 0.8}`, "block", 1, "B"},
+	}
+
+	for i, tc := range tcs {
+		models.FlushCache()
+
+		rt.DB.MustExec(`UPDATE ai_llm SET config = config || jsonb_build_object('spam_action', $2::text) WHERE id = $1`, testdb.TestLLM.ID, tc.action)
+		rt.DB.MustExec(`UPDATE contacts_contact SET status = 'A' WHERE id = $1`, testdb.Bob.ID)
+		rt.DB.MustExec(`DELETE FROM contacts_contactgroup_contacts WHERE contact_id = $1 AND contactgroup_id = $2`, testdb.Bob.ID, testdb.TestersGroup.ID)
+		rt.DB.MustExec(`UPDATE msgs_msg SET status = 'P', flow_id = NULL WHERE id = $1`, dbMsg.ID)
+
+		task := &ctasks.MsgReceived{
+			ChannelID: testdb.TwilioChannel.ID,
+			MsgUUID:   dbMsg.UUID,
+			URN:       testdb.Bob.URN,
+			URNID:     testdb.Bob.URNID,
+			Text:      tc.text,
+		}
+
+		err := tasks.QueueContact(ctx, rt, testdb.Org1.ID, testdb.Bob.ID, task)
+		require.NoError(t, err)
+
+		queued, err := rt.Queues.Realtime.Pop(ctx, vc)
+		require.NoError(t, err)
+
+		err = tasks.Perform(ctx, rt, queued)
+		require.NoError(t, err)
+
+		assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactgroup_contacts WHERE contact_id = $1 AND contactgroup_id = $2`, testdb.Bob.ID, testdb.TestersGroup.ID).Returns(tc.expectedTester, "%d: group mismatch", i)
+		assertdb.Query(t, rt.DB, `SELECT status FROM contacts_contact WHERE id = $1`, testdb.Bob.ID).Returns(tc.expectedStatus, "%d: status mismatch", i)
+	}
+
+	// every screening is recorded as usage of the LLM
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'calls'`, testdb.TestLLM.ID).Returns(int64(5))
+
+	// if there's no group to flag contacts with, messages are handled as normal
+	models.FlushCache()
+	testdb.InsertCatchallTrigger(t, rt, testdb.Org1, testdb.Favorites, nil, nil, nil)
+
+	rt.DB.MustExec(`UPDATE ai_llm SET config = (config - 'spam_group_uuid') || '{"spam_action": "flag"}'::jsonb WHERE id = $1`, testdb.TestLLM.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET status = 'A' WHERE id = $1`, testdb.Bob.ID)
+	rt.DB.MustExec(`UPDATE msgs_msg SET status = 'P', flow_id = NULL WHERE id = $1`, dbMsg.ID)
+
+	task := &ctasks.MsgReceived{
+		ChannelID: testdb.TwilioChannel.ID,
+		MsgUUID:   dbMsg.UUID,
+		URN:       testdb.Bob.URN,
+		URNID:     testdb.Bob.URNID,
+		Text:      `\return {"spam": 0.9, "abuse": 0.0}`,
+	}
+
+	err := tasks.QueueContact(ctx, rt, testdb.Org1.ID, testdb.Bob.ID, task)
+	require.NoError(t, err)
+
+	queued, err := rt.Queues.Realtime.Pop(ctx, vc)
+	require.NoError(t, err)
+
+	err = tasks.Perform(ctx, rt, queued)
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT flow_id FROM msgs_msg WHERE id = $1`, dbMsg.ID).Returns(int64(testdb.Favorites.ID))
+	assertdb.Query(t, rt.DB, `SELECT status FROM contacts_contact WHERE id = $1`, testdb.Bob.ID).Returns("A")
+}
+
 func getLastSeenOn(t *testing.T, rt *runtime.Runtime, c *testdb.Contact) *time.Time {
 	var lastSeenOn *time.Time
 	err := rt.DB.Get(&lastSeenOn, `SELECT last_seen_on FROM contacts_contact WHERE id = $1`, c.ID)
@@ -0,0 +1,107 @@
+package ctasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/runner"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+const (
+	TypeSummarizeTicket = "summarize_ticket"
+
+	ticketSummaryMsgLimit = 50 // number of most recent messages which are summarized
+)
+
+func init() {
+	RegisterType(TypeSummarizeTicket, func() Task { return &SummarizeTicket{} })
+}
+
+// SummarizeTicket is queued when a ticket is opened from a flow or first assigned to an agent for an org which has opted
+// into having an LLM add a summary of the contact's recent messages to the ticket as a note.
+type SummarizeTicket struct {
+	TicketUUID flows.TicketUUID `json:"ticket_uuid" validate:"required"`
+}
+
+func NewSummarizeTicket(ticketUUID flows.TicketUUID) *SummarizeTicket {
+	return &SummarizeTicket{TicketUUID: ticketUUID}
+}
+
+func (t *SummarizeTicket) Type() string {
+	return TypeSummarizeTicket
+}
+
+func (t *SummarizeTicket) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, mc *models.Contact) error {
+	// org may have since opted out or deleted the LLM
+	llm := oa.LLMByUUID(oa.Org().TicketSummaryLLM())
+	if llm == nil {
+		return nil
+	}
+
+	// contacts are loaded with their open tickets, so if the ticket isn't there it has since been closed
+	if mc.FindTicket(t.TicketUUID) == nil {
+		return nil
+	}
+
+	summary, err := t.summarize(ctx, rt, oa, mc, llm)
+	if err != nil {
+		// LLM errors leave the ticket without a summary rather than fail the task, as retrying is unlikely to help
+		slog.Warn("error summarizing ticket", "error", err, "ticket", t.TicketUUID, "llm_id", llm.ID())
+		return nil
+	}
+	if summary == "" {
+		return nil
+	}
+
+	contact, err := mc.EngineContact(oa)
+	if err != nil {
+		return fmt.Errorf("error creating flow contact: %w", err)
+	}
+
+	scene := runner.NewScene(mc, contact)
+
+	if err := scene.ApplyModifier(ctx, rt, oa, modifiers.NewTicketNote(t.TicketUUID, summary), models.NilUserID, ""); err != nil {
+		return fmt.Errorf("error applying ticket note modifier: %w", err)
+	}
+	if err := scene.Commit(ctx, rt, oa); err != nil {
+		return fmt.Errorf("error committing scene for contact %s: %w", scene.ContactUUID(), err)
+	}
+
+	return nil
+}
+
+// asks the LLM to summarize the contact's recent messages, returning an empty summary if there are none
+func (t *SummarizeTicket) summarize(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, mc *models.Contact, llm *models.LLM) (string, error) {
+	transcript, err := models.GetRecentContactTranscript(ctx, rt.DB, oa.OrgID(), mc.ID(), ticketSummaryMsgLimit)
+	if err != nil {
+		return "", fmt.Errorf("error loading recent messages: %w", err)
+	}
+	if transcript == "" {
+		return "", nil
+	}
+
+	svc, err := llm.AsService(rt, rt.HTTP.Services)
+	if err != nil {
+		return "", fmt.Errorf("error creating LLM service: %w", err)
+	}
+
+	callStart := time.Now()
+	resp, err := ai.Summarize(ctx, svc, transcript)
+
+	if rerr := llm.RecordStandaloneCall(ctx, rt, oa, "", transcript, resp, time.Since(callStart), err != nil); rerr != nil {
+		slog.Error("error recording llm call", "error", rerr, "llm_id", llm.ID())
+	}
+
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Output), nil
+}
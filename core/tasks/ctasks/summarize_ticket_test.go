@@ -0,0 +1,60 @@
+package ctasks_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	_ "github.com/nyaruka/mailroom/v26/core/runner/handlers"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/core/tasks/ctasks"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeTicket(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	defer testsuite.Reset(t, rt, testsuite.ResetAll)
+
+	openedOn := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	ticket := testdb.InsertOpenTicket(t, rt, "01992f54-5ab6-717a-a39e-e8ca91fb7262", testdb.Org1, testdb.Ann, testdb.DefaultTopic, openedOn, nil)
+	testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bad8-d4be-76c7-8a5c-a12caae7aa87", testdb.TwilioChannel, testdb.Ann, "My order hasn't arrived", models.MsgStatusHandled, "")
+
+	perform := func() {
+		err := tasks.QueueContact(ctx, rt, testdb.Org1.ID, testdb.Ann.ID, ctasks.NewSummarizeTicket(ticket.UUID))
+		require.NoError(t, err)
+
+		task, err := rt.Queues.Realtime.Pop(ctx, vc)
+		require.NoError(t, err)
+
+		err = tasks.Perform(ctx, rt, task)
+		require.NoError(t, err)
+	}
+
+	// org hasn't opted in so nothing happens
+	perform()
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM ai_llmcount WHERE llm_id = $1`, testdb.TestLLM.ID).Returns(0)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM tickets_ticket WHERE id = $1 AND last_activity_on = $2`, ticket.ID, openedOn).Returns(1)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = '{"ticket_summary_llm": "e5d8900a-ef54-4d2a-8214-ff7d3e903502"}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+	models.FlushCache()
+
+	// summary is added to the ticket as a note and usage is recorded
+	perform()
+
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'calls'`, testdb.TestLLM.ID).Returns(int64(1))
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM ai_llmcall WHERE llm_id = $1 AND status = 'S'`, testdb.TestLLM.ID).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM tickets_ticket WHERE id = $1 AND last_activity_on > $2`, ticket.ID, openedOn).Returns(1)
+
+	// closed tickets aren't summarized
+	rt.DB.MustExec(`UPDATE tickets_ticket SET status = 'C', closed_on = NOW() WHERE id = $1`, ticket.ID)
+	perform()
+
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'calls'`, testdb.TestLLM.ID).Returns(int64(1))
+}
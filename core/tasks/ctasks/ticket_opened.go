@@ -0,0 +1,134 @@
+package ctasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/runner"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+const (
+	TypeTicketOpened = "ticket_opened"
+
+	ticketTopicMsgLimit = 20 // number of most recent messages the LLM is given to choose a topic from
+)
+
+func init() {
+	RegisterType(TypeTicketOpened, func() Task { return &TicketOpened{} })
+}
+
+// TicketOpened is queued when a ticket is opened with the default topic for an org which has opted into having an LLM
+// assign topics to new tickets from the contact's recent messages.
+type TicketOpened struct {
+	TicketUUID flows.TicketUUID `json:"ticket_uuid" validate:"required"`
+}
+
+func NewTicketOpened(ticketUUID flows.TicketUUID) *TicketOpened {
+	return &TicketOpened{TicketUUID: ticketUUID}
+}
+
+func (t *TicketOpened) Type() string {
+	return TypeTicketOpened
+}
+
+func (t *TicketOpened) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, mc *models.Contact) error {
+	// org may have since opted out or deleted the LLM
+	llm := oa.LLMByUUID(oa.Org().TicketTopicLLM())
+	if llm == nil {
+		return nil
+	}
+
+	// contacts are loaded with their open tickets, so if the ticket isn't there it has since been closed
+	idx := slices.IndexFunc(mc.Tickets(), func(tk *models.Ticket) bool { return tk.UUID == t.TicketUUID })
+	if idx < 0 {
+		return nil
+	}
+	ticket := mc.Tickets()[idx]
+
+	// don't override a topic that a user has since chosen
+	if current := oa.TopicByID(ticket.TopicID); current != nil && !current.IsDefault() {
+		return nil
+	}
+
+	topic, err := t.chooseTopic(ctx, rt, oa, mc, llm)
+	if err != nil {
+		// LLM errors leave the ticket with its default topic rather than fail the task, as retrying is unlikely to help
+		slog.Warn("error choosing topic for ticket", "error", err, "ticket", t.TicketUUID, "llm_id", llm.ID())
+		return nil
+	}
+	if topic == nil || topic.ID() == ticket.TopicID {
+		return nil
+	}
+
+	contact, err := mc.EngineContact(oa)
+	if err != nil {
+		return fmt.Errorf("error creating flow contact: %w", err)
+	}
+
+	scene := runner.NewScene(mc, contact)
+
+	mod := modifiers.NewTicketTopic(ticket.UUID, oa.SessionAssets().Topics().Get(topic.UUID()))
+	if err := scene.ApplyModifier(ctx, rt, oa, mod, models.NilUserID, ""); err != nil {
+		return fmt.Errorf("error applying ticket topic modifier: %w", err)
+	}
+	if err := scene.Commit(ctx, rt, oa); err != nil {
+		return fmt.Errorf("error committing scene for contact %s: %w", scene.ContactUUID(), err)
+	}
+
+	return nil
+}
+
+// asks the LLM to choose a topic from the contact's recent messages, returning nil if it can't
+func (t *TicketOpened) chooseTopic(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, mc *models.Contact, llm *models.LLM) (*models.Topic, error) {
+	transcript, err := models.GetRecentContactTranscript(ctx, rt.DB, oa.OrgID(), mc.ID(), ticketTopicMsgLimit)
+	if err != nil {
+		return nil, fmt.Errorf("error loading recent messages: %w", err)
+	}
+	if transcript == "" {
+		return nil, nil
+	}
+
+	topics, err := oa.Topics()
+	if err != nil {
+		return nil, fmt.Errorf("error loading topics: %w", err)
+	}
+	names := make([]string, 0, len(topics))
+	for _, tp := range topics {
+		names = append(names, tp.Name())
+	}
+
+	svc, err := llm.AsService(rt, rt.HTTP.Services)
+	if err != nil {
+		return nil, fmt.Errorf("error creating LLM service: %w", err)
+	}
+
+	instructions := prompts.Render("ticket_topic", map[string]any{"Topics": names})
+
+	callStart := time.Now()
+	resp, err := svc.Response(ctx, instructions, transcript, llm.MaxOutputTokens())
+
+	if rerr := llm.RecordStandaloneCall(ctx, rt, oa, instructions, transcript, resp, time.Since(callStart), err != nil); rerr != nil {
+		slog.Error("error recording llm call", "error", rerr, "llm_id", llm.ID())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	answer := strings.Trim(strings.TrimSpace(resp.Output), `"'`)
+	for _, tp := range topics {
+		if strings.EqualFold(tp.Name(), answer) {
+			return oa.TopicByUUID(tp.UUID()), nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,60 @@
+package ctasks_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	_ "github.com/nyaruka/mailroom/v26/core/runner/handlers"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/core/tasks/ctasks"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTicketOpened(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	defer testsuite.Reset(t, rt, testsuite.ResetAll)
+
+	ticket := testdb.InsertOpenTicket(t, rt, "01992f54-5ab6-717a-a39e-e8ca91fb7262", testdb.Org1, testdb.Ann, testdb.DefaultTopic, time.Now(), nil)
+	testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bad8-d4be-76c7-8a5c-a12caae7aa87", testdb.TwilioChannel, testdb.Ann, "I want to buy something", models.MsgStatusHandled, "")
+
+	perform := func() {
+		err := tasks.QueueContact(ctx, rt, testdb.Org1.ID, testdb.Ann.ID, ctasks.NewTicketOpened(ticket.UUID))
+		require.NoError(t, err)
+
+		task, err := rt.Queues.Realtime.Pop(ctx, vc)
+		require.NoError(t, err)
+
+		err = tasks.Perform(ctx, rt, task)
+		require.NoError(t, err)
+	}
+
+	// org hasn't opted in so nothing happens
+	perform()
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM ai_llmcount WHERE llm_id = $1`, testdb.TestLLM.ID).Returns(0)
+	assertdb.Query(t, rt.DB, `SELECT topic_id FROM tickets_ticket WHERE id = $1`, ticket.ID).Returns(int64(testdb.DefaultTopic.ID))
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = '{"ticket_topic_llm": "e5d8900a-ef54-4d2a-8214-ff7d3e903502"}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+	models.FlushCache()
+
+	// test LLM doesn't answer with a topic so ticket keeps its topic but usage is recorded
+	perform()
+
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'calls'`, testdb.TestLLM.ID).Returns(int64(1))
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'tokens:in'`, testdb.TestLLM.ID).Returns(int64(45))
+	assertdb.Query(t, rt.DB, `SELECT topic_id FROM tickets_ticket WHERE id = $1`, ticket.ID).Returns(int64(testdb.DefaultTopic.ID))
+
+	// once a user has chosen a topic, the LLM isn't called
+	rt.DB.MustExec(`UPDATE tickets_ticket SET topic_id = $2 WHERE id = $1`, ticket.ID, testdb.SupportTopic.ID)
+	perform()
+
+	assertdb.Query(t, rt.DB, `SELECT COALESCE(SUM(count), 0)::bigint FROM ai_llmcount WHERE llm_id = $1 AND scope = 'calls'`, testdb.TestLLM.ID).Returns(int64(1))
+	assertdb.Query(t, rt.DB, `SELECT topic_id FROM tickets_ticket WHERE id = $1`, ticket.ID).Returns(int64(testdb.SupportTopic.ID))
+}
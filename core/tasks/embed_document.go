@@ -0,0 +1,145 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+const (
+	TypeEmbedDocument = "embed_document"
+
+	embedChunkTokens = 500 // roughly the maximum number of tokens in each chunk of a document
+	embedBatchSize   = 100 // number of chunks embedded per call to the LLM service
+)
+
+func init() {
+	RegisterType(TypeEmbedDocument, func() Task { return &EmbedDocument{} })
+}
+
+// EmbedDocument is our task for chunking a knowledge base document and embedding those chunks using the knowledge
+// base's LLM so that they can be retrieved by similarity. Documents which aren't needed right away, e.g. when backfilling
+// a knowledge base, can opt into having their chunks embedded offline by the LLM's provider at lower cost.
+type EmbedDocument struct {
+	DocumentID models.DocumentID `json:"document_id" validate:"required"`
+	UseBatch   bool              `json:"use_batch,omitempty"`
+
+	// results of an offline batch in the order of the batches of chunks, if this task is being queued again with them
+	Results []*ai.BatchResult `json:"results,omitempty"`
+}
+
+func (t *EmbedDocument) Type() string {
+	return TypeEmbedDocument
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *EmbedDocument) Timeout() time.Duration {
+	return 10 * time.Minute
+}
+
+func (t *EmbedDocument) WithAssets() models.Refresh {
+	return models.RefreshNone
+}
+
+func (t *EmbedDocument) SetBatchResults(results []*ai.BatchResult) {
+	t.Results = results
+}
+
+func (t *EmbedDocument) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) error {
+	doc, err := models.GetDocument(ctx, rt.DB, t.DocumentID)
+	if err != nil {
+		return err
+	}
+
+	var chunks []*models.DocumentChunk
+	if t.Results != nil {
+		chunks, err = t.batchChunks(doc)
+	} else if t.UseBatch {
+		// document remains pending until this is queued again with the results
+		err = t.submitBatch(ctx, rt, oa, doc)
+		if err == nil {
+			return nil
+		}
+	} else {
+		chunks, err = t.embed(ctx, rt, oa, doc)
+	}
+	if err != nil {
+		if ferr := models.SetDocumentFailed(ctx, rt.DB, doc); ferr != nil {
+			return ferr
+		}
+		return fmt.Errorf("error embedding document #%d: %w", doc.ID, err)
+	}
+
+	return models.SetDocumentChunks(ctx, rt.DB, doc, chunks)
+}
+
+func (t *EmbedDocument) embed(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, doc *models.Document) ([]*models.DocumentChunk, error) {
+	llm := oa.LLMByID(doc.LLMID)
+	if llm == nil {
+		return nil, fmt.Errorf("no such LLM #%d", doc.LLMID)
+	}
+
+	svc, err := llm.AsService(rt, rt.HTTP.Services)
+	if err != nil {
+		return nil, fmt.Errorf("error creating LLM service: %w", err)
+	}
+	es, ok := svc.(ai.EmbeddingService)
+	if !ok {
+		return nil, fmt.Errorf("LLM %s doesn't support embeddings", llm.UUID())
+	}
+
+	texts := ai.ChunkText(doc.Content, embedChunkTokens)
+	chunks := make([]*models.DocumentChunk, 0, len(texts))
+
+	for batch := range slices.Chunk(texts, embedBatchSize) {
+		vectors, err := es.Embed(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for i, text := range batch {
+			chunks = append(chunks, &models.DocumentChunk{DocumentID: doc.ID, Position: len(chunks), Content: text, Embedding: vectors[i]})
+		}
+	}
+	return chunks, nil
+}
+
+// submits the chunks of the document to be embedded as an offline batch
+func (t *EmbedDocument) submitBatch(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, doc *models.Document) error {
+	llm := oa.LLMByID(doc.LLMID)
+	if llm == nil {
+		return fmt.Errorf("no such LLM #%d", doc.LLMID)
+	}
+
+	batches := slices.Collect(slices.Chunk(ai.ChunkText(doc.Content, embedChunkTokens), embedBatchSize))
+
+	return submitLLMBatch(ctx, rt, oa, llm, t, func(bs ai.BatchService) (string, error) { return bs.SubmitEmbeddingBatch(ctx, batches) })
+}
+
+// creates the chunks of the document from the results of an offline batch, failing if the document has been edited
+// since the batch was submitted so that its chunks no longer match
+func (t *EmbedDocument) batchChunks(doc *models.Document) ([]*models.DocumentChunk, error) {
+	texts := ai.ChunkText(doc.Content, embedChunkTokens)
+	chunks := make([]*models.DocumentChunk, 0, len(texts))
+
+	for _, r := range t.Results {
+		if r.Error != "" {
+			return nil, errors.New(r.Error)
+		}
+		for _, vector := range r.Vectors {
+			if len(chunks) == len(texts) {
+				return nil, errors.New("document changed since batch was submitted")
+			}
+			chunks = append(chunks, &models.DocumentChunk{DocumentID: doc.ID, Position: len(chunks), Content: texts[len(chunks)], Embedding: vector})
+		}
+	}
+	if len(chunks) != len(texts) {
+		return nil, errors.New("document changed since batch was submitted")
+	}
+	return chunks, nil
+}
@@ -0,0 +1,43 @@
+package tasks
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// TypeFireIncidentWebhook is the type of the fire incident webhook task
+const TypeFireIncidentWebhook = "fire_incident_webhook"
+
+func init() {
+	RegisterType(TypeFireIncidentWebhook, func() Task { return &FireIncidentWebhook{} })
+
+	models.RegisterIncidentWebhookQueuer(func(ctx context.Context, rt *runtime.Runtime, incident *models.Incident) error {
+		return Queue(ctx, rt, rt.Queues.Batch, incident.OrgID, &FireIncidentWebhook{Incident: incident}, true)
+	})
+}
+
+// FireIncidentWebhook is our task for notifying an org's incident webhook that an incident has started or ended
+type FireIncidentWebhook struct {
+	Incident *models.Incident `json:"incident" validate:"required"`
+}
+
+func (t *FireIncidentWebhook) Type() string {
+	return TypeFireIncidentWebhook
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *FireIncidentWebhook) Timeout() time.Duration {
+	return time.Minute
+}
+
+func (t *FireIncidentWebhook) WithAssets() models.Refresh {
+	return models.RefreshNone
+}
+
+func (t *FireIncidentWebhook) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) error {
+	models.FireIncidentWebhook(ctx, rt, oa, t.Incident)
+	return nil
+}
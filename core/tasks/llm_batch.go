@@ -0,0 +1,71 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// BatchedTask is a task which can have its LLM requests processed offline as a batch, at lower cost, and which is
+// queued again with the results once the batch has finished
+type BatchedTask interface {
+	Task
+
+	SetBatchResults([]*ai.BatchResult)
+}
+
+// submits a batch to the given LLM's provider using the given function, and records it so that the given task is
+// queued again with its results. Batches bypass the usual services so the org's budget is checked here.
+func submitLLMBatch(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, llm *models.LLM, task BatchedTask, submit func(ai.BatchService) (string, error)) error {
+	exceeded, err := models.LLMBudgetExceeded(ctx, rt, oa.OrgID())
+	if err != nil {
+		return fmt.Errorf("error checking token budget: %w", err)
+	}
+	if exceeded {
+		return &ai.ServiceError{Message: "token budget exceeded", Code: ai.ErrorBudgetExceeded}
+	}
+
+	svc, err := llm.AsService(rt, rt.HTTP.Services)
+	if err != nil {
+		return fmt.Errorf("error creating LLM service: %w", err)
+	}
+	bs, ok := svc.(ai.BatchService)
+	if !ok {
+		return fmt.Errorf("LLM %s doesn't support batches", llm.UUID())
+	}
+
+	id, err := submit(bs)
+	if err != nil {
+		return err
+	}
+
+	return models.InsertLLMBatch(ctx, rt, &models.LLMBatch{
+		ID:        id,
+		OrgID:     oa.OrgID(),
+		LLMID:     llm.ID(),
+		TaskType:  task.Type(),
+		Task:      jsonx.MustMarshal(task),
+		CreatedOn: dates.Now(),
+	})
+}
+
+// QueueBatchResults queues the task which submitted the given batch again with its results
+func QueueBatchResults(ctx context.Context, rt *runtime.Runtime, b *models.LLMBatch, results []*ai.BatchResult) error {
+	task, err := ReadTask(b.TaskType, b.Task)
+	if err != nil {
+		return fmt.Errorf("error reading task of batch %s: %w", b.ID, err)
+	}
+	bt, ok := task.(BatchedTask)
+	if !ok {
+		return fmt.Errorf("task of type %s can't take batch results", b.TaskType)
+	}
+
+	bt.SetBatchResults(results)
+
+	return Queue(ctx, rt, rt.Queues.AI, b.OrgID, bt, false)
+}
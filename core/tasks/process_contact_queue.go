@@ -2,6 +2,7 @@ package tasks
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
@@ -98,6 +99,18 @@ func (t *ProcessContactQueue) Perform(ctx context.Context, rt *runtime.Runtime,
 		// record metrics
 		rt.Stats.RecordContactTask(taskPayload.Type, int(oa.OrgID()), time.Since(start), time.Since(taskPayload.QueuedOn), err != nil)
 
+		// if the task was deferred until LLM calls are made, put it back at the front of the queue so that it and any
+		// later tasks wait for those calls, which resume processing once they're made
+		var deferred *ctasks.DeferredError
+		if errors.As(err, &deferred) {
+			if err := deferContact(ctx, rt, oa, t.ContactID, ctask, taskPayload.ErrorCount, deferred.Calls); err != nil {
+				return fmt.Errorf("error deferring contact task: %w", err)
+			}
+
+			log.Info("ctask deferred", "elapsed", time.Since(start), "llm_calls", len(deferred.Calls))
+			return nil
+		}
+
 		// if we get an error processing an event, requeue it for later and return our error
 		if err != nil {
 			if qerr := dbutil.AsQueryError(err); qerr != nil {
@@ -141,3 +154,29 @@ func queueContact(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID,
 	}
 	return nil
 }
+
+// requeues a deferred task to the front of the contact's queue, and queues the LLM calls it was deferred until which
+// aren't already pending, without flagging the contact as having tasks until those calls have been made
+func deferContact(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, contactID models.ContactID, task ctasks.Task, errorCount int, calls []*models.LLMDeferredCall) error {
+	if err := ctasks.Queue(ctx, rt, oa.OrgID(), contactID, task, true, errorCount); err != nil {
+		return fmt.Errorf("error requeuing contact task: %w", err)
+	}
+
+	for _, call := range calls {
+		timeout := defaultCallLLMTimeout
+		if llm := oa.LLMByID(call.LLMID); llm != nil {
+			timeout = llm.AsyncTimeout()
+		}
+
+		pending, err := call.MarkPending(ctx, rt, timeout)
+		if err != nil {
+			return err
+		}
+		if pending {
+			if err := Queue(ctx, rt, rt.Queues.AI, oa.OrgID(), &CallLLM{Call: call}, false); err != nil {
+				return fmt.Errorf("error queuing LLM call task: %w", err)
+			}
+		}
+	}
+	return nil
+}
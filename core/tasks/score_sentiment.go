@@ -0,0 +1,110 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/runner"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// TypeScoreSentiment is the type of the score sentiment task
+const TypeScoreSentiment = "score_sentiment"
+
+func init() {
+	RegisterType(TypeScoreSentiment, func() Task { return &ScoreSentiment{} })
+}
+
+// ScoreSentiment is our task for scoring the sentiment and urgency of a batch of incoming messages with a single LLM
+// call, and saving the scores of each contact's last message to the contact fields configured on the LLM.
+type ScoreSentiment struct {
+	Msgs []*models.SentimentMsg `json:"msgs" validate:"required"`
+}
+
+func (t *ScoreSentiment) Type() string {
+	return TypeScoreSentiment
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *ScoreSentiment) Timeout() time.Duration {
+	return 5 * time.Minute
+}
+
+func (t *ScoreSentiment) WithAssets() models.Refresh {
+	return models.RefreshNone
+}
+
+func (t *ScoreSentiment) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) error {
+	// org may have since opted out or deleted the LLM
+	llm := oa.SentimentLLM()
+	if llm == nil {
+		return nil
+	}
+
+	svc, err := llm.AsService(rt, rt.HTTP.Services)
+	if err != nil {
+		return fmt.Errorf("error creating LLM service: %w", err)
+	}
+
+	texts := make([]string, len(t.Msgs))
+	for i, m := range t.Msgs {
+		texts[i] = m.Text
+	}
+
+	callStart := time.Now()
+	scores, resp, err := ai.ScoreSentiments(ctx, svc, texts)
+
+	if rerr := llm.RecordStandaloneCall(ctx, rt, oa, "", "", resp, time.Since(callStart), err != nil); rerr != nil {
+		slog.Error("error recording llm call", "error", rerr, "llm", llm.UUID())
+	}
+
+	if err != nil {
+		// LLM errors drop the batch rather than fail the task, as scores are only useful while messages are recent
+		slog.Error("error scoring sentiment of messages", "llm", llm.UUID(), "error", err, "count", len(t.Msgs))
+		return nil
+	}
+
+	sentimentKey, urgencyKey := llm.SentimentFields()
+	sentimentField := oa.SessionAssets().Fields().Get(sentimentKey)
+	urgencyField := oa.SessionAssets().Fields().Get(urgencyKey)
+
+	// only the scores of each contact's last message are saved
+	mods := make(map[models.ContactID][]flows.Modifier, len(t.Msgs))
+	for i, m := range t.Msgs {
+		var cmods []flows.Modifier
+		if sentimentField != nil {
+			cmods = append(cmods, modifiers.NewField(sentimentField, formatScore(scores[i].Score)))
+		}
+		if urgencyField != nil {
+			cmods = append(cmods, modifiers.NewField(urgencyField, formatScore(scores[i].Urgency)))
+		}
+		if len(cmods) > 0 {
+			mods[m.ContactID] = cmods
+		}
+	}
+	if len(mods) == 0 {
+		return nil
+	}
+
+	contactIDs := make([]models.ContactID, 0, len(mods))
+	for id := range mods {
+		contactIDs = append(contactIDs, id)
+	}
+
+	if _, _, err := runner.ModifyWithLock(ctx, rt, oa, models.NilUserID, contactIDs, mods, nil, ""); err != nil {
+		return fmt.Errorf("error saving sentiment scores: %w", err)
+	}
+
+	return nil
+}
+
+func formatScore(s float64) string {
+	return strconv.FormatFloat(s, 'f', 2, 64)
+}
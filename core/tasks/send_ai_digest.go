@@ -0,0 +1,125 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/goflow/utils/smtpx"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// TypeSendAIDigest is the type of the send AI digest task
+const TypeSendAIDigest = "send_ai_digest"
+
+const (
+	aiDigestPeriod         = 24 * time.Hour // conversations with ticket activity in this period are included
+	aiDigestMaxTickets     = 50             // maximum number of conversations included in a digest
+	aiDigestTicketMsgLimit = 10             // number of most recent messages of each conversation included
+)
+
+func init() {
+	RegisterType(TypeSendAIDigest, func() Task { return &SendAIDigest{} })
+}
+
+// SendAIDigest is our task for writing a digest, grouped by topic, of conversations with contacts who have open tickets
+// and have been active in the last day, and emailing it to the administrators of an org which has opted into that.
+type SendAIDigest struct{}
+
+func (t *SendAIDigest) Type() string {
+	return TypeSendAIDigest
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *SendAIDigest) Timeout() time.Duration {
+	return 5 * time.Minute
+}
+
+func (t *SendAIDigest) WithAssets() models.Refresh {
+	return models.RefreshNone
+}
+
+func (t *SendAIDigest) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) error {
+	// org may have since opted out or deleted the LLM
+	llm := oa.LLMByUUID(oa.Org().AIDigestLLM())
+	if llm == nil {
+		return nil
+	}
+
+	recipients := digestRecipients(oa)
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	tickets, err := models.LoadDigestTickets(ctx, rt.DB, oa.OrgID(), time.Now().Add(-aiDigestPeriod), aiDigestMaxTickets)
+	if err != nil {
+		return fmt.Errorf("error loading tickets for digest: %w", err)
+	}
+
+	conversations := make([]*ai.DigestConversation, 0, len(tickets))
+	for _, tk := range tickets {
+		transcript, err := models.GetRecentContactTranscript(ctx, rt.DB, oa.OrgID(), tk.ContactID, aiDigestTicketMsgLimit)
+		if err != nil {
+			return fmt.Errorf("error loading recent messages: %w", err)
+		}
+		if transcript == "" {
+			continue
+		}
+
+		topic := "General"
+		if tp := oa.TopicByID(tk.TopicID); tp != nil {
+			topic = tp.Name()
+		}
+		conversations = append(conversations, &ai.DigestConversation{Topic: topic, Transcript: transcript})
+	}
+	if len(conversations) == 0 {
+		return nil
+	}
+
+	svc, err := llm.AsService(rt, rt.HTTP.Services)
+	if err != nil {
+		return fmt.Errorf("error creating LLM service: %w", err)
+	}
+
+	callStart := time.Now()
+	resp, err := ai.Digest(ctx, svc, conversations)
+
+	if rerr := llm.RecordStandaloneCall(ctx, rt, oa, "", "", resp, time.Since(callStart), err != nil); rerr != nil {
+		slog.Error("error recording llm call", "error", rerr, "llm", llm.UUID())
+	}
+
+	if err != nil {
+		// LLM errors skip the day's digest rather than fail the task, as a late digest is of little use
+		slog.Error("error writing AI digest", "llm", llm.UUID(), "error", err, "org_id", oa.OrgID())
+		return nil
+	}
+
+	emailSvc, err := oa.Org().EmailService(ctx, rt, smtpx.NewFixedRetries(time.Second*3, time.Second*6))
+	if err != nil {
+		return fmt.Errorf("error creating email service: %w", err)
+	}
+
+	subject := fmt.Sprintf("Daily digest of %d conversations in %s", len(conversations), oa.Org().Name())
+	if err := emailSvc.Send(recipients, subject, strings.TrimSpace(resp.Output)); err != nil {
+		return fmt.Errorf("error sending AI digest: %w", err)
+	}
+
+	return nil
+}
+
+// gets the email addresses of the administrators of the org
+func digestRecipients(oa *models.OrgAssets) []string {
+	users, _ := oa.Users()
+
+	var emails []string
+	for _, u := range users {
+		if user := u.(*models.User); user.Role() == models.UserRoleAdministrator && user.Email() != "" {
+			emails = append(emails, user.Email())
+		}
+	}
+	return emails
+}
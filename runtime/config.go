@@ -7,6 +7,8 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/nyaruka/ezconf"
@@ -38,6 +40,7 @@ type Config struct {
 	WorkersRealtime  int     `help:"the number of workers for the realtime task queue (set to 0 to disable processing of realtime tasks on this node)"`
 	WorkersBatch     int     `help:"the number of workers for the batch task queue (set to 0 to disable processing of batch tasks on this node)"`
 	WorkersThrottled int     `help:"the number of workers for the throttled task queue (set to 0 to disable processing of throttled tasks on this node)"`
+	WorkersAI        int     `help:"the number of workers for the AI task queue (set to 0 to disable processing of AI tasks on this node)"`
 	WorkerOwnerLimit float64 `help:"the maximum number of workers, across nodes, available to a single owner, as a fraction of the per node worker counts"`
 
 	WebhooksTimeout              int     `help:"the timeout in milliseconds for webhook calls from engine"`
@@ -83,8 +86,11 @@ type Config struct {
 	DeploymentID        string `help:"the deployment identifier to use for metrics"`
 	InstanceID          string `help:"the instance identifier to use for metrics"`
 
-	AndroidCredentialsFile string `help:"path to JSON file with FCM service account credentials used to sync Android relayers"`
-	IDObfuscationKey       string `help:"key used to decode obfuscated IDs, as 4 comma separated integers" validate:"omitempty,hexadecimal,len=32"`
+	AndroidCredentialsFile string   `help:"path to JSON file with FCM service account credentials used to sync Android relayers"`
+	LLMPricingFile         string   `help:"path to JSON file of model names to USD per million input and output tokens used to track LLM costs"`
+	LLMCallsPerMinute      int      `help:"the maximum number of LLM calls an org can make per minute, which orgs can override, 0 meaning unlimited"`
+	LLMConcurrency         []string `help:"comma separated list of LLM types and the maximum number of calls to each that this node makes at the same time, with * for calls to all types, e.g. *:50,openai:20"`
+	IDObfuscationKey       string   `help:"key used to decode obfuscated IDs, as 4 comma separated integers" validate:"omitempty,hexadecimal,len=32"`
 
 	LogLevel slog.Level `help:"the logging level courier should use"`
 	UUIDSeed int        `help:"seed to use for UUID generation in a testing environment"`
@@ -95,6 +101,7 @@ type Config struct {
 	DisallowedNets         []*net.IPNet
 	IDObfuscationKeyParsed [4]uint32
 	WebhookProxyURLParsed  *url.URL
+	LLMConcurrencyParsed   map[string]int
 }
 
 // NewDefaultConfig returns a new default configuration object
@@ -126,6 +133,7 @@ func NewDefaultConfig() *Config {
 		WorkersRealtime:  32,
 		WorkersBatch:     8,
 		WorkersThrottled: 8,
+		WorkersAI:        8,
 		WorkerOwnerLimit: 0.5,
 
 		WebhooksTimeout:              15000,
@@ -221,6 +229,11 @@ func (c *Config) Parse() error {
 		c.WebhookProxyURLParsed = u
 	}
 
+	// parse our LLM concurrency limits
+	if err := c.parseLLMConcurrency(); err != nil {
+		return fmt.Errorf("invalid LLM concurrency: %w", err)
+	}
+
 	// parse our ID obfuscation key
 	bytes, err := hex.DecodeString(c.IDObfuscationKey)
 	if err != nil {
@@ -246,3 +259,18 @@ func (c *Config) parseDisallowedNetworks() error {
 	c.DisallowedNets = nets
 	return nil
 }
+
+// parses the list of LLM types and their concurrency limits
+func (c *Config) parseLLMConcurrency() error {
+	limits := make(map[string]int, len(c.LLMConcurrency))
+	for _, item := range c.LLMConcurrency {
+		typ, limit, ok := strings.Cut(item, ":")
+		n, err := strconv.Atoi(limit)
+		if !ok || typ == "" || err != nil || n <= 0 {
+			return fmt.Errorf("%s is not a valid LLM type and limit", item)
+		}
+		limits[typ] = n
+	}
+	c.LLMConcurrencyParsed = limits
+	return nil
+}
@@ -70,3 +70,20 @@ func TestIDObfuscationKeyParsing(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, [4]uint32{0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF}, cfg.IDObfuscationKeyParsed)
 }
+
+func TestLLMConcurrencyParsing(t *testing.T) {
+	// check default value
+	cfg, err := runtime.LoadConfig("--log-level=warn")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{}, cfg.LLMConcurrencyParsed)
+
+	cfg, err = runtime.LoadConfig("--llm-concurrency=*:50,openai:20")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"*": 50, "openai": 20}, cfg.LLMConcurrencyParsed)
+
+	_, err = runtime.LoadConfig("--llm-concurrency=openai")
+	assert.EqualError(t, err, "invalid LLM concurrency: openai is not a valid LLM type and limit")
+
+	_, err = runtime.LoadConfig("--llm-concurrency=openai:0")
+	assert.EqualError(t, err, "invalid LLM concurrency: openai:0 is not a valid LLM type and limit")
+}
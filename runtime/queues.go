@@ -6,6 +6,7 @@ type Queues struct {
 	Realtime  queues.Fair
 	Batch     queues.Fair
 	Throttled queues.Fair
+	AI        queues.Fair
 }
 
 func newQueues(cfg *Config) *Queues {
@@ -14,5 +15,6 @@ func newQueues(cfg *Config) *Queues {
 		Realtime:  queues.NewFair("realtime", int(float64(cfg.WorkersRealtime)*cfg.WorkerOwnerLimit)),
 		Batch:     queues.NewFair("batch", int(float64(cfg.WorkersBatch)*cfg.WorkerOwnerLimit)),
 		Throttled: queues.NewFair("throttled", int(float64(cfg.WorkersThrottled)*cfg.WorkerOwnerLimit)),
+		AI:        queues.NewFair("ai", int(float64(cfg.WorkersAI)*cfg.WorkerOwnerLimit)),
 	}
 }
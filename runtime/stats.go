@@ -3,12 +3,14 @@ package runtime
 import (
 	"fmt"
 	"log/slog"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
 	valkey "github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/gocommon/aws/cwatch"
@@ -19,6 +21,18 @@ type LLMTypeAndModel struct {
 	Model string
 }
 
+type LLMTypeModelAndError struct {
+	Type  string
+	Model string
+	Code  string
+}
+
+// upper bounds of the buckets LLM call durations are counted in, with the last also counting anything slower
+var llmDurationBuckets = []time.Duration{
+	250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2 * time.Second, 5 * time.Second,
+	10 * time.Second, 20 * time.Second, 30 * time.Second, time.Minute, 2 * time.Minute,
+}
+
 type Stats struct {
 	ContactTaskCount        map[string]int           // number of contact tasks handled by type
 	ContactTaskErrors       map[string]int           // number of contact tasks that errored by type
@@ -30,8 +44,20 @@ type Stats struct {
 	CronTaskCount    map[string]int           // number of cron tasks run by type
 	CronTaskDuration map[string]time.Duration // total time spent running cron tasks
 
-	LLMCallCount    map[LLMTypeAndModel]int           // number of LLM calls run by type
-	LLMCallDuration map[LLMTypeAndModel]time.Duration // total time spent making LLM calls
+	AITaskCount    map[string]int           // number of tasks on the AI queue run by type
+	AITaskErrors   map[string]int           // number of those tasks that errored by type
+	AITaskDuration map[string]time.Duration // total time spent running those tasks
+	AITaskLatency  map[string]time.Duration // total time those tasks spent queued before they were run
+
+	LLMCallCount     map[LLMTypeAndModel]int           // number of LLM calls run by type
+	LLMCallErrors    map[LLMTypeModelAndError]int      // number of those calls which failed by error code
+	LLMCallDuration  map[LLMTypeAndModel]time.Duration // total time spent making LLM calls
+	LLMCallDurations map[LLMTypeAndModel][]int         // number of LLM calls in each of the duration buckets
+	LLMTokensInput   map[LLMTypeAndModel]int64         // number of input tokens used by successful LLM calls
+	LLMTokensOutput  map[LLMTypeAndModel]int64         // number of output tokens used by successful LLM calls
+	LLMTokensReason  map[LLMTypeAndModel]int64         // number of those output tokens which were hidden reasoning
+	LLMCacheCalls    map[LLMTypeAndModel]int           // number of LLM calls which reported prompt cache usage
+	LLMCacheHits     map[LLMTypeAndModel]int           // number of those calls which read at least some input from the cache
 
 	WebhookCallCount    int           // number of webhook calls
 	WebhookCallDuration time.Duration // total time spent handling webhook calls
@@ -51,8 +77,20 @@ func newStats() *Stats {
 		CronTaskCount:    make(map[string]int),
 		CronTaskDuration: make(map[string]time.Duration),
 
-		LLMCallCount:    make(map[LLMTypeAndModel]int),
-		LLMCallDuration: make(map[LLMTypeAndModel]time.Duration),
+		AITaskCount:    make(map[string]int),
+		AITaskErrors:   make(map[string]int),
+		AITaskDuration: make(map[string]time.Duration),
+		AITaskLatency:  make(map[string]time.Duration),
+
+		LLMCallCount:     make(map[LLMTypeAndModel]int),
+		LLMCallErrors:    make(map[LLMTypeModelAndError]int),
+		LLMCallDuration:  make(map[LLMTypeAndModel]time.Duration),
+		LLMCallDurations: make(map[LLMTypeAndModel][]int),
+		LLMTokensInput:   make(map[LLMTypeAndModel]int64),
+		LLMTokensOutput:  make(map[LLMTypeAndModel]int64),
+		LLMTokensReason:  make(map[LLMTypeAndModel]int64),
+		LLMCacheCalls:    make(map[LLMTypeAndModel]int),
+		LLMCacheHits:     make(map[LLMTypeAndModel]int),
 
 		SearchCount:    make(map[string]int),
 		SearchDuration: make(map[string]time.Duration),
@@ -82,12 +120,44 @@ func (s *Stats) ToMetrics(advanced bool) []types.MetricDatum {
 		}
 	}
 
+	for typ, count := range s.AITaskCount {
+		avgDuration := s.AITaskDuration[typ] / time.Duration(count)
+		avgLatency := s.AITaskLatency[typ] / time.Duration(count)
+		typDim := cwatch.Dimension("TaskType", typ)
+
+		metrics = append(metrics,
+			cwatch.Datum("AITaskCount", float64(count), types.StandardUnitCount, typDim),
+			cwatch.Datum("AITaskErrors", float64(s.AITaskErrors[typ]), types.StandardUnitCount, typDim),
+			cwatch.Datum("AITaskDuration", float64(avgDuration)/float64(time.Second), types.StandardUnitSeconds, typDim),
+			cwatch.Datum("AITaskLatency", float64(avgLatency)/float64(time.Second), types.StandardUnitSeconds, typDim),
+		)
+	}
+
 	for typeAndModel, count := range s.LLMCallCount {
 		avgTime := s.LLMCallDuration[typeAndModel] / time.Duration(count)
+		typeDim, modelDim := cwatch.Dimension("LLMType", typeAndModel.Type), cwatch.Dimension("LLMModel", typeAndModel.Model)
+
+		metrics = append(metrics,
+			cwatch.Datum("LLMCallCount", float64(count), types.StandardUnitCount, typeDim, modelDim),
+			cwatch.Datum("LLMCallDuration", float64(avgTime)/float64(time.Second), types.StandardUnitSeconds, typeDim, modelDim),
+			llmDurationsDatum(s.LLMCallDurations[typeAndModel], typeDim, modelDim),
+			cwatch.Datum("LLMTokensInput", float64(s.LLMTokensInput[typeAndModel]), types.StandardUnitCount, typeDim, modelDim),
+			cwatch.Datum("LLMTokensOutput", float64(s.LLMTokensOutput[typeAndModel]), types.StandardUnitCount, typeDim, modelDim),
+			cwatch.Datum("LLMTokensReasoning", float64(s.LLMTokensReason[typeAndModel]), types.StandardUnitCount, typeDim, modelDim),
+		)
+	}
 
+	for typeModelAndError, count := range s.LLMCallErrors {
 		metrics = append(metrics,
-			cwatch.Datum("LLMCallCount", float64(count), types.StandardUnitCount, cwatch.Dimension("LLMType", typeAndModel.Type), cwatch.Dimension("LLMModel", typeAndModel.Model)),
-			cwatch.Datum("LLMCallDuration", float64(avgTime)/float64(time.Second), types.StandardUnitSeconds, cwatch.Dimension("LLMType", typeAndModel.Type), cwatch.Dimension("LLMModel", typeAndModel.Model)),
+			cwatch.Datum("LLMCallErrors", float64(count), types.StandardUnitCount, cwatch.Dimension("LLMType", typeModelAndError.Type), cwatch.Dimension("LLMModel", typeModelAndError.Model), cwatch.Dimension("ErrorCode", typeModelAndError.Code)),
+		)
+	}
+
+	for typeAndModel, count := range s.LLMCacheCalls {
+		hitRate := float64(s.LLMCacheHits[typeAndModel]) / float64(count)
+
+		metrics = append(metrics,
+			cwatch.Datum("LLMCacheHitRate", hitRate, types.StandardUnitNone, cwatch.Dimension("LLMType", typeAndModel.Type), cwatch.Dimension("LLMModel", typeAndModel.Model)),
 		)
 	}
 
@@ -128,6 +198,20 @@ func (s *Stats) ToMetrics(advanced bool) []types.MetricDatum {
 	return metrics
 }
 
+// creates a datum of LLM call durations as a histogram, i.e. a count for the upper bound of each non-empty bucket, from
+// which CloudWatch can calculate percentiles
+func llmDurationsDatum(counts []int, dims ...types.Dimension) types.MetricDatum {
+	d := types.MetricDatum{MetricName: aws.String("LLMCallDurations"), Unit: types.StandardUnitSeconds, Dimensions: dims}
+
+	for i, count := range counts {
+		if count > 0 {
+			d.Values = append(d.Values, float64(llmDurationBuckets[i])/float64(time.Second))
+			d.Counts = append(d.Counts, float64(count))
+		}
+	}
+	return d
+}
+
 // StatsCollector provides threadsafe stats collection
 type StatsCollector struct {
 	vk           *valkey.Pool
@@ -174,6 +258,18 @@ func (c *StatsCollector) RecordCronTask(name string, d time.Duration) {
 	c.mutex.Unlock()
 }
 
+// RecordAITask records a task run from the AI queue, which took d to run after being queued for l
+func (c *StatsCollector) RecordAITask(typ string, d, l time.Duration, errored bool) {
+	c.mutex.Lock()
+	c.stats.AITaskCount[typ]++
+	c.stats.AITaskDuration[typ] += d
+	c.stats.AITaskLatency[typ] += l
+	if errored {
+		c.stats.AITaskErrors[typ]++
+	}
+	c.mutex.Unlock()
+}
+
 func (c *StatsCollector) RecordWebhookCall(d time.Duration) {
 	c.mutex.Lock()
 	c.stats.WebhookCallCount++
@@ -188,10 +284,39 @@ func (c *StatsCollector) RecordSearch(index string, d time.Duration) {
 	c.mutex.Unlock()
 }
 
-func (c *StatsCollector) RecordLLMCall(typ, model string, d time.Duration) {
+// RecordLLMCall records a call to an LLM, which failed if the given error code is non-empty
+func (c *StatsCollector) RecordLLMCall(typ, model string, d time.Duration, errorCode string) {
+	key := LLMTypeAndModel{typ, model}
+	bucket, _ := slices.BinarySearch(llmDurationBuckets, d)
+	bucket = min(bucket, len(llmDurationBuckets)-1)
+
+	c.mutex.Lock()
+	c.stats.LLMCallCount[key]++
+	c.stats.LLMCallDuration[key] += d
+	if c.stats.LLMCallDurations[key] == nil {
+		c.stats.LLMCallDurations[key] = make([]int, len(llmDurationBuckets))
+	}
+	c.stats.LLMCallDurations[key][bucket]++
+	if errorCode != "" {
+		c.stats.LLMCallErrors[LLMTypeModelAndError{typ, model, errorCode}]++
+	}
+	c.mutex.Unlock()
+}
+
+func (c *StatsCollector) RecordLLMTokens(typ, model string, input, output, reasoning int64) {
 	c.mutex.Lock()
-	c.stats.LLMCallCount[LLMTypeAndModel{typ, model}]++
-	c.stats.LLMCallDuration[LLMTypeAndModel{typ, model}] += d
+	c.stats.LLMTokensInput[LLMTypeAndModel{typ, model}] += input
+	c.stats.LLMTokensOutput[LLMTypeAndModel{typ, model}] += output
+	c.stats.LLMTokensReason[LLMTypeAndModel{typ, model}] += reasoning
+	c.mutex.Unlock()
+}
+
+func (c *StatsCollector) RecordLLMCache(typ, model string, hit bool) {
+	c.mutex.Lock()
+	c.stats.LLMCacheCalls[LLMTypeAndModel{typ, model}]++
+	if hit {
+		c.stats.LLMCacheHits[LLMTypeAndModel{typ, model}]++
+	}
 	c.mutex.Unlock()
 }
 
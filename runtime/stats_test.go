@@ -23,30 +23,57 @@ func TestStats(t *testing.T) {
 	sc := runtime.NewStatsCollector(rt.VK, nil)
 	sc.RecordCronTask("make_foos", 10*time.Second)
 	sc.RecordCronTask("make_foos", 5*time.Second)
-	sc.RecordLLMCall("openai", "gpt-4", 7*time.Second)
-	sc.RecordLLMCall("openai", "gpt-4", 3*time.Second)
-	sc.RecordLLMCall("anthropic", "claude-3.7", 4*time.Second)
+	sc.RecordLLMCall("openai", "gpt-4", 7*time.Second, "")
+	sc.RecordLLMCall("openai", "gpt-4", 3*time.Second, "")
+	sc.RecordLLMCall("openai", "gpt-4", 500*time.Millisecond, "ratelimit")
+	sc.RecordLLMCall("anthropic", "claude-3.7", 4*time.Second, "")
+	sc.RecordLLMCall("anthropic", "claude-4", 4*time.Minute, "")
+	sc.RecordLLMTokens("openai", "gpt-4", 100, 20, 0)
+	sc.RecordLLMTokens("openai", "gpt-4", 50, 10, 4)
+	sc.RecordLLMCache("openai", "gpt-4", true)
+	sc.RecordLLMCache("openai", "gpt-4", false)
+	sc.RecordLLMCache("openai", "gpt-4", false)
+	sc.RecordLLMCache("openai", "gpt-4", true)
 	sc.RecordSearch("contacts", 100*time.Millisecond)
 	sc.RecordSearch("contacts", 200*time.Millisecond)
 	sc.RecordSearch("messages", 150*time.Millisecond)
+	sc.RecordAITask("call_llm", 4*time.Second, 2*time.Second, false)
+	sc.RecordAITask("call_llm", 2*time.Second, 0, true)
 
 	stats := sc.Extract()
 	assert.Equal(t, 2, stats.CronTaskCount["make_foos"])
 	assert.Equal(t, 15*time.Second, stats.CronTaskDuration["make_foos"])
-	assert.Equal(t, 2, stats.LLMCallCount[runtime.LLMTypeAndModel{Type: "openai", Model: "gpt-4"}])
-	assert.Equal(t, 10*time.Second, stats.LLMCallDuration[runtime.LLMTypeAndModel{Type: "openai", Model: "gpt-4"}])
+	assert.Equal(t, 3, stats.LLMCallCount[runtime.LLMTypeAndModel{Type: "openai", Model: "gpt-4"}])
+	assert.Equal(t, 10500*time.Millisecond, stats.LLMCallDuration[runtime.LLMTypeAndModel{Type: "openai", Model: "gpt-4"}])
+	assert.Equal(t, []int{0, 1, 0, 0, 1, 1, 0, 0, 0, 0}, stats.LLMCallDurations[runtime.LLMTypeAndModel{Type: "openai", Model: "gpt-4"}])
+	assert.Equal(t, 1, stats.LLMCallErrors[runtime.LLMTypeModelAndError{Type: "openai", Model: "gpt-4", Code: "ratelimit"}])
+	assert.Equal(t, int64(150), stats.LLMTokensInput[runtime.LLMTypeAndModel{Type: "openai", Model: "gpt-4"}])
+	assert.Equal(t, int64(30), stats.LLMTokensOutput[runtime.LLMTypeAndModel{Type: "openai", Model: "gpt-4"}])
+	assert.Equal(t, int64(4), stats.LLMTokensReason[runtime.LLMTypeAndModel{Type: "openai", Model: "gpt-4"}])
 	assert.Equal(t, 1, stats.LLMCallCount[runtime.LLMTypeAndModel{Type: "anthropic", Model: "claude-3.7"}])
 	assert.Equal(t, 4*time.Second, stats.LLMCallDuration[runtime.LLMTypeAndModel{Type: "anthropic", Model: "claude-3.7"}])
+	assert.Equal(t, []int{0, 0, 0, 0, 1, 0, 0, 0, 0, 0}, stats.LLMCallDurations[runtime.LLMTypeAndModel{Type: "anthropic", Model: "claude-3.7"}])
+	assert.Equal(t, 4*time.Minute, stats.LLMCallDuration[runtime.LLMTypeAndModel{Type: "anthropic", Model: "claude-4"}])
+	assert.Equal(t, []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, stats.LLMCallDurations[runtime.LLMTypeAndModel{Type: "anthropic", Model: "claude-4"}])
+	assert.Equal(t, 4, stats.LLMCacheCalls[runtime.LLMTypeAndModel{Type: "openai", Model: "gpt-4"}])
+	assert.Equal(t, 2, stats.LLMCacheHits[runtime.LLMTypeAndModel{Type: "openai", Model: "gpt-4"}])
 	assert.Equal(t, 2, stats.SearchCount["contacts"])
 	assert.Equal(t, 300*time.Millisecond, stats.SearchDuration["contacts"])
 	assert.Equal(t, 1, stats.SearchCount["messages"])
 	assert.Equal(t, 150*time.Millisecond, stats.SearchDuration["messages"])
+	assert.Equal(t, 2, stats.AITaskCount["call_llm"])
+	assert.Equal(t, 1, stats.AITaskErrors["call_llm"])
+	assert.Equal(t, 6*time.Second, stats.AITaskDuration["call_llm"])
+	assert.Equal(t, 2*time.Second, stats.AITaskLatency["call_llm"])
 
 	datums := stats.ToMetrics(true)
-	assert.Len(t, datums, 13)
+	assert.Len(t, datums, 33)
+	assert.Equal(t, float64(1), findDatumValue(t, datums, "AITaskLatency"))
+	assert.Equal(t, 0.5, findDatumValue(t, datums, "LLMCacheHitRate"))
+	assert.Equal(t, float64(1), findDatumValue(t, datums, "LLMCallErrors"))
 
 	datums = stats.ToMetrics(false)
-	assert.Len(t, datums, 10)
+	assert.Len(t, datums, 30)
 
 	// no latencies recorded yet
 	latencies, err := runtime.GetCTaskLatencies(rt.VK)
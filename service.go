@@ -14,6 +14,7 @@ import (
 	valkey "github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/gocommon/aws/cwatch"
 	"github.com/nyaruka/gocommon/aws/dynamo"
+	"github.com/nyaruka/mailroom/v26/core/ai"
 	"github.com/nyaruka/mailroom/v26/core/crons"
 	"github.com/nyaruka/mailroom/v26/runtime"
 	"github.com/nyaruka/mailroom/v26/web"
@@ -34,6 +35,7 @@ type Service struct {
 	realtimeForeman  *Foreman
 	batchForeman     *Foreman
 	throttledForeman *Foreman
+	aiForeman        *Foreman
 
 	webserver *web.Server
 
@@ -55,6 +57,7 @@ func NewService(rt *runtime.Runtime) *Service {
 	s.realtimeForeman = NewForeman(s.rt, s.rt.Queues.Realtime, rt.Config.WorkersRealtime)
 	s.batchForeman = NewForeman(s.rt, s.rt.Queues.Batch, rt.Config.WorkersBatch)
 	s.throttledForeman = NewForeman(s.rt, s.rt.Queues.Throttled, rt.Config.WorkersThrottled)
+	s.aiForeman = NewForeman(s.rt, s.rt.Queues.AI, rt.Config.WorkersAI)
 
 	return s
 }
@@ -135,6 +138,14 @@ func (s *Service) Start() error {
 		log.Warn("fcm not configured, no android syncing")
 	}
 
+	if c.LLMPricingFile != "" {
+		if err := ai.LoadPricing(c.LLMPricingFile); err != nil {
+			log.Error("unable to load LLM pricing", "error", err)
+		}
+	} else {
+		log.Warn("llm pricing not configured, no cost tracking")
+	}
+
 	s.rt.Centrifugo = gocent.New(gocent.Config{
 		Addr: c.CentrifugoEndpoint,
 		Key:  c.CentrifugoKey,
@@ -157,6 +168,7 @@ func (s *Service) Start() error {
 	s.realtimeForeman.Start(s.workersWG)
 	s.batchForeman.Start(s.workersWG)
 	s.throttledForeman.Start(s.workersWG)
+	s.aiForeman.Start(s.workersWG)
 
 	// start our web server
 	s.webserver = web.NewServer(s.ctx, s.rt, s.workersWG)
@@ -245,7 +257,7 @@ func (s *Service) reportMetrics(ctx context.Context) (int, error) {
 
 	metrics := s.rt.Stats.Extract().ToMetrics(s.rt.Config.MetricsReporting == "advanced")
 
-	realtimeSize, batchSize, throttledSize := getQueueSizes(ctx, s.rt)
+	realtimeSize, batchSize, throttledSize, aiSize := getQueueSizes(ctx, s.rt)
 
 	// calculate DB and valkey stats
 	dbStats := s.rt.DB.Stats()
@@ -264,6 +276,7 @@ func (s *Service) reportMetrics(ctx context.Context) (int, error) {
 		cwatch.Datum("QueuedTasks", float64(realtimeSize), types.StandardUnitCount, cwatch.Dimension("QueueName", "realtime")),
 		cwatch.Datum("QueuedTasks", float64(batchSize), types.StandardUnitCount, cwatch.Dimension("QueueName", "batch")),
 		cwatch.Datum("QueuedTasks", float64(throttledSize), types.StandardUnitCount, cwatch.Dimension("QueueName", "throttled")),
+		cwatch.Datum("QueuedTasks", float64(aiSize), types.StandardUnitCount, cwatch.Dimension("QueueName", "ai")),
 	)
 	if s.rt.Dynamo.Spool != nil {
 		metrics = append(metrics,
@@ -292,6 +305,7 @@ func (s *Service) Stop() error {
 	s.realtimeForeman.Stop()
 	s.batchForeman.Stop()
 	s.throttledForeman.Stop()
+	s.aiForeman.Stop()
 
 	close(s.quit) // tell workers and crons to stop
 	s.cancel()
@@ -322,7 +336,7 @@ func checkDBConnection(db *sql.DB) error {
 	return err
 }
 
-func getQueueSizes(ctx context.Context, rt *runtime.Runtime) (int, int, int) {
+func getQueueSizes(ctx context.Context, rt *runtime.Runtime) (int, int, int, int) {
 	vc := rt.VK.Get()
 	defer vc.Close()
 
@@ -338,6 +352,10 @@ func getQueueSizes(ctx context.Context, rt *runtime.Runtime) (int, int, int) {
 	if err != nil {
 		slog.Error("error calculating throttled queue size", "error", err)
 	}
+	ai, err := rt.Queues.AI.Size(ctx, vc)
+	if err != nil {
+		slog.Error("error calculating AI queue size", "error", err)
+	}
 
-	return realtime, batch, throttled
+	return realtime, batch, throttled, ai
 }
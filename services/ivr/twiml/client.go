@@ -50,6 +50,24 @@ type Record struct {
 	MaxLength int    `xml:"maxLength,attr,omitempty"`
 }
 
+type Parameter struct {
+	XMLName string `xml:"Parameter"`
+	Name    string `xml:"name,attr"`
+	Value   string `xml:"value,attr"`
+}
+
+type Stream struct {
+	XMLName    string      `xml:"Stream"`
+	URL        string      `xml:"url,attr"`
+	Parameters []Parameter `xml:"Parameter"`
+}
+
+type Connect struct {
+	XMLName string `xml:"Connect"`
+	Action  string `xml:"action,attr,omitempty"`
+	Stream  Stream `xml:"Stream"`
+}
+
 type Response struct {
 	XMLName  string  `xml:"Response"`
 	Message  string  `xml:",comment"`
@@ -16,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/gorilla/websocket"
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/gocommon/urns"
@@ -307,6 +308,9 @@ func (s *service) ResumeForRequest(r *http.Request) (ivr.Resume, error) {
 		}
 		return ivr.InputResume{Attachment: utils.Attachment("audio/mp3:" + url + ".mp3")}, nil
 
+	case "agent":
+		return ivr.AgentResume{}, nil
+
 	case "dial":
 		twStatus := r.Form.Get("DialCallStatus")
 		status := dialStatusMap[twStatus]
@@ -377,7 +381,13 @@ func (s *service) ValidateRequestSignature(r *http.Request) error {
 		path = proxyPath
 	}
 
-	url := fmt.Sprintf("https://%s%s", r.Host, path)
+	// media streams sign their websocket handshakes with the URL they connect to
+	scheme := "https"
+	if websocket.IsWebSocketUpgrade(r) {
+		scheme = "wss"
+	}
+
+	url := fmt.Sprintf("%s://%s%s", scheme, r.Host, path)
 	expected, err := twCalculateSignature(url, r.PostForm, s.authToken)
 	if err != nil {
 		return fmt.Errorf("error calculating signature: %w", err)
@@ -412,6 +422,23 @@ func (s *service) WriteSessionResponse(ctx context.Context, rt *runtime.Runtime,
 	return nil
 }
 
+// WriteAgentResponse writes a TWIML response which connects the call to a media stream, resuming once it ends
+func (s *service) WriteAgentResponse(w http.ResponseWriter, streamURL string, callUUID flows.CallUUID, resumeURL string) error {
+	return s.writeResponse(w, &Response{
+		Commands: []any{
+			Connect{
+				Action: resumeURL + "&wait_type=agent",
+				Stream: Stream{URL: streamURL, Parameters: []Parameter{{Name: "call", Value: string(callUUID)}}},
+			},
+		},
+	})
+}
+
+// NewMediaStream creates a media stream from a websocket connection made by Twilio
+func (s *service) NewMediaStream(conn *websocket.Conn) ivr.MediaStream {
+	return &mediaStream{conn: conn}
+}
+
 func (s *service) WriteRejectResponse(w http.ResponseWriter) error {
 	return s.writeResponse(w, &Response{
 		Commands: []any{Reject{}},
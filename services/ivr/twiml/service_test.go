@@ -2,12 +2,15 @@ package twiml_test
 
 import (
 	"encoding/xml"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/assets"
@@ -20,6 +23,7 @@ import (
 	"github.com/nyaruka/mailroom/v26/testsuite"
 	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestResponseForSprint(t *testing.T) {
@@ -148,3 +152,81 @@ func TestRedactValues(t *testing.T) {
 
 	assert.Equal(t, []string{"U0lEMTIzNDU2Nzg5OnNlc2FtZQ==", "sesame"}, svc.RedactValues(ch))
 }
+
+func TestAgent(t *testing.T) {
+	s := twiml.NewService(http.DefaultClient, "12345", "sesame")
+	asvc := s.(ivr.AgentService)
+
+	w := httptest.NewRecorder()
+	err := asvc.WriteAgentResponse(w, "wss://mailroom.io/mr/ivr/c/19012bfd-3ce3-4cae-9bb9-76cf92c73d49/agent", "0198cb05-7cbe-7ae7-8f1b-9b2b4a1a3bd1", "https://mailroom.io/resume?session=1")
+	assert.NoError(t, err)
+	assert.Equal(t, xml.Header+`<Response><Connect action="https://mailroom.io/resume?session=1&amp;wait_type=agent"><Stream url="wss://mailroom.io/mr/ivr/c/19012bfd-3ce3-4cae-9bb9-76cf92c73d49/agent"><Parameter name="call" value="0198cb05-7cbe-7ae7-8f1b-9b2b4a1a3bd1"></Parameter></Stream></Connect></Response>`, w.Body.String())
+
+	r, _ := http.NewRequest("POST", "https://mailroom.io/resume?session=1&wait_type=agent", nil)
+	r.ParseForm()
+	resume, err := s.ResumeForRequest(r)
+	assert.NoError(t, err)
+	assert.Equal(t, ivr.AgentResume{}, resume)
+
+	// check media stream messages in both directions
+	var sent []string
+	done := make(chan bool)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _ := upgrader.Upgrade(w, r, nil)
+		defer conn.Close()
+		defer close(done)
+
+		for _, m := range []string{
+			`{"event": "connected", "protocol": "Call", "version": "1.0.0"}`,
+			`{"event": "start", "streamSid": "MZ123", "start": {"callSid": "CA123", "customParameters": {"call": "0198cb05-7cbe-7ae7-8f1b-9b2b4a1a3bd1"}}}`,
+			`{"event": "media", "streamSid": "MZ123", "media": {"track": "inbound", "payload": "AQID"}}`,
+			`{"event": "mark", "streamSid": "MZ123", "mark": {"name": "agent_ended"}}`,
+			`{"event": "stop", "streamSid": "MZ123"}`,
+		} {
+			conn.WriteMessage(websocket.TextMessage, []byte(m))
+		}
+		for range 3 {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			sent = append(sent, strings.TrimSpace(string(data)))
+		}
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+
+	stream := asvc.NewMediaStream(conn)
+
+	callUUID, err := stream.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, flows.CallUUID("0198cb05-7cbe-7ae7-8f1b-9b2b4a1a3bd1"), callUUID)
+
+	audio, mark, err := stream.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, audio)
+	assert.Equal(t, "", mark)
+
+	audio, mark, err = stream.Read()
+	assert.NoError(t, err)
+	assert.Nil(t, audio)
+	assert.Equal(t, "agent_ended", mark)
+
+	_, _, err = stream.Read()
+	assert.Equal(t, io.EOF, err)
+
+	assert.NoError(t, stream.WriteAudio([]byte{4, 5, 6}))
+	assert.NoError(t, stream.Clear())
+	assert.NoError(t, stream.WriteMark("agent_ended"))
+	stream.Close()
+	<-done
+
+	assert.Equal(t, []string{
+		`{"event":"media","media":{"payload":"BAUG"},"streamSid":"MZ123"}`,
+		`{"event":"clear","streamSid":"MZ123"}`,
+		`{"event":"mark","mark":{"name":"agent_ended"},"streamSid":"MZ123"}`,
+	}, sent)
+}
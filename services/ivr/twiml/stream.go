@@ -0,0 +1,125 @@
+package twiml
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/core/ivr"
+)
+
+// a message of a media stream, see https://www.twilio.com/docs/voice/media-streams/websocket-messages
+type streamMessage struct {
+	Event     string `json:"event"`
+	StreamSID string `json:"streamSid,omitempty"`
+	Start     *struct {
+		CallSID          string            `json:"callSid"`
+		CustomParameters map[string]string `json:"customParameters"`
+	} `json:"start,omitempty"`
+	Media *struct {
+		Payload string `json:"payload"`
+	} `json:"media,omitempty"`
+	Mark *struct {
+		Name string `json:"name"`
+	} `json:"mark,omitempty"`
+}
+
+// mediaStream is a bidirectional media stream of a call, whose audio is base64 encoded 8kHz G.711 μ-law
+type mediaStream struct {
+	conn      *websocket.Conn
+	streamSID string
+}
+
+var _ ivr.MediaStream = (*mediaStream)(nil)
+
+func (s *mediaStream) Start() (flows.CallUUID, error) {
+	for {
+		msg, err := s.read()
+		if err != nil {
+			return "", err
+		}
+
+		switch msg.Event {
+		case "start":
+			if msg.Start == nil || msg.Start.CustomParameters["call"] == "" {
+				return "", fmt.Errorf("media stream started without call parameter")
+			}
+			s.streamSID = msg.StreamSID
+			return flows.CallUUID(msg.Start.CustomParameters["call"]), nil
+		case "stop":
+			return "", io.EOF
+		}
+	}
+}
+
+func (s *mediaStream) Read() ([]byte, string, error) {
+	for {
+		msg, err := s.read()
+		if err != nil {
+			return nil, "", err
+		}
+
+		switch msg.Event {
+		case "media":
+			if msg.Media == nil {
+				continue
+			}
+			audio, err := base64.StdEncoding.DecodeString(msg.Media.Payload)
+			if err != nil {
+				return nil, "", fmt.Errorf("error decoding media stream audio: %w", err)
+			}
+			return audio, "", nil
+		case "mark":
+			if msg.Mark != nil {
+				return nil, msg.Mark.Name, nil
+			}
+		case "stop":
+			return nil, "", io.EOF
+		}
+	}
+}
+
+func (s *mediaStream) WriteAudio(audio []byte) error {
+	return s.write(map[string]any{"event": "media", "streamSid": s.streamSID, "media": map[string]any{"payload": base64.StdEncoding.EncodeToString(audio)}})
+}
+
+func (s *mediaStream) WriteMark(name string) error {
+	return s.write(map[string]any{"event": "mark", "streamSid": s.streamSID, "mark": map[string]any{"name": name}})
+}
+
+func (s *mediaStream) Clear() error {
+	return s.write(map[string]any{"event": "clear", "streamSid": s.streamSID})
+}
+
+// Close ends the stream, which ends the connect verb so that the call moves on to its action
+func (s *mediaStream) Close() error {
+	s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return s.conn.Close()
+}
+
+func (s *mediaStream) read() (*streamMessage, error) {
+	_, data, err := s.conn.ReadMessage()
+	if err != nil {
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("error reading from media stream: %w", err)
+	}
+
+	msg := &streamMessage{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("error parsing media stream message: %w", err)
+	}
+	return msg, nil
+}
+
+func (s *mediaStream) write(msg map[string]any) error {
+	if err := s.conn.WriteJSON(msg); err != nil {
+		return fmt.Errorf("error writing to media stream: %w", err)
+	}
+	return nil
+}
@@ -18,17 +18,22 @@ import (
 const (
 	TypeAnthropic = "anthropic"
 
-	configAPIKey = "api_key"
+	configAPIKey   = "api_key"
+	configEndpoint = "endpoint"
 )
 
 func init() {
 	models.RegisterLLMService(TypeAnthropic, New)
+
+	ai.RegisterDefaultEndpoint(TypeAnthropic, "https://api.anthropic.com/")
 }
 
 // an LLM service implementation for Anthropic
 type service struct {
-	client anthropic.Client
-	model  string
+	client   anthropic.Client
+	model    string
+	invokeID string // what the model is called by in requests if not its name, e.g. an inference profile
+	params   ai.Params
 }
 
 func New(rt *runtime.Runtime, m *models.LLM, c *http.Client) (flows.LLMService, error) {
@@ -37,30 +42,67 @@ func New(rt *runtime.Runtime, m *models.LLM, c *http.Client) (flows.LLMService,
 		return nil, fmt.Errorf("config incomplete for LLM: %s", m.UUID())
 	}
 
-	return &service{
-		client: anthropic.NewClient(option.WithAPIKey(apiKey), option.WithHTTPClient(c)),
-		model:  m.Model(),
-	}, nil
+	return NewWithOptions(m.Model(), "", m.Params(),
+		option.WithAPIKey(apiKey),
+		option.WithHTTPClient(c),
+		option.WithBaseURL(m.Config().GetString(configEndpoint, ai.DefaultEndpoint(m.Type()))),
+	), nil
 }
 
-func (s *service) Response(ctx context.Context, instructions, input string, maxTokens int) (*flows.LLMResponse, error) {
-	resp, err := s.client.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:  anthropic.Model(s.model),
-		System: []anthropic.TextBlockParam{{Text: instructions}},
-		Messages: []anthropic.MessageParam{
-			{
-				Role: anthropic.MessageParamRoleUser,
-				Content: []anthropic.ContentBlockParamUnion{
-					{
-						OfText: &anthropic.TextBlockParam{Text: input},
-					},
-				},
-			},
-		},
-		MaxTokens: int64(maxTokens),
+// NewWithOptions creates a new service for the given model with a client created from the given options, e.g. to use
+// Anthropic models hosted by another provider. If that provider needs requests to use another ID for the model, e.g. an
+// inference profile, that can be given as the invoke ID.
+func NewWithOptions(model, invokeID string, params ai.Params, opts ...option.RequestOption) *ai.LLMService {
+	if invokeID == "" {
+		invokeID = model
+	}
+
+	return ai.NewLLMService(&service{
+		client:   anthropic.NewClient(opts...),
+		model:    model,
+		invokeID: invokeID,
+		params:   params,
 	})
+}
+
+// the capabilities of Anthropic, which has no embeddings or JSON modes, which are further limited by model
+var capabilities = ai.ServiceCapabilities{Tools: true, Vision: true}
+
+func (s *service) Capabilities() ai.ServiceCapabilities {
+	return ai.ModelCapabilities(s.model, capabilities)
+}
+
+func (s *service) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	timer := ai.NewTimer()
+	p := ai.Params{Temperature: s.params.Temperature, TopP: s.params.TopP} // Anthropic has no JSON mode
+
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.Model(s.invokeID),
+		System:    []anthropic.TextBlockParam{{Text: req.Instructions}},
+		MaxTokens: int64(req.MaxTokens),
+	}
+	for _, t := range req.History {
+		params.Messages = append(params.Messages, anthropic.NewUserMessage(anthropic.NewTextBlock(t.Input)), anthropic.NewAssistantMessage(anthropic.NewTextBlock(t.Output)))
+	}
+	params.Messages = append(params.Messages, anthropic.NewUserMessage(anthropic.NewTextBlock(req.Input)))
+
+	if p.Temperature != nil {
+		params.Temperature = anthropic.Float(*p.Temperature)
+	}
+	if p.TopP != nil {
+		params.TopP = anthropic.Float(*p.TopP)
+	}
+
+	var httpResp *http.Response
+
+	opts := []option.RequestOption{option.WithResponseInto(&httpResp), option.WithMaxRetries(0)} // retries are ours to make
+	if req.IdempotencyKey != "" {
+		opts = append(opts, option.WithHeader("Idempotency-Key", req.IdempotencyKey))
+	}
+
+	resp, err := s.client.Messages.New(timer.Trace(ctx), params, opts...)
 	if err != nil {
-		return nil, s.error(err, instructions, input)
+		return nil, s.error(err, httpResp, req.Instructions, req.Input)
 	}
 
 	var output strings.Builder
@@ -70,24 +112,42 @@ func (s *service) Response(ctx context.Context, instructions, input string, maxT
 		}
 	}
 
-	return &flows.LLMResponse{
+	// Anthropic input tokens don't include those read from or written to the cache
+	totalInput := resp.Usage.InputTokens + resp.Usage.CacheReadInputTokens + resp.Usage.CacheCreationInputTokens
+
+	r := &ai.Response{
 		Output:       s.cleanOutput(output.String()),
 		TokensInput:  resp.Usage.InputTokens,
 		TokensOutput: resp.Usage.OutputTokens,
-	}, nil
+		Timings:      timer.Timings(),
+		CachedTokens: int(resp.Usage.CacheReadInputTokens),
+		CacheStatus:  ai.CacheStatusFor(resp.Usage.CacheReadInputTokens, totalInput),
+	}
+	applied := p.Applied(s.model, req.MaxTokens)
+	r.RequestHash = ai.HashRequest(req, applied)
+	if req.Debug {
+		r.AppliedParams = applied
+	}
+
+	// Anthropic has no graded safety ratings but does tell us when its safety classifiers made the model refuse
+	if resp.StopReason == anthropic.StopReasonRefusal {
+		r.SafetyRatings = map[string]string{"refusal": ai.SafetyHigh}
+	}
+	return r, nil
 }
 
-func (s *service) error(err error, instructions, input string) error {
-	code := ai.ErrorUnknown
+func (s *service) error(err error, resp *http.Response, instructions, input string) error {
+	// gateways in front of the provider may return error bodies that aren't the JSON the SDK expects
+	if rerr := ai.NewRawResponseError(resp, instructions, input); rerr != nil {
+		return rerr
+	}
+
+	code, status := ai.ErrorUnknown, 0
 	if aerr, ok := errors.AsType[*anthropic.Error](err); ok {
-		switch aerr.StatusCode {
-		case http.StatusUnauthorized:
-			code = ai.ErrorCredentials
-		case http.StatusTooManyRequests:
-			code = ai.ErrorRateLimit
-		}
+		code = ai.ErrorCodeForStatus(aerr.StatusCode)
+		status = aerr.StatusCode
 	}
-	return &ai.ServiceError{Message: err.Error(), Code: code, Instructions: instructions, Input: input}
+	return &ai.ServiceError{Message: err.Error(), Code: code, StatusCode: status, RetryAfter: ai.ParseRetryAfter(resp), Instructions: instructions, Input: input}
 }
 
 func (s *service) cleanOutput(output string) string {
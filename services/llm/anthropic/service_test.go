@@ -12,6 +12,10 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+func TestDefaultEndpoint(t *testing.T) {
+	assert.Equal(t, "https://api.anthropic.com/", ai.DefaultEndpoint("anthropic"))
+}
+
 func TestService(t *testing.T) {
 	ctx, rt := testsuite.Runtime(t)
 
@@ -28,8 +32,24 @@ func TestService(t *testing.T) {
 		"https://api.anthropic.com/v1/messages": {
 			httpx.NewMockResponse(401, map[string]string{"Content-type": "application/json"}, []byte(`{"type": "error", "error": {"message": "Incorrect API key provided", "type": "invalid_api_key"}}`)),
 			httpx.NewMockResponse(429, map[string]string{"Content-type": "application/json"}, []byte(`{"type": "error", "error": {"message": "Rate limit reached for your model", "type": "rate_limit_exceeded"}}`)),
-			httpx.NewMockResponse(429, map[string]string{"Content-type": "application/json"}, []byte(`{"type": "error", "error": {"message": "Rate limit reached for your model", "type": "rate_limit_exceeded"}}`)),
-			httpx.NewMockResponse(429, map[string]string{"Content-type": "application/json"}, []byte(`{"type": "error", "error": {"message": "Rate limit reached for your model", "type": "rate_limit_exceeded"}}`)),
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "msg_01XFDUDYJgAACzvnptvVoYEL",
+				"type": "message",
+				"role": "assistant",
+				"model": "claude",
+				"content": [{"type": "text", "text": "Hola mundo"}],
+				"stop_reason": "end_turn",
+				"usage": {"input_tokens": 0, "cache_read_input_tokens": 2048, "cache_creation_input_tokens": 0, "output_tokens": 3}
+			}`)),
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "msg_01Y2nqMde5UgxzMj8iLDtvQP",
+				"type": "message",
+				"role": "assistant",
+				"model": "claude",
+				"content": [],
+				"stop_reason": "refusal",
+				"usage": {"input_tokens": 12, "output_tokens": 0}
+			}`)),
 		},
 	})
 
@@ -56,4 +76,18 @@ func TestService(t *testing.T) {
 		assert.Equal(t, ai.ErrorRateLimit, serr.Code)
 	}
 	assert.Nil(t, resp)
+
+	// no safety ratings for a normal response, which in this case was entirely read from the prompt cache
+	xresp, err := svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "translate to Spanish", Input: "Hello world", MaxTokens: 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hola mundo", xresp.Output)
+	assert.Nil(t, xresp.SafetyRatings)
+	assert.Equal(t, 2048, xresp.CachedTokens)
+	assert.Equal(t, ai.CacheHit, xresp.CacheStatus)
+
+	// but a refusal is reported as one
+	xresp, err = svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "translate to Spanish", Input: "Hello world", MaxTokens: 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, "", xresp.Output)
+	assert.Equal(t, map[string]string{"refusal": "high"}, xresp.SafetyRatings)
 }
@@ -0,0 +1,155 @@
+package bedrock
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+)
+
+// an LLM service implementation for Llama models on Bedrock, which are invoked with a raw prompt in Llama's chat format
+type llamaService struct {
+	client   *http.Client
+	cfg      aws.Config
+	signer   *v4.Signer
+	model    string
+	invokeID string
+	params   ai.Params
+}
+
+func newLlamaService(c *http.Client, cfg aws.Config, model, invokeID string, params ai.Params) *ai.LLMService {
+	if invokeID == "" {
+		invokeID = model
+	}
+
+	return ai.NewLLMService(&llamaService{client: c, cfg: cfg, signer: v4.NewSigner(), model: model, invokeID: invokeID, params: params})
+}
+
+// Llama has no tools, vision, embeddings or JSON modes
+func (s *llamaService) Capabilities() ai.ServiceCapabilities {
+	return ai.ModelCapabilities(s.model, ai.ServiceCapabilities{})
+}
+
+type llamaRequest struct {
+	Prompt      string   `json:"prompt"`
+	MaxGenLen   int      `json:"max_gen_len"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+}
+
+type llamaResponse struct {
+	Generation           string `json:"generation"`
+	PromptTokenCount     int64  `json:"prompt_token_count"`
+	GenerationTokenCount int64  `json:"generation_token_count"`
+	StopReason           string `json:"stop_reason"`
+}
+
+func (s *llamaService) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	timer := ai.NewTimer()
+	p := ai.Params{Temperature: s.params.Temperature, TopP: s.params.TopP}
+
+	body, _ := json.Marshal(&llamaRequest{Prompt: llamaPrompt(req), MaxGenLen: req.MaxTokens, Temperature: p.Temperature, TopP: p.TopP})
+
+	u := &url.URL{
+		Scheme:  "https",
+		Host:    fmt.Sprintf("bedrock-runtime.%s.amazonaws.com", s.cfg.Region),
+		Path:    fmt.Sprintf("/model/%s/invoke", s.invokeID),
+		RawPath: fmt.Sprintf("/model/%s/invoke", url.QueryEscape(s.invokeID)),
+	}
+	httpReq, err := http.NewRequestWithContext(timer.Trace(ctx), http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+
+	creds, err := s.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, &ai.ServiceError{Message: fmt.Sprintf("error retrieving AWS credentials: %s", err), Code: ai.ErrorCredentials, Instructions: req.Instructions, Input: req.Input}
+	}
+	hash := sha256.Sum256(body)
+	if err := s.signer.SignHTTP(ctx, creds, httpReq, hex.EncodeToString(hash[:]), "bedrock", s.cfg.Region, time.Now()); err != nil {
+		return nil, fmt.Errorf("error signing request: %w", err)
+	}
+
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		return nil, &ai.ServiceError{Message: err.Error(), Code: ai.ErrorUnknown, Instructions: req.Instructions, Input: req.Input}
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode >= 400 {
+		return nil, s.error(httpResp, req.Instructions, req.Input)
+	}
+
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, &ai.ServiceError{Message: err.Error(), Code: ai.ErrorUnknown, Instructions: req.Instructions, Input: req.Input}
+	}
+
+	resp := &llamaResponse{}
+	if err := json.Unmarshal(respBody, resp); err != nil {
+		return nil, &ai.ServiceError{Message: fmt.Sprintf("error parsing response: %s", err), Code: ai.ErrorUnknown, Instructions: req.Instructions, Input: req.Input}
+	}
+
+	r := &ai.Response{
+		Output:       strings.TrimSpace(resp.Generation),
+		TokensInput:  resp.PromptTokenCount,
+		TokensOutput: resp.GenerationTokenCount,
+		Timings:      timer.Timings(),
+	}
+	applied := p.Applied(s.model, req.MaxTokens)
+	r.RequestHash = ai.HashRequest(req, applied)
+	if req.Debug {
+		r.AppliedParams = applied
+	}
+	return r, nil
+}
+
+func (s *llamaService) error(resp *http.Response, instructions, input string) error {
+	normalizeStatus(resp)
+
+	if rerr := ai.NewRawResponseError(resp, instructions, input); rerr != nil {
+		return rerr
+	}
+
+	body := &struct {
+		Message string `json:"message"`
+	}{}
+	json.NewDecoder(resp.Body).Decode(body)
+
+	message := body.Message
+	if message == "" {
+		message = resp.Status
+	}
+	return &ai.ServiceError{Message: message, Code: ai.ErrorCodeForStatus(resp.StatusCode), StatusCode: resp.StatusCode, RetryAfter: ai.ParseRetryAfter(resp), Instructions: instructions, Input: input}
+}
+
+// builds a prompt in the chat format of Llama 3 models from the given request
+func llamaPrompt(req *ai.Request) string {
+	var b strings.Builder
+	turn := func(role, content string) {
+		b.WriteString("<|start_header_id|>" + role + "<|end_header_id|>\n\n" + content + "<|eot_id|>")
+	}
+
+	b.WriteString("<|begin_of_text|>")
+	turn("system", req.Instructions)
+	for _, t := range req.History {
+		turn("user", t.Input)
+		turn("assistant", t.Output)
+	}
+	turn("user", req.Input)
+	b.WriteString("<|start_header_id|>assistant<|end_header_id|>\n\n")
+	return b.String()
+}
@@ -0,0 +1,128 @@
+package bedrock
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go/bedrock"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/services/llm/anthropic"
+)
+
+const (
+	TypeBedrock = "bedrock"
+
+	configRegion    = "region"
+	configAccessKey = "access_key" // if not set, credentials come from the environment, e.g. an IAM role
+	configSecret    = "secret"
+	configModelARN  = "model_arn" // e.g. an inference profile to use instead of the model ID
+)
+
+func init() {
+	models.RegisterLLMService(TypeBedrock, New)
+}
+
+// New creates a new LLM service for Anthropic or Llama models hosted on AWS Bedrock, which authenticates with IAM
+// credentials rather than an API key
+func New(rt *runtime.Runtime, m *models.LLM, c *http.Client) (flows.LLMService, error) {
+	region := m.Config().GetString(configRegion, "")
+	accessKey := m.Config().GetString(configAccessKey, "")
+	secret := m.Config().GetString(configSecret, "")
+
+	if region == "" || (accessKey == "") != (secret == "") {
+		return nil, fmt.Errorf("config incomplete for LLM: %s", m.UUID())
+	}
+
+	cfg, err := loadConfig(region, accessKey, secret)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS config for LLM: %w", err)
+	}
+
+	// the model stays the base model ID so that it can be looked up, with any ARN only used to invoke it
+	invokeID := m.Config().GetString(configModelARN, "")
+
+	switch {
+	case isModelFamily(m.Model(), "anthropic"):
+		return anthropic.NewWithOptions(m.Model(), invokeID, m.Params(),
+			option.WithHTTPClient(c),
+			option.WithMiddleware(normalizeErrors), // must be before bedrock so it sees responses last
+			bedrock.WithConfig(cfg),
+		), nil
+	case isModelFamily(m.Model(), "meta"):
+		return newLlamaService(c, cfg, m.Model(), invokeID, m.Params()), nil
+	}
+
+	return nil, fmt.Errorf("unsupported model %s for LLM: %s", m.Model(), m.UUID())
+}
+
+// AWS configs are loaded once for each set of credentials since loading them from the environment is expensive
+var (
+	awsConfigs   = map[string]aws.Config{}
+	awsConfigsMu sync.Mutex
+)
+
+func loadConfig(region, accessKey, secret string) (aws.Config, error) {
+	secretHash := sha256.Sum256([]byte(secret))
+	key := fmt.Sprintf("%s:%s:%x", region, accessKey, secretHash)
+
+	awsConfigsMu.Lock()
+	defer awsConfigsMu.Unlock()
+
+	if cfg, ok := awsConfigs[key]; ok {
+		return cfg, nil
+	}
+
+	opts := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	if accessKey != "" {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secret, "")))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	awsConfigs[key] = cfg
+	return cfg, nil
+}
+
+// checks whether the given Bedrock model ID is of a model from the given provider, e.g. meta.llama3-70b-instruct-v1:0,
+// allowing for a region prefix as used by cross-region inference profiles, e.g. us.meta.llama3-70b-instruct-v1:0
+func isModelFamily(model, provider string) bool {
+	return strings.HasPrefix(model, provider+".") || strings.Contains(model, "."+provider+".")
+}
+
+// Bedrock reports some errors with statuses that don't match the equivalent Anthropic errors, e.g. quota errors are
+// 400s, so we use the error type header to normalize those statuses so that errors are mapped to the right codes.
+func normalizeErrors(r *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+	resp, err := next(r)
+	if err != nil || resp == nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+
+	normalizeStatus(resp)
+	return resp, nil
+}
+
+// normalizes the status of the given error response using its error type header
+func normalizeStatus(resp *http.Response) {
+	// header value can be suffixed with a URL after a colon
+	errType, _, _ := strings.Cut(resp.Header.Get("X-Amzn-Errortype"), ":")
+
+	switch errType {
+	case "ThrottlingException", "ServiceQuotaExceededException", "ModelNotReadyException":
+		resp.StatusCode, resp.Status = http.StatusTooManyRequests, "429 Too Many Requests"
+	case "AccessDeniedException", "UnrecognizedClientException", "InvalidSignatureException", "ExpiredTokenException":
+		resp.StatusCode, resp.Status = http.StatusUnauthorized, "401 Unauthorized"
+	}
+}
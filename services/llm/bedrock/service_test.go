@@ -0,0 +1,129 @@
+package bedrock_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/goflow/test"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/services/llm/bedrock"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	bad := testdb.InsertLLM(t, rt, testdb.Org1, "c69723d8-fb37-4cf6-9ec4-bc40cb36f2cc", "bedrock", "anthropic.claude-3-5-sonnet", "Bad Config", map[string]any{"region": "us-east-1", "access_key": "AKIA123"}, "TF")
+	good := testdb.InsertLLM(t, rt, testdb.Org1, "b86966fd-206e-4bdd-a962-06faa3af1182", "bedrock", "anthropic.claude-3-5-sonnet", "Good", map[string]any{"region": "us-east-1", "access_key": "AKIA123", "secret": "sesame"}, "TF")
+	llama := testdb.InsertLLM(t, rt, testdb.Org1, "0b7b3a4e-5d1c-4f2a-9e8b-7c6d5e4f3a2b", "bedrock", "meta.llama3-1-70b-instruct-v1:0", "Llama", map[string]any{"region": "us-east-1", "access_key": "AKIA123", "secret": "sesame"}, "TF")
+	unsupported := testdb.InsertLLM(t, rt, testdb.Org1, "8d1e2f3a-4b5c-4d6e-8f7a-9b0c1d2e3f4a", "bedrock", "amazon.titan-text-express-v1", "Titan", map[string]any{"region": "us-east-1"}, "TF")
+	profile := testdb.InsertLLM(t, rt, testdb.Org1, "2ec2809e-b0d7-4d7c-a0b5-0bd4b1bbc0ad", "bedrock", "anthropic.claude-3-5-sonnet", "Profile", map[string]any{"region": "eu-west-1", "access_key": "AKIA123", "secret": "sesame", "model_arn": "eu.claude-profile"}, "TF")
+
+	oa := testdb.Org1.Load(t, rt)
+	badLLM := oa.LLMByID(bad.ID)
+	goodLLM := oa.LLMByID(good.ID)
+	profileLLM := oa.LLMByID(profile.ID)
+	llamaLLM := oa.LLMByID(llama.ID)
+	unsupportedLLM := oa.LLMByID(unsupported.ID)
+
+	throttled := httpx.NewMockResponse(400, map[string]string{"Content-type": "application/json", "X-Amzn-Errortype": "ServiceQuotaExceededException:http://internal.amazon.com/coral/com.amazon.bedrock/"}, []byte(`{"message": "Too many tokens, please wait before trying again."}`))
+
+	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://bedrock-runtime.us-east-1.amazonaws.com/model/anthropic.claude-3-5-sonnet/invoke": {
+			httpx.NewMockResponse(403, map[string]string{"Content-type": "application/json", "X-Amzn-Errortype": "UnrecognizedClientException"}, []byte(`{"message": "The security token included in the request is invalid."}`)),
+			throttled, throttled, throttled,
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "msg_01XFDUDYJgAACzvnptvVoYEL",
+				"type": "message",
+				"role": "assistant",
+				"model": "claude-3-5-sonnet-20241022",
+				"content": [{"type": "text", "text": "Hola mundo"}],
+				"stop_reason": "end_turn",
+				"usage": {"input_tokens": 12, "output_tokens": 3}
+			}`)),
+		},
+		"https://bedrock-runtime.us-east-1.amazonaws.com/model/meta.llama3-1-70b-instruct-v1%3A0/invoke": {
+			httpx.NewMockResponse(400, map[string]string{"Content-type": "application/json", "X-Amzn-Errortype": "ThrottlingException"}, []byte(`{"message": "Too many requests, please wait before trying again."}`)),
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{"generation": " Hola mundo", "prompt_token_count": 24, "generation_token_count": 3, "stop_reason": "stop"}`)),
+		},
+		"https://bedrock-runtime.eu-west-1.amazonaws.com/model/eu.claude-profile/invoke": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "msg_01Y2nqMde5UgxzMj8iLDtvQP",
+				"type": "message",
+				"role": "assistant",
+				"model": "claude-3-5-sonnet-20241022",
+				"content": [{"type": "text", "text": "Bonjour le monde"}],
+				"stop_reason": "end_turn",
+				"usage": {"input_tokens": 12, "output_tokens": 4}
+			}`)),
+		},
+	})
+
+	// can't create service with a secret missing
+	svc, err := bedrock.New(rt, badLLM, client)
+	assert.EqualError(t, err, "config incomplete for LLM: c69723d8-fb37-4cf6-9ec4-bc40cb36f2cc")
+	assert.Nil(t, svc)
+
+	svc, err = bedrock.New(rt, goodLLM, client)
+	assert.NoError(t, err)
+	assert.NotNil(t, svc)
+
+	resp, err := svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.ErrorContains(t, err, "The security token included in the request is invalid.")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorCredentials, serr.Code)
+	}
+	assert.Nil(t, resp)
+
+	resp, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.ErrorContains(t, err, "Too many tokens")
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorRateLimit, serr.Code)
+	}
+	assert.Nil(t, resp)
+
+	resp, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hola mundo", resp.Output)
+	assert.Equal(t, int64(12), resp.TokensInput)
+	assert.Equal(t, int64(3), resp.TokensOutput)
+
+	// model ARN is used in place of the model if set
+	svc, err = bedrock.New(rt, profileLLM, client)
+	assert.NoError(t, err)
+
+	resp, err = svc.Response(ctx, "translate to French", "Hello world", 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bonjour le monde", resp.Output)
+
+	// but the base model ID is still used for the model
+	xresp, err := svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "translate to French", Input: "Hello world", MaxTokens: 1000, Debug: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "anthropic.claude-3-5-sonnet", xresp.AppliedParams["model"])
+
+	// Llama models are invoked with a prompt in their chat format
+	svc, err = bedrock.New(rt, llamaLLM, client)
+	assert.NoError(t, err)
+
+	resp, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorRateLimit, serr.Code)
+	}
+	assert.Nil(t, resp)
+
+	resp, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hola mundo", resp.Output)
+	assert.Equal(t, int64(24), resp.TokensInput)
+	assert.Equal(t, int64(3), resp.TokensOutput)
+
+	// other models aren't supported
+	svc, err = bedrock.New(rt, unsupportedLLM, client)
+	assert.EqualError(t, err, "unsupported model amazon.titan-text-express-v1 for LLM: 8d1e2f3a-4b5c-4d6e-8f7a-9b0c1d2e3f4a")
+	assert.Nil(t, svc)
+}
@@ -17,17 +17,21 @@ import (
 const (
 	TypeGoogle = "google"
 
-	configAPIKey = "api_key"
+	configAPIKey   = "api_key"
+	configEndpoint = "endpoint"
 )
 
 func init() {
 	models.RegisterLLMService(TypeGoogle, New)
+
+	ai.RegisterDefaultEndpoint(TypeGoogle, "https://generativelanguage.googleapis.com/")
 }
 
 // an LLM service implementation for Google GenAI
 type service struct {
 	client *genai.Client
 	model  string
+	params ai.Params
 }
 
 func New(rt *runtime.Runtime, m *models.LLM, c *http.Client) (flows.LLMService, error) {
@@ -40,30 +44,105 @@ func New(rt *runtime.Runtime, m *models.LLM, c *http.Client) (flows.LLMService,
 		APIKey:     apiKey,
 		Backend:    genai.BackendGeminiAPI,
 		HTTPClient: c,
+		HTTPOptions: genai.HTTPOptions{
+			BaseURL: m.Config().GetString(configEndpoint, ai.DefaultEndpoint(m.Type())),
+		},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error creating LLM client: %w", err)
 	}
 
-	return &service{client: client, model: m.Model()}, nil
+	return ai.NewLLMService(&service{client: client, model: m.Model(), params: m.Params()}), nil
+}
+
+// the capabilities of Google GenAI, which are further limited by model
+var capabilities = ai.ServiceCapabilities{Tools: true, Vision: true, Embeddings: true, JSONMode: true, JSONSchema: true}
+
+func (s *service) Capabilities() ai.ServiceCapabilities {
+	return ai.ModelCapabilities(s.model, capabilities)
 }
 
-func (s *service) Response(ctx context.Context, instructions, input string, maxTokens int) (*flows.LLMResponse, error) {
+func (s *service) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	timer := ai.NewTimer()
+	p := ai.Params{Temperature: new(ai.DefaultTemperature)}.Override(s.params)
+
 	config := &genai.GenerateContentConfig{
-		Temperature:       genai.Ptr(float32(0.000001)),
-		MaxOutputTokens:   int32(maxTokens),
-		SystemInstruction: &genai.Content{Parts: []*genai.Part{{Text: instructions}}}}
+		Temperature:       genai.Ptr(float32(*p.Temperature)),
+		MaxOutputTokens:   int32(req.MaxTokens),
+		SystemInstruction: &genai.Content{Parts: []*genai.Part{{Text: req.Instructions}}}}
+
+	if p.TopP != nil {
+		config.TopP = genai.Ptr(float32(*p.TopP))
+	}
+	if p.JSONMode != nil && *p.JSONMode {
+		config.ResponseMIMEType = "application/json"
+	}
+	if p.Seed != nil {
+		config.Seed = genai.Ptr(int32(*p.Seed))
+	}
+	if p.FrequencyPenalty != nil {
+		config.FrequencyPenalty = genai.Ptr(float32(*p.FrequencyPenalty))
+	}
+	if p.PresencePenalty != nil {
+		config.PresencePenalty = genai.Ptr(float32(*p.PresencePenalty))
+	}
+
+	var contents []*genai.Content
+	for _, t := range req.History {
+		contents = append(contents, genai.NewContentFromText(t.Input, genai.RoleUser), genai.NewContentFromText(t.Output, genai.RoleModel))
+	}
+	contents = append(contents, genai.NewContentFromText(req.Input, genai.RoleUser))
 
-	resp, err := s.client.Models.GenerateContent(ctx, s.model, genai.Text(input), config)
+	resp, err := s.client.Models.GenerateContent(timer.Trace(ctx), s.model, contents, config)
 	if err != nil {
-		return nil, s.error(err, instructions, input)
+		return nil, s.error(err, req.Instructions, req.Input)
 	}
 
-	return &flows.LLMResponse{
+	// Gemini thinking tokens aren't included in the candidates count but are billed as output
+	r := &ai.Response{
 		Output:       strings.TrimSpace(resp.Text()),
 		TokensInput:  int64(resp.UsageMetadata.PromptTokenCount),
-		TokensOutput: int64(resp.UsageMetadata.CandidatesTokenCount),
-	}, nil
+		TokensOutput: int64(resp.UsageMetadata.CandidatesTokenCount + resp.UsageMetadata.ThoughtsTokenCount),
+		Timings:      timer.Timings(),
+		CachedTokens: int(resp.UsageMetadata.CachedContentTokenCount),
+		CacheStatus:  ai.CacheStatusFor(int64(resp.UsageMetadata.CachedContentTokenCount), int64(resp.UsageMetadata.PromptTokenCount)),
+
+		TokensReasoning: int64(resp.UsageMetadata.ThoughtsTokenCount),
+	}
+	if len(resp.Candidates) > 0 {
+		r.SafetyRatings = safetyRatings(resp.Candidates[0].SafetyRatings)
+	}
+	applied := p.Applied(s.model, req.MaxTokens)
+	r.RequestHash = ai.HashRequest(req, applied)
+	if req.Debug {
+		r.AppliedParams = applied
+	}
+	return r, nil
+}
+
+// normalizes Gemini safety ratings, e.g. HARM_CATEGORY_HARASSMENT=NEGLIGIBLE becomes harassment=negligible. Severity
+// is only returned by Vertex AI so otherwise we use the probability.
+func safetyRatings(ratings []*genai.SafetyRating) map[string]string {
+	if len(ratings) == 0 {
+		return nil
+	}
+
+	normalized := make(map[string]string, len(ratings))
+	for _, r := range ratings {
+		category := strings.ToLower(strings.TrimPrefix(string(r.Category), "HARM_CATEGORY_"))
+
+		var severity string
+		if r.Severity != "" && r.Severity != genai.HarmSeverityUnspecified {
+			severity = strings.ToLower(strings.TrimPrefix(string(r.Severity), "HARM_SEVERITY_"))
+		} else if r.Probability != "" && r.Probability != genai.HarmProbabilityUnspecified {
+			severity = strings.ToLower(string(r.Probability))
+		} else {
+			continue
+		}
+
+		normalized[category] = severity
+	}
+	return normalized
 }
 
 func (s *service) error(err error, instructions, input string) error {
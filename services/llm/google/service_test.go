@@ -4,14 +4,21 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/goflow/test"
+	"github.com/nyaruka/mailroom/v26/core/ai"
 	"github.com/nyaruka/mailroom/v26/services/llm/google"
 	"github.com/nyaruka/mailroom/v26/testsuite"
 	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestDefaultEndpoint(t *testing.T) {
+	assert.Equal(t, "https://generativelanguage.googleapis.com/", ai.DefaultEndpoint("google"))
+}
+
 func TestService(t *testing.T) {
-	_, rt := testsuite.Runtime(t)
+	ctx, rt := testsuite.Runtime(t)
 
 	defer testsuite.Reset(t, rt, testsuite.ResetData)
 
@@ -30,4 +37,33 @@ func TestService(t *testing.T) {
 	svc, err = google.New(rt, goodLLM, http.DefaultClient)
 	assert.NoError(t, err)
 	assert.NotNil(t, svc)
+
+	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://generativelanguage.googleapis.com/v1beta/models/gemini:generateContent": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"candidates": [
+					{
+						"content": {"parts": [{"text": "Hola mundo"}], "role": "model"},
+						"finishReason": "STOP",
+						"safetyRatings": [
+							{"category": "HARM_CATEGORY_HATE_SPEECH", "probability": "NEGLIGIBLE"},
+							{"category": "HARM_CATEGORY_HARASSMENT", "probability": "LOW"},
+							{"category": "HARM_CATEGORY_DANGEROUS_CONTENT", "probability": "LOW", "severity": "HARM_SEVERITY_MEDIUM"}
+						]
+					}
+				],
+				"usageMetadata": {"promptTokenCount": 12, "candidatesTokenCount": 3, "totalTokenCount": 15}
+			}`)),
+		},
+	})
+
+	svc, err = google.New(rt, goodLLM, client)
+	assert.NoError(t, err)
+
+	resp, err := svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "translate to Spanish", Input: "Hello world", MaxTokens: 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hola mundo", resp.Output)
+	assert.Equal(t, int64(12), resp.TokensInput)
+	assert.Equal(t, int64(3), resp.TokensOutput)
+	assert.Equal(t, map[string]string{"hate_speech": "negligible", "harassment": "low", "dangerous_content": "medium"}, resp.SafetyRatings)
 }
@@ -0,0 +1,211 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/responses"
+)
+
+var _ ai.BatchService = (*service)(nil)
+
+// a line of a batch input file
+type batchRequest struct {
+	CustomID string `json:"custom_id"`
+	Method   string `json:"method"`
+	URL      string `json:"url"`
+	Body     any    `json:"body"`
+}
+
+// a line of a batch output or error file
+type batchResponse struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// SubmitBatch submits the given requests to the batch API, which processes them within 24 hours at half the cost
+func (s *service) SubmitBatch(ctx context.Context, reqs []*ai.Request) (string, error) {
+	lines := make([]*batchRequest, len(reqs))
+	for i, req := range reqs {
+		params, _ := s.newParams(req)
+		lines[i] = &batchRequest{CustomID: strconv.Itoa(i), Method: http.MethodPost, URL: "/v1/responses", Body: params}
+	}
+
+	return s.submitBatch(ctx, openai.BatchNewParamsEndpointV1Responses, lines)
+}
+
+// SubmitEmbeddingBatch submits the given sets of inputs to be embedded by the batch API
+func (s *service) SubmitEmbeddingBatch(ctx context.Context, inputs [][]string) (string, error) {
+	lines := make([]*batchRequest, len(inputs))
+	for i, in := range inputs {
+		params := openai.EmbeddingNewParams{
+			Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: in},
+			Model: openai.EmbeddingModel(s.embeddingModel),
+		}
+		lines[i] = &batchRequest{CustomID: strconv.Itoa(i), Method: http.MethodPost, URL: "/v1/embeddings", Body: params}
+	}
+
+	return s.submitBatch(ctx, openai.BatchNewParamsEndpointV1Embeddings, lines)
+}
+
+// uploads the given requests as an input file and creates a batch to process them
+func (s *service) submitBatch(ctx context.Context, endpoint openai.BatchNewParamsEndpoint, lines []*batchRequest) (string, error) {
+	var httpResp *http.Response
+
+	input := &bytes.Buffer{}
+	enc := json.NewEncoder(input)
+	for _, l := range lines {
+		if err := enc.Encode(l); err != nil {
+			return "", fmt.Errorf("error encoding batch request: %w", err)
+		}
+	}
+
+	file, err := s.client.Files.New(ctx, openai.FileNewParams{
+		File:    openai.File(input, "batch.jsonl", "application/jsonl"),
+		Purpose: openai.FilePurposeBatch,
+	}, option.WithResponseInto(&httpResp))
+	if err != nil {
+		return "", s.error(err, httpResp, "", "")
+	}
+
+	batch, err := s.client.Batches.New(ctx, openai.BatchNewParams{
+		CompletionWindow: openai.BatchNewParamsCompletionWindow24h,
+		Endpoint:         endpoint,
+		InputFileID:      file.ID,
+	}, option.WithResponseInto(&httpResp))
+	if err != nil {
+		return "", s.error(err, httpResp, "", "")
+	}
+
+	return batch.ID, nil
+}
+
+// CollectBatch collects the results of a batch if it has finished. Batches which expired or were cancelled have
+// partial results, and requests without a result are given an error.
+func (s *service) CollectBatch(ctx context.Context, id string) ([]*ai.BatchResult, error) {
+	var httpResp *http.Response
+
+	batch, err := s.client.Batches.Get(ctx, id, option.WithResponseInto(&httpResp))
+	if err != nil {
+		return nil, s.error(err, httpResp, "", "")
+	}
+
+	results := make([]*ai.BatchResult, batch.RequestCounts.Total)
+
+	switch batch.Status {
+	case openai.BatchStatusCompleted, openai.BatchStatusExpired, openai.BatchStatusCancelled:
+		for _, fileID := range []string{batch.OutputFileID, batch.ErrorFileID} {
+			if fileID == "" {
+				continue
+			}
+			if err := s.readBatchFile(ctx, batch.Endpoint, fileID, results); err != nil {
+				return nil, err
+			}
+		}
+	case openai.BatchStatusFailed:
+		msg := "batch failed"
+		if len(batch.Errors.Data) > 0 {
+			msg = batch.Errors.Data[0].Message
+		}
+		for i := range results {
+			results[i] = &ai.BatchResult{Error: msg}
+		}
+		return results, nil
+	default:
+		return nil, nil
+	}
+
+	for i, r := range results {
+		if r == nil {
+			results[i] = &ai.BatchResult{Error: fmt.Sprintf("no result in %s batch", batch.Status)}
+		}
+	}
+	return results, nil
+}
+
+// reads a batch output or error file into the given results
+func (s *service) readBatchFile(ctx context.Context, endpoint, fileID string, results []*ai.BatchResult) error {
+	var httpResp *http.Response
+
+	content, err := s.client.Files.Content(ctx, fileID, option.WithResponseInto(&httpResp))
+	if err != nil {
+		return s.error(err, httpResp, "", "")
+	}
+	defer content.Body.Close()
+
+	scanner := bufio.NewScanner(content.Body)
+	scanner.Buffer(nil, 64*1024*1024) // embedding responses are big
+
+	for scanner.Scan() {
+		line := &batchResponse{}
+		if err := json.Unmarshal(scanner.Bytes(), line); err != nil {
+			return fmt.Errorf("error reading batch file line: %w", err)
+		}
+
+		i, err := strconv.Atoi(line.CustomID)
+		if err != nil || i < 0 || i >= len(results) {
+			return fmt.Errorf("batch file has invalid custom ID '%s'", line.CustomID)
+		}
+
+		results[i] = batchResult(endpoint, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading batch file: %w", err)
+	}
+	return nil
+}
+
+// converts a line of a batch output or error file to a result
+func batchResult(endpoint string, line *batchResponse) *ai.BatchResult {
+	if line.Error != nil {
+		return &ai.BatchResult{Error: line.Error.Message}
+	}
+	if line.Response == nil {
+		return &ai.BatchResult{Error: "no response"}
+	}
+	if line.Response.StatusCode != http.StatusOK {
+		return &ai.BatchResult{Error: fmt.Sprintf("request failed with status %d", line.Response.StatusCode)}
+	}
+
+	if endpoint == string(openai.BatchNewParamsEndpointV1Embeddings) {
+		resp := &openai.CreateEmbeddingResponse{}
+		if err := json.Unmarshal(line.Response.Body, resp); err != nil {
+			return &ai.BatchResult{Error: fmt.Sprintf("error reading response: %s", err)}
+		}
+
+		vectors := make([][]float32, len(resp.Data))
+		for _, e := range resp.Data {
+			if e.Index < 0 || int(e.Index) >= len(vectors) {
+				return &ai.BatchResult{Error: fmt.Sprintf("embedding has invalid index %d", e.Index)}
+			}
+			vector := make([]float32, len(e.Embedding))
+			for j, v := range e.Embedding {
+				vector[j] = float32(v)
+			}
+			vectors[e.Index] = vector
+		}
+		return &ai.BatchResult{Vectors: vectors, TokensInput: resp.Usage.PromptTokens}
+	}
+
+	resp := &responses.Response{}
+	if err := json.Unmarshal(line.Response.Body, resp); err != nil {
+		return &ai.BatchResult{Error: fmt.Sprintf("error reading response: %s", err)}
+	}
+	return &ai.BatchResult{Output: strings.TrimSpace(resp.OutputText()), TokensInput: resp.Usage.InputTokens, TokensOutput: resp.Usage.OutputTokens}
+}
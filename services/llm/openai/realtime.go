@@ -0,0 +1,206 @@
+package openai
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+)
+
+const (
+	defaultRealtimeModel    = "gpt-4o-realtime-preview"
+	defaultRealtimeEndpoint = "https://api.openai.com/v1/"
+
+	realtimeEndTool = "end_call"
+)
+
+// tool the agent calls to end the conversation with its results
+var realtimeTools = []any{
+	map[string]any{
+		"type":        "function",
+		"name":        realtimeEndTool,
+		"description": "Ends the call once the conversation is complete or the caller wants to leave, with the results of the conversation.",
+		"parameters": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"results": map[string]any{
+					"type":                 "object",
+					"description":          "What was found out in the conversation as short text values, keyed by names like those in the instructions.",
+					"additionalProperties": map[string]any{"type": "string"},
+				},
+			},
+			"required": []any{"results"},
+		},
+	},
+}
+
+// Realtime starts a realtime session over a websocket, with the agent speaking first
+func (s *service) Realtime(ctx context.Context, cfg *ai.RealtimeConfig) (ai.RealtimeSession, error) {
+	wsURL, err := realtimeURL(s.endpoint, s.realtimeModel)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("OpenAI-Beta", "realtime=v1")
+	if s.apiKey != "" {
+		header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		if resp != nil {
+			return nil, &ai.ServiceError{Message: fmt.Sprintf("error connecting to realtime API: %s", resp.Status), Code: ai.ErrorCodeForStatus(resp.StatusCode), StatusCode: resp.StatusCode}
+		}
+		return nil, fmt.Errorf("error connecting to realtime API: %w", err)
+	}
+
+	sess := &realtimeSession{conn: conn}
+	context.AfterFunc(ctx, func() { conn.Close() })
+
+	update := map[string]any{
+		"type": "session.update",
+		"session": map[string]any{
+			"modalities":                []any{"audio", "text"},
+			"instructions":              cfg.Instructions,
+			"voice":                     cfg.Voice,
+			"input_audio_format":        "g711_ulaw",
+			"output_audio_format":       "g711_ulaw",
+			"input_audio_transcription": map[string]any{"model": s.transcriptionModel},
+			"turn_detection":            map[string]any{"type": "server_vad"},
+			"tools":                     realtimeTools,
+			"tool_choice":               "auto",
+		},
+	}
+	if err := sess.send(update); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := sess.send(map[string]any{"type": "response.create"}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// converts the HTTP endpoint of the API to the websocket URL of the realtime API for the given model
+func realtimeURL(endpoint, model string) (string, error) {
+	if endpoint == "" {
+		endpoint = defaultRealtimeEndpoint
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/") + "/realtime")
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint: %w", err)
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	u.RawQuery = url.Values{"model": []string{model}}.Encode()
+	return u.String(), nil
+}
+
+type realtimeSession struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+func (s *realtimeSession) SendAudio(ctx context.Context, audio []byte) error {
+	return s.send(map[string]any{"type": "input_audio_buffer.append", "audio": base64.StdEncoding.EncodeToString(audio)})
+}
+
+// server events that we care about, with the fields of all of them
+type realtimeServerEvent struct {
+	Type       string `json:"type"`
+	Delta      string `json:"delta"`
+	Transcript string `json:"transcript"`
+	Name       string `json:"name"`
+	Arguments  string `json:"arguments"`
+	Response   struct {
+		Usage struct {
+			InputTokens  int64 `json:"input_tokens"`
+			OutputTokens int64 `json:"output_tokens"`
+		} `json:"usage"`
+	} `json:"response"`
+	Error struct {
+		Message string `json:"message"`
+		Code    string `json:"code"`
+	} `json:"error"`
+}
+
+// Receive reads server events until there is one which is relevant to the caller of the session
+func (s *realtimeSession) Receive(ctx context.Context) (*ai.RealtimeEvent, error) {
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("error reading from realtime API: %w", err)
+		}
+
+		var e realtimeServerEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("error parsing realtime API event: %w", err)
+		}
+
+		switch e.Type {
+		case "response.audio.delta", "response.output_audio.delta":
+			audio, err := base64.StdEncoding.DecodeString(e.Delta)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding realtime audio: %w", err)
+			}
+			return &ai.RealtimeEvent{Type: ai.RealtimeEventAudio, Audio: audio}, nil
+
+		case "input_audio_buffer.speech_started":
+			return &ai.RealtimeEvent{Type: ai.RealtimeEventInterrupted}, nil
+
+		case "conversation.item.input_audio_transcription.completed":
+			return &ai.RealtimeEvent{Type: ai.RealtimeEventTranscript, Speaker: ai.RealtimeSpeakerCaller, Text: strings.TrimSpace(e.Transcript)}, nil
+
+		case "response.audio_transcript.done", "response.output_audio_transcript.done":
+			return &ai.RealtimeEvent{Type: ai.RealtimeEventTranscript, Speaker: ai.RealtimeSpeakerAgent, Text: strings.TrimSpace(e.Transcript)}, nil
+
+		case "response.done":
+			return &ai.RealtimeEvent{Type: ai.RealtimeEventUsage, TokensInput: e.Response.Usage.InputTokens, TokensOutput: e.Response.Usage.OutputTokens}, nil
+
+		case "response.function_call_arguments.done":
+			if e.Name != realtimeEndTool {
+				continue
+			}
+			var args struct {
+				Results map[string]string `json:"results"`
+			}
+			json.Unmarshal([]byte(e.Arguments), &args) // results are optional so bad arguments just means we don't have any
+			return &ai.RealtimeEvent{Type: ai.RealtimeEventEnded, Results: args.Results}, nil
+
+		case "error":
+			return nil, &ai.ServiceError{Message: e.Error.Message, Code: ai.ErrorCodeForType(e.Error.Code, 0)}
+		}
+	}
+}
+
+func (s *realtimeSession) Close() error {
+	return s.conn.Close()
+}
+
+func (s *realtimeSession) send(event map[string]any) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.conn.WriteJSON(event); err != nil {
+		return fmt.Errorf("error writing to realtime API: %w", err)
+	}
+	return nil
+}
@@ -2,17 +2,23 @@ package openai
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"path"
 	"strings"
 
+	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
 	"github.com/nyaruka/mailroom/v26/core/ai"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/runtime"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/packages/ssestream"
 	"github.com/openai/openai-go/responses"
 	"github.com/openai/openai-go/shared"
 )
@@ -21,23 +27,46 @@ const (
 	TypeOpenAI   = "openai"
 	TypeCustomAI = "custom_ai"
 
-	configAPIKey   = "api_key"
-	configEndpoint = "endpoint"
+	configAPIKey    = "api_key"
+	configEndpoint  = "endpoint"
+	configReasoning = "reasoning" // whether the model is a reasoning model, if that can't be known from its name
+
+	configTranscriptionModel = "transcription_model" // model used to transcribe audio (default whisper-1)
+	configSpeechModel        = "speech_model"        // model used to synthesize speech (default tts-1)
+	configEmbeddingModel     = "embedding_model"     // model used to embed text (default text-embedding-3-small)
+	configModerationModel    = "moderation_model"    // model used to moderate text (default omni-moderation-latest)
+	configRealtimeModel      = "realtime_model"      // model used for realtime voice sessions (default gpt-4o-realtime-preview)
+	configTranslationModel   = "translation_model"   // model used to translate messages (default same model)
 )
 
 func init() {
 	models.RegisterLLMService(TypeOpenAI, New)
 	models.RegisterLLMService(TypeCustomAI, New)
+
+	ai.RegisterDefaultEndpoint(TypeOpenAI, "https://api.openai.com/v1/")
 }
 
 // an LLM service implementation for OpenAI
 type service struct {
-	client openai.Client
-	model  string
+	client             openai.Client
+	http               *http.Client // for fetching attachments
+	apiKey             string       // for realtime sessions which use websockets rather than the client
+	endpoint           string
+	model              string
+	params             ai.Params
+	reasoning          bool // reasoning models reject sampling params
+	transcriptionModel string
+	speechModel        string
+	embeddingModel     string
+	moderationModel    string
+	realtimeModel      string
+	translationModel   string
 }
 
 func New(rt *runtime.Runtime, m *models.LLM, c *http.Client) (flows.LLMService, error) {
 	apiKey := m.Config().GetString(configAPIKey, "")
+	endpoint := m.Config().GetString(configEndpoint, ai.DefaultEndpoint(m.Type()))
+
 	if apiKey == "" {
 		return nil, fmt.Errorf("config incomplete for LLM: %s", m.UUID())
 	}
@@ -47,46 +76,336 @@ func New(rt *runtime.Runtime, m *models.LLM, c *http.Client) (flows.LLMService,
 		option.WithHTTPClient(c),
 	}
 
-	if endpoint := m.Config().GetString(configEndpoint, ""); endpoint != "" {
+	if endpoint != "" {
 		opts = append(opts, option.WithBaseURL(endpoint))
 	}
 
-	return &service{
-		client: openai.NewClient(opts...),
-		model:  m.Model(),
-	}, nil
+	return ai.NewLLMService(&service{
+		client:             openai.NewClient(opts...),
+		http:               c,
+		apiKey:             apiKey,
+		endpoint:           endpoint,
+		model:              m.Model(),
+		params:             m.Params(),
+		reasoning:          m.Config().GetBool(configReasoning, ai.IsReasoningModel(m.Model())),
+		transcriptionModel: m.Config().GetString(configTranscriptionModel, openai.AudioModelWhisper1),
+		speechModel:        m.Config().GetString(configSpeechModel, openai.SpeechModelTTS1),
+		embeddingModel:     m.Config().GetString(configEmbeddingModel, openai.EmbeddingModelTextEmbedding3Small),
+		moderationModel:    m.Config().GetString(configModerationModel, openai.ModerationModelOmniModerationLatest),
+		realtimeModel:      m.Config().GetString(configRealtimeModel, defaultRealtimeModel),
+		translationModel:   m.Config().GetString(configTranslationModel, m.Model()),
+	}), nil
 }
 
-func (s *service) Response(ctx context.Context, instructions, input string, maxTokens int) (*flows.LLMResponse, error) {
-	resp, err := s.client.Responses.New(ctx, responses.ResponseNewParams{
-		Model:        shared.ResponsesModel(s.model),
-		Instructions: openai.String(instructions),
-		Input: responses.ResponseNewParamsInputUnion{
-			OfString: openai.String(input),
-		},
-		Temperature:     openai.Float(0.000001),
-		MaxOutputTokens: openai.Int(int64(maxTokens)),
-	})
+// the capabilities of the OpenAI responses API, which are further limited by model
+var capabilities = ai.ServiceCapabilities{Streaming: true, Tools: true, Vision: true, Embeddings: true, JSONMode: true, JSONSchema: true}
+
+func (s *service) Capabilities() ai.ServiceCapabilities {
+	return ai.ModelCapabilities(s.model, capabilities)
+}
+
+var _ ai.StreamingService = (*service)(nil)
+var _ ai.TranscriptionService = (*service)(nil)
+var _ ai.SpeechService = (*service)(nil)
+var _ ai.EmbeddingService = (*service)(nil)
+var _ ai.Moderator = (*service)(nil)
+var _ ai.RealtimeService = (*service)(nil)
+var _ ai.TranslationService = (*service)(nil)
+
+func (s *service) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	timer := ai.NewTimer()
+	params, p := s.newParams(req)
+
+	var httpResp *http.Response
+
+	resp, err := s.client.Responses.New(timer.Trace(ctx), params, s.requestOptions(req, &httpResp)...)
 	if err != nil {
-		return nil, s.error(err, instructions, input)
+		return nil, s.error(err, httpResp, req.Instructions, req.Input)
+	}
+	if resp.IncompleteDetails.Reason == "content_filter" {
+		return nil, &ai.ServiceError{Message: "response blocked by content filter", Code: ai.ErrorContentFiltered, Instructions: req.Instructions, Input: req.Input}
 	}
 
-	return &flows.LLMResponse{
+	r := &ai.Response{
 		Output:       strings.TrimSpace(resp.OutputText()),
 		TokensInput:  resp.Usage.InputTokens,
 		TokensOutput: resp.Usage.OutputTokens,
-	}, nil
+		Timings:      timer.Timings(),
+		CachedTokens: int(resp.Usage.InputTokensDetails.CachedTokens),
+		CacheStatus:  ai.CacheStatusFor(resp.Usage.InputTokensDetails.CachedTokens, resp.Usage.InputTokens),
+
+		TokensReasoning: resp.Usage.OutputTokensDetails.ReasoningTokens,
+	}
+	for _, item := range resp.Output {
+		if item.Type == "function_call" {
+			call := item.AsFunctionCall()
+			r.ToolCalls = append(r.ToolCalls, &ai.ToolCall{ID: call.CallID, Name: call.Name, Arguments: json.RawMessage(call.Arguments)})
+		}
+	}
+	applied := p.Applied(s.model, req.MaxTokens)
+	r.RequestHash = ai.HashRequest(req, applied)
+	if req.Debug {
+		r.AppliedParams = applied
+	}
+	if ignored := s.ignoredParams(); len(ignored) > 0 {
+		r.Diagnostics = append(r.Diagnostics, fmt.Sprintf("ignored %s as not supported by the responses API", strings.Join(ignored, ", ")))
+	}
+	return r, nil
 }
 
-func (s *service) error(err error, instructions, input string) error {
-	code := ai.ErrorUnknown
-	if aerr, ok := errors.AsType[*responses.Error](err); ok {
-		switch aerr.StatusCode {
-		case http.StatusUnauthorized:
-			code = ai.ErrorCredentials
-		case http.StatusTooManyRequests:
-			code = ai.ErrorRateLimit
+// Stream makes a streaming request so that partial output can be forwarded as it arrives, e.g. to chat channels
+func (s *service) Stream(ctx context.Context, req *ai.Request) (*ai.Stream, error) {
+	timer := ai.NewTimer()
+	params, _ := s.newParams(req)
+
+	var httpResp *http.Response
+
+	stream := s.client.Responses.NewStreaming(timer.Trace(ctx), params, s.requestOptions(req, &httpResp)...)
+	if err := stream.Err(); err != nil {
+		return nil, s.error(err, httpResp, req.Instructions, req.Input)
+	}
+
+	return ai.NewStream(&streamSource{stream: stream}, timer, nil), nil
+}
+
+// Transcribe fetches the given audio attachment and transcribes it
+func (s *service) Transcribe(ctx context.Context, audio utils.Attachment) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, audio.URL(), nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request for audio: %w", err)
+	}
+	fetched, err := s.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error fetching audio: %w", err)
+	}
+	defer fetched.Body.Close()
+
+	if fetched.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error fetching audio: %s", fetched.Status)
+	}
+
+	var httpResp *http.Response
+
+	params := openai.AudioTranscriptionNewParams{
+		File:  openai.File(fetched.Body, path.Base(req.URL.Path), audio.ContentType()),
+		Model: openai.AudioModel(s.transcriptionModel),
+	}
+
+	// body can only be read once so we can't retry
+	resp, err := s.client.Audio.Transcriptions.New(ctx, params, option.WithResponseInto(&httpResp), option.WithMaxRetries(0))
+	if err != nil {
+		return "", s.error(err, httpResp, "", "")
+	}
+	return strings.TrimSpace(resp.Text), nil
+}
+
+// Translate translates the given text with the translation model, which can be a cheaper model than the one used for
+// everything else since translating messages doesn't need much reasoning
+func (s *service) Translate(ctx context.Context, text string, from, to i18n.Language) (*ai.Response, error) {
+	ts := *s
+	if s.translationModel != s.model {
+		ts.model = s.translationModel
+		ts.reasoning = ai.IsReasoningModel(s.translationModel)
+	}
+
+	return ts.Call(ctx, ai.NewTranslationRequest(text, from, to))
+}
+
+// Synthesize synthesizes speech from the given text as MP3 audio
+func (s *service) Synthesize(ctx context.Context, text, voice string) ([]byte, string, error) {
+	var httpResp *http.Response
+
+	params := openai.AudioSpeechNewParams{
+		Input:          text,
+		Model:          openai.SpeechModel(s.speechModel),
+		Voice:          openai.AudioSpeechNewParamsVoice(voice),
+		ResponseFormat: openai.AudioSpeechNewParamsResponseFormatMP3,
+	}
+
+	resp, err := s.client.Audio.Speech.New(ctx, params, option.WithResponseInto(&httpResp))
+	if err != nil {
+		return nil, "", s.error(err, httpResp, "", text)
+	}
+	defer resp.Body.Close()
+
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading speech audio: %w", err)
+	}
+	return audio, "audio/mpeg", nil
+}
+
+// Embed embeds the given inputs, returning a vector for each in the same order
+func (s *service) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	var httpResp *http.Response
+
+	params := openai.EmbeddingNewParams{
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: inputs},
+		Model: openai.EmbeddingModel(s.embeddingModel),
+	}
+
+	resp, err := s.client.Embeddings.New(ctx, params, option.WithResponseInto(&httpResp))
+	if err != nil {
+		return nil, s.error(err, httpResp, "", "")
+	}
+	if len(resp.Data) != len(inputs) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(inputs), len(resp.Data))
+	}
+
+	vectors := make([][]float32, len(inputs))
+	for _, e := range resp.Data {
+		if e.Index < 0 || int(e.Index) >= len(inputs) {
+			return nil, fmt.Errorf("embedding has invalid index %d", e.Index)
 		}
+		vector := make([]float32, len(e.Embedding))
+		for i, v := range e.Embedding {
+			vector[i] = float32(v)
+		}
+		vectors[e.Index] = vector
+	}
+	return vectors, nil
+}
+
+// gets the names of any configured params which the responses API doesn't support so aren't sent
+func (s *service) ignoredParams() []string {
+	var ignored []string
+	if s.params.Seed != nil {
+		ignored = append(ignored, "seed")
+	}
+	if s.params.FrequencyPenalty != nil {
+		ignored = append(ignored, "frequency_penalty")
+	}
+	if s.params.PresencePenalty != nil {
+		ignored = append(ignored, "presence_penalty")
+	}
+	return ignored
+}
+
+// builds the params for the given request, returning them along with the effective generation params
+func (s *service) newParams(req *ai.Request) (responses.ResponseNewParams, ai.Params) {
+	p := ai.Params{Temperature: new(ai.DefaultTemperature)}.Override(s.params)
+	p.Seed, p.FrequencyPenalty, p.PresencePenalty = nil, nil, nil // not supported by the responses API, see ignoredParams
+	if s.reasoning {
+		p.Temperature, p.TopP = nil, nil
+	}
+
+	params := responses.ResponseNewParams{
+		Model:        shared.ResponsesModel(s.model),
+		Instructions: openai.String(req.Instructions),
+		Input: responses.ResponseNewParamsInputUnion{
+			OfString: openai.String(req.Input),
+		},
+		MaxOutputTokens: openai.Int(int64(req.MaxTokens)), // includes reasoning tokens
+	}
+	if p.Temperature != nil {
+		params.Temperature = openai.Float(*p.Temperature)
+	}
+	if images := req.Images(); len(images) > 0 || len(req.History) > 0 {
+		var items responses.ResponseInputParam
+		for _, t := range req.History {
+			items = append(items, textMessage(responses.EasyInputMessageRoleUser, t.Input), textMessage(responses.EasyInputMessageRoleAssistant, t.Output))
+		}
+
+		content := responses.ResponseInputMessageContentListParam{{OfInputText: &responses.ResponseInputTextParam{Text: req.Input}}}
+		for _, url := range images {
+			content = append(content, responses.ResponseInputContentUnionParam{
+				OfInputImage: &responses.ResponseInputImageParam{ImageURL: openai.String(url), Detail: responses.ResponseInputImageDetailAuto},
+			})
+		}
+		items = append(items, responses.ResponseInputItemUnionParam{
+			OfMessage: &responses.EasyInputMessageParam{
+				Role:    responses.EasyInputMessageRoleUser,
+				Content: responses.EasyInputMessageContentUnionParam{OfInputItemContentList: content},
+			},
+		})
+
+		params.Input = responses.ResponseNewParamsInputUnion{OfInputItemList: items}
+	}
+	if p.TopP != nil {
+		params.TopP = openai.Float(*p.TopP)
+	}
+	if req.Schema != nil {
+		params.Text.Format.OfJSONSchema = &responses.ResponseFormatTextJSONSchemaConfigParam{Name: "output", Schema: req.Schema, Strict: openai.Bool(false)}
+	} else if p.JSONMode != nil && *p.JSONMode {
+		params.Text.Format.OfJSONObject = &shared.ResponseFormatJSONObjectParam{}
+	}
+	for _, t := range req.Tools {
+		tool := &responses.FunctionToolParam{Name: t.Name, Parameters: t.Parameters, Strict: openai.Bool(false)}
+		if t.Description != "" {
+			tool.Description = openai.String(t.Description)
+		}
+		params.Tools = append(params.Tools, responses.ToolUnionParam{OfFunction: tool})
+	}
+	return params, p
+}
+
+func textMessage(role responses.EasyInputMessageRole, text string) responses.ResponseInputItemUnionParam {
+	return responses.ResponseInputItemUnionParam{
+		OfMessage: &responses.EasyInputMessageParam{Role: role, Content: responses.EasyInputMessageContentUnionParam{OfString: openai.String(text)}},
+	}
+}
+
+func (s *service) requestOptions(req *ai.Request, httpResp **http.Response) []option.RequestOption {
+	opts := []option.RequestOption{option.WithResponseInto(httpResp), option.WithMaxRetries(0)} // retries are ours to make
+	if req.IdempotencyKey != "" {
+		opts = append(opts, option.WithHeader("Idempotency-Key", req.IdempotencyKey))
+	}
+	return opts
+}
+
+// adapts a stream of OpenAI response events
+type streamSource struct {
+	stream *ssestream.Stream[responses.ResponseStreamEventUnion]
+}
+
+func (s *streamSource) Next() bool   { return s.stream.Next() }
+func (s *streamSource) Err() error   { return s.stream.Err() }
+func (s *streamSource) Close() error { return s.stream.Close() }
+
+func (s *streamSource) Current() ai.StreamEvent {
+	e := s.stream.Current()
+
+	switch e.Type {
+	case "response.output_text.delta":
+		return ai.StreamEvent{Delta: e.Delta.OfString}
+	case "response.completed":
+		return ai.StreamEvent{Usage: &ai.Usage{TokensInput: e.Response.Usage.InputTokens, TokensOutput: e.Response.Usage.OutputTokens}}
+	}
+	return ai.StreamEvent{}
+}
+
+// Moderate classifies the given text with the moderation endpoint, returning whether it's flagged
+func (s *service) Moderate(ctx context.Context, text string) (bool, error) {
+	var httpResp *http.Response
+
+	params := openai.ModerationNewParams{
+		Input: openai.ModerationNewParamsInputUnion{OfString: openai.String(text)},
+		Model: openai.ModerationModel(s.moderationModel),
+	}
+
+	resp, err := s.client.Moderations.New(ctx, params, option.WithResponseInto(&httpResp))
+	if err != nil {
+		return false, s.error(err, httpResp, "", text)
+	}
+
+	for _, r := range resp.Results {
+		if r.Flagged {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *service) error(err error, resp *http.Response, instructions, input string) error {
+	// gateways in front of the provider may return error bodies that aren't the JSON the SDK expects
+	if rerr := ai.NewRawResponseError(resp, instructions, input); rerr != nil {
+		return rerr
+	}
+
+	code, status := ai.ErrorUnknown, 0
+	if aerr, ok := errors.AsType[*responses.Error](err); ok {
+		code = ai.ErrorCodeForType(aerr.Code, aerr.StatusCode)
+		status = aerr.StatusCode
 	}
-	return &ai.ServiceError{Message: err.Error(), Code: code, Instructions: instructions, Input: input}
+	return &ai.ServiceError{Message: err.Error(), Code: code, StatusCode: status, RetryAfter: ai.ParseRetryAfter(resp), Instructions: instructions, Input: input}
 }
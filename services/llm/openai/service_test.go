@@ -1,34 +1,56 @@
 package openai_test
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/buger/jsonparser"
+	"github.com/gorilla/websocket"
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/goflow/test"
+	"github.com/nyaruka/goflow/utils"
 	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/services/llm/openai"
 	"github.com/nyaruka/mailroom/v26/testsuite"
 	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func TestDefaultEndpoint(t *testing.T) {
+	assert.Equal(t, "https://api.openai.com/v1/", ai.DefaultEndpoint("openai"))
+}
+
 func TestService(t *testing.T) {
 	ctx, rt := testsuite.Runtime(t)
 
 	defer testsuite.Reset(t, rt, testsuite.ResetData)
 
 	bad := testdb.InsertLLM(t, rt, testdb.Org1, "c69723d8-fb37-4cf6-9ec4-bc40cb36f2cc", "openai", "gpt-4", "Bad Config", map[string]any{}, "TF")
-	good := testdb.InsertLLM(t, rt, testdb.Org1, "b86966fd-206e-4bdd-a962-06faa3af1182", "openai", "gpt-4", "Good", map[string]any{"api_key": "sesame"}, "TF")
+	good := testdb.InsertLLM(t, rt, testdb.Org1, "b86966fd-206e-4bdd-a962-06faa3af1182", "openai", "gpt-4", "Good", map[string]any{"api_key": "sesame", "debug_params": true}, "TF")
+
+	custom := testdb.InsertLLM(t, rt, testdb.Org1, "1b8c3d5e-7f0a-4b2c-9d4e-6f8a0b2c4d6e", "openai", "gpt-4", "Custom Endpoint", map[string]any{"api_key": "sesame", "endpoint": "https://openai.example.com/v1/"}, "TF")
 
 	oa := testdb.Org1.Load(t, rt)
 	badLLM := oa.LLMByID(bad.ID)
 	goodLLM := oa.LLMByID(good.ID)
+	customLLM := oa.LLMByID(custom.ID)
 
 	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://openai.example.com/v1/responses": {
+			httpx.NewMockResponse(401, map[string]string{"Content-type": "application/json"}, []byte(`{"message": "Incorrect API key provided", "type": "invalid_request_error", "param": null, "code": "invalid_api_key"}`)),
+		},
 		"https://api.openai.com/v1/responses": {
 			httpx.NewMockResponse(401, map[string]string{"Content-type": "application/json"}, []byte(`{"message": "Incorrect API key provided", "type": "invalid_request_error", "param": null, "code": "invalid_api_key"}`)),
 			httpx.NewMockResponse(429, map[string]string{"Content-type": "application/json"}, []byte(`{"message": "Rate limit reached for your model", "type": "requests", "param": null, "code": "rate_limit_exceeded"}`)),
-			httpx.NewMockResponse(429, map[string]string{"Content-type": "application/json"}, []byte(`{"message": "Rate limit reached for your model", "type": "requests", "param": null, "code": "rate_limit_exceeded"}`)),
+			httpx.NewMockResponse(502, map[string]string{"Content-type": "text/html"}, []byte(`<html><head><title>502 Bad Gateway</title></head><body><h1>502 Bad Gateway</h1></body></html>`)),
 			httpx.NewMockResponse(429, map[string]string{"Content-type": "application/json"}, []byte(`{"message": "Rate limit reached for your model", "type": "requests", "param": null, "code": "rate_limit_exceeded"}`)),
 			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
 				"id": "resp_67ccd2bed1ec8190b14f964abc0542670bb6a6b452d3795b", 
@@ -109,9 +131,627 @@ func TestService(t *testing.T) {
 	}
 	assert.Nil(t, resp)
 
+	// gateway in front of the provider returns an HTML error page
 	resp, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.EqualError(t, err, "502 Bad Gateway: <html><head><title>502 Bad Gateway</title></head><body><h1>502 Bad Gateway</h1></body></html>")
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorUnknown, serr.Code)
+		assert.Equal(t, 502, serr.StatusCode)
+	}
+	assert.Nil(t, resp)
+
+	dates.SetNowFunc(dates.NewSequentialNow(time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC), time.Second))
+	defer dates.SetNowFunc(time.Now)
+
+	// calls which aren't idempotent aren't retried
+	_, err = svc.(ai.Service).Call(ctx, &ai.Request{Instructions: "translate to Spanish", Input: "Hello world", MaxTokens: 1000, Idempotent: false})
+	assert.EqualError(t, err, "POST \"https://api.openai.com/v1/responses\": 429 Too Many Requests ")
+
+	// configured endpoint overrides the default
+	svc, err = openai.New(rt, customLLM, client)
 	assert.NoError(t, err)
+
+	_, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.EqualError(t, err, "POST \"https://openai.example.com/v1/responses\": 401 Unauthorized ")
+
+	// call via the wrapped service so that max tokens are clamped to the model's limit
+	wrapped, err := goodLLM.AsService(rt, client)
+	assert.NoError(t, err)
+
+	xresp, err := wrapped.(ai.Service).Call(ctx, &ai.Request{Instructions: "translate to Spanish", Input: "Hello world", MaxTokens: 10000})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hola mundo", xresp.Output)
+	assert.Equal(t, int64(36), xresp.TokensInput)
+	assert.Equal(t, int64(87), xresp.TokensOutput)
+	assert.Equal(t, ai.Timings{Total: time.Second}, xresp.Timings)
+	assert.Equal(t, 0, xresp.CachedTokens)
+	assert.Equal(t, ai.CacheMiss, xresp.CacheStatus)
+	assert.Equal(t, ai.HashRequest(&ai.Request{Instructions: "translate to Spanish", Input: "Hello world", MaxTokens: 8192}, xresp.AppliedParams), xresp.RequestHash)
+	assert.Equal(t, map[string]any{"model": "gpt-4", "max_tokens": 8192, "temperature": 0.000001}, xresp.AppliedParams)
+}
+
+func TestCapabilities(t *testing.T) {
+	capabilities := func(model string) ai.ServiceCapabilities {
+		svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: model, Config_: map[string]any{"api_key": "sesame"}}, http.DefaultClient)
+		require.NoError(t, err)
+		return svc.(ai.CapableService).Capabilities()
+	}
+
+	assert.Equal(t, ai.ServiceCapabilities{Streaming: true, Tools: true, Vision: true, Embeddings: true, JSONMode: true, JSONSchema: true}, capabilities("gpt-4o"))
+	assert.Equal(t, ai.ServiceCapabilities{Streaming: true, Tools: true, Embeddings: true, JSONMode: true, JSONSchema: true}, capabilities("o3-mini-2025-01-31"))
+	assert.Equal(t, ai.ServiceCapabilities{Streaming: true, Tools: true, Embeddings: true, JSONMode: true}, capabilities("gpt-3.5-turbo"))
+	assert.Equal(t, ai.ServiceCapabilities{Streaming: true, Embeddings: true, JSONMode: true}, capabilities("my-custom-model"))
+}
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+
+	events := []string{
+		`{"type": "response.created", "sequence_number": 0, "response": {"id": "resp_1", "status": "in_progress"}}`,
+		`{"type": "response.output_text.delta", "sequence_number": 1, "item_id": "msg_1", "output_index": 0, "content_index": 0, "delta": "Hola"}`,
+		`{"type": "response.output_text.delta", "sequence_number": 2, "item_id": "msg_1", "output_index": 0, "content_index": 0, "delta": " mundo"}`,
+		`{"type": "response.output_text.done", "sequence_number": 3, "item_id": "msg_1", "output_index": 0, "content_index": 0, "text": "Hola mundo"}`,
+		`{"type": "response.completed", "sequence_number": 4, "response": {"id": "resp_1", "status": "completed", "usage": {"input_tokens": 36, "output_tokens": 2, "total_tokens": 38}}}`,
+	}
+	var body strings.Builder
+	for _, e := range events {
+		body.WriteString("data: " + e + "\n\n")
+	}
+
+	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/responses": {
+			httpx.NewMockResponse(401, map[string]string{"Content-type": "application/json"}, []byte(`{"message": "Incorrect API key provided", "type": "invalid_request_error", "param": null, "code": "invalid_api_key"}`)),
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "text/event-stream"}, []byte(body.String())),
+		},
+	})
+
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame"}}, client)
+	require.NoError(t, err)
+	assert.True(t, svc.(ai.CapableService).Capabilities().Streaming)
+
+	_, err = svc.(ai.StreamingService).Stream(ctx, &ai.Request{Instructions: "translate to Spanish", Input: "Hello world", MaxTokens: 1000})
+	assert.EqualError(t, err, "POST \"https://api.openai.com/v1/responses\": 401 Unauthorized ")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorCredentials, serr.Code)
+	}
+
+	stream, err := svc.(ai.StreamingService).Stream(ctx, &ai.Request{Instructions: "translate to Spanish", Input: "Hello world", MaxTokens: 1000})
+	require.NoError(t, err)
+
+	var chunks []string
+	for stream.Next() {
+		chunks = append(chunks, stream.Chunk())
+	}
+	assert.NoError(t, stream.Err())
+	assert.NoError(t, stream.Close())
+
+	assert.Equal(t, []string{"Hola", " mundo"}, chunks)
+	resp := stream.Response()
 	assert.Equal(t, "Hola mundo", resp.Output)
 	assert.Equal(t, int64(36), resp.TokensInput)
-	assert.Equal(t, int64(87), resp.TokensOutput)
+	assert.Equal(t, int64(2), resp.TokensOutput)
+}
+
+func TestTools(t *testing.T) {
+	ctx := context.Background()
+
+	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/responses": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "resp_1",
+				"object": "response",
+				"status": "completed",
+				"model": "gpt-4o",
+				"output": [
+					{
+						"type": "function_call",
+						"id": "fc_1",
+						"call_id": "call_123",
+						"name": "lookup_field",
+						"arguments": "{\"field\":\"age\"}",
+						"status": "completed"
+					}
+				],
+				"usage": {"input_tokens": 52, "output_tokens": 14, "total_tokens": 66}
+			}`)),
+		},
+	})
+
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame"}}, client)
+	require.NoError(t, err)
+
+	resp, err := svc.(*ai.LLMService).Call(ctx, &ai.Request{
+		Instructions: "answer questions about the contact",
+		Input:        "How old am I?",
+		MaxTokens:    1000,
+		Tools: []*ai.Tool{{
+			Name:        "lookup_field",
+			Description: "Looks up a contact field",
+			Parameters:  map[string]any{"type": "object", "properties": map[string]any{"field": map[string]any{"type": "string"}}},
+		}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "", resp.Output)
+	assert.Equal(t, []*ai.ToolCall{{ID: "call_123", Name: "lookup_field", Arguments: []byte(`{"field":"age"}`)}}, resp.ToolCalls)
+	assert.Equal(t, int64(52), resp.TokensInput)
+	assert.Equal(t, int64(14), resp.TokensOutput)
+}
+
+func TestImages(t *testing.T) {
+	ctx := context.Background()
+
+	client, mocks := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/responses": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "resp_1",
+				"object": "response",
+				"status": "completed",
+				"model": "gpt-4o",
+				"output": [{"type": "message", "id": "msg_1", "role": "assistant", "status": "completed", "content": [{"type": "output_text", "text": "A cat", "annotations": []}]}],
+				"usage": {"input_tokens": 850, "output_tokens": 2, "total_tokens": 852}
+			}`)),
+		},
+	})
+
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame"}}, client)
+	require.NoError(t, err)
+
+	resp, err := svc.(*ai.LLMService).Call(ctx, &ai.Request{
+		Instructions: "describe the photo",
+		Input:        "What is this?",
+		MaxTokens:    1000,
+		Attachments:  []utils.Attachment{"image/jpeg:https://example.com/cat.jpg", "audio/mp4:https://example.com/meow.m4a"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "A cat", resp.Output)
+
+	body, err := mocks.Requests()[0].GetBody()
+	require.NoError(t, err)
+	sent, err := io.ReadAll(body)
+	require.NoError(t, err)
+	input, _, _, err := jsonparser.Get(sent, "input")
+	require.NoError(t, err)
+
+	// non-image attachments are ignored
+	assert.JSONEq(t, `[{"role": "user", "content": [
+		{"type": "input_text", "text": "What is this?"},
+		{"type": "input_image", "image_url": "https://example.com/cat.jpg", "detail": "auto"}
+	]}]`, string(input))
+}
+
+func TestResponseJSON(t *testing.T) {
+	ctx := context.Background()
+
+	client, mocks := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/responses": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "resp_1",
+				"object": "response",
+				"status": "completed",
+				"model": "gpt-4o",
+				"output": [{"type": "message", "id": "msg_1", "role": "assistant", "status": "completed", "content": [{"type": "output_text", "text": "{\"age\": 34}", "annotations": []}]}],
+				"usage": {"input_tokens": 30, "output_tokens": 6, "total_tokens": 36}
+			}`)),
+		},
+	})
+
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame"}}, client)
+	require.NoError(t, err)
+
+	schema := map[string]any{"type": "object", "properties": map[string]any{"age": map[string]any{"type": "integer"}}, "required": []any{"age"}}
+
+	resp, err := svc.(*ai.LLMService).ResponseJSON(ctx, "extract the age", "Bob is 34", schema, 100)
+	require.NoError(t, err)
+	assert.Equal(t, `{"age": 34}`, resp.Output)
+
+	body, err := mocks.Requests()[0].GetBody()
+	require.NoError(t, err)
+	sent, err := io.ReadAll(body)
+	require.NoError(t, err)
+	format, _, _, err := jsonparser.Get(sent, "text", "format")
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"type": "json_schema", "name": "output", "strict": false, "schema": {"type": "object", "properties": {"age": {"type": "integer"}}, "required": ["age"]}}`, string(format))
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+
+	client, mocks := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/responses": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "resp_1",
+				"object": "response",
+				"status": "completed",
+				"model": "gpt-4o",
+				"output": [{"type": "message", "id": "msg_1", "role": "assistant", "status": "completed", "content": [{"type": "output_text", "text": "Bob", "annotations": []}]}],
+				"usage": {"input_tokens": 30, "output_tokens": 1, "total_tokens": 31}
+			}`)),
+		},
+	})
+
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame"}}, client)
+	require.NoError(t, err)
+
+	history := []*ai.Turn{{Input: "I'm Bob", Output: "Hi Bob"}}
+
+	resp, err := svc.(*ai.LLMService).Call(ctx, &ai.Request{Instructions: "chat", Input: "What's my name?", History: history, MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "Bob", resp.Output)
+
+	body, err := mocks.Requests()[0].GetBody()
+	require.NoError(t, err)
+	sent, err := io.ReadAll(body)
+	require.NoError(t, err)
+	input, _, _, err := jsonparser.Get(sent, "input")
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `[
+		{"role": "user", "content": "I'm Bob"},
+		{"role": "assistant", "content": "Hi Bob"},
+		{"role": "user", "content": [{"type": "input_text", "text": "What's my name?"}]}
+	]`, string(input))
+}
+
+func TestReasoning(t *testing.T) {
+	ctx := context.Background()
+
+	reply := httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+		"id": "resp_1",
+		"object": "response",
+		"status": "completed",
+		"model": "o3-mini",
+		"output": [{"type": "message", "id": "msg_1", "role": "assistant", "status": "completed", "content": [{"type": "output_text", "text": "42", "annotations": []}]}],
+		"usage": {"input_tokens": 30, "output_tokens": 250, "output_tokens_details": {"reasoning_tokens": 240}, "total_tokens": 280}
+	}`))
+
+	client, mocks := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/responses": {reply, reply},
+	})
+
+	sentParams := func(i int) []byte {
+		body, err := mocks.Requests()[i].GetBody()
+		require.NoError(t, err)
+		sent, err := io.ReadAll(body)
+		require.NoError(t, err)
+		return sent
+	}
+
+	// reasoning models are detected from their names and aren't sent sampling params
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "o3-mini", Config_: map[string]any{"api_key": "sesame", "temperature": 0.5}}, client)
+	require.NoError(t, err)
+
+	resp, err := svc.(*ai.LLMService).Call(ctx, &ai.Request{Instructions: "answer", Input: "what is 6 x 7?", MaxTokens: 1000, Debug: true})
+	require.NoError(t, err)
+	assert.Equal(t, "42", resp.Output)
+	assert.Equal(t, int64(250), resp.TokensOutput)
+	assert.Equal(t, int64(240), resp.TokensReasoning)
+	assert.Equal(t, map[string]any{"model": "o3-mini", "max_tokens": 1000}, resp.AppliedParams)
+
+	_, _, _, err = jsonparser.Get(sentParams(0), "temperature")
+	assert.ErrorIs(t, err, jsonparser.KeyPathNotFoundError)
+
+	// or can be configured as such
+	svc, err = openai.New(nil, &models.LLM{Type_: "openai", Model_: "my-reasoner", Config_: map[string]any{"api_key": "sesame", "reasoning": true}}, client)
+	require.NoError(t, err)
+
+	_, err = svc.Response(ctx, "answer", "what is 6 x 7?", 1000)
+	require.NoError(t, err)
+
+	_, _, _, err = jsonparser.Get(sentParams(1), "temperature")
+	assert.ErrorIs(t, err, jsonparser.KeyPathNotFoundError)
+}
+
+func TestUnsupportedParams(t *testing.T) {
+	ctx := context.Background()
+
+	reply := httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+		"id": "resp_1",
+		"object": "response",
+		"status": "completed",
+		"model": "gpt-4o",
+		"output": [{"type": "message", "id": "msg_1", "role": "assistant", "status": "completed", "content": [{"type": "output_text", "text": "Hola", "annotations": []}]}],
+		"usage": {"input_tokens": 10, "output_tokens": 2, "total_tokens": 12}
+	}`))
+
+	client, mocks := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/responses": {reply, reply},
+	})
+
+	// seed and penalties aren't supported by the responses API so aren't sent, but we note that they were ignored
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame", "seed": 42, "presence_penalty": 0.5}}, client)
+	require.NoError(t, err)
+
+	resp, err := svc.(*ai.LLMService).Call(ctx, &ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100, Debug: true})
+	require.NoError(t, err)
+	assert.Equal(t, "Hola", resp.Output)
+	assert.Equal(t, map[string]any{"model": "gpt-4o", "max_tokens": 100, "temperature": 0.000001}, resp.AppliedParams)
+	assert.Equal(t, []string{"ignored seed, presence_penalty as not supported by the responses API"}, resp.Diagnostics)
+
+	body, err := mocks.Requests()[0].GetBody()
+	require.NoError(t, err)
+	sent, err := io.ReadAll(body)
+	require.NoError(t, err)
+
+	_, _, _, err = jsonparser.Get(sent, "seed")
+	assert.ErrorIs(t, err, jsonparser.KeyPathNotFoundError)
+
+	// no diagnostics if there's nothing to ignore
+	svc, err = openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame"}}, client)
+	require.NoError(t, err)
+
+	resp, err = svc.(*ai.LLMService).Call(ctx, &ai.Request{Instructions: "translate to Spanish", Input: "Hello", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Nil(t, resp.Diagnostics)
+}
+
+func TestTranscribe(t *testing.T) {
+	ctx := context.Background()
+
+	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://example.com/note.m4a": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "audio/mp4"}, []byte(`...audio...`)),
+			httpx.NewMockResponse(404, nil, []byte(`not found`)),
+		},
+		"https://api.openai.com/v1/audio/transcriptions": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{"text": " I'd like to book an appointment. "}`)),
+		},
+	})
+
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame"}}, client)
+	require.NoError(t, err)
+
+	text, err := svc.(ai.TranscriptionService).Transcribe(ctx, "audio/mp4:https://example.com/note.m4a")
+	assert.NoError(t, err)
+	assert.Equal(t, "I'd like to book an appointment.", text)
+
+	_, err = svc.(ai.TranscriptionService).Transcribe(ctx, "audio/mp4:https://example.com/note.m4a")
+	assert.EqualError(t, err, "error fetching audio: 404 Not Found")
+}
+
+func TestTranslate(t *testing.T) {
+	ctx := context.Background()
+
+	reply := httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+		"id": "resp_1",
+		"object": "response",
+		"status": "completed",
+		"model": "gpt-4o-mini",
+		"output": [{"type": "message", "id": "msg_1", "role": "assistant", "status": "completed", "content": [{"type": "output_text", "text": "Hola, ¿cómo estás?", "annotations": []}]}],
+		"usage": {"input_tokens": 60, "output_tokens": 8, "total_tokens": 68}
+	}`))
+
+	client, mocks := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/responses": {reply},
+	})
+
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame", "translation_model": "gpt-4o-mini"}}, client)
+	require.NoError(t, err)
+
+	resp, err := svc.(ai.TranslationService).Translate(ctx, "Hi, how are you?", "eng", "spa")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hola, ¿cómo estás?", resp.Output)
+	assert.Equal(t, int64(60), resp.TokensInput)
+
+	// translations are made with the translation model
+	body, err := mocks.Requests()[0].GetBody()
+	require.NoError(t, err)
+	sent, err := io.ReadAll(body)
+	require.NoError(t, err)
+
+	model, err := jsonparser.GetString(sent, "model")
+	assert.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", model)
+}
+
+func TestSynthesize(t *testing.T) {
+	ctx := context.Background()
+
+	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/audio/speech": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "audio/mpeg"}, []byte(`...audio...`)),
+			httpx.NewMockResponse(401, map[string]string{"Content-type": "application/json"}, []byte(`{"message": "Incorrect API key provided", "type": "invalid_request_error", "param": null, "code": "invalid_api_key"}`)),
+		},
+	})
+
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame"}}, client)
+	require.NoError(t, err)
+
+	audio, contentType, err := svc.(ai.SpeechService).Synthesize(ctx, "Welcome to the survey", "alloy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`...audio...`), audio)
+	assert.Equal(t, "audio/mpeg", contentType)
+
+	_, _, err = svc.(ai.SpeechService).Synthesize(ctx, "Welcome to the survey", "alloy")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorCredentials, serr.Code)
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	ctx := context.Background()
+
+	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/embeddings": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"object": "list",
+				"model": "text-embedding-3-small",
+				"data": [
+					{"object": "embedding", "index": 1, "embedding": [0.5, -0.25]},
+					{"object": "embedding", "index": 0, "embedding": [0.125, 1.0]}
+				],
+				"usage": {"prompt_tokens": 8, "total_tokens": 8}
+			}`)),
+		},
+	})
+
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame"}}, client)
+	require.NoError(t, err)
+
+	vectors, err := svc.(ai.EmbeddingService).Embed(ctx, []string{"Opening hours", "Parking"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]float32{{0.125, 1.0}, {0.5, -0.25}}, vectors)
+}
+
+func TestModerate(t *testing.T) {
+	ctx := context.Background()
+
+	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/moderations": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "modr-123",
+				"model": "omni-moderation-latest",
+				"results": [{"flagged": false, "categories": {}, "category_scores": {}, "category_applied_input_types": {}}]
+			}`)),
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "modr-456",
+				"model": "omni-moderation-latest",
+				"results": [{"flagged": true, "categories": {"violence": true}, "category_scores": {}, "category_applied_input_types": {}}]
+			}`)),
+			httpx.NewMockResponse(401, map[string]string{"Content-type": "application/json"}, []byte(`{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error", "code": "invalid_api_key"}}`)),
+		},
+	})
+
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame"}}, client)
+	require.NoError(t, err)
+
+	flagged, err := svc.(ai.Moderator).Moderate(ctx, "The clinic opens at 9am")
+	assert.NoError(t, err)
+	assert.False(t, flagged)
+
+	flagged, err = svc.(ai.Moderator).Moderate(ctx, "Something violent")
+	assert.NoError(t, err)
+	assert.True(t, flagged)
+
+	_, err = svc.(ai.Moderator).Moderate(ctx, "Hello")
+	var serr *ai.ServiceError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorCredentials, serr.Code)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+
+	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/files": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{"id": "file-in", "object": "file", "bytes": 100, "created_at": 1741476542, "filename": "batch.jsonl", "purpose": "batch"}`)),
+		},
+		"https://api.openai.com/v1/batches": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{"id": "batch_123", "object": "batch", "endpoint": "/v1/responses", "input_file_id": "file-in", "completion_window": "24h", "status": "validating", "created_at": 1741476542}`)),
+		},
+		"https://api.openai.com/v1/batches/batch_123": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{"id": "batch_123", "object": "batch", "endpoint": "/v1/responses", "input_file_id": "file-in", "completion_window": "24h", "status": "in_progress", "created_at": 1741476542, "request_counts": {"total": 3, "completed": 0, "failed": 0}}`)),
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{"id": "batch_123", "object": "batch", "endpoint": "/v1/responses", "input_file_id": "file-in", "output_file_id": "file-out", "error_file_id": "file-err", "completion_window": "24h", "status": "completed", "created_at": 1741476542, "request_counts": {"total": 3, "completed": 1, "failed": 1}}`)),
+		},
+		"https://api.openai.com/v1/files/file-out/content": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/binary"}, []byte(`{"id": "batch_req_1", "custom_id": "1", "response": {"status_code": 200, "body": {"id": "resp_1", "object": "response", "status": "completed", "output": [{"type": "message", "id": "msg_1", "status": "completed", "role": "assistant", "content": [{"type": "output_text", "text": "Question", "annotations": []}]}], "usage": {"input_tokens": 20, "output_tokens": 2}}}, "error": null}
+`)),
+		},
+		"https://api.openai.com/v1/files/file-err/content": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/binary"}, []byte(`{"id": "batch_req_0", "custom_id": "0", "response": null, "error": {"code": "invalid_request", "message": "Input is too long"}}
+`)),
+		},
+	})
+
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame"}}, client)
+	require.NoError(t, err)
+
+	bs := svc.(ai.BatchService)
+
+	id, err := bs.SubmitBatch(ctx, []*ai.Request{{Instructions: "Categorize", Input: "Hello"}, {Instructions: "Categorize", Input: "Where?"}, {Instructions: "Categorize", Input: "Bye"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "batch_123", id)
+
+	// batch still in progress
+	results, err := bs.CollectBatch(ctx, id)
+	assert.NoError(t, err)
+	assert.Nil(t, results)
+
+	results, err = bs.CollectBatch(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ai.BatchResult{
+		{Error: "Input is too long"},
+		{Output: "Question", TokensInput: 20, TokensOutput: 2},
+		{Error: "no result in completed batch"},
+	}, results)
+}
+
+func TestRealtime(t *testing.T) {
+	ctx := context.Background()
+
+	var received []map[string]any
+	var header http.Header
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		assert.Equal(t, "/v1/realtime", r.URL.Path)
+		assert.Equal(t, "gpt-4o-realtime-preview", r.URL.Query().Get("model"))
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// read session update, response create and one audio append
+		for range 3 {
+			var e map[string]any
+			require.NoError(t, conn.ReadJSON(&e))
+			received = append(received, e)
+		}
+
+		for _, e := range []string{
+			`{"type": "session.updated"}`,
+			`{"type": "response.audio.delta", "delta": "AQID"}`,
+			`{"type": "input_audio_buffer.speech_started"}`,
+			`{"type": "conversation.item.input_audio_transcription.completed", "transcript": " I'm 34 "}`,
+			`{"type": "response.audio_transcript.done", "transcript": "Thanks, goodbye!"}`,
+			`{"type": "response.done", "response": {"usage": {"input_tokens": 120, "output_tokens": 45}}}`,
+			`{"type": "response.function_call_arguments.done", "name": "other_tool", "arguments": "{}"}`,
+			`{"type": "response.function_call_arguments.done", "name": "end_call", "arguments": "{\"results\": {\"age\": \"34\"}}"}`,
+			`{"type": "error", "error": {"type": "invalid_request_error", "code": "invalid_value", "message": "Invalid value"}}`,
+		} {
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(e)))
+		}
+		conn.ReadMessage() // wait for client to close
+	}))
+	defer server.Close()
+
+	svc, err := openai.New(nil, &models.LLM{Type_: "openai", Model_: "gpt-4o", Config_: map[string]any{"api_key": "sesame", "endpoint": server.URL + "/v1/"}}, http.DefaultClient)
+	require.NoError(t, err)
+
+	session, err := svc.(ai.RealtimeService).Realtime(ctx, &ai.RealtimeConfig{Instructions: "Ask the caller their age.", Voice: "alloy"})
+	require.NoError(t, err)
+	defer session.Close()
+
+	require.NoError(t, session.SendAudio(ctx, []byte{4, 5, 6}))
+
+	receive := func() *ai.RealtimeEvent {
+		evt, err := session.Receive(ctx)
+		require.NoError(t, err)
+		return evt
+	}
+
+	assert.Equal(t, &ai.RealtimeEvent{Type: ai.RealtimeEventAudio, Audio: []byte{1, 2, 3}}, receive())
+	assert.Equal(t, &ai.RealtimeEvent{Type: ai.RealtimeEventInterrupted}, receive())
+	assert.Equal(t, &ai.RealtimeEvent{Type: ai.RealtimeEventTranscript, Speaker: ai.RealtimeSpeakerCaller, Text: "I'm 34"}, receive())
+	assert.Equal(t, &ai.RealtimeEvent{Type: ai.RealtimeEventTranscript, Speaker: ai.RealtimeSpeakerAgent, Text: "Thanks, goodbye!"}, receive())
+	assert.Equal(t, &ai.RealtimeEvent{Type: ai.RealtimeEventUsage, TokensInput: 120, TokensOutput: 45}, receive())
+	assert.Equal(t, &ai.RealtimeEvent{Type: ai.RealtimeEventEnded, Results: map[string]string{"age": "34"}}, receive())
+
+	_, err = session.Receive(ctx)
+	assert.EqualError(t, err, "Invalid value")
+
+	assert.Equal(t, "Bearer sesame", header.Get("Authorization"))
+	assert.Equal(t, "realtime=v1", header.Get("OpenAI-Beta"))
+
+	require.Len(t, received, 3)
+	assert.Equal(t, "session.update", received[0]["type"])
+	assert.Equal(t, "Ask the caller their age.", received[0]["session"].(map[string]any)["instructions"])
+	assert.Equal(t, "alloy", received[0]["session"].(map[string]any)["voice"])
+	assert.Equal(t, "g711_ulaw", received[0]["session"].(map[string]any)["input_audio_format"])
+	assert.Equal(t, "response.create", received[1]["type"])
+	assert.Equal(t, map[string]any{"type": "input_audio_buffer.append", "audio": "BAUG"}, received[2])
 }
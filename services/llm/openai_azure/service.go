@@ -22,10 +22,13 @@ import (
 const (
 	TypeOpenAIAzure = "openai_azure"
 
-	apiVersion = "2025-03-01-preview"
+	defaultAPIVersion = "2025-03-01-preview"
 
-	configAPIKey   = "api_key"
-	configEndpoint = "endpoint"
+	configAPIKey     = "api_key"
+	configEndpoint   = "endpoint"
+	configAPIVersion = "api_version"
+	configDeployment = "deployment" // if the deployment name isn't the model name
+	configReasoning  = "reasoning"  // whether the model is a reasoning model, if that can't be known from its name
 )
 
 func init() {
@@ -34,8 +37,11 @@ func init() {
 
 // an LLM service implementation for OpenAI va Microsoft Azure
 type service struct {
-	client openai.Client
-	model  string
+	client     openai.Client
+	model      string
+	deployment string
+	params     ai.Params
+	reasoning  bool // reasoning models reject sampling params and max_tokens
 }
 
 func New(rt *runtime.Runtime, m *models.LLM, c *http.Client) (flows.LLMService, error) {
@@ -57,47 +63,110 @@ func New(rt *runtime.Runtime, m *models.LLM, c *http.Client) (flows.LLMService,
 		return mn(r)
 	}
 
-	return &service{
+	return ai.NewLLMService(&service{
 		client: openai.NewClient(
-			azure.WithEndpoint(bareEndpoint, apiVersion),
+			azure.WithEndpoint(bareEndpoint, m.Config().GetString(configAPIVersion, defaultAPIVersion)),
 			azure.WithAPIKey(apiKey),
 			option.WithMiddleware(mw),
 			option.WithHTTPClient(c),
 		),
-		model: m.Model(),
-	}, nil
+		model:      m.Model(),
+		deployment: m.Config().GetString(configDeployment, m.Model()),
+		params:     m.Params(),
+		reasoning:  m.Config().GetBool(configReasoning, ai.IsReasoningModel(m.Model())),
+	}), nil
 }
 
-func (s *service) Response(ctx context.Context, instructions, input string, maxTokens int) (*flows.LLMResponse, error) {
-	resp, err := s.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Model: shared.ChatModel(s.model),
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.SystemMessage(instructions),
-			openai.UserMessage(input),
-		},
-		Temperature: openai.Float(0.000001),
-		MaxTokens:   openai.Int(int64(maxTokens)),
-	})
+// the capabilities of OpenAI via Azure, which are further limited by model
+var capabilities = ai.ServiceCapabilities{Tools: true, Vision: true, Embeddings: true, JSONMode: true, JSONSchema: true}
+
+func (s *service) Capabilities() ai.ServiceCapabilities {
+	return ai.ModelCapabilities(s.model, capabilities)
+}
+
+func (s *service) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	timer := ai.NewTimer()
+	p := ai.Params{Temperature: new(ai.DefaultTemperature)}.Override(s.params)
+	if s.reasoning {
+		p.Temperature, p.TopP, p.FrequencyPenalty, p.PresencePenalty = nil, nil, nil, nil
+	}
+
+	params := openai.ChatCompletionNewParams{
+		Model:    shared.ChatModel(s.deployment), // Azure routes requests to deployments by this
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.SystemMessage(req.Instructions)},
+	}
+	for _, t := range req.History {
+		params.Messages = append(params.Messages, openai.UserMessage(t.Input), openai.AssistantMessage(t.Output))
+	}
+	params.Messages = append(params.Messages, openai.UserMessage(req.Input))
+
+	if s.reasoning {
+		params.MaxCompletionTokens = openai.Int(int64(req.MaxTokens)) // includes reasoning tokens
+	} else {
+		params.MaxTokens = openai.Int(int64(req.MaxTokens))
+	}
+	if p.Temperature != nil {
+		params.Temperature = openai.Float(*p.Temperature)
+	}
+	if p.TopP != nil {
+		params.TopP = openai.Float(*p.TopP)
+	}
+	if p.JSONMode != nil && *p.JSONMode {
+		params.ResponseFormat.OfJSONObject = &shared.ResponseFormatJSONObjectParam{}
+	}
+	if p.Seed != nil {
+		params.Seed = openai.Int(*p.Seed)
+	}
+	if p.FrequencyPenalty != nil {
+		params.FrequencyPenalty = openai.Float(*p.FrequencyPenalty)
+	}
+	if p.PresencePenalty != nil {
+		params.PresencePenalty = openai.Float(*p.PresencePenalty)
+	}
+
+	var httpResp *http.Response
+
+	opts := []option.RequestOption{option.WithResponseInto(&httpResp), option.WithMaxRetries(0)} // retries are ours to make
+	if req.IdempotencyKey != "" {
+		opts = append(opts, option.WithHeader("Idempotency-Key", req.IdempotencyKey))
+	}
+
+	resp, err := s.client.Chat.Completions.New(timer.Trace(ctx), params, opts...)
 	if err != nil {
-		return nil, s.error(err, instructions, input)
+		return nil, s.error(err, httpResp, req.Instructions, req.Input)
+	}
+	if resp.Choices[0].FinishReason == "content_filter" {
+		return nil, &ai.ServiceError{Message: "response blocked by content filter", Code: ai.ErrorContentFiltered, Instructions: req.Instructions, Input: req.Input}
 	}
 
-	return &flows.LLMResponse{
+	r := &ai.Response{
 		Output:       strings.TrimSpace(resp.Choices[0].Message.Content),
 		TokensInput:  resp.Usage.PromptTokens,
 		TokensOutput: resp.Usage.CompletionTokens,
-	}, nil
+		Timings:      timer.Timings(),
+		CachedTokens: int(resp.Usage.PromptTokensDetails.CachedTokens),
+		CacheStatus:  ai.CacheStatusFor(resp.Usage.PromptTokensDetails.CachedTokens, resp.Usage.PromptTokens),
+
+		TokensReasoning: resp.Usage.CompletionTokensDetails.ReasoningTokens,
+	}
+	applied := p.Applied(s.model, req.MaxTokens)
+	r.RequestHash = ai.HashRequest(req, applied)
+	if req.Debug {
+		r.AppliedParams = applied
+	}
+	return r, nil
 }
 
-func (s *service) error(err error, instructions, input string) error {
-	code := ai.ErrorUnknown
+func (s *service) error(err error, resp *http.Response, instructions, input string) error {
+	// gateways in front of the provider may return error bodies that aren't the JSON the SDK expects
+	if rerr := ai.NewRawResponseError(resp, instructions, input); rerr != nil {
+		return rerr
+	}
+
+	code, status := ai.ErrorUnknown, 0
 	if aerr, ok := errors.AsType[*responses.Error](err); ok {
-		switch aerr.StatusCode {
-		case http.StatusUnauthorized:
-			code = ai.ErrorCredentials
-		case http.StatusTooManyRequests:
-			code = ai.ErrorRateLimit
-		}
-	}
-	return &ai.ServiceError{Message: err.Error(), Code: code, Instructions: instructions, Input: input}
+		code = ai.ErrorCodeForType(aerr.Code, aerr.StatusCode)
+		status = aerr.StatusCode
+	}
+	return &ai.ServiceError{Message: err.Error(), Code: code, StatusCode: status, RetryAfter: ai.ParseRetryAfter(resp), Instructions: instructions, Input: input}
 }
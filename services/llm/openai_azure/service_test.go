@@ -19,17 +19,26 @@ func TestService(t *testing.T) {
 
 	bad := testdb.InsertLLM(t, rt, testdb.Org1, "c69723d8-fb37-4cf6-9ec4-bc40cb36f2cc", "openai_azure", "gpt-4", "Bad Config", map[string]any{}, "TF")
 	good := testdb.InsertLLM(t, rt, testdb.Org1, "b86966fd-206e-4bdd-a962-06faa3af1182", "openai_azure", "gpt-4", "Good", map[string]any{"endpoint": "http://azure.com/ai", "api_key": "sesame"}, "TF")
+	deployed := testdb.InsertLLM(t, rt, testdb.Org1, "9e3c5a0f-2c0b-4c1b-a0a4-5a2ad8e6b1f3", "openai_azure", "gpt-4", "Deployed", map[string]any{"endpoint": "http://azure.com/ai", "api_key": "sesame", "deployment": "prod-gpt4", "api_version": "2024-10-21"}, "TF")
 
 	oa := testdb.Org1.Load(t, rt)
 	badLLM := oa.LLMByID(bad.ID)
 	goodLLM := oa.LLMByID(good.ID)
+	deployedLLM := oa.LLMByID(deployed.ID)
 
 	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
 		"http://azure.com/ai/openai/deployments/gpt-4/chat/completions?api-version=2025-03-01-preview": {
 			httpx.NewMockResponse(401, map[string]string{"Content-type": "application/json"}, []byte(`{"message": "Incorrect API key provided", "type": "invalid_request_error", "param": null, "code": "invalid_api_key"}`)),
 			httpx.NewMockResponse(429, map[string]string{"Content-type": "application/json"}, []byte(`{"message": "Rate limit reached for your model", "type": "requests", "param": null, "code": "rate_limit_exceeded"}`)),
-			httpx.NewMockResponse(429, map[string]string{"Content-type": "application/json"}, []byte(`{"message": "Rate limit reached for your model", "type": "requests", "param": null, "code": "rate_limit_exceeded"}`)),
-			httpx.NewMockResponse(429, map[string]string{"Content-type": "application/json"}, []byte(`{"message": "Rate limit reached for your model", "type": "requests", "param": null, "code": "rate_limit_exceeded"}`)),
+		},
+		"http://azure.com/ai/openai/deployments/prod-gpt4/chat/completions?api-version=2024-10-21": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "chatcmpl-1",
+				"object": "chat.completion",
+				"model": "gpt-4",
+				"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Hola mundo"}}],
+				"usage": {"prompt_tokens": 12, "completion_tokens": 3, "total_tokens": 15}
+			}`)),
 		},
 	})
 
@@ -56,4 +65,14 @@ func TestService(t *testing.T) {
 		assert.Equal(t, ai.ErrorRateLimit, serr.Code)
 	}
 	assert.Nil(t, resp)
+
+	// deployment and API version can be configured
+	svc, err = openai_azure.New(rt, deployedLLM, client)
+	assert.NoError(t, err)
+
+	resp, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hola mundo", resp.Output)
+	assert.Equal(t, int64(12), resp.TokensInput)
+	assert.Equal(t, int64(3), resp.TokensOutput)
 }
@@ -0,0 +1,166 @@
+package openai_compat
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/ai"
+)
+
+const (
+	TypeDeepSeek         = "deepseek"
+	TypeGroq             = "groq"
+	TypeMistral          = "mistral"
+	TypeOpenAICompatible = "openai_compatible" // self-hosted servers such as Ollama or vLLM
+	TypeOpenRouter       = "openrouter"
+)
+
+// a hosted provider with an OpenAI compatible chat completions API
+type provider struct {
+	endpoint   string
+	validModel func(model string) bool
+	retryAfter func(r *http.Response) time.Duration
+	errorCode  func(status int, e *errorBody) string
+	seedParam  string // if the provider doesn't take the seed as seed
+	keyless    bool   // if the provider can be used without an API key
+
+	reasoningMaxTokens bool // whether reasoning models take max_tokens rather than max_completion_tokens
+}
+
+var providers = map[string]*provider{
+	TypeDeepSeek: {
+		endpoint:           "https://api.deepseek.com/v1/",
+		validModel:         deepSeekModelRegex.MatchString,
+		retryAfter:         ai.ParseRetryAfter,
+		errorCode:          deepSeekErrorCode,
+		reasoningMaxTokens: true,
+	},
+	TypeGroq: {
+		endpoint:   "https://api.groq.com/openai/v1/",
+		validModel: func(m string) bool { return slices.Contains(groqModels, m) },
+		retryAfter: groqRetryAfter,
+		errorCode:  groqErrorCode,
+	},
+	TypeMistral: {
+		endpoint:   "https://api.mistral.ai/v1/",
+		validModel: mistralModelRegex.MatchString,
+		retryAfter: ai.ParseRetryAfter,
+		errorCode:  mistralErrorCode,
+		seedParam:  "random_seed",
+	},
+	TypeOpenAICompatible: {
+		validModel: func(m string) bool { return m != "" }, // whatever the server has been set up to serve
+		retryAfter: ai.ParseRetryAfter,
+		errorCode:  func(status int, e *errorBody) string { return ai.ErrorCodeForType(e.code(), status) },
+		keyless:    true,
+	},
+	TypeOpenRouter: {
+		endpoint:   "https://openrouter.ai/api/v1/",
+		validModel: openRouterModelRegex.MatchString,
+		retryAfter: openRouterRetryAfter,
+		errorCode:  openRouterErrorCode,
+	},
+}
+
+// models of DeepSeek, which are its chat model and its reasoning model, each being the latest version
+var deepSeekModelRegex = regexp.MustCompile(`^deepseek-(chat|reasoner)$`)
+
+// models available on Groq, which are few and change often as it only hosts open models which it has optimized
+var groqModels = []string{
+	"deepseek-r1-distill-llama-70b",
+	"gemma2-9b-it",
+	"llama-3.1-8b-instant",
+	"llama-3.3-70b-versatile",
+	"meta-llama/llama-4-maverick-17b-128e-instruct",
+	"meta-llama/llama-4-scout-17b-16e-instruct",
+	"moonshotai/kimi-k2-instruct",
+	"openai/gpt-oss-120b",
+	"openai/gpt-oss-20b",
+	"qwen/qwen3-32b",
+}
+
+// models of Mistral, by family which can be used as is, as the latest version or as a specific version like 2411
+var mistralModelRegex = regexp.MustCompile(`^(codestral|devstral-medium|devstral-small|magistral-medium|magistral-small|ministral-3b|ministral-8b|mistral-large|mistral-medium|mistral-saba|mistral-small|open-mistral-nemo|pixtral-12b|pixtral-large)(-latest|-\d{4})?$`)
+
+// models of OpenRouter are named by the vendor and model, optionally with a variant like :free
+var openRouterModelRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*/[a-z0-9][a-z0-9._-]*(:[a-z]+)?$`)
+
+// DeepSeek errors are like OpenAI's but it has its own statuses for running out of balance and being overloaded
+func deepSeekErrorCode(status int, e *errorBody) string {
+	switch status {
+	case http.StatusPaymentRequired: // account has run out of balance
+		return ai.ErrorCredentials
+	case http.StatusServiceUnavailable: // servers are overloaded
+		return ai.ErrorUnavailable
+	}
+	if strings.Contains(e.Message, "maximum context length") {
+		return ai.ErrorContextLength
+	}
+	return ai.ErrorCodeForType(e.code(), status)
+}
+
+// Groq may only tell us when the limit we've exhausted resets, as a duration like 2m59.56s
+func groqRetryAfter(r *http.Response) time.Duration {
+	if d := ai.ParseRetryAfter(r); d > 0 || r == nil {
+		return d
+	}
+
+	var wait time.Duration
+	for _, limit := range []string{"requests", "tokens"} {
+		if r.Header.Get("X-Ratelimit-Remaining-"+limit) == "0" {
+			if d, err := time.ParseDuration(r.Header.Get("X-Ratelimit-Reset-" + limit)); err == nil {
+				wait = max(wait, d)
+			}
+		}
+	}
+	return wait
+}
+
+func groqErrorCode(status int, e *errorBody) string {
+	if e.code() == "model_decommissioned" {
+		return ai.ErrorInvalidModel
+	}
+	return ai.ErrorCodeForType(e.code(), status)
+}
+
+// Mistral errors aren't nested in an error object and have numeric codes so we go by their type and message
+func mistralErrorCode(status int, e *errorBody) string {
+	if e.Type == "invalid_model" {
+		return ai.ErrorInvalidModel
+	}
+	if strings.Contains(e.Message, "too large for model") {
+		return ai.ErrorContextLength
+	}
+	return ai.ErrorCodeForType(e.Type, status)
+}
+
+// OpenRouter tells us when the limit resets as a timestamp in milliseconds
+func openRouterRetryAfter(r *http.Response) time.Duration {
+	if d := ai.ParseRetryAfter(r); d > 0 || r == nil {
+		return d
+	}
+	if ms, err := strconv.ParseInt(r.Header.Get("X-Ratelimit-Reset"), 10, 64); err == nil && ms > 0 {
+		return max(time.Until(time.UnixMilli(ms)), 0)
+	}
+	return 0
+}
+
+// OpenRouter errors have the status as their code, with some statuses meaning something specific to OpenRouter
+func openRouterErrorCode(status int, e *errorBody) string {
+	switch status {
+	case http.StatusPaymentRequired: // account has run out of credits
+		return ai.ErrorCredentials
+	case http.StatusForbidden: // input was flagged by the moderation of the model's provider
+		return ai.ErrorContentFiltered
+	case http.StatusRequestTimeout, http.StatusServiceUnavailable: // no provider of the model is available
+		return ai.ErrorUnavailable
+	}
+	if strings.Contains(e.Message, "No endpoints found") {
+		return ai.ErrorInvalidModel
+	}
+	return ai.ErrorCodeForStatus(status)
+}
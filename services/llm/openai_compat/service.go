@@ -0,0 +1,233 @@
+package openai_compat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/shared"
+)
+
+const (
+	configAPIKey    = "api_key"
+	configEndpoint  = "endpoint"  // if requests go through a gateway rather than directly to the provider
+	configReasoning = "reasoning" // whether the model is a reasoning model, if that can't be known from its name
+)
+
+func init() {
+	for typ, p := range providers {
+		models.RegisterLLMService(typ, New)
+		if p.endpoint != "" {
+			ai.RegisterDefaultEndpoint(typ, p.endpoint)
+		}
+	}
+}
+
+// an LLM service implementation for hosted providers with OpenAI compatible APIs
+type service struct {
+	client    openai.Client
+	provider  *provider
+	model     string
+	params    ai.Params
+	reasoning bool // reasoning models reject sampling params
+}
+
+func New(rt *runtime.Runtime, m *models.LLM, c *http.Client) (flows.LLMService, error) {
+	p := providers[m.Type()]
+	if p == nil {
+		return nil, fmt.Errorf("config incomplete for LLM: %s", m.UUID())
+	}
+
+	// self-hosted servers may not need a key but we can't know where they are without an endpoint
+	apiKey := m.Config().GetString(configAPIKey, "")
+	endpoint := m.Config().GetString(configEndpoint, p.endpoint)
+
+	if endpoint == "" || (apiKey == "" && !p.keyless) {
+		return nil, fmt.Errorf("config incomplete for LLM: %s", m.UUID())
+	}
+	if !p.validModel(strings.ToLower(m.Model())) {
+		return nil, fmt.Errorf("model %s isn't supported by %s for LLM: %s", m.Model(), m.Type(), m.UUID())
+	}
+
+	opts := []option.RequestOption{option.WithBaseURL(endpoint), option.WithHTTPClient(c)}
+	if apiKey != "" {
+		opts = append(opts, option.WithAPIKey(apiKey))
+	} else {
+		opts = append(opts, option.WithHeaderDel("authorization")) // so a key from the environment is never sent
+	}
+
+	return ai.NewLLMService(&service{
+		client:    openai.NewClient(opts...),
+		provider:  p,
+		model:     m.Model(),
+		params:    m.Params(),
+		reasoning: m.Config().GetBool(configReasoning, ai.IsReasoningModel(m.Model())),
+	}), nil
+}
+
+// the capabilities of OpenAI compatible chat completions, which are further limited by model
+var capabilities = ai.ServiceCapabilities{JSONMode: true}
+
+func (s *service) Capabilities() ai.ServiceCapabilities {
+	return ai.ModelCapabilities(s.model, capabilities)
+}
+
+var _ ai.HealthCheckedService = (*service)(nil)
+
+func (s *service) Call(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	timer := ai.NewTimer()
+	p := ai.Params{Temperature: new(ai.DefaultTemperature)}.Override(s.params)
+	if s.reasoning {
+		p.Temperature, p.TopP, p.FrequencyPenalty, p.PresencePenalty = nil, nil, nil, nil
+	}
+
+	params := openai.ChatCompletionNewParams{
+		Model:    shared.ChatModel(s.model),
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.SystemMessage(req.Instructions)},
+	}
+	for _, t := range req.History {
+		params.Messages = append(params.Messages, openai.UserMessage(t.Input), openai.AssistantMessage(t.Output))
+	}
+	params.Messages = append(params.Messages, openai.UserMessage(req.Input))
+
+	if s.reasoning && !s.provider.reasoningMaxTokens {
+		params.MaxCompletionTokens = openai.Int(int64(req.MaxTokens)) // includes reasoning tokens
+	} else {
+		params.MaxTokens = openai.Int(int64(req.MaxTokens))
+	}
+	if p.Temperature != nil {
+		params.Temperature = openai.Float(*p.Temperature)
+	}
+	if p.TopP != nil {
+		params.TopP = openai.Float(*p.TopP)
+	}
+	if p.JSONMode != nil && *p.JSONMode {
+		params.ResponseFormat.OfJSONObject = &shared.ResponseFormatJSONObjectParam{}
+	}
+	if p.FrequencyPenalty != nil {
+		params.FrequencyPenalty = openai.Float(*p.FrequencyPenalty)
+	}
+	if p.PresencePenalty != nil {
+		params.PresencePenalty = openai.Float(*p.PresencePenalty)
+	}
+
+	var httpResp *http.Response
+
+	opts := []option.RequestOption{option.WithResponseInto(&httpResp), option.WithMaxRetries(0)} // retries are ours to make
+	if p.Seed != nil {
+		if s.provider.seedParam != "" {
+			opts = append(opts, option.WithJSONSet(s.provider.seedParam, *p.Seed))
+		} else {
+			params.Seed = openai.Int(*p.Seed)
+		}
+	}
+
+	resp, err := s.client.Chat.Completions.New(timer.Trace(ctx), params, opts...)
+	if err != nil {
+		return nil, s.error(err, httpResp, req.Instructions, req.Input)
+	}
+
+	// gateways like OpenRouter can report errors of the provider behind them in successful responses
+	if len(resp.Choices) == 0 {
+		return nil, &ai.ServiceError{Message: "response has no choices", Code: ai.ErrorUnknown, Instructions: req.Instructions, Input: req.Input}
+	}
+	if resp.Choices[0].FinishReason == "content_filter" {
+		return nil, &ai.ServiceError{Message: "response blocked by content filter", Code: ai.ErrorContentFiltered, Instructions: req.Instructions, Input: req.Input}
+	}
+
+	// reasoning models served by some providers include their thinking in the output
+	output, thinking := ai.StripThinking(resp.Choices[0].Message.Content)
+	if thinking != "" && strings.TrimSpace(output) == "" {
+		return nil, &ai.ServiceError{Message: "response only contains reasoning, max tokens may be too low", Code: ai.ErrorReasoning, Instructions: req.Instructions, Input: req.Input}
+	}
+
+	r := &ai.Response{
+		Output:       strings.TrimSpace(output),
+		Cleaned:      thinking != "",
+		TokensInput:  resp.Usage.PromptTokens,
+		TokensOutput: resp.Usage.CompletionTokens,
+		Timings:      timer.Timings(),
+		CachedTokens: int(resp.Usage.PromptTokensDetails.CachedTokens),
+		CacheStatus:  ai.CacheStatusFor(resp.Usage.PromptTokensDetails.CachedTokens, resp.Usage.PromptTokens),
+
+		TokensReasoning: resp.Usage.CompletionTokensDetails.ReasoningTokens,
+	}
+	if r.TokensReasoning == 0 && thinking != "" {
+		r.TokensReasoning = min(int64(ai.EstimateTokens(thinking)), r.TokensOutput) // not all providers count them
+	}
+
+	applied := p.Applied(s.model, req.MaxTokens)
+	r.RequestHash = ai.HashRequest(req, applied)
+	if req.Debug {
+		r.AppliedParams = applied
+	}
+	return r, nil
+}
+
+// Health checks that the provider is reachable and accepts our credentials by listing its models
+func (s *service) Health(ctx context.Context) error {
+	var httpResp *http.Response
+
+	if _, err := s.client.Models.List(ctx, option.WithResponseInto(&httpResp), option.WithMaxRetries(0)); err != nil {
+		return s.error(err, httpResp, "", "")
+	}
+	return nil
+}
+
+// the body of an error response, which some providers nest in an error object
+type errorBody struct {
+	Message string          `json:"message"`
+	Type    string          `json:"type"`
+	Code    json.RawMessage `json:"code"` // string or number depending on the provider
+	Error   *errorBody      `json:"error"`
+}
+
+func (e *errorBody) code() string {
+	return strings.Trim(string(e.Code), `"`)
+}
+
+func (s *service) error(err error, resp *http.Response, instructions, input string) error {
+	// gateways in front of the provider may return error bodies that aren't the JSON the SDK expects
+	if rerr := ai.NewRawResponseError(resp, instructions, input); rerr != nil {
+		return rerr
+	}
+
+	// not all providers return errors the way the SDK expects so we parse them ourselves
+	if resp == nil || resp.StatusCode < 400 {
+		return &ai.ServiceError{Message: err.Error(), Code: ai.ErrorUnknown, Instructions: instructions, Input: input}
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	e := &errorBody{}
+	json.Unmarshal(body, e)
+	if e.Error != nil {
+		e = e.Error
+	}
+
+	message := fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	if e.Message != "" {
+		message += ": " + e.Message
+	}
+
+	return &ai.ServiceError{
+		Message:      message,
+		Code:         s.provider.errorCode(resp.StatusCode, e),
+		StatusCode:   resp.StatusCode,
+		RetryAfter:   s.provider.retryAfter(resp),
+		Instructions: instructions,
+		Input:        input,
+	}
+}
@@ -0,0 +1,248 @@
+package openai_compat_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/goflow/test"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/services/llm/openai_compat"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultEndpoints(t *testing.T) {
+	assert.Equal(t, "https://api.deepseek.com/v1/", ai.DefaultEndpoint("deepseek"))
+	assert.Equal(t, "https://api.groq.com/openai/v1/", ai.DefaultEndpoint("groq"))
+	assert.Equal(t, "https://api.mistral.ai/v1/", ai.DefaultEndpoint("mistral"))
+	assert.Equal(t, "https://openrouter.ai/api/v1/", ai.DefaultEndpoint("openrouter"))
+	assert.Equal(t, "", ai.DefaultEndpoint("openai_compatible")) // endpoint is always required
+}
+
+func TestService(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	bad := testdb.InsertLLM(t, rt, testdb.Org1, "c69723d8-fb37-4cf6-9ec4-bc40cb36f2cc", "groq", "llama-3.3-70b-versatile", "Bad Config", map[string]any{}, "TF")
+	unknown := testdb.InsertLLM(t, rt, testdb.Org1, "5f0f4d4e-3b6a-4c1e-8f0e-6d2b9a1c7e3f", "groq", "gpt-4o", "Unknown Model", map[string]any{"api_key": "sesame"}, "TF")
+	groq := testdb.InsertLLM(t, rt, testdb.Org1, "b86966fd-206e-4bdd-a962-06faa3af1182", "groq", "llama-3.3-70b-versatile", "Groq", map[string]any{"api_key": "sesame"}, "TF")
+	mistral := testdb.InsertLLM(t, rt, testdb.Org1, "9e3c5a0f-2c0b-4c1b-a0a4-5a2ad8e6b1f3", "mistral", "mistral-small-latest", "Mistral", map[string]any{"api_key": "sesame", "seed": 42}, "TF")
+	openRouter := testdb.InsertLLM(t, rt, testdb.Org1, "2d6a4c1b-7e8f-4a3d-9b0c-1e2f3a4b5c6d", "openrouter", "anthropic/claude-3.5-sonnet", "OpenRouter", map[string]any{"api_key": "sesame"}, "TF")
+
+	oa := testdb.Org1.Load(t, rt)
+
+	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.groq.com/openai/v1/chat/completions": {
+			httpx.NewMockResponse(401, map[string]string{"Content-type": "application/json"}, []byte(`{"error": {"message": "Invalid API Key", "type": "invalid_request_error", "code": "invalid_api_key"}}`)),
+			httpx.NewMockResponse(429, map[string]string{"Content-type": "application/json", "X-Ratelimit-Remaining-Tokens": "0", "X-Ratelimit-Reset-Tokens": "7.66s"}, []byte(`{"error": {"message": "Rate limit reached", "type": "tokens", "code": "rate_limit_exceeded"}}`)),
+			httpx.NewMockResponse(404, map[string]string{"Content-type": "application/json"}, []byte(`{"error": {"message": "The model has been decommissioned", "type": "invalid_request_error", "code": "model_decommissioned"}}`)),
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "chatcmpl-1",
+				"object": "chat.completion",
+				"model": "llama-3.3-70b-versatile",
+				"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Hola mundo"}}],
+				"usage": {"prompt_tokens": 12, "completion_tokens": 3, "total_tokens": 15}
+			}`)),
+		},
+		"https://api.mistral.ai/v1/chat/completions": {
+			httpx.NewMockResponse(400, map[string]string{"Content-type": "application/json"}, []byte(`{"object": "error", "message": "Invalid model: mistral-small-latest", "type": "invalid_model", "param": null, "code": "1500"}`)),
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "cmpl-1",
+				"object": "chat.completion",
+				"model": "mistral-small-latest",
+				"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Hola mundo"}}],
+				"usage": {"prompt_tokens": 10, "completion_tokens": 4, "total_tokens": 14}
+			}`)),
+		},
+		"https://openrouter.ai/api/v1/chat/completions": {
+			httpx.NewMockResponse(402, map[string]string{"Content-type": "application/json"}, []byte(`{"error": {"code": 402, "message": "Insufficient credits"}}`)),
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{"id": "gen-1", "choices": [], "error": {"code": 502, "message": "Provider returned error"}}`)),
+		},
+	})
+
+	// can't create service with bad config or a model the provider doesn't have
+	svc, err := openai_compat.New(rt, oa.LLMByID(bad.ID), client)
+	assert.EqualError(t, err, "config incomplete for LLM: c69723d8-fb37-4cf6-9ec4-bc40cb36f2cc")
+	assert.Nil(t, svc)
+
+	svc, err = openai_compat.New(rt, oa.LLMByID(unknown.ID), client)
+	assert.EqualError(t, err, "model gpt-4o isn't supported by groq for LLM: 5f0f4d4e-3b6a-4c1e-8f0e-6d2b9a1c7e3f")
+	assert.Nil(t, svc)
+
+	svc, err = openai_compat.New(rt, oa.LLMByID(groq.ID), client)
+	assert.NoError(t, err)
+
+	var serr *ai.ServiceError
+
+	resp, err := svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.EqualError(t, err, "401 Unauthorized: Invalid API Key")
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorCredentials, serr.Code)
+	}
+	assert.Nil(t, resp)
+
+	_, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorRateLimit, serr.Code)
+		assert.Equal(t, 7660*time.Millisecond, serr.RetryAfter)
+	}
+
+	_, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorInvalidModel, serr.Code)
+	}
+
+	resp, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hola mundo", resp.Output)
+	assert.Equal(t, int64(12), resp.TokensInput)
+	assert.Equal(t, int64(3), resp.TokensOutput)
+
+	// Mistral errors aren't nested in an error object
+	svc, err = openai_compat.New(rt, oa.LLMByID(mistral.ID), client)
+	assert.NoError(t, err)
+
+	_, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.EqualError(t, err, "400 Bad Request: Invalid model: mistral-small-latest")
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorInvalidModel, serr.Code)
+	}
+
+	resp, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hola mundo", resp.Output)
+
+	// OpenRouter has its own statuses and can return errors in successful responses
+	svc, err = openai_compat.New(rt, oa.LLMByID(openRouter.ID), client)
+	assert.NoError(t, err)
+
+	_, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.EqualError(t, err, "402 Payment Required: Insufficient credits")
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorCredentials, serr.Code)
+	}
+
+	_, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.EqualError(t, err, "response has no choices")
+}
+
+func TestDeepSeek(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	reasoner := testdb.InsertLLM(t, rt, testdb.Org1, "b86966fd-206e-4bdd-a962-06faa3af1182", "deepseek", "deepseek-reasoner", "DeepSeek", map[string]any{"api_key": "sesame"}, "TF")
+	gateway := testdb.InsertLLM(t, rt, testdb.Org1, "9e3c5a0f-2c0b-4c1b-a0a4-5a2ad8e6b1f3", "deepseek", "deepseek-reasoner", "DeepSeek via Gateway", map[string]any{"api_key": "sesame", "endpoint": "https://gateway.example.com/v1/"}, "TF")
+
+	oa := testdb.Org1.Load(t, rt)
+
+	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.deepseek.com/v1/chat/completions": {
+			httpx.NewMockResponse(402, map[string]string{"Content-type": "application/json"}, []byte(`{"error": {"message": "Insufficient Balance", "type": "unknown_error", "param": null, "code": "invalid_request_error"}}`)),
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "1",
+				"object": "chat.completion",
+				"model": "deepseek-reasoner",
+				"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Hola mundo", "reasoning_content": "They want Spanish."}}],
+				"usage": {"prompt_tokens": 12, "completion_tokens": 30, "total_tokens": 42, "completion_tokens_details": {"reasoning_tokens": 27}}
+			}`)),
+		},
+		"https://gateway.example.com/v1/chat/completions": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "2",
+				"object": "chat.completion",
+				"model": "deepseek-reasoner",
+				"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "<think>\nThey want Spanish.\n</think>\n\nHola mundo"}}],
+				"usage": {"prompt_tokens": 12, "completion_tokens": 10, "total_tokens": 22}
+			}`)),
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "3",
+				"object": "chat.completion",
+				"model": "deepseek-reasoner",
+				"choices": [{"index": 0, "finish_reason": "length", "message": {"role": "assistant", "content": "<think>\nThey want Spanish so I should"}}],
+				"usage": {"prompt_tokens": 12, "completion_tokens": 10, "total_tokens": 22}
+			}`)),
+		},
+	})
+
+	svc, err := openai_compat.New(rt, oa.LLMByID(reasoner.ID), client)
+	assert.NoError(t, err)
+
+	var serr *ai.ServiceError
+
+	_, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.EqualError(t, err, "402 Payment Required: Insufficient Balance")
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorCredentials, serr.Code)
+	}
+
+	// reasoning is returned separately from output and counted separately from other output tokens
+	resp, err := svc.(*ai.LLMService).Call(ctx, &ai.Request{Instructions: "translate to Spanish", Input: "Hello world", MaxTokens: 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hola mundo", resp.Output)
+	assert.Equal(t, int64(30), resp.TokensOutput)
+	assert.Equal(t, int64(27), resp.TokensReasoning)
+	assert.False(t, resp.Cleaned)
+
+	// other providers of the model may include reasoning in output without counting it
+	svc, err = openai_compat.New(rt, oa.LLMByID(gateway.ID), client)
+	assert.NoError(t, err)
+
+	resp, err = svc.(*ai.LLMService).Call(ctx, &ai.Request{Instructions: "translate to Spanish", Input: "Hello world", MaxTokens: 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hola mundo", resp.Output)
+	assert.Equal(t, int64(10), resp.TokensOutput)
+	assert.Equal(t, int64(5), resp.TokensReasoning)
+	assert.True(t, resp.Cleaned)
+
+	// and if output is cut short while reasoning, there's no output to return
+	_, err = svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	assert.EqualError(t, err, "response only contains reasoning, max tokens may be too low")
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, ai.ErrorReasoning, serr.Code)
+	}
+}
+
+func TestOpenAICompatible(t *testing.T) {
+	ctx := context.Background()
+
+	client, _ := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"http://localhost:11434/v1/models": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{"object": "list", "data": [{"id": "llama3.2", "object": "model", "created": 1730000000, "owned_by": "library"}]}`)),
+			httpx.NewMockResponse(502, map[string]string{"Content-type": "text/html"}, []byte(`<html><body>Bad Gateway</body></html>`)),
+		},
+		"http://localhost:11434/v1/chat/completions": {
+			httpx.NewMockResponse(200, map[string]string{"Content-type": "application/json"}, []byte(`{
+				"id": "1",
+				"object": "chat.completion",
+				"model": "llama3.2",
+				"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Hola mundo"}}],
+				"usage": {"prompt_tokens": 20, "completion_tokens": 3, "total_tokens": 23}
+			}`)),
+		},
+	})
+
+	// endpoint is required but API key isn't
+	_, err := openai_compat.New(nil, &models.LLM{UUID_: "c69723d8-fb37-4cf6-9ec4-bc40cb36f2cc", Type_: "openai_compatible", Model_: "llama3.2", Config_: map[string]any{}}, client)
+	assert.EqualError(t, err, "config incomplete for LLM: c69723d8-fb37-4cf6-9ec4-bc40cb36f2cc")
+
+	svc, err := openai_compat.New(nil, &models.LLM{Type_: "openai_compatible", Model_: "llama3.2", Config_: map[string]any{"endpoint": "http://localhost:11434/v1/"}}, client)
+	require.NoError(t, err)
+
+	assert.NoError(t, svc.(ai.HealthCheckedService).Health(ctx))
+
+	err = svc.(ai.HealthCheckedService).Health(ctx)
+	assert.EqualError(t, err, "502 Bad Gateway: <html><body>Bad Gateway</body></html>")
+
+	resp, err := svc.Response(ctx, "translate to Spanish", "Hello world", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, "Hola mundo", resp.Output)
+	assert.Equal(t, int64(20), resp.TokensInput)
+	assert.Equal(t, int64(3), resp.TokensOutput)
+}
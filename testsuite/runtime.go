@@ -238,6 +238,8 @@ DELETE FROM channels_channelevent;
 DELETE FROM msgs_msg;
 DELETE FROM flows_flowrun;
 DELETE FROM flows_flowactivitycount;
+DELETE FROM ai_llmflowcount;
+DELETE FROM ai_llmcall;
 DELETE FROM flows_flowresultcount;
 DELETE FROM flows_flowstartcount;
 DELETE FROM flows_flowstart_contacts;
@@ -247,6 +249,18 @@ DELETE FROM flows_flowsession;
 DELETE FROM flows_flowrevision WHERE flow_id >= 30000;
 DELETE FROM flows_flow WHERE id >= 30000;
 DELETE FROM ai_llmcount;
+DELETE FROM ai_conversation;
+DO $$
+BEGIN
+	IF to_regclass('public.ai_documentchunk') IS NOT NULL THEN
+		DELETE FROM ai_documentchunk;
+		DELETE FROM ai_document;
+		DELETE FROM ai_knowledgebase;
+	END IF;
+END
+$$;
+DELETE FROM ai_promptversion;
+DELETE FROM ai_prompt;
 DELETE FROM ai_llm WHERE id >= 30000;
 DELETE FROM ivr_call;
 DELETE FROM msgs_msg_labels;
@@ -271,6 +285,7 @@ DELETE FROM contacts_contactgroupcount WHERE group_id >= 30000;
 DELETE FROM contacts_contactgroup WHERE id >= 30000;
 DELETE FROM orgs_itemcount;
 DELETE FROM orgs_dailycount;
+DELETE FROM orgs_llmusage;
 
 ALTER SEQUENCE ai_llm_id_seq RESTART WITH 30000;
 ALTER SEQUENCE api_resthook_id_seq RESTART WITH 30000;
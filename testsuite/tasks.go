@@ -122,7 +122,7 @@ func drainTasks(t *testing.T, rt *runtime.Runtime, perform bool, qnames ...strin
 	counts := make(map[string]int)
 
 	var qs []queues.Fair
-	for _, q := range []queues.Fair{rt.Queues.Realtime, rt.Queues.Batch, rt.Queues.Throttled} {
+	for _, q := range []queues.Fair{rt.Queues.Realtime, rt.Queues.Batch, rt.Queues.Throttled, rt.Queues.AI} {
 		if len(qnames) == 0 || slices.Contains(qnames, fmt.Sprint(q)) {
 			qs = append(qs, q)
 		}
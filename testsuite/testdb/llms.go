@@ -24,3 +24,26 @@ func InsertLLM(t *testing.T, rt *runtime.Runtime, org *Org, uuid assets.LLMUUID,
 	require.NoError(t, err)
 	return &LLM{ID: id, UUID: uuid}
 }
+
+type Prompt struct {
+	ID   models.PromptID
+	UUID models.PromptUUID
+}
+
+// InsertPrompt inserts a prompt as its first version
+func InsertPrompt(t *testing.T, rt *runtime.Runtime, org *Org, uuid models.PromptUUID, name, body string, llm *LLM) *Prompt {
+	llmID := models.NilLLMID
+	if llm != nil {
+		llmID = llm.ID
+	}
+
+	var id models.PromptID
+	err := rt.DB.Get(&id,
+		`INSERT INTO ai_prompt(org_id, uuid, name, body, llm_id, version, is_active, created_on, modified_on, created_by_id, modified_by_id)
+		VALUES($1, $2, $3, $4, $5, 1, TRUE, NOW(), NOW(), 1, 1) RETURNING id`, org.ID, uuid, name, body, llmID,
+	)
+	require.NoError(t, err)
+
+	rt.DB.MustExec(`INSERT INTO ai_promptversion(prompt_id, version, body, llm_id, created_by_id, created_on) VALUES($1, 1, $2, $3, 1, NOW())`, id, body, llmID)
+	return &Prompt{ID: id, UUID: uuid}
+}
@@ -97,6 +97,14 @@ func TestExportPreview(t *testing.T) {
 	testsuite.RunWebTests(t, rt, "testdata/export_preview.json")
 }
 
+func TestExtractFields(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	testsuite.RunWebTests(t, rt, "testdata/extract_fields.json")
+}
+
 func TestImport(t *testing.T) {
 	_, rt := testsuite.Runtime(t)
 
@@ -189,6 +197,14 @@ func TestParseQuery(t *testing.T) {
 	testsuite.RunWebTests(t, rt, "testdata/parse_query.json")
 }
 
+func TestParseNL(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	testsuite.RunWebTests(t, rt, "testdata/parse_nl.json")
+}
+
 func TestPopulateGroup(t *testing.T) {
 	_, rt := testsuite.Runtime(t)
 
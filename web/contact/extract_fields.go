@@ -0,0 +1,102 @@
+package contact
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/runner"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/contact/extract_fields", web.JSONPayload(handleExtractFields))
+}
+
+// Request to extract values for contact fields from free text using an LLM, optionally saving them to a contact.
+//
+//	{
+//	  "org_id": 1,
+//	  "llm_id": 1234,
+//	  "text": "I'm Marie, 34, living in Cap-Haïtien, 2 kids",
+//	  "fields": ["age", "city", "children"],
+//	  "contact_id": 10001
+//	}
+type extractFieldsRequest struct {
+	OrgID     models.OrgID     `json:"org_id"     validate:"required"`
+	LLMID     models.LLMID     `json:"llm_id"     validate:"required"`
+	Text      string           `json:"text"       validate:"required"`
+	Fields    []string         `json:"fields"     validate:"required,min=1"`
+	ContactID models.ContactID `json:"contact_id"`
+}
+
+// Response for a field extraction request, which only includes fields whose values were found in the text
+//
+//	{
+//	  "values": {"age": "34", "city": "Cap-Haïtien", "children": "2"}
+//	}
+type extractFieldsResponse struct {
+	Values map[string]string `json:"values"`
+}
+
+// handles a request to extract contact field values from text
+func handleExtractFields(ctx context.Context, rt *runtime.Runtime, r *extractFieldsRequest) (any, int, error) {
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, r.OrgID, models.RefreshFields)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	llm := oa.LLMByID(r.LLMID)
+	if llm == nil {
+		return nil, 0, fmt.Errorf("no such LLM with ID %d", r.LLMID)
+	}
+
+	fields := make([]*ai.ExtractField, len(r.Fields))
+	for i, key := range r.Fields {
+		field := oa.FieldByKey(key)
+		if field == nil {
+			return nil, 0, fmt.Errorf("no such field with key '%s'", key)
+		}
+		fields[i] = &ai.ExtractField{Key: field.Key(), Name: field.Name(), Type: field.Type()}
+	}
+
+	caller, err := web.NewLLMCaller(rt, oa, llm)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var values map[string]string
+	err = caller.Call(ctx, "", r.Text, func(ctx context.Context, svc flows.LLMService) (*flows.LLMResponse, error) {
+		var resp *flows.LLMResponse
+		var err error
+		values, resp, err = ai.ExtractFields(ctx, svc, r.Text, fields)
+		return resp, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if r.ContactID != models.NilContactID && len(values) > 0 {
+		mods := make([]flows.Modifier, 0, len(values))
+		for _, f := range fields {
+			if v, ok := values[f.Key]; ok {
+				mods = append(mods, modifiers.NewField(oa.SessionAssets().Fields().Get(f.Key), v))
+			}
+		}
+
+		_, skipped, err := runner.ModifyWithLock(ctx, rt, oa, models.NilUserID, []models.ContactID{r.ContactID}, map[models.ContactID][]flows.Modifier{r.ContactID: mods}, nil, "")
+		if err != nil {
+			return nil, 0, fmt.Errorf("error saving extracted field values: %w", err)
+		}
+		if len(skipped) > 0 {
+			return nil, 0, fmt.Errorf("unable to lock contact %d to save extracted field values", r.ContactID)
+		}
+	}
+
+	return &extractFieldsResponse{Values: values}, http.StatusOK, nil
+}
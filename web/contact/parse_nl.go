@@ -0,0 +1,121 @@
+package contact
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/contact/parse_nl", web.JSONPayload(handleParseNL))
+}
+
+// Request to convert a natural language description of contacts into a query using an LLM
+//
+//	{
+//	  "org_id": 1,
+//	  "llm_id": 1234,
+//	  "text": "women in Port-au-Prince who joined last month"
+//	}
+type parseNLRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+	LLMID models.LLMID `json:"llm_id" validate:"required"`
+	Text  string       `json:"text"   validate:"required"`
+}
+
+// Response for a natural language parse request, which includes the query even if it's invalid, along with the error
+//
+//	{
+//	  "query": "gender = \"female\" AND district = \"Port-au-Prince\" AND joined >= 2026-04-01",
+//	  "metadata": {
+//	    "fields": [
+//	      {"key": "gender", "name": "Gender"}
+//	    ],
+//	    "allow_as_group": true
+//	  }
+//	}
+type parseNLResponse struct {
+	Query    string                `json:"query"`
+	Metadata *contactql.Inspection `json:"metadata,omitempty"`
+	Error    *web.ErrorResponse    `json:"error,omitempty"`
+}
+
+// handles a natural language query parsing request
+func handleParseNL(ctx context.Context, rt *runtime.Runtime, r *parseNLRequest) (any, int, error) {
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, r.OrgID, models.RefreshFields|models.RefreshGroups)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	llm := oa.LLMByID(r.LLMID)
+	if llm == nil {
+		return nil, 0, fmt.Errorf("no such LLM with ID %d", r.LLMID)
+	}
+	if !slices.Contains(llm.Roles(), assets.LLMRoleEditing) {
+		return nil, 0, fmt.Errorf("LLM with ID %d does not support editing", r.LLMID)
+	}
+
+	caller, err := web.NewLLMCaller(rt, oa, llm)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	instructions, err := contactQueryInstructions(oa)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := caller.Response(ctx, instructions, r.Text)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := strings.TrimSpace(resp.Output)
+	if query == "<CANT>" {
+		return &parseNLResponse{Error: &web.ErrorResponse{Error: "text can't be expressed as a query"}}, http.StatusOK, nil
+	}
+
+	parsed, err := contactql.ParseQuery(oa.Env(), query, oa.SessionAssets())
+	if err != nil {
+		qerr, _ := web.ErrorToResponse(err)
+		return &parseNLResponse{Query: query, Error: qerr}, http.StatusOK, nil
+	}
+
+	return &parseNLResponse{Query: parsed.String(), Metadata: contactql.Inspect(parsed)}, http.StatusOK, nil
+}
+
+// renders the instructions for converting text to a query, which describe the org's fields and groups
+func contactQueryInstructions(oa *models.OrgAssets) (string, error) {
+	fields, err := oa.Fields()
+	if err != nil {
+		return "", fmt.Errorf("error loading fields: %w", err)
+	}
+	groups, err := oa.Groups()
+	if err != nil {
+		return "", fmt.Errorf("error loading groups: %w", err)
+	}
+
+	data := struct {
+		Today  string
+		Fields []assets.Field
+		Groups []string
+	}{
+		Today:  dates.Now().In(oa.Env().Timezone()).Format("2006-01-02"),
+		Fields: fields,
+	}
+	for _, g := range groups {
+		data.Groups = append(data.Groups, g.Name())
+	}
+
+	return prompts.Render("contact_query", data), nil
+}
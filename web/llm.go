@@ -0,0 +1,75 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// LLMCaller makes calls to an org's LLM on behalf of an endpoint, recording each call against the org
+type LLMCaller struct {
+	rt  *runtime.Runtime
+	oa  *models.OrgAssets
+	llm *models.LLM
+	svc flows.LLMService
+}
+
+// NewLLMCaller creates a new caller for the given LLM. Calls go through the same service as flows so the org's rate
+// limits and budget apply.
+func NewLLMCaller(rt *runtime.Runtime, oa *models.OrgAssets, llm *models.LLM) (*LLMCaller, error) {
+	svc, err := llm.AsService(rt, http.DefaultClient)
+	if err != nil {
+		return nil, fmt.Errorf("error creating LLM service: %w", err)
+	}
+
+	return &LLMCaller{rt: rt, oa: oa, llm: llm, svc: svc}, nil
+}
+
+// Response requests a response from the LLM for the given instructions and input
+func (c *LLMCaller) Response(ctx context.Context, instructions, input string) (*flows.LLMResponse, error) {
+	var resp *flows.LLMResponse
+	err := c.Call(ctx, instructions, input, func(ctx context.Context, svc flows.LLMService) (*flows.LLMResponse, error) {
+		var err error
+		resp, err = svc.Response(ctx, instructions, input, c.llm.MaxOutputTokens())
+		return resp, err
+	})
+	return resp, err
+}
+
+// Call makes a call to the LLM via the given function and records it. An error from the LLM service itself (bad
+// credentials, rate limit, model unavailable, etc.) is returned as an *ai.ServiceError so that it's reported as a 422,
+// because LLMs are user-configured and so it's not necessarily our fault.
+func (c *LLMCaller) Call(ctx context.Context, instructions, input string, fn func(context.Context, flows.LLMService) (*flows.LLMResponse, error)) error {
+	callStart := time.Now()
+	resp, err := fn(ctx, c.svc)
+
+	// detach from the request context so a client-side timeout during the LLM call doesn't prevent us from recording usage someone may have paid for
+	recCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if rerr := c.llm.RecordStandaloneCall(recCtx, c.rt, c.oa, instructions, input, resp, time.Since(callStart), err != nil); rerr != nil {
+		slog.Error("error recording llm call", "error", rerr, "llm_id", c.llm.ID())
+	}
+
+	if err != nil {
+		// context cancellation/deadline is a client/timeout issue, not an LLM config failure
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+		// real LLM services wrap their errors as *ai.ServiceError already; wrap anything else
+		// (e.g. from the test service) so the handler response is consistently a 422.
+		var aerr *ai.ServiceError
+		if !errors.As(err, &aerr) {
+			err = &ai.ServiceError{Message: err.Error(), Code: ai.ErrorUnknown}
+		}
+		return err
+	}
+	return nil
+}
@@ -2,11 +2,23 @@ package llm_test
 
 import (
 	"testing"
+	"time"
 
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/testsuite"
 	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/require"
 )
 
+func TestEvaluate(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	testsuite.RunWebTests(t, rt, "testdata/evaluate.json")
+}
+
 func TestTranslate(t *testing.T) {
 	_, rt := testsuite.Runtime(t)
 
@@ -17,3 +29,52 @@ func TestTranslate(t *testing.T) {
 
 	testsuite.RunWebTests(t, rt, "testdata/translate.json")
 }
+
+func TestVerify(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2026, 5, 4, 13, 14, 30, 0, time.UTC)))
+	defer dates.SetNowFunc(time.Now)
+
+	testdb.InsertLLM(t, rt, testdb.Org1, "3f9c2a71-6b4e-4d8a-9e5f-1c2b3a4d5e6f", "test", "gpt-4", "Verifiable", map[string]any{}, "F")
+
+	testsuite.RunWebTests(t, rt, "testdata/verify.json")
+}
+
+func TestExperiment(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData|testsuite.ResetValkey)
+
+	testdb.InsertLLM(t, rt, testdb.Org1, "7a1b2c3d-4e5f-4a6b-8c9d-0e1f2a3b4c5d", "test", "gpt-4", "Experimental", map[string]any{
+		"experiment":          "greeting",
+		"experiment_variants": []any{map[string]any{"name": "control"}, map[string]any{"name": "brief", "instructions": "{instructions} Be brief."}},
+	}, "F")
+
+	testsuite.RunWebTests(t, rt, "testdata/experiment.json")
+}
+
+func TestUsage(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	may3, may4 := dates.NewDate(2026, 5, 3), dates.NewDate(2026, 5, 4)
+
+	err := models.InsertLLMDailyCounts(ctx, rt.DB, []*models.LLMDailyCount{
+		{LLMID: testdb.OpenAI.ID, FlowID: testdb.Favorites.ID, Day: may3, Scope: "calls", Count: 2},
+		{LLMID: testdb.OpenAI.ID, FlowID: testdb.Favorites.ID, Day: may3, Scope: "tokens:in", Count: 200},
+		{LLMID: testdb.OpenAI.ID, FlowID: testdb.Favorites.ID, Day: may3, Scope: "tokens:out", Count: 100},
+		{LLMID: testdb.OpenAI.ID, FlowID: testdb.Favorites.ID, Day: may3, Scope: "cost:microusd", Count: 1500},
+		{LLMID: testdb.OpenAI.ID, FlowID: testdb.PickANumber.ID, Day: may4, Scope: "calls", Count: 3},
+		{LLMID: testdb.OpenAI.ID, FlowID: testdb.PickANumber.ID, Day: may4, Scope: "cost:microusd", Count: 500},
+		{LLMID: testdb.OpenAI.ID, FlowID: testdb.PickANumber.ID, Day: may4, Scope: "errors:ratelimit", Count: 1},
+		{LLMID: testdb.Anthropic.ID, Day: may4, Scope: "calls", Count: 1},
+		{LLMID: testdb.Anthropic.ID, Day: may4, Scope: "errors:timeout", Count: 1},
+	})
+	require.NoError(t, err)
+
+	testsuite.RunWebTests(t, rt, "testdata/usage.json")
+}
@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+const defaultCallsLimit = 50
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/llm/calls", web.JSONPayload(handleCalls))
+}
+
+// Lists the most recent calls made by an org to its LLMs, optionally only to a single LLM, for debugging.
+//
+//	{
+//	  "org_id": 1,
+//	  "llm_id": 1234,
+//	  "limit": 20
+//	}
+type callsRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+	LLMID models.LLMID `json:"llm_id"`
+	Limit int          `json:"limit"  validate:"omitempty,min=1,max=1000"`
+}
+
+//	{
+//	  "calls": [
+//	    {
+//	      "id": 4567,
+//	      "llm_id": 1234,
+//	      "flow_id": 345,
+//	      "contact_id": 10000,
+//	      "status": "F",
+//	      "error_code": "ratelimit",
+//	      "elapsed_ms": 1250,
+//	      "tokens_input": 0,
+//	      "tokens_output": 0,
+//	      "created_on": "2026-05-04T13:14:30.123456Z"
+//	    }
+//	  ]
+//	}
+type callsResponse struct {
+	Calls []*models.LLMCall `json:"calls"`
+}
+
+func handleCalls(ctx context.Context, rt *runtime.Runtime, r *callsRequest) (any, int, error) {
+	limit := r.Limit
+	if limit == 0 {
+		limit = defaultCallsLimit
+	}
+
+	calls, err := models.GetRecentLLMCalls(ctx, rt.DB, r.OrgID, r.LLMID, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading llm calls: %w", err)
+	}
+
+	return &callsResponse{Calls: calls}, http.StatusOK, nil
+}
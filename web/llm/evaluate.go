@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+// maximum number of test cases which are run at the same time
+const evaluateConcurrency = 5
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/llm/evaluate", web.JSONPayload(handleEvaluate))
+}
+
+// Evaluates a prompt against a set of test cases, each of which passes if the LLM's output for its input is the expected
+// category (ignoring case and surrounding whitespace) or matches the expected regular expression.
+//
+//	{
+//	  "org_id": 1,
+//	  "llm_uuid": "e5d8900a-ef54-4d2a-8214-ff7d3e903502",
+//	  "instructions": "Categorize the input as Question, Complaint or Other. Return only the category.",
+//	  "cases": [
+//	    {"input": "Where is my order?", "category": "Question"},
+//	    {"input": "This is the third time it's broken!", "pattern": "(?i)^complaint"}
+//	  ]
+//	}
+type evaluateRequest struct {
+	OrgID        models.OrgID    `json:"org_id"       validate:"required"`
+	LLMUUID      assets.LLMUUID  `json:"llm_uuid"     validate:"required"`
+	Instructions string          `json:"instructions" validate:"required"`
+	Cases        []*evaluateCase `json:"cases"        validate:"required,min=1,max=100,dive"`
+}
+
+type evaluateCase struct {
+	Input    string `json:"input"    validate:"required"`
+	Category string `json:"category" validate:"required_without=Pattern"`
+	Pattern  string `json:"pattern"  validate:"required_without=Category"`
+}
+
+//	{
+//	  "results": [
+//	    {"input": "Where is my order?", "output": "Question", "passed": true, "tokens_input": 45, "tokens_output": 1},
+//	    {"input": "This is the third time it's broken!", "output": "", "passed": false, "error": "rate limit exceeded"}
+//	  ],
+//	  "passed": 1,
+//	  "failed": 1,
+//	  "tokens_input": 45,
+//	  "tokens_output": 1
+//	}
+type evaluateResponse struct {
+	Results      []*evaluateResult `json:"results"`
+	Passed       int               `json:"passed"`
+	Failed       int               `json:"failed"`
+	TokensInput  int64             `json:"tokens_input"`
+	TokensOutput int64             `json:"tokens_output"`
+}
+
+type evaluateResult struct {
+	Input        string `json:"input"`
+	Output       string `json:"output"`
+	Passed       bool   `json:"passed"`
+	Error        string `json:"error,omitempty"`
+	TokensInput  int64  `json:"tokens_input"`
+	TokensOutput int64  `json:"tokens_output"`
+}
+
+func handleEvaluate(ctx context.Context, rt *runtime.Runtime, r *evaluateRequest) (any, int, error) {
+	patterns := make([]*regexp.Regexp, len(r.Cases))
+	for i, c := range r.Cases {
+		if c.Pattern != "" {
+			re, err := regexp.Compile(c.Pattern)
+			if err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("invalid pattern for case %d: %w", i, err)
+			}
+			patterns[i] = re
+		}
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	llm := oa.LLMByUUID(r.LLMUUID)
+	if llm == nil {
+		return nil, 0, fmt.Errorf("no such LLM with UUID %s", r.LLMUUID)
+	}
+
+	caller, err := web.NewLLMCaller(rt, oa, llm)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	results := make([]*evaluateResult, len(r.Cases))
+	sem := make(chan struct{}, evaluateConcurrency)
+	wg := &sync.WaitGroup{}
+
+	for i, c := range r.Cases {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+
+			result := &evaluateResult{Input: c.Input}
+			results[i] = result
+
+			resp, err := caller.Response(ctx, r.Instructions, c.Input)
+			if err != nil {
+				result.Error = err.Error()
+				return
+			}
+
+			result.Output = resp.Output
+			result.TokensInput = resp.TokensInput
+			result.TokensOutput = resp.TokensOutput
+
+			if patterns[i] != nil {
+				result.Passed = patterns[i].MatchString(resp.Output)
+			} else {
+				result.Passed = strings.EqualFold(strings.TrimSpace(resp.Output), strings.TrimSpace(c.Category))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	eval := &evaluateResponse{Results: results}
+	for _, res := range results {
+		if res.Passed {
+			eval.Passed++
+		} else {
+			eval.Failed++
+		}
+		eval.TokensInput += res.TokensInput
+		eval.TokensOutput += res.TokensOutput
+	}
+
+	return eval, http.StatusOK, nil
+}
@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/llm/experiment", web.JSONPayload(handleExperiment))
+}
+
+// Gets the outcomes of each variant of the experiment configured on an LLM, i.e. how many contacts got that variant,
+// how their calls went, and counts of short outputs such as categories.
+//
+//	{
+//	  "org_id": 1,
+//	  "llm_uuid": "e5d8900a-ef54-4d2a-8214-ff7d3e903502"
+//	}
+type experimentRequest struct {
+	OrgID   models.OrgID   `json:"org_id"   validate:"required"`
+	LLMUUID assets.LLMUUID `json:"llm_uuid" validate:"required"`
+}
+
+//	{
+//	  "experiment": "greeting",
+//	  "variants": [
+//	    {"name": "control", "contacts": 12, "calls": 30, "failures": 1, "tokens_input": 1350, "tokens_output": 2262, "outputs": {"yes": 20, "no": 9}},
+//	    {"name": "short", "contacts": 10, "calls": 24, "failures": 0, "tokens_input": 1080, "tokens_output": 1872, "outputs": {"yes": 15, "no": 9}}
+//	  ]
+//	}
+type experimentResponse struct {
+	Experiment string                             `json:"experiment"`
+	Variants   []*models.ExperimentVariantResults `json:"variants"`
+}
+
+func handleExperiment(ctx context.Context, rt *runtime.Runtime, r *experimentRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	llm := oa.LLMByUUID(r.LLMUUID)
+	if llm == nil {
+		return nil, 0, fmt.Errorf("no such LLM with UUID %s", r.LLMUUID)
+	}
+
+	name := llm.Experiment()
+	if name == "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("LLM %s has no experiment", r.LLMUUID)
+	}
+
+	variants, err := llm.ExperimentResults(ctx, rt)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &experimentResponse{Experiment: name, Variants: variants}, http.StatusOK, nil
+}
@@ -3,18 +3,13 @@ package llm
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"slices"
-	"time"
 
 	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/goflow/assets"
-	"github.com/nyaruka/goflow/flows"
-	"github.com/nyaruka/goflow/flows/events"
-	"github.com/nyaruka/mailroom/v26/core/ai"
 	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/runtime"
@@ -73,9 +68,9 @@ func handleTranslate(ctx context.Context, rt *runtime.Runtime, r *translateReque
 		return nil, 0, fmt.Errorf("LLM with ID %d does not support editing", r.LLMID)
 	}
 
-	llmSvc, err := llm.AsService(rt, http.DefaultClient)
+	caller, err := web.NewLLMCaller(rt, oa, llm)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error creating LLM service: %w", err)
+		return nil, 0, err
 	}
 
 	instructionsTpl := "translate"
@@ -89,33 +84,8 @@ func handleTranslate(ctx context.Context, rt *runtime.Runtime, r *translateReque
 		return nil, 0, fmt.Errorf("error marshaling input: %w", err)
 	}
 
-	callStart := time.Now()
-	resp, err := llmSvc.Response(ctx, instructions, string(inputBytes), llm.MaxOutputTokens())
-	if resp == nil {
-		resp = &flows.LLMResponse{}
-	}
-	counts := llm.RecordCall(rt, oa, events.NewLLMCalled(flows.NewLLM(llm), instructions, string(inputBytes), resp, time.Since(callStart)))
-
-	// detach from the request context so a client-side timeout during the LLM call doesn't prevent us from recording usage someone may have paid for
-	recCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
-	defer cancel()
-	if rerr := insertLLMCallCounts(recCtx, rt, counts); rerr != nil {
-		slog.Error("error recording llm call", "error", rerr, "llm_id", r.LLMID)
-	}
-
-	// An error from the LLM service itself (bad credentials, rate limit, model unavailable, etc.)
-	// is reported as 422 because LLMs are user-configured — it's not necessarily our fault.
+	resp, err := caller.Response(ctx, instructions, string(inputBytes))
 	if err != nil {
-		// context cancellation/deadline is a client/timeout issue, not an LLM config failure
-		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-			return nil, 0, err
-		}
-		// real LLM services wrap their errors as *ai.ServiceError already; wrap anything else
-		// (e.g. from the test service) so the handler response is consistently a 422.
-		var aerr *ai.ServiceError
-		if !errors.As(err, &aerr) {
-			err = &ai.ServiceError{Message: err.Error(), Code: ai.ErrorUnknown}
-		}
 		return nil, 0, err
 	}
 
@@ -144,16 +114,3 @@ func handleTranslate(ctx context.Context, rt *runtime.Runtime, r *translateReque
 
 	return translateResponse{Items: items}, http.StatusOK, nil
 }
-
-// insertLLMCallCounts inserts the given LLM daily counts in a transaction.
-func insertLLMCallCounts(ctx context.Context, rt *runtime.Runtime, counts []*models.LLMDailyCount) error {
-	tx, err := rt.DB.BeginTxx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("error starting transaction: %w", err)
-	}
-	if err := models.InsertLLMDailyCounts(ctx, tx, counts); err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit()
-}
@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/llm/usage", web.JSONPayload(handleUsage))
+}
+
+// Reports the usage of an org's LLMs between two days inclusive, rolled up from their daily counts, in total and by
+// day, LLM and flow. Flows are ordered with the most expensive first.
+//
+//	{
+//	  "org_id": 1,
+//	  "since": "2026-05-01",
+//	  "until": "2026-05-31"
+//	}
+type usageRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+	Since string       `json:"since"  validate:"required,datetime=2006-01-02"`
+	Until string       `json:"until"  validate:"required,datetime=2006-01-02"`
+}
+
+//	{
+//	  "total": {"calls": 3, "tokens_input": 369, "tokens_output": 369, "cost_microusd": 4500, "errors": {"ratelimit": 1}},
+//	  "days": [
+//	    {"day": "2026-05-04", "calls": 3, "tokens_input": 369, "tokens_output": 369, "cost_microusd": 4500, "errors": {"ratelimit": 1}}
+//	  ],
+//	  "llms": [
+//	    {"llm_id": 1234, "calls": 3, "tokens_input": 369, "tokens_output": 369, "cost_microusd": 4500, "errors": {"ratelimit": 1}}
+//	  ],
+//	  "flows": [
+//	    {"flow_id": 345, "llm_id": 1234, "calls": 2, "tokens_input": 246, "tokens_output": 246, "cost_microusd": 3000, "errors": {}}
+//	  ]
+//	}
+func handleUsage(ctx context.Context, rt *runtime.Runtime, r *usageRequest) (any, int, error) {
+	since, _ := time.Parse(time.DateOnly, r.Since)
+	until, _ := time.Parse(time.DateOnly, r.Until)
+	if until.Before(since) {
+		return nil, http.StatusBadRequest, fmt.Errorf("until must not be before since")
+	}
+
+	report, err := models.GetLLMUsageReport(ctx, rt.DB, r.OrgID, dates.ExtractDate(since), dates.ExtractDate(until))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading llm usage: %w", err)
+	}
+
+	return report, http.StatusOK, nil
+}
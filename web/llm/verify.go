@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/llm/verify", web.JSONPayload(handleVerify))
+}
+
+// Verifies that an LLM, either an existing one or one with the given unsaved config, works by making a cheap test call
+// to its provider.
+//
+//	{
+//	  "org_id": 1,
+//	  "llm_uuid": "e5d8900a-ef54-4d2a-8214-ff7d3e903502"
+//	}
+//
+//	{
+//	  "org_id": 1,
+//	  "type": "openai",
+//	  "model": "gpt-4o",
+//	  "config": {"api_key": "sk-..."}
+//	}
+type verifyRequest struct {
+	OrgID   models.OrgID   `json:"org_id"   validate:"required"`
+	LLMUUID assets.LLMUUID `json:"llm_uuid" validate:"required_without=Type"`
+	Type    string         `json:"type"     validate:"required_without=LLMUUID"`
+	Model   string         `json:"model"    validate:"required_with=Type"`
+	Config  models.Config  `json:"config"`
+}
+
+//	{
+//	  "ok": false,
+//	  "model": "gpt-4o",
+//	  "elapsed_ms": 345,
+//	  "error": "Incorrect API key provided",
+//	  "error_code": "credentials"
+//	}
+type verifyResponse struct {
+	OK        bool   `json:"ok"`
+	Model     string `json:"model"`
+	ElapsedMS int    `json:"elapsed_ms"`
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+func handleVerify(ctx context.Context, rt *runtime.Runtime, r *verifyRequest) (any, int, error) {
+	var llm *models.LLM
+
+	if r.LLMUUID != "" {
+		oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+		}
+
+		llm = oa.LLMByUUID(r.LLMUUID)
+		if llm == nil {
+			return nil, 0, fmt.Errorf("no such LLM with UUID %s", r.LLMUUID)
+		}
+	} else {
+		llm = &models.LLM{OrgID_: r.OrgID, Type_: r.Type, Model_: r.Model, Config_: r.Config}
+	}
+
+	start := dates.Now()
+	resp, err := llm.Verify(ctx, rt, rt.HTTP.Services)
+	elapsed := dates.Since(start)
+
+	v := &verifyResponse{OK: err == nil, Model: llm.Model(), ElapsedMS: int(elapsed.Milliseconds())}
+	if err != nil {
+		v.Error = err.Error()
+		v.ErrorCode = ai.ErrorCode(err)
+	} else if resp.Model != "" {
+		v.Model = resp.Model
+	}
+
+	return v, http.StatusOK, nil
+}
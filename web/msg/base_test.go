@@ -124,3 +124,13 @@ func TestSearch(t *testing.T) {
 
 	testsuite.RunWebTests(t, rt, "testdata/search.json")
 }
+
+func TestTemplateVariables(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	testdb.InsertLLM(t, rt, testdb.Org1, "f0d5bd3e-7e31-4a52-b2e5-8b5e3a9bfe29", "test", "gpt-4", "Engine Only", map[string]any{}, "F")
+
+	testsuite.RunWebTests(t, rt, "testdata/template_variables.json")
+}
@@ -0,0 +1,153 @@
+package msg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/core/ai"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/msg/template_variables", web.JSONPayload(handleTemplateVariables))
+}
+
+// Request to generate values for the variables of a WhatsApp template being sent to a contact using an LLM, optionally
+// following instructions from the sender. Values are checked against the template so they can be sent as is.
+//
+//	{
+//	  "org_id": 1,
+//	  "llm_id": 1234,
+//	  "template_uuid": "9c22b594-fcab-4b29-9bcb-ce4404894a80",
+//	  "channel_uuid": "0f661e8b-ea9d-4bd3-9953-d368340acf91",
+//	  "locale": "eng-US",
+//	  "contact_id": 10000,
+//	  "instructions": "Ask about their internet connection"
+//	}
+type templateVariablesRequest struct {
+	OrgID        models.OrgID        `json:"org_id"        validate:"required"`
+	LLMID        models.LLMID        `json:"llm_id"        validate:"required"`
+	TemplateUUID assets.TemplateUUID `json:"template_uuid" validate:"required"`
+	ChannelUUID  assets.ChannelUUID  `json:"channel_uuid"  validate:"required"`
+	Locale       i18n.Locale         `json:"locale"        validate:"required"`
+	ContactID    models.ContactID    `json:"contact_id"    validate:"required"`
+	Instructions string              `json:"instructions"`
+}
+
+// Response with a value for each variable of the template translation, which is empty for media variables
+//
+//	{
+//	  "variables": ["Ann", "your internet connection"]
+//	}
+type templateVariablesResponse struct {
+	Variables []string `json:"variables"`
+}
+
+// handles a request to generate template variable values
+func handleTemplateVariables(ctx context.Context, rt *runtime.Runtime, r *templateVariablesRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	llm := oa.LLMByID(r.LLMID)
+	if llm == nil {
+		return nil, 0, fmt.Errorf("no such LLM with ID %d", r.LLMID)
+	}
+	if !slices.Contains(llm.Roles(), assets.LLMRoleEditing) {
+		return nil, 0, fmt.Errorf("LLM with ID %d does not support editing", r.LLMID)
+	}
+
+	template := oa.TemplateByUUID(r.TemplateUUID)
+	if template == nil {
+		return nil, 0, fmt.Errorf("no such template with UUID %s", r.TemplateUUID)
+	}
+	channel := oa.ChannelByUUID(r.ChannelUUID)
+	if channel == nil {
+		return nil, 0, fmt.Errorf("no such channel with UUID %s", r.ChannelUUID)
+	}
+	translation := template.FindTranslation(channel, r.Locale)
+	if translation == nil {
+		return nil, 0, fmt.Errorf("template %s has no translation for channel %s and locale %s", r.TemplateUUID, r.ChannelUUID, r.Locale)
+	}
+
+	values := make([]string, len(translation.Variables()))
+
+	textVars := translation.TextVariables()
+	if len(textVars) == 0 {
+		return &templateVariablesResponse{Variables: values}, http.StatusOK, nil
+	}
+
+	mc, err := models.LoadContact(ctx, rt.DB, oa, r.ContactID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading contact: %w", err)
+	}
+
+	vars := make([]*ai.TemplateVariable, len(textVars))
+	for i, v := range textVars {
+		vars[i] = &ai.TemplateVariable{Key: fmt.Sprintf("%s_%s", v.Component, v.Name), Name: v.Name, Content: v.Content, MaxLength: v.MaxLength}
+	}
+
+	input := templateVariablesContact(oa, mc)
+
+	caller, err := web.NewLLMCaller(rt, oa, llm)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var generated map[string]string
+	err = caller.Call(ctx, r.Instructions, input, func(ctx context.Context, svc flows.LLMService) (*flows.LLMResponse, error) {
+		var resp *flows.LLMResponse
+		var err error
+		generated, resp, err = ai.GenerateTemplateVariables(ctx, svc, vars, input, r.Instructions)
+		return resp, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i, v := range textVars {
+		values[v.Index] = generated[vars[i].Key]
+	}
+
+	// values which WhatsApp would reject are reported like other bad output from the LLM
+	if err := translation.ValidateVariables(values); err != nil {
+		return nil, 0, &ai.ServiceError{Message: fmt.Sprintf("generated values are invalid: %s", err), Code: ai.ErrorUnknown}
+	}
+
+	return &templateVariablesResponse{Variables: values}, http.StatusOK, nil
+}
+
+// describes a contact to the LLM by their name, language and the text values of their fields
+func templateVariablesContact(oa *models.OrgAssets, mc *models.Contact) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Name: %s\n", mc.Name())
+	if mc.Language() != "" {
+		fmt.Fprintf(&sb, "Language: %s\n", mc.Language())
+	}
+
+	keys := make([]string, 0, len(mc.Fields()))
+	for key, value := range mc.Fields() {
+		if value != nil && value.Text != nil && value.Text.Native() != "" {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		name := key
+		if field := oa.FieldByKey(key); field != nil {
+			name = field.Name()
+		}
+		fmt.Fprintf(&sb, "%s: %s\n", name, mc.Fields()[key].Text.Native())
+	}
+	return sb.String()
+}
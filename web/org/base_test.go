@@ -3,9 +3,12 @@ package org_test
 import (
 	"testing"
 
+	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/testsuite"
 	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
 	"github.com/nyaruka/vkutil/assertvk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDeindex(t *testing.T) {
@@ -25,3 +28,18 @@ func TestDeindex(t *testing.T) {
 	defer vc.Close()
 	assertvk.SMembers(t, vc, "deindex:contacts", []string{"1"})
 }
+
+func TestDefaultLLM(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	// LLM without the engine role - id will be 30000
+	testdb.InsertLLM(t, rt, testdb.Org1, "c69723d8-fb37-4cf6-9ec4-bc40cb36f2cc", "test", "gpt-4", "Editing Only", map[string]any{}, "E")
+
+	testsuite.RunWebTests(t, rt, "testdata/default_llm.json")
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+	assert.Equal(t, testdb.TestLLM.UUID, oa.Org().DefaultLLM())
+}
@@ -0,0 +1,67 @@
+package org
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/org/default_llm", web.JSONPayload(handleDefaultLLM))
+}
+
+// Sets the default LLM of an org, which is used by AI actions in flows which don't reference an LLM which exists. An
+// empty llm_uuid clears the default.
+//
+//	{
+//	  "org_id": 1,
+//	  "llm_uuid": "e5d8900a-ef54-4d2a-8214-ff7d3e903502"
+//	}
+type defaultLLMRequest struct {
+	OrgID   models.OrgID   `json:"org_id"   validate:"required"`
+	LLMUUID assets.LLMUUID `json:"llm_uuid"`
+}
+
+//	{
+//	  "default_llm": {"uuid": "e5d8900a-ef54-4d2a-8214-ff7d3e903502", "name": "GPT-4o"}
+//	}
+type defaultLLMResponse struct {
+	DefaultLLM *assets.LLMReference `json:"default_llm"`
+}
+
+func handleDefaultLLM(ctx context.Context, rt *runtime.Runtime, r *defaultLLMRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	resp := &defaultLLMResponse{}
+
+	if r.LLMUUID != "" {
+		llm := oa.LLMByUUID(r.LLMUUID)
+		if llm == nil {
+			return nil, 0, fmt.Errorf("no such LLM with UUID %s", r.LLMUUID)
+		}
+		if !slices.Contains(llm.Roles(), assets.LLMRoleEngine) {
+			return nil, 0, fmt.Errorf("LLM with UUID %s does not support flows", r.LLMUUID)
+		}
+		resp.DefaultLLM = assets.NewLLMReference(llm.UUID(), llm.Name())
+	}
+
+	if err := models.SetDefaultLLM(ctx, rt.DB, r.OrgID, r.LLMUUID); err != nil {
+		return nil, 0, err
+	}
+
+	// flows are resolved against the default when loaded so reload them too
+	if _, err := models.GetOrgAssetsWithRefresh(ctx, rt, r.OrgID, models.RefreshOrg|models.RefreshFlows); err != nil {
+		return nil, 0, fmt.Errorf("error refreshing org assets: %w", err)
+	}
+
+	return resp, http.StatusOK, nil
+}
@@ -0,0 +1,44 @@
+package prompt
+
+import (
+	"fmt"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/v26/core/models"
+)
+
+//	{
+//	  "uuid": "d2f852ec-7b4e-457f-ae7f-f8b243c49ff5",
+//	  "name": "support_triage",
+//	  "body": "You are a support agent for {product}. Categorize the message.",
+//	  "llm_uuid": "e5d8900a-ef54-4d2a-8214-ff7d3e903502",
+//	  "variables": ["product"],
+//	  "version": 2,
+//	  "modified_on": "2026-05-04T13:14:30.123456Z"
+//	}
+type promptResponse struct {
+	*models.Prompt
+
+	LLMUUID   assets.LLMUUID `json:"llm_uuid,omitempty"`
+	Variables []string       `json:"variables"`
+}
+
+func newPromptResponse(oa *models.OrgAssets, p *models.Prompt) *promptResponse {
+	r := &promptResponse{Prompt: p, Variables: p.Variables()}
+	if llm := oa.LLMByID(p.LLMID); llm != nil {
+		r.LLMUUID = llm.UUID()
+	}
+	return r
+}
+
+// resolves the optional UUID of the LLM a prompt is designed for to its ID
+func resolveLLM(oa *models.OrgAssets, uuid assets.LLMUUID) (models.LLMID, error) {
+	if uuid == "" {
+		return models.NilLLMID, nil
+	}
+	llm := oa.LLMByUUID(uuid)
+	if llm == nil {
+		return models.NilLLMID, fmt.Errorf("no such LLM with UUID %s", uuid)
+	}
+	return llm.ID(), nil
+}
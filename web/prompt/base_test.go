@@ -0,0 +1,38 @@
+package prompt_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+)
+
+func TestCreate(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	testsuite.RunWebTests(t, rt, "testdata/create.json")
+}
+
+func TestUpdate(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	testdb.InsertPrompt(t, rt, testdb.Org1, "5c1d8e2f-3a4b-4c6d-8e9f-0a1b2c3d4e5f", "support_triage", "Categorize messages about {product}.", testdb.TestLLM)
+	testdb.InsertPrompt(t, rt, testdb.Org1, "8b7a6c5d-4e3f-4a2b-9c1d-0e9f8a7b6c5d", "greeting", "Greet the contact.", nil)
+
+	testsuite.RunWebTests(t, rt, "testdata/update.json")
+}
+
+func TestPreview(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	testdb.InsertPrompt(t, rt, testdb.Org1, "5c1d8e2f-3a4b-4c6d-8e9f-0a1b2c3d4e5f", "support_triage", "Categorize messages about {product}.", testdb.TestLLM)
+	testdb.InsertPrompt(t, rt, testdb.Org1, "8b7a6c5d-4e3f-4a2b-9c1d-0e9f8a7b6c5d", "greeting", "Greet the contact.", nil)
+
+	testsuite.RunWebTests(t, rt, "testdata/preview.json")
+}
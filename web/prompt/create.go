@@ -0,0 +1,63 @@
+package prompt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/prompt/create", web.JSONPayload(handleCreate))
+}
+
+// Creates a new prompt which AI actions in flows can reference by name, optionally linked to the LLM it's designed for.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "name": "support_triage",
+//	  "body": "You are a support agent for {product}. Categorize the message.",
+//	  "llm_uuid": "e5d8900a-ef54-4d2a-8214-ff7d3e903502"
+//	}
+type createRequest struct {
+	OrgID   models.OrgID   `json:"org_id"   validate:"required"`
+	UserID  models.UserID  `json:"user_id"  validate:"required"`
+	Name    string         `json:"name"     validate:"required,max=64,excludesall=\n"`
+	Body    string         `json:"body"     validate:"required"`
+	LLMUUID assets.LLMUUID `json:"llm_uuid"`
+}
+
+func handleCreate(ctx context.Context, rt *runtime.Runtime, r *createRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	llmID, err := resolveLLM(oa, r.LLMUUID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	name := strings.TrimSpace(r.Name)
+
+	// names are how flows reference prompts so they must be unique
+	if _, err := models.GetPromptByName(ctx, rt.DB, r.OrgID, name); err == nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("prompt with name %s already exists", name)
+	} else if !errors.Is(err, models.ErrPromptNotFound) {
+		return nil, 0, err
+	}
+
+	prompt, err := models.CreatePrompt(ctx, rt.DB, r.OrgID, r.UserID, name, r.Body, llmID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error creating prompt: %w", err)
+	}
+
+	return newPromptResponse(oa, prompt), http.StatusOK, nil
+}
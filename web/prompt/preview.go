@@ -0,0 +1,104 @@
+package prompt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/prompt/preview", web.JSONPayload(handlePreview))
+}
+
+// Renders a saved prompt, or a draft body, with the given values of its variables, and if input is given, calls the
+// LLM with the rendered instructions so that changes can be tried before they're saved. The LLM defaults to the one
+// the prompt is linked to.
+//
+//	{
+//	  "org_id": 1,
+//	  "uuid": "d2f852ec-7b4e-457f-ae7f-f8b243c49ff5",
+//	  "values": {"product": "Solar Lamp"},
+//	  "input": "My lamp won't charge"
+//	}
+type previewRequest struct {
+	OrgID   models.OrgID      `json:"org_id"   validate:"required"`
+	UUID    models.PromptUUID `json:"uuid"     validate:"required_without=Body"`
+	Body    string            `json:"body"     validate:"required_without=UUID"`
+	LLMUUID assets.LLMUUID    `json:"llm_uuid"`
+	Values  map[string]string `json:"values"`
+	Input   string            `json:"input"`
+}
+
+//	{
+//	  "instructions": "You are a support agent for Solar Lamp. Categorize the message.",
+//	  "output": "Complaint",
+//	  "tokens_input": 45,
+//	  "tokens_output": 1
+//	}
+type previewResponse struct {
+	Instructions string `json:"instructions"`
+	Output       string `json:"output,omitempty"`
+	Error        string `json:"error,omitempty"`
+	TokensInput  int64  `json:"tokens_input,omitempty"`
+	TokensOutput int64  `json:"tokens_output,omitempty"`
+}
+
+func handlePreview(ctx context.Context, rt *runtime.Runtime, r *previewRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	prompt := &models.Prompt{OrgID: r.OrgID, Body: r.Body}
+	if r.UUID != "" {
+		if prompt, err = models.GetPromptByUUID(ctx, rt.DB, r.OrgID, r.UUID); err != nil {
+			return nil, 0, err
+		}
+		if r.Body != "" {
+			prompt.Body = r.Body
+		}
+	}
+
+	instructions, err := prompt.Render(r.Values)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	resp := &previewResponse{Instructions: instructions}
+	if r.Input == "" {
+		return resp, http.StatusOK, nil
+	}
+
+	llmID, err := resolveLLM(oa, r.LLMUUID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if llmID == models.NilLLMID {
+		llmID = prompt.LLMID
+	}
+	llm := oa.LLMByID(llmID)
+	if llm == nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("an LLM is required to preview a prompt which isn't linked to one")
+	}
+
+	caller, err := web.NewLLMCaller(rt, oa, llm)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	llmResp, err := caller.Response(ctx, instructions, r.Input)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Output = llmResp.Output
+		resp.TokensInput = llmResp.TokensInput
+		resp.TokensOutput = llmResp.TokensOutput
+	}
+
+	return resp, http.StatusOK, nil
+}
@@ -0,0 +1,70 @@
+package prompt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/prompt/update", web.JSONPayload(handleUpdate))
+}
+
+// Saves a new version of a prompt, which takes effect in all flows which reference it. The name and LLM are unchanged
+// if they're omitted.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "uuid": "d2f852ec-7b4e-457f-ae7f-f8b243c49ff5",
+//	  "body": "You are a friendly support agent for {product}. Categorize the message."
+//	}
+type updateRequest struct {
+	OrgID   models.OrgID      `json:"org_id"   validate:"required"`
+	UserID  models.UserID     `json:"user_id"  validate:"required"`
+	UUID    models.PromptUUID `json:"uuid"     validate:"required"`
+	Name    string            `json:"name"     validate:"max=64,excludesall=\n"`
+	Body    string            `json:"body"     validate:"required"`
+	LLMUUID assets.LLMUUID    `json:"llm_uuid"`
+}
+
+func handleUpdate(ctx context.Context, rt *runtime.Runtime, r *updateRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	prompt, err := models.GetPromptByUUID(ctx, rt.DB, r.OrgID, r.UUID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	name, llmID := prompt.Name, prompt.LLMID
+
+	if n := strings.TrimSpace(r.Name); n != "" && n != name {
+		if other, err := models.GetPromptByName(ctx, rt.DB, r.OrgID, n); err == nil && other.ID != prompt.ID {
+			return nil, http.StatusBadRequest, fmt.Errorf("prompt with name %s already exists", n)
+		} else if err != nil && !errors.Is(err, models.ErrPromptNotFound) {
+			return nil, 0, err
+		}
+		name = n
+	}
+	if r.LLMUUID != "" {
+		if llmID, err = resolveLLM(oa, r.LLMUUID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err := prompt.Update(ctx, rt.DB, r.UserID, name, r.Body, llmID); err != nil {
+		return nil, 0, fmt.Errorf("error updating prompt: %w", err)
+	}
+
+	return newPromptResponse(oa, prompt), http.StatusOK, nil
+}
@@ -145,6 +145,13 @@ func handleIncoming(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAsse
 		// build our resume URL
 		resumeURL := buildResumeURL(rt.Config, ch, call)
 
+		handed, err := ivr.HandOffToAgent(ctx, rt, oa, svc, ch, scene, resumeURL, w)
+		if err != nil {
+			return call, fmt.Errorf("error handing call to agent: %w", err)
+		} else if handed {
+			return call, nil
+		}
+
 		// have our client output our session status
 		err = svc.WriteSessionResponse(ctx, rt, oa, ch, scene, urn, resumeURL, r, w)
 		if err != nil {
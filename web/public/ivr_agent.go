@@ -0,0 +1,69 @@
+package public
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/v26/core/ivr"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.PublicRoute(http.MethodGet, "/ivr/c/{uuid:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}}/agent", handleAgentStream)
+}
+
+var agentUpgrader = websocket.Upgrader{}
+
+// handles the media stream of a call which has been handed to a voice agent, for as long as the agent talks to the caller
+func handleAgentStream(ctx context.Context, rt *runtime.Runtime, r *http.Request, w http.ResponseWriter) error {
+	channelUUID := assets.ChannelUUID(r.PathValue("uuid"))
+
+	orgID, err := models.OrgIDForChannelUUID(ctx, rt.DB, channelUUID)
+	if err != nil {
+		return writeGenericErrorResponse(w, err)
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, orgID)
+	if err != nil {
+		return writeGenericErrorResponse(w, fmt.Errorf("error loading org assets: %w", err))
+	}
+
+	ch := oa.ChannelByUUID(channelUUID)
+	if ch == nil {
+		return writeGenericErrorResponse(w, fmt.Errorf("no active channel with uuid: %s", channelUUID))
+	}
+
+	svc, err := ivr.GetService(rt.HTTP.Services, ch)
+	if err != nil {
+		return writeGenericErrorResponse(w, fmt.Errorf("unable to get service for channel: %s: %w", ch.UUID(), err))
+	}
+	asvc, ok := svc.(ivr.AgentService)
+	if !ok {
+		return writeGenericErrorResponse(w, fmt.Errorf("channel %s doesn't support voice agents", ch.UUID()))
+	}
+
+	if err := svc.ValidateRequestSignature(r); err != nil {
+		return writeGenericErrorResponse(w, fmt.Errorf("request failed signature validation: %w", err))
+	}
+
+	conn, err := agentUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil // upgrader has already written an error response
+	}
+
+	stream := asvc.NewMediaStream(conn)
+	defer stream.Close()
+
+	// calls last longer than requests so the agent isn't bound by the request context
+	if err := ivr.RunAgent(context.WithoutCancel(ctx), rt, oa, ch, stream); err != nil {
+		slog.Error("error running voice agent", "error", err, "channel", ch.UUID())
+	}
+
+	return nil
+}
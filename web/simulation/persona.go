@@ -0,0 +1,204 @@
+package simulation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/goflow/flows/resumes"
+	"github.com/nyaruka/goflow/flows/triggers"
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+	"github.com/nyaruka/mailroom/v26/core/goflow"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+// output of the persona LLM when the contact has nothing more to say
+const personaEnd = "<END>"
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/sim/persona", web.JSONPayload(handlePersona))
+}
+
+// Starts a new engine session and has an LLM play the contact for up to the given number of turns, e.g. to smoke test
+// a conversational flow before it's published.
+//
+//	{
+//	  "org_id": 1,
+//	  "llm_id": 1234,
+//	  "persona": "A farmer from Jacmel who is worried about her crops and answers briefly in Haitian Creole",
+//	  "turns": 5,
+//	  "contact": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "name": "Bob", ...},
+//	  "trigger": {...},
+//	  "assets": {...}
+//	}
+type personaRequest struct {
+	sessionRequest
+
+	Trigger json.RawMessage `json:"trigger" validate:"required"`
+	LLMID   models.LLMID    `json:"llm_id"  validate:"required"`
+	Persona string          `json:"persona" validate:"required"`
+	Turns   int             `json:"turns"   validate:"required,min=1,max=20"`
+}
+
+// Response for a persona simulation, which includes the transcript of the conversation and the text of any errors or
+// failures in the flow, as well as the session and all its events.
+//
+//	{
+//	  "session": {...},
+//	  "contact": {...},
+//	  "events": [...],
+//	  "transcript": [
+//	    {"from": "flow", "text": "What is your favorite color?"},
+//	    {"from": "contact", "text": "Blue"}
+//	  ],
+//	  "errors": []
+//	}
+type personaResponse struct {
+	Session    flows.Session          `json:"session"`
+	Contact    *flows.ContactEnvelope `json:"contact"`
+	Events     []flows.Event          `json:"events"`
+	Transcript []*personaTurn         `json:"transcript"`
+	Errors     []string               `json:"errors"`
+}
+
+type personaTurn struct {
+	From string `json:"from"`
+	Text string `json:"text"`
+}
+
+// handles a request to /persona
+func handlePersona(ctx context.Context, rt *runtime.Runtime, r *personaRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	llm := oa.LLMByID(r.LLMID)
+	if llm == nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("no such LLM with ID %d", r.LLMID)
+	}
+
+	caller, err := web.NewLLMCaller(rt, oa, llm)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// create clone of assets for simulation
+	simOA, err := oa.CloneForSimulation(ctx, rt, r.channels())
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("unable to clone org: %w", err)
+	}
+
+	contact, err := r.Contact.Unmarshal(simOA.SessionAssets(), assets.IgnoreMissing)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("unable to read contact: %w", err)
+	}
+
+	var call *flows.Call
+	if r.Call != nil {
+		call = r.Call.Unmarshal(simOA.SessionAssets(), assets.IgnoreMissing)
+	}
+
+	trigger, err := triggers.Read(simOA.SessionAssets(), r.Trigger, assets.IgnoreMissing)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("unable to read trigger: %w", err)
+	}
+
+	session, sprint, err := goflow.Simulator(ctx, rt).NewSession(ctx, simOA.SessionAssets(), simOA.Env(), contact, trigger, call)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error starting session: %w", err)
+	}
+
+	resp := &personaResponse{Session: session, Transcript: []*personaTurn{}, Errors: []string{}}
+	if err := resp.addSprint(ctx, rt, simOA, sprint); err != nil {
+		return nil, 0, err
+	}
+
+	urn := testURN
+	if len(contact.URNs()) > 0 {
+		urn = contact.URNs()[0].Identity()
+	}
+
+	instructions := prompts.Render("sim_persona", map[string]any{"Persona": r.Persona})
+
+	for range r.Turns {
+		if session.Status() != flows.SessionStatusWaiting {
+			break
+		}
+
+		input := resp.transcriptText()
+
+		llmResp, err := caller.Response(ctx, instructions, input)
+
+		// the persona failing ends the conversation but is reported like a flow error
+		if err != nil {
+			resp.Errors = append(resp.Errors, fmt.Sprintf("persona LLM error: %s", err))
+			break
+		}
+
+		text := strings.TrimSpace(llmResp.Output)
+		if text == "" || text == personaEnd {
+			break
+		}
+
+		msgEvt := events.NewMsgReceived(flows.NewMsgIn(urn, nil, text, nil, ""), "")
+
+		sprint, err := session.Resume(ctx, resumes.NewMsg(msgEvt))
+		if err != nil {
+			return nil, 0, fmt.Errorf("error resuming session: %w", err)
+		}
+
+		if err := resp.addSprint(ctx, rt, simOA, sprint); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	resp.Contact = session.Contact().Marshal()
+
+	return resp, http.StatusOK, nil
+}
+
+// adds the events of a sprint to this response, including any messages to the transcript and errors to the errors
+func (r *personaResponse) addSprint(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, sprint flows.Sprint) error {
+	if err := handleSimulationEvents(ctx, rt.DB, oa, sprint.Events()); err != nil {
+		return fmt.Errorf("error handling simulation events: %w", err)
+	}
+
+	for _, e := range sprint.Events() {
+		switch typed := e.(type) {
+		case *events.MsgCreated:
+			r.Transcript = append(r.Transcript, &personaTurn{From: "flow", Text: typed.Msg.Text()})
+		case *events.MsgReceived:
+			r.Transcript = append(r.Transcript, &personaTurn{From: "contact", Text: typed.Msg.Text()})
+		case *events.Error:
+			r.Errors = append(r.Errors, typed.Text)
+		case *events.Failure:
+			r.Errors = append(r.Errors, typed.Text)
+		}
+	}
+
+	r.Events = append(r.Events, sprint.Events()...)
+	return nil
+}
+
+// formats the transcript as the input for the persona LLM
+func (r *personaResponse) transcriptText() string {
+	var sb strings.Builder
+	for _, t := range r.Transcript {
+		if t.From == "flow" {
+			sb.WriteString("Service: ")
+		} else {
+			sb.WriteString("Contact: ")
+		}
+		sb.WriteString(t.Text)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
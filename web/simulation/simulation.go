@@ -55,9 +55,10 @@ type simulationResponse struct {
 	Events   []flows.Event          `json:"events"`
 	Segments []flows.Segment        `json:"segments"`
 	Context  *types.XObject         `json:"context,omitempty"`
+	LLMLogs  []*flows.HTTPLog       `json:"llm_logs,omitempty"`
 }
 
-func newSimulationResponse(session flows.Session, sprint flows.Sprint) *simulationResponse {
+func newSimulationResponse(session flows.Session, sprint flows.Sprint, llmLogs []*flows.HTTPLog) *simulationResponse {
 	var context *types.XObject
 	if session != nil {
 		context = session.CurrentContext()
@@ -75,6 +76,7 @@ func newSimulationResponse(session flows.Session, sprint flows.Sprint) *simulati
 		Events:   sprint.Events(),
 		Segments: sprint.Segments(),
 		Context:  context,
+		LLMLogs:  llmLogs,
 	}
 }
 
@@ -144,6 +146,11 @@ func handleStart(ctx context.Context, rt *runtime.Runtime, r *startRequest) (any
 
 // triggerFlow creates a new session with the passed in trigger, returning our standard response
 func triggerFlow(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, contact *flows.Contact, call *flows.Call, trigger flows.Trigger) (any, int, error) {
+	// log the requests of any LLM calls so that they can be inspected
+	llmLogs := models.NewLLMHTTPLogs()
+	ctx = models.WithLLMHTTPLogs(ctx, llmLogs)
+	ctx = models.WithLLMVariables(ctx, models.NewLLMVariables(oa, contact, nil))
+
 	// start our flow session
 	session, sprint, err := goflow.Simulator(ctx, rt).NewSession(ctx, oa.SessionAssets(), oa.Env(), contact, trigger, call)
 	if err != nil {
@@ -155,7 +162,7 @@ func triggerFlow(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets,
 		return nil, 0, fmt.Errorf("error handling simulation events: %w", err)
 	}
 
-	return newSimulationResponse(session, sprint), http.StatusOK, nil
+	return newSimulationResponse(session, sprint, llmLogs.Logs()), http.StatusOK, nil
 }
 
 // Resumes an existing engine session
@@ -258,6 +265,11 @@ func handleResume(ctx context.Context, rt *runtime.Runtime, r *resumeRequest) (a
 		return &simulationResponse{Session: session, Events: nil}, http.StatusOK, nil
 	}
 
+	// log the requests of any LLM calls so that they can be inspected
+	llmLogs := models.NewLLMHTTPLogs()
+	ctx = models.WithLLMHTTPLogs(ctx, llmLogs)
+	ctx = models.WithLLMVariables(ctx, models.NewLLMVariables(oa, contact, session))
+
 	// resume our session
 	sprint, err := session.Resume(ctx, resume)
 	if err != nil {
@@ -269,5 +281,5 @@ func handleResume(ctx context.Context, rt *runtime.Runtime, r *resumeRequest) (a
 		return nil, 0, fmt.Errorf("error handling simulation events: %w", err)
 	}
 
-	return newSimulationResponse(session, sprint), http.StatusOK, nil
+	return newSimulationResponse(session, sprint, llmLogs.Logs()), http.StatusOK, nil
 }
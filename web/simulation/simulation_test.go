@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/testsuite"
@@ -230,3 +231,32 @@ func TestServer(t *testing.T) {
 		assert.Contains(t, string(content), tc.ExpectedResponse, "%d: did not find expected response content", i)
 	}
 }
+
+func TestPersona(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer testsuite.Reset(t, rt, testsuite.ResetData)
+
+	r := &personaRequest{LLMID: testdb.TestLLM.ID, Persona: "Someone who likes blue", Turns: 2}
+	jsonx.MustUnmarshal([]byte(startBody), r)
+
+	resp, status, err := handlePersona(ctx, rt, r)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+
+	// test LLM echoes its prompt which isn't a color, so the flow keeps asking
+	presp := resp.(*personaResponse)
+	if assert.Len(t, presp.Transcript, 5) {
+		assert.Equal(t, &personaTurn{From: "flow", Text: "What is your favorite color?"}, presp.Transcript[0])
+		assert.Equal(t, "contact", presp.Transcript[1].From)
+		assert.Contains(t, presp.Transcript[1].Text, "Service: What is your favorite color?")
+		assert.Equal(t, "flow", presp.Transcript[2].From)
+		assert.Equal(t, "contact", presp.Transcript[3].From)
+		assert.Equal(t, "flow", presp.Transcript[4].From)
+	}
+	assert.Equal(t, []string{}, presp.Errors)
+	assert.NotNil(t, presp.Session)
+	assert.NotNil(t, presp.Contact)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM ai_llmcall WHERE llm_id = $1 AND status = 'S'`, testdb.TestLLM.ID).Returns(2)
+}
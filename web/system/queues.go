@@ -28,7 +28,7 @@ func handleQueues(ctx context.Context, rt *runtime.Runtime, r *queuesRequest) (a
 
 	resp := map[string]any{}
 
-	for _, queue := range []queues.Fair{rt.Queues.Realtime, rt.Queues.Batch, rt.Queues.Throttled} {
+	for _, queue := range []queues.Fair{rt.Queues.Realtime, rt.Queues.Batch, rt.Queues.Throttled, rt.Queues.AI} {
 		dump, err := queue.Dump(ctx, vc)
 		if err != nil {
 			return nil, 0, fmt.Errorf("error dumping queue %s: %w", queue, err)
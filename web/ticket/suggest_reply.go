@@ -0,0 +1,116 @@
+package ticket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/core/ai/prompts"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+const (
+	suggestReplyMsgLimit = 20 // number of most recent messages the LLM is given to suggest replies from
+	suggestReplyMax      = 3  // maximum number of suggested replies returned
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/ticket/suggest_reply", web.JSONPayload(handleSuggestReply))
+}
+
+// Suggests replies to a ticket using an LLM, written in the contact's language.
+//
+//	{
+//	  "org_id": 1,
+//	  "llm_id": 1234,
+//	  "ticket_uuid": "01992f54-5ab6-717a-a39e-e8ca91fb7262"
+//	}
+type suggestReplyRequest struct {
+	OrgID      models.OrgID     `json:"org_id"      validate:"required"`
+	LLMID      models.LLMID     `json:"llm_id"      validate:"required"`
+	TicketUUID flows.TicketUUID `json:"ticket_uuid" validate:"required"`
+}
+
+//	{
+//	  "replies": ["Thanks for getting in touch!", "Could you tell us more?"]
+//	}
+type suggestReplyResponse struct {
+	Replies []string `json:"replies"`
+}
+
+func handleSuggestReply(ctx context.Context, rt *runtime.Runtime, r *suggestReplyRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	llm := oa.LLMByID(r.LLMID)
+	if llm == nil {
+		return nil, 0, fmt.Errorf("no such LLM with ID %d", r.LLMID)
+	}
+	if !slices.Contains(llm.Roles(), assets.LLMRoleEditing) {
+		return nil, 0, fmt.Errorf("LLM with ID %d does not support editing", r.LLMID)
+	}
+
+	tickets, err := models.LoadTickets(ctx, rt.DB, oa.OrgID(), []flows.TicketUUID{r.TicketUUID})
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading ticket: %w", err)
+	}
+	if len(tickets) == 0 {
+		return nil, 0, fmt.Errorf("no such ticket: %s", r.TicketUUID)
+	}
+	ticket := tickets[0]
+
+	mc, err := models.LoadContact(ctx, rt.DB, oa, ticket.ContactID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading contact: %w", err)
+	}
+
+	transcript, err := models.GetRecentContactTranscript(ctx, rt.DB, oa.OrgID(), ticket.ContactID, suggestReplyMsgLimit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading recent messages: %w", err)
+	}
+	if transcript == "" {
+		return &suggestReplyResponse{Replies: []string{}}, http.StatusOK, nil
+	}
+
+	language := mc.Language()
+	if language == "" {
+		language = oa.Env().DefaultLanguage()
+	}
+
+	caller, err := web.NewLLMCaller(rt, oa, llm)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	instructions := prompts.Render("suggest_replies", map[string]any{"Language": language})
+
+	resp, err := caller.Response(ctx, instructions, transcript)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// suggestions are optional for agents so unparseable output just means there are none
+	var suggested []string
+	if err := json.Unmarshal([]byte(resp.Output), &suggested); err != nil {
+		slog.Warn("suggest reply: failed to parse LLM output", "error", err, "output", resp.Output, "llm_id", r.LLMID)
+	}
+
+	replies := make([]string, 0, suggestReplyMax)
+	for _, s := range suggested {
+		if s = strings.TrimSpace(s); s != "" && len(replies) < suggestReplyMax {
+			replies = append(replies, s)
+		}
+	}
+
+	return &suggestReplyResponse{Replies: replies}, http.StatusOK, nil
+}
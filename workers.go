@@ -193,10 +193,16 @@ func (w *Worker) handleTask(task *queues.Task) {
 	log.Info("task started")
 	start := time.Now()
 
-	if err := tasks.Perform(context.Background(), w.foreman.rt, task); err != nil {
+	err := tasks.Perform(context.Background(), w.foreman.rt, task)
+	if err != nil {
 		log.Error("error running task", "task", string(task.Task), "error", err)
 	}
 
 	elapsed := time.Since(start)
+
+	// tasks on the AI queue are instrumented so that provider slowness shows up as queue latency
+	if w.foreman.queue == w.foreman.rt.Queues.AI {
+		w.foreman.rt.Stats.RecordAITask(task.Type, elapsed, start.Sub(task.QueuedOn), err != nil)
+	}
 	log.Info("task complete", "elapsed", elapsed)
 }